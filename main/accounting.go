@@ -0,0 +1,278 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jobAccounting is the final sacct record of a finished job, stored once on
+// completion so that list and stats need no remote calls.
+type jobAccounting struct {
+	Elapsed   time.Duration // -1 when unknown
+	ExitCode  string        // "code:signal"
+	MaxRSS    int64         // bytes, peak over the job's steps; -1 when unknown
+	TotalCPU  time.Duration // -1 when unknown
+	NodeList  string
+	Partition string
+	Note      string    // why the record is missing, e.g. sacct is disabled
+	Start     time.Time // the first allocation's start; zero when unknown
+	End       time.Time // the last allocation's end; zero when unknown
+
+	// Not stored: they feed the job's reason (see jobOutcome).
+	State  string // e.g. "CANCELLED by 1234"
+	Reason string // e.g. NonZeroExitCode
+}
+
+// unknownAccounting is a record with nothing known yet.
+func unknownAccounting() jobAccounting {
+	return jobAccounting{Elapsed: -1, MaxRSS: -1, TotalCPU: -1}
+}
+
+// recorded reports whether anything, even a note, was stored.
+func (a jobAccounting) recorded() bool {
+	return a != unknownAccounting()
+}
+
+// sacctAccountingFields is the -o list parseSacctAccounting expects. Slurm
+// releases without the Reason field get the list without it.
+const sacctAccountingFields = "JobID,Elapsed,ExitCode,MaxRSS,TotalCPU,NodeList,Partition,State,Start,End,Reason"
+
+// queryJobAccounting runs one sacct query for the job's final accounting.
+// -D lists every allocation of a job that was preempted and requeued, not
+// only the last, so Start is when it first ran. A cluster without accounting
+// yields a record carrying only a note.
+func queryJobAccounting(remote string, sshOpts sshHostOptions, cluster, jobID string) jobAccounting {
+	out, err := sshCommand(remote, sshOpts, slurmArgs(cluster, "sacct", "-n", "-P", "-D", "-j", jobID, "-o", sacctAccountingFields)...).CombinedOutput()
+	if err != nil && strings.Contains(strings.ToLower(string(out)), "invalid field") {
+		fields := strings.TrimSuffix(sacctAccountingFields, ",Reason")
+		out, err = sshCommand(remote, sshOpts, slurmArgs(cluster, "sacct", "-n", "-P", "-D", "-j", jobID, "-o", fields)...).CombinedOutput()
+	}
+	if err != nil {
+		acct := unknownAccounting()
+		acct.Note = "sacct unavailable"
+		if first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n"); first != "" {
+			acct.Note += ": " + first
+		}
+		return acct
+	}
+	acct, err := parseSacctAccounting(jobID, string(out))
+	if err != nil {
+		acct.Note = err.Error()
+	}
+	return acct
+}
+
+// parseSacctAccounting reads sacct -P output for sacctAccountingFields. The
+// allocation line (the job ID itself) carries elapsed time, exit code, nodes
+// and partition; MaxRSS is only reported on steps such as ".batch", so the
+// peak over all lines is taken. Fields the allocation line leaves empty fall
+// back to the batch step's. Start is the earliest of the allocations'.
+func parseSacctAccounting(jobID, out string) (jobAccounting, error) {
+	acct := unknownAccounting()
+	var alloc, batch []string
+	var start time.Time
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		f := strings.Split(line, "|")
+		if len(f) < 7 || f[0] == "JobID" {
+			continue
+		}
+		step, _, isStep := strings.Cut(f[0], ".")
+		if step != jobID && !strings.HasPrefix(step, jobID+"_") {
+			continue
+		}
+		switch {
+		case !isStep:
+			// A requeued job lists its latest allocation last.
+			alloc = f
+			if len(f) > 8 {
+				if t := parseSlurmTime(f[8]); !t.IsZero() && (start.IsZero() || t.Before(start)) {
+					start = t
+				}
+			}
+		case strings.HasSuffix(f[0], ".batch"):
+			batch = f
+		}
+		if f[3] != "" {
+			if rss, err := parseSize(f[3]); err == nil && rss > acct.MaxRSS {
+				acct.MaxRSS = rss
+			}
+		}
+	}
+	if alloc == nil && batch == nil {
+		return acct, fmt.Errorf("sacct has no record of job %s", jobID)
+	}
+	field := func(i int) string {
+		if alloc != nil && alloc[i] != "" {
+			return alloc[i]
+		}
+		if batch != nil {
+			return batch[i]
+		}
+		return ""
+	}
+	if d, ok := parseSlurmDuration(field(1)); ok {
+		acct.Elapsed = d
+	}
+	acct.ExitCode = field(2)
+	if d, ok := parseSlurmDuration(field(4)); ok {
+		acct.TotalCPU = d
+	}
+	acct.NodeList = field(5)
+	if alloc != nil {
+		acct.Partition = alloc[6]
+		if len(alloc) > 7 {
+			acct.State = alloc[7]
+		}
+		if len(alloc) > 9 {
+			acct.Start = start
+			acct.End = parseSlurmTime(alloc[9])
+		}
+		if len(alloc) > 10 {
+			acct.Reason = alloc[10]
+		}
+	}
+	return acct, nil
+}
+
+// outcome is what the record says about how the job ended.
+func (a jobAccounting) outcome() jobOutcome {
+	_, detail := splitSlurmState(a.State)
+	return jobOutcome{Detail: detail, ExitCode: a.ExitCode, Reason: a.Reason, MaxRSS: a.MaxRSS}
+}
+
+// parseSlurmDuration parses Slurm's [DD-][HH:]MM:SS[.sss] times.
+func parseSlurmDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	var days int
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		days, s = n, rest
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	secs, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	total := time.Duration(days)*24*time.Hour + time.Duration(secs*float64(time.Second))
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		total += time.Duration(n) * unit
+		unit *= 60
+	}
+	return total, true
+}
+
+// formatSlurmDuration renders d the way sacct shows Elapsed.
+func formatSlurmDuration(d time.Duration) string {
+	secs := int64(d.Round(time.Second) / time.Second)
+	days, secs := secs/86400, secs%86400
+	s := fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	if days > 0 {
+		s = fmt.Sprintf("%d-%s", days, s)
+	}
+	return s
+}
+
+// recordJobAccounting stores acct on experiment id; unknown fields stay
+// NULL.
+func recordJobAccounting(db execer, id int64, acct jobAccounting) error {
+	var elapsed, maxRSS, cpu interface{}
+	if acct.Elapsed >= 0 {
+		elapsed = int64(acct.Elapsed / time.Second)
+	}
+	if acct.MaxRSS >= 0 {
+		maxRSS = acct.MaxRSS
+	}
+	if acct.TotalCPU >= 0 {
+		cpu = acct.TotalCPU.Seconds()
+	}
+	_, err := db.Exec(`UPDATE experiments SET job_elapsed_seconds = ?, job_exit_code = ?, job_max_rss = ?,
+                                   job_total_cpu_seconds = ?, job_node_list = ?, job_partition = ?,
+                                   job_accounting_note = ?, job_start_at = ?, job_end_at = ?
+                             WHERE id = ?`,
+		elapsed, nullString(acct.ExitCode), maxRSS, cpu, nullString(acct.NodeList), nullString(acct.Partition),
+		nullString(acct.Note), nullTime(acct.Start), nullTime(acct.End), id)
+	return err
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// scanAccounting builds a record from the job_* columns.
+func scanAccounting(elapsed, maxRSS sql.NullInt64, cpu sql.NullFloat64, exitCode, nodes, partition, note, start, end sql.NullString) jobAccounting {
+	acct := unknownAccounting()
+	if elapsed.Valid {
+		acct.Elapsed = time.Duration(elapsed.Int64) * time.Second
+	}
+	if maxRSS.Valid {
+		acct.MaxRSS = maxRSS.Int64
+	}
+	if cpu.Valid {
+		acct.TotalCPU = time.Duration(cpu.Float64 * float64(time.Second))
+	}
+	acct.ExitCode = exitCode.String
+	acct.NodeList = nodes.String
+	acct.Partition = partition.String
+	acct.Note = note.String
+	acct.Start, _ = time.Parse(time.RFC3339, start.String)
+	acct.End, _ = time.Parse(time.RFC3339, end.String)
+	return acct
+}
+
+// summary renders the record for exp show and the monitor log.
+func (a jobAccounting) summary() string {
+	var parts []string
+	if a.Elapsed >= 0 {
+		parts = append(parts, "elapsed "+formatSlurmDuration(a.Elapsed))
+	}
+	if a.ExitCode != "" {
+		parts = append(parts, "exit code "+a.ExitCode)
+	}
+	if a.MaxRSS >= 0 {
+		parts = append(parts, "max RSS "+formatBytes(a.MaxRSS))
+	}
+	if a.TotalCPU >= 0 {
+		parts = append(parts, "CPU "+formatSlurmDuration(a.TotalCPU))
+	}
+	if a.Partition != "" {
+		parts = append(parts, "partition "+a.Partition)
+	}
+	if a.NodeList != "" {
+		parts = append(parts, "nodes "+a.NodeList)
+	}
+	if a.Note != "" {
+		parts = append(parts, "("+a.Note+")")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSacctAccounting(t *testing.T) {
+	cases := []struct {
+		name, jobID, out string
+		want             jobAccounting
+	}{
+		{
+			name:  "batch and extern steps",
+			jobID: "4242",
+			out: "4242|01:02:03|0:0||02:00:10|gpu-[01-02]|gpu\n" +
+				"4242.batch|01:02:03|0:0|1536000K|02:00:09|gpu-01|\n" +
+				"4242.extern|01:02:03|0:0|0|00:00:00.001|gpu-[01-02]|\n",
+			want: jobAccounting{Elapsed: time.Hour + 2*time.Minute + 3*time.Second, ExitCode: "0:0", MaxRSS: 1536000 << 10,
+				TotalCPU: 2*time.Hour + 10*time.Second, NodeList: "gpu-[01-02]", Partition: "gpu"},
+		},
+		{
+			name:  "srun steps report the larger peak",
+			jobID: "77",
+			out: "77|1-00:00:05|1:0||3-04:05:06|cpu-7|long\n" +
+				"77.batch|1-00:00:05|1:0|2.50G|00:10.500|cpu-7|\n" +
+				"77.0|23:59:00|1:0|12G|3-03:54:55|cpu-7|\n",
+			want: jobAccounting{Elapsed: 24*time.Hour + 5*time.Second, ExitCode: "1:0", MaxRSS: 12 << 30,
+				TotalCPU: 3*24*time.Hour + 4*time.Hour + 5*time.Minute + 6*time.Second, NodeList: "cpu-7", Partition: "long"},
+		},
+		{
+			// Too short for the accounting poller to sample memory.
+			name:  "short job without MaxRSS",
+			jobID: "9",
+			out:   "9|00:00:02|0:0||00:00.012|n1|debug\n9.batch|00:00:02|0:0||00:00.012|n1|\n",
+			want: jobAccounting{Elapsed: 2 * time.Second, ExitCode: "0:0", MaxRSS: -1,
+				TotalCPU: 12 * time.Millisecond, NodeList: "n1", Partition: "debug"},
+		},
+		{
+			name:  "killed by a signal, requeued once",
+			jobID: "500",
+			out: "500|00:05:00|0:15||00:04:00|n2|short\n" +
+				"500|00:07:30|0:9||00:07:00|n3|short\n" +
+				"500.batch|00:07:30|0:9|300M|00:07:00|n3|\n",
+			want: jobAccounting{Elapsed: 7*time.Minute + 30*time.Second, ExitCode: "0:9", MaxRSS: 300 << 20,
+				TotalCPU: 7 * time.Minute, NodeList: "n3", Partition: "short"},
+		},
+		{
+			name:  "array task",
+			jobID: "600_3",
+			out:   "600_3|00:00:30|0:0||00:00:29|n4|batch\n600_3.batch|00:00:30|0:0|10M|00:00:29|n4|\n",
+			want: jobAccounting{Elapsed: 30 * time.Second, ExitCode: "0:0", MaxRSS: 10 << 20,
+				TotalCPU: 29 * time.Second, NodeList: "n4", Partition: "batch"},
+		},
+		{
+			name:  "out of memory, with State and Reason",
+			jobID: "910",
+			out: "910|00:42:00|0:125||00:41:00|n6|gpu|OUT_OF_MEMORY|Unknown|Unknown|OutOfMemory\n" +
+				"910.batch|00:42:00|0:125|31G|00:41:00|n6||OUT_OF_MEMORY|Unknown|Unknown|\n",
+			want: jobAccounting{Elapsed: 42 * time.Minute, ExitCode: "0:125", MaxRSS: 31 << 30,
+				TotalCPU: 41 * time.Minute, NodeList: "n6", Partition: "gpu", State: "OUT_OF_MEMORY", Reason: "OutOfMemory"},
+		},
+		{
+			name:  "preempted twice, with Start and End",
+			jobID: "700",
+			out: "700|00:20:00|0:0||00:19:00|n7|preempt|PREEMPTED|2025-03-01T10:00:00|2025-03-01T10:20:00|None\n" +
+				"700|00:15:00|0:0||00:14:00|n8|preempt|PREEMPTED|2025-03-01T10:30:00|2025-03-01T10:45:00|None\n" +
+				"700|01:00:00|0:0||00:59:00|n7|preempt|COMPLETED|2025-03-01T11:00:00|2025-03-01T12:00:00|None\n" +
+				"700.batch|01:00:00|0:0|2G|00:59:00|n7||COMPLETED|2025-03-01T11:00:00|2025-03-01T12:00:00|\n",
+			want: jobAccounting{Elapsed: time.Hour, ExitCode: "0:0", MaxRSS: 2 << 30, TotalCPU: 59 * time.Minute,
+				NodeList: "n7", Partition: "preempt", State: "COMPLETED", Reason: "None",
+				Start: parseSlurmTime("2025-03-01T10:00:00"), End: parseSlurmTime("2025-03-01T12:00:00")},
+		},
+		{
+			name:  "allocation line purged, batch step left",
+			jobID: "8",
+			out:   "8.batch|00:01:00|2:0|5M|00:00:50|n5|\n",
+			want: jobAccounting{Elapsed: time.Minute, ExitCode: "2:0", MaxRSS: 5 << 20,
+				TotalCPU: 50 * time.Second, NodeList: "n5"},
+		},
+	}
+	for _, c := range cases {
+		got, err := parseSacctAccounting(c.jobID, c.out)
+		if err != nil || got != c.want {
+			t.Errorf("%s: parseSacctAccounting = %+v, %v\nwant %+v", c.name, got, err, c.want)
+		}
+	}
+
+	for _, out := range []string{"", "Slurm accounting storage is disabled\n", "1234|00:00:01|0:0||00:00:01|n1|p\n"} {
+		got, err := parseSacctAccounting("99", out)
+		if err == nil || got.recorded() {
+			t.Errorf("parseSacctAccounting(%q) = %+v, %v; want an error and nothing recorded", out, got, err)
+		}
+	}
+}
+
+func TestParseSlurmDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"00:00:00":     0,
+		"12:34":        12*time.Minute + 34*time.Second,
+		"01:00.250":    time.Minute + 250*time.Millisecond,
+		"10:11:12":     10*time.Hour + 11*time.Minute + 12*time.Second,
+		"2-03:04:05":   2*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second,
+		"1-00:00:00.5": 24*time.Hour + 500*time.Millisecond,
+	} {
+		if got, ok := parseSlurmDuration(in); !ok || got != want {
+			t.Errorf("parseSlurmDuration(%q) = %s, %v; want %s", in, got, ok, want)
+		}
+	}
+	for _, bad := range []string{"", "INVALID", "UNLIMITED", "1:2:3:4", "x-01:00:00"} {
+		if _, ok := parseSlurmDuration(bad); ok {
+			t.Errorf("parseSlurmDuration(%q) should fail", bad)
+		}
+	}
+	if got := formatSlurmDuration(26*time.Hour + 61*time.Second); got != "1-02:01:01" {
+		t.Errorf("formatSlurmDuration = %s", got)
+	}
+}
+
+func TestRecordJobAccounting(t *testing.T) {
+	db := openTestDB(t)
+	done := insertTestExperiment(t, db, "done", "COMPLETED", "")
+	noAcct := insertTestExperiment(t, db, "no-acct", "COMPLETED", "")
+	older := insertTestExperiment(t, db, "older", "COMPLETED", "")
+
+	acct := jobAccounting{Elapsed: 90 * time.Second, ExitCode: "0:0", MaxRSS: -1, TotalCPU: 80 * time.Second, NodeList: "n1", Partition: "gpu"}
+	if err := recordJobAccounting(db, done, acct); err != nil {
+		t.Fatal(err)
+	}
+	disabled := unknownAccounting()
+	disabled.Note = "sacct unavailable: Slurm accounting storage is disabled"
+	if err := recordJobAccounting(db, noAcct, disabled); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(id int64) jobAccounting {
+		exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exp.Accounting
+	}
+	if got := load(done); got != acct {
+		t.Errorf("stored accounting = %+v, want %+v", got, acct)
+	}
+	var rss *int64
+	if err := db.QueryRow(`SELECT job_max_rss FROM experiments WHERE id = ?`, done).Scan(&rss); err != nil || rss != nil {
+		t.Errorf("unknown MaxRSS should stay NULL, got %v, %v", rss, err)
+	}
+	if got := load(noAcct); got != disabled {
+		t.Errorf("disabled accounting = %+v", got)
+	}
+	if got := load(older); got.recorded() {
+		t.Errorf("experiment without accounting = %+v", got)
+	}
+
+	exp, _ := findExperiment(db, strconv.FormatInt(done, 10))
+	for col, want := range map[string]string{"elapsed": "00:01:30", "exit_code": "0:0", "max_rss": "-"} {
+		if got := listColumnValue(exp, nil, col); got != want {
+			t.Errorf("list %s = %q, want %q", col, got, want)
+		}
+	}
+	if got := exp.Accounting.summary(); !strings.HasPrefix(got, "elapsed 00:01:30, exit code 0:0, CPU 00:01:20") {
+		t.Errorf("summary = %q", got)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive layout: metadata.json (one exp export record) is always the first
+// entry so exp restore can register the experiment before streaming the
+// artifact files stored under artifacts/.
+const (
+	archiveMetadataName = "metadata.json"
+	archiveArtifactDir  = "artifacts/"
+)
+
+// exp archive <id> [-o file.tar.gz] [--remove-local]
+func cmdArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	var (
+		outPath     string
+		removeLocal bool
+	)
+	fs.StringVar(&outPath, "o", "", "Archive file to write (default: exp-<id>-<name>.tar.gz in the current directory)")
+	fs.BoolVar(&removeLocal, "remove-local", false, "Delete the local artifact directory once the archive has been written")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp archive <id> [-o file.tar.gz] [--remove-local]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		outPath = fmt.Sprintf("exp-%d-%s.tar.gz", exp.ID, exp.Name)
+	}
+	absOut, err := expandLocalPath(outPath)
+	if err != nil {
+		return fmt.Errorf("output path: %w", err)
+	}
+
+	var metadata bytes.Buffer
+	if _, err := exportExperiments(db, &metadata, []idRange{{lo: exp.ID, hi: exp.ID}}, nil); err != nil {
+		return err
+	}
+	files, err := writeArchive(absOut, metadata.Bytes(), exp.ArtifactDest)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(absOut)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Archived experiment %d (%d file(s)) to %s (%s)\n", exp.ID, files, absOut, formatBytes(info.Size()))
+
+	if _, err := db.Exec(`UPDATE experiments SET archive_path = ? WHERE id = ?`, absOut, exp.ID); err != nil {
+		return fmt.Errorf("record archive path: %w", err)
+	}
+	if removeLocal && exp.ArtifactDest != "" {
+		if err := os.RemoveAll(exp.ArtifactDest); err != nil {
+			return fmt.Errorf("remove %s: %w", exp.ArtifactDest, err)
+		}
+		fmt.Printf("Removed local artifacts at %s\n", exp.ArtifactDest)
+	}
+	return nil
+}
+
+// writeArchive streams metadata and every regular file under artifactDir into
+// a gzip-compressed tarball. It writes to a temporary file first so a failure
+// part way through never leaves a truncated archive at dest.
+func writeArchive(dest string, metadata []byte, artifactDir string) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".exp-archive-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     archiveMetadataName,
+		Mode:     0o644,
+		Size:     int64(len(metadata)),
+		ModTime:  now,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(metadata); err != nil {
+		return 0, err
+	}
+
+	files := 0
+	if artifactDir != "" {
+		err = filepath.WalkDir(artifactDir, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				if p == artifactDir && os.IsNotExist(err) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(artifactDir, p)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = archiveArtifactDir + filepath.ToSlash(rel)
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(tw, f); err != nil {
+				return fmt.Errorf("archive %s: %w", p, err)
+			}
+			files++
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return 0, err
+	}
+	return files, nil
+}
+
+// exp restore <file.tar.gz> [--dest DIR]
+func cmdRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var destFlag string
+	fs.StringVar(&destFlag, "dest", "", "Directory to unpack artifacts into (default: the experiment's recorded artifact destination)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp restore <file.tar.gz> [--dest DIR]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("archive file is required")
+	}
+	archivePath, err := expandLocalPath(positional[0])
+	if err != nil {
+		return fmt.Errorf("archive path: %w", err)
+	}
+	dest := ""
+	if destFlag != "" {
+		if dest, err = expandLocalPath(destFlag); err != nil {
+			return fmt.Errorf("dest: %w", err)
+		}
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	id, files, dest, err := restoreArchive(db, f, archivePath, dest)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored experiment %d (%d file(s)) to %s\n", id, files, dest)
+	return nil
+}
+
+// restoreArchive unpacks an archive written by exp archive. If the experiment
+// is already registered locally (same remote, job ID and creation time, e.g.
+// after archive --remove-local) its row is reused; otherwise the metadata is
+// inserted with a fresh ID as exp import would, and without dest the
+// artifacts go to the per-ID directory of that new ID.
+func restoreArchive(db *sql.DB, r io.Reader, archivePath, dest string) (int64, int, string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("read archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("read archive: %w", err)
+	}
+	if hdr.Name != archiveMetadataName {
+		return 0, 0, "", fmt.Errorf("archive does not start with %s; was it produced by exp archive?", archiveMetadataName)
+	}
+	metadata, err := io.ReadAll(tr)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	rec, err := decodeImportRecord(bytes.TrimSpace(metadata))
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%s: %w", archiveMetadataName, err)
+	}
+
+	// The row is written first: a new one gets a fresh ID, and the recorded
+	// per-ID destination (<root>/<old id>) moves to it, as exp import does.
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer tx.Rollback()
+	id, err := findDuplicateExperiment(tx, rec)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	recorded, _ := rec["artifact_dest"].(string)
+	if id == 0 {
+		oldID, _ := rec["id"].(int64)
+		rec["archive_path"] = archivePath
+		if id, err = insertImportRecord(tx, rec); err != nil {
+			return 0, 0, "", fmt.Errorf("register experiment: %w", err)
+		}
+		recorded = remapArtifactDest(recorded, oldID, id)
+	}
+	if dest == "" {
+		dest = recorded
+		if dest == "" {
+			return 0, 0, "", fmt.Errorf("archive records no artifact destination; pass --dest")
+		}
+	}
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+		return 0, 0, "", fmt.Errorf("destination %s already exists and is not empty; pass --dest", dest)
+	}
+
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasPrefix(hdr.Name, archiveArtifactDir) {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(hdr.Name, archiveArtifactDir))
+		if rel == "." || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return 0, 0, "", fmt.Errorf("archive entry %q escapes the destination", hdr.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return 0, 0, "", err
+		}
+		if err := extractFile(tr, target, hdr); err != nil {
+			return 0, 0, "", err
+		}
+		files++
+	}
+
+	if _, err := tx.Exec(`UPDATE experiments SET artifact_dest = ?, archive_path = ? WHERE id = ?`, dest, archivePath, id); err != nil {
+		return 0, 0, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, "", err
+	}
+	return id, files, dest, nil
+}
+
+func extractFile(r io.Reader, target string, hdr *tar.Header) error {
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm()|0o200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("extract %s: %w", target, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveRestoreRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "COMPLETED", `{"name":"a"}`)
+	artifacts := filepath.Join(t.TempDir(), "1")
+	if err := os.MkdirAll(filepath.Join(artifacts, "results"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(artifacts, "results", "recall.json"), []byte(`{"recall":0.9}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = ? WHERE id = ?`, artifacts, id); err != nil {
+		t.Fatal(err)
+	}
+
+	var metadata bytes.Buffer
+	if _, err := exportExperiments(db, &metadata, []idRange{{lo: id, hi: id}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "a.tar.gz")
+	files, err := writeArchive(archive, metadata.Bytes(), artifacts)
+	if err != nil || files != 1 {
+		t.Fatalf("writeArchive = %d, %v", files, err)
+	}
+
+	// Restoring into a fresh database registers a new experiment.
+	other := openTestDB(t)
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dest := filepath.Join(t.TempDir(), "restored")
+	newID, files, _, err := restoreArchive(other, f, archive, dest)
+	if err != nil || files != 1 {
+		t.Fatalf("restoreArchive = %d, %v", files, err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "results", "recall.json"))
+	if err != nil || string(got) != `{"recall":0.9}` {
+		t.Fatalf("restored file = %q, %v", got, err)
+	}
+	exp, err := findExperiment(other, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.ID != newID || exp.Name != "a" || exp.ArtifactDest != dest || exp.ArchivePath != archive {
+		t.Fatalf("restored experiment = %+v", exp)
+	}
+
+	// Without --dest a new row's artifacts go to its own per-ID directory,
+	// not to the one named after the old ID.
+	third := openTestDB(t)
+	local := insertTestExperiment(t, third, "local", "COMPLETED", "")
+	if _, err := third.Exec(`UPDATE experiments SET job_id = '43' WHERE id = ?`, local); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	newID, _, restored, err := restoreArchive(third, f, archive, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(artifacts), "2"); newID != 2 || restored != want {
+		t.Fatalf("restored experiment %d to %s, want 2 in %s", newID, restored, want)
+	}
+	if _, err := os.Stat(filepath.Join(restored, "results", "recall.json")); err != nil {
+		t.Fatal(err)
+	}
+	exp, err = findExperiment(third, "2")
+	if err != nil || exp.ArtifactDest != restored {
+		t.Fatalf("restored experiment = %+v, %v", exp, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// Script arguments are stored twice: args_json holds the exact list, and args
+// the same list as shell words, for display and for older versions of exp.
+// Rows recorded before args_json existed were backfilled by splitting args on
+// whitespace, which loses any quoting; args_approximate marks them.
+
+// argsColumns returns the args and args_json values recording args.
+func argsColumns(args []string) (display, exact string) {
+	if args == nil {
+		args = []string{}
+	}
+	data, _ := json.Marshal(args)
+	return formatArgs(args), string(data)
+}
+
+// formatArgs joins args as shell words, quoting those that need it, so
+// --label "run one" and --label run one read differently.
+func formatArgs(args []string) string {
+	words := make([]string, len(args))
+	for i, a := range args {
+		words[i] = a
+		if a == "" || strings.IndexFunc(a, needsShellQuote) >= 0 {
+			words[i] = shellQuote(a)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func needsShellQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_=+:,./@%", r)
+}
+
+// scanArgs decodes the args columns. Without args_json (an import from an
+// older export), args is split on whitespace and reported approximate.
+func scanArgs(display string, exact sql.NullString, approximate sql.NullInt64) ([]string, bool) {
+	if exact.Valid {
+		var args []string
+		if err := json.Unmarshal([]byte(exact.String), &args); err == nil {
+			return args, approximate.Int64 == 1
+		}
+	}
+	args := strings.Fields(display)
+	return args, len(args) > 0
+}
+
+// backfillArgs recovers a legacy row's argument list: exactly from its config
+// snapshot when it has one, else by splitting args on whitespace.
+func backfillArgs(snapshot, display string) (args []string, approximate bool) {
+	if snapshot != "" {
+		var snap struct {
+			Args *[]string `json:"args"`
+		}
+		if json.Unmarshal([]byte(snapshot), &snap) == nil && snap.Args != nil {
+			return *snap.Args, false
+		}
+	}
+	args = strings.Fields(display)
+	return args, len(args) > 0
+}
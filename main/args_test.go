@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestArgsRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	cases := [][]string{
+		{"--label", "run one"},
+		{"--label", "run", "one"},
+		{"--msg", `it's "quoted"`, ""},
+		{"--empty=", "", "--k=10"},
+		{},
+	}
+	ids := make([]int64, len(cases))
+	for i, args := range cases {
+		ids[i] = insertTestExperiment(t, db, "e"+strconv.Itoa(i), "COMPLETED", "")
+		display, exact := argsColumns(args)
+		if _, err := db.Exec(`UPDATE experiments SET args = ?, args_json = ? WHERE id = ?`, display, exact, ids[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range cases {
+		exp, err := findExperiment(db, strconv.FormatInt(ids[i], 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp.ArgsApproximate || len(exp.ArgList) != len(want) || len(want) > 0 && !reflect.DeepEqual(exp.ArgList, want) {
+			t.Errorf("args %q loaded as %q (approximate %v)", want, exp.ArgList, exp.ArgsApproximate)
+		}
+		if got := exp.runSnapshot().Args; len(want) > 0 && !reflect.DeepEqual(got, want) {
+			t.Errorf("snapshot args = %q, want %q", got, want)
+		}
+	}
+
+	a, _ := findExperiment(db, strconv.FormatInt(ids[0], 10))
+	b, _ := findExperiment(db, strconv.FormatInt(ids[1], 10))
+	if a.Args != `--label 'run one'` || b.Args != "--label run one" {
+		t.Errorf("display args = %q and %q", a.Args, b.Args)
+	}
+	for _, d := range diffSnapshots(a.runSnapshot(), b.runSnapshot()) {
+		if d.Field == "args" && d.Equal {
+			t.Error("diff treats --label 'run one' and --label run one as equal")
+		}
+	}
+	if got := formatArgs(cases[2]); got != `--msg 'it'"'"'s "quoted"' ''` {
+		t.Errorf("formatArgs = %s", got)
+	}
+
+	// Exports carry the list as JSON and imports restore it.
+	var buf bytes.Buffer
+	if _, err := exportExperiments(db, &buf, []idRange{{ids[2], ids[2]}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"args_json":["--msg","it's \"quoted\"",""]`)) {
+		t.Errorf("export = %s", buf.String())
+	}
+	if _, err := importExperiments(db, &buf, true, false); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := loadExperiments(db, "name = 'e2'")
+	if err != nil || len(imported) != 2 || !reflect.DeepEqual(imported[0].ArgList, cases[2]) {
+		t.Errorf("imported args = %+v, %v", imported, err)
+	}
+}
+
+func TestBackfillArgs(t *testing.T) {
+	if args, approx := backfillArgs(`{"args":["--label","run one"]}`, "--label run one"); approx || !reflect.DeepEqual(args, []string{"--label", "run one"}) {
+		t.Errorf("from snapshot = %q, %v", args, approx)
+	}
+	if args, approx := backfillArgs("", "--label run one"); !approx || len(args) != 3 {
+		t.Errorf("split = %q, %v", args, approx)
+	}
+	if args, approx := backfillArgs(`{"name":"x"}`, ""); approx || len(args) != 0 {
+		t.Errorf("no args = %q, %v", args, approx)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// artifactListing is one row of exp artifacts --json.
+type artifactListing struct {
+	artifactEntry
+	Location string `json:"location"`
+}
+
+// location reports which side(s) of the comparison hold the file.
+func (e artifactEntry) location() string {
+	switch {
+	case e.Remote != nil && e.Local != nil:
+		return "both"
+	case e.Remote != nil:
+		return "remote-only"
+	default:
+		return "local-only"
+	}
+}
+
+// exp artifacts <id> [--remote-only | --local-only] [--json]
+func cmdArtifacts(args []string) error {
+	fs := flag.NewFlagSet("artifacts", flag.ExitOnError)
+	var (
+		remoteOnly bool
+		localOnly  bool
+		asJSON     bool
+	)
+	fs.BoolVar(&remoteOnly, "remote-only", false, "Only show files that exist remotely but not locally")
+	fs.BoolVar(&localOnly, "local-only", false, "Only show files that exist locally but not remotely")
+	fs.BoolVar(&asJSON, "json", false, "Print the merged listing as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp artifacts <id> [--remote-only | --local-only] [--json]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	if remoteOnly && localOnly {
+		return fmt.Errorf("--remote-only and --local-only are mutually exclusive")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	exp, err := findExperiment(db, idStr)
+	db.Close()
+	if err != nil {
+		return err
+	}
+	if exp.ArtifactDest == "" {
+		return fmt.Errorf("experiment %s has no recorded artifact destination", idStr)
+	}
+	sources := exp.EffectiveArtifactSources()
+	if len(sources) == 0 {
+		return fmt.Errorf("no artifact sources recorded for experiment %s", idStr)
+	}
+
+	entries, err := compareArtifacts(exp, sources, false)
+	if err != nil {
+		return err
+	}
+	var rows []artifactListing
+	for _, e := range entries {
+		loc := e.location()
+		if (remoteOnly && loc != "remote-only") || (localOnly && loc != "local-only") {
+			continue
+		}
+		rows = append(rows, artifactListing{artifactEntry: e, Location: loc})
+	}
+	if asJSON {
+		if rows == nil {
+			rows = []artifactListing{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+	printArtifactListing(os.Stdout, rows)
+	return nil
+}
+
+func printArtifactListing(w io.Writer, rows []artifactListing) {
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "No artifact files.")
+		return
+	}
+	size := func(fi *fileInfo) string {
+		if fi == nil {
+			return "-"
+		}
+		return formatBytes(fi.Size)
+	}
+	counts := make(map[string]int)
+	var remoteBytes, localBytes int64
+	fmt.Fprintf(w, "%-12s %10s %10s  %s\n", "LOCATION", "REMOTE", "LOCAL", "PATH")
+	for _, r := range rows {
+		counts[r.Location]++
+		if r.Remote != nil {
+			remoteBytes += r.Remote.Size
+		}
+		if r.Local != nil {
+			localBytes += r.Local.Size
+		}
+		fmt.Fprintf(w, "%-12s %10s %10s  %s\n", r.Location, size(r.Remote), size(r.Local), r.Rel)
+	}
+	fmt.Fprintf(w, "%d file(s): %d both, %d remote-only, %d local-only; %s remote, %s local\n",
+		len(rows), counts["both"], counts["remote-only"], counts["local-only"], formatBytes(remoteBytes), formatBytes(localBytes))
+}
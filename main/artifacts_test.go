@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintArtifactListing(t *testing.T) {
+	var rows []artifactListing
+	for _, e := range []artifactEntry{
+		{Rel: "a.json", Remote: &fileInfo{Size: 10}, Local: &fileInfo{Size: 10}},
+		{Rel: "b.bin", Remote: &fileInfo{Size: 2048}},
+		{Rel: "notes.txt", Local: &fileInfo{Size: 5}},
+	} {
+		rows = append(rows, artifactListing{artifactEntry: e, Location: e.location()})
+	}
+	var buf bytes.Buffer
+	printArtifactListing(&buf, rows)
+	out := buf.String()
+	for _, want := range []string{
+		"both", "remote-only     2.0 KiB          -  b.bin", "local-only", "3 file(s): 1 both, 1 remote-only, 1 local-only",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("listing missing %q:\n%s", want, out)
+		}
+	}
+}
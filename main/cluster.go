@@ -0,0 +1,94 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A login node can submit to other clusters of a multi-cluster or federated
+// Slurm setup (sbatch -M). The job then lives on that cluster: squeue, sacct,
+// scontrol and seff on the login node only find it when given -M as well, so
+// exp stores the cluster with the experiment and passes it to every later
+// command about the job.
+
+// slurmTimeEnv makes Slurm print times as epoch seconds. Slurm otherwise
+// prints them in the cluster's time zone, without saying which, and that
+// need not be the zone exp runs in.
+const slurmTimeEnv = "SLURM_TIME_FORMAT=%s"
+
+// slurmArgs is the argument list running command, say squeue, against
+// cluster; without a cluster it runs against the login node's own.
+func slurmArgs(cluster, command string, args ...string) []string {
+	if cluster == "" {
+		return append([]string{slurmTimeEnv, command}, args...)
+	}
+	return append([]string{slurmTimeEnv, command, "-M", shellQuote(cluster)}, args...)
+}
+
+// isClusterHeader reports whether line is the "CLUSTER: name" header squeue
+// prints before each cluster's jobs when given -M, even with -h.
+func isClusterHeader(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "CLUSTER:")
+}
+
+// parseSbatchOutput reads the job ID, and the cluster when sbatch names one,
+// from sbatch --parsable ("2723147" or "2723147;cluster") or from its plain
+// output ("Submitted batch job 2723147", with " on cluster NAME" after -M).
+// Warnings sbatch prints before the job ID are skipped.
+func parseSbatchOutput(out string) (jobID, cluster string, err error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if rest, ok := strings.CutPrefix(line, "Submitted batch job "); ok {
+			jobID, cluster, _ = strings.Cut(rest, " on cluster ")
+			return strings.TrimSpace(jobID), strings.TrimSpace(cluster), nil
+		}
+		id, name, _ := strings.Cut(line, ";")
+		if id != "" && strings.Trim(id, "0123456789") == "" {
+			return id, strings.TrimSpace(name), nil
+		}
+	}
+	return "", "", fmt.Errorf("unable to parse sbatch output: %q", out)
+}
+
+// validateCluster checks cluster as given in a run config or on the command
+// line. Slurm cluster names are plain words.
+func validateCluster(cluster string) error {
+	if strings.ContainsAny(cluster, " \t\n;,'\"") {
+		return fmt.Errorf("invalid cluster %q: a Slurm cluster name is a single word", cluster)
+	}
+	return nil
+}
+
+// slurmGroup is the experiments whose jobs one batched query covers: those on
+// the same remote and cluster.
+type slurmGroup struct {
+	Remote  string
+	Cluster string
+}
+
+func (g slurmGroup) String() string {
+	if g.Cluster == "" {
+		return g.Remote
+	}
+	return g.Remote + " (cluster " + g.Cluster + ")"
+}
+
+// groupBySlurm splits exps into slurmGroups, in a stable order.
+func groupBySlurm(exps []*Experiment) ([]slurmGroup, map[slurmGroup][]*Experiment) {
+	byGroup := make(map[slurmGroup][]*Experiment)
+	var groups []slurmGroup
+	for _, exp := range exps {
+		g := slurmGroup{Remote: exp.Remote, Cluster: exp.Cluster}
+		if _, ok := byGroup[g]; !ok {
+			groups = append(groups, g)
+		}
+		byGroup[g] = append(byGroup[g], exp)
+	}
+	slices.SortFunc(groups, func(a, b slurmGroup) int {
+		return cmp.Or(strings.Compare(a.Remote, b.Remote), strings.Compare(a.Cluster, b.Cluster))
+	})
+	return groups, byGroup
+}
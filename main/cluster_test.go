@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSbatchOutput(t *testing.T) {
+	tests := []struct {
+		out, jobID, cluster string
+	}{
+		{"2723147\n", "2723147", ""},
+		{"2723147;gpu\n", "2723147", "gpu"},
+		{"sbatch: Warning: --mem-per-cpu raised to the partition minimum\n2723147;gpu\n", "2723147", "gpu"},
+		{"Submitted batch job 2723147\n", "2723147", ""},
+		{"Submitted batch job 2723147 on cluster gpu\n", "2723147", "gpu"},
+	}
+	for _, tt := range tests {
+		jobID, cluster, err := parseSbatchOutput(tt.out)
+		if err != nil || jobID != tt.jobID || cluster != tt.cluster {
+			t.Errorf("parseSbatchOutput(%q) = %q, %q, %v; want %q, %q", tt.out, jobID, cluster, err, tt.jobID, tt.cluster)
+		}
+	}
+	if _, _, err := parseSbatchOutput("sbatch: error: Batch job submission failed: Invalid account\n"); err == nil {
+		t.Error("an sbatch error parsed as a job ID")
+	}
+}
+
+// TestClusterQueries submits to a cluster with fake Slurm commands that only
+// know the job when given -M gpu, as on a login node of another cluster, and
+// print the CLUSTER header squeue -M adds.
+func TestClusterQueries(t *testing.T) {
+	bin := t.TempDir()
+	calls := filepath.Join(t.TempDir(), "calls")
+	writeScript := func(name, body string) {
+		script := "#!/bin/sh\necho " + name + ` "$@" >> ` + shellQuote(calls) + "\n" +
+			`[ "$1" = -M ] && [ "$2" = gpu ] || { echo "slurm_load_jobs error: Invalid job id specified"; exit 1; }` + "\n" + body
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript("sbatch", `echo "4242;gpu"`)
+	writeScript("squeue", `case "$*" in
+*--start*) printf 'CLUSTER: gpu\n2025-03-01T14:00:00 Priority\n' ;;
+*"%i %T"*) printf 'CLUSTER: gpu\n4242 PENDING\n' ;;
+*) printf 'CLUSTER: gpu\nPENDING\n' ;;
+esac`)
+	writeScript("sacct", `printf '4242|FAILED|2025-03-01T12:00:00|3:0\n'`)
+	writeScript("scontrol", `echo "JobId=4242 JobState=FAILED ExitCode=3:0"`)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+
+	jobID, cluster, _, err := submitSbatchSSH("u@h", sshHostOptions{}, "gpu", "/logs/x-%j.out", "/s.sbatch", nil)
+	if err != nil || jobID != "4242" || cluster != "gpu" {
+		t.Fatalf("submit = %q, %q, %v", jobID, cluster, err)
+	}
+	if status, err := queryJobStatus("u@h", sshHostOptions{}, cluster, jobID); err != nil || status != "PENDING" {
+		t.Errorf("status = %q, %v", status, err)
+	}
+	states, err := batchJobStatuses("u@h", sshHostOptions{}, cluster, []string{jobID})
+	if err != nil || states[jobID].Status != "PENDING" || len(states) != 1 {
+		t.Errorf("batch = %+v, %v", states, err)
+	}
+	if e, err := querySqueueStart("u@h", sshHostOptions{}, cluster, jobID); err != nil || e.Reason != "Priority" || e.Start.IsZero() {
+		t.Errorf("start estimate = %+v, %v", e, err)
+	}
+	if states, err := runScontrol("u@h", sshHostOptions{}, cluster, []string{jobID}); err != nil || states[jobID].Status != "FAILED" {
+		t.Errorf("scontrol = %+v, %v", states, err)
+	}
+	if job, err := lookupSlurmJob("u@h", cluster, jobID); err != nil || job.State != "FAILED" {
+		t.Errorf("track lookup = %+v, %v", job, err)
+	}
+	data, _ := os.ReadFile(calls)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if name, args, _ := strings.Cut(line, " "); !strings.HasPrefix(args, "-M gpu ") {
+			t.Errorf("%s ran without -M gpu: %q", name, line)
+		}
+	}
+	if !strings.Contains(string(data), "sbatch -M gpu --parsable") {
+		t.Errorf("sbatch calls: %q", data)
+	}
+
+	// Without the cluster the login node's own scheduler knows nothing.
+	if status, err := queryJobStatus("u@h", sshHostOptions{}, "", jobID); err != nil || status != "UNKNOWN" {
+		t.Errorf("status without -M = %q, %v", status, err)
+	}
+}
+
+func TestMonitorDaemonGroupsByCluster(t *testing.T) {
+	db := openTestDB(t)
+	for _, c := range []struct{ name, cluster string }{{"a", "gpu"}, {"b", ""}, {"c", "gpu"}, {"d", "cpu"}} {
+		id := insertTestExperiment(t, db, c.name, "RUNNING", "")
+		if _, err := db.Exec(`UPDATE experiments SET cluster = ? WHERE id = ?`, nullString(c.cluster), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := newMonitorDaemon(db, time.Minute)
+	queried := map[string]int{}
+	d.query = func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		queried[remote+"/"+cluster] += len(jobIDs)
+		return map[string]jobState{"42": {Status: "RUNNING"}}, nil
+	}
+	d.pass(context.Background(), time.Now(), true)
+	if len(queried) != 3 || queried["u@h/gpu"] != 2 || queried["u@h/cpu"] != 1 || queried["u@h/"] != 1 {
+		t.Errorf("queries per remote/cluster = %v", queried)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every external program exp runs (ssh, rsync, scp, git, ...) goes through
+// runCommand, so that --debug-log (or debug_log in the config) can record
+// each one: when it ran, for which experiment, its argv, how long it took,
+// its exit code and the start and end of what it printed.
+
+// debugLogCap bounds each of an entry's stdout and stderr, and each argv
+// element, so one chatty command cannot bloat the log.
+const debugLogCap = 4 << 10
+
+// debugLogger appends JSON lines to the debug log; a nil file disables it.
+type debugLogger struct {
+	mu         sync.Mutex
+	file       *os.File
+	experiment int64
+}
+
+var debugLog debugLogger
+
+// openDebugLog starts appending command transcripts to path.
+func openDebugLog(path string) error {
+	abs, err := expandLocalPath(path)
+	if err != nil {
+		return fmt.Errorf("debug log: %w", err)
+	}
+	f, err := os.OpenFile(abs, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("debug log: %w", err)
+	}
+	debugLog.mu.Lock()
+	defer debugLog.mu.Unlock()
+	debugLog.file = f
+	return nil
+}
+
+// setDebugExperiment tags the entries that follow with experiment id (0 for
+// none, e.g. a query batched over several experiments).
+func setDebugExperiment(id int64) {
+	debugLog.mu.Lock()
+	defer debugLog.mu.Unlock()
+	debugLog.experiment = id
+}
+
+func (l *debugLogger) enabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file != nil
+}
+
+// debugLogEntry is one line of the debug log.
+type debugLogEntry struct {
+	Time         string   `json:"time"`
+	ExperimentID int64    `json:"experiment_id,omitempty"`
+	Argv         []string `json:"argv"`
+	DurationMS   int64    `json:"duration_ms"`
+	ExitCode     *int     `json:"exit_code,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Stdout       string   `json:"stdout,omitempty"`
+	Stderr       string   `json:"stderr,omitempty"`
+	Detached     bool     `json:"detached,omitempty"`
+}
+
+func (l *debugLogger) write(e debugLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	e.ExperimentID = l.experiment
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_, _ = l.file.Write(append(data, '\n'))
+}
+
+// cappedBuffer keeps the first and last debugLogCap/2 bytes written to it.
+type cappedBuffer struct {
+	head, tail []byte
+	total      int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += int64(len(p))
+	half := debugLogCap / 2
+	rest := p
+	if n := min(half-len(b.head), len(rest)); n > 0 {
+		b.head = append(b.head, rest[:n]...)
+		rest = rest[n:]
+	}
+	b.tail = append(b.tail, rest...)
+	if len(b.tail) > half {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-half:]...)
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	if b == nil {
+		return ""
+	}
+	omitted := b.total - int64(len(b.head)+len(b.tail))
+	if omitted <= 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n... (%d bytes omitted) ...\n%s", b.head, omitted, b.tail)
+}
+
+func capArg(s string) string {
+	if len(s) <= debugLogCap {
+		return s
+	}
+	return s[:debugLogCap] + fmt.Sprintf("... (%d bytes omitted)", len(s)-debugLogCap)
+}
+
+// loggedCmd is an exec.Cmd whose runs are recorded in the debug log. Use it
+// like an exec.Cmd; output going to a terminal or a pipe (an *os.File) is
+// not captured.
+type loggedCmd struct {
+	*exec.Cmd
+	started        time.Time
+	stdout, stderr *cappedBuffer
+	// session runs the command over a native SSH connection instead of
+	// starting Cmd; Cmd then only holds its argv and streams.
+	session *nativeSession
+
+	timeout  time.Duration // see timeouts.go; zero for none
+	timer    *time.Timer
+	timedOut atomic.Bool
+	group    bool // the process leads its own process group
+
+	stopWatch func() bool // undoes the watch on stopCommands
+}
+
+// stopCommands kills every command still running once it is done. The
+// monitor daemon sets it to the context SIGTERM cancels, so stopping the
+// daemon does not wait out a hung ssh.
+var stopCommands = context.Background()
+
+// runCommand is exec.Command for everything exp runs, with the deadline for
+// name.
+func runCommand(name string, args ...string) *loggedCmd {
+	return &loggedCmd{Cmd: exec.Command(name, args...), timeout: defaultTimeout(name)}
+}
+
+// withTimeout replaces the command's deadline, e.g. with timeouts.Transfer
+// for an ssh run that copies files or walks a large tree.
+func (c *loggedCmd) withTimeout(d time.Duration) *loggedCmd {
+	c.timeout = d
+	return c
+}
+
+func (c *loggedCmd) Start() error {
+	if _, isFile := c.Stdout.(*os.File); c.Stdout != nil && c.Stdout == c.Stderr && !isFile {
+		// exec.Cmd serializes writes to a shared Stdout and Stderr, but not
+		// once the tees below make them differ, and an ssh session never
+		// does.
+		w := &syncWriter{w: c.Stdout}
+		c.Stdout, c.Stderr = w, w
+	}
+	if debugLog.enabled() {
+		if c.Stdout == nil || c.Stderr == nil {
+			// Capturing output that would have gone to /dev/null adds a
+			// pipe; don't let a process that inherits it, such as an ssh
+			// control master, hold up Wait.
+			c.WaitDelay = time.Second
+		}
+		c.stdout, c.Stdout = teeCapped(c.Stdout)
+		c.stderr, c.Stderr = teeCapped(c.Stderr)
+	}
+	if c.timeout > 0 && c.session == nil {
+		if c.SysProcAttr == nil {
+			if attr := groupProcAttr(); attr != nil {
+				c.SysProcAttr, c.group = attr, true
+			}
+		}
+		if c.WaitDelay == 0 {
+			// A child left behind by the kill may hold the pipes open.
+			c.WaitDelay = 5 * time.Second
+		}
+	}
+	c.started = time.Now()
+	var err error
+	if c.session != nil {
+		err = c.session.start(c)
+	} else {
+		err = c.Cmd.Start()
+	}
+	if err != nil {
+		c.log(err, false)
+		return err
+	}
+	if c.timeout > 0 {
+		c.timer = time.AfterFunc(c.timeout, func() {
+			c.timedOut.Store(true)
+			c.Kill()
+		})
+	}
+	c.stopWatch = context.AfterFunc(stopCommands, c.Kill)
+	return nil
+}
+
+func (c *loggedCmd) Wait() error {
+	var err error
+	if c.session != nil {
+		err = c.session.wait()
+	} else {
+		err = c.Cmd.Wait()
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if c.stopWatch != nil && !c.stopWatch() && err != nil {
+		err = fmt.Errorf("%s: %w", c.Args[0], context.Cause(stopCommands))
+	}
+	if c.timedOut.Load() {
+		err = &commandTimeoutError{Name: c.Args[0], Timeout: c.timeout}
+	}
+	c.log(err, false)
+	return err
+}
+
+func (c *loggedCmd) StdoutPipe() (io.ReadCloser, error) {
+	if c.session != nil {
+		return c.session.stdoutPipe(c)
+	}
+	return c.Cmd.StdoutPipe()
+}
+
+// Kill stops a started command.
+func (c *loggedCmd) Kill() {
+	if c.session != nil {
+		c.session.kill()
+	} else if c.Process != nil {
+		killProcessGroup(c.Process, c.group)
+	}
+}
+
+func (c *loggedCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+func (c *loggedCmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var out bytes.Buffer
+	c.Stdout = &out
+	err := c.Run()
+	return out.Bytes(), err
+}
+
+func (c *loggedCmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil || c.Stderr != nil {
+		return nil, errors.New("exec: Stdout or Stderr already set")
+	}
+	var out bytes.Buffer
+	c.Stdout, c.Stderr = &out, &out
+	err := c.Run()
+	return out.Bytes(), err
+}
+
+// StartDetached starts a process exp does not wait for, such as the monitor
+// daemon, and logs that it was started.
+func (c *loggedCmd) StartDetached() error {
+	c.started = time.Now()
+	if err := c.Cmd.Start(); err != nil {
+		c.log(err, false)
+		return err
+	}
+	c.log(nil, true)
+	return c.Process.Release()
+}
+
+// syncWriter lets two goroutines share a writer.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// status is a line on a terminal kept at the bottom, redrawn in place
+	// while whole lines written scroll past it; see setStatus.
+	status string
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == "" {
+		return s.w.Write(p)
+	}
+	fmt.Fprint(s.w, "\r\033[K")
+	n, err := s.w.Write(p)
+	fmt.Fprint(s.w, s.status)
+	return n, err
+}
+
+// teeCapped adds a capture of w's output, unless w is a file: a terminal or
+// a pipe the caller reads is handed to the child as is.
+func teeCapped(w io.Writer) (*cappedBuffer, io.Writer) {
+	if _, ok := w.(*os.File); ok {
+		return nil, w
+	}
+	buf := &cappedBuffer{}
+	if w == nil {
+		return buf, buf
+	}
+	return buf, io.MultiWriter(w, buf)
+}
+
+func (c *loggedCmd) log(err error, detached bool) {
+	if !debugLog.enabled() {
+		return
+	}
+	e := debugLogEntry{
+		Time:       c.started.UTC().Format(time.RFC3339Nano),
+		DurationMS: time.Since(c.started).Milliseconds(),
+		Stdout:     strings.TrimRight(c.stdout.String(), "\n"),
+		Stderr:     strings.TrimRight(c.stderr.String(), "\n"),
+		Detached:   detached,
+	}
+	for _, a := range c.Args {
+		e.Argv = append(e.Argv, capArg(a))
+	}
+	if c.ProcessState != nil {
+		code := c.ProcessState.ExitCode()
+		e.ExitCode = &code
+	} else if code, ok := exitCode(err); ok {
+		e.ExitCode = &code
+	} else if err == nil && !detached {
+		e.ExitCode = new(int)
+	}
+	if err != nil {
+		e.Error = capArg(err.Error())
+	}
+	debugLog.write(e)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useTestDebugLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "debug.jsonl")
+	if err := openDebugLog(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		debugLog.file.Close()
+		debugLog = debugLogger{}
+	})
+	return path
+}
+
+func readDebugLog(t *testing.T, path string) []debugLogEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []debugLogEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var e debugLogEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad debug log line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestDebugLogRecordsCommands(t *testing.T) {
+	path := useTestDebugLog(t)
+	setDebugExperiment(7)
+
+	out, err := runCommand("sh", "-c", "echo out; echo err >&2; exit 3").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "out") || !strings.Contains(string(out), "err") {
+		t.Fatalf("CombinedOutput = %q, %v", out, err)
+	}
+	setDebugExperiment(0)
+	if err := runCommand("sh", "-c", "echo quiet").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readDebugLog(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.ExperimentID != 7 || e.ExitCode == nil || *e.ExitCode != 3 || e.Error == "" || e.Time == "" {
+		t.Errorf("entry = %+v", e)
+	}
+	if strings.Join(e.Argv, " ") != "sh -c echo out; echo err >&2; exit 3" {
+		t.Errorf("argv = %q", e.Argv)
+	}
+	// The log keeps the streams apart even when the caller combines them.
+	if e.Stdout != "out" || e.Stderr != "err" {
+		t.Errorf("stdout = %q, stderr = %q", e.Stdout, e.Stderr)
+	}
+	// Output nobody reads is still recorded.
+	if e := entries[1]; e.ExperimentID != 0 || *e.ExitCode != 0 || e.Stdout != "quiet" {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestDebugLogCapsOutput(t *testing.T) {
+	path := useTestDebugLog(t)
+	long := strings.Repeat("x", 3*debugLogCap)
+	out, err := runCommand("sh", "-c", "printf start; head -c 100000 /dev/zero | tr '\\0' y; printf end", long).Output()
+	if err != nil || len(out) != 100008 {
+		t.Fatalf("Output = %d bytes, %v", len(out), err)
+	}
+	e := readDebugLog(t, path)[0]
+	if !strings.HasPrefix(e.Stdout, "start") || !strings.HasSuffix(e.Stdout, "end") || len(e.Stdout) > debugLogCap+64 {
+		t.Errorf("stdout not capped: %d bytes", len(e.Stdout))
+	}
+	if !strings.Contains(e.Stdout, "bytes omitted") {
+		t.Errorf("stdout does not say output was omitted")
+	}
+	if len(e.Argv[3]) > debugLogCap+64 {
+		t.Errorf("argv not capped: %d bytes", len(e.Argv[3]))
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+var hasTerminal = sync.OnceValue(func() bool {
+	f, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+})
+
+// groupProcAttr puts a command in its own process group, so a deadline
+// kills what it started too (rsync's ssh, say). With a terminal, commands
+// stay in exp's group: ssh asking for a password or a 2FA code from a
+// background group would be stopped.
+func groupProcAttr() *syscall.SysProcAttr {
+	if hasTerminal() {
+		return nil
+	}
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills p, and its process group when it leads one.
+func killProcessGroup(p *os.Process, group bool) {
+	if group {
+		syscall.Kill(-p.Pid, syscall.SIGKILL)
+	}
+	p.Kill()
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func groupProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func killProcessGroup(p *os.Process, group bool) {
+	p.Kill()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// compareRow is one parameter or metric across the compared experiments.
+// Missing values are "-"; Deltas (metrics only, with --baseline) hold the
+// relative change against the baseline column.
+type compareRow struct {
+	Kind    string     `json:"kind"`
+	Key     string     `json:"key"`
+	Values  []string   `json:"values"`
+	Differs bool       `json:"differs"`
+	Deltas  []*float64 `json:"deltas,omitempty"`
+}
+
+type compareColumn struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// exp compare <id...> [--metrics k1,k2] [--params p1,p2] [--baseline ID] [--csv | --json]
+func cmdCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var (
+		metricsFlag string
+		paramsFlag  string
+		baselineID  int64
+		asCSV       bool
+		asJSON      bool
+	)
+	fs.StringVar(&metricsFlag, "metrics", "", "Comma-separated metric keys to show (default: every recorded metric)")
+	fs.StringVar(&paramsFlag, "params", "", "Comma-separated parameters parsed from args, without dashes (default: every parameter)")
+	fs.Int64Var(&baselineID, "baseline", 0, "Experiment ID to compute relative metric deltas against")
+	fs.BoolVar(&asCSV, "csv", false, "Emit CSV instead of an aligned table")
+	fs.BoolVar(&asJSON, "json", false, "Emit JSON instead of an aligned table")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp compare <id...> [--metrics recall@10,qps] [--params k,beam-width] [--baseline ID] [--csv | --json]\n")
+		fs.PrintDefaults()
+	}
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) < 2 {
+		fs.Usage()
+		return fmt.Errorf("at least two experiment ids are required")
+	}
+	if asCSV && asJSON {
+		return fmt.Errorf("--csv and --json are mutually exclusive")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	var (
+		columns []compareColumn
+		params  []map[string]string
+		metrics []map[string]float64
+	)
+	baseline := -1
+	for _, idStr := range ids {
+		exp, err := findExperiment(db, idStr)
+		if err != nil {
+			return err
+		}
+		if exp.ID == baselineID {
+			baseline = len(columns)
+		}
+		columns = append(columns, compareColumn{ID: exp.ID, Name: exp.Name})
+		params = append(params, parseArgParams(exp.runSnapshot().Args))
+		values, err := loadMetrics(db, exp.ID)
+		if err != nil {
+			return fmt.Errorf("load metrics for experiment %d: %w", exp.ID, err)
+		}
+		m := make(map[string]float64, len(values))
+		for _, v := range values {
+			m[v.Key] = v.Value
+		}
+		metrics = append(metrics, m)
+	}
+	if baselineID != 0 && baseline < 0 {
+		return fmt.Errorf("--baseline %d is not one of the compared experiments", baselineID)
+	}
+
+	paramKeys := splitCommaValues([]string{paramsFlag})
+	if len(paramKeys) == 0 {
+		paramKeys = unionKeys(params)
+	}
+	metricKeys := splitCommaValues([]string{metricsFlag})
+	if len(metricKeys) == 0 {
+		metricKeys = unionKeys(metrics)
+	}
+	rows := buildCompareRows(paramKeys, params, metricKeys, metrics, baseline)
+
+	switch {
+	case asJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Experiments []compareColumn `json:"experiments"`
+			Baseline    *int64          `json:"baseline,omitempty"`
+			Rows        []compareRow    `json:"rows"`
+		}{columns, baselinePtr(baselineID, baseline), rows})
+	case asCSV:
+		return writeCompareCSV(columns, rows, baseline)
+	default:
+		printCompareTable(columns, rows, baseline)
+		return nil
+	}
+}
+
+func baselinePtr(id int64, idx int) *int64 {
+	if idx < 0 {
+		return nil
+	}
+	return &id
+}
+
+// parseArgParams turns script args such as "--k 100 --beam-width 8 --fp16"
+// into key/value pairs. Flags followed by another flag (or nothing) are
+// recorded as "true"; "--key=value" is also understood. Bare positional
+// arguments are ignored.
+func parseArgParams(args []string) map[string]string {
+	out := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			continue
+		}
+		key := strings.TrimLeft(arg, "-")
+		if k, v, ok := strings.Cut(key, "="); ok {
+			out[k] = v
+			continue
+		}
+		if i+1 < len(args) && !isFlagToken(args[i+1]) {
+			out[key] = args[i+1]
+			i++
+			continue
+		}
+		out[key] = "true"
+	}
+	return out
+}
+
+// isFlagToken reports whether s looks like a flag rather than a value;
+// negative numbers are values.
+func isFlagToken(s string) bool {
+	if !strings.HasPrefix(s, "-") || s == "-" {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err != nil
+}
+
+func unionKeys[V any](maps []map[string]V) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func buildCompareRows(paramKeys []string, params []map[string]string, metricKeys []string, metrics []map[string]float64, baseline int) []compareRow {
+	var rows []compareRow
+	for _, key := range paramKeys {
+		row := compareRow{Kind: "param", Key: key}
+		for _, p := range params {
+			v, ok := p[key]
+			if !ok {
+				v = "-"
+			}
+			row.Values = append(row.Values, v)
+		}
+		row.Differs = !allEqual(row.Values)
+		rows = append(rows, row)
+	}
+	for _, key := range metricKeys {
+		row := compareRow{Kind: "metric", Key: key}
+		base, hasBase := 0.0, false
+		if baseline >= 0 {
+			base, hasBase = metrics[baseline][key]
+		}
+		for _, m := range metrics {
+			v, ok := m[key]
+			if !ok {
+				row.Values = append(row.Values, "-")
+			} else {
+				row.Values = append(row.Values, formatMetric(v))
+			}
+			if baseline >= 0 {
+				var delta *float64
+				if ok && hasBase && base != 0 {
+					d := (v - base) / math.Abs(base)
+					delta = &d
+				}
+				row.Deltas = append(row.Deltas, delta)
+			}
+		}
+		row.Differs = !allEqual(row.Values)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func allEqual(values []string) bool {
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatDelta(d *float64) string {
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf("%+.1f%%", *d*100)
+}
+
+// printCompareTable renders one column per experiment. Rows whose values
+// differ are marked with "*" (and shown in bold on a terminal).
+func printCompareTable(columns []compareColumn, rows []compareRow, baseline int) {
+	header := []string{""}
+	for i, c := range columns {
+		label := fmt.Sprintf("#%d %s", c.ID, c.Name)
+		if i == baseline {
+			label += " (base)"
+		}
+		header = append(header, label)
+	}
+	table := [][]string{header}
+	for _, r := range rows {
+		line := []string{r.Kind + ":" + r.Key}
+		for i, v := range r.Values {
+			if r.Deltas != nil && i != baseline && r.Deltas[i] != nil {
+				v += " (" + formatDelta(r.Deltas[i]) + ")"
+			}
+			line = append(line, v)
+		}
+		table = append(table, line)
+	}
+	widths := make([]int, len(header))
+	for _, line := range table {
+		for i, cell := range line {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	bold := isTerminal(os.Stdout)
+	for n, line := range table {
+		mark := "  "
+		if n > 0 && rows[n-1].Differs {
+			mark = "* "
+		}
+		parts := make([]string, len(line))
+		for i, cell := range line {
+			parts[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		text := strings.TrimRight(strings.Join(parts, "  "), " ")
+		if bold && mark == "* " {
+			text = "\033[1m" + text + "\033[0m"
+		}
+		fmt.Println(mark + text)
+	}
+}
+
+func writeCompareCSV(columns []compareColumn, rows []compareRow, baseline int) error {
+	w := csv.NewWriter(os.Stdout)
+	header := []string{"kind", "key"}
+	for _, c := range columns {
+		header = append(header, fmt.Sprintf("%d:%s", c.ID, c.Name))
+	}
+	if baseline >= 0 {
+		for i, c := range columns {
+			if i != baseline {
+				header = append(header, fmt.Sprintf("%d:delta", c.ID))
+			}
+		}
+	}
+	header = append(header, "differs")
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		rec := append([]string{r.Kind, r.Key}, r.Values...)
+		if baseline >= 0 {
+			for i := range columns {
+				if i == baseline {
+					continue
+				}
+				if r.Deltas != nil {
+					rec = append(rec, formatDelta(r.Deltas[i]))
+				} else {
+					rec = append(rec, "")
+				}
+			}
+		}
+		rec = append(rec, strconv.FormatBool(r.Differs))
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgParams(t *testing.T) {
+	got := parseArgParams([]string{"--k", "100", "--beam-width=8", "--fp16", "--offset", "-3", "input.bin", "-v"})
+	want := map[string]string{"k": "100", "beam-width": "8", "fp16": "true", "offset": "-3", "v": "true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestBuildCompareRows(t *testing.T) {
+	params := []map[string]string{{"k": "10"}, {"k": "100", "fp16": "true"}}
+	metrics := []map[string]float64{{"qps": 200}, {"qps": 250}}
+	rows := buildCompareRows([]string{"fp16", "k"}, params, []string{"qps", "recall"}, metrics, 0)
+	if len(rows) != 4 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if rows[0].Values[0] != "-" || !rows[0].Differs {
+		t.Errorf("fp16 row = %+v", rows[0])
+	}
+	qps := rows[2]
+	if qps.Deltas[0] == nil || *qps.Deltas[0] != 0 || qps.Deltas[1] == nil || formatDelta(qps.Deltas[1]) != "+25.0%" {
+		t.Errorf("qps deltas = %v", qps.Deltas)
+	}
+	recall := rows[3]
+	if recall.Differs || recall.Values[1] != "-" || recall.Deltas[1] != nil {
+		t.Errorf("recall row = %+v", recall)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// completionCommands lists the subcommands offered by shell completion.
+var completionCommands = []string{
+	"run", "list", "show", "fetch", "export", "import", "diff", "gc", "open",
+	"rename", "verify", "report", "db", "config", "archive", "restore", "metrics",
+	"compare", "watch", "requeue", "track", "doctor", "export-config", "push",
+	"grep", "refresh", "resume", "serve", "artifacts", "monitor", "diff-artifacts",
+	"prune-artifacts", "stats", "tag", "completion",
+}
+
+// completionIDCommands take experiment IDs as positional arguments.
+var completionIDCommands = []string{
+	"show", "fetch", "diff", "open", "rename", "verify", "report", "archive",
+	"metrics", "compare", "watch", "requeue", "export-config", "push", "grep",
+	"refresh", "resume", "artifacts", "diff-artifacts", "tag",
+}
+
+// completeIDLimit bounds how many recent experiments __complete-ids returns.
+const completeIDLimit = 50
+
+// exp completion bash|zsh
+func cmdCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp completion bash|zsh\n\n")
+		fmt.Fprintf(os.Stderr, "Install with:\n  source <(exp completion bash)   # in ~/.bashrc\n  source <(exp completion zsh)    # in ~/.zshrc\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("shell name is required")
+	}
+	switch fs.Arg(0) {
+	case "bash":
+		fmt.Print(bashCompletionScript())
+	case "zsh":
+		fmt.Print(zshCompletionScript())
+	default:
+		return fmt.Errorf("unsupported shell %q (expected bash or zsh)", fs.Arg(0))
+	}
+	return nil
+}
+
+// cmdCompleteIDs prints recent experiment IDs with their names, tab-separated.
+// It is called by the completion scripts on every <TAB>, so it must stay a
+// single primary-key query with no remote calls.
+func cmdCompleteIDs(args []string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT id, name FROM experiments ORDER BY id DESC LIMIT ?`, completeIDLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		fmt.Printf("%d\t%s\n", id, name)
+	}
+	return rows.Err()
+}
+
+// cmdCompleteProfiles prints the profile names defined in the user config.
+func cmdCompleteProfiles(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil || cfg == nil {
+		return err
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// completionFlagsCmd extracts flag names from a subcommand's -h output so the
+// scripts never drift from the real flag sets.
+const completionFlagsCmd = `exp "$cmd" -h 2>&1 | sed -n 's/^  -\([A-Za-z0-9-]*\).*/--\1/p'`
+
+func bashCompletionScript() string {
+	return fmt.Sprintf(`# bash completion for exp; install with: source <(exp completion bash)
+_exp_complete() {
+  local cur prev cmd
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  prev="${COMP_WORDS[COMP_CWORD-1]}"
+  if [ "$COMP_CWORD" -eq 1 ]; then
+    COMPREPLY=( $(compgen -W "%s" -- "$cur") )
+    return
+  fi
+  cmd="${COMP_WORDS[1]}"
+  if [ "$prev" = "--profile" ] || [ "$prev" = "-profile" ]; then
+    COMPREPLY=( $(compgen -W "$(exp __complete-profiles 2>/dev/null)" -- "$cur") )
+    return
+  fi
+  if [[ "$cur" == -* ]]; then
+    COMPREPLY=( $(compgen -W "$(%s)" -- "$cur") )
+    return
+  fi
+  case "$cmd" in
+    %s)
+      COMPREPLY=( $(compgen -W "$(exp __complete-ids 2>/dev/null | cut -f1)" -- "$cur") )
+      ;;
+    completion)
+      COMPREPLY=( $(compgen -W "bash zsh" -- "$cur") )
+      ;;
+  esac
+}
+complete -o default -F _exp_complete exp
+`, strings.Join(completionCommands, " "), completionFlagsCmd, strings.Join(completionIDCommands, "|"))
+}
+
+func zshCompletionScript() string {
+	return fmt.Sprintf(`#compdef exp
+# zsh completion for exp; install with: source <(exp completion zsh)
+_exp() {
+  local -a commands ids profiles flags
+  local cmd
+  commands=(%s)
+  if (( CURRENT == 2 )); then
+    _describe 'command' commands
+    return
+  fi
+  cmd=${words[2]}
+  if [[ ${words[CURRENT-1]} == (--profile|-profile) ]]; then
+    profiles=(${(f)"$(exp __complete-profiles 2>/dev/null)"})
+    _describe 'profile' profiles
+    return
+  fi
+  if [[ $PREFIX == -* ]]; then
+    flags=(${(f)"$(%s)"})
+    _describe 'flag' flags
+    return
+  fi
+  case $cmd in
+    %s)
+      ids=(${(f)"$(exp __complete-ids 2>/dev/null | sed -e 's/:/\\:/g' -e 's/	/:/')"})
+      _describe -V 'experiment' ids
+      ;;
+    completion)
+      _values 'shell' bash zsh
+      ;;
+    *)
+      _files
+      ;;
+  esac
+}
+compdef _exp exp
+`, strings.Join(completionCommands, " "), completionFlagsCmd, strings.Join(completionIDCommands, "|"))
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompletionScriptsCoverCommands(t *testing.T) {
+	for name, script := range map[string]string{"bash": bashCompletionScript(), "zsh": zshCompletionScript()} {
+		for _, cmd := range completionCommands {
+			if !strings.Contains(script, cmd) {
+				t.Errorf("%s script missing command %q", name, cmd)
+			}
+		}
+		if !strings.Contains(script, "__complete-ids") || !strings.Contains(script, "__complete-profiles") {
+			t.Errorf("%s script does not use the completion helpers", name)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A config or run config may start from others:
+//
+//	include: ["~/work/exp-shared/cluster.yaml", "gpu.toml"]
+//
+// Included files are read first, in order, and the including file's own
+// settings go on top, so it wins; mappings merge key by key, anything else
+// (lists included) is replaced whole. Relative paths are relative to the
+// including file. Each value remembers which file set it, for exp config
+// show and for errors about unknown keys.
+
+const (
+	// maxIncludeDepth bounds how deep includes nest.
+	maxIncludeDepth = 8
+	// maxIncludeFiles bounds how many files one config reads in all.
+	maxIncludeFiles = 32
+)
+
+// configDoc is a config document with the file each value came from, by
+// the path of every value that is not a mapping.
+type configDoc struct {
+	values map[string]interface{}
+	from   map[string]string
+}
+
+// includeLoader reads one config and everything it includes.
+type includeLoader struct {
+	stack []string // the files being read, outermost first
+	files int
+}
+
+// loadConfigDocument reads the config file at path with its includes.
+func loadConfigDocument(path string) (*configDoc, error) {
+	var l includeLoader
+	return l.load(path)
+}
+
+// unmarshalConfigFile reads the config file at path with its includes into
+// target.
+func unmarshalConfigFile(path string, target interface{}) error {
+	doc, err := loadConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	if len(doc.values) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(doc.values)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, target)
+}
+
+func (l *includeLoader) load(path string) (*configDoc, error) {
+	for i, open := range l.stack {
+		if open == path {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(l.stack[i:], path), " -> "))
+		}
+	}
+	if len(l.stack) > maxIncludeDepth {
+		return nil, fmt.Errorf("%s: includes nest more than %d deep", path, maxIncludeDepth)
+	}
+	if l.files++; l.files > maxIncludeFiles {
+		return nil, fmt.Errorf("%s: more than %d config files included", path, maxIncludeFiles)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if len(l.stack) > 0 {
+			return nil, fmt.Errorf("included from %s: %w", l.stack[len(l.stack)-1], err)
+		}
+		return nil, err
+	}
+	values, err := decodeConfigDocument(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	includes, err := includePaths(path, values["include"])
+	if err != nil {
+		return nil, err
+	}
+	delete(values, "include")
+
+	doc := &configDoc{values: make(map[string]interface{}), from: make(map[string]string)}
+	l.stack = append(l.stack, path)
+	for _, inc := range includes {
+		included, err := l.load(inc)
+		if err != nil {
+			return nil, err
+		}
+		doc.merge(doc.values, included.values, included.from, "")
+	}
+	l.stack = l.stack[:len(l.stack)-1]
+	own := make(map[string]string)
+	markConfigSource(values, "", path, own)
+	doc.merge(doc.values, values, own, "")
+	return doc, nil
+}
+
+// includePaths resolves the include value of the file at path, a path or
+// a list of them.
+func includePaths(path string, value interface{}) ([]string, error) {
+	var names []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = []interface{}{v}
+	case []interface{}:
+		names = v
+	default:
+		return nil, fmt.Errorf("%s: include must be a path or a list of paths", path)
+	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		s, ok := name.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s: include must be a path or a list of paths", path)
+		}
+		if !strings.HasPrefix(s, "~") && !filepath.IsAbs(s) {
+			s = filepath.Join(filepath.Dir(path), s)
+		}
+		abs, err := expandLocalPath(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %s: %w", path, name, err)
+		}
+		paths[i] = abs
+	}
+	return paths, nil
+}
+
+// markConfigSource records file as the source of every value in values.
+func markConfigSource(values map[string]interface{}, prefix, file string, from map[string]string) {
+	for k, v := range values {
+		path := joinConfigPath(prefix, k)
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			markConfigSource(m, path, file, from)
+			continue
+		}
+		from[path] = file
+	}
+}
+
+// merge lays values, whose sources are in from, over target, the mapping
+// at prefix in d.
+func (d *configDoc) merge(target, values map[string]interface{}, from map[string]string, prefix string) {
+	for k, v := range values {
+		path := joinConfigPath(prefix, k)
+		src, isMap := v.(map[string]interface{})
+		if dst, ok := target[k].(map[string]interface{}); ok && isMap {
+			d.merge(dst, src, from, path)
+			continue
+		}
+		for p := range d.from {
+			if p == path || strings.HasPrefix(p, path+".") {
+				delete(d.from, p)
+			}
+		}
+		target[k] = copyConfigValue(v)
+		for p, file := range from {
+			if p == path || strings.HasPrefix(p, path+".") {
+				d.from[p] = file
+			}
+		}
+	}
+}
+
+// copyConfigValue copies mappings, so later merges into the copy leave the
+// included file's document alone.
+func copyConfigValue(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = copyConfigValue(v)
+	}
+	return c
+}
+
+// source is the file that set the value at path, or one below it.
+func (d *configDoc) source(path string) string {
+	if file, ok := d.from[path]; ok {
+		return file
+	}
+	var files []string
+	for p, file := range d.from {
+		if strings.HasPrefix(p, path+".") {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return ""
+	}
+	return files[0]
+}
+
+// exp config show [file]
+func cmdConfigShow(args []string) error {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp config show [file]\n\n")
+		fmt.Fprintf(os.Stderr, "Prints every setting of the config file (%s), or of the given config or run\nconfig file, with its includes merged in and the file each value came from.\n", configPathHint())
+		fs.PrintDefaults()
+	}
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	var path string
+	switch len(paths) {
+	case 0:
+		if path, err = globalConfigPath(); err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("no config file found (expected %s)", configPathHint())
+		}
+	case 1:
+		if path, err = expandLocalPath(paths[0]); err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("at most one file may be given")
+	}
+	doc, err := loadConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	return printConfigDoc(os.Stdout, doc)
+}
+
+// printConfigDoc writes each value of doc as path = JSON value, followed
+// by the file it came from.
+func printConfigDoc(w io.Writer, doc *configDoc) error {
+	var rows [][2]string
+	var walk func(values map[string]interface{}, prefix string) error
+	walk = func(values map[string]interface{}, prefix string) error {
+		for k, v := range values {
+			path := joinConfigPath(prefix, k)
+			if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+				if err := walk(m, path); err != nil {
+					return err
+				}
+				continue
+			}
+			buf, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, [2]string{path + " = " + string(buf), doc.from[path]})
+		}
+		return nil
+	}
+	if err := walk(doc.values, ""); err != nil {
+		return err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r[0]))
+	}
+	for _, r := range rows {
+		if _, err := fmt.Fprintf(w, "%-*s  # %s\n", width, r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConfigInclude(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("EXP_HOME", filepath.Join(home, "exp"))
+	writeConfigFiles(t, home, map[string]string{
+		"work/exp-shared/cluster.yaml": "include: gpu.toml\ndefaults:\n  remote: u@cluster\n  log_dir: /scratch/u/logs\n  artifact_patterns: [\"*.json\"]\n",
+		"work/exp-shared/gpu.toml":     "[profiles.gpu]\nremote = \"u@gpu\"\nscript = \"train.sh\"\n",
+		"exp/config.yaml":              "include: [\"~/work/exp-shared/cluster.yaml\"]\ndefaults:\n  log_dir: /home/u/logs\n  artifact_patterns: [\"*.pt\"]\nprofiles:\n  gpu:\n    remote: u@mine\n",
+	})
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Defaults.Remote != "u@cluster" || cfg.Defaults.LogDir != "/home/u/logs" {
+		t.Errorf("defaults = %+v", cfg.Defaults)
+	}
+	if got := cfg.Defaults.ArtifactPatterns; len(got) != 1 || got[0] != "*.pt" {
+		t.Errorf("artifact_patterns = %v, want the including file's list", got)
+	}
+	if gpu := cfg.Profiles["gpu"]; gpu.Remote != "u@mine" || gpu.Script != "train.sh" {
+		t.Errorf("gpu = %+v", gpu)
+	}
+
+	doc, err := loadConfigDocument(filepath.Join(home, "exp", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := printConfigDoc(&out, doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`defaults.remote = "u@cluster"`,
+		filepath.Join(home, "work", "exp-shared", "cluster.yaml"),
+		`profiles.gpu.script = "train.sh"`,
+		filepath.Join(home, "work", "exp-shared", "gpu.toml"),
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("config show output lacks %q:\n%s", want, out.String())
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.HasPrefix(line, "defaults.log_dir") && !strings.HasSuffix(line, filepath.Join(home, "exp", "config.yaml")) {
+			t.Errorf("log_dir should come from config.yaml: %s", line)
+		}
+	}
+}
+
+func TestRunConfigFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"shared/base.json": `{"remote": "u@cluster", "log_dir": "/scratch/logs", "artifact_patternz": ["x"]}`,
+		"runs/train.yaml":  "include: ../shared/base.json\nname: train\nlog_dir: /home/logs\n",
+	})
+	path := filepath.Join(dir, "runs", "train.yaml")
+	cfg, err := loadRunConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Remote != "u@cluster" || cfg.Name != "train" || cfg.LogDir != "/home/logs" {
+		t.Errorf("run config = %+v", cfg)
+	}
+	unknown, err := checkConfigFile(path, &RunConfigFile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unknown) != 1 || unknown[0].File != filepath.Join(dir, "shared", "base.json") {
+		t.Errorf("unknown = %+v, want artifact_patternz from base.json", unknown)
+	}
+}
+
+func TestConfigIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":       "include: b.yaml\n",
+		"b.yaml":       "include: [\"a.yaml\"]\n",
+		"missing.yaml": "include: nowhere.yaml\n",
+		"bad.yaml":     "include: {\"x\": 1}\n",
+	}
+	for i := 0; i <= maxIncludeDepth+1; i++ {
+		files[filepath.Join("deep", strings.Repeat("d", i+1)+".yaml")] = "include: " + strings.Repeat("d", i+2) + ".yaml\n"
+	}
+	files[filepath.Join("deep", strings.Repeat("d", maxIncludeDepth+3)+".yaml")] = "name: x\n"
+	writeConfigFiles(t, dir, files)
+
+	tests := []struct{ file, want string }{
+		{"a.yaml", "include cycle: " + filepath.Join(dir, "a.yaml") + " -> " + filepath.Join(dir, "b.yaml") + " -> " + filepath.Join(dir, "a.yaml")},
+		{"missing.yaml", "included from " + filepath.Join(dir, "missing.yaml")},
+		{"bad.yaml", "include must be a path or a list of paths"},
+		{filepath.Join("deep", "d.yaml"), "includes nest more than"},
+	}
+	for _, tt := range tests {
+		_, err := loadRunConfigFile(filepath.Join(dir, tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.file, err, tt.want)
+		}
+	}
+}
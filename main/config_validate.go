@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Config files are decoded leniently: a key no struct field claims is
+// dropped, so a typo such as artifact_patern silently does nothing. The
+// strict check walks the document as parsed, before the JSON round trip
+// into Config, RunProfile or RunConfigFile, and names every key none of
+// their fields takes, with the nearest known key when one is close.
+
+// unknownConfigKey is a key no field takes, by its path in the document.
+type unknownConfigKey struct {
+	Path       string // e.g. profiles.explorer.artifact_patern
+	Suggestion string // a known key at the same place, or ""
+	File       string // the included file that set it, or ""
+}
+
+func (k unknownConfigKey) String() string {
+	s := "unknown key " + k.Path
+	if k.Suggestion != "" {
+		s += fmt.Sprintf(" (did you mean %s?)", k.Suggestion)
+	}
+	if k.File != "" {
+		s += " in " + k.File
+	}
+	return s
+}
+
+// decodeConfigDocument parses config data by its extension (JSON, with a
+// YAML fallback, YAML or TOML) into the generic document the config
+// structs are unmarshalled from.
+func decodeConfigDocument(data []byte, ext string) (map[string]interface{}, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	ext = strings.ToLower(ext)
+	if ext == ".toml" {
+		return parseTOMLDocument(trimmed)
+	}
+	if ext != ".yaml" && ext != ".yml" {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(trimmed, &doc); err == nil {
+			return doc, nil
+		}
+	}
+	return parseYAMLDocument(trimmed)
+}
+
+// unknownConfigKeys lists the keys of doc that no field of t takes, sorted
+// by path.
+func unknownConfigKeys(doc interface{}, t reflect.Type) []unknownConfigKey {
+	var unknown []unknownConfigKey
+	walkConfigKeys(doc, t, "", &unknown)
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Path < unknown[j].Path })
+	return unknown
+}
+
+func walkConfigKeys(node interface{}, t reflect.Type, path string, unknown *[]unknownConfigKey) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		// It reads its value its own way.
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := configFields(t)
+		for key, value := range m {
+			field, ok := fields[key]
+			if !ok {
+				*unknown = append(*unknown, unknownConfigKey{Path: joinConfigPath(path, key), Suggestion: nearestConfigKey(key, fields)})
+				continue
+			}
+			walkConfigKeys(value, field, joinConfigPath(path, key), unknown)
+		}
+	case reflect.Map:
+		if m, ok := node.(map[string]interface{}); ok {
+			for key, value := range m {
+				walkConfigKeys(value, t.Elem(), joinConfigPath(path, key), unknown)
+			}
+		}
+	case reflect.Slice:
+		if items, ok := node.([]interface{}); ok {
+			for i, item := range items {
+				walkConfigKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+			}
+		}
+	}
+}
+
+// configFields maps the JSON keys of struct t to their types.
+func configFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// nearestConfigKey is the known key closest to key by edit distance, when
+// it is close enough to be the likely intent.
+func nearestConfigKey(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 0
+	for name := range fields {
+		d := editDistance(key, name)
+		if best == "" || d < bestDist || d == bestDist && name < best {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" || bestDist > max(2, len(key)/4) {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// checkConfigFile reports the unknown keys of the config file at path and
+// the files it includes, read as target's type.
+func checkConfigFile(path string, target interface{}) ([]unknownConfigKey, error) {
+	doc, err := loadConfigDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	unknown := unknownConfigKeys(doc.values, reflect.TypeOf(target))
+	for i, k := range unknown {
+		if file := doc.source(k.Path); file != path {
+			unknown[i].File = file
+		}
+	}
+	return unknown, nil
+}
+
+// strictConfigError is checkConfigFile as an error, for exp run
+// --strict-config.
+func strictConfigError(path string, target interface{}) error {
+	unknown, err := checkConfigFile(path, target)
+	if err != nil || len(unknown) == 0 {
+		return err
+	}
+	lines := make([]string, len(unknown))
+	for i, k := range unknown {
+		lines[i] = "  " + k.String()
+	}
+	return fmt.Errorf("%s has %d unknown key(s):\n%s", path, len(unknown), strings.Join(lines, "\n"))
+}
+
+// globalConfigPath is the config file loadConfig reads, or "" when there
+// is none.
+func globalConfigPath() (string, error) {
+	paths, err := defaultConfigPaths()
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// exp config validate [--strict=false] [file...]
+// exp config show [file]
+func cmdConfig(args []string) error {
+	if len(args) == 0 {
+		printConfigUsage()
+		return fmt.Errorf("subcommand is required")
+	}
+	switch args[0] {
+	case "validate":
+		return cmdConfigValidate(args[1:])
+	case "show":
+		return cmdConfigShow(args[1:])
+	default:
+		printConfigUsage()
+		return fmt.Errorf("unknown config subcommand %q", args[0])
+	}
+}
+
+func printConfigUsage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  exp config validate [--strict=false] [file...]   Parse the config (or the given config and run config files) and report unknown keys
+  exp config show [file]                           Print every setting, with includes merged in, and the file that set it
+`)
+}
+
+func cmdConfigValidate(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	var strict bool
+	fs.BoolVar(&strict, "strict", true, "Report keys no setting takes, such as misspelt ones")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp config validate [--strict=false] [file...]\n\n")
+		fmt.Fprintf(os.Stderr, "Without files, checks the config file (%s). A file named config.json, config.yaml,\nconfig.yml or config.toml is checked as a config file, any other as a run config (--config-file).\n", configPathHint())
+		fs.PrintDefaults()
+	}
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		path, err := globalConfigPath()
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("no config file found (expected %s)", configPathHint())
+		}
+		paths = []string{path}
+	}
+	problems := 0
+	for _, path := range paths {
+		var target interface{} = &RunConfigFile{}
+		if slices.Contains(configFileNames, filepath.Base(path)) {
+			target = &Config{}
+		}
+		if err := unmarshalConfigFile(path, target); err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			problems++
+			continue
+		}
+		var unknown []unknownConfigKey
+		if strict {
+			if unknown, err = checkConfigFile(path, target); err != nil {
+				return err
+			}
+		}
+		if len(unknown) == 0 {
+			fmt.Printf("%s: OK\n", path)
+			continue
+		}
+		for _, k := range unknown {
+			fmt.Printf("%s: %s\n", path, k)
+		}
+		problems += len(unknown)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnknownConfigKeys(t *testing.T) {
+	doc := `
+defaults:
+  remote: u@login
+  compress_level: 3
+profiles:
+  explorer:
+    artifact_patern: results/.*
+    artifact_sources:
+      - path: /scratch/u/run
+        artifact_patterns: [".*"]
+      - path: /scratch/u/eval
+        artifact_paterns: [".*"]
+        prune_dirs: [ckpt]
+        colour: blue
+    metrics:
+      - pattern: x
+        key: [loss]
+report:
+  markdown_templte: /t.md
+# notify_local is a profile setting, so nothing at the top is close.
+notify_lcoal: true
+`
+	m, err := parseYAMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, k := range unknownConfigKeys(m, reflect.TypeOf(&Config{})) {
+		got = append(got, k.String())
+	}
+	want := []string{
+		"unknown key notify_lcoal",
+		"unknown key profiles.explorer.artifact_patern (did you mean artifact_pattern?)",
+		"unknown key profiles.explorer.artifact_sources[1].artifact_paterns (did you mean artifact_patterns?)",
+		"unknown key profiles.explorer.artifact_sources[1].colour",
+		"unknown key profiles.explorer.metrics[0].key (did you mean keys?)",
+		"unknown key report.markdown_templte (did you mean markdown_template?)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStrictRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.json")
+	data := `{"name": "sweep", "remote": "u@h", "artifact_sources": [{"path": "/r", "artifact_patterns": [".*"], "flaten": true}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := strictConfigError(path, &RunConfigFile{})
+	if err == nil || !strings.Contains(err.Error(), "unknown key artifact_sources[0].flaten (did you mean flatten?)") {
+		t.Errorf("err = %v", err)
+	}
+	// The lenient load still takes the rest.
+	if cfg, err := loadRunConfigFile(path); err != nil || cfg.Name != "sweep" {
+		t.Errorf("load: %+v, %v", cfg, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"name": "sweep", "compress_level": "3"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := strictConfigError(path, &RunConfigFile{}); err != nil {
+		t.Errorf("clean config: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+const backupFilePrefix = "experiments-"
+
+// defaultDBBusyTimeout is how long a statement waits for another process's
+// lock before failing with "database is locked".
+const defaultDBBusyTimeout = 5 * time.Second
+
+// dbBusyTimeout is defaultDBBusyTimeout, or EXP_DB_BUSY_TIMEOUT (e.g. 30s)
+// when set.
+func dbBusyTimeout() (time.Duration, error) {
+	v := os.Getenv("EXP_DB_BUSY_TIMEOUT")
+	if v == "" {
+		return defaultDBBusyTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid EXP_DB_BUSY_TIMEOUT %q (examples: 5s, 30s)", v)
+	}
+	return d, nil
+}
+
+// execer is the write side *sql.DB and *sql.Tx share.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// dbBusyRetries is how many more times inTx runs a transaction that still
+// found the database locked after the busy timeout.
+const dbBusyRetries = 3
+
+// inTx runs fn in a transaction and commits it, retrying a few times with a
+// short pause when the database stays locked. fn may run more than once, so
+// it must only touch the database.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	for attempt := 0; ; attempt++ {
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			if err := fn(tx); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}()
+		if !isBusy(err) || attempt >= dbBusyRetries {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * 100 * time.Millisecond)
+	}
+}
+
+// isBusy reports whether err is SQLite's SQLITE_BUSY or SQLITE_LOCKED, in
+// any of their extended forms.
+func isBusy(err error) bool {
+	var se *sqlite.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.Code() & 0xff {
+	case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+		return true
+	}
+	return false
+}
+
+// exp db backup [path] [--keep N] | exp db vacuum | exp db check
+func cmdDB(args []string) error {
+	if len(args) == 0 {
+		printDBUsage()
+		return fmt.Errorf("subcommand is required")
+	}
+	switch args[0] {
+	case "backup":
+		return cmdDBBackup(args[1:])
+	case "vacuum":
+		return cmdDBVacuum(args[1:])
+	case "check":
+		return cmdDBCheck(args[1:])
+	case "migrate-home":
+		return cmdDBMigrateHome(args[1:])
+	default:
+		printDBUsage()
+		return fmt.Errorf("unknown db subcommand %q", args[0])
+	}
+}
+
+func printDBUsage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  exp db backup [path] [--keep N]   Online backup (VACUUM INTO); defaults to <data dir>/backups/experiments-<timestamp>.db
+  exp db vacuum                     Rebuild the database file to reclaim free pages
+  exp db check                      Run PRAGMA integrity_check and report the schema version and row counts per table
+  exp db migrate-home [--dry-run]   Move a ~/.exp installation to the config and data directories (EXP_HOME or XDG)
+`)
+}
+
+func cmdDBBackup(args []string) error {
+	fs := flag.NewFlagSet("db backup", flag.ExitOnError)
+	var keep int
+	fs.IntVar(&keep, "keep", 0, "Keep only the newest N timestamped backups in the default backup directory (0 keeps all)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp db backup [path] [--keep N]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return fmt.Errorf("at most one backup path may be given")
+	}
+
+	backupDir, err := defaultBackupDir()
+	if err != nil {
+		return err
+	}
+	target := ""
+	if len(positional) == 1 {
+		if target, err = expandLocalPath(positional[0]); err != nil {
+			return fmt.Errorf("backup path: %w", err)
+		}
+	} else {
+		if err := os.MkdirAll(backupDir, privateDirMode); err != nil {
+			return err
+		}
+		target = filepath.Join(backupDir, backupFilePrefix+time.Now().Format("20060102-150405")+".db")
+	}
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("backup target %s already exists", target)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	// VACUUM INTO takes a consistent snapshot through SQLite's own locking, so
+	// it is safe while a monitor process keeps writing.
+	if _, err := db.Exec(`VACUUM INTO ?`, target); err != nil {
+		return fmt.Errorf("backup to %s: %w", target, err)
+	}
+	if err := os.Chmod(target, privateFileMode); err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up database to %s (%s)\n", target, formatBytes(info.Size()))
+
+	if keep > 0 {
+		removed, err := pruneBackups(backupDir, keep)
+		if err != nil {
+			return err
+		}
+		for _, path := range removed {
+			fmt.Printf("Removed old backup %s\n", path)
+		}
+	}
+	return nil
+}
+
+func defaultBackupDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups"), nil
+}
+
+// pruneBackups keeps the newest keep timestamped backups in dir and deletes
+// the rest. Only files following the default naming scheme are considered.
+func pruneBackups(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupFilePrefix) && strings.HasSuffix(e.Name(), ".db") {
+			names = append(names, e.Name())
+		}
+	}
+	// Timestamps sort lexically, newest last.
+	sort.Strings(names)
+	var removed []string
+	for len(names) > keep {
+		path := filepath.Join(dir, names[0])
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+		names = names[1:]
+	}
+	return removed, nil
+}
+
+func cmdDBVacuum(args []string) error {
+	fs := flag.NewFlagSet("db vacuum", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path, err := dbPath()
+	if err != nil {
+		return err
+	}
+	before, _ := os.Stat(path)
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if before != nil {
+		fmt.Printf("Vacuumed %s: %s -> %s\n", path, formatBytes(before.Size()), formatBytes(after.Size()))
+	} else {
+		fmt.Printf("Vacuumed %s (%s)\n", path, formatBytes(after.Size()))
+	}
+	return nil
+}
+
+func cmdDBCheck(args []string) error {
+	fs := flag.NewFlagSet("db check", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path, err := dbPath()
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	fmt.Printf("Database: %s\n", path)
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema version: %d (latest %d)\n", version, latestSchemaVersion())
+	problems, err := integrityCheck(db)
+	if err != nil {
+		return err
+	}
+	counts, err := tableRowCounts(db)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Tables:")
+	for _, tc := range counts {
+		fmt.Printf("  %-20s %d row(s)\n", tc.name, tc.rows)
+	}
+	if len(problems) > 0 {
+		fmt.Println("Integrity check: FAILED")
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+		return fmt.Errorf("integrity check reported %d problem(s)", len(problems))
+	}
+	fmt.Println("Integrity check: ok")
+	return nil
+}
+
+func integrityCheck(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("integrity_check: %w", err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+type tableCount struct {
+	name string
+	rows int64
+}
+
+func tableRowCounts(db *sql.DB) ([]tableCount, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var out []tableCount
+	for _, name := range names {
+		var n int64
+		if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %q`, name)).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s: %w", name, err)
+		}
+		out = append(out, tableCount{name: name, rows: n})
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"experiments-20250101-000000.db",
+		"experiments-20250102-000000.db",
+		"experiments-20250103-000000.db",
+		"manual-copy.db",
+	}
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(dir, n), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := pruneBackups(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != names[0] {
+		t.Fatalf("removed = %v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manual-copy.db")); err != nil {
+		t.Fatalf("non-timestamped backup was touched: %v", err)
+	}
+}
+
+func TestBackupAndCheck(t *testing.T) {
+	db := openTestDB(t)
+	insertTestExperiment(t, db, "a", "COMPLETED", "")
+	target := filepath.Join(t.TempDir(), "copy.db")
+	if _, err := db.Exec(`VACUUM INTO ?`, target); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := integrityCheck(db)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("integrityCheck = %v, %v", problems, err)
+	}
+	counts, err := tableRowCounts(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range counts {
+		if c.name == "experiments" && c.rows == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("counts = %+v", counts)
+	}
+	if info, err := os.Stat(target); err != nil || info.Size() == 0 {
+		t.Fatalf("backup missing: %v", err)
+	}
+}
+
+// hammerDB mixes the writes a monitor makes with the reads of exp list on
+// its own connection pool, the way a separate process would.
+func hammerDB(id int64, rounds int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for i := 0; i < rounds; i++ {
+		status := "RUNNING"
+		if i%2 == 1 {
+			status = "PENDING"
+		}
+		if err := changeExperimentStatus(db, id, status, "hammer", nil); err != nil {
+			return fmt.Errorf("change status: %w", err)
+		}
+		now := time.Now().UTC()
+		if err := recordArtifactSync(db, id, &now, &syncStats{Files: i, Updated: -1, UpdatedBytes: -1}, ""); err != nil {
+			return fmt.Errorf("record sync: %w", err)
+		}
+		if _, err := loadExperiments(db, ""); err != nil {
+			return fmt.Errorf("list: %w", err)
+		}
+	}
+	return nil
+}
+
+// TestDBHammerProcess is the child half of TestConcurrentDBAccess.
+func TestDBHammerProcess(t *testing.T) {
+	id, err := strconv.ParseInt(os.Getenv("EXP_TEST_HAMMER_ID"), 10, 64)
+	if err != nil {
+		t.Skip("only run as a child of TestConcurrentDBAccess")
+	}
+	if err := hammerDB(id, 40); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentDBAccess(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "busy", "RUNNING", "")
+
+	var procs []*exec.Cmd
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestDBHammerProcess$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("EXP_TEST_HAMMER_ID=%d", id))
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		procs = append(procs, cmd)
+	}
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- hammerDB(id, 40) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("goroutine: %v", err)
+		}
+	}
+	for _, cmd := range procs {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("child process: %v", err)
+		}
+	}
+
+	events, err := loadStatusEvents(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 6 * 40; len(events) != want {
+		t.Errorf("status events = %d, want %d", len(events), want)
+	}
+	var mode string
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q, %v", mode, err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// With max_monitor, a foreground monitor gives up after a while instead of
+// polling a five-day job from a laptop. It leaves a marker in the status
+// history, not a status: the job runs on, and exp watch, exp refresh
+// --fetch-missing or the monitor daemon take over, syncing the artifacts of
+// a job that finished while nobody watched.
+
+// statusMonitorDetached marks, in the status history, where a monitor
+// stopped after max_monitor. It is never an experiment's status.
+const statusMonitorDetached = "MONITOR_DETACHED"
+
+// parseMaxMonitor checks max_monitor as given in a run config or on the
+// command line; empty means no limit.
+func parseMaxMonitor(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid max_monitor %q (examples: 12h, 30m)", s)
+	}
+	return d, nil
+}
+
+// detachMonitor records that the monitor of exp stopped after monitoring for
+// d and says how to pick the job up again.
+func detachMonitor(db *sql.DB, exp *Experiment, d time.Duration) error {
+	note := fmt.Sprintf("monitor stopped after max_monitor %s while the job was %s", d, exp.JobStatus)
+	if err := recordStatusEvent(db, exp.ID, statusMonitorDetached, note); err != nil {
+		return err
+	}
+	fmt.Printf("Stopped monitoring job %s after %s (max_monitor); it is still %s.\n", exp.JobID, d, exp.JobStatus)
+	fmt.Printf("Resume with: exp watch %d (or exp refresh --fetch-missing once it has finished)\n", exp.ID)
+	return nil
+}
+
+// missedFinalSync reports whether exp finished without the sync after
+// completion, as when no monitor saw it finish: it has artifacts to fetch
+// and none were fetched since it ended. A sync while it ran does not count,
+// and one deferred over confirm_over waits for exp fetch.
+func (exp *Experiment) missedFinalSync() bool {
+	if isActiveStatus(exp.JobStatus) || exp.JobStatus == statusSyncDeferred ||
+		exp.ArtifactDest == "" || len(exp.EffectiveArtifactSources()) == 0 {
+		return false
+	}
+	return exp.ArtifactLastSync.IsZero() || exp.ArtifactLastSync.Before(exp.CompletedAt)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMonitorDetachesAfterMaxMonitor(t *testing.T) {
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "squeue"), []byte("#!/bin/sh\necho \"$3 RUNNING\"\n"), 0o755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "five-days", "RUNNING", "")
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := monitorExperiment(db, exp, 10*time.Millisecond, monitorOptions{MaxMonitor: 50 * time.Millisecond}); err != nil {
+		t.Fatalf("detaching is not an error: %v", err)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.JobStatus != "RUNNING" {
+		t.Errorf("status = %s after detaching", exp.JobStatus)
+	}
+	events, _ := loadStatusEvents(db, id)
+	if len(events) == 0 || events[len(events)-1].Status != statusMonitorDetached {
+		t.Fatalf("events = %+v", events)
+	}
+
+	// The marker is not a status: a job back in the queue afterwards was
+	// still preempted from RUNNING.
+	if err := changeExperimentStatus(db, id, "PENDING", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	events, _ = loadStatusEvents(db, id)
+	if last := events[len(events)-1]; last.Note != "preempted and requeued" {
+		t.Errorf("last event = %+v", last)
+	}
+}
+
+func TestMissedFinalSync(t *testing.T) {
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	ended := created.Add(5 * 24 * time.Hour)
+	sources := []ArtifactSource{{Path: "/scratch/u/run", Patterns: []string{".*"}}}
+	tests := []struct {
+		name     string
+		status   string
+		lastSync time.Time
+		dest     string
+		want     bool
+	}{
+		{"never synced", "COMPLETED", time.Time{}, "/a", true},
+		{"synced while running only", "COMPLETED", created.Add(time.Hour), "/a", true},
+		{"synced after it ended", "FAILED", ended.Add(time.Minute), "/a", false},
+		{"still running", "RUNNING", time.Time{}, "/a", false},
+		{"nowhere to sync to", "COMPLETED", time.Time{}, "", false},
+	}
+	for _, tt := range tests {
+		exp := &Experiment{JobStatus: tt.status, CreatedAt: created, CompletedAt: ended,
+			ArtifactLastSync: tt.lastSync, ArtifactDest: tt.dest, ArtifactSources: sources}
+		if got := exp.missedFinalSync(); got != tt.want {
+			t.Errorf("%s: missedFinalSync = %v", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// fieldDiff describes one compared snapshot field.
+type fieldDiff struct {
+	Field    string      `json:"field"`
+	A        interface{} `json:"a"`
+	B        interface{} `json:"b"`
+	Equal    bool        `json:"equal"`
+	Identity bool        `json:"identity,omitempty"`
+	ArgsDiff []tokenOp   `json:"args_diff,omitempty"`
+}
+
+// diffIdentityFields name an experiment rather than configure it: two runs
+// of the same config always differ in them, so they leave the exit status
+// alone and are only listed with --all.
+var diffIdentityFields = map[string]bool{"name": true, "artifact_dest": true}
+
+// tokenOp is one step of a token-level diff: "=" kept, "-" only in A, "+" only in B.
+type tokenOp struct {
+	Op    string `json:"op"`
+	Token string `json:"token"`
+}
+
+// exp diff <id1> <id2> [--all] [--json]
+func cmdDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var (
+		showAll bool
+		asJSON  bool
+	)
+	fs.BoolVar(&showAll, "all", false, "Show identical fields and the name and artifact_dest, too")
+	fs.BoolVar(&asJSON, "json", false, "Emit the comparison as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp diff <id1> <id2> [--all] [--json]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("two experiment ids are required")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	a, err := findExperiment(db, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := findExperiment(db, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diffs := diffSnapshots(a.runSnapshot(), b.runSnapshot())
+	differ := false
+	var shown []fieldDiff
+	for _, d := range diffs {
+		if !d.Equal && !d.Identity {
+			differ = true
+		}
+		if showAll || (!d.Equal && !d.Identity) {
+			shown = append(shown, d)
+		}
+	}
+
+	if asJSON {
+		out := struct {
+			A           int64       `json:"a"`
+			B           int64       `json:"b"`
+			Differences bool        `json:"differences"`
+			Fields      []fieldDiff `json:"fields"`
+		}{a.ID, b.ID, differ, shown}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("--- experiment %d (%s)\n", a.ID, a.Name)
+		fmt.Printf("+++ experiment %d (%s)\n", b.ID, b.Name)
+		if !differ {
+			fmt.Println("No differences.")
+		}
+		for _, d := range shown {
+			printFieldDiff(d)
+		}
+	}
+	if differ {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// diffSnapshots compares every RunSnapshot field in declaration order, so new
+// snapshot fields are picked up automatically. Args get a token-level diff.
+func diffSnapshots(a, b RunSnapshot) []fieldDiff {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	var out []fieldDiff
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = f.Name
+		}
+		fa, fb := va.Field(i).Interface(), vb.Field(i).Interface()
+		d := fieldDiff{Field: name, A: fa, B: fb, Equal: reflect.DeepEqual(normalizeEmpty(fa), normalizeEmpty(fb)), Identity: diffIdentityFields[name]}
+		if name == "args" {
+			d.ArgsDiff = diffTokens(a.Args, b.Args)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// normalizeEmpty treats nil and empty slices as equal.
+func normalizeEmpty(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		return nil
+	}
+	return v
+}
+
+// diffTokens computes a longest-common-subsequence diff over argument tokens.
+func diffTokens(a, b []string) []tokenOp {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []tokenOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, tokenOp{"=", a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, tokenOp{"-", a[i]})
+			i++
+		default:
+			ops = append(ops, tokenOp{"+", b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, tokenOp{"-", a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, tokenOp{"+", b[j]})
+	}
+	return ops
+}
+
+func printFieldDiff(d fieldDiff) {
+	if d.Equal {
+		fmt.Printf("  %-22s %s\n", d.Field+":", formatDiffValue(d.A))
+		return
+	}
+	if d.Field == "args" {
+		var parts []string
+		for _, op := range d.ArgsDiff {
+			switch op.Op {
+			case "-":
+				parts = append(parts, "[-"+op.Token+"-]")
+			case "+":
+				parts = append(parts, "{+"+op.Token+"+}")
+			default:
+				parts = append(parts, op.Token)
+			}
+		}
+		fmt.Printf("~ %-22s %s\n", "args:", strings.Join(parts, " "))
+		return
+	}
+	fmt.Printf("~ %s\n", d.Field+":")
+	fmt.Printf("    - %s\n", formatDiffValue(d.A))
+	fmt.Printf("    + %s\n", formatDiffValue(d.B))
+}
+
+func formatDiffValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if val == "" {
+			return "(empty)"
+		}
+		return val
+	case []string:
+		return strings.Join(val, " ")
+	}
+	if normalizeEmpty(v) == nil {
+		return "(none)"
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
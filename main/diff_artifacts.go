@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// contentDiffMaxBytes caps the files --content will diff line by line.
+	contentDiffMaxBytes = 256 * 1024
+	contentDiffContext  = 3
+)
+
+// artifactPair is one relative path compared across two experiments.
+type artifactPair struct {
+	Rel   string
+	A     *fileInfo
+	B     *fileInfo
+	State string // identical, added, removed, size-changed, content-changed
+	Diff  string // unified diff when --content matched
+}
+
+// exp diff-artifacts <id1> <id2> [--checksum] [--content PATTERN]
+func cmdDiffArtifacts(args []string) error {
+	fs := flag.NewFlagSet("diff-artifacts", flag.ExitOnError)
+	var (
+		checksum bool
+		content  string
+	)
+	fs.BoolVar(&checksum, "checksum", false, "Compare sha256 of files whose sizes match")
+	fs.StringVar(&content, "content", "", "Regex; show a unified diff for small text files whose relative path matches (e.g. '\\.json$')")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp diff-artifacts <id1> <id2> [--checksum] [--content PATTERN]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return fmt.Errorf("two experiment ids are required")
+	}
+	var contentRe *regexp.Regexp
+	if content != "" {
+		if contentRe, err = regexp.Compile(content); err != nil {
+			return fmt.Errorf("--content %q: %w", content, err)
+		}
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	var exps [2]*Experiment
+	for i, idStr := range positional {
+		if exps[i], err = findExperiment(db, idStr); err != nil {
+			db.Close()
+			return err
+		}
+		if exps[i].ArtifactDest == "" {
+			db.Close()
+			return fmt.Errorf("experiment %s has no recorded artifact destination", idStr)
+		}
+	}
+	db.Close()
+
+	pairs, err := diffArtifactTrees(exps[0], exps[1], checksum, contentRe)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("--- experiment %d (%s) %s\n", exps[0].ID, exps[0].Name, exps[0].ArtifactDest)
+	fmt.Printf("+++ experiment %d (%s) %s\n", exps[1].ID, exps[1].Name, exps[1].ArtifactDest)
+	if printArtifactPairs(os.Stdout, pairs) {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// diffArtifactTrees walks both local destinations, keeping only files that
+// match each experiment's own recorded patterns, and pairs them by path.
+func diffArtifactTrees(a, b *Experiment, checksum bool, contentRe *regexp.Regexp) ([]artifactPair, error) {
+	filesA, err := recordedLocalArtifacts(a)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := recordedLocalArtifacts(b)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []artifactPair
+	for _, rel := range unionKeys([]map[string]fileInfo{filesA, filesB}) {
+		p := artifactPair{Rel: rel}
+		if fi, ok := filesA[rel]; ok {
+			p.A = &fi
+		}
+		if fi, ok := filesB[rel]; ok {
+			p.B = &fi
+		}
+		pathA := filepath.Join(a.ArtifactDest, filepath.FromSlash(rel))
+		pathB := filepath.Join(b.ArtifactDest, filepath.FromSlash(rel))
+		switch {
+		case p.B == nil:
+			p.State = "removed"
+		case p.A == nil:
+			p.State = "added"
+		case contentRe != nil && contentRe.MatchString(rel) && p.A.Size <= contentDiffMaxBytes && p.B.Size <= contentDiffMaxBytes:
+			dataA, err := os.ReadFile(pathA)
+			if err != nil {
+				return nil, err
+			}
+			dataB, err := os.ReadFile(pathB)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case bytes.Equal(dataA, dataB):
+				p.State = "identical"
+			case p.A.Size != p.B.Size:
+				p.State = "size-changed"
+			default:
+				p.State = "content-changed"
+			}
+			if p.State != "identical" && isText(dataA) && isText(dataB) {
+				p.Diff = unifiedDiff(splitLines(dataA), splitLines(dataB), contentDiffContext)
+			}
+		case p.A.Size != p.B.Size:
+			p.State = "size-changed"
+		case checksum:
+			if p.A.SHA256, err = sha256File(pathA); err != nil {
+				return nil, err
+			}
+			if p.B.SHA256, err = sha256File(pathB); err != nil {
+				return nil, err
+			}
+			p.State = "identical"
+			if p.A.SHA256 != p.B.SHA256 {
+				p.State = "content-changed"
+			}
+		default:
+			p.State = "identical"
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, nil
+}
+
+// recordedLocalArtifacts lists the experiment's local destination, filtered
+// by its recorded artifact patterns so unrelated files in a shared
+// destination are ignored. Without recorded sources every file counts.
+func recordedLocalArtifacts(exp *Experiment) (map[string]fileInfo, error) {
+	files, err := listLocalFileInfo(exp.ArtifactDest, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("list artifacts for experiment %d: %w", exp.ID, err)
+	}
+	sources := exp.EffectiveArtifactSources()
+	if len(sources) == 0 {
+		return files, nil
+	}
+	perSource := exp.recordedFetchOptions().PerSource
+	kept := make(map[string]fileInfo)
+	for _, src := range sources {
+		compiled, err := compileMatchers(src.Patterns, src.PatternSyntax)
+		if err != nil {
+			return nil, err
+		}
+		for rel, fi := range files {
+			srcRel := rel
+			if perSource {
+				var ok bool
+				if srcRel, ok = strings.CutPrefix(rel, src.Name+"/"); !ok {
+					continue
+				}
+			}
+			if patternMatches(compiled, src.Path, srcRel) {
+				kept[rel] = fi
+			}
+		}
+	}
+	return kept, nil
+}
+
+// printArtifactPairs prints every differing pair and a summary line, and
+// reports whether anything differed.
+func printArtifactPairs(w io.Writer, pairs []artifactPair) bool {
+	counts := make(map[string]int)
+	for _, p := range pairs {
+		counts[p.State]++
+		switch p.State {
+		case "identical":
+			continue
+		case "added":
+			fmt.Fprintf(w, "%-16s %s (%s)\n", p.State, p.Rel, formatBytes(p.B.Size))
+		case "removed":
+			fmt.Fprintf(w, "%-16s %s (%s)\n", p.State, p.Rel, formatBytes(p.A.Size))
+		default:
+			fmt.Fprintf(w, "%-16s %s (%s -> %s)\n", p.State, p.Rel, formatBytes(p.A.Size), formatBytes(p.B.Size))
+		}
+		if p.Diff != "" {
+			fmt.Fprint(w, p.Diff)
+		}
+	}
+	differing := len(pairs) - counts["identical"]
+	fmt.Fprintf(w, "Compared %d file(s): %d identical, %d added, %d removed, %d size changed, %d content changed\n",
+		len(pairs), counts["identical"], counts["added"], counts["removed"], counts["size-changed"], counts["content-changed"])
+	return differing > 0
+}
+
+// isText treats data without NUL bytes as text, like diff(1) does.
+func isText(data []byte) bool {
+	return !bytes.Contains(data, []byte{0})
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// unifiedDiff renders the line diff from diffTokens as unified-diff hunks
+// with the given number of context lines.
+func unifiedDiff(a, b []string, context int) string {
+	ops := diffTokens(a, b)
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change, then extend the hunk while changes are
+		// separated by no more than 2*context unchanged lines.
+		first := start
+		for first < len(ops) && ops[first].Op == "=" {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		lo := first - context
+		if lo < start {
+			lo = start
+		}
+		hi := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].Op != "=" {
+				hi = i
+				continue
+			}
+			if i-hi > 2*context {
+				break
+			}
+		}
+		end := hi + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		lineA, lineB := 1, 1
+		for _, op := range ops[:lo] {
+			if op.Op != "+" {
+				lineA++
+			}
+			if op.Op != "-" {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		var body strings.Builder
+		for _, op := range ops[lo:end] {
+			prefix := " "
+			switch op.Op {
+			case "-":
+				prefix = "-"
+				countA++
+			case "+":
+				prefix = "+"
+				countB++
+			default:
+				countA++
+				countB++
+			}
+			body.WriteString(prefix + op.Token + "\n")
+		}
+		// An empty side is addressed by the line before it, as diff -u does.
+		if countA == 0 {
+			lineA--
+		}
+		if countB == 0 {
+			lineB--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", lineA, countA, lineB, countB, body.String())
+		start = end
+	}
+	return out.String()
+}
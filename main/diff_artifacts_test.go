@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	b := []string{"1", "2", "three", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13"}
+	want := "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if got := unifiedDiff(a, b, 3); got != want {
+		t.Fatalf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff(a, a, 3); got != "" {
+		t.Fatalf("identical input produced %q", got)
+	}
+}
+
+func TestDiffArtifactTrees(t *testing.T) {
+	write := func(dir, rel, content string) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	da, dbDir := t.TempDir(), t.TempDir()
+	write(da, "same.txt", "x\n")
+	write(dbDir, "same.txt", "x\n")
+	write(da, "res/recall.json", "{\"recall\": 0.91}\n")
+	write(dbDir, "res/recall.json", "{\"recall\": 0.93}\n")
+	write(da, "model.bin", "aaaa")
+	write(dbDir, "model.bin", "aaab")
+	write(da, "gone.log", "old")
+	write(dbDir, "new.log", "new!")
+	write(dbDir, "unrelated.tmp", "ignored by the pattern")
+
+	sources := []ArtifactSource{{Path: "/remote/res", Patterns: []string{`\.(txt|json|bin|log)$`}}}
+	a := &Experiment{ID: 1, ArtifactDest: da, ArtifactSources: sources}
+	b := &Experiment{ID: 2, ArtifactDest: dbDir, ArtifactSources: sources}
+	pairs, err := diffArtifactTrees(a, b, true, regexp.MustCompile(`\.json$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]string)
+	for _, p := range pairs {
+		states[p.Rel] = p.State
+	}
+	want := map[string]string{
+		"same.txt": "identical", "res/recall.json": "content-changed", "model.bin": "content-changed",
+		"gone.log": "removed", "new.log": "added",
+	}
+	if len(states) != len(want) {
+		t.Fatalf("states = %v", states)
+	}
+	for rel, st := range want {
+		if states[rel] != st {
+			t.Errorf("%s = %s, want %s", rel, states[rel], st)
+		}
+	}
+
+	var buf bytes.Buffer
+	if !printArtifactPairs(&buf, pairs) {
+		t.Fatal("expected differences")
+	}
+	out := buf.String()
+	for _, w := range []string{"-{\"recall\": 0.91}", "+{\"recall\": 0.93}", "Compared 5 file(s): 1 identical, 1 added, 1 removed, 0 size changed, 2 content changed"} {
+		if !strings.Contains(out, w) {
+			t.Errorf("output missing %q:\n%s", w, out)
+		}
+	}
+}
+
+func TestRecordedLocalArtifactsPerSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"train/metrics.json", "eval/metrics.json", "eval/debug.tmp", "stray.json"} {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot, _ := json.Marshal(RunSnapshot{ArtifactLayout: artifactLayoutPerSource})
+	exp := &Experiment{
+		ID:             3,
+		ArtifactDest:   dir,
+		ConfigSnapshot: string(snapshot),
+		ArtifactSources: []ArtifactSource{
+			{Name: "train", Path: "/remote/train", Patterns: []string{`\.json$`}},
+			{Name: "eval", Path: "/remote/eval", Patterns: []string{`\.json$`}},
+		},
+	}
+	files, err := recordedLocalArtifacts(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedKeys(files); !reflect.DeepEqual(got, []string{"eval/metrics.json", "train/metrics.json"}) {
+		t.Errorf("files = %v", got)
+	}
+}
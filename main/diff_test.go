@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTokens(t *testing.T) {
+	a := []string{"--k", "100", "--beam-width", "8"}
+	b := []string{"--k", "50", "--beam-width", "8", "--cut", "10"}
+	got := diffTokens(a, b)
+	want := []tokenOp{
+		{"=", "--k"}, {"-", "100"}, {"+", "50"}, {"=", "--beam-width"}, {"=", "8"}, {"+", "--cut"}, {"+", "10"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diffTokens = %v, want %v", got, want)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	a := RunSnapshot{Name: "x", Script: "/a.sbatch", Args: []string{"--k", "1"}, ArtifactDest: "/data/exp/1"}
+	b := RunSnapshot{Name: "y", Script: "/b.sbatch", Args: []string{"--k", "1"}, ArtifactPatterns: []string{}, ArtifactDest: "/data/exp/2"}
+	changed, identity := map[string]bool{}, map[string]bool{}
+	for _, d := range diffSnapshots(a, b) {
+		switch {
+		case d.Equal:
+		case d.Identity:
+			identity[d.Field] = true
+		default:
+			changed[d.Field] = true
+		}
+	}
+	if !reflect.DeepEqual(changed, map[string]bool{"script": true}) {
+		t.Fatalf("changed fields = %v, want only script", changed)
+	}
+	if !reflect.DeepEqual(identity, map[string]bool{"name": true, "artifact_dest": true}) {
+		t.Fatalf("identity fields = %v, want name and artifact_dest", identity)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+
+	// clockSkewWarn is where -newermt filtering starts to look unreliable;
+	// beyond sinceStartGracePeriod the since-start filter will skip files.
+	clockSkewWarn = 30 * time.Second
+)
+
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+	Hint   string
+}
+
+// remoteTools are probed on the remote host. Optional tools only degrade
+// features, so their absence is a warning with a tool-specific hint.
+var remoteTools = []struct {
+	name     string
+	required bool
+	hint     string
+}{
+	{"sbatch", true, ""},
+	{"squeue", true, ""},
+	{"sacct", false, "job states fall back to UNKNOWN once a job leaves squeue; ask your admins whether accounting is enabled"},
+	{"scontrol", false, "exp requeue and exp track need scontrol"},
+	{"find", true, ""},
+}
+
+// exp doctor [--remote user@host | --profile NAME]
+func cmdDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	var (
+		remote      string
+		profileName string
+	)
+	fs.StringVar(&remote, "remote", "", "Remote user@host to check (defaults to the profile's or defaults' remote, or EXP_REMOTE)")
+	fs.StringVar(&profileName, "profile", "", "Profile whose remote and log_dir should be checked")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp doctor [--remote user@host | --profile NAME]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var checks []doctorCheck
+	checks = append(checks, checkLocalTools()...)
+
+	cfg, err := loadConfig()
+	logDir := ""
+	var sshOpts sshHostOptions
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{"config", checkFail, err.Error(), "fix the syntax error reported above in " + configPathHint()})
+	case cfg == nil:
+		checks = append(checks, doctorCheck{"config", checkPass, "no config file (optional; expected " + configPathHint() + ")", ""})
+	default:
+		checks = append(checks, doctorCheck{"config", checkPass, "parsed " + cfg.path, ""})
+		prof := cfg.Defaults
+		if profileName != "" {
+			p, ok := cfg.Profiles[profileName]
+			if !ok {
+				checks = append(checks, doctorCheck{"profile", checkFail, fmt.Sprintf("profile %q not found", profileName), "check the profiles section of " + cfg.path})
+			} else {
+				if p.Remote != "" {
+					prof.Remote = p.Remote
+				}
+				if p.LogDir != "" {
+					prof.LogDir = p.LogDir
+				}
+				sshOpts = p.sshHostOptions()
+			}
+		}
+		sshOpts.fill(prof.sshHostOptions())
+		if remote == "" {
+			remote = prof.Remote
+		}
+		logDir = prof.LogDir
+	}
+	if cfg == nil && profileName != "" {
+		checks = append(checks, doctorCheck{"profile", checkFail, fmt.Sprintf("profile %q requested but no config file found", profileName), "create " + configPathHint()})
+	}
+
+	checks = append(checks, checkDatabase())
+
+	if remote == "" {
+		remote = os.Getenv("EXP_REMOTE")
+	}
+	if remote == "" {
+		checks = append(checks, doctorCheck{"remote", checkWarn, "no remote given; skipping remote checks", "pass --remote user@host or --profile NAME"})
+	} else {
+		checks = append(checks, checkRemote(remote, sshOpts, logDir)...)
+	}
+
+	failed := 0
+	for _, c := range checks {
+		fmt.Printf("[%s] %-16s %s\n", c.Status, c.Name, c.Detail)
+		if c.Hint != "" && c.Status != checkPass {
+			fmt.Printf("       %-16s hint: %s\n", "", c.Hint)
+		}
+		if c.Status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d check(s) failed\n", failed)
+		return exitStatus(1)
+	}
+	return nil
+}
+
+func checkLocalTools() []doctorCheck {
+	var checks []doctorCheck
+	for _, tool := range []struct {
+		name, use string
+		required  bool
+	}{
+		{"ssh", "every remote command", true},
+		{"rsync", "artifact fetches", true},
+		{"scp", "--script-local uploads", false},
+	} {
+		path, err := exec.LookPath(tool.name)
+		switch {
+		case err == nil:
+			checks = append(checks, doctorCheck{"local " + tool.name, checkPass, path, ""})
+		case tool.required:
+			checks = append(checks, doctorCheck{"local " + tool.name, checkFail, "not found in PATH (needed for " + tool.use + ")", "install " + tool.name + " with your package manager"})
+		default:
+			checks = append(checks, doctorCheck{"local " + tool.name, checkWarn, "not found in PATH (needed for " + tool.use + ")", "install " + tool.name + " if you use that feature"})
+		}
+	}
+	return checks
+}
+
+func checkDatabase() doctorCheck {
+	path, err := dbPath()
+	if err != nil {
+		return doctorCheck{"database", checkFail, err.Error(), "set HOME (or EXP_HOME) so exp can locate its data directory"}
+	}
+	db, err := openDB()
+	if err != nil {
+		return doctorCheck{"database", checkFail, fmt.Sprintf("%s: %v", path, err), "check permissions on " + path + ", or restore it from a backup (exp db backup)"}
+	}
+	defer db.Close()
+	version, err := schemaVersion(db)
+	if err != nil {
+		return doctorCheck{"database", checkFail, fmt.Sprintf("%s: %v", path, err), "run exp db check"}
+	}
+	cols, err := tableColumns(db, "experiments")
+	if err != nil {
+		return doctorCheck{"database", checkFail, fmt.Sprintf("%s: %v", path, err), "run exp db check"}
+	}
+	return doctorCheck{"database", checkPass, fmt.Sprintf("%s (schema version %d, %d experiment columns)", path, version, len(cols)), ""}
+}
+
+// checkRemote runs every remote probe in a single BatchMode ssh call so a
+// missing agent or key fails fast instead of prompting for a password.
+func checkRemote(remote string, sshOpts sshHostOptions, logDir string) []doctorCheck {
+	var script strings.Builder
+	for _, tool := range remoteTools {
+		fmt.Fprintf(&script, "echo tool:%s=$(command -v %s);", tool.name, tool.name)
+	}
+	if logDir != "" {
+		q := shellQuote(logDir)
+		fmt.Fprintf(&script, "if mkdir -p %s 2>/dev/null && test -w %s; then echo logdir=ok; else echo logdir=unwritable; fi;", q, q)
+	}
+	script.WriteString("echo time=$(date +%s)")
+
+	before := time.Now()
+	var cmd *loggedCmd
+	if _, ok := remoteExecutor.(systemExecutor); ok {
+		cmd = muxCommand("ssh", sshOpts, "-o", "BatchMode=yes", remote, "bash", "-lc", shellQuote(script.String()))
+	} else {
+		// The native backend never prompts and has its own timeout.
+		cmd = sshCommand(remote, sshOpts, "bash", "-lc", shellQuote(script.String()))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return []doctorCheck{{"ssh " + remote, checkFail, fmt.Sprintf("%v: %s", err, strings.TrimSpace(stderr.String())),
+			"make sure ssh-agent is running with your key loaded (ssh-add -l) and that ssh " + remote + " works without a password"}}
+	}
+	localMid := before.Add(time.Since(before) / 2)
+	checks := []doctorCheck{{"ssh " + remote, checkPass, "connected in BatchMode", ""}}
+	return append(checks, interpretRemoteProbe(stdout.String(), logDir, localMid)...)
+}
+
+// interpretRemoteProbe turns the "key=value" lines printed by the remote probe
+// into checks. local is the local time at which the remote clock was read.
+func interpretRemoteProbe(out, logDir string, local time.Time) []doctorCheck {
+	values := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if key, val, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			values[key] = val
+		}
+	}
+	var checks []doctorCheck
+	for _, tool := range remoteTools {
+		path := values["tool:"+tool.name]
+		switch {
+		case path != "":
+			checks = append(checks, doctorCheck{"remote " + tool.name, checkPass, path, ""})
+		case tool.required:
+			checks = append(checks, doctorCheck{"remote " + tool.name, checkFail, "not found on the remote PATH",
+				"load the Slurm module in your remote ~/.bash_profile (exp runs commands via bash -lc)"})
+		default:
+			checks = append(checks, doctorCheck{"remote " + tool.name, checkWarn, "not found on the remote PATH", tool.hint})
+		}
+	}
+	if logDir != "" {
+		if values["logdir"] == "ok" {
+			checks = append(checks, doctorCheck{"remote log dir", checkPass, logDir + " is writable", ""})
+		} else {
+			checks = append(checks, doctorCheck{"remote log dir", checkFail, logDir + " is not writable", "create it or fix its permissions on the remote host"})
+		}
+	}
+	remoteUnix, err := strconv.ParseInt(values["time"], 10, 64)
+	if err != nil {
+		return append(checks, doctorCheck{"clock skew", checkWarn, "could not read the remote clock", ""})
+	}
+	skew := time.Unix(remoteUnix, 0).Sub(local).Round(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	detail := fmt.Sprintf("remote clock differs by %s", skew)
+	switch {
+	case abs > sinceStartGracePeriod:
+		checks = append(checks, doctorCheck{"clock skew", checkFail, detail,
+			fmt.Sprintf("the since-start artifact filter allows only %s of skew; enable NTP on the skewed machine", sinceStartGracePeriod)})
+	case abs > clockSkewWarn:
+		checks = append(checks, doctorCheck{"clock skew", checkWarn, detail, "enable NTP on the skewed machine"})
+	default:
+		checks = append(checks, doctorCheck{"clock skew", checkPass, detail, ""})
+	}
+	return checks
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterpretRemoteProbe(t *testing.T) {
+	local := time.Unix(1700000000, 0)
+	out := "tool:sbatch=/usr/bin/sbatch\ntool:squeue=/usr/bin/squeue\ntool:sacct=\ntool:scontrol=/usr/bin/scontrol\n" +
+		"tool:find=/usr/bin/find\nlogdir=unwritable\ntime=1700000045\n"
+	got := make(map[string]string)
+	for _, c := range interpretRemoteProbe(out, "/logs", local) {
+		got[c.Name] = c.Status
+	}
+	want := map[string]string{
+		"remote sbatch":  checkPass,
+		"remote sacct":   checkWarn,
+		"remote find":    checkPass,
+		"remote log dir": checkFail,
+		"clock skew":     checkWarn,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s = %q, want %q", name, got[name], status)
+		}
+	}
+
+	for _, c := range interpretRemoteProbe("time=1700000500\n", "", local) {
+		if c.Name == "clock skew" && c.Status != checkFail {
+			t.Errorf("500s skew reported as %s", c.Status)
+		}
+		if c.Name == "remote sbatch" && c.Status != checkFail {
+			t.Errorf("missing sbatch reported as %s", c.Status)
+		}
+	}
+}
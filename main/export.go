@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exportSchemaVersion is written into every exported record. Bump it whenever
+// the exported layout changes in a way older importers cannot read.
+// Version 2 added archive_path and the columns that followed it.
+const exportSchemaVersion = 2
+
+// exportField is one key/value pair of an exported record. Records are kept as
+// ordered slices (rather than maps) so schema_version always comes first and
+// the column order mirrors the table.
+type exportField struct {
+	Key   string
+	Value interface{}
+}
+
+type exportRecord []exportField
+
+func (r exportRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Key, err)
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// exp export [--ids 1,5-9] [--status COMPLETED,...] [-o file]
+func cmdExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		idsFlag    string
+		statusFlag multiStringFlag
+		outPath    string
+	)
+	fs.StringVar(&idsFlag, "ids", "", "Comma-separated experiment IDs or ranges to export (e.g. 1,5-9)")
+	fs.Var(&statusFlag, "status", "Only export experiments with this job status; may be repeated or comma-separated")
+	fs.StringVar(&outPath, "o", "", "Write JSONL to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp export [--ids 1,5-9] [--status COMPLETED] [-o file.jsonl]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	ranges, err := parseIDRanges(idsFlag)
+	if err != nil {
+		return err
+	}
+	statuses := splitCommaValues(statusFlag.Values())
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		absOut, err := expandLocalPath(outPath)
+		if err != nil {
+			return fmt.Errorf("output path: %w", err)
+		}
+		f, err := os.Create(absOut)
+		if err != nil {
+			return fmt.Errorf("create %s: %w", absOut, err)
+		}
+		defer f.Close()
+		out = f
+		outPath = absOut
+	}
+	w := bufio.NewWriter(out)
+
+	count, err := exportExperiments(db, w, ranges, statuses)
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+	if outPath != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d experiment(s) to %s\n", count, outPath)
+	} else {
+		fmt.Fprintf(os.Stderr, "Exported %d experiment(s)\n", count)
+	}
+	return nil
+}
+
+// exportExperiments streams matching rows from the experiments table to w, one
+// JSON object per line. Every column is emitted under its column name so newly
+// added columns are exported without touching this code.
+func exportExperiments(db *sql.DB, w io.Writer, ranges []idRange, statuses []string) (int, error) {
+	where, whereArgs := idRangeWhere(ranges)
+	if len(statuses) > 0 {
+		clause, args := experimentFilter{Statuses: statuses}.where()
+		where = append(where, clause)
+		whereArgs = append(whereArgs, args...)
+	}
+	query := `SELECT * FROM experiments`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, whereArgs...)
+	if err != nil {
+		return 0, fmt.Errorf("query experiments: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	count := 0
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return count, err
+		}
+		rec := exportRecord{{Key: "schema_version", Value: exportSchemaVersion}}
+		for i, col := range cols {
+			rec = append(rec, exportField{Key: col, Value: exportValue(col, vals[i])})
+		}
+		if err := enc.Encode(rec); err != nil {
+			return count, fmt.Errorf("encode experiment: %w", err)
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// exportValue converts a raw column value into its JSON form. The config
+// snapshot and the argument list are embedded as JSON rather than
+// double-encoded strings.
+func exportValue(col string, v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if col == "config_snapshot" || col == "args_json" {
+		if s, ok := v.(string); ok && s != "" && json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+	}
+	return v
+}
+
+type idRange struct {
+	lo, hi int64
+}
+
+// parseIDRanges parses "1,5-9" into inclusive ranges. An empty string means
+// no ID filter.
+func parseIDRanges(s string) ([]idRange, error) {
+	var out []idRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		loStr, hiStr, isRange := strings.Cut(part, "-")
+		lo, err := strconv.ParseInt(strings.TrimSpace(loStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", part)
+		}
+		hi := lo
+		if isRange {
+			hi, err = strconv.ParseInt(strings.TrimSpace(hiStr), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid id range %q", part)
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("invalid id range %q: end before start", part)
+			}
+		}
+		out = append(out, idRange{lo: lo, hi: hi})
+	}
+	return out, nil
+}
+
+// idRangeWhere renders ranges as a single parenthesised WHERE clause.
+func idRangeWhere(ranges []idRange) ([]string, []interface{}) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	var parts []string
+	var args []interface{}
+	for _, r := range ranges {
+		if r.lo == r.hi {
+			parts = append(parts, "id = ?")
+			args = append(args, r.lo)
+			continue
+		}
+		parts = append(parts, "id BETWEEN ? AND ?")
+		args = append(args, r.lo, r.hi)
+	}
+	return []string{"(" + strings.Join(parts, " OR ") + ")"}, args
+}
+
+// splitCommaValues flattens repeated and comma-separated flag values.
+func splitCommaValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// portableArtifactDest replaces a local artifact destination outside $HOME
+// when exporting with --portable.
+const portableArtifactDest = "~/experiments/CHANGE_ME"
+
+// exp export-config <id> [-o run.yaml] [--portable]
+func cmdExportConfig(args []string) error {
+	fs := flag.NewFlagSet("export-config", flag.ExitOnError)
+	var (
+		outPath  string
+		portable bool
+	)
+	fs.StringVar(&outPath, "o", "", "Write the config to this file (.yaml/.yml, .json or .toml) instead of stdout (YAML)")
+	fs.BoolVar(&portable, "portable", false, "Replace machine-specific local paths with ~-relative paths or placeholders")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp export-config <id> [-o run.yaml] [--portable]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, positional[0])
+	if err != nil {
+		return err
+	}
+	runCfg := runConfigFromSnapshot(exp, exp.runSnapshot())
+	if portable {
+		home, _ := os.UserHomeDir()
+		for _, warning := range makePortable(runCfg, home) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+	}
+
+	var data []byte
+	switch strings.ToLower(filepath.Ext(outPath)) {
+	case ".json":
+		if data, err = json.MarshalIndent(runCfg, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	case ".toml":
+		data = []byte(renderTOML(runCfg))
+	default:
+		data = []byte(renderRunConfigYAML(runCfg))
+	}
+	if outPath == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	absOut, err := expandLocalPath(outPath)
+	if err != nil {
+		return fmt.Errorf("output path: %w", err)
+	}
+	if err := os.WriteFile(absOut, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote run config for experiment %d to %s\n", exp.ID, absOut)
+	return nil
+}
+
+// runConfigFromSnapshot turns a recorded snapshot back into the run config
+// that would reproduce it. The per-ID directory exp run appends to the
+// artifact destination is stripped so a new run gets its own.
+func runConfigFromSnapshot(exp *Experiment, snap RunSnapshot) *RunConfigFile {
+	sinceStart := snap.ArtifactSinceStart
+	cfg := &RunConfigFile{
+		Profile:              snap.Profile,
+		Name:                 snap.Name,
+		Remote:               snap.Remote,
+		Cluster:              snap.Cluster,
+		ProgressRegex:        snap.ProgressRegex,
+		MaxMonitor:           snap.MaxMonitor,
+		LogDir:               snap.LogDir,
+		Script:               snap.Script,
+		BuildScript:          snap.BuildScript,
+		BuildScriptInline:    snap.BuildScriptInline,
+		ArtifactRemote:       snap.ArtifactRemote,
+		ArtifactDest:         snap.ArtifactDest,
+		ArtifactSources:      copyArtifactSources(snap.ArtifactSources),
+		ArtifactPatterns:     append([]string(nil), snap.ArtifactPatterns...),
+		ArtifactSinceStart:   &sinceStart,
+		MinSize:              looseString(snap.MinSize),
+		MaxSize:              looseString(snap.MaxSize),
+		BWLimit:              looseString(snap.BWLimit),
+		ConfirmOver:          looseString(snap.ConfirmOver),
+		SyncInterval:         snap.SyncInterval,
+		TransferRemote:       snap.TransferRemote,
+		SettleDelay:          snap.SettleDelay,
+		SettleMaxWait:        snap.SettleMaxWait,
+		AssumeCompletedAfter: snap.AssumeCompletedAfter,
+		PendingCheckInterval: snap.PendingCheckInterval,
+		StallAfter:           snap.StallAfter,
+		SSHIdentity:          snap.SSHIdentity,
+		SSHPort:              looseInt(snap.SSHPort),
+		SSHProxyJump:         snap.SSHProxyJump,
+		SSHOptions:           append([]string(nil), snap.SSHOptions...),
+		Compress:             snap.Compress,
+		CompressLevel:        looseInt(snap.CompressLevel),
+		Parallel:             looseInt(snap.Parallel),
+		RsyncBackoff:         snap.RsyncBackoff,
+		ListRetryDelay:       snap.ListRetryDelay,
+		PollInterval:         snap.PollInterval,
+		Metrics:              append([]MetricSpec(nil), snap.Metrics...),
+		Args:                 append([]string(nil), snap.Args...),
+	}
+	if len(cfg.ArtifactPatterns) == 0 && len(cfg.ArtifactSources) == 0 {
+		cfg.ArtifactPattern = snap.ArtifactPattern
+	}
+	// Regex is the default, so only a glob syntax needs spelling out, and a
+	// source only needs its own when it differs from the top level.
+	if snap.PatternSyntax == patternSyntaxGlob {
+		cfg.PatternSyntax = patternSyntaxGlob
+	}
+	for i := range cfg.ArtifactSources {
+		if syntax := cfg.ArtifactSources[i].PatternSyntax; syntax == snap.PatternSyntax || (syntax == patternSyntaxRegex && snap.PatternSyntax == "") {
+			cfg.ArtifactSources[i].PatternSyntax = ""
+		}
+	}
+	// Single-source experiments recorded before per-source subdirectories
+	// existed synced into the destination root; keep that when reproducing
+	// them.
+	if snap.ArtifactLayout == "" && len(snap.ArtifactSources) <= 1 && (len(snap.ArtifactSources) == 1 || snap.ArtifactRemote != "") {
+		flat := true
+		cfg.FlatArtifacts = &flat
+	}
+	if snap.RsyncRetries != nil {
+		n := looseInt(*snap.RsyncRetries)
+		cfg.RsyncRetries = &n
+	}
+	if snap.ListRetries != nil {
+		n := looseInt(*snap.ListRetries)
+		cfg.ListRetries = &n
+	}
+	if snap.FallbackNoTimeFilter {
+		on := true
+		cfg.FallbackNoTimeFilter = &on
+	}
+	if snap.Checksum {
+		on := true
+		cfg.Checksum = &on
+	}
+	if snap.DeferLargeSync {
+		on := true
+		cfg.DeferLargeSync = &on
+	}
+	if snap.CaptureSeff {
+		on := true
+		cfg.CaptureSeff = &on
+	}
+	if snap.NotifyLocal {
+		on := true
+		cfg.NotifyLocal = &on
+	}
+	if cfg.LogDir == "" && exp.LogPath != "" {
+		cfg.LogDir = filepath.Dir(exp.LogPath)
+	}
+	if cfg.ArtifactDest != "" && filepath.Base(cfg.ArtifactDest) == strconv.FormatInt(exp.ID, 10) {
+		cfg.ArtifactDest = filepath.Dir(cfg.ArtifactDest)
+	}
+	return cfg
+}
+
+// makePortable rewrites local absolute paths: those under home become
+// ~-relative, anything else is replaced with a placeholder. It returns a
+// warning for every placeholder so the user knows what to fill in.
+func makePortable(cfg *RunConfigFile, home string) []string {
+	var warnings []string
+	rewrite := func(field, p, placeholder string) string {
+		if p == "" || !filepath.IsAbs(p) {
+			return p
+		}
+		if home != "" {
+			if rel, err := filepath.Rel(home, p); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+				return filepath.ToSlash(filepath.Join("~", rel))
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %s replaced with placeholder %s", field, p, placeholder))
+		return placeholder
+	}
+	cfg.ArtifactDest = rewrite("artifact_dest", cfg.ArtifactDest, portableArtifactDest)
+	cfg.BuildScript = rewrite("build_script", cfg.BuildScript, "CHANGE_ME/build.sh")
+	cfg.SSHIdentity = rewrite("ssh_identity", cfg.SSHIdentity, "~/.ssh/CHANGE_ME")
+	return warnings
+}
+
+// renderRunConfigYAML emits cfg in the YAML subset understood by
+// parseYAMLDocument. Every string is double-quoted so values containing
+// ':' or '#' (common in regex patterns) survive the round trip.
+func renderRunConfigYAML(cfg *RunConfigFile) string {
+	var b strings.Builder
+	str := func(key, val string) {
+		if val != "" {
+			fmt.Fprintf(&b, "%s: %s\n", key, strconv.Quote(val))
+		}
+	}
+	// block writes multi-line text as a literal block scalar, keeping its
+	// final line breaks with the chomping indicator; text a block cannot
+	// hold as it is gets quoted like any string.
+	block := func(key, val string) {
+		body := strings.TrimRight(val, "\n")
+		if !strings.Contains(body, "\n") || strings.HasPrefix(strings.TrimLeft(body, "\n"), " ") || strings.ContainsAny(body, "\r\t") {
+			str(key, val)
+			return
+		}
+		chomp := "-"
+		switch len(val) - len(body) {
+		case 1:
+			chomp = ""
+		case 0:
+		default:
+			chomp = "+"
+		}
+		fmt.Fprintf(&b, "%s: |%s\n", key, chomp)
+		for _, line := range strings.Split(body, "\n") {
+			if line == "" {
+				b.WriteString("\n")
+			} else {
+				fmt.Fprintf(&b, "  %s\n", line)
+			}
+		}
+		if chomp == "+" {
+			b.WriteString(strings.Repeat("\n", len(val)-len(body)-1))
+		}
+	}
+	list := func(indent, key string, vals []string) {
+		if len(vals) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s%s:\n", indent, key)
+		for _, v := range vals {
+			fmt.Fprintf(&b, "%s  - %s\n", indent, strconv.Quote(v))
+		}
+	}
+	str("profile", cfg.Profile)
+	str("name", cfg.Name)
+	str("remote", cfg.Remote)
+	str("cluster", cfg.Cluster)
+	str("log_dir", cfg.LogDir)
+	str("script", cfg.Script)
+	str("build_script", cfg.BuildScript)
+	block("build_script_inline", cfg.BuildScriptInline)
+	str("script_local", cfg.ScriptLocal)
+	str("artifact_remote", cfg.ArtifactRemote)
+	str("transfer_remote", cfg.TransferRemote)
+	str("artifact_dest", cfg.ArtifactDest)
+	if len(cfg.ArtifactSources) > 0 {
+		b.WriteString("artifact_sources:\n")
+		for _, src := range cfg.ArtifactSources {
+			fmt.Fprintf(&b, "  - path: %s\n", strconv.Quote(src.Path))
+			if src.Name != "" {
+				fmt.Fprintf(&b, "    name: %s\n", strconv.Quote(src.Name))
+			}
+			if src.PatternSyntax != "" {
+				fmt.Fprintf(&b, "    pattern_syntax: %s\n", strconv.Quote(src.PatternSyntax))
+			}
+			if src.Flatten {
+				b.WriteString("    flatten: true\n")
+			}
+			if src.Symlinks != "" {
+				fmt.Fprintf(&b, "    symlinks: %s\n", strconv.Quote(src.Symlinks))
+			}
+			if src.Remote != "" {
+				fmt.Fprintf(&b, "    remote: %s\n", strconv.Quote(src.Remote))
+			}
+			list("    ", "prune_dirs", src.PruneDirs)
+			list("    ", "artifact_patterns", src.Patterns)
+		}
+	}
+	list("", "artifact_patterns", cfg.ArtifactPatterns)
+	str("artifact_pattern", cfg.ArtifactPattern)
+	str("pattern_syntax", cfg.PatternSyntax)
+	str("min_size", string(cfg.MinSize))
+	str("max_size", string(cfg.MaxSize))
+	str("bwlimit", string(cfg.BWLimit))
+	if cfg.Compress != nil {
+		fmt.Fprintf(&b, "compress: %t\n", *cfg.Compress)
+	}
+	if cfg.CompressLevel > 0 {
+		fmt.Fprintf(&b, "compress_level: %d\n", cfg.CompressLevel)
+	}
+	if cfg.Parallel > 0 {
+		fmt.Fprintf(&b, "parallel: %d\n", cfg.Parallel)
+	}
+	if cfg.RsyncRetries != nil {
+		fmt.Fprintf(&b, "rsync_retries: %d\n", *cfg.RsyncRetries)
+	}
+	str("rsync_backoff", cfg.RsyncBackoff)
+	if cfg.ListRetries != nil {
+		fmt.Fprintf(&b, "list_retries: %d\n", *cfg.ListRetries)
+	}
+	str("list_retry_delay", cfg.ListRetryDelay)
+	if cfg.FallbackNoTimeFilter != nil {
+		fmt.Fprintf(&b, "fallback_no_time_filter: %t\n", *cfg.FallbackNoTimeFilter)
+	}
+	if cfg.Checksum != nil {
+		fmt.Fprintf(&b, "checksum: %t\n", *cfg.Checksum)
+	}
+	str("confirm_over", string(cfg.ConfirmOver))
+	if cfg.DeferLargeSync != nil {
+		fmt.Fprintf(&b, "defer_large_sync: %t\n", *cfg.DeferLargeSync)
+	}
+	if cfg.CaptureSeff != nil {
+		fmt.Fprintf(&b, "capture_seff: %t\n", *cfg.CaptureSeff)
+	}
+	if cfg.NotifyLocal != nil {
+		fmt.Fprintf(&b, "notify_local: %t\n", *cfg.NotifyLocal)
+	}
+	if cfg.FlatArtifacts != nil {
+		fmt.Fprintf(&b, "flat_artifacts: %t\n", *cfg.FlatArtifacts)
+	}
+	if cfg.ArtifactSinceStart != nil {
+		fmt.Fprintf(&b, "artifact_since_start: %t\n", *cfg.ArtifactSinceStart)
+	}
+	str("poll_interval", cfg.PollInterval)
+	str("sync_interval", cfg.SyncInterval)
+	str("settle_delay", cfg.SettleDelay)
+	str("settle_max_wait", cfg.SettleMaxWait)
+	str("assume_completed_after", cfg.AssumeCompletedAfter)
+	str("pending_check_interval", cfg.PendingCheckInterval)
+	str("stall_after", cfg.StallAfter)
+	str("progress_regex", cfg.ProgressRegex)
+	str("max_monitor", cfg.MaxMonitor)
+	str("ssh_identity", cfg.SSHIdentity)
+	if cfg.SSHPort > 0 {
+		fmt.Fprintf(&b, "ssh_port: %d\n", cfg.SSHPort)
+	}
+	str("ssh_proxy_jump", cfg.SSHProxyJump)
+	list("", "ssh_options", cfg.SSHOptions)
+	if len(cfg.Metrics) > 0 {
+		b.WriteString("metrics:\n")
+		for _, m := range cfg.Metrics {
+			fmt.Fprintf(&b, "  - pattern: %s\n", strconv.Quote(m.Pattern))
+			list("    ", "keys", m.Keys)
+		}
+	}
+	list("", "args", cfg.Args)
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportConfigRoundTrip(t *testing.T) {
+	snap := RunSnapshot{
+		Name:   "bigann-k100",
+		Remote: "u@explorer-01",
+		LogDir: "/projects/logs",
+		Script: "/projects/scripts/query.sbatch",
+		// A literal block: '#' is not a comment, and the blank and
+		// indented lines stay.
+		BuildScriptInline: "module load cuda # 12.4\n\ncd build &&\n  make -j8\n",
+		ArtifactRemote:    "/projects/results",
+		ArtifactDest:      "/home/u/experiments/bigann/7",
+		ArtifactPatterns:  []string{`results/.*\.json$`},
+		ArtifactSources: []ArtifactSource{
+			{Path: "/projects/results", Patterns: []string{`recall#[0-9]+: .*\.json$`}},
+			{Path: "/scratch/u/run", Patterns: []string{".*"}, Remote: "u@storage-01", Symlinks: symlinksFollow, Flatten: true, PruneDirs: []string{"checkpoints"}},
+		},
+		Checksum:             true,
+		ConfirmOver:          "5G",
+		DeferLargeSync:       true,
+		CaptureSeff:          true,
+		NotifyLocal:          true,
+		SyncInterval:         "1h0m0s",
+		TransferRemote:       "u@dtn.example.edu",
+		SettleDelay:          "30s",
+		SettleMaxWait:        "5m0s",
+		AssumeCompletedAfter: "30m0s",
+		PendingCheckInterval: "10m0s",
+		StallAfter:           "2h0m0s",
+		Cluster:              "gpu",
+		ProgressRegex:        `epoch (\d+)/(\d+)`,
+		MaxMonitor:           "12h0m0s",
+		SSHIdentity:          "/home/u/.ssh/cluster_ed25519",
+		SSHPort:              2222,
+		SSHProxyJump:         "u@bastion.example.edu",
+		SSHOptions:           []string{"ServerAliveInterval=30", "ProxyCommand=none"},
+		ArtifactSinceStart:   true,
+		PollInterval:         "45s",
+		Metrics:              []MetricSpec{{Pattern: `^results/.*\.json$`, Keys: []string{"recall@10", "qps"}}},
+		Args:                 []string{"--k", "100", "--label", "a b"},
+	}
+	exp := &Experiment{ID: 7}
+	cfg := runConfigFromSnapshot(exp, snap)
+	if cfg.ArtifactDest != "/home/u/experiments/bigann" {
+		t.Fatalf("per-ID directory not stripped: %s", cfg.ArtifactDest)
+	}
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "run.yaml")
+	if err := os.WriteFile(yamlPath, []byte(renderRunConfigYAML(cfg)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadRunConfigFile(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("YAML round trip mismatch\n got: %+v\nwant: %+v\nyaml:\n%s", got, cfg, renderRunConfigYAML(cfg))
+	}
+
+	tomlPath := filepath.Join(dir, "run.toml")
+	if err := os.WriteFile(tomlPath, []byte(renderTOML(cfg)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = loadRunConfigFile(tomlPath); err != nil || !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("TOML round trip mismatch: %v\n got: %+v\nwant: %+v\ntoml:\n%s", err, got, cfg, renderTOML(cfg))
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonPath := filepath.Join(dir, "run.json")
+	if err := os.WriteFile(jsonPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = loadRunConfigFile(jsonPath); err != nil || !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("JSON round trip mismatch: %+v, %v", got, err)
+	}
+}
+
+func TestMakePortable(t *testing.T) {
+	cfg := &RunConfigFile{ArtifactDest: "/home/u/experiments/bigann", BuildScript: "/opt/build.sh"}
+	warnings := makePortable(cfg, "/home/u")
+	if cfg.ArtifactDest != "~/experiments/bigann" || cfg.BuildScript != "CHANGE_ME/build.sh" || len(warnings) != 1 {
+		t.Fatalf("cfg = %+v, warnings = %v", cfg, warnings)
+	}
+}
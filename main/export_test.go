@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// openTestDB points HOME at a temp dir so openDB creates a throwaway database.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	db, err := openDB()
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func insertTestExperiment(t *testing.T, db *sql.DB, name, status, snapshot string) int64 {
+	t.Helper()
+	res, err := db.Exec(`INSERT INTO experiments (name, remote, script_path, args, git_commit, git_branch, job_id, job_status, log_path,
+                                  created_at, completed_at, artifact_remote, artifact_dest, artifact_pattern,
+                                  artifact_since_start, artifact_last_sync, artifact_last_error, config_snapshot)
+         VALUES (?, 'u@h', '/s.sbatch', '--k 1', '', '', '42', ?, '/logs/x.out', '2025-01-02T03:04:05Z', '', '', '', '', 1, '', '', ?)`,
+		name, status, snapshot)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+func TestParseIDRanges(t *testing.T) {
+	got, err := parseIDRanges("1, 5-9,12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []idRange{{1, 1}, {5, 9}, {12, 12}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	for _, bad := range []string{"x", "9-5", "1-"} {
+		if _, err := parseIDRanges(bad); err == nil {
+			t.Errorf("parseIDRanges(%q): expected error", bad)
+		}
+	}
+}
+
+func TestExportExperiments(t *testing.T) {
+	db := openTestDB(t)
+	insertTestExperiment(t, db, "a", "COMPLETED", `{"name":"a","args":["--k","1"]}`)
+	insertTestExperiment(t, db, "b", "FAILED", "")
+	insertTestExperiment(t, db, "c", "COMPLETED", "")
+
+	var buf bytes.Buffer
+	n, err := exportExperiments(db, &buf, []idRange{{1, 2}}, []string{"completed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("exported %d rows, want 1", n)
+	}
+	line := strings.TrimSpace(buf.String())
+	if !strings.HasPrefix(line, `{"schema_version":2,"id":1,`) {
+		t.Fatalf("unexpected record prefix: %s", line)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		t.Fatal(err)
+	}
+	snap, ok := rec["config_snapshot"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("config_snapshot not nested: %#v", rec["config_snapshot"])
+	}
+	if snap["name"] != "a" {
+		t.Fatalf("snapshot name = %v", snap["name"])
+	}
+	if rec["created_at"] != "2025-01-02T03:04:05Z" {
+		t.Fatalf("created_at = %v", rec["created_at"])
+	}
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	insertTestExperiment(t, db, "a", "COMPLETED", `{"name":"a"}`)
+	insertTestExperiment(t, db, "b", "FAILED", "")
+
+	var buf bytes.Buffer
+	if _, err := exportExperiments(db, &buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	exported := buf.String()
+
+	// Same identity already present: everything is skipped.
+	sum, err := importExperiments(db, strings.NewReader(exported), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Inserted != 0 || sum.Skipped != 2 {
+		t.Fatalf("summary = %+v, want 2 skipped", sum)
+	}
+
+	sum, err = importExperiments(db, strings.NewReader(exported), true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Inserted != 2 {
+		t.Fatalf("summary = %+v, want 2 inserted", sum)
+	}
+	var snapshot string
+	if err := db.QueryRow(`SELECT config_snapshot FROM experiments WHERE id = 3`).Scan(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot != `{"name":"a"}` {
+		t.Fatalf("snapshot = %q", snapshot)
+	}
+}
+
+func TestImportRejectsSchemaMismatch(t *testing.T) {
+	db := openTestDB(t)
+	for _, input := range []string{
+		`{"schema_version":99,"id":1,"name":"x"}`,
+		`{"schema_version":2,"id":1,"name":"x","mystery_column":"y"}`,
+		`{"schema_version":0,"id":1,"name":"x"}`,
+		`{"id":1,"name":"x"}`,
+	} {
+		if _, err := importExperiments(db, strings.NewReader(input), true, false); err == nil {
+			t.Errorf("import %s: expected error", input)
+		}
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM experiments`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("rows inserted despite errors: %d", n)
+	}
+}
+
+func TestImportDuplicates(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "FAILED", "")
+	if _, err := db.Exec(`UPDATE experiments SET job_id = NULL WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := exportExperiments(db, &buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	line := buf.String()
+
+	// A record without a job ID still matches its own row.
+	sum, err := importExperiments(db, strings.NewReader(line), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Inserted != 0 || sum.Skipped != 1 {
+		t.Fatalf("summary = %+v, want 1 skipped", sum)
+	}
+
+	// The same record twice in one file: a dry run reports what a real
+	// import would do.
+	twice := strings.Replace(line+line, `"name":"a"`, `"name":"b"`, -1)
+	twice = strings.Replace(twice, `"created_at":"2025-01-02T03:04:05Z"`, `"created_at":"2025-02-02T03:04:05Z"`, -1)
+	for _, dryRun := range []bool{true, false} {
+		sum, err := importExperiments(db, strings.NewReader(twice), false, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum.Inserted != 1 || sum.Skipped != 1 {
+			t.Errorf("dry run %v: summary = %+v, want 1 inserted and 1 skipped", dryRun, sum)
+		}
+	}
+}
+
+func TestImportSchemaVersion1(t *testing.T) {
+	db := openTestDB(t)
+	in := `{"schema_version":1,"id":7,"name":"old","remote":"u@h","job_id":"9","created_at":"2024-01-02T03:04:05Z"}`
+	sum, err := importExperiments(db, strings.NewReader(in), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Inserted != 1 {
+		t.Fatalf("summary = %+v, want 1 inserted", sum)
+	}
+}
+
+func TestImportRemapsArtifactDest(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "COMPLETED", `{"name":"a","artifact_dest":"/data/exp/1"}`)
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = '/data/exp/1' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	other := insertTestExperiment(t, db, "b", "COMPLETED", "")
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = '/data/results' WHERE id = ?`, other); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := exportExperiments(db, &buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importExperiments(db, &buf, true, false); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[int64]string{1: "/data/exp/1", 3: "/data/exp/3", 4: "/data/results"} {
+		var dest, snapshot string
+		if err := db.QueryRow(`SELECT artifact_dest, config_snapshot FROM experiments WHERE id = ?`, id).Scan(&dest, &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if dest != want {
+			t.Errorf("experiment %d: artifact_dest = %q, want %q", id, dest, want)
+		}
+		if id == 3 && !strings.Contains(snapshot, `"artifact_dest":"/data/exp/3"`) {
+			t.Errorf("experiment 3: snapshot = %s", snapshot)
+		}
+	}
+}
+
+func TestImportFailedRecordWritesNothing(t *testing.T) {
+	db := openTestDB(t)
+	in := `{"schema_version":2,"id":7,"name":"bad","remote":"u@h","job_id":"9","artifact_remote":"u@h:/out","artifact_pattern":"*.json"}
+{"schema_version":2,"id":8,"name":"good","remote":"u@h","job_id":"10"}`
+	if _, err := db.Exec(`CREATE TRIGGER no_sources BEFORE INSERT ON artifact_sources BEGIN SELECT RAISE(ABORT, 'no sources'); END`); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := importExperiments(db, strings.NewReader(in), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Inserted != 1 || sum.Failed != 1 {
+		t.Fatalf("summary = %+v, want 1 inserted and 1 failed", sum)
+	}
+	var names []string
+	rows, err := db.Query(`SELECT name FROM experiments`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	if len(names) != 1 || names[0] != "good" {
+		t.Errorf("experiments = %q, want only good", names)
+	}
+}
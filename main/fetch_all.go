@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fetchSelection picks the experiments exp fetch --all syncs.
+type fetchSelection struct {
+	Statuses       []string  // job statuses to include; empty means COMPLETED
+	CompletedAfter time.Time // zero means any completion time
+	MissingOnly    bool      // skip experiments synced since they completed
+}
+
+func (sel fetchSelection) matches(exp *Experiment) bool {
+	if exp.Remote == "" || exp.ArtifactDest == "" || len(exp.EffectiveArtifactSources()) == 0 {
+		return false
+	}
+	status := strings.ToUpper(strings.TrimSpace(exp.JobStatus))
+	statuses := sel.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{"COMPLETED"}
+	}
+	matched := false
+	for _, s := range statuses {
+		if strings.EqualFold(s, status) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	completed := exp.CompletedAt
+	if completed.IsZero() {
+		// Rows from before completed_at was tracked only have a creation time.
+		completed = exp.CreatedAt
+	}
+	if !sel.CompletedAfter.IsZero() && (completed.IsZero() || completed.Before(sel.CompletedAfter)) {
+		return false
+	}
+	if sel.MissingOnly && !exp.ArtifactLastSync.IsZero() && !exp.ArtifactLastSync.Before(exp.CompletedAt) {
+		return false
+	}
+	return true
+}
+
+// selectFetchExperiments returns the matching experiments grouped by remote
+// (remotes in name order, experiments by id within each).
+func selectFetchExperiments(exps []*Experiment, sel fetchSelection) []*Experiment {
+	var out []*Experiment
+	for _, exp := range exps {
+		if sel.matches(exp) {
+			out = append(out, exp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Remote != out[j].Remote {
+			return out[i].Remote < out[j].Remote
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// fetchAll syncs every selected experiment one after another. A failure is
+// recorded on that experiment and reported at the end; it never stops the
+// batch.
+func fetchAll(sel fetchSelection, f fetchFlags) error {
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		return fmt.Errorf("query experiments: %w", err)
+	}
+	selected := selectFetchExperiments(exps, sel)
+	if len(selected) == 0 {
+		fmt.Println("No experiments to fetch.")
+		return nil
+	}
+
+	var failed []string
+	remote := ""
+	for _, exp := range selected {
+		if exp.Remote != remote {
+			remote = exp.Remote
+			fmt.Printf("== %s ==\n", remote)
+		}
+		fmt.Printf("--- experiment %d (%s) ---\n", exp.ID, exp.Name)
+		stats, err := fetchExperiment(db, exp, f)
+		switch {
+		case err != nil:
+			fmt.Printf("experiment %d (%s): FAILED: %v\n", exp.ID, exp.Name, err)
+			failed = append(failed, fmt.Sprintf("  %d (%s): %v", exp.ID, exp.Name, err))
+		case f.dryRun:
+			fmt.Printf("experiment %d (%s): dry run\n", exp.ID, exp.Name)
+		default:
+			fmt.Printf("experiment %d (%s): ok, %s%s\n", exp.ID, exp.Name, stats, stats.updatedNote())
+			if w := stats.skippedWarning(); w != "" {
+				fmt.Printf("experiment %d (%s): %s\n", exp.ID, exp.Name, w)
+			}
+		}
+	}
+
+	fmt.Printf("\nFetched %d of %d experiment(s)", len(selected)-len(failed), len(selected))
+	if len(failed) == 0 {
+		fmt.Println(".")
+		return nil
+	}
+	fmt.Printf("; %d failed:\n%s\n", len(failed), strings.Join(failed, "\n"))
+	return exitStatus(1)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectFetchExperiments(t *testing.T) {
+	now := time.Now().UTC()
+	outSources := []ArtifactSource{{Path: "/r/out"}}
+	exp := func(id int64, remote, status string, completed, synced time.Time) *Experiment {
+		return &Experiment{ID: id, Name: "e", Remote: remote, JobStatus: status, ArtifactDest: "/data",
+			ArtifactSources: outSources, CompletedAt: completed, CreatedAt: completed, ArtifactLastSync: synced}
+	}
+	exps := []*Experiment{
+		exp(1, "b@host", "COMPLETED", now.Add(-time.Hour), time.Time{}),
+		exp(2, "a@host", "COMPLETED", now.Add(-2*time.Hour), now.Add(-time.Hour)),                        // synced after completing
+		exp(3, "a@host", "COMPLETED", now.Add(-time.Hour), now.Add(-3*time.Hour)),                        // synced before a requeue finished
+		exp(4, "a@host", "FAILED", now.Add(-time.Hour), time.Time{}),                                     // wrong status
+		exp(5, "a@host", "COMPLETED", now.Add(-10*24*time.Hour), time.Time{}),                            // too old for --since
+		{ID: 6, Remote: "a@host", JobStatus: "COMPLETED", CompletedAt: now, ArtifactSources: outSources}, // no destination
+	}
+	ids := func(sel fetchSelection) []int64 {
+		var out []int64
+		for _, e := range selectFetchExperiments(exps, sel) {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+	week := now.Add(-7 * 24 * time.Hour)
+	if got := ids(fetchSelection{CompletedAfter: week, MissingOnly: true}); !equalIDs(got, []int64{3, 1}) {
+		t.Errorf("missing-only = %v", got)
+	}
+	if got := ids(fetchSelection{}); !equalIDs(got, []int64{2, 3, 5, 1}) {
+		t.Errorf("default = %v", got)
+	}
+	if got := ids(fetchSelection{Statuses: []string{"failed"}}); !equalIDs(got, []int64{4}) {
+		t.Errorf("--status failed = %v", got)
+	}
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
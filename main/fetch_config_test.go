@@ -90,15 +90,20 @@ func TestFetchFromConfig(t *testing.T) {
 		CreatedAt:          time.Now().UTC(),
 	}
 
-	if err := fetchArtifacts(exp, remotePath, destDir, patterns, sinceStart, *fetchDryRun); err != nil {
+	src := ArtifactSource{Path: remotePath, Patterns: patterns, PatternSyntax: cfg.PatternSyntax}
+	if err := fetchArtifacts(exp, src, destDir, fetchOptions{SinceStart: sinceStart, DryRun: *fetchDryRun}); err != nil {
 		t.Fatalf("fetchArtifacts: %v", err)
 	}
-	files, _, err := listRemoteFiles(remoteHost, remotePath, time.Time{})
+	files, _, err := listRemoteFiles(os.Stdout, remoteHost, sshHostOptions{}, remotePath, "", time.Time{}, listFilter{})
 	if err == nil {
 		if len(files) == 0 {
 			t.Logf("No files reported under %s during logging pass", remotePath)
 		} else {
-			t.Logf("Files visible under %s:\n%s", remotePath, strings.Join(files, "\n"))
+			names := make([]string, len(files))
+			for i, f := range files {
+				names[i] = f.Rel
+			}
+			t.Logf("Files visible under %s:\n%s", remotePath, strings.Join(names, "\n"))
 		}
 	} else {
 		t.Logf("Unable to list files for logging: %v", err)
@@ -129,7 +134,11 @@ func TestRemoteGitInfo(t *testing.T) {
 	if !strings.HasPrefix(*gitRemoteDir, "/") {
 		t.Fatalf("git remote dir must be absolute, got %s", *gitRemoteDir)
 	}
-	commit, branch, err := getRemoteGitInfo(*gitRemoteHost, *gitRemoteDir)
+	p, err := runPreflight(*gitRemoteHost, sshHostOptions{}, []string{*gitRemoteDir}, nil)
+	if err != nil {
+		t.Fatalf("runPreflight: %v", err)
+	}
+	commit, branch, err := getRemoteGitInfo(p.Output, *gitRemoteDir)
 	if err != nil {
 		t.Fatalf("getRemoteGitInfo: %v", err)
 	}
@@ -138,3 +147,27 @@ func TestRemoteGitInfo(t *testing.T) {
 	}
 	t.Logf("remote git info from %s:%s -> commit=%s branch=%s", *gitRemoteHost, *gitRemoteDir, commit, branch)
 }
+
+func TestSourceRemoteHost(t *testing.T) {
+	exp := &Experiment{Remote: "u@login-01"}
+	local := ArtifactSource{Path: "/projects/results"}
+	storage := ArtifactSource{Path: "/data/results", Remote: "u@storage-01"}
+	if local.host(exp) != "u@login-01" || storage.host(exp) != "u@storage-01" {
+		t.Errorf("hosts = %q, %q", local.host(exp), storage.host(exp))
+	}
+	if storage.label() != "u@storage-01:/data/results" || local.label() != "/projects/results" {
+		t.Errorf("labels = %q, %q", storage.label(), local.label())
+	}
+	if got := copyArtifactSources([]ArtifactSource{storage}); got[0].Remote != storage.Remote {
+		t.Errorf("copyArtifactSources dropped the host: %+v", got)
+	}
+
+	for _, remote := range []string{"storage-01", "@storage-01", "u@", "u@-oProxyCommand=x", "u@host:/path", "u@a@b", "u@ho st"} {
+		if err := validateSourceRemotes([]ArtifactSource{{Path: "/r", Remote: remote}}); err == nil {
+			t.Errorf("remote %q accepted", remote)
+		}
+	}
+	if err := validateSourceRemotes([]ArtifactSource{local, storage}); err != nil {
+		t.Errorf("valid sources rejected: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// fileCandidate is one place a --file path may live: a relative path under
+// one of the experiment's artifact sources.
+type fileCandidate struct {
+	source int
+	rel    string
+}
+
+// resolveNamedFile maps a --file argument to the sources it could belong to.
+// "SOURCE:PATH" names a source explicitly, an absolute path matches the
+// sources whose directory contains it, and a relative path is tried under
+// every source.
+func resolveNamedFile(sources []ArtifactSource, arg string) ([]fileCandidate, error) {
+	only := -1
+	if name, rest, ok := strings.Cut(arg, ":"); ok {
+		for i, src := range sources {
+			if src.Name == name {
+				only, arg = i, rest
+				break
+			}
+		}
+	}
+	var out []fileCandidate
+	for i, src := range sources {
+		if only >= 0 && i != only {
+			continue
+		}
+		rel := arg
+		if strings.HasPrefix(arg, "/") {
+			root := strings.TrimRight(src.Path, "/") + "/"
+			if !strings.HasPrefix(path.Clean(arg), root) {
+				continue
+			}
+			rel = strings.TrimPrefix(path.Clean(arg), root)
+		}
+		rel = path.Clean(rel)
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil, fmt.Errorf("%s: not a file inside an artifact source", displayPath(arg))
+		}
+		out = append(out, fileCandidate{source: i, rel: rel})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: not under any artifact source", displayPath(arg))
+	}
+	return out, nil
+}
+
+// statFilesCommand prints a listing record, in parseRemoteListing's format,
+// for each of paths that is a file. Missing paths are silently left out.
+func statFilesCommand(symlinks string, paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	find, test := "find", "-type f"
+	switch symlinks {
+	case symlinksFollow:
+		find = "find -L"
+	case symlinksPreserve:
+		test = "\\( -type f -o -type l \\)"
+	}
+	return fmt.Sprintf("%s %s -maxdepth 0 %s -printf '%%s\\t%%T@\\t%%p\\0' 2>/dev/null", find, strings.Join(quoted, " "), test)
+}
+
+// statRemoteFiles looks up every candidate on one host with a single ssh
+// call and returns what it found, keyed by absolute path.
+func statRemoteFiles(remote string, sshOpts sshHostOptions, sources []ArtifactSource, cands []fileCandidate) (map[string]remoteFile, error) {
+	byMode := make(map[string][]string)
+	for _, c := range cands {
+		src := sources[c.source]
+		byMode[src.Symlinks] = append(byMode[src.Symlinks], path.Join(src.Path, c.rel))
+	}
+	var parts []string
+	for _, mode := range sortedKeys(byMode) {
+		parts = append(parts, statFilesCommand(mode, byMode[mode]))
+	}
+	// find exits non-zero for the paths that do not exist.
+	script := strings.Join(parts, "; ") + "; true"
+	cmd := sshCommand(remote, sshOpts, "bash", "-c", shellQuote(script)).withTimeout(timeouts.Transfer)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("remote stat on %s failed: %v\n%s", remote, err, strings.TrimSpace(stderr.String()))
+	}
+	files, err := parseRemoteListing(stdout.String())
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]remoteFile, len(files))
+	for _, f := range files {
+		found[f.Rel] = f
+	}
+	return found, nil
+}
+
+// fetchNamedFiles implements exp fetch --file: it transfers just the named
+// files without listing the sources, one transfer per source, into the usual
+// destination layout. Patterns and time filters do not apply, and nothing is
+// recorded as a sync. A path that is missing or ambiguous is reported and
+// the others are still fetched.
+func fetchNamedFiles(db *sql.DB, exp *Experiment, f fetchFlags) error {
+	sources, destDir, opts, err := resolveFetch(db, exp, f)
+	if err != nil {
+		return err
+	}
+	if opts.Via != "" {
+		if sources, err = routeVia(os.Stdout, exp, sources, opts.Via); err != nil {
+			return err
+		}
+	}
+	w := io.Writer(os.Stdout)
+	if f.stdout {
+		w = os.Stderr
+	}
+
+	failed := 0
+	cands := make(map[string][]fileCandidate)
+	byHost := make(map[string][]fileCandidate)
+	for _, arg := range f.files {
+		cs, err := resolveNamedFile(sources, arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		cands[arg] = cs
+		for _, c := range cs {
+			host := sources[c.source].host(exp)
+			byHost[host] = append(byHost[host], c)
+		}
+	}
+	found := make(map[string]remoteFile)
+	for _, host := range sortedKeys(byHost) {
+		files, err := statRemoteFiles(host, exp.SSH, sources, byHost[host])
+		if err != nil {
+			return err
+		}
+		for abs, rf := range files {
+			found[host+":"+abs] = rf
+		}
+	}
+
+	type namedFetch struct {
+		cand fileCandidate
+		file remoteFile
+	}
+	var fetches []namedFetch
+	for _, arg := range f.files {
+		var hits []namedFetch
+		for _, c := range cands[arg] {
+			src := sources[c.source]
+			if rf, ok := found[src.host(exp)+":"+path.Join(src.Path, c.rel)]; ok {
+				hits = append(hits, namedFetch{cand: c, file: rf})
+			}
+		}
+		switch {
+		case len(cands[arg]) == 0:
+			// Already reported.
+		case len(hits) == 0:
+			fmt.Fprintf(os.Stderr, "%s: not found remotely\n", displayPath(arg))
+			failed++
+		case len(hits) > 1:
+			var names []string
+			for _, h := range hits {
+				names = append(names, sources[h.cand.source].Name+":"+h.cand.rel)
+			}
+			fmt.Fprintf(os.Stderr, "%s: exists in more than one artifact source; name one of %s\n", displayPath(arg), strings.Join(names, ", "))
+			failed++
+		default:
+			fetches = append(fetches, hits[0])
+		}
+	}
+
+	if f.stdout {
+		if failed > 0 {
+			return exitStatus(1)
+		}
+		h := fetches[0]
+		src := sources[h.cand.source]
+		cmd := sshCommand(src.host(exp), exp.SSH, "cat", "--", shellQuote(path.Join(src.Path, h.cand.rel))).withTimeout(timeouts.Transfer)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("remote cat failed: %w", err)
+		}
+		return nil
+	}
+
+	absDest, err := expandLocalPath(destDir)
+	if err != nil {
+		return fmt.Errorf("artifact destination: %w", err)
+	}
+	bySource := make(map[int][]string)
+	var total int64
+	for _, h := range fetches {
+		bySource[h.cand.source] = append(bySource[h.cand.source], h.cand.rel)
+		total += h.file.Size
+		if opts.DryRun {
+			fmt.Fprintf(w, "Would fetch %s (%s) from %s\n", displayPath(h.cand.rel), formatBytes(h.file.Size), sources[h.cand.source].label())
+		}
+	}
+	if !opts.DryRun {
+		indexes := make([]int, 0, len(bySource))
+		for i := range bySource {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		for _, i := range indexes {
+			src, rels := sources[i], bySource[i]
+			dest := opts.sourceDest(absDest, src)
+			if src.Flatten {
+				m, err := loadArtifactManifest(db, exp.ID, src.Path, dest)
+				if err != nil {
+					return fmt.Errorf("load manifest: %w", err)
+				}
+				_, err = rsyncFlattened(w, src.host(exp), exp.SSH, src, rels, dest, namedFlatNames(m, rels), opts)
+			} else {
+				_, err = transferFiles(w, src.host(exp), exp.SSH, src, rels, dest, opts)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "Fetched %d file(s) (%s) into %s.\n", len(fetches), formatBytes(total), absDest)
+	}
+	if failed > 0 {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// namedFlatNames picks local names for files of a flattened source: the
+// name the last sync recorded for a file, else its flattenName.
+func namedFlatNames(m artifactManifest, rels []string) map[string]string {
+	names := make(map[string]string, len(rels))
+	for _, rel := range rels {
+		names[rel] = flattenName(rel)
+		if e, ok := m.Files[rel]; ok && e.Local != "" {
+			names[rel] = e.Local
+		}
+	}
+	return names
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveNamedFile(t *testing.T) {
+	sources := []ArtifactSource{
+		{Name: "out", Path: "/scratch/run/out"},
+		{Name: "logs", Path: "/scratch/run/logs/"},
+	}
+	cases := []struct {
+		arg  string
+		want []fileCandidate
+	}{
+		{"a/metrics.json", []fileCandidate{{0, "a/metrics.json"}, {1, "a/metrics.json"}}},
+		{"logs:a/metrics.json", []fileCandidate{{1, "a/metrics.json"}}},
+		{"/scratch/run/out/a/../b.csv", []fileCandidate{{0, "b.csv"}}},
+		// Not a source name, so the colon is part of the path.
+		{"t:1.json", []fileCandidate{{0, "t:1.json"}, {1, "t:1.json"}}},
+	}
+	for _, c := range cases {
+		got, err := resolveNamedFile(sources, c.arg)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("resolveNamedFile(%q) = %v, %v; want %v", c.arg, got, err, c.want)
+		}
+	}
+	for _, arg := range []string{"/elsewhere/x.json", "../x.json", "out:.."} {
+		if _, err := resolveNamedFile(sources, arg); err == nil {
+			t.Errorf("resolveNamedFile(%q) should fail", arg)
+		}
+	}
+}
+
+func TestStatFilesCommand(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	root := t.TempDir()
+	present := filepath.Join(root, "it's here.json")
+	if err := os.WriteFile(present, []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "gone.json")
+	// Run the remote half locally, the way ssh would.
+	out, err := exec.Command("bash", "-c", statFilesCommand("", []string{present, missing, root})+"; true").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := parseRemoteListing(string(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Rel != present || files[0].Size != 5 {
+		t.Errorf("stat listing = %+v, want only %s", files, present)
+	}
+
+	names := namedFlatNames(artifactManifest{Files: map[string]manifestEntry{
+		"run1/metrics.json": {Local: "metrics.json"},
+	}}, []string{"run1/metrics.json", "new/log.txt"})
+	if names["run1/metrics.json"] != "metrics.json" || names["new/log.txt"] != "new_log.txt" {
+		t.Errorf("flat names = %v", names)
+	}
+}
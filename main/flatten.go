@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// flattenStagingDir is where a flattened source is first synced with its
+// remote layout intact, before files are moved to their flat names.
+const flattenStagingDir = ".exp-flatten"
+
+// flattenName is the local name of a remote file without directories: its
+// relative path with the components joined by "_", so results/run1/
+// metrics.json lands as results_run1_metrics.json. It depends on nothing
+// but the path, so a file keeps its name whatever else a fetch matched.
+func flattenName(rel string) string {
+	return strings.ReplaceAll(rel, "/", "_")
+}
+
+// flattenNames maps each relative remote path to its flattenName. Two paths
+// that only differ in where "/" and "_" stand, such as a_b/c and a/b_c,
+// would share a name; that is an error rather than a rename, which a later
+// fetch might not repeat.
+func flattenNames(rels []string) (map[string]string, error) {
+	sorted := append([]string(nil), rels...)
+	sort.Strings(sorted)
+	out := make(map[string]string, len(sorted))
+	owner := make(map[string]string, len(sorted))
+	for _, rel := range sorted {
+		name := flattenName(rel)
+		if other, ok := owner[name]; ok {
+			return nil, fmt.Errorf("flatten: %s and %s would both land as %s; fetch this source without flattening",
+				displayPath(other), displayPath(rel), displayPath(name))
+		}
+		owner[name] = rel
+		out[rel] = name
+	}
+	return out, nil
+}
+
+// rsyncFlattened transfers files into a staging directory under dest and
+// then moves each to its flat name. The staging directory is kept after a
+// failure so the next attempt can resume. When only unreadable files failed,
+// the others are still moved and the *deniedError is returned.
+func rsyncFlattened(w io.Writer, remote string, sshOpts sshHostOptions, src ArtifactSource, files []string, dest string, names map[string]string, opts fetchOptions) (transferTally, error) {
+	staging := filepath.Join(dest, flattenStagingDir)
+	updated, err := transferFiles(w, remote, sshOpts, src, files, staging, opts)
+	var de *deniedError
+	if errors.As(err, &de) {
+		files = withoutDenied(files, de.Paths)
+	} else if err != nil {
+		return transferTally{}, err
+	}
+	for _, rel := range files {
+		target := filepath.Join(dest, names[rel])
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(rel)), target); err != nil {
+			return transferTally{}, fmt.Errorf("flatten %s: %w", rel, err)
+		}
+	}
+	if err := os.RemoveAll(staging); err != nil {
+		return updated, err
+	}
+	return updated, err
+}
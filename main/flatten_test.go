@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlattenNames(t *testing.T) {
+	rels := []string{
+		"results/run2/metrics.json",
+		"results/run1/metrics.json",
+		"other/run1/metrics.json",
+		"summary.csv",
+		"logs/train.log",
+		"metrics.json",
+	}
+	want := map[string]string{
+		"metrics.json":              "metrics.json",
+		"other/run1/metrics.json":   "other_run1_metrics.json",
+		"results/run1/metrics.json": "results_run1_metrics.json",
+		"results/run2/metrics.json": "results_run2_metrics.json",
+		"summary.csv":               "summary.csv",
+		"logs/train.log":            "logs_train.log",
+	}
+	got, err := flattenNames(rels)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenNames = %v, %v\nwant %v", got, err, want)
+	}
+	// A later fetch matching fewer files names them the same.
+	if again, err := flattenNames(rels[:1]); err != nil || again[rels[0]] != want[rels[0]] {
+		t.Errorf("flattenNames of one file = %v, %v", again, err)
+	}
+
+	if _, err := flattenNames([]string{"a_b/c", "a/b_c"}); err == nil || !strings.Contains(err.Error(), "would both land as a_b_c") {
+		t.Errorf("collision err = %v", err)
+	}
+}
+
+func TestManifestLocalNames(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "run1_metrics.json"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listing := []remoteFile{{Rel: "run1/metrics.json", Size: 5, ModTime: 10}}
+	m := newArtifactManifest(listing)
+	if d := m.diff(listing, dest); len(d.Unchanged) != 0 {
+		t.Fatalf("without the mapping the flattened copy cannot be found: %+v", d)
+	}
+	m.setLocalNames(map[string]string{"run1/metrics.json": "run1_metrics.json"})
+	if d := m.diff(listing, dest); !reflect.DeepEqual(d.Unchanged, []string{"run1/metrics.json"}) {
+		t.Errorf("diff with local names = %+v", d)
+	}
+}
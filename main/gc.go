@@ -0,0 +1,257 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type gcItem struct {
+	exp       *Experiment
+	artifacts string
+	size      int64
+}
+
+type orphanDir struct {
+	path string
+	size int64
+}
+
+// exp gc [--older-than 90d] [--status failed,cancelled] [--purge-artifacts] [--artifact-root DIR] [--dry-run]
+func cmdGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	var (
+		olderThan      string
+		statusFlag     multiStringFlag
+		purgeArtifacts bool
+		dryRun         bool
+		yes            bool
+		artifactRoots  multiStringFlag
+	)
+	fs.StringVar(&olderThan, "older-than", "", "Only remove experiments created longer ago than this (e.g. 90d, 12h)")
+	fs.Var(&statusFlag, "status", "Only remove experiments with this job status; may be repeated or comma-separated")
+	fs.BoolVar(&purgeArtifacts, "purge-artifacts", false, "Also delete the per-experiment artifact directories of removed experiments")
+	fs.BoolVar(&dryRun, "dry-run", false, "Show what would be removed and how much space it would reclaim")
+	fs.BoolVar(&yes, "yes", false, "Remove orphaned artifact directories without prompting")
+	fs.Var(&artifactRoots, "artifact-root", "LOCAL artifact root to scan for orphaned per-ID directories; may be repeated (no root, no orphan scan)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp gc [--older-than 90d] [--status failed,cancelled] [--purge-artifacts] [--artifact-root DIR] [--dry-run]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var cutoff time.Time
+	if olderThan != "" {
+		age, err := parseAge(olderThan)
+		if err != nil {
+			return fmt.Errorf("older-than: %w", err)
+		}
+		cutoff = time.Now().UTC().Add(-age)
+	}
+	statuses := make(map[string]bool)
+	for _, s := range splitCommaValues(statusFlag.Values()) {
+		statuses[strings.ToUpper(s)] = true
+	}
+	filtering := !cutoff.IsZero() || len(statuses) > 0
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		return fmt.Errorf("query experiments: %w", err)
+	}
+
+	var items []gcItem
+	// A directory is in use when a row records it, or something under it, as
+	// its artifact destination: an imported or restored experiment keeps a
+	// destination named after its old ID.
+	known := make(map[int64]bool, len(exps))
+	inUse := make(map[string]bool, len(exps))
+	roots := make(map[string]bool)
+	for _, r := range artifactRoots.Values() {
+		abs, err := expandLocalPath(r)
+		if err != nil {
+			return fmt.Errorf("artifact-root %s: %w", r, err)
+		}
+		roots[abs] = true
+	}
+	for _, exp := range exps {
+		known[exp.ID] = true
+		if exp.ArtifactDest != "" && filepath.IsAbs(exp.ArtifactDest) {
+			inUse[filepath.Clean(exp.ArtifactDest)] = true
+		}
+		perID := perExperimentArtifactDir(exp)
+		if !filtering || isLiveStatus(exp.JobStatus) {
+			continue
+		}
+		if !cutoff.IsZero() && (exp.CreatedAt.IsZero() || !exp.CreatedAt.Before(cutoff)) {
+			continue
+		}
+		if len(statuses) > 0 && !statuses[strings.ToUpper(strings.TrimSpace(exp.JobStatus))] {
+			continue
+		}
+		item := gcItem{exp: exp}
+		if purgeArtifacts && perID != "" {
+			item.artifacts = perID
+			if item.size, err = dirSize(perID); err != nil {
+				return fmt.Errorf("measure %s: %w", perID, err)
+			}
+		}
+		items = append(items, item)
+	}
+
+	// Only roots named on the command line are scanned: another database
+	// (--db, EXP_DB_PATH) may keep its artifacts under the same root.
+	orphans, err := findOrphanArtifactDirs(roots, known, inUse)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	if !filtering {
+		fmt.Println("No --older-than or --status filter given; not removing any experiments.")
+	} else if len(items) == 0 {
+		fmt.Println("No experiments match the given filters.")
+	} else {
+		fmt.Printf("Experiments to remove (%d):\n", len(items))
+		for _, it := range items {
+			line := fmt.Sprintf("  %-5d %-25s %-12s %s", it.exp.ID, it.exp.Name, it.exp.JobStatus, it.exp.CreatedAt.Format(time.RFC3339))
+			if it.artifacts != "" {
+				line += fmt.Sprintf("  %s (%s)", it.artifacts, formatBytes(it.size))
+				total += it.size
+			}
+			fmt.Println(line)
+		}
+	}
+	var orphanTotal int64
+	if len(orphans) > 0 {
+		fmt.Printf("Orphaned artifact directories (%d):\n", len(orphans))
+		for _, o := range orphans {
+			fmt.Printf("  %s (%s)\n", o.path, formatBytes(o.size))
+			orphanTotal += o.size
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Dry run: would reclaim %s (%s from experiments, %s from orphans)\n",
+			formatBytes(total+orphanTotal), formatBytes(total), formatBytes(orphanTotal))
+		return nil
+	}
+
+	removed := 0
+	var reclaimed int64
+	for _, it := range items {
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`DELETE FROM experiments WHERE id = ?`, it.exp.ID); err != nil {
+				return fmt.Errorf("delete experiment %d: %w", it.exp.ID, err)
+			}
+			for _, table := range []string{"metrics", "status_events", "pushes", "artifact_manifests", "artifact_sources", "sync_history", "locks"} {
+				if _, err := tx.Exec(`DELETE FROM `+table+` WHERE experiment_id = ?`, it.exp.ID); err != nil {
+					return fmt.Errorf("delete %s of experiment %d: %w", table, it.exp.ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		removed++
+		if it.artifacts != "" {
+			if err := os.RemoveAll(it.artifacts); err != nil {
+				fmt.Printf("Warning: unable to remove %s: %v\n", it.artifacts, err)
+				continue
+			}
+			reclaimed += it.size
+		}
+	}
+	if len(orphans) > 0 && (yes || confirm(fmt.Sprintf("Remove %d orphaned artifact directories (%s)?", len(orphans), formatBytes(orphanTotal)))) {
+		for _, o := range orphans {
+			if err := os.RemoveAll(o.path); err != nil {
+				fmt.Printf("Warning: unable to remove %s: %v\n", o.path, err)
+				continue
+			}
+			reclaimed += o.size
+		}
+	}
+	fmt.Printf("Removed %d experiment(s); reclaimed %s\n", removed, formatBytes(reclaimed))
+	return nil
+}
+
+// isLiveStatus reports whether an experiment may still be running and must
+// therefore never be garbage collected.
+func isLiveStatus(status string) bool {
+	s := strings.ToUpper(strings.TrimSpace(status))
+	return s == "" || s == "SUBMITTED" || isActiveStatus(s)
+}
+
+// perExperimentArtifactDir returns the experiment's artifact destination when
+// it is the per-ID directory created by exp run (…/<id>), or "" otherwise. Only
+// such directories are safe to delete wholesale.
+func perExperimentArtifactDir(exp *Experiment) string {
+	dest := exp.ArtifactDest
+	if dest == "" || !filepath.IsAbs(dest) {
+		return ""
+	}
+	if filepath.Base(dest) != strconv.FormatInt(exp.ID, 10) {
+		return ""
+	}
+	return filepath.Clean(dest)
+}
+
+// findOrphanArtifactDirs scans artifact roots for numeric directories that no
+// longer correspond to an experiment row: neither named after a known ID nor
+// holding a destination in inUse.
+func findOrphanArtifactDirs(roots map[string]bool, known map[int64]bool, inUse map[string]bool) ([]orphanDir, error) {
+	var out []orphanDir
+	for root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("scan %s: %w", root, err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			id, err := strconv.ParseInt(e.Name(), 10, 64)
+			if err != nil || known[id] {
+				continue
+			}
+			path := filepath.Join(root, e.Name())
+			if holdsArtifactDest(path, inUse) {
+				continue
+			}
+			size, err := dirSize(path)
+			if err != nil {
+				return nil, fmt.Errorf("measure %s: %w", path, err)
+			}
+			out = append(out, orphanDir{path: path, size: size})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out, nil
+}
+
+// holdsArtifactDest reports whether dir is, or contains, one of dests.
+func holdsArtifactDest(dir string, dests map[string]bool) bool {
+	for dest := range dests {
+		if dest == dir || strings.HasPrefix(dest, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindOrphanArtifactDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"1", "2", "3/run", "4", "notes"} {
+		if err := os.MkdirAll(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "2", "out.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 3 holds a restored experiment's destination, 4 another row's.
+	inUse := map[string]bool{filepath.Join(root, "3", "run"): true, filepath.Join(root, "4"): true}
+	orphans, err := findOrphanArtifactDirs(map[string]bool{root: true}, map[int64]bool{1: true}, inUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0].path != filepath.Join(root, "2") || orphans[0].size != 5 {
+		t.Fatalf("orphans = %+v", orphans)
+	}
+}
+
+func TestPerExperimentArtifactDir(t *testing.T) {
+	cases := []struct {
+		dest string
+		want string
+	}{
+		{"/data/exp/7", "/data/exp/7"},
+		{"/data/exp/results", ""},
+		{"relative/7", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		got := perExperimentArtifactDir(&Experiment{ID: 7, ArtifactDest: c.dest})
+		if got != c.want {
+			t.Errorf("perExperimentArtifactDir(%q) = %q, want %q", c.dest, got, c.want)
+		}
+	}
+}
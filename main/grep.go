@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// grepNoLogStatus is the exit status the remote grep script uses when the
+// log file does not exist, distinct from grep's own 1 (no match) and 2 (error).
+const grepNoLogStatus = 3
+
+// exp grep <id> REGEX [--context N] [--ignore-case] [--all-logs]
+func cmdGrep(args []string) error {
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	var (
+		context    int
+		ignoreCase bool
+		allLogs    bool
+	)
+	fs.IntVar(&context, "context", 0, "Lines of context to print around each match")
+	fs.BoolVar(&ignoreCase, "ignore-case", false, "Match case-insensitively")
+	fs.BoolVar(&allLogs, "all-logs", false, "Search every log of an array job (expands the log path as a glob on the remote host)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp grep <id> REGEX [--context 3] [--ignore-case] [--all-logs]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return fmt.Errorf("experiment id and pattern are required")
+	}
+	idStr, pattern := positional[0], positional[1]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	exp, err := findExperiment(db, idStr)
+	db.Close()
+	if err != nil {
+		return err
+	}
+	if exp.Remote == "" || exp.LogPath == "" {
+		return fmt.Errorf("experiment %s has no recorded remote log", idStr)
+	}
+
+	logGlob := shellQuote(exp.LogPath)
+	if allLogs {
+		logGlob = remoteLogGlob(exp.LogPath, exp.JobID)
+	}
+	script := buildRemoteGrepScript(pattern, logGlob, context, ignoreCase, allLogs)
+	cmd := sshCommand(exp.Remote, exp.SSH, "bash", "-c", shellQuote(script)).withTimeout(timeouts.Transfer)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if code, ok := exitCode(err); ok {
+		switch code {
+		case 1:
+			return exitStatus(1)
+		case grepNoLogStatus:
+			return fmt.Errorf("log %s does not exist yet on %s (job %s may still be pending)", exp.LogPath, exp.Remote, exp.JobID)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("remote grep failed: %w", err)
+	}
+	return nil
+}
+
+// buildRemoteGrepScript returns a bash snippet that checks the log exists and
+// then greps it. logGlob is already shell-quoted (with unquoted wildcards
+// when searching array-job logs).
+func buildRemoteGrepScript(pattern, logGlob string, context int, ignoreCase, withFilename bool) string {
+	flags := []string{"-nE"}
+	if ignoreCase {
+		flags = append(flags, "-i")
+	}
+	if context > 0 {
+		flags = append(flags, "-C", strconv.Itoa(context))
+	}
+	if withFilename {
+		flags = append(flags, "-H")
+	}
+	return fmt.Sprintf(`set -- %s; [ -e "$1" ] || exit %d; grep %s -e %s -- "$@"`,
+		logGlob, grepNoLogStatus, strings.Join(flags, " "), shellQuote(pattern))
+}
+
+// remoteLogGlob turns a log path into a quoted glob matching every array
+// task: Slurm's %A/%a placeholders become wildcards, and a plain job ID gets
+// a trailing "*" so "name-123.out" also matches "name-123_4.out".
+func remoteLogGlob(logPath, jobID string) string {
+	glob := strings.NewReplacer("%A", "*", "%a", "*").Replace(logPath)
+	if !strings.Contains(glob, "*") && jobID != "" {
+		if i := strings.LastIndex(glob, jobID); i >= 0 {
+			glob = glob[:i+len(jobID)] + "*" + glob[i+len(jobID):]
+		}
+	}
+	return quoteGlob(glob)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRemoteLogGlob(t *testing.T) {
+	if got := remoteLogGlob("/logs/run-123.out", "123"); got != `'/logs/run-123'*'.out'` {
+		t.Errorf("plain job id: got %s", got)
+	}
+	if got := remoteLogGlob("/logs/run-%A_%a.out", "123"); got != `'/logs/run-'*'_'*'.out'` {
+		t.Errorf("array placeholders: got %s", got)
+	}
+}
+
+func TestRemoteGrepScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"run-7_0.out": "start\nCUDA error: out of memory\n",
+		"run-7_1.out": "start\ndone\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(script string) (string, int) {
+		out, err := exec.Command("bash", "-c", script).Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out), 0
+	}
+
+	out, code := run(buildRemoteGrepScript("cuda error", remoteLogGlob(filepath.Join(dir, "run-7.out"), "7"), 0, true, true))
+	if code != 0 || !strings.Contains(out, "run-7_0.out:2:CUDA error") {
+		t.Errorf("array grep: code %d, output %q", code, out)
+	}
+	if _, code = run(buildRemoteGrepScript("Traceback", shellQuote(filepath.Join(dir, "run-7_1.out")), 0, false, false)); code != 1 {
+		t.Errorf("no match: code %d, want 1", code)
+	}
+	if _, code = run(buildRemoteGrepScript("x", shellQuote(filepath.Join(dir, "missing.out")), 0, false, false)); code != grepNoLogStatus {
+		t.Errorf("missing log: code %d, want %d", code, grepNoLogStatus)
+	}
+}
+
+func TestJobLogGlobs(t *testing.T) {
+	got := jobLogGlobs("/logs/bigann-123.out", "123")
+	want := []string{"'/logs/bigann-123.out'", "'/logs/bigann-123_'*'.out'", "'/logs/bigann-123.err'", "'/logs/bigann-123_'*'.err'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jobLogGlobs = %q\nwant %q", got, want)
+	}
+	if got := jobLogGlobs("/logs/sweep-%A_%a.log", "77"); !reflect.DeepEqual(got, []string{"'/logs/sweep-'*'_'*'.log'"}) {
+		t.Errorf("array template = %q", got)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// exp keeps its configuration in a config directory and everything else (the
+// database, its backups, the monitor's pidfile and log) in a data directory:
+//
+//   - EXP_HOME, when set, is both.
+//   - A legacy ~/.exp holding a database or config file is still used as
+//     both, until exp db migrate-home moves it.
+//   - Otherwise $XDG_CONFIG_HOME/exp (~/.config/exp) and $XDG_DATA_HOME/exp
+//     (~/.local/share/exp).
+//
+// Config snapshots record hostnames and paths, so the directories are
+// created private (0700) and the files exp writes there are 0600.
+
+const (
+	privateDirMode  = 0o700
+	privateFileMode = 0o600
+	dbFileName      = "experiments.db"
+)
+
+// configFileNames are the global config files, in lookup order.
+var configFileNames = []string{"config.yaml", "config.yml", "config.json", "config.toml"}
+
+// shadowedConfigWarning makes warnShadowedConfigs warn once per process.
+var shadowedConfigWarning sync.Once
+
+// warnShadowedConfigs warns on stderr when config files other than the one
+// in use, path, exist in the config directory.
+func warnShadowedConfigs(path string, others []string) {
+	var ignored []string
+	for _, other := range others {
+		if _, err := os.Stat(other); err == nil {
+			ignored = append(ignored, filepath.Base(other))
+		}
+	}
+	if len(ignored) == 0 {
+		return
+	}
+	shadowedConfigWarning.Do(func() {
+		fmt.Fprintf(os.Stderr, "Warning: using %s; ignoring %s in the same directory\n", path, strings.Join(ignored, ", "))
+	})
+}
+
+// expLayout is where exp's directories are.
+type expLayout struct {
+	Config string
+	Data   string
+	Legacy bool // both are the old ~/.exp
+}
+
+// legacyHome is the pre-XDG ~/.exp.
+func legacyHome() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".exp"), nil
+}
+
+// isLegacyHome reports whether dir holds an installation in the old layout.
+func isLegacyHome(dir string) bool {
+	for _, name := range append([]string{dbFileName}, configFileNames...) {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// currentLayout resolves the directories as described above.
+func currentLayout() (expLayout, error) {
+	if dir := os.Getenv("EXP_HOME"); dir != "" {
+		abs, err := expandLocalPath(dir)
+		if err != nil {
+			return expLayout{}, fmt.Errorf("EXP_HOME: %w", err)
+		}
+		return expLayout{Config: abs, Data: abs}, nil
+	}
+	legacy, err := legacyHome()
+	if err != nil {
+		return expLayout{}, err
+	}
+	if isLegacyHome(legacy) {
+		return expLayout{Config: legacy, Data: legacy, Legacy: true}, nil
+	}
+	return xdgLayout()
+}
+
+// xdgLayout is the layout without EXP_HOME or a legacy ~/.exp.
+func xdgLayout() (expLayout, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return expLayout{}, err
+	}
+	base := func(env, fallback string) string {
+		// The XDG spec ignores relative paths.
+		if dir := os.Getenv(env); filepath.IsAbs(dir) {
+			return dir
+		}
+		return filepath.Join(home, fallback)
+	}
+	return expLayout{
+		Config: filepath.Join(base("XDG_CONFIG_HOME", ".config"), "exp"),
+		Data:   filepath.Join(base("XDG_DATA_HOME", filepath.Join(".local", "share")), "exp"),
+	}, nil
+}
+
+// configDir returns the directory holding the global config, creating it.
+func configDir() (string, error) {
+	layout, err := currentLayout()
+	if err != nil {
+		return "", err
+	}
+	return layout.Config, os.MkdirAll(layout.Config, privateDirMode)
+}
+
+// dataDir returns the directory holding the database and exp's state,
+// creating it, or making it private if an older exp created it open.
+func dataDir() (string, error) {
+	layout, err := currentLayout()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(layout.Data, privateDirMode); err != nil {
+		return "", err
+	}
+	makePrivate(layout.Data, privateDirMode)
+	return layout.Data, nil
+}
+
+// createPrivateFile creates path as an empty 0600 file unless it exists, so
+// a file another program then opens (SQLite, say) is not world-readable. An
+// existing file is made private instead.
+func createPrivateFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, privateFileMode)
+	if errors.Is(err, os.ErrExist) {
+		makePrivate(path, privateFileMode)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// madePrivate records the paths makePrivate has looked at in this process.
+var madePrivate sync.Map
+
+// makePrivate takes group and other access away from path, which exp
+// created with mode, when it has any: directories and databases created
+// before exp made them private keep their old permissions otherwise. A
+// failure, on a file someone else owns say, is only a warning.
+func makePrivate(path string, mode os.FileMode) {
+	if runtime.GOOS == "windows" {
+		// Permission bits are not how Windows controls access.
+		return
+	}
+	if _, seen := madePrivate.LoadOrStore(path, true); seen {
+		return
+	}
+	st, err := os.Stat(path)
+	if err != nil || st.Mode().Perm()&0o077 == 0 {
+		return
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s is readable by other users (%s) and could not be made private: %v\n", path, st.Mode().Perm(), err)
+	}
+}
+
+// exp db migrate-home [--dry-run]
+func cmdDBMigrateHome(args []string) error {
+	fs := flag.NewFlagSet("db migrate-home", flag.ExitOnError)
+	var dryRun bool
+	fs.BoolVar(&dryRun, "dry-run", false, "Only print what would move where")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp db migrate-home [--dry-run]\n\n")
+		fmt.Fprintf(os.Stderr, "Moves a ~/.exp installation to the config and data directories (EXP_HOME, or the XDG ones).\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	legacy, err := legacyHome()
+	if err != nil {
+		return err
+	}
+	if !isLegacyHome(legacy) {
+		return fmt.Errorf("%s holds no database or config to move", legacy)
+	}
+	target, err := xdgLayout()
+	if err != nil {
+		return err
+	}
+	if os.Getenv("EXP_HOME") != "" {
+		if target, err = currentLayout(); err != nil {
+			return err
+		}
+	}
+	if target.Config == legacy || target.Data == legacy {
+		return fmt.Errorf("EXP_HOME is %s already; nothing to move", legacy)
+	}
+	if pid, ok := runningMonitorPID(); ok {
+		return fmt.Errorf("a monitor daemon (pid %d) is using the database; stop it first", pid)
+	}
+	plan, err := planHomeMigration(legacy, target)
+	if err != nil {
+		return err
+	}
+	for _, m := range plan {
+		fmt.Printf("%s -> %s\n", m.from, m.to)
+	}
+	if dryRun || len(plan) == 0 {
+		return nil
+	}
+	if err := migrateHome(legacy, plan, target); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(legacy); err == nil && len(entries) == 0 {
+		os.Remove(legacy)
+	} else {
+		fmt.Printf("Left behind in %s: files exp does not manage\n", legacy)
+	}
+	fmt.Printf("Config: %s\nData:   %s\n", target.Config, target.Data)
+	return nil
+}
+
+// homeMove is one file migrate-home moves.
+type homeMove struct {
+	from, to string
+	db       bool
+}
+
+// planHomeMigration lists what moves from the legacy directory, refusing to
+// overwrite anything already at the target.
+func planHomeMigration(legacy string, target expLayout) ([]homeMove, error) {
+	var plan []homeMove
+	add := func(name, dir string, db bool) {
+		from := filepath.Join(legacy, name)
+		if _, err := os.Stat(from); err == nil {
+			plan = append(plan, homeMove{from: from, to: filepath.Join(dir, name), db: db})
+		}
+	}
+	add(dbFileName, target.Data, true)
+	for _, name := range configFileNames {
+		add(name, target.Config, false)
+	}
+	add("monitor.log", target.Data, false)
+	backups, err := os.ReadDir(filepath.Join(legacy, "backups"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range backups {
+		if !e.IsDir() {
+			add(filepath.Join("backups", e.Name()), target.Data, false)
+		}
+	}
+	for _, m := range plan {
+		if _, err := os.Stat(m.to); err == nil {
+			return nil, fmt.Errorf("%s already exists; move or remove it first", m.to)
+		}
+	}
+	return plan, nil
+}
+
+// migrateHome carries out plan. The database is copied with VACUUM INTO,
+// which folds in its write-ahead log, and checked before the original goes.
+func migrateHome(legacy string, plan []homeMove, target expLayout) error {
+	for _, dir := range []string{target.Config, target.Data} {
+		if err := os.MkdirAll(dir, privateDirMode); err != nil {
+			return err
+		}
+	}
+	for _, m := range plan {
+		if err := os.MkdirAll(filepath.Dir(m.to), privateDirMode); err != nil {
+			return err
+		}
+		var err error
+		if m.db {
+			err = moveDatabase(m.from, m.to)
+		} else {
+			err = moveFile(m.from, m.to)
+		}
+		if err != nil {
+			return fmt.Errorf("move %s: %w", m.from, err)
+		}
+	}
+	os.Remove(filepath.Join(legacy, "backups"))
+	os.Remove(filepath.Join(legacy, "monitor.pid"))
+	return nil
+}
+
+func moveDatabase(from, to string) error {
+	src, err := sql.Open("sqlite", from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Exec(`VACUUM INTO ?`, to); err != nil {
+		return err
+	}
+	if err := os.Chmod(to, privateFileMode); err != nil {
+		return err
+	}
+	dst, err := sql.Open("sqlite", to)
+	if err != nil {
+		return err
+	}
+	problems, err := integrityCheck(dst)
+	dst.Close()
+	if err == nil && len(problems) > 0 {
+		err = fmt.Errorf("copy failed integrity_check: %s", problems[0])
+	}
+	if err != nil {
+		os.Remove(to)
+		return err
+	}
+	src.Close()
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(from + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveFile renames from to to, copying when they are on different
+// filesystems. The result is private either way.
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return os.Chmod(to, privateFileMode)
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, privateFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+	in.Close()
+	return os.Remove(from)
+}
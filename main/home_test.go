@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	check := func(what, wantConfig, wantData string) {
+		t.Helper()
+		layout, err := currentLayout()
+		if err != nil || layout.Config != wantConfig || layout.Data != wantData {
+			t.Errorf("%s: layout = %+v, %v; want config %s, data %s", what, layout, err, wantConfig, wantData)
+		}
+	}
+	check("default", filepath.Join(home, ".config", "exp"), filepath.Join(home, ".local", "share", "exp"))
+
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "relative/is/ignored")
+	check("XDG", "/xdg/config/exp", filepath.Join(home, ".local", "share", "exp"))
+
+	legacy := filepath.Join(home, ".exp")
+	if err := os.MkdirAll(legacy, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	check("empty ~/.exp", "/xdg/config/exp", filepath.Join(home, ".local", "share", "exp"))
+	if err := os.WriteFile(filepath.Join(legacy, "config.yaml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check("legacy", legacy, legacy)
+
+	t.Setenv("EXP_HOME", "~/exp-all")
+	check("EXP_HOME", filepath.Join(home, "exp-all"), filepath.Join(home, "exp-all"))
+}
+
+func TestPrivateFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// Created open by an older exp; opening the database tightens both.
+	dir := filepath.Join(home, ".local", "share", "exp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, dbFileName), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db := openTestDBAt(t)
+	db.Close()
+	for path, want := range map[string]os.FileMode{dir: privateDirMode, filepath.Join(dir, dbFileName): privateFileMode} {
+		info, err := os.Stat(path)
+		if err != nil || info.Mode().Perm() != want {
+			t.Errorf("%s: mode %v, %v; want %v", path, info.Mode().Perm(), err, want)
+		}
+	}
+}
+
+func TestMigrateHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	legacy := filepath.Join(home, ".exp")
+	if err := os.MkdirAll(filepath.Join(legacy, "backups"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"config.yaml":                            "defaults:\n  remote: u@h\n",
+		"monitor.log":                            "started\n",
+		"backups/experiments-20250101-000000.db": "backup",
+		"notes.txt":                              "mine",
+	} {
+		if err := os.WriteFile(filepath.Join(legacy, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The database is created in ~/.exp because config.yaml marks it legacy.
+	db := openTestDBAt(t)
+	id := insertTestExperiment(t, db, "kept", "COMPLETED", "")
+	db.Close()
+	if _, err := os.Stat(filepath.Join(legacy, dbFileName)); err != nil {
+		t.Fatalf("legacy database: %v", err)
+	}
+
+	if err := cmdDBMigrateHome(nil); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(home, ".config", "exp")
+	data := filepath.Join(home, ".local", "share", "exp")
+	for _, path := range []string{
+		filepath.Join(config, "config.yaml"),
+		filepath.Join(data, dbFileName),
+		filepath.Join(data, "monitor.log"),
+		filepath.Join(data, "backups", "experiments-20250101-000000.db"),
+	} {
+		info, err := os.Stat(path)
+		if err != nil || info.Mode().Perm() != privateFileMode {
+			t.Errorf("%s after migration: %v, %v", path, info, err)
+		}
+	}
+	for _, name := range []string{dbFileName, dbFileName + "-wal", "config.yaml", "monitor.log", "backups"} {
+		if _, err := os.Stat(filepath.Join(legacy, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left in ~/.exp: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "notes.txt")); err != nil {
+		t.Errorf("unmanaged file was touched: %v", err)
+	}
+
+	if layout, _ := currentLayout(); layout.Legacy {
+		t.Error("still using the legacy layout after migrating")
+	}
+	db = openTestDBAt(t)
+	if _, err := findExperiment(db, "1"); err != nil || id != 1 {
+		t.Errorf("migrated experiment: %v", err)
+	}
+	cfg, err := loadConfig()
+	if err != nil || cfg == nil || cfg.Defaults.Remote != "u@h" {
+		t.Errorf("migrated config = %+v, %v", cfg, err)
+	}
+	if err := cmdDBMigrateHome(nil); err == nil {
+		t.Error("migrating again should report nothing to move")
+	}
+}
+
+func TestConfigLookupOrder(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("EXP_HOME", home)
+	for name, data := range map[string]string{
+		"config.toml": "[defaults]\nremote = \"u@toml\"\n",
+		"config.yaml": "defaults:\n  remote: u@yaml\n",
+	} {
+		if err := os.WriteFile(filepath.Join(home, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil || cfg.Defaults.Remote != "u@yaml" {
+		t.Fatalf("config.yaml should win: %+v, %v", cfg, err)
+	}
+	if err := os.Remove(filepath.Join(home, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = loadConfig(); err != nil || cfg.Defaults.Remote != "u@toml" {
+		t.Errorf("config.toml alone: %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// on_state_change in the config names a local program exp runs whenever an
+// experiment goes from queued to running to finished, its pending job stalls
+// (see stalledJobs), or its artifacts fail to sync, so a chat message or
+// dashboard can be driven by a script of one's own. The program reads the
+// experiment, as exp export writes it, on stdin; the fields most scripts
+// want are in the environment too.
+
+const (
+	// stateHookTimeout bounds one run of the hook.
+	stateHookTimeout = 30 * time.Second
+	// stateHookDebounce is how soon after the hook ran for an experiment a
+	// move between queued and running runs it again: a job preempted and
+	// requeued a few times in a row would otherwise send a message each time.
+	// A finished job, a stall and a failed sync always run it.
+	stateHookDebounce = 5 * time.Minute
+)
+
+// stateHooks runs on_state_change; finishGlobalOptions sets it up from the
+// config.
+var stateHooks = newStateHookDispatcher("")
+
+// stateHookDispatcher decides which changes run the hook and runs it.
+type stateHookDispatcher struct {
+	command string
+	now     func() time.Time
+	warnf   func(format string, args ...interface{})
+
+	mu   sync.Mutex
+	last map[int64]time.Time // when the hook last ran for each experiment
+}
+
+func newStateHookDispatcher(command string) *stateHookDispatcher {
+	return &stateHookDispatcher{
+		command: command,
+		now:     time.Now,
+		warnf: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+		},
+		last: make(map[int64]time.Time),
+	}
+}
+
+// hookPhase is the part of a job's life status belongs to; the hook runs
+// when it changes.
+func hookPhase(status string) string {
+	switch {
+	case !isActiveStatus(status):
+		return "finished"
+	case jobStarted(status):
+		return "running"
+	}
+	return "queued"
+}
+
+// statusChanged runs the hook for experiment id going from prev to status,
+// when that moves it to another phase and is not a flap within
+// stateHookDebounce.
+func (h *stateHookDispatcher) statusChanged(db *sql.DB, id int64, prev, status string) {
+	if h.command == "" || hookPhase(prev) == hookPhase(status) {
+		return
+	}
+	now := h.now()
+	h.mu.Lock()
+	last, seen := h.last[id]
+	skip := seen && isActiveStatus(status) && now.Sub(last) < stateHookDebounce
+	switch {
+	case skip:
+	case isActiveStatus(status):
+		h.last[id] = now
+	default:
+		delete(h.last, id)
+	}
+	h.mu.Unlock()
+	if skip {
+		return
+	}
+	h.run(db, id, "status_changed", prev, "")
+}
+
+// stalled runs the hook for experiment id's pending job being marked
+// stalled; EXP_STALLED_REASON is the Slurm reason holding it.
+func (h *stateHookDispatcher) stalled(db *sql.DB, id int64) {
+	if h.command == "" {
+		return
+	}
+	h.run(db, id, "stalled", "", "")
+}
+
+// syncFailed runs the hook for experiment id's artifacts failing to sync.
+func (h *stateHookDispatcher) syncFailed(db *sql.DB, id int64, errMsg string) {
+	if h.command == "" {
+		return
+	}
+	h.run(db, id, "sync_failed", "", errMsg)
+}
+
+// run runs the hook for experiment id. It only ever warns: a broken hook
+// must not stop a monitor.
+func (h *stateHookDispatcher) run(db *sql.DB, id int64, event, prev, errMsg string) {
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		h.warnf("on_state_change for experiment %d: %v", id, err)
+		return
+	}
+	if prev == "" {
+		prev = exp.JobStatus
+	}
+	var record bytes.Buffer
+	if _, err := exportExperiments(db, &record, []idRange{{id, id}}, nil); err != nil {
+		h.warnf("on_state_change for experiment %d: %v", id, err)
+		return
+	}
+	path, err := expandLocalPath(h.command)
+	if err != nil {
+		h.warnf("on_state_change: %v", err)
+		return
+	}
+	cmd := runCommand(path).withTimeout(stateHookTimeout)
+	cmd.Stdin = &record
+	cmd.Env = append(os.Environ(),
+		"EXP_EVENT="+event,
+		"EXP_ID="+strconv.FormatInt(id, 10),
+		"EXP_NAME="+exp.Name,
+		"EXP_STATUS="+exp.JobStatus,
+		"EXP_PREV_STATUS="+prev,
+		"EXP_ARTIFACT_DEST="+exp.ArtifactDest,
+		"EXP_SYNC_ERROR="+errMsg,
+		"EXP_STALLED_REASON="+exp.StalledReason,
+	)
+	output := &cappedBuffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		h.warnf("on_state_change %s for experiment %d failed: %v (output: %s)", path, id, err, output.String())
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useStateHook points on_state_change at a stub script that appends one
+// line per run to the returned file: the environment, then the name read
+// from the JSON on stdin.
+func useStateHook(t *testing.T, body string) (*stateHookDispatcher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := filepath.Join(dir, "hook")
+	os.WriteFile(script, []byte("#!/bin/sh\n"+
+		`echo "$EXP_EVENT $EXP_ID $EXP_NAME $EXP_PREV_STATUS->$EXP_STATUS $EXP_SYNC_ERROR" >> `+shellQuote(runs)+"\n"+
+		"cat > "+shellQuote(filepath.Join(dir, "stdin"))+"\n"+body), 0o755)
+	saved := stateHooks
+	t.Cleanup(func() { stateHooks = saved })
+	stateHooks = newStateHookDispatcher(script)
+	return stateHooks, runs
+}
+
+func TestStateHook(t *testing.T) {
+	db := openTestDB(t)
+	h, runs := useStateHook(t, "")
+	now := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	id := insertTestExperiment(t, db, "train", "PENDING", "")
+
+	for _, step := range []struct {
+		status string
+		after  time.Duration
+	}{
+		{"RUNNING", time.Hour},
+		// Preempted and requeued: the flap back and forth runs the hook once.
+		{"PENDING", 3 * time.Hour},
+		{"REQUEUED", time.Minute},
+		{"RUNNING", time.Minute},
+		{"COMPLETED", time.Hour},
+	} {
+		now = now.Add(step.after)
+		if err := changeExperimentStatus(db, id, step.status, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recordArtifactSync(db, id, nil, nil, "rsync: connection reset"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(runs)
+	want := fmt.Sprintf("status_changed %[1]d train PENDING->RUNNING \n"+
+		"status_changed %[1]d train RUNNING->PENDING \n"+
+		"status_changed %[1]d train RUNNING->COMPLETED \n"+
+		"sync_failed %[1]d train COMPLETED->COMPLETED rsync: connection reset\n", id)
+	if string(data) != want {
+		t.Errorf("hook runs:\n%s\nwant:\n%s", data, want)
+	}
+	var record map[string]interface{}
+	stdin, _ := os.ReadFile(filepath.Join(filepath.Dir(runs), "stdin"))
+	if err := json.Unmarshal(stdin, &record); err != nil || record["name"] != "train" || record["job_status"] != "COMPLETED" {
+		t.Errorf("stdin = %s (%v)", stdin, err)
+	}
+}
+
+func TestStateHookStalled(t *testing.T) {
+	db := openTestDB(t)
+	_, runs := useStateHook(t, `echo "$EXP_STALLED_REASON" >> "$(dirname "$0")/runs"`+"\n")
+	id := insertTestExperiment(t, db, "queued", "PENDING", `{"stall_after":"30m"}`)
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := make(stalledJobs)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	limit := pendingEstimate{Reason: "QOSMaxSubmitJobPerUserLimit"}
+	for _, after := range []time.Duration{0, 30 * time.Minute, 40 * time.Minute} {
+		if _, err := s.observe(db, exp, limit, start.Add(after)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(runs)
+	want := fmt.Sprintf("stalled %d queued PENDING->PENDING \nQOSMaxSubmitJobPerUserLimit\n", id)
+	if string(data) != want {
+		t.Errorf("hook runs:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestStateHookFailureIsNotFatal(t *testing.T) {
+	db := openTestDB(t)
+	h, _ := useStateHook(t, "echo 'webhook returned 502' >&2; exit 3\n")
+	var warnings []string
+	h.warnf = func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+	id := insertTestExperiment(t, db, "train", "RUNNING", "")
+	if err := changeExperimentStatus(db, id, "FAILED", "", nil); err != nil {
+		t.Fatalf("a failing hook failed the status change: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "webhook returned 502") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	if exp, _ := findExperiment(db, fmt.Sprint(id)); exp.JobStatus != "FAILED" {
+		t.Errorf("status = %s", exp.JobStatus)
+	}
+}
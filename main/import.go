@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type importSummary struct {
+	Inserted int
+	Skipped  int
+	Failed   int
+}
+
+// exp import [--dry-run] [--duplicate skip|allow] file.jsonl
+func cmdImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var (
+		dryRun    bool
+		duplicate string
+	)
+	fs.BoolVar(&dryRun, "dry-run", false, "Report what would be imported without writing to the database")
+	fs.StringVar(&duplicate, "duplicate", "skip", "How to treat records matching an existing experiment (remote + job_id + created_at): skip or allow")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp import [--dry-run] [--duplicate skip|allow] file.jsonl\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("input file is required")
+	}
+	if duplicate != "skip" && duplicate != "allow" {
+		return fmt.Errorf("--duplicate must be skip or allow, got %q", duplicate)
+	}
+
+	path, err := expandLocalPath(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("input path: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	summary, err := importExperiments(db, f, duplicate == "allow", dryRun)
+	if err != nil {
+		return err
+	}
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d experiment(s); skipped %d duplicate(s); %d failed\n", verb, summary.Inserted, summary.Skipped, summary.Failed)
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d record(s) failed to import", summary.Failed)
+	}
+	return nil
+}
+
+// importExperiments reads JSONL produced by exp export and inserts each record
+// with a fresh local ID. The whole import runs in one transaction so a schema
+// mismatch part way through leaves the database untouched.
+func importExperiments(db *sql.DB, r io.Reader, allowDuplicates, dryRun bool) (importSummary, error) {
+	var summary importSummary
+
+	columns, err := tableColumns(db, "experiments")
+	if err != nil {
+		return summary, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNo := 0
+	// A dry run inserts nothing, so duplicates within the file are caught
+	// here rather than by findDuplicateExperiment.
+	pending := make(map[string]int)
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rec, err := decodeImportRecord(line)
+		if err != nil {
+			return summary, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		var unknown []string
+		for key := range rec {
+			if key != "schema_version" && !columns[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return summary, fmt.Errorf("line %d: fields not present in the local schema: %s (upgrade exp before importing)",
+				lineNo, strings.Join(unknown, ", "))
+		}
+
+		oldID, _ := rec["id"].(int64)
+		if !allowDuplicates {
+			existing, err := findDuplicateExperiment(tx, rec)
+			if err != nil {
+				return summary, err
+			}
+			if existing != 0 {
+				fmt.Printf("Skipping record %d (line %d): already present as experiment %d\n", oldID, lineNo, existing)
+				summary.Skipped++
+				continue
+			}
+			if dryRun {
+				key := fmt.Sprintf("%#v\x00%#v\x00%#v", rec["remote"], rec["job_id"], rec["created_at"])
+				if first, ok := pending[key]; ok {
+					fmt.Printf("Skipping record %d (line %d): duplicate of line %d\n", oldID, lineNo, first)
+					summary.Skipped++
+					continue
+				}
+				pending[key] = lineNo
+			}
+		}
+		if dryRun {
+			fmt.Printf("Would import record %d (%v)\n", oldID, rec["name"])
+			summary.Inserted++
+			continue
+		}
+		// A savepoint per record, so a failed one leaves nothing behind
+		// while the others still commit.
+		if _, err := tx.Exec(`SAVEPOINT import_record`); err != nil {
+			return summary, err
+		}
+		newID, err := insertImportRecord(tx, rec)
+		if err != nil {
+			if _, rerr := tx.Exec(`ROLLBACK TO import_record`); rerr != nil {
+				return summary, rerr
+			}
+		}
+		if _, rerr := tx.Exec(`RELEASE import_record`); rerr != nil {
+			return summary, rerr
+		}
+		if err != nil {
+			fmt.Printf("Failed to import record %d (line %d): %v\n", oldID, lineNo, err)
+			summary.Failed++
+			continue
+		}
+		fmt.Printf("Imported record %d as experiment %d\n", oldID, newID)
+		summary.Inserted++
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, fmt.Errorf("read input: %w", err)
+	}
+	if dryRun {
+		return summary, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// decodeImportRecord parses one exported line and converts values back into
+// the column representation (integers, strings, snapshot re-encoded as text).
+func decodeImportRecord(line []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("parse record: %w", err)
+	}
+	ver, ok := raw["schema_version"].(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("record has no schema_version; was it produced by exp export?")
+	}
+	// Older records only lack columns added since, so they still import.
+	if n, err := ver.Int64(); err != nil || n < 1 || n > exportSchemaVersion {
+		return nil, fmt.Errorf("record has schema_version %s but this exp reads versions 1 to %d", ver, exportSchemaVersion)
+	}
+	rec := make(map[string]interface{}, len(raw))
+	for key, val := range raw {
+		switch v := val.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				rec[key] = n
+			} else if f, err := v.Float64(); err == nil {
+				rec[key] = f
+			} else {
+				return nil, fmt.Errorf("field %s: invalid number %s", key, v)
+			}
+		case map[string]interface{}, []interface{}:
+			buf, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", key, err)
+			}
+			rec[key] = string(buf)
+		default:
+			rec[key] = v
+		}
+	}
+	return rec, nil
+}
+
+func findDuplicateExperiment(tx *sql.Tx, rec map[string]interface{}) (int64, error) {
+	var id int64
+	// IS rather than =, so records without a job ID (NULL) still match.
+	err := tx.QueryRow(`SELECT id FROM experiments WHERE remote IS ? AND job_id IS ? AND created_at IS ? LIMIT 1`,
+		rec["remote"], rec["job_id"], rec["created_at"]).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func insertImportRecord(tx *sql.Tx, rec map[string]interface{}) (int64, error) {
+	var cols []string
+	for key := range rec {
+		if key == "schema_version" || key == "id" {
+			continue
+		}
+		cols = append(cols, key)
+	}
+	sort.Strings(cols)
+	placeholders := make([]string, len(cols))
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		placeholders[i] = "?"
+		vals[i] = rec[col]
+	}
+	res, err := tx.Exec(fmt.Sprintf(`INSERT INTO experiments (%s) VALUES (%s)`,
+		strings.Join(cols, ", "), strings.Join(placeholders, ", ")), vals...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	text := func(col string) string {
+		s, _ := rec[col].(string)
+		return s
+	}
+	// A per-ID destination (<root>/<old id>) follows the record to its new
+	// ID, or exp fetch would sync into whatever experiment has the old one.
+	oldID, _ := rec["id"].(int64)
+	if dest := remapArtifactDest(text("artifact_dest"), oldID, id); dest != text("artifact_dest") {
+		snapshot := rec["config_snapshot"]
+		if s, ok := snapshot.(string); ok {
+			if snapshot, err = remapSnapshotDest(s, text("artifact_dest"), dest); err != nil {
+				return 0, fmt.Errorf("config snapshot: %w", err)
+			}
+		}
+		if _, err := tx.Exec(`UPDATE experiments SET artifact_dest = ?, config_snapshot = ? WHERE id = ?`, dest, snapshot, id); err != nil {
+			return 0, err
+		}
+	}
+	sources := recordedArtifactSources(text("config_snapshot"), text("artifact_remote"), text("artifact_pattern"))
+	return id, writeArtifactSources(tx, id, sources)
+}
+
+// remapArtifactDest returns dest for an experiment given newID in place of
+// oldID: the per-ID directory <root>/<oldID> becomes <root>/<newID>, and any
+// other destination stays as it is.
+func remapArtifactDest(dest string, oldID, newID int64) string {
+	if dest == "" || oldID == 0 || filepath.Base(dest) != strconv.FormatInt(oldID, 10) {
+		return dest
+	}
+	return filepath.Join(filepath.Dir(dest), strconv.FormatInt(newID, 10))
+}
+
+// remapSnapshotDest points the artifact_dest a config snapshot recorded at
+// dest, when it was old; other snapshots come back unchanged.
+func remapSnapshotDest(snapshot, old, dest string) (string, error) {
+	if snapshot == "" {
+		return snapshot, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(snapshot), &fields); err != nil {
+		return "", err
+	}
+	var recorded string
+	if err := json.Unmarshal(fields["artifact_dest"], &recorded); err != nil || recorded != old {
+		return snapshot, nil
+	}
+	buf, err := json.Marshal(dest)
+	if err != nil {
+		return "", err
+	}
+	fields["artifact_dest"] = buf
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// queryer is the read side *sql.DB and *sql.Tx share.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// tableColumns returns the set of column names defined on table.
+func tableColumns(db queryer, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// With progress_regex, the monitor reads the end of a running job's log now
+// and then and keeps the newest line the regex matches, so exp list can say
+// "epoch 12/50" without anyone opening the log.
+
+const (
+	// progressCheckInterval is how often the log is read.
+	progressCheckInterval = 2 * time.Minute
+	// progressTailBytes is how much of the log's end is read; the newest
+	// progress line is expected there.
+	progressTailBytes = 8 << 10
+)
+
+// jobProgress is what the newest matching log line says.
+type jobProgress struct {
+	Text    string    // the capture, or "current/total"
+	Percent float64   // -1 when unknown
+	Line    string    // the matching line, verbatim
+	At      time.Time // when the line was first read
+}
+
+// describe renders the progress for exp list and exp show.
+func (p jobProgress) describe() string {
+	if p.Percent < 0 {
+		return p.Text
+	}
+	return fmt.Sprintf("%s (%.0f%%)", p.Text, p.Percent)
+}
+
+// compileProgressRegex checks progress_regex as given in a run config or on
+// the command line: one capture group, the progress, or two, the current and
+// total.
+func compileProgressRegex(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid progress_regex %q: %w", expr, err)
+	}
+	if n := re.NumSubexp(); n != 1 && n != 2 {
+		return nil, fmt.Errorf("invalid progress_regex %q: it needs one capture group (the progress) or two (current and total), not %d", expr, n)
+	}
+	return re, nil
+}
+
+// matchProgress finds the newest line of log re matches. Progress bars that
+// redraw with \r count as one line per redraw.
+func matchProgress(re *regexp.Regexp, log string) (jobProgress, bool) {
+	lines := strings.FieldsFunc(log, func(r rune) bool { return r == '\n' || r == '\r' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		m := re.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		p := jobProgress{Text: m[1], Percent: -1, Line: strings.TrimSpace(lines[i])}
+		if len(m) == 3 {
+			p.Text = m[1] + "/" + m[2]
+			cur, err1 := strconv.ParseFloat(m[1], 64)
+			total, err2 := strconv.ParseFloat(m[2], 64)
+			if err1 == nil && err2 == nil && total > 0 {
+				p.Percent = min(100*cur/total, 100)
+			}
+		} else if pct, ok := strings.CutSuffix(strings.TrimSpace(m[1]), "%"); ok {
+			if f, err := strconv.ParseFloat(pct, 64); err == nil {
+				p.Percent = f
+			}
+		}
+		return p, true
+	}
+	return jobProgress{}, false
+}
+
+// tailRemoteLog reads the last progressTailBytes of path on remote.
+func tailRemoteLog(remote string, sshOpts sshHostOptions, path string) (string, error) {
+	out, err := sshCombinedOutput(remote, sshOpts, "tail", "-c", strconv.Itoa(progressTailBytes), shellQuote(path))
+	if err != nil {
+		return "", fmt.Errorf("tail %s: %w (output: %s)", path, err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// progressChecks remembers when each experiment's log was last read.
+type progressChecks map[int64]time.Time
+
+// check reads exp's log with tail when its job runs, its run sets
+// progress_regex and the last read is progressCheckInterval old, and stores
+// what the newest matching line says. A log that is missing or unreadable,
+// or has no matching line, leaves the stored progress as it is; only a
+// database error is returned.
+func (p progressChecks) check(db execer, exp *Experiment, now time.Time, tail func(remote string, sshOpts sshHostOptions, path string) (string, error)) (jobProgress, bool, error) {
+	expr := exp.runSnapshot().ProgressRegex
+	if expr == "" || exp.LogPath == "" || !jobStarted(exp.JobStatus) || !isActiveStatus(exp.JobStatus) {
+		delete(p, exp.ID)
+		return jobProgress{}, false, nil
+	}
+	if last, seen := p[exp.ID]; seen && now.Sub(last) < progressCheckInterval {
+		return jobProgress{}, false, nil
+	}
+	p[exp.ID] = now
+	re, err := compileProgressRegex(expr)
+	if err != nil {
+		return jobProgress{}, false, nil
+	}
+	log, err := tail(exp.Remote, exp.SSH, exp.LogPath)
+	if err != nil {
+		return jobProgress{}, false, nil
+	}
+	prog, ok := matchProgress(re, log)
+	if !ok || (prog.Line == exp.Progress.Line && prog.Text == exp.Progress.Text) {
+		return jobProgress{}, false, nil
+	}
+	prog.At = now.UTC()
+	exp.Progress = prog
+	return prog, true, recordProgress(db, exp.ID, prog)
+}
+
+// recordProgress stores prog on experiment id.
+func recordProgress(db execer, id int64, prog jobProgress) error {
+	var percent interface{}
+	if prog.Percent >= 0 {
+		percent = prog.Percent
+	}
+	_, err := db.Exec(`UPDATE experiments SET progress = ?, progress_percent = ?, progress_line = ?, progress_at = ? WHERE id = ?`,
+		nullString(prog.Text), percent, nullString(prog.Line), nullTime(prog.At), id)
+	return err
+}
+
+// scanProgress builds the progress from the progress_* columns.
+func scanProgress(text sql.NullString, percent sql.NullFloat64, line, at sql.NullString) jobProgress {
+	p := jobProgress{Text: text.String, Percent: -1, Line: line.String}
+	if percent.Valid {
+		p.Percent = percent.Float64
+	}
+	p.At, _ = time.Parse(time.RFC3339, at.String)
+	return p
+}
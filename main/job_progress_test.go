@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const trainingLog = "loading data\nepoch 11/50 loss=0.41\nvalidating\nepoch 12/50 loss=0.39\r  batch 3/100\n"
+
+func TestMatchProgress(t *testing.T) {
+	cases := []struct {
+		expr, log, text string
+		percent         float64
+		line            string
+	}{
+		{`epoch (\d+)/(\d+)`, trainingLog, "12/50", 24, "epoch 12/50 loss=0.39"},
+		{`step (\d+)`, "step 100\nstep 200\nsaving\n", "200", -1, "step 200"},
+		{`(\d+%)\|`, " 45%|████▌     | 45/100\r 46%|████▋     | 46/100", "46%", 46, "46%|████▋     | 46/100"},
+	}
+	for _, c := range cases {
+		re, err := compileProgressRegex(c.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, ok := matchProgress(re, c.log)
+		if !ok || p.Text != c.text || p.Percent != c.percent || p.Line != c.line {
+			t.Errorf("matchProgress(%s) = %+v, %v", c.expr, p, ok)
+		}
+	}
+	re, _ := compileProgressRegex(`epoch (\d+)/(\d+)`)
+	if _, ok := matchProgress(re, "loading data\n"); ok {
+		t.Error("a log without progress matched")
+	}
+	for _, bad := range []string{`epoch \d+`, `(a)(b)(c)`, `(`} {
+		if _, err := compileProgressRegex(bad); err == nil {
+			t.Errorf("progress_regex %q accepted", bad)
+		}
+	}
+}
+
+func TestProgressChecks(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "train", "RUNNING", `{"progress_regex":"epoch (\\d+)/(\\d+)"}`)
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, logErr := "", errors.New("tail: cannot open '/logs/x.out' for reading: No such file or directory")
+	reads := 0
+	tail := func(remote string, sshOpts sshHostOptions, path string) (string, error) {
+		reads++
+		return log, logErr
+	}
+	p := make(progressChecks)
+	now := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// A missing log, then one without a progress line, are not errors.
+	if _, ok, err := p.check(db, exp, now, tail); ok || err != nil {
+		t.Fatalf("missing log: %v, %v", ok, err)
+	}
+	log, logErr = "loading data\n", nil
+	if _, ok, err := p.check(db, exp, now.Add(progressCheckInterval), tail); ok || err != nil {
+		t.Fatalf("no progress yet: %v, %v", ok, err)
+	}
+	log = trainingLog
+	if _, ok, _ := p.check(db, exp, now.Add(progressCheckInterval+time.Second), tail); ok || reads != 2 {
+		t.Errorf("read the log again before progressCheckInterval (%d reads)", reads)
+	}
+	if prog, ok, err := p.check(db, exp, now.Add(2*progressCheckInterval), tail); !ok || err != nil || prog.Text != "12/50" {
+		t.Fatalf("check = %+v, %v, %v", prog, ok, err)
+	}
+
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if got := listColumnValue(exp, nil, "progress"); got != "12/50 (24%)" {
+		t.Errorf("progress column = %q", got)
+	}
+	if exp.Progress.Line != "epoch 12/50 loss=0.39" || !exp.Progress.At.Equal(now.Add(2*progressCheckInterval)) {
+		t.Errorf("stored progress = %+v", exp.Progress)
+	}
+
+	// A log that went missing later keeps the last progress.
+	log, logErr = "", errors.New("connection reset")
+	if _, ok, err := p.check(db, exp, now.Add(3*progressCheckInterval), tail); ok || err != nil {
+		t.Fatalf("unreadable log: %v, %v", ok, err)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.Progress.Text != "12/50" {
+		t.Errorf("progress lost: %+v", exp.Progress)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jobCategory is what a job's state means for exp: still going, or how it
+// ended.
+type jobCategory string
+
+const (
+	jobActive    jobCategory = "active"
+	jobSuccess   jobCategory = "success"
+	jobFailed    jobCategory = "failed"
+	jobCancelled jobCategory = "cancelled"
+	jobTimeout   jobCategory = "timeout"
+	jobOOM       jobCategory = "oom"
+	jobUnknown   jobCategory = "unknown" // the job is gone and how it ended is not known
+)
+
+// jobStates classifies the Slurm job states squeue (%T) and sacct print, and
+// the statuses exp stores itself.
+var jobStates = map[string]jobCategory{
+	"SUBMITTED":                jobActive,
+	"PENDING":                  jobActive,
+	"CONFIGURING":              jobActive,
+	"RUNNING":                  jobActive,
+	"COMPLETING":               jobActive,
+	"SUSPENDED":                jobActive,
+	"STOPPED":                  jobActive,
+	"SIGNALING":                jobActive,
+	"STAGE_OUT":                jobActive,
+	"RESIZING":                 jobActive,
+	"RESV_DEL_HOLD":            jobActive,
+	"SPECIAL_EXIT":             jobActive,
+	"REQUEUED":                 jobActive,
+	"REQUEUE_HOLD":             jobActive,
+	"REQUEUE_FED":              jobActive,
+	"COMPLETED":                jobSuccess,
+	statusCompletedUnconfirmed: jobSuccess,
+	statusSyncDeferred:         jobSuccess, // only COMPLETED experiments are deferred
+	"FAILED":                   jobFailed,
+	"NODE_FAIL":                jobFailed,
+	"BOOT_FAIL":                jobFailed,
+	"PREEMPTED":                jobFailed,
+	"CANCELLED":                jobCancelled,
+	"REVOKED":                  jobCancelled,
+	"TIMEOUT":                  jobTimeout,
+	"DEADLINE":                 jobTimeout,
+	"OUT_OF_MEMORY":            jobOOM,
+	"UNKNOWN":                  jobUnknown,
+}
+
+// stateNotes describe the states whose name alone says less than it could.
+var stateNotes = map[string]string{
+	"NODE_FAIL":     "a node failed",
+	"BOOT_FAIL":     "a node failed to boot",
+	"PREEMPTED":     "preempted by another job",
+	"REVOKED":       "revoked by another cluster of the federation",
+	"TIMEOUT":       "hit its time limit",
+	"DEADLINE":      "missed its deadline",
+	"OUT_OF_MEMORY": "ran out of memory",
+}
+
+// statusCompletedUnconfirmed marks a job that left the queue on a cluster
+// without accounting and was assumed to have completed (see absentJobs).
+const statusCompletedUnconfirmed = "COMPLETED_UNCONFIRMED"
+
+// isPreemption reports whether a job that was RUNNING and is now queued
+// again was preempted and requeued. The monitor only sees the states it
+// polls, so a job requeued and restarted between two polls goes unnoticed.
+func isPreemption(from, to string) bool {
+	if normalizeStatus(from) != "RUNNING" {
+		return false
+	}
+	switch normalizeStatus(to) {
+	case "PENDING", "REQUEUED", "REQUEUE_HOLD", "REQUEUE_FED":
+		return true
+	}
+	return false
+}
+
+// isRequeue reports whether a job recorded as ended is queued or running
+// again: requeued after exp saw it end, by Slurm or by a scontrol requeue
+// outside exp. A job only assumed to have ended proves nothing by coming back.
+func isRequeue(from, to string) bool {
+	from = normalizeStatus(from)
+	if from == statusCompletedUnconfirmed || !isActiveStatus(to) {
+		return false
+	}
+	c, ok := jobStateCategory(from)
+	return ok && c != jobActive && c != jobUnknown
+}
+
+// runDuration is how long a finished job took: from sacct's first Start to
+// its End once accounting recorded them, so requeues after a preemption and
+// exp's polling delay do not skew it, or from submission to when exp saw it
+// finish.
+func (exp *Experiment) runDuration() (time.Duration, bool) {
+	if a := exp.Accounting; !a.Start.IsZero() && a.End.After(a.Start) {
+		return a.End.Sub(a.Start).Round(time.Second), true
+	}
+	if !exp.CreatedAt.IsZero() && !exp.CompletedAt.IsZero() {
+		return exp.CompletedAt.Sub(exp.CreatedAt).Round(time.Second), true
+	}
+	return 0, false
+}
+
+// unrecognizedStateGrace is how long a state missing from jobStates, say
+// from a newer Slurm, is treated as active before exp records UNKNOWN.
+const unrecognizedStateGrace = 30 * time.Minute
+
+// splitSlurmState splits a state as squeue and sacct print it into the state
+// and what follows it: "CANCELLED by 1234" gives CANCELLED and "by 1234".
+// sacct marks a truncated state with a trailing +.
+func splitSlurmState(raw string) (state, detail string) {
+	state, detail, _ = strings.Cut(strings.TrimSpace(raw), " ")
+	return strings.ToUpper(strings.TrimRight(state, "+")), strings.TrimSpace(detail)
+}
+
+// jobStateCategory classifies status. A state jobStates lacks is active, and
+// ok is false. An empty status, not yet polled, is active.
+func jobStateCategory(status string) (c jobCategory, ok bool) {
+	state := normalizeStatus(status)
+	if state == "" {
+		return jobActive, true
+	}
+	c, ok = jobStates[state]
+	if !ok {
+		return jobActive, false
+	}
+	return c, true
+}
+
+func isActiveStatus(status string) bool {
+	c, _ := jobStateCategory(status)
+	return c == jobActive
+}
+
+// activeStates are the known states of a job that has not finished.
+func activeStates() []string {
+	var states []string
+	for s, c := range jobStates {
+		if c == jobActive {
+			states = append(states, s)
+		}
+	}
+	slices.Sort(states)
+	return states
+}
+
+// failure reports whether a job that ended this way did not succeed. How an
+// UNKNOWN job ended is not known, so it does not count.
+func (c jobCategory) failure() bool {
+	switch c {
+	case jobFailed, jobCancelled, jobTimeout, jobOOM:
+		return true
+	}
+	return false
+}
+
+// jobOutcome is what Slurm says about how a job ended.
+type jobOutcome struct {
+	Detail   string // what follows the state, e.g. "by 1234" for CANCELLED
+	ExitCode string // "code:signal"
+	Reason   string // sacct's Reason, e.g. NonZeroExitCode
+	MaxRSS   int64  // bytes; -1 when unknown
+}
+
+// reason explains how a job in status ended, or is empty when it succeeded
+// or is still running.
+func (o jobOutcome) reason(status string) string {
+	state := normalizeStatus(status)
+	c, _ := jobStateCategory(state)
+	if !c.failure() {
+		return ""
+	}
+	var parts []string
+	if note := stateNotes[state]; note != "" {
+		parts = append(parts, note)
+	}
+	if uid, ok := strings.CutPrefix(o.Detail, "by "); ok && c == jobCancelled {
+		parts = append(parts, "cancelled by uid "+uid)
+	}
+	if c == jobOOM && o.MaxRSS > 0 {
+		parts = append(parts, "peak RSS "+formatBytes(o.MaxRSS))
+	}
+	// A cancelled job's signal is the cancelling, and an OOM kill reports
+	// signal 125, which is not one.
+	if code := describeExitCode(o.ExitCode); code != "" && c != jobCancelled && c != jobOOM {
+		parts = append(parts, code)
+	}
+	if o.Reason != "" && !strings.EqualFold(o.Reason, "None") {
+		parts = append(parts, "Slurm reason "+o.Reason)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// describeExitCode renders sacct's "code:signal", or is empty for 0:0.
+func describeExitCode(exitCode string) string {
+	code, signal, _ := strings.Cut(exitCode, ":")
+	switch {
+	case signal != "" && signal != "0":
+		return "killed by signal " + signal
+	case code != "" && code != "0":
+		return "exit code " + code
+	}
+	return ""
+}
+
+// recordJobOutcome stores how a finished job ended. An empty exitCode keeps
+// the stored one.
+func recordJobOutcome(db execer, id int64, reason, exitCode string) error {
+	_, err := db.Exec(`UPDATE experiments SET job_reason = ?, job_exit_code = COALESCE(?, job_exit_code) WHERE id = ?`,
+		nullString(reason), nullString(exitCode), id)
+	return err
+}
+
+// unrecognizedStates remembers since when each experiment's job has been in
+// a state jobStates lacks.
+type unrecognizedStates map[int64]time.Time
+
+// resolve returns status, or UNKNOWN once it has been unrecognized for
+// unrecognizedStateGrace. It logs the first sighting and giving up.
+func (u unrecognizedStates) resolve(exp *Experiment, status string, now time.Time, logf func(format string, args ...interface{})) string {
+	if _, ok := jobStateCategory(status); ok {
+		delete(u, exp.ID)
+		return status
+	}
+	since, seen := u[exp.ID]
+	if !seen {
+		u[exp.ID] = now
+		logf("job %s is in state %s, which exp does not know; treating it as active for up to %s", exp.JobID, status, unrecognizedStateGrace)
+		return status
+	}
+	if now.Sub(since) < unrecognizedStateGrace {
+		return status
+	}
+	delete(u, exp.ID)
+	logf("job %s has been in unknown state %s since %s; recording it as UNKNOWN", exp.JobID, status, since.Format(time.RFC3339))
+	return "UNKNOWN"
+}
+
+// absentJobs remembers since when each experiment's job has been gone from
+// squeue with neither sacct nor scontrol knowing how it ended.
+type absentJobs map[int64]time.Time
+
+// resolve returns status unless it is UNKNOWN and exp's run sets
+// assume_completed_after. Then the job keeps its last known state until it
+// has been gone that long, and is COMPLETED_UNCONFIRMED after.
+func (a absentJobs) resolve(exp *Experiment, status string, now time.Time, logf func(format string, args ...interface{})) string {
+	after := exp.assumeCompletedAfter()
+	if normalizeStatus(status) != "UNKNOWN" || after <= 0 {
+		delete(a, exp.ID)
+		return status
+	}
+	since, seen := a[exp.ID]
+	if !seen {
+		since = now
+		a[exp.ID] = now
+		logf("job %s has left the queue and neither sacct nor scontrol knows how it ended; assuming it completed if it stays gone for %s", exp.JobID, after)
+	}
+	if now.Sub(since) < after {
+		if isActiveStatus(exp.JobStatus) {
+			return exp.JobStatus
+		}
+		return status
+	}
+	delete(a, exp.ID)
+	logf("job %s has been gone since %s; recording it as %s", exp.JobID, since.Format(time.RFC3339), statusCompletedUnconfirmed)
+	return statusCompletedUnconfirmed
+}
+
+// assumeCompletedAfter reads assume_completed_after from the run snapshot; 0
+// means a job that vanishes ends as UNKNOWN.
+func (exp *Experiment) assumeCompletedAfter() time.Duration {
+	d, err := time.ParseDuration(exp.runSnapshot().AssumeCompletedAfter)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// validateAssumeCompleted checks assume_completed_after as given in a run
+// config or on the command line.
+func validateAssumeCompleted(after string) error {
+	if after == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(after); err != nil || d <= 0 {
+		return fmt.Errorf("invalid assume_completed_after %q (examples: 30m, 2h)", after)
+	}
+	return nil
+}
+
+// outcomeLine describes a finished experiment for exp show and exp run, e.g.
+// "oom: ran out of memory; peak RSS 31.9 GiB".
+func (exp *Experiment) outcomeLine() string {
+	if exp.JobCategory == "" || exp.JobCategory == jobActive {
+		return ""
+	}
+	if exp.JobReason == "" {
+		return string(exp.JobCategory)
+	}
+	return fmt.Sprintf("%s: %s", exp.JobCategory, exp.JobReason)
+}
+
+// scanJobCategory reads job_category, falling back to the status's category
+// for rows stored before the column was filled.
+func scanJobCategory(category sql.NullString, status string) jobCategory {
+	if category.String != "" {
+		return jobCategory(category.String)
+	}
+	c, _ := jobStateCategory(status)
+	return c
+}
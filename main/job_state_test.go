@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobStateCategory(t *testing.T) {
+	tests := []struct {
+		status string
+		want   jobCategory
+		known  bool
+	}{
+		{"", jobActive, true},
+		{"SUBMITTED", jobActive, true},
+		{"running", jobActive, true},
+		{"REQUEUE_HOLD", jobActive, true},
+		{"COMPLETED", jobSuccess, true},
+		{"COMPLETED+", jobSuccess, true},
+		{statusSyncDeferred, jobSuccess, true},
+		{"FAILED", jobFailed, true},
+		{"NODE_FAIL", jobFailed, true},
+		{"CANCELLED by 1234", jobCancelled, true},
+		{"CANCELLED+", jobCancelled, true},
+		{"TIMEOUT", jobTimeout, true},
+		{"OUT_OF_MEMORY", jobOOM, true},
+		{"UNKNOWN", jobUnknown, true},
+		{"LAUNCH_FAILED_NEWSTATE", jobActive, false},
+	}
+	for _, tt := range tests {
+		if got, known := jobStateCategory(tt.status); got != tt.want || known != tt.known {
+			t.Errorf("jobStateCategory(%q) = %s, %v; want %s, %v", tt.status, got, known, tt.want, tt.known)
+		}
+	}
+	if isActiveStatus("CANCELLED by 1234") || !isActiveStatus("LAUNCH_FAILED_NEWSTATE") {
+		t.Error("isActiveStatus disagrees with the table")
+	}
+}
+
+func TestJobOutcomeReason(t *testing.T) {
+	tests := []struct {
+		status  string
+		outcome jobOutcome
+		want    string
+	}{
+		{"COMPLETED", jobOutcome{ExitCode: "0:0"}, ""},
+		{"FAILED", jobOutcome{ExitCode: "1:0", Reason: "NonZeroExitCode"}, "exit code 1; Slurm reason NonZeroExitCode"},
+		{"FAILED", jobOutcome{ExitCode: "0:9", Reason: "None"}, "killed by signal 9"},
+		{"CANCELLED", jobOutcome{Detail: "by 1234", ExitCode: "0:15"}, "cancelled by uid 1234"},
+		{"TIMEOUT", jobOutcome{ExitCode: "0:15"}, "hit its time limit; killed by signal 15"},
+		{"OUT_OF_MEMORY", jobOutcome{ExitCode: "0:125", MaxRSS: 2 << 30}, "ran out of memory; peak RSS 2.0 GiB"},
+		{"NODE_FAIL", jobOutcome{}, "a node failed"},
+		{"UNKNOWN", jobOutcome{ExitCode: "1:0"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.outcome.reason(tt.status); got != tt.want {
+			t.Errorf("reason(%s, %+v) = %q, want %q", tt.status, tt.outcome, got, tt.want)
+		}
+	}
+}
+
+func TestUnrecognizedStates(t *testing.T) {
+	exp := &Experiment{ID: 1, JobID: "42"}
+	u := make(unrecognizedStates)
+	var logged []string
+	logf := func(format string, args ...interface{}) { logged = append(logged, format) }
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := u.resolve(exp, "NEW_STATE", start, logf); got != "NEW_STATE" || len(logged) != 1 {
+		t.Fatalf("first sighting = %q, logged %d", got, len(logged))
+	}
+	if got := u.resolve(exp, "NEW_STATE", start.Add(unrecognizedStateGrace-time.Second), logf); got != "NEW_STATE" || len(logged) != 1 {
+		t.Errorf("within the grace period = %q, logged %d", got, len(logged))
+	}
+	if got := u.resolve(exp, "NEW_STATE", start.Add(unrecognizedStateGrace), logf); got != "UNKNOWN" || len(logged) != 2 {
+		t.Errorf("after the grace period = %q, logged %d", got, len(logged))
+	}
+
+	// A known state in between starts the clock over.
+	u.resolve(exp, "NEW_STATE", start, logf)
+	u.resolve(exp, "RUNNING", start.Add(time.Minute), logf)
+	if got := u.resolve(exp, "NEW_STATE", start.Add(unrecognizedStateGrace+time.Minute), logf); got != "NEW_STATE" {
+		t.Errorf("after a known state = %q", got)
+	}
+}
+
+func TestAbsentJobs(t *testing.T) {
+	exp := &Experiment{ID: 1, JobID: "42", JobStatus: "RUNNING", ConfigSnapshot: `{"assume_completed_after":"30m"}`}
+	a := make(absentJobs)
+	var logged []string
+	logf := func(format string, args ...interface{}) { logged = append(logged, format) }
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := a.resolve(exp, "UNKNOWN", start, logf); got != "RUNNING" || len(logged) != 1 {
+		t.Fatalf("first absence = %q, logged %d", got, len(logged))
+	}
+	if got := a.resolve(exp, "UNKNOWN", start.Add(29*time.Minute), logf); got != "RUNNING" || len(logged) != 1 {
+		t.Errorf("within assume_completed_after = %q, logged %d", got, len(logged))
+	}
+	if got := a.resolve(exp, "UNKNOWN", start.Add(30*time.Minute), logf); got != statusCompletedUnconfirmed || len(logged) != 2 {
+		t.Errorf("after assume_completed_after = %q, logged %d", got, len(logged))
+	}
+	if c, ok := jobStateCategory(statusCompletedUnconfirmed); c != jobSuccess || !ok {
+		t.Errorf("%s is %s, %v", statusCompletedUnconfirmed, c, ok)
+	}
+
+	// A state from Slurm starts the clock over.
+	a.resolve(exp, "UNKNOWN", start, logf)
+	a.resolve(exp, "COMPLETING", start.Add(time.Minute), logf)
+	if got := a.resolve(exp, "UNKNOWN", start.Add(31*time.Minute), logf); got != "RUNNING" {
+		t.Errorf("after a known state = %q", got)
+	}
+
+	// Without the policy a vanished job is UNKNOWN at once.
+	exp.ConfigSnapshot = `{}`
+	if got := a.resolve(exp, "UNKNOWN", start, logf); got != "UNKNOWN" {
+		t.Errorf("without assume_completed_after = %q", got)
+	}
+	if err := validateAssumeCompleted("soon"); err == nil {
+		t.Error("invalid assume_completed_after accepted")
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	exp := &Experiment{CreatedAt: created, CompletedAt: created.Add(3*time.Hour + 2*time.Second), Accounting: unknownAccounting()}
+	if d, ok := exp.runDuration(); !ok || d != 3*time.Hour+2*time.Second {
+		t.Errorf("without accounting = %v, %v", d, ok)
+	}
+	exp.Accounting.Start = created.Add(time.Hour)
+	exp.Accounting.End = created.Add(3 * time.Hour)
+	if d, ok := exp.runDuration(); !ok || d != 2*time.Hour {
+		t.Errorf("with sacct's Start and End = %v, %v", d, ok)
+	}
+	if _, ok := (&Experiment{CreatedAt: created}).runDuration(); ok {
+		t.Error("a running job has a duration")
+	}
+	if !isPreemption("RUNNING", "PENDING") || isPreemption("PENDING", "RUNNING") || isPreemption("RUNNING", "COMPLETED") {
+		t.Error("isPreemption misclassified a transition")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// jobRefPrefix marks an experiment reference by Slurm job ID instead of
+// experiment id: job:2723147, or job:2723147:HOST when the same number exists
+// on two clusters. findExperiment accepts these wherever it takes an id.
+const jobRefPrefix = "job:"
+
+// jobRef is the reference --job-id and --remote select, for findExperiment.
+func jobRef(jobID, remote string) string {
+	if remote == "" {
+		return jobRefPrefix + jobID
+	}
+	return jobRefPrefix + jobID + ":" + remote
+}
+
+// experimentArg returns the experiment reference a command was given: its
+// single positional id, or --job-id (with --remote to pick the cluster).
+func experimentArg(positional []string, jobID, remote string) (string, error) {
+	switch {
+	case jobID != "" && len(positional) > 0:
+		return "", fmt.Errorf("give either an experiment id or --job-id, not both")
+	case jobID != "":
+		return jobRef(jobID, remote), nil
+	case remote != "":
+		return "", fmt.Errorf("--remote requires --job-id")
+	case len(positional) != 1:
+		return "", fmt.Errorf("experiment id (or --job-id) is required")
+	}
+	return positional[0], nil
+}
+
+// remoteMatches reports whether an experiment's user@host remote is want,
+// given either in full or as just the host.
+func remoteMatches(remote, want string) bool {
+	if remote == want {
+		return true
+	}
+	_, host, ok := strings.Cut(remote, "@")
+	return ok && host == want
+}
+
+// loadExperimentByJobID returns the experiment that submitted Slurm job
+// jobID. Job IDs are only unique per cluster, so when several experiments
+// match, remote (user@host or host) must pick one.
+func loadExperimentByJobID(db *sql.DB, jobID, remote string) (*Experiment, error) {
+	exps, err := selectExperiments(db, experimentFilter{JobID: jobID})
+	if err != nil {
+		return nil, err
+	}
+	var matched []*Experiment
+	for _, exp := range exps {
+		if remote == "" || remoteMatches(exp.Remote, remote) {
+			matched = append(matched, exp)
+		}
+	}
+	switch {
+	case len(matched) == 1:
+		return matched[0], nil
+	case len(matched) == 0 && remote != "":
+		return nil, fmt.Errorf("no experiment with job ID %s on %s", jobID, remote)
+	case len(matched) == 0:
+		return nil, fmt.Errorf("no experiment with job ID %s", jobID)
+	}
+	candidates := make([]string, len(matched))
+	for i, exp := range matched {
+		candidates[i] = fmt.Sprintf("%d (%s)", exp.ID, exp.Remote)
+	}
+	hint := "pick one with --remote"
+	if remote != "" {
+		hint = "use the experiment id"
+	}
+	return nil, fmt.Errorf("job ID %s matches experiments %s; %s", jobID, strings.Join(candidates, ", "), hint)
+}
+
+// warnDuplicateJob warns when another experiment already records jobID on
+// remote. Slurm does not reuse job IDs on a cluster for a long time, so this
+// usually means the sbatch output was misparsed.
+func warnDuplicateJob(db queryer, remote, jobID string) {
+	rows, err := db.Query(`SELECT id FROM experiments WHERE remote = ? AND job_id = ?`, remote, jobID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, fmt.Sprint(id))
+		}
+	}
+	if len(ids) > 0 {
+		fmt.Printf("Warning: job %s on %s is already recorded as experiment %s; check that the sbatch output was parsed correctly\n",
+			jobID, remote, strings.Join(ids, ", "))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFindExperimentByJobID(t *testing.T) {
+	db := openTestDB(t)
+	a := insertTestExperiment(t, db, "a", "COMPLETED", "")
+	b := insertTestExperiment(t, db, "b", "FAILED", "")
+	c := insertTestExperiment(t, db, "c", "RUNNING", "")
+	for id, row := range map[int64][2]string{a: {"alice@cluster-a", "2723147"}, b: {"alice@cluster-b", "2723147"}, c: {"alice@cluster-a", "99"}} {
+		if _, err := db.Exec(`UPDATE experiments SET remote = ?, job_id = ? WHERE id = ?`, row[0], row[1], id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for ref, want := range map[string]int64{
+		"job:99":                       c,
+		"job:2723147:cluster-b":        b,
+		"job:2723147:alice@cluster-a":  a,
+		jobRef("2723147", "cluster-a"): a,
+		strconv.FormatInt(b, 10):       b,
+	} {
+		exp, err := findExperiment(db, ref)
+		if err != nil || exp.ID != want {
+			t.Errorf("findExperiment(%q) = %v, %v; want experiment %d", ref, exp, err, want)
+		}
+	}
+	for ref, msg := range map[string]string{
+		"job:2723147":           "pick one with --remote",
+		"job:5":                 "no experiment with job ID 5",
+		"job:99:cluster-b":      "no experiment with job ID 99 on cluster-b",
+		"job:2723147:bob@other": "on bob@other",
+	} {
+		if _, err := findExperiment(db, ref); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("findExperiment(%q) = %v; want %q", ref, err, msg)
+		}
+	}
+}
+
+func TestExperimentArg(t *testing.T) {
+	if ref, err := experimentArg(nil, "12", "h"); err != nil || ref != "job:12:h" {
+		t.Errorf("experimentArg(--job-id) = %q, %v", ref, err)
+	}
+	if ref, err := experimentArg([]string{"3"}, "", ""); err != nil || ref != "3" {
+		t.Errorf("experimentArg(id) = %q, %v", ref, err)
+	}
+	for _, bad := range []struct {
+		pos           []string
+		jobID, remote string
+	}{{[]string{"3"}, "12", ""}, {nil, "", "h"}, {nil, "", ""}, {[]string{"1", "2"}, "", ""}} {
+		if _, err := experimentArg(bad.pos, bad.jobID, bad.remote); err == nil {
+			t.Errorf("experimentArg(%v, %q, %q) should fail", bad.pos, bad.jobID, bad.remote)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jobLogDir is where fetched job logs land under the artifact destination.
+const jobLogDir = "logs"
+
+// jobLogGlobs returns quoted remote globs for the job's stdout log, the
+// array-task logs sharing its name, and the matching .err files. Slurm's
+// %A/%a placeholders become wildcards; a plain job ID also matches
+// "<id>_<task>".
+func jobLogGlobs(logPath, jobID string) []string {
+	var paths []string
+	add := func(p string) {
+		if strings.Contains(p, "%") {
+			paths = append(paths, strings.NewReplacer("%A", "*", "%a", "*").Replace(p))
+			return
+		}
+		paths = append(paths, p)
+		if jobID != "" {
+			if i := strings.LastIndex(p, jobID); i >= 0 {
+				paths = append(paths, p[:i+len(jobID)]+"_*"+p[i+len(jobID):])
+			}
+		}
+	}
+	add(logPath)
+	if strings.HasSuffix(logPath, ".out") {
+		add(strings.TrimSuffix(logPath, ".out") + ".err")
+	}
+	globs := make([]string, len(paths))
+	for i, p := range paths {
+		globs[i] = quoteGlob(p)
+	}
+	return globs
+}
+
+// quoteGlob shell-quotes everything in glob except its "*" wildcards.
+func quoteGlob(glob string) string {
+	parts := strings.Split(glob, "*")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = shellQuote(p)
+		}
+	}
+	return strings.Join(parts, "*")
+}
+
+// fetchJobLogs copies every existing log matching the experiment's log path
+// into <destDir>/logs and returns the remote paths copied. No logs on the
+// remote is not an error.
+func fetchJobLogs(exp *Experiment, destDir string) ([]string, error) {
+	if exp.Remote == "" || exp.LogPath == "" {
+		return nil, nil
+	}
+	script := fmt.Sprintf(`for f in %s; do [ -f "$f" ] && printf '%%s\0' "$f"; done; true`, strings.Join(jobLogGlobs(exp.LogPath, exp.JobID), " "))
+	out, err := sshCommand(exp.Remote, exp.SSH, "bash", "-c", shellQuote(script)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list logs on %s: %w", exp.Remote, err)
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, line := range strings.Split(string(out), "\x00") {
+		if line != "" && !seen[line] {
+			seen[line] = true
+			paths = append(paths, line)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	absDest, err := expandLocalPath(destDir)
+	if err != nil {
+		return nil, err
+	}
+	logDir := filepath.Join(absDest, jobLogDir)
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return nil, err
+	}
+	cmd := runCommand("rsync", append(rsyncSSHArgs(exp.SSH), "-a", "--no-relative", "--files-from=-", "--from0", exp.Remote+":/", logDir+"/")...)
+	cmd.Stdin = strings.NewReader(filesFrom0(paths))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("rsync logs: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return paths, nil
+}
+
+// archiveJobLogs fetches the job's logs next to its artifacts and records
+// whether that worked. Failures are warnings: the artifacts matter more.
+func archiveJobLogs(db *sql.DB, exp *Experiment, destDir string) {
+	paths, err := fetchJobLogs(exp, destDir)
+	switch {
+	case err != nil:
+		fmt.Printf("Warning: could not fetch the job log: %v\n", err)
+	case len(paths) == 0:
+		fmt.Printf("Warning: job log %s not found on %s; skipping.\n", exp.LogPath, exp.Remote)
+	default:
+		fmt.Printf("Copied %d log file(s) into %s\n", len(paths), filepath.Join(destDir, jobLogDir))
+	}
+	archived := err == nil && len(paths) > 0
+	if _, err := db.Exec(`UPDATE experiments SET log_archived = ? WHERE id = ?`, boolToInt(archived), exp.ID); err != nil {
+		fmt.Printf("Warning: could not record the log archive state: %v\n", err)
+	}
+	exp.LogArchived = archived
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Experiment locks keep two exp processes (two exp watch terminals, or a
+// watch and the monitor daemon) from polling and syncing the same experiment
+// at once. A lock is a row in the locks table naming its owner; the owner
+// refreshes heartbeat_at while it runs and deletes the row when it exits. A
+// crashed owner stops heartbeating, and its lock can be taken over once the
+// heartbeat is stale, or at once when the owner ran on this host and its
+// process is gone.
+
+const (
+	lockHeartbeatInterval = 30 * time.Second
+	lockStaleAfter        = 2 * time.Minute
+)
+
+// lockOwner identifies a process holding experiment locks.
+type lockOwner struct {
+	PID     int
+	Host    string
+	Command string
+}
+
+// lockCommand names the running exp subcommand for lock owners.
+func lockCommand() string {
+	if len(os.Args) > 1 {
+		return "exp " + os.Args[1]
+	}
+	return "exp"
+}
+
+// currentLockOwner is this process, doing command.
+func currentLockOwner(command string) lockOwner {
+	host, _ := os.Hostname()
+	return lockOwner{PID: os.Getpid(), Host: host, Command: command}
+}
+
+func (o lockOwner) String() string {
+	return fmt.Sprintf("%s (pid %d on %s)", o.Command, o.PID, o.Host)
+}
+
+func (o lockOwner) same(other lockOwner) bool {
+	return o.PID == other.PID && o.Host == other.Host
+}
+
+// lockedError is returned when another live process holds the lock.
+type lockedError struct {
+	ID        int64
+	Owner     lockOwner
+	Heartbeat time.Time
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("experiment %d is already being monitored by %s, last seen %s ago; stop it first, or wait %s for its lock to go stale if it is hung",
+		e.ID, e.Owner, time.Since(e.Heartbeat).Round(time.Second), lockStaleAfter)
+}
+
+// claimExperimentLock takes the lock on experiment id for me, as of now. A
+// lock me already holds is re-claimed; one held by another process is taken
+// over only when it is abandoned.
+func claimExperimentLock(db *sql.DB, id int64, me lockOwner, now time.Time) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var holder lockOwner
+		var heartbeat string
+		err := tx.QueryRow(`SELECT owner_pid, owner_host, command, heartbeat_at FROM locks WHERE experiment_id = ?`, id).
+			Scan(&holder.PID, &holder.Host, &holder.Command, &heartbeat)
+		stamp := now.UTC().Format(time.RFC3339)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return err
+		case holder.same(me):
+			_, err := tx.Exec(`UPDATE locks SET heartbeat_at = ? WHERE experiment_id = ?`, stamp, id)
+			return err
+		default:
+			beat, _ := time.Parse(time.RFC3339, heartbeat)
+			if !lockAbandoned(holder, me, beat, now) {
+				return &lockedError{ID: id, Owner: holder, Heartbeat: beat}
+			}
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO locks (experiment_id, owner_pid, owner_host, command, acquired_at, heartbeat_at)
+         VALUES (?, ?, ?, ?, ?, ?)`, id, me.PID, me.Host, me.Command, stamp, stamp)
+		return err
+	})
+}
+
+// lockAbandoned reports whether holder's lock may be taken over.
+func lockAbandoned(holder, me lockOwner, heartbeat, now time.Time) bool {
+	if now.Sub(heartbeat) > lockStaleAfter {
+		return true
+	}
+	return holder.Host == me.Host && !processAlive(holder.PID)
+}
+
+// heartbeatLocks refreshes every lock owner holds and returns how many rows
+// it still owns.
+func heartbeatLocks(db *sql.DB, owner lockOwner, now time.Time) (int64, error) {
+	res, err := db.Exec(`UPDATE locks SET heartbeat_at = ? WHERE owner_pid = ? AND owner_host = ?`,
+		now.UTC().Format(time.RFC3339), owner.PID, owner.Host)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// releaseOwnerLocks drops every lock owner holds.
+func releaseOwnerLocks(db *sql.DB, owner lockOwner) error {
+	_, err := db.Exec(`DELETE FROM locks WHERE owner_pid = ? AND owner_host = ?`, owner.PID, owner.Host)
+	return err
+}
+
+// releaseExperimentLock drops owner's lock on id; a lock taken over in the
+// meantime is left alone.
+func releaseExperimentLock(db *sql.DB, id int64, owner lockOwner) error {
+	_, err := db.Exec(`DELETE FROM locks WHERE experiment_id = ? AND owner_pid = ? AND owner_host = ?`, id, owner.PID, owner.Host)
+	return err
+}
+
+// experimentLock is a held lock kept alive by a background heartbeat, for
+// commands that watch a single experiment.
+type experimentLock struct {
+	db    *sql.DB
+	id    int64
+	owner lockOwner
+	lost  atomic.Bool
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// lockExperiment claims the lock on experiment id for this process and
+// starts heartbeating it.
+func lockExperiment(db *sql.DB, id int64, command string) (*experimentLock, error) {
+	l := &experimentLock{db: db, id: id, owner: currentLockOwner(command), stop: make(chan struct{})}
+	if err := claimExperimentLock(db, id, l.owner, time.Now()); err != nil {
+		return nil, err
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(lockHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case now := <-ticker.C:
+				if n, err := heartbeatLocks(db, l.owner, now); err == nil && n == 0 {
+					l.lost.Store(true)
+					return
+				}
+			}
+		}
+	}()
+	return l, nil
+}
+
+// Lost reports whether another process took the lock over, which happens
+// when this one stopped heartbeating for longer than lockStaleAfter (a
+// suspended laptop, say).
+func (l *experimentLock) Lost() bool {
+	return l.lost.Load()
+}
+
+// Release stops the heartbeat and drops the lock.
+func (l *experimentLock) Release() {
+	close(l.stop)
+	l.wg.Wait()
+	if err := releaseExperimentLock(l.db, l.id, l.owner); err != nil {
+		fmt.Printf("Warning: unable to release the lock on experiment %d: %v\n", l.id, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExperimentLockTakeover(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "e", "RUNNING", "")
+	now := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	laptop := lockOwner{PID: 4100, Host: "laptop", Command: "exp watch"}
+	desktop := lockOwner{PID: 4200, Host: "desktop", Command: "exp watch"}
+
+	if err := claimExperimentLock(db, id, laptop, now); err != nil {
+		t.Fatal(err)
+	}
+	// Claiming again is a heartbeat.
+	if err := claimExperimentLock(db, id, laptop, now.Add(time.Minute)); err != nil {
+		t.Fatalf("re-claim by the owner: %v", err)
+	}
+
+	err := claimExperimentLock(db, id, desktop, now.Add(2*time.Minute))
+	var le *lockedError
+	if !errors.As(err, &le) || le.Owner != laptop || !strings.Contains(err.Error(), "exp watch (pid 4100 on laptop)") {
+		t.Fatalf("claim of a live lock = %v", err)
+	}
+
+	// The laptop goes to sleep: its heartbeat goes stale and the desktop
+	// takes over.
+	stale := now.Add(time.Minute + lockStaleAfter + time.Second)
+	if err := claimExperimentLock(db, id, desktop, stale); err != nil {
+		t.Fatalf("takeover of a stale lock: %v", err)
+	}
+	if n, err := heartbeatLocks(db, laptop, stale.Add(time.Second)); err != nil || n != 0 {
+		t.Errorf("heartbeat of the displaced owner = %d, %v; want 0 rows", n, err)
+	}
+	if err := releaseExperimentLock(db, id, laptop); err != nil {
+		t.Fatal(err)
+	}
+	var holder string
+	if err := db.QueryRow(`SELECT owner_host FROM locks WHERE experiment_id = ?`, id).Scan(&holder); err != nil || holder != "desktop" {
+		t.Errorf("lock holder after the displaced owner released = %q, %v", holder, err)
+	}
+}
+
+func TestExperimentLockDeadProcess(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "e", "RUNNING", "")
+	me := currentLockOwner("exp watch")
+	crashed := lockOwner{PID: 999999999, Host: me.Host, Command: "exp watch"}
+	now := time.Now()
+	if err := claimExperimentLock(db, id, crashed, now); err != nil {
+		t.Fatal(err)
+	}
+	// A crashed process on this host does not hold its lock until it goes
+	// stale.
+	l, err := lockExperiment(db, id, "exp watch")
+	if err != nil {
+		t.Fatalf("takeover from a dead process: %v", err)
+	}
+	if l.Lost() {
+		t.Error("fresh lock reported lost")
+	}
+	l.Release()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM locks`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("locks after release = %d, %v", n, err)
+	}
+}
+
+func TestMonitorDaemonSkipsLockedExperiment(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "e", "RUNNING", "")
+	now := time.Now()
+	watcher := lockOwner{PID: 4100, Host: "elsewhere", Command: "exp watch"}
+	if err := claimExperimentLock(db, id, watcher, now); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newMonitorDaemon(db, time.Minute)
+	queries := 0
+	d.query = func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		queries++
+		return map[string]jobState{"42": {Status: "RUNNING"}}, nil
+	}
+	d.pass(context.Background(), now, true)
+	if queries != 0 {
+		t.Fatalf("daemon polled an experiment exp watch holds")
+	}
+	// The watcher died without releasing; once its heartbeat is stale the
+	// daemon takes over.
+	d.pass(context.Background(), now.Add(lockStaleAfter+time.Minute), true)
+	if queries != 1 {
+		t.Fatalf("daemon did not take over a stale lock (%d queries)", queries)
+	}
+	var pid int
+	if err := db.QueryRow(`SELECT owner_pid FROM locks WHERE experiment_id = ?`, id).Scan(&pid); err != nil || pid != d.owner.PID {
+		t.Errorf("lock owner = %d, %v", pid, err)
+	}
+}
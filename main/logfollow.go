@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exp run --follow-log and exp watch --follow-log stream the job's log while
+// the monitor polls, as tail -F in another window would. The log lines and
+// the monitor's status lines share one writer, so neither cuts into the
+// other.
+
+const (
+	// logFollowGrace is how long the log must stay quiet after the job ends
+	// before the follower stops: Slurm may still be flushing it.
+	logFollowGrace = 5 * time.Second
+	// logFollowMaxDrain bounds that wait for a log that keeps growing.
+	logFollowMaxDrain = time.Minute
+	// logLineMax is how much of one log line is printed.
+	logLineMax = 64 << 10
+)
+
+// logFollowPolicy paces reconnecting after the stream broke. There is no
+// last attempt: the follower tries for as long as the job is monitored.
+var logFollowPolicy = retryPolicy{Initial: 2 * time.Second, Max: time.Minute}
+
+// logFollower streams a remote log to out, one prefixed line at a time.
+type logFollower struct {
+	remote  string
+	sshOpts sshHostOptions
+	path    string
+	out     *syncWriter
+	prefix  string
+
+	mu      sync.Mutex
+	lines   int       // lines printed so far; a reconnect resumes after them
+	newest  string    // the last line printed
+	last    time.Time // when the stream last connected or printed a line
+	stopped bool
+	stdin   *os.File   // closing it ends the remote tail
+	cmd     *loggedCmd // the ssh session of the current stream
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startLogFollower starts streaming path on remote to out.
+func startLogFollower(remote string, sshOpts sshHostOptions, path string, out *syncWriter) *logFollower {
+	prefix := "| "
+	if isTerminal(os.Stdout) {
+		prefix = "\033[2m│\033[0m "
+	}
+	f := &logFollower{
+		remote:  remote,
+		sshOpts: sshOpts,
+		path:    path,
+		out:     out,
+		prefix:  prefix,
+		last:    time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+func (f *logFollower) run() {
+	defer close(f.done)
+	for failures := 0; ; {
+		streamed, output, err := f.stream()
+		if f.isStopped() {
+			return
+		}
+		if streamed {
+			failures = 0
+		}
+		if err != nil {
+			if class := classifySSHError(err, output); !class.transient() {
+				first, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+				fmt.Fprintf(f.out, "log: following %s failed: %v (%s: %s); no longer following it\n",
+					f.path, err, class, first)
+				return
+			}
+		}
+		failures++
+		wait := logFollowPolicy.delay(failures)
+		fmt.Fprintf(f.out, "log: lost the stream of %s; reconnecting in %s\n", f.path, wait)
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// stream runs one tail -F, from the first line not printed yet, until it
+// ends. The remote shell kills tail once our end of its stdin closes, which
+// close does, so no tail is left behind on the login node.
+func (f *logFollower) stream() (streamed bool, output string, err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return false, "", err
+	}
+	defer w.Close()
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		r.Close()
+		return false, "", nil
+	}
+	from := f.lines + 1
+	f.stdin = w
+	f.last = time.Now()
+	f.mu.Unlock()
+
+	// tail's own stdin is /dev/null, as for any background command of a
+	// script, so a watcher reads ours from fd 3. The script exits with tail's
+	// status when tail fails by itself.
+	script := fmt.Sprintf("exec 3<&0; tail -n +%d -F %s </dev/null & t=$!; (cat <&3; kill $t) >/dev/null 2>&1 & w=$!; wait $t; s=$?; kill $w 2>/dev/null; exit $s",
+		from, shellQuote(f.path))
+	cmd := sshCommand(f.remote, f.sshOpts, "sh", "-c", shellQuote(script)).withTimeout(0)
+	cmd.Stdin = r
+	stderr := &cappedBuffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		r.Close()
+		return false, "", err
+	}
+	err = cmd.Start()
+	r.Close()
+	if err != nil {
+		return false, stderr.String(), err
+	}
+	f.mu.Lock()
+	f.cmd = cmd
+	f.mu.Unlock()
+	reader := bufio.NewReaderSize(stdout, logLineMax)
+	for {
+		line, cut, rerr := readLogLine(reader)
+		if rerr != nil && len(line) == 0 && cut == 0 {
+			break
+		}
+		// One write per line, whole, through the shared writer.
+		if cut > 0 {
+			fmt.Fprintf(f.out, "%s%s... (%s cut)\n", f.prefix, line, formatBytes(cut))
+		} else {
+			fmt.Fprintf(f.out, "%s%s\n", f.prefix, line)
+		}
+		f.mu.Lock()
+		f.lines++
+		f.newest = string(line)
+		f.last = time.Now()
+		f.mu.Unlock()
+		streamed = true
+		if rerr != nil {
+			break
+		}
+	}
+	// The stream ended; an ssh session whose stdin is still open would
+	// not finish.
+	w.Close()
+	err = cmd.Wait()
+	f.mu.Lock()
+	f.cmd = nil
+	f.mu.Unlock()
+	return streamed, stderr.String(), err
+}
+
+// readLogLine reads one line of the log, without its line ending. A
+// progress bar redraws its line with \r, so only the text after the last
+// \r is kept, as a terminal would show it; past logLineMax bytes the rest
+// of the line is dropped and counted in cut. Lines still end only at \n,
+// the way tail -n +N counts them on a reconnect.
+func readLogLine(r *bufio.Reader) (line []byte, cut int64, err error) {
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+		}
+		line = append(line, chunk...)
+		if len(line) > 1 {
+			if i := bytes.LastIndexByte(line[:len(line)-1], '\r'); i >= 0 {
+				line = append(line[:0], line[i+1:]...)
+				cut = 0
+			}
+		}
+		if len(line) > logLineMax {
+			cut += int64(len(line) - logLineMax)
+			line = line[:logLineMax]
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		return line, cut, err
+	}
+}
+
+// lastLine is the newest line of the log printed so far.
+func (f *logFollower) lastLine() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.newest
+}
+
+func (f *logFollower) isStopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopped
+}
+
+// close stops following once the log has been quiet for grace, or after
+// logFollowMaxDrain at the latest, and waits until the stream is gone; a
+// session that does not end by itself within logFollowGrace is killed. A
+// grace of 0 stops right away.
+func (f *logFollower) close(grace time.Duration) {
+	deadline := time.Now().Add(logFollowMaxDrain)
+	for grace > 0 && time.Now().Before(deadline) {
+		f.mu.Lock()
+		quiet := time.Since(f.last)
+		f.mu.Unlock()
+		if quiet >= grace {
+			break
+		}
+		time.Sleep(grace - quiet)
+	}
+	f.mu.Lock()
+	f.stopped = true
+	if f.stdin != nil {
+		f.stdin.Close()
+	}
+	cmd := f.cmd
+	f.mu.Unlock()
+	close(f.stop)
+	select {
+	case <-f.done:
+	case <-time.After(logFollowGrace):
+		if cmd != nil {
+			cmd.Kill()
+		}
+		<-f.done
+	}
+}
+
+// jobStarted reports whether a job in status has left the queue, so Slurm has
+// created its log.
+func jobStarted(status string) bool {
+	switch normalizeStatus(status) {
+	case "", "SUBMITTED", "PENDING":
+		return false
+	}
+	return true
+}
+
+// hold runs f while no one else may write, for output that does not go
+// through s, such as a sync's. The status line steps aside meanwhile.
+func (s *syncWriter) hold(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != "" {
+		fmt.Fprint(s.w, "\r\033[K")
+		defer fmt.Fprint(s.w, s.status)
+	}
+	f()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// droppingExecutor runs commands locally like localExecutor, but drops the
+// first connection after a moment, as a VPN blip would.
+type droppingExecutor struct {
+	localExecutor
+	dropped bool
+}
+
+func (e *droppingExecutor) Command(remote string, _ sshHostOptions, args ...string) *loggedCmd {
+	if e.dropped {
+		return e.localExecutor.Command(remote, sshHostOptions{}, args...)
+	}
+	e.dropped = true
+	line := strings.Join(args, " ")
+	e.calls = append(e.calls, line)
+	// The remote side sees its stdin close, as when sshd goes away.
+	return runCommand("sh", "-c", "sleep 0.5 | ("+line+"); echo 'Connection reset by peer' >&2; exit 255")
+}
+
+func TestLogFollowerResumesAfterDrop(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	exec := &droppingExecutor{}
+	remoteExecutor = exec
+	useTestMux(t, nil)
+	savedPolicy := logFollowPolicy
+	logFollowPolicy.Initial = 10 * time.Millisecond
+	t.Cleanup(func() { logFollowPolicy = savedPolicy })
+
+	log := filepath.Join(t.TempDir(), "train-42.out")
+	os.WriteFile(log, []byte("epoch 1\nepoch 2\n"), 0o644)
+	var buf bytes.Buffer
+	out := &syncWriter{w: &buf}
+	printed := func() string {
+		var s string
+		out.hold(func() { s = buf.String() })
+		return s
+	}
+	waitFor := func(text string) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); !strings.Contains(printed(), text); {
+			if time.Now().After(deadline) {
+				t.Fatalf("never printed %q; got:\n%s", text, printed())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	f := startLogFollower("u@h", sshHostOptions{}, log, out)
+	waitFor("| epoch 2\n")
+	waitFor("reconnecting")
+	fh, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	fh.WriteString("epoch 3\n")
+	fh.Close()
+	waitFor("| epoch 3\n")
+	f.close(0)
+
+	got := printed()
+	if strings.Count(got, "epoch 1") != 1 || strings.Count(got, "epoch 2") != 1 {
+		t.Errorf("lines repeated after reconnecting:\n%s", got)
+	}
+	if len(exec.calls) < 2 || !strings.Contains(exec.calls[1], "tail -n +3 -F") {
+		t.Errorf("reconnect did not resume after the printed lines: %q", exec.calls)
+	}
+}
+
+func TestLogFollowerGivesUpOnFailingTail(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "tail"), []byte("#!/bin/sh\necho \"tail: option -F not supported\" >&2; exit 1\n"), 0o755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var buf bytes.Buffer
+	out := &syncWriter{w: &buf}
+	f := startLogFollower("u@h", sshHostOptions{}, "/logs/x.out", out)
+	select {
+	case <-f.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("follower kept retrying a tail that cannot work")
+	}
+	f.close(0)
+	if got := buf.String(); !strings.Contains(got, "no longer following") || !strings.Contains(got, "option -F not supported") {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestLogFollowerLongLines(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+
+	log := filepath.Join(t.TempDir(), "train-42.out")
+	data := "epoch 1\n" + strings.Repeat("x", 2<<20) + "\n" +
+		"step 1/3\rstep 2/3\rstep 3/3\r\n" + "epoch 2\n"
+	os.WriteFile(log, []byte(data), 0o644)
+	var buf bytes.Buffer
+	out := &syncWriter{w: &buf}
+	printed := func() string {
+		var s string
+		out.hold(func() { s = buf.String() })
+		return s
+	}
+
+	f := startLogFollower("u@h", sshHostOptions{}, log, out)
+	for deadline := time.Now().Add(10 * time.Second); !strings.Contains(printed(), "| epoch 2\n"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("stopped following after a long line; got %d bytes", len(printed()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.close(0)
+
+	got := printed()
+	if want := "| " + strings.Repeat("x", logLineMax) + "... (" + formatBytes(2<<20-logLineMax) + " cut)\n"; !strings.Contains(got, want) {
+		t.Errorf("long line not cut to %d bytes", logLineMax)
+	}
+	if !strings.Contains(got, "| step 3/3\n") || strings.Contains(got, "step 1/3") {
+		t.Errorf("progress line not printed as its last redraw")
+	}
+	if f.lines != 4 {
+		t.Errorf("lines = %d, want 4 so a reconnect resumes at tail -n +5", f.lines)
+	}
+}
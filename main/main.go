@@ -7,14 +7,20 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	_ "modernc.org/sqlite" // SQLite driver (pure Go)
 )
@@ -23,8 +29,9 @@ type Experiment struct {
 	ID          int64
 	Name        string
 	Remote      string
+	Cluster     string // the Slurm cluster the job was submitted to with -M; empty for the login node's own
 	ScriptPath  string
-	Args        string
+	Args        string // shell words, for display
 	GitCommit   string
 	GitBranch   string
 	JobID       string
@@ -33,21 +40,53 @@ type Experiment struct {
 	CreatedAt   time.Time
 	CompletedAt time.Time
 
-	ArtifactRemote     string
-	ArtifactDest       string
-	ArtifactSources    []ArtifactSource
-	ArtifactPattern    string
-	ArtifactSinceStart bool
-	ArtifactLastSync   time.Time
-	ArtifactLastError  string
+	// ArgList is the exact argument list; ArgsApproximate is set when it was
+	// recovered by splitting Args on whitespace.
+	ArgList         []string
+	ArgsApproximate bool
+
+	ArtifactRemote      string
+	ArtifactDest        string
+	ArtifactSources     []ArtifactSource
+	ArtifactPattern     string
+	ArtifactSinceStart  bool
+	ArtifactLastSync    time.Time
+	ArtifactLastError   string
+	ArtifactSyncStats   syncStats // from the last successful sync
+	ArtifactEverMatched bool      // some sync in sync_history matched files
+	LogArchived         bool      // job log copied into <ArtifactDest>/logs
+	ArtifactSize        int64     // cached size of ArtifactDest, see cachedArtifactSize
+	ArtifactSizeAt      time.Time // when ArtifactSize was measured; zero if never
+
+	Tags []string
 
 	ConfigSnapshot string
+	SSH            sshHostOptions // how the run reached its hosts, from the snapshot
+	ArchivePath    string
+	RequeueCount   int
+	PreemptCount   int // times the job was seen going from RUNNING back to the queue
+
+	Accounting jobAccounting // final sacct record, stored on completion
+	Efficiency seffReport    // seff's report, with capture_seff
+
+	// JobCategory says whether the job is active or how it ended; JobReason
+	// explains an ending that was not a success.
+	JobCategory jobCategory
+	JobReason   string
+
+	// PendingReason and PendingStart are what squeue --start last said
+	// about a pending job (see pendingChecks).
+	PendingReason string
+	PendingStart  time.Time
+	StalledReason string // an actionable PendingReason that held for stall_after
+
+	Progress jobProgress // the newest log line progress_regex matched
 }
 
 const (
 	defaultPollInterval   = 30 * time.Second
 	sinceStartGracePeriod = 2 * time.Minute
-	artifactSettleDelay   = 10 * time.Second
+	defaultSettleDelay    = 10 * time.Second
 )
 
 type boolFlag struct {
@@ -73,6 +112,50 @@ func (b *boolFlag) IsBoolFlag() bool {
 	return true
 }
 
+// looseInt decodes from a JSON number or a numeric string, since the YAML
+// reader leaves unquoted numbers as strings.
+type looseInt int
+
+func (n *looseInt) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "" || text == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*n = looseInt(v)
+	return nil
+}
+
+// looseString decodes from a JSON string or number, so a setting such as
+// bwlimit: 1000 may be written without quotes in JSON and TOML too.
+type looseString string
+
+func (s *looseString) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	switch {
+	case text == "null":
+		*s = ""
+		return nil
+	case strings.HasPrefix(text, `"`):
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*s = looseString(v)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected a string or a number, got %s", data)
+	}
+	*s = looseString(n)
+	return nil
+}
+
 type multiStringFlag struct {
 	values []string
 }
@@ -90,6 +173,28 @@ func (m *multiStringFlag) Values() []string {
 	return append([]string(nil), m.values...)
 }
 
+// parseInterspersed parses flags that may appear before or after positional
+// arguments (exp open 12 --cd) and returns the positionals in order. Anything
+// after a literal "--" is returned verbatim.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		consumed := args[:len(args)-len(rest)]
+		if len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
 type durationFlag struct {
 	value time.Duration
 	set   bool
@@ -110,90 +215,395 @@ func (d *durationFlag) String() string {
 }
 
 type Config struct {
-	Defaults RunProfile            `json:"defaults"`
-	Profiles map[string]RunProfile `json:"profiles"`
-	path     string                `json:"-"`
+	Defaults  RunProfile            `json:"defaults"`
+	Profiles  map[string]RunProfile `json:"profiles"`
+	Report    ReportConfig          `json:"report"`
+	Retention RetentionConfig       `json:"retention"`
+	// DebugLog is where to record every external command run, as with
+	// --debug-log.
+	DebugLog string `json:"debug_log"`
+	// SSHBackend is system (run the ssh binary, the default) or native;
+	// see remote.go.
+	SSHBackend string `json:"ssh_backend"`
+	// SSHIdentityFiles are the native backend's key files.
+	SSHIdentityFiles []string `json:"ssh_identity_files"`
+	// SSHConnectTimeout, CommandTimeout and TransferTimeout are durations
+	// overriding the deadlines in timeouts.go.
+	SSHConnectTimeout looseString `json:"ssh_connect_timeout"`
+	CommandTimeout    looseString `json:"command_timeout"`
+	TransferTimeout   looseString `json:"transfer_timeout"`
+	// OnStateChange is a local program to run when an experiment is queued,
+	// starts or finishes, or its artifacts fail to sync; see hooks.go.
+	OnStateChange string `json:"on_state_change"`
+	// MonitorHeartbeat is how often a monitor writing to a log says the
+	// job is still in the same state; see monitor_display.go.
+	MonitorHeartbeat looseString `json:"monitor_heartbeat"`
+	// MaxConcurrentPolls caps the job status queries running on one host
+	// at a time; see poll_limit.go.
+	MaxConcurrentPolls *looseInt `json:"max_concurrent_polls"`
+	path               string    `json:"-"`
+}
+
+// ReportConfig customizes exp report. Template paths override the built-in
+// Markdown/HTML templates so groups can brand their reports.
+type ReportConfig struct {
+	MarkdownTemplate string `json:"markdown_template"`
+	HTMLTemplate     string `json:"html_template"`
+	InlinePattern    string `json:"inline_pattern"`
+	InlineMaxBytes   int64  `json:"inline_max_bytes"`
 }
 
 type RunProfile struct {
-	Remote             string           `json:"remote"`
-	LogDir             string           `json:"log_dir"`
-	Script             string           `json:"script"`
-	BuildScript        string           `json:"build_script"`
-	ArtifactSources    []ArtifactSource `json:"artifact_sources"`
-	ArtifactPatterns   []string         `json:"artifact_patterns"`
-	ArtifactRemote     string           `json:"artifact_remote"`
-	ArtifactDest       string           `json:"artifact_dest"`
-	ArtifactPattern    string           `json:"artifact_pattern"`
-	ArtifactSinceStart *bool            `json:"artifact_since_start"`
-	PollInterval       string           `json:"poll_interval"`
+	Remote               string           `json:"remote"`
+	LogDir               string           `json:"log_dir"`
+	Script               string           `json:"script"`
+	BuildScript          string           `json:"build_script"`
+	ArtifactSources      []ArtifactSource `json:"artifact_sources"`
+	ArtifactPatterns     []string         `json:"artifact_patterns"`
+	ArtifactRemote       string           `json:"artifact_remote"`
+	ArtifactDest         string           `json:"artifact_dest"`
+	ArtifactPattern      string           `json:"artifact_pattern"`
+	ArtifactSinceStart   *bool            `json:"artifact_since_start"`
+	PollInterval         string           `json:"poll_interval"`
+	Metrics              []MetricSpec     `json:"metrics"`
+	PatternSyntax        string           `json:"pattern_syntax"`
+	MinSize              looseString      `json:"min_size"`
+	MaxSize              looseString      `json:"max_size"`
+	BWLimit              looseString      `json:"bwlimit"`
+	Compress             *bool            `json:"compress"`
+	CompressLevel        looseInt         `json:"compress_level"`
+	Parallel             looseInt         `json:"parallel"`
+	FlatArtifacts        *bool            `json:"flat_artifacts"`
+	RsyncRetries         *looseInt        `json:"rsync_retries"`
+	RsyncBackoff         string           `json:"rsync_backoff"`
+	ListRetries          *looseInt        `json:"list_retries"`
+	ListRetryDelay       string           `json:"list_retry_delay"`
+	FallbackNoTimeFilter *bool            `json:"fallback_no_time_filter"`
+	Checksum             *bool            `json:"checksum"`
+	CaptureSeff          *bool            `json:"capture_seff"`
+	NotifyLocal          *bool            `json:"notify_local"`
+	ConfirmOver          looseString      `json:"confirm_over"`
+	DeferLargeSync       *bool            `json:"defer_large_sync"`
+	SyncInterval         string           `json:"sync_interval"`
+	TransferRemote       string           `json:"transfer_remote"`
+	SettleDelay          string           `json:"settle_delay"`
+	SettleMaxWait        string           `json:"settle_max_wait"`
+	AssumeCompletedAfter string           `json:"assume_completed_after"`
+	PendingCheckInterval string           `json:"pending_check_interval"`
+	StallAfter           string           `json:"stall_after"`
+	Cluster              string           `json:"cluster"`
+	ProgressRegex        string           `json:"progress_regex"`
+	MaxMonitor           string           `json:"max_monitor"`
+	SSHIdentity          string           `json:"ssh_identity"`
+	SSHPort              looseInt         `json:"ssh_port"`
+	SSHProxyJump         string           `json:"ssh_proxy_jump"`
+	SSHOptions           []string         `json:"ssh_options"`
 }
 
 type RunConfigFile struct {
-	Profile            string           `json:"profile"`
-	Name               string           `json:"name"`
-	Remote             string           `json:"remote"`
-	LogDir             string           `json:"log_dir"`
-	Script             string           `json:"script"`
-	BuildScript        string           `json:"build_script"`
-	ScriptLocal        string           `json:"script_local"`
-	ArtifactRemote     string           `json:"artifact_remote"`
-	ArtifactDest       string           `json:"artifact_dest"`
-	ArtifactSources    []ArtifactSource `json:"artifact_sources"`
-	ArtifactPatterns   []string         `json:"artifact_patterns"`
-	ArtifactPattern    string           `json:"artifact_pattern"`
-	ArtifactSinceStart *bool            `json:"artifact_since_start"`
-	PollInterval       string           `json:"poll_interval"`
-	Args               []string         `json:"args"`
+	Profile              string           `json:"profile"`
+	Name                 string           `json:"name"`
+	Remote               string           `json:"remote"`
+	LogDir               string           `json:"log_dir"`
+	Script               string           `json:"script"`
+	BuildScript          string           `json:"build_script"`
+	BuildScriptInline    string           `json:"build_script_inline"`
+	ScriptLocal          string           `json:"script_local"`
+	ArtifactRemote       string           `json:"artifact_remote"`
+	ArtifactDest         string           `json:"artifact_dest"`
+	ArtifactSources      []ArtifactSource `json:"artifact_sources"`
+	ArtifactPatterns     []string         `json:"artifact_patterns"`
+	ArtifactPattern      string           `json:"artifact_pattern"`
+	ArtifactSinceStart   *bool            `json:"artifact_since_start"`
+	PollInterval         string           `json:"poll_interval"`
+	Metrics              []MetricSpec     `json:"metrics"`
+	PatternSyntax        string           `json:"pattern_syntax"`
+	MinSize              looseString      `json:"min_size"`
+	MaxSize              looseString      `json:"max_size"`
+	BWLimit              looseString      `json:"bwlimit"`
+	Compress             *bool            `json:"compress"`
+	CompressLevel        looseInt         `json:"compress_level"`
+	Parallel             looseInt         `json:"parallel"`
+	FlatArtifacts        *bool            `json:"flat_artifacts"`
+	RsyncRetries         *looseInt        `json:"rsync_retries"`
+	RsyncBackoff         string           `json:"rsync_backoff"`
+	ListRetries          *looseInt        `json:"list_retries"`
+	ListRetryDelay       string           `json:"list_retry_delay"`
+	FallbackNoTimeFilter *bool            `json:"fallback_no_time_filter"`
+	Checksum             *bool            `json:"checksum"`
+	CaptureSeff          *bool            `json:"capture_seff"`
+	NotifyLocal          *bool            `json:"notify_local"`
+	ConfirmOver          looseString      `json:"confirm_over"`
+	DeferLargeSync       *bool            `json:"defer_large_sync"`
+	SyncInterval         string           `json:"sync_interval"`
+	TransferRemote       string           `json:"transfer_remote"`
+	SettleDelay          string           `json:"settle_delay"`
+	SettleMaxWait        string           `json:"settle_max_wait"`
+	AssumeCompletedAfter string           `json:"assume_completed_after"`
+	PendingCheckInterval string           `json:"pending_check_interval"`
+	StallAfter           string           `json:"stall_after"`
+	Cluster              string           `json:"cluster"`
+	ProgressRegex        string           `json:"progress_regex"`
+	MaxMonitor           string           `json:"max_monitor"`
+	SSHIdentity          string           `json:"ssh_identity"`
+	SSHPort              looseInt         `json:"ssh_port"`
+	SSHProxyJump         string           `json:"ssh_proxy_jump"`
+	SSHOptions           []string         `json:"ssh_options"`
+	Args                 []string         `json:"args"`
 }
 
 type RunSnapshot struct {
-	Name               string           `json:"name"`
-	Remote             string           `json:"remote"`
-	LogDir             string           `json:"log_dir"`
-	Script             string           `json:"script"`
-	BuildScript        string           `json:"build_script,omitempty"`
-	ArtifactRemote     string           `json:"artifact_remote"`
-	ArtifactDest       string           `json:"artifact_dest"`
-	ArtifactPatterns   []string         `json:"artifact_patterns,omitempty"`
-	ArtifactSources    []ArtifactSource `json:"artifact_sources,omitempty"`
-	ArtifactPattern    string           `json:"artifact_pattern"`
-	ArtifactSinceStart bool             `json:"artifact_since_start"`
-	PollInterval       string           `json:"poll_interval"`
-	Args               []string         `json:"args"`
-	ConfigFile         string           `json:"config_file,omitempty"`
-	Profile            string           `json:"profile,omitempty"`
-	GitCommit          string           `json:"git_commit,omitempty"`
-	GitBranch          string           `json:"git_branch,omitempty"`
+	Name                 string           `json:"name"`
+	Remote               string           `json:"remote"`
+	LogDir               string           `json:"log_dir"`
+	Script               string           `json:"script"`
+	BuildScript          string           `json:"build_script,omitempty"`
+	BuildScriptInline    string           `json:"build_script_inline,omitempty"`
+	ArtifactRemote       string           `json:"artifact_remote"`
+	ArtifactDest         string           `json:"artifact_dest"`
+	ArtifactPatterns     []string         `json:"artifact_patterns,omitempty"`
+	ArtifactSources      []ArtifactSource `json:"artifact_sources,omitempty"`
+	ArtifactPattern      string           `json:"artifact_pattern"`
+	PatternSyntax        string           `json:"pattern_syntax,omitempty"`
+	MinSize              string           `json:"min_size,omitempty"`
+	MaxSize              string           `json:"max_size,omitempty"`
+	BWLimit              string           `json:"bwlimit,omitempty"`
+	Compress             *bool            `json:"compress,omitempty"`
+	CompressLevel        int              `json:"compress_level,omitempty"`
+	Parallel             int              `json:"parallel,omitempty"`
+	ArtifactLayout       string           `json:"artifact_layout,omitempty"`
+	RsyncRetries         *int             `json:"rsync_retries,omitempty"`
+	RsyncBackoff         string           `json:"rsync_backoff,omitempty"`
+	ListRetries          *int             `json:"list_retries,omitempty"`
+	ListRetryDelay       string           `json:"list_retry_delay,omitempty"`
+	FallbackNoTimeFilter bool             `json:"fallback_no_time_filter,omitempty"`
+	Checksum             bool             `json:"checksum,omitempty"`
+	CaptureSeff          bool             `json:"capture_seff,omitempty"`
+	NotifyLocal          bool             `json:"notify_local,omitempty"`
+	ConfirmOver          string           `json:"confirm_over,omitempty"`
+	DeferLargeSync       bool             `json:"defer_large_sync,omitempty"`
+	SyncInterval         string           `json:"sync_interval,omitempty"`
+	TransferRemote       string           `json:"transfer_remote,omitempty"`
+	SettleDelay          string           `json:"settle_delay,omitempty"`
+	SettleMaxWait        string           `json:"settle_max_wait,omitempty"`
+	AssumeCompletedAfter string           `json:"assume_completed_after,omitempty"`
+	PendingCheckInterval string           `json:"pending_check_interval,omitempty"`
+	StallAfter           string           `json:"stall_after,omitempty"`
+	Cluster              string           `json:"cluster,omitempty"`
+	ProgressRegex        string           `json:"progress_regex,omitempty"`
+	MaxMonitor           string           `json:"max_monitor,omitempty"`
+	SSHIdentity          string           `json:"ssh_identity,omitempty"`
+	SSHPort              int              `json:"ssh_port,omitempty"`
+	SSHProxyJump         string           `json:"ssh_proxy_jump,omitempty"`
+	SSHOptions           []string         `json:"ssh_options,omitempty"`
+	ArtifactSinceStart   bool             `json:"artifact_since_start"`
+	PollInterval         string           `json:"poll_interval"`
+	Metrics              []MetricSpec     `json:"metrics,omitempty"`
+	Args                 []string         `json:"args"`
+	ConfigFile           string           `json:"config_file,omitempty"`
+	Profile              string           `json:"profile,omitempty"`
+	GitCommit            string           `json:"git_commit,omitempty"`
+	GitBranch            string           `json:"git_branch,omitempty"`
 }
 
 type ArtifactSource struct {
-	Path     string   `json:"path"`
-	Patterns []string `json:"artifact_patterns"`
+	Name          string   `json:"name,omitempty"`
+	Path          string   `json:"path"`
+	Patterns      []string `json:"artifact_patterns"`
+	PatternSyntax string   `json:"pattern_syntax,omitempty"`
+	// Flatten drops remote directories so every file lands directly in the
+	// source's destination.
+	Flatten bool `json:"flatten,omitempty"`
+	// Symlinks is "follow" to fetch what symlinks point at, "preserve" to
+	// fetch them as links, or empty to skip them.
+	Symlinks string `json:"symlinks,omitempty"`
+	// Remote is the user@host to list and rsync this source from when the
+	// files live on another machine than the one jobs are submitted to.
+	Remote string `json:"remote,omitempty"`
+	// PruneDirs names directories the remote listing never descends into.
+	// They match directory basenames (find -name, so globs such as "wandb-*"
+	// work) at any depth and may not contain a "/".
+	PruneDirs []string `json:"prune_dirs,omitempty"`
+}
+
+// host returns the user@host this source is fetched from: its own Remote,
+// or the experiment's submission host.
+func (src ArtifactSource) host(exp *Experiment) string {
+	if src.Remote != "" {
+		return src.Remote
+	}
+	return exp.Remote
+}
+
+// label names the source for display, prefixed with its host when that
+// differs from the submission host.
+func (src ArtifactSource) label() string {
+	if src.Remote != "" {
+		return src.Remote + ":" + src.Path
+	}
+	return src.Path
 }
 
 func main() {
+	rest, err := setupGlobalOptions(os.Args[1:])
+	if err != nil {
+		exitOnError("exp", err)
+	}
+	os.Args = append(os.Args[:1], rest...)
 	if len(os.Args) < 2 {
 		printUsage()
 		return
 	}
+	jobStatuses.shared = sharedStatusPath
 
 	switch os.Args[1] {
 	case "run":
 		if err := cmdRun(os.Args[2:]); err != nil {
-			log.Fatalf("exp run: %v", err)
+			exitOnError("exp run", err)
 		}
 	case "list":
 		if err := cmdList(os.Args[2:]); err != nil {
-			log.Fatalf("exp list: %v", err)
+			exitOnError("exp list", err)
 		}
 	case "show":
 		if err := cmdShow(os.Args[2:]); err != nil {
-			log.Fatalf("exp show: %v", err)
+			exitOnError("exp show", err)
 		}
 	case "fetch":
 		if err := cmdFetch(os.Args[2:]); err != nil {
-			log.Fatalf("exp fetch: %v", err)
+			exitOnError("exp fetch", err)
+		}
+	case "export":
+		if err := cmdExport(os.Args[2:]); err != nil {
+			exitOnError("exp export", err)
+		}
+	case "import":
+		if err := cmdImport(os.Args[2:]); err != nil {
+			exitOnError("exp import", err)
+		}
+	case "diff":
+		if err := cmdDiff(os.Args[2:]); err != nil {
+			exitOnError("exp diff", err)
+		}
+	case "gc":
+		if err := cmdGC(os.Args[2:]); err != nil {
+			exitOnError("exp gc", err)
+		}
+	case "open":
+		if err := cmdOpen(os.Args[2:]); err != nil {
+			exitOnError("exp open", err)
+		}
+	case "rename":
+		if err := cmdRename(os.Args[2:]); err != nil {
+			exitOnError("exp rename", err)
+		}
+	case "verify":
+		if err := cmdVerify(os.Args[2:]); err != nil {
+			exitOnError("exp verify", err)
+		}
+	case "report":
+		if err := cmdReport(os.Args[2:]); err != nil {
+			exitOnError("exp report", err)
+		}
+	case "db":
+		if err := cmdDB(os.Args[2:]); err != nil {
+			exitOnError("exp db", err)
+		}
+	case "config":
+		if err := cmdConfig(os.Args[2:]); err != nil {
+			exitOnError("exp config", err)
+		}
+	case "archive":
+		if err := cmdArchive(os.Args[2:]); err != nil {
+			exitOnError("exp archive", err)
+		}
+	case "restore":
+		if err := cmdRestore(os.Args[2:]); err != nil {
+			exitOnError("exp restore", err)
+		}
+	case "metrics":
+		if err := cmdMetrics(os.Args[2:]); err != nil {
+			exitOnError("exp metrics", err)
+		}
+	case "compare":
+		if err := cmdCompare(os.Args[2:]); err != nil {
+			exitOnError("exp compare", err)
+		}
+	case "watch":
+		if err := cmdWatch(os.Args[2:]); err != nil {
+			exitOnError("exp watch", err)
+		}
+	case "requeue":
+		if err := cmdRequeue(os.Args[2:]); err != nil {
+			exitOnError("exp requeue", err)
+		}
+	case "track":
+		if err := cmdTrack(os.Args[2:]); err != nil {
+			exitOnError("exp track", err)
+		}
+	case "doctor":
+		if err := cmdDoctor(os.Args[2:]); err != nil {
+			exitOnError("exp doctor", err)
+		}
+	case "export-config":
+		if err := cmdExportConfig(os.Args[2:]); err != nil {
+			exitOnError("exp export-config", err)
+		}
+	case "push":
+		if err := cmdPush(os.Args[2:]); err != nil {
+			exitOnError("exp push", err)
+		}
+	case "grep":
+		if err := cmdGrep(os.Args[2:]); err != nil {
+			exitOnError("exp grep", err)
+		}
+	case "refresh":
+		if err := cmdRefresh(os.Args[2:]); err != nil {
+			exitOnError("exp refresh", err)
+		}
+	case "resume":
+		if err := cmdResume(os.Args[2:]); err != nil {
+			exitOnError("exp resume", err)
+		}
+	case "serve":
+		if err := cmdServe(os.Args[2:]); err != nil {
+			exitOnError("exp serve", err)
+		}
+	case "artifacts":
+		if err := cmdArtifacts(os.Args[2:]); err != nil {
+			exitOnError("exp artifacts", err)
+		}
+	case "monitor":
+		if err := cmdMonitor(os.Args[2:]); err != nil {
+			exitOnError("exp monitor", err)
+		}
+	case "diff-artifacts":
+		if err := cmdDiffArtifacts(os.Args[2:]); err != nil {
+			exitOnError("exp diff-artifacts", err)
+		}
+	case "prune-artifacts":
+		if err := cmdPruneArtifacts(os.Args[2:]); err != nil {
+			exitOnError("exp prune-artifacts", err)
+		}
+	case "stats":
+		if err := cmdStats(os.Args[2:]); err != nil {
+			exitOnError("exp stats", err)
+		}
+	case "tag":
+		if err := cmdTag(os.Args[2:]); err != nil {
+			exitOnError("exp tag", err)
+		}
+	case "completion":
+		if err := cmdCompletion(os.Args[2:]); err != nil {
+			exitOnError("exp completion", err)
+		}
+	case "__complete-ids":
+		if err := cmdCompleteIDs(os.Args[2:]); err != nil {
+			os.Exit(1)
+		}
+	case "__complete-profiles":
+		if err := cmdCompleteProfiles(os.Args[2:]); err != nil {
+			os.Exit(1)
 		}
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
@@ -202,18 +612,99 @@ func main() {
 	}
 }
 
+// exitStatus is returned by commands that signal their result through the
+// process exit code (e.g. "differences found") rather than an error message.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func exitOnError(cmd string, err error) {
+	var status exitStatus
+	if errors.As(err, &status) {
+		os.Exit(int(status))
+	}
+	log.Fatalf("%s: %v", cmd, err)
+}
+
 func printUsage() {
 	fmt.Println(`Usage:
-  exp run   [flags] -- [remote script args...]
-  exp list
-  exp show  <id>
-  exp fetch <id> [flags]
+  exp [--db PATH] [--debug-log PATH] [--no-multiplex] <command> ...
+
+  exp run            [flags] -- [remote script args...]
+  exp list           [--columns id,name,status,recall@10]
+  exp show           <id> | --job-id JOBID [--remote HOST] [--usage]
+  exp fetch          <id> | --job-id JOBID [--remote HOST] [flags]
+  exp fetch          --all [--status S] [--since 7d] [--missing-only]
+  exp export         [--ids 1,5-9] [--status S] [-o file]
+  exp import         [--dry-run] [--duplicate skip|allow] <file.jsonl>
+  exp diff           <id1> <id2> [--all] [--json]
+  exp gc             [--older-than 90d] [--status failed,cancelled] [--purge-artifacts] [--artifact-root DIR] [--dry-run]
+  exp open           <id> [--cd | --log | --finder]
+  exp rename         <id> <new-name>
+  exp verify         <id> [--checksum] [--fix]
+  exp report         <id...> [--format md|html] [-o file]
+  exp db             backup [path] [--keep N] | vacuum | check
+  exp config         validate [--strict=false] [file...] | show [file]
+  exp archive        <id> [-o file.tar.gz] [--remove-local]
+  exp restore        <file.tar.gz> [--dest DIR]
+  exp metrics        <id>
+  exp compare        <id...> [--metrics k1,k2] [--params p1,p2] [--baseline ID] [--csv | --json]
+  exp watch          <id> [--poll-interval 30s] [--follow-log]
+  exp requeue        <id>
+  exp track          --remote user@host --job-id ID [--cluster NAME] [--name NAME] [--watch]
+  exp doctor         [--remote user@host | --profile NAME]
+  exp export-config  <id> [-o run.yaml] [--portable]
+  exp push           <id> LOCAL... [--remote-path SUBDIR] [--exclude REGEX] [--dry-run]
+  exp grep           <id> REGEX [--context 3] [--ignore-case] [--all-logs]
+  exp refresh        [--all | id...] [--fetch-missing] [--resume] [--verbose]
+  exp resume         <id>
+  exp serve          [--addr 127.0.0.1:7777] [--metrics-recent 20] [--write-textfile PATH]
+  exp artifacts      <id> [--remote-only | --local-only] [--json]
+  exp monitor        [--daemon | --once] [--poll-interval 30s] [--verbose]
+  exp diff-artifacts <id1> <id2> [--checksum] [--content PATTERN]
+  exp prune-artifacts [--dry-run] [--max-total-size 200G] [--max-age 90d] [--keep-per-name 3]
+  exp stats
+  exp tag            <id> [--remove] TAG...
+  exp completion     bash|zsh
 
 Commands:
-  run   Submit an experiment via ssh + sbatch on remote host and record it locally.
-  list  List recorded experiments (stored locally).
-  show  Show details of one experiment by ID.
-  fetch Download experiment artifacts from the remote host via rsync.
+  run            Submit an experiment via ssh + sbatch on remote host and record it locally.
+  list           List recorded experiments (stored locally).
+  show           Show details of one experiment by ID.
+  fetch          Download experiment artifacts from the remote host via rsync.
+  export         Dump recorded experiments as JSONL (one object per line).
+  import         Merge an exported JSONL file into the local DB with fresh IDs.
+  diff           Compare the recorded configuration of two experiments (exit 1 when they differ).
+  gc             Prune old experiment rows and orphaned per-ID artifact directories.
+  open           Print (or open) an experiment's local artifact directory or remote log.
+  rename         Change an experiment's recorded name (remote paths keep the old one).
+  verify         Compare local artifacts against the remote (exit 1 when anything differs).
+  report         Render a Markdown/HTML summary of one or more experiments.
+  db             Maintain the local SQLite database (online backup, vacuum, integrity check).
+  config         Check config files for unknown keys, or show where each setting comes from.
+  archive        Bundle an experiment's artifacts and metadata into a portable tar.gz.
+  restore        Unpack an archive and re-register its experiment in the local DB.
+  metrics        Re-extract metrics from an experiment's fetched artifacts and print them.
+  compare        Side-by-side table of parsed args and metrics across experiments.
+  watch          Resume monitoring a submitted job (then fetch artifacts) until it finishes.
+  requeue        Requeue a Slurm job via scontrol requeue and reset its status to PENDING.
+  track          Adopt a Slurm job submitted by hand so exp can monitor and fetch it.
+  doctor         Check local tools, config, DB, and remote Slurm/ssh setup (exit 1 on failures).
+  export-config  Emit a reusable run config (YAML/JSON) from an experiment's snapshot.
+  push           Upload local files into the experiment's remote artifact tree via rsync.
+  grep           Search the remote job log (exit 1 when nothing matched, like grep).
+  refresh        Re-query Slurm for unfinished experiments (one squeue + sacct per remote).
+  resume         Finish the bookkeeping of a job that ended while nothing monitored it.
+  serve          Browse experiments in a local read-only web UI, JSON API and /metrics.
+  artifacts      List remote and local artifact files side by side with sizes.
+  monitor        Watch every active experiment from one process (one per database).
+  diff-artifacts Compare two experiments' local artifact trees (exit 1 when they differ).
+  prune-artifacts Delete old or over-quota local artifact directories per the retention policy.
+  stats          Summarize experiments by status, artifact disk usage, memory and efficiency.
+  tag            Add or remove tags on an experiment (tag keep to protect it from prune-artifacts).
+  completion     Print a shell completion script (bash or zsh).
 
  Examples:
   exp run \
@@ -229,42 +720,107 @@ Commands:
 
   exp run --config-file explorer.yaml
 
-  exp list
+  exp doctor --profile explorer
+
+  exp track --remote baidya.ar@explorer-01 --job-id 2723147 --watch
+
+  exp list --columns id,name,status,recall@10,qps
 
   exp show 1
+  exp show --job-id 2723147 --remote cluster-a
 
   exp fetch 1 --remote-path /projects/foo/results --dest ./results --since-start --pattern 'json$'
 
+  exp fetch --all --since 7d --missing-only
+
+  exp fetch 1 --file results/metrics.json --stdout | jq .
+
+  exp fetch 1 --tar - --gzip | tar -C /scratch -xz
+
+  exp export --ids 1,5-9 -o backup.jsonl
+
+  exp import --dry-run backup.jsonl
+
+  exp diff 14 15
+
+  exp diff-artifacts 14 15 --checksum --content '\.json$'
+
+  exp gc --older-than 90d --status failed,cancelled --purge-artifacts --dry-run
+
+  exp tag 12 keep
+  exp prune-artifacts --dry-run
+
+  cd $(exp open 12 --cd)
+
+  exp report 12 15 --format html -o meeting.html
+
+  exp compare 12 15 18 --metrics recall@10,qps --params k,beam-width --baseline 12
+
+  exp artifacts 12 --remote-only
+
+  exp refresh --all --fetch-missing
+
+  exp monitor --daemon
+  exp run --profile explorer --detach -- --k 100
+
+  exp serve --addr 127.0.0.1:7777
+  exp serve --write-textfile /var/lib/node_exporter/textfile/exp.prom
+
+  exp grep 12 'error|Traceback' --context 3 --ignore-case
+
+  exp push 12 configs/ --remote-path configs --dry-run
+
+  exp export-config 12 --portable -o run.yaml
+
+  exp archive 12 -o bigann-k100.tar.gz --remove-local
+
  Notes:
-  - --config-file accepts JSON or YAML describing a single run (name/remote/logs/artifacts/args).
-  - Define defaults and profiles in ~/.exp/config.(json|yaml), then pass --profile NAME to avoid retyping remote/log/artifact paths.
+  - --config-file accepts JSON, YAML or TOML describing a single run (name/remote/logs/artifacts/args).
+  - Define defaults and profiles in ~/.config/exp/config.(yaml|json|toml), then pass --profile NAME.
+  - exp config validate reports misspelt keys; exp config show prints where each setting comes from.
   - Providing --artifact-remote/--artifact-dest makes "exp run" wait for completion and automatically rsync matching files.
+  - A monitored "exp run" exits 1 when the job failed, was cancelled, timed out or ran out of memory.
   - exp fetch shells out to rsync locally and find on the remote host.
-  - --remote-path must be an absolute path so rsync can address the files.`)
+  - --remote-path must be an absolute path so rsync can address the files.
+  - Patterns are regexes by default; pattern_syntax: glob or --glob for globs; a leading ! excludes.
+  - Anywhere an id is expected, job:JOBID (or job:JOBID:HOST) names the experiment by its Slurm job.
+  - Config lives in ~/.config/exp and data in ~/.local/share/exp; EXP_HOME puts both in one place.
+  - --db PATH (or EXP_DB_PATH) keeps experiments in another database than experiments.db.
+  - Enable shell completion with: source <(exp completion bash)   (or zsh, in ~/.zshrc)
+  - README.md describes the ssh, config, monitoring, artifact and database settings in full.`)
 }
 
 //
 // DB helpers (local, on your laptop)
 //
 
+// dbPath is the database every command opens: --db, else EXP_DB_PATH, else
+// experiments.db in the data directory (see home.go).
 func dbPath() (string, error) {
-	dir, err := configDir()
+	p := globals.DBPath
+	if p == "" {
+		p = os.Getenv("EXP_DB_PATH")
+	}
+	if p != "" {
+		path, err := expandLocalPath(p)
+		if err != nil {
+			return "", fmt.Errorf("database path: %w", err)
+		}
+		return path, os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	dir, err := dataDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, "experiments.db"), nil
+	return filepath.Join(dir, dbFileName), nil
 }
 
-func configDir() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(home, ".exp")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", err
+// printDBPath reports the database in use on stderr, keeping stdout for the
+// command's own output.
+func printDBPath() {
+	if path, err := dbPath(); err == nil {
+		fmt.Fprintf(os.Stderr, "Database: %s\n", path)
 	}
-	return dir, nil
 }
 
 func defaultConfigPaths() ([]string, error) {
@@ -272,19 +828,21 @@ func defaultConfigPaths() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []string{
-		filepath.Join(dir, "config.yaml"),
-		filepath.Join(dir, "config.yml"),
-		filepath.Join(dir, "config.json"),
-	}, nil
+	paths := make([]string, len(configFileNames))
+	for i, name := range configFileNames {
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths, nil
 }
 
+// loadConfig reads the first of configFileNames found in the config
+// directory; others are ignored, with a warning.
 func loadConfig() (*Config, error) {
 	paths, err := defaultConfigPaths()
 	if err != nil {
 		return nil, err
 	}
-	for _, path := range paths {
+	for i, path := range paths {
 		data, err := os.ReadFile(path)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
@@ -292,6 +850,7 @@ func loadConfig() (*Config, error) {
 			}
 			return nil, err
 		}
+		warnShadowedConfigs(path, paths[i+1:])
 		cfg := &Config{
 			Profiles: make(map[string]RunProfile),
 			path:     path,
@@ -299,8 +858,8 @@ func loadConfig() (*Config, error) {
 		if len(bytes.TrimSpace(data)) == 0 {
 			return cfg, nil
 		}
-		if err := unmarshalConfigData(data, filepath.Ext(path), cfg); err != nil {
-			return nil, fmt.Errorf("parse config %s: %w", path, err)
+		if err := unmarshalConfigFile(path, cfg); err != nil {
+			return nil, fmt.Errorf("config: %w", err)
 		}
 		if cfg.Profiles == nil {
 			cfg.Profiles = make(map[string]RunProfile)
@@ -311,13 +870,9 @@ func loadConfig() (*Config, error) {
 }
 
 func loadRunConfigFile(path string) (*RunConfigFile, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
 	var cfg RunConfigFile
-	if err := unmarshalConfigData(data, filepath.Ext(path), &cfg); err != nil {
-		return nil, fmt.Errorf("parse %s: %w", path, err)
+	if err := unmarshalConfigFile(path, &cfg); err != nil {
+		return nil, err
 	}
 	return &cfg, nil
 }
@@ -325,9 +880,9 @@ func loadRunConfigFile(path string) (*RunConfigFile, error) {
 func configPathHint() string {
 	dir, err := configDir()
 	if err != nil {
-		return "~/.exp/config.(json|yaml)"
+		return "~/.config/exp/config.(json|yaml|toml)"
 	}
-	return fmt.Sprintf("%s/config.(json|yaml)", dir)
+	return fmt.Sprintf("%s/config.(json|yaml|toml)", dir)
 }
 
 func openDB() (*sql.DB, error) {
@@ -335,7 +890,19 @@ func openDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite", path)
+	if err := createPrivateFile(path); err != nil {
+		return nil, fmt.Errorf("create database: %w", err)
+	}
+	busy, err := dbBusyTimeout()
+	if err != nil {
+		return nil, err
+	}
+	// busy_timeout lets short-lived commands (list, db backup) wait for a
+	// concurrent monitor's write instead of failing with "database is locked".
+	// In WAL mode readers never block the writer or each other, and
+	// _txlock=immediate takes the write lock when a transaction begins, so it
+	// waits there instead of failing when it first writes.
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_txlock=immediate", path, busy.Milliseconds()))
 	if err != nil {
 		return nil, err
 	}
@@ -346,63 +913,91 @@ func openDB() (*sql.DB, error) {
 	return db, nil
 }
 
-func initSchema(db *sql.DB) error {
-	const createExperiments = `
-CREATE TABLE IF NOT EXISTS experiments (
-  id           INTEGER PRIMARY KEY AUTOINCREMENT,
-  name         TEXT,
-  remote       TEXT,
-  script_path  TEXT,
-  args         TEXT,
-  git_commit   TEXT,
-  git_branch   TEXT,
-  job_id       TEXT,
-  job_status   TEXT,
-  log_path     TEXT,
-  created_at   TEXT,
-  completed_at TEXT,
-  artifact_remote TEXT,
-  artifact_dest   TEXT,
-  artifact_pattern TEXT,
-  artifact_since_start INTEGER,
-  artifact_last_sync   TEXT,
-  artifact_last_error  TEXT,
-  config_snapshot      TEXT
-);`
-	if _, err := db.Exec(createExperiments); err != nil {
-		return err
+// experimentColumns is the column list understood by scanExperiment.
+const experimentColumns = `id, name, remote, script_path, args, git_commit, git_branch, job_id, job_status, log_path,
+                           created_at, completed_at, artifact_remote, artifact_dest, artifact_pattern,
+                           artifact_since_start, artifact_last_sync, artifact_last_error, config_snapshot,
+                           archive_path, requeue_count, artifact_sync_files, artifact_sync_bytes,
+                           artifact_sync_seconds, artifact_manifest, log_archived, artifact_size,
+                           artifact_size_at, tags, artifact_sync_tar, artifact_sync_host,
+                           artifact_sync_updated, artifact_sync_updated_bytes, artifact_sync_settle,
+                           job_elapsed_seconds, job_exit_code, job_max_rss, job_total_cpu_seconds,
+                           job_node_list, job_partition, job_accounting_note, args_json, args_approximate,
+                           job_category, job_reason, seff_cpu_efficiency, seff_mem_efficiency,
+                           seff_wall_seconds, seff_report, job_start_at, job_end_at, preempt_count,
+                           pending_reason, pending_start, stalled_reason, cluster, progress,
+                           progress_percent, progress_line, progress_at,
+                           EXISTS (SELECT 1 FROM sync_history h WHERE h.experiment_id = experiments.id AND h.files_matched > 0)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func loadExperimentByID(db *sql.DB, id string) (*Experiment, error) {
+	exp, err := scanExperiment(db.QueryRow(`SELECT `+experimentColumns+` FROM experiments WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
 	}
-	migrations := []string{
-		`ALTER TABLE experiments ADD COLUMN job_status TEXT`,
-		`ALTER TABLE experiments ADD COLUMN completed_at TEXT`,
-		`ALTER TABLE experiments ADD COLUMN artifact_remote TEXT`,
-		`ALTER TABLE experiments ADD COLUMN artifact_dest TEXT`,
-		`ALTER TABLE experiments ADD COLUMN artifact_pattern TEXT`,
-		`ALTER TABLE experiments ADD COLUMN artifact_since_start INTEGER`,
-		`ALTER TABLE experiments ADD COLUMN artifact_last_sync TEXT`,
-		`ALTER TABLE experiments ADD COLUMN artifact_last_error TEXT`,
-		`ALTER TABLE experiments ADD COLUMN config_snapshot TEXT`,
-	}
-	for _, stmt := range migrations {
-		if _, err := db.Exec(stmt); err != nil {
-			if strings.Contains(strings.ToLower(err.Error()), "duplicate column name") {
-				continue
-			}
-			return err
-		}
+	if err := attachArtifactSources(db, []*Experiment{exp}); err != nil {
+		return nil, err
 	}
-	return nil
+	return exp, nil
 }
 
-func loadExperimentByID(db *sql.DB, id string) (*Experiment, error) {
-	row := db.QueryRow(`SELECT id, name, remote, script_path, args, git_commit, git_branch, job_id, job_status, log_path,
-                               created_at, completed_at, artifact_remote, artifact_dest, artifact_pattern,
-                               artifact_since_start, artifact_last_sync, artifact_last_error, config_snapshot
-                        FROM experiments WHERE id = ?`, id)
+// loadExperiments returns every experiment matching the optional WHERE clause,
+// newest first.
+func loadExperiments(db *sql.DB, where string, args ...interface{}) ([]*Experiment, error) {
+	query := `SELECT ` + experimentColumns + ` FROM experiments`
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+	query += ` ORDER BY created_at DESC`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Experiment
+	for rows.Next() {
+		exp, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, exp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := attachArtifactSources(db, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
 
+func scanExperiment(row rowScanner) (*Experiment, error) {
 	var exp Experiment
-	var created, completed, lastSync sql.NullString
-	var sinceStart sql.NullInt64
+	var created, completed, lastSync, archivePath sql.NullString
+	var sinceStart, requeueCount, syncFiles, syncBytes, logArchived sql.NullInt64
+	var syncSeconds sql.NullFloat64
+	var manifestPath, sizeAt, tags, tarPath, syncHost, syncSettle sql.NullString
+	var syncUpdated, syncUpdatedBytes sql.NullInt64
+	var artifactSize sql.NullInt64
+	var acctElapsed, acctMaxRSS sql.NullInt64
+	var acctCPU sql.NullFloat64
+	var acctExit, acctNodes, acctPartition, acctNote sql.NullString
+	var argsJSON sql.NullString
+	var argsApproximate sql.NullInt64
+	var jobCat, jobReason sql.NullString
+	var seffCPU, seffMem sql.NullFloat64
+	var seffWall sql.NullInt64
+	var seffRaw sql.NullString
+	var acctStart, acctEnd sql.NullString
+	var preemptCount sql.NullInt64
+	var pendingReason, pendingStart, stalledReason sql.NullString
+	var cluster sql.NullString
+	var progress, progressLine, progressAt sql.NullString
+	var progressPercent sql.NullFloat64
 	if err := row.Scan(
 		&exp.ID,
 		&exp.Name,
@@ -423,6 +1018,48 @@ func loadExperimentByID(db *sql.DB, id string) (*Experiment, error) {
 		&lastSync,
 		&exp.ArtifactLastError,
 		&exp.ConfigSnapshot,
+		&archivePath,
+		&requeueCount,
+		&syncFiles,
+		&syncBytes,
+		&syncSeconds,
+		&manifestPath,
+		&logArchived,
+		&artifactSize,
+		&sizeAt,
+		&tags,
+		&tarPath,
+		&syncHost,
+		&syncUpdated,
+		&syncUpdatedBytes,
+		&syncSettle,
+		&acctElapsed,
+		&acctExit,
+		&acctMaxRSS,
+		&acctCPU,
+		&acctNodes,
+		&acctPartition,
+		&acctNote,
+		&argsJSON,
+		&argsApproximate,
+		&jobCat,
+		&jobReason,
+		&seffCPU,
+		&seffMem,
+		&seffWall,
+		&seffRaw,
+		&acctStart,
+		&acctEnd,
+		&preemptCount,
+		&pendingReason,
+		&pendingStart,
+		&stalledReason,
+		&cluster,
+		&progress,
+		&progressPercent,
+		&progressLine,
+		&progressAt,
+		&exp.ArtifactEverMatched,
 	); err != nil {
 		return nil, err
 	}
@@ -444,72 +1081,132 @@ func loadExperimentByID(db *sql.DB, id string) (*Experiment, error) {
 			exp.ArtifactLastSync = t
 		}
 	}
+	exp.ArchivePath = archivePath.String
+	exp.RequeueCount = int(requeueCount.Int64)
+	exp.PreemptCount = int(preemptCount.Int64)
+	exp.PendingReason = pendingReason.String
+	exp.PendingStart, _ = time.Parse(time.RFC3339, pendingStart.String)
+	exp.StalledReason = stalledReason.String
+	exp.Cluster = cluster.String
+	exp.Progress = scanProgress(progress, progressPercent, progressLine, progressAt)
+	exp.LogArchived = logArchived.Int64 == 1
+	exp.ArtifactSize = artifactSize.Int64
+	if sizeAt.Valid && sizeAt.String != "" {
+		if t, err := time.Parse(time.RFC3339, sizeAt.String); err == nil {
+			exp.ArtifactSizeAt = t
+		}
+	}
+	exp.Tags = splitTags(tags.String)
+	exp.ArtifactSyncStats = syncStats{
+		Files:        int(syncFiles.Int64),
+		Bytes:        syncBytes.Int64,
+		Duration:     time.Duration(syncSeconds.Float64 * float64(time.Second)),
+		ManifestPath: manifestPath.String,
+		TarPath:      tarPath.String,
+		Host:         syncHost.String,
+		Settle:       syncSettle.String,
+		Updated:      -1,
+		UpdatedBytes: -1,
+	}
+	if syncUpdated.Valid {
+		exp.ArtifactSyncStats.Updated = int(syncUpdated.Int64)
+	}
+	if syncUpdatedBytes.Valid {
+		exp.ArtifactSyncStats.UpdatedBytes = syncUpdatedBytes.Int64
+	}
+	exp.ArgList, exp.ArgsApproximate = scanArgs(exp.Args, argsJSON, argsApproximate)
+	exp.Accounting = scanAccounting(acctElapsed, acctMaxRSS, acctCPU, acctExit, acctNodes, acctPartition, acctNote, acctStart, acctEnd)
+	exp.JobCategory = scanJobCategory(jobCat, exp.JobStatus)
+	exp.JobReason = jobReason.String
+	exp.Efficiency = scanSeff(seffCPU, seffMem, seffWall, seffRaw)
+	// The artifact_sources table takes precedence; the loaders replace these
+	// when the experiment has rows there.
 	if exp.ConfigSnapshot != "" {
 		var snap RunSnapshot
 		if err := json.Unmarshal([]byte(exp.ConfigSnapshot), &snap); err == nil {
 			if len(snap.ArtifactSources) > 0 {
 				exp.ArtifactSources = copyArtifactSources(snap.ArtifactSources)
 			}
+			exp.SSH = snap.sshHostOptions()
 		}
 	}
 	return &exp, nil
 }
 
+// findExperiment loads an experiment by its ID string and turns a missing row
+// into a user-facing error.
+func findExperiment(db *sql.DB, idStr string) (*Experiment, error) {
+	var exp *Experiment
+	var err error
+	if ref, ok := strings.CutPrefix(idStr, jobRefPrefix); ok {
+		jobID, remote, _ := strings.Cut(ref, ":")
+		exp, err = loadExperimentByJobID(db, jobID, remote)
+	} else if exp, err = loadExperimentByID(db, idStr); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no experiment with id %s", idStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setDebugExperiment(exp.ID)
+	return exp, nil
+}
+
+// runSnapshot decodes the stored config snapshot, filling anything missing
+// (legacy rows recorded before snapshots existed) from the experiment columns.
+func (exp *Experiment) runSnapshot() RunSnapshot {
+	var snap RunSnapshot
+	if exp.ConfigSnapshot != "" {
+		_ = json.Unmarshal([]byte(exp.ConfigSnapshot), &snap)
+	} else {
+		snap.ArtifactSinceStart = exp.ArtifactSinceStart
+	}
+	if snap.Name == "" {
+		snap.Name = exp.Name
+	}
+	if snap.Remote == "" {
+		snap.Remote = exp.Remote
+	}
+	if snap.Script == "" {
+		snap.Script = exp.ScriptPath
+	}
+	if snap.Args == nil && len(exp.ArgList) > 0 {
+		snap.Args = append([]string(nil), exp.ArgList...)
+	}
+	if snap.ArtifactRemote == "" {
+		snap.ArtifactRemote = exp.ArtifactRemote
+	}
+	if snap.ArtifactDest == "" {
+		snap.ArtifactDest = exp.ArtifactDest
+	}
+	if snap.ArtifactPattern == "" {
+		snap.ArtifactPattern = exp.ArtifactPattern
+	}
+	if snap.GitCommit == "" {
+		snap.GitCommit = exp.GitCommit
+	}
+	if snap.GitBranch == "" {
+		snap.GitBranch = exp.GitBranch
+	}
+	return snap
+}
+
 //
 // git helpers (local repo info)
 //
 
 func getGitInfo() (commit, branch string) {
-	c1 := exec.Command("git", "rev-parse", "HEAD")
+	c1 := runCommand("git", "rev-parse", "HEAD")
 	if out, err := c1.Output(); err == nil {
 		commit = strings.TrimSpace(string(out))
 	}
-	c2 := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	c2 := runCommand("git", "rev-parse", "--abbrev-ref", "HEAD")
 	if out, err := c2.Output(); err == nil {
 		branch = strings.TrimSpace(string(out))
 	}
 	return
 }
 
-func getRemoteGitInfo(remote, gitDir string) (commit, branch string, err error) {
-	if remote == "" {
-		return "", "", fmt.Errorf("remote host is required for remote git lookup")
-	}
-	if gitDir == "" {
-		return "", "", fmt.Errorf("git directory is required for remote git lookup")
-	}
-	fmt.Printf("Running remote git commands in %s:%s\n", remote, gitDir)
-	run := func(gitCmd string) (string, error) {
-		cmdStr := fmt.Sprintf("hostname >&2 && cd %s && env GIT_DISCOVERY_ACROSS_FILESYSTEM=1 %s", shellQuote(gitDir), gitCmd)
-		fmt.Printf("  ssh %s \"bash -lc %s\"\n", remote, shellQuote(cmdStr))
-		cmd := exec.Command("ssh", remote, "bash", "-lc", cmdStr)
-		var stdoutBuf, stderrBuf bytes.Buffer
-		cmd.Stdout = &stdoutBuf
-		cmd.Stderr = &stderrBuf
-		err := cmd.Run()
-		if stderrBuf.Len() > 0 {
-			fmt.Print(stderrBuf.String())
-		}
-		if err != nil {
-			return "", fmt.Errorf("%s: %v (stdout: %s stderr: %s)", gitCmd, err,
-				strings.TrimSpace(stdoutBuf.String()), strings.TrimSpace(stderrBuf.String()))
-		}
-		return strings.TrimSpace(stdoutBuf.String()), nil
-	}
-	commit, err = run("git rev-parse HEAD")
-	if err != nil {
-		return "", "", err
-	}
-	fmt.Printf("Remote git commit from %s:%s = %s\n", remote, gitDir, commit)
-	branch, err = run("git rev-parse --abbrev-ref HEAD")
-	if err != nil {
-		return "", "", err
-	}
-	fmt.Printf("Remote git branch from %s:%s = %s\n", remote, gitDir, branch)
-	return commit, branch, nil
-}
-
-func uploadScript(remote, localPath, remotePath string) error {
+func uploadScript(remote string, sshOpts sshHostOptions, localPath, remotePath string) error {
 	if remote == "" {
 		return fmt.Errorf("remote host is required to upload script")
 	}
@@ -527,17 +1224,13 @@ func uploadScript(remote, localPath, remotePath string) error {
 		return fmt.Errorf("script-local %s: %w", absLocal, err)
 	}
 	fmt.Printf("Uploading local script %s to %s:%s\n", absLocal, remote, remotePath)
-	target := fmt.Sprintf("%s:%s", remote, remotePath)
-	cmd := exec.Command("scp", absLocal, target)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("scp script to %s: %w", target, err)
+	if err := remoteExecutor.Upload(absLocal, remote, sshOpts, remotePath); err != nil {
+		return fmt.Errorf("upload script to %s:%s: %w", remote, remotePath, err)
 	}
 	return nil
 }
 
-func runRemoteBuildScript(remote, localPath string) error {
+func runRemoteBuildScript(remote string, sshOpts sshHostOptions, localPath string) error {
 	if remote == "" {
 		return fmt.Errorf("remote host is required for build script execution")
 	}
@@ -559,13 +1252,28 @@ func runRemoteBuildScript(remote, localPath string) error {
 	if err != nil {
 		return fmt.Errorf("read build-script %s: %w", absLocal, err)
 	}
+	return runBuildScript(remote, sshOpts, "build script "+absLocal, data)
+}
+
+// runInlineBuildScript runs a run config's build_script_inline the way
+// runRemoteBuildScript runs a script file.
+func runInlineBuildScript(remote string, sshOpts sshHostOptions, script string) error {
+	if strings.TrimSpace(script) == "" {
+		return fmt.Errorf("build_script_inline is empty")
+	}
+	return runBuildScript(remote, sshOpts, "build_script_inline", []byte(script))
+}
+
+// runBuildScript writes data to a temporary script on remote through a
+// heredoc, runs it with bash and removes it; what names it in the output.
+func runBuildScript(remote string, sshOpts sshHostOptions, what string, data []byte) error {
 	if len(data) == 0 || data[len(data)-1] != '\n' {
 		data = append(data, '\n')
 	}
 	remotePath := fmt.Sprintf("/tmp/exp-build-%d-%d.sh", time.Now().UnixNano(), os.Getpid())
 	remoteQuoted := shellQuote(remotePath)
 	marker := fmt.Sprintf("EXP_BUILD_%d", time.Now().UnixNano())
-	fmt.Printf("Uploading and executing build script %s on %s:%s\n", absLocal, remote, remotePath)
+	fmt.Printf("Uploading and executing %s on %s:%s\n", what, remote, remotePath)
 	var builder strings.Builder
 	builder.WriteString("set -eo pipefail; ")
 	fmt.Fprintf(&builder, "cat > %s <<'%s'\n", remoteQuoted, marker)
@@ -574,7 +1282,7 @@ func runRemoteBuildScript(remote, localPath string) error {
 	fmt.Fprintf(&builder, "chmod +x %s\n", remoteQuoted)
 	fmt.Fprintf(&builder, "bash %s\n", remoteQuoted)
 	fmt.Fprintf(&builder, "rm -f %s\n", remoteQuoted)
-	cmd := exec.Command("ssh", remote, "bash", "-lc", builder.String())
+	cmd := sshCommand(remote, sshOpts, "bash", "-lc", builder.String()).withTimeout(timeouts.Transfer)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -583,6 +1291,24 @@ func runRemoteBuildScript(remote, localPath string) error {
 	return nil
 }
 
+var experimentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._=+-]*$`)
+
+// validateExperimentName enforces the characters allowed in experiment names.
+// Names end up in the sbatch --output template and the remote log filename, so
+// whitespace, slashes, and '%' (sbatch placeholders) are rejected.
+func validateExperimentName(name string) error {
+	if name == "" {
+		return fmt.Errorf("experiment name must not be empty")
+	}
+	if len(name) > 128 {
+		return fmt.Errorf("experiment name %q is longer than 128 characters", name)
+	}
+	if !experimentNamePattern.MatchString(name) {
+		return fmt.Errorf("experiment name %q may only contain letters, digits, '.', '_', '=', '+', and '-' (and must start with a letter or digit)", name)
+	}
+	return nil
+}
+
 //
 // ssh + sbatch helper
 //
@@ -590,30 +1316,103 @@ func runRemoteBuildScript(remote, localPath string) error {
 // submitSbatchSSH runs sbatch on the remote host via SSH.
 // remote: "user@host"
 // logTemplate, scriptPath, scriptArgs must be valid paths/args on the remote machine.
-func submitSbatchSSH(remote, logTemplate, scriptPath string, scriptArgs []string) (jobID string, sshOutput string, err error) {
-	// ssh remote sbatch --output=logTemplate scriptPath [scriptArgs...]
-	args := []string{
-		remote,
-		"sbatch",
+//
+// A connection failure is retried, but a job is never submitted twice: when
+// the connection broke after sbatch may have run, squeue is asked for the
+// job before sbatch runs again.
+//
+// cluster, when set, submits with -M. The returned jobCluster is the cluster
+// sbatch reports the job on, which is where later commands must look for it.
+func submitSbatchSSH(remote string, sshOpts sshHostOptions, cluster, logTemplate, scriptPath string, scriptArgs []string) (jobID, jobCluster, sshOutput string, err error) {
+	// ssh remote sbatch [-M cluster] --parsable --output=logTemplate scriptPath [scriptArgs...]
+	args := slurmArgs(cluster, "sbatch",
+		"--parsable",
 		fmt.Sprintf("--output=%s", logTemplate),
 		scriptPath,
-	}
+	)
 	args = append(args, scriptArgs...)
 
-	cmd := exec.Command("ssh", args...)
-	out, err := cmd.CombinedOutput()
-	sshOutput = string(out)
+	started := time.Now()
+	unknown := false // the last attempt may have submitted the job
+	adopted := ""
+	err = retrySSH(os.Stdout, remote, "sbatch on "+remote, sshRetryPolicy, time.Sleep, func() (string, error) {
+		if unknown {
+			ids, err := recentJobIDs(remote, sshOpts, cluster, scriptPath, time.Since(started)+time.Minute)
+			if err != nil {
+				return "", err
+			}
+			switch len(ids) {
+			case 0:
+				fmt.Println("The interrupted submission did not reach Slurm; submitting again.")
+			case 1:
+				adopted = ids[0]
+				return "", nil
+			default:
+				return "", fmt.Errorf("jobs %s were all submitted from %s just now", strings.Join(ids, ", "), scriptPath)
+			}
+		}
+		out, err := sshCommand(remote, sshOpts, args...).CombinedOutput()
+		sshOutput = string(out)
+		// sbatch failing on its own submitted nothing; only a connection
+		// that broke once it may have run leaves that open.
+		if err != nil {
+			class := classifySSHError(err, sshOutput)
+			unknown = class != sshErrRemote && !class.beforeCommand()
+		}
+		return sshOutput, err
+	})
+	if adopted != "" {
+		fmt.Printf("Job %s was submitted before the connection dropped; recording it.\n", adopted)
+		return adopted, cluster, sshOutput, nil
+	}
+	if err != nil && unknown {
+		return "", "", sshOutput, fmt.Errorf("ssh/sbatch failed: %v\nOutput: %s\nThe job may have been submitted anyway; check squeue on %s before running exp run again", err, sshOutput, remote)
+	}
+	if err != nil {
+		return "", "", sshOutput, fmt.Errorf("ssh/sbatch failed: %v\nOutput: %s", err, sshOutput)
+	}
+
+	jobID, jobCluster, err = parseSbatchOutput(sshOutput)
 	if err != nil {
-		return "", sshOutput, fmt.Errorf("ssh/sbatch failed: %v\nOutput: %s", err, sshOutput)
+		return "", "", sshOutput, err
 	}
+	if jobCluster == "" {
+		jobCluster = cluster
+	}
+	return jobID, jobCluster, sshOutput, nil
+}
 
-	// Typical sbatch output: "Submitted batch job 2723147"
-	parts := strings.Fields(sshOutput)
-	if len(parts) == 0 {
-		return "", sshOutput, fmt.Errorf("unable to parse sbatch output: %q", sshOutput)
+// recentJobIDs lists our jobs on remote that were submitted from scriptPath
+// within the last window, by the remote's clock (squeue prints submit times
+// as epoch seconds, see slurmTimeEnv). squeue is asked for the job name
+// sbatch gives them, the script's unless it sets #SBATCH --job-name (or
+// -J), and a job only counts when its command is scriptPath as sbatch
+// records it (relative to the login directory, where sbatch ran), so a
+// sibling run of the same script under another path is left alone.
+func recentJobIDs(remote string, sshOpts sshHostOptions, cluster, scriptPath string, window time.Duration) ([]string, error) {
+	out, err := sshCombinedOutput(remote, sshOpts, "bash", "-c", shellQuote(recentJobsScript(cluster, scriptPath, window)))
+	if err != nil {
+		return nil, fmt.Errorf("squeue: %w (output: %s)", err, strings.TrimSpace(string(out)))
 	}
-	jobID = parts[len(parts)-1]
-	return jobID, sshOutput, nil
+	return strings.Fields(string(out)), nil
+}
+
+func recentJobsScript(cluster, scriptPath string, window time.Duration) string {
+	script := shellQuote(scriptPath)
+	squeue := strings.Join(slurmArgs(cluster, "squeue"), " ")
+	return fmt.Sprintf(`name=$(sed -n 's/^#SBATCH[[:space:]]*\(--job-name[=[:space:]]\|-J[[:space:]]*\)[[:space:]]*\([^[:space:]]*\).*/\2/p' %s | tail -n 1)
+[ -n "$name" ] || name=$(basename %s)
+script=%s
+case $script in /*) ;; *) script="$PWD/$script" ;; esac
+jobs=$(%s -h -u "$USER" -n "$name" -o '%%i %%V %%o') || exit 2
+now=$(date +%%s)
+printf '%%s\n' "$jobs" | while read -r id submitted command _; do
+  [ -n "$id" ] && [ "$id" != CLUSTER: ] || continue
+  case $submitted in ''|*[!0-9]*) continue ;; esac
+  [ "$command" = "$script" ] || continue
+  [ $((now - submitted)) -le %d ] && echo "$id"
+done
+exit 0`, script, script, script, squeue, int(window.Seconds()))
 }
 
 //
@@ -629,15 +1428,42 @@ func cmdRun(args []string) error {
 		logDir           string
 		script           string
 		buildScript      string
+		buildInline      string
 		scriptLocal      string
 		artifactRemote   string
 		artifactDest     string
 		artifactPatterns multiStringFlag
 		configPath       string
 		profileName      string
+		detach           bool
+		followLogFlag    bool
+		globPatterns     bool
+		patternSyntax    string
+		minSize          string
+		maxSize          string
+		bwLimit          string
+		compressLevel    int
+		parallel         int
+		confirmOver      string
+		syncInterval     string
+		transferRemote   string
+		settleDelay      string
+		settleMaxWait    string
+		assumeCompleted  string
+		pendingCheck     string
+		stallAfter       string
+		cluster          string
+		progressRegex    string
+		maxMonitor       string
+		sshOpts          sshHostOptions
+		verbose          bool
+		interactiveAuth  bool
+		strictConfig     bool
+		sshOptionFlags   multiStringFlag
 	)
 	var configPatterns []string
 	var artifactSources []ArtifactSource
+	var metricSpecs []MetricSpec
 	fs.StringVar(&remote, "remote", "", "Remote user@host for SSH (required)")
 	fs.StringVar(&name, "name", "", "Logical name for the experiment (required)")
 	fs.StringVar(&logDir, "log-dir", "", "REMOTE directory for sbatch logs (required)")
@@ -646,13 +1472,49 @@ func cmdRun(args []string) error {
 	fs.StringVar(&scriptLocal, "script-local", "", "LOCAL path to sbatch script to upload to --script before running (optional)")
 	fs.StringVar(&artifactRemote, "artifact-remote", "", "REMOTE directory tree to sync after the job completes (optional)")
 	fs.StringVar(&artifactDest, "artifact-dest", "", "LOCAL directory to store downloaded artifacts (optional)")
-	fs.Var(&artifactPatterns, "artifact-pattern", "Regex filter applied to full remote artifact paths; may be repeated")
-	fs.StringVar(&configPath, "config-file", "", "Path to YAML/JSON file describing this run (optional)")
-	fs.StringVar(&profileName, "profile", "", "Profile name defined in ~/.exp/config.json to use as defaults")
+	fs.Var(&artifactPatterns, "artifact-pattern", "Regex filter applied to full remote artifact paths (a glob with --glob); may be repeated")
+	fs.StringVar(&minSize, "min-size", "", "Skip artifact files smaller than this when syncing (e.g. 1K)")
+	fs.StringVar(&maxSize, "max-size", "", "Skip artifact files larger than this when syncing (e.g. 10M, 1.5G)")
+	fs.StringVar(&bwLimit, "bwlimit", "", "Limit the post-run artifact sync bandwidth, e.g. 500K or 1.5M (KiB/s when bare; 0 disables)")
+	fs.IntVar(&compressLevel, "compress-level", 0, "rsync compression level (1-9) when compressing the artifact sync")
+	fs.StringVar(&confirmOver, "confirm-over", "", "Flag artifact syncs larger than this (e.g. 5G): exp fetch asks first, the post-run sync logs a warning")
+	fs.StringVar(&syncInterval, "sync-interval", "", "Also sync artifacts this often while the job is running (e.g. 1h), each pass only moving files changed since the previous one")
+	fs.StringVar(&settleDelay, "settle-delay", "", "Wait this long after the job finishes before syncing artifacts (default 10s); with --settle-max-wait, the interval between listings")
+	fs.StringVar(&settleMaxWait, "settle-max-wait", "", "Before the post-run sync, list the artifacts every --settle-delay until their count and size stop changing, for at most this long (e.g. 5m)")
+	fs.StringVar(&assumeCompleted, "assume-completed-after", "", "On a cluster without job accounting, record a job that has been gone from squeue and scontrol this long as COMPLETED_UNCONFIRMED and sync its artifacts (e.g. 30m)")
+	fs.StringVar(&pendingCheck, "pending-check-interval", "", "While the job is pending, ask squeue --start for its estimated start and reason this often (default 5m; 0 turns it off)")
+	fs.StringVar(&stallAfter, "stall-after", "", "Warn when a QOS limit, hold or other reason that will not clear by itself has kept the job pending this long (default 1h)")
+	fs.StringVar(&progressRegex, "progress-regex", "", "While the job runs, read the end of its log every 2m and keep the newest line this regex matches; one group is the progress, two are current and total (e.g. 'epoch (\\d+)/(\\d+)')")
+	fs.StringVar(&maxMonitor, "max-monitor", "", "Stop monitoring after this long (e.g. 12h) and leave the job to exp watch, exp refresh --fetch-missing or the monitor daemon")
+	fs.StringVar(&cluster, "cluster", "", "Submit to this cluster of a multi-cluster or federated Slurm setup (sbatch -M) and query the job there")
+	fs.StringVar(&sshOpts.Identity, "ssh-identity", "", "LOCAL private key for ssh to the remote (ssh -i)")
+	fs.IntVar(&sshOpts.Port, "ssh-port", 0, "ssh port on the remote")
+	fs.StringVar(&sshOpts.ProxyJump, "ssh-proxy-jump", "", "Reach the remote through this bastion, user@host[:port] (ssh -J)")
+	fs.Var(&sshOptionFlags, "ssh-option", "Extra ssh option as given to ssh -o, e.g. ServerAliveInterval=30; may be repeated")
+	fs.BoolVar(&globPatterns, "glob", false, "Treat artifact patterns as globs (*.json, results/**/*.csv) instead of regexes")
+	fs.StringVar(&configPath, "config-file", "", "Path to a YAML/JSON/TOML file describing this run (optional)")
+	fs.StringVar(&profileName, "profile", "", "Profile name defined in the global config (see exp help) to use as defaults")
+	fs.BoolVar(&followLogFlag, "follow-log", false, "While monitoring, stream the job's log (tail -F over ssh) between the status lines")
+	fs.BoolVar(&detach, "detach", false, "Return right after submitting and leave monitoring and artifact syncs to exp monitor --daemon")
+	fs.BoolVar(&verbose, "verbose", false, "Also print how many ssh round trips the remote preflight saved")
+	fs.BoolVar(&interactiveAuth, "interactive-auth", false, "Let ssh prompt for passwords, passphrases and 2FA codes (other commands never prompt)")
+	fs.BoolVar(&strictConfig, "strict-config", false, "Fail on keys in the config or --config-file that no setting takes, such as misspelt ones")
 
 	artifactSinceStartFlag := boolFlag{value: true}
 	fs.Var(&artifactSinceStartFlag, "artifact-since-start", "Only copy files newer than experiment start when syncing artifacts")
 
+	var compressFlag boolFlag
+	fs.Var(&compressFlag, "compress", "Compress the artifact sync (rsync -z); defaults to on when most files are text-like")
+
+	var deferFlag boolFlag
+	fs.Var(&deferFlag, "defer-large-sync", "Skip a post-run sync over --confirm-over and mark the experiment "+statusSyncDeferred+" (exp fetch --all --status "+statusSyncDeferred+" picks these up)")
+
+	var notifyFlag boolFlag
+	fs.Var(&notifyFlag, "notify-local", "Ring the terminal bell and post a desktop notification (osascript/notify-send) when the job ends or its artifacts fail to sync")
+
+	var flatFlag boolFlag
+	fs.Var(&flatFlag, "flat-artifacts", "Sync a single artifact source straight into artifact-dest instead of artifact-dest/<source-name>/")
+
 	pollIntervalFlag := durationFlag{value: defaultPollInterval}
 	fs.Var(&pollIntervalFlag, "poll-interval", "How frequently to poll job status (e.g. 45s, 2m)")
 
@@ -666,6 +1528,28 @@ func cmdRun(args []string) error {
 
 	artifactSinceStart := artifactSinceStartFlag.value
 	pollInterval := pollIntervalFlag.value
+	sshOpts.Options = sshOptionFlags.Values()
+	sshBatchMode = !interactiveAuth
+	var compress *bool
+	if compressFlag.set {
+		compress = &compressFlag.value
+	}
+	flat := flatFlag.value
+	var rsyncRetries *int
+	rsyncBackoff := ""
+	var listRetries *int
+	listRetryDelay := ""
+	var fallbackNoTimeFilter *bool
+	var checksum *bool
+	var captureSeff *bool
+	var notifyLocal *bool
+	if notifyFlag.set {
+		notifyLocal = &notifyFlag.value
+	}
+	var deferLargeSync *bool
+	if deferFlag.set {
+		deferLargeSync = &deferFlag.value
+	}
 
 	var runFile *RunConfigFile
 	if configPath != "" {
@@ -687,6 +1571,22 @@ func cmdRun(args []string) error {
 		}
 	}
 
+	if strictConfig {
+		path, err := globalConfigPath()
+		if err != nil {
+			return err
+		}
+		if path != "" {
+			if err := strictConfigError(path, &Config{}); err != nil {
+				return err
+			}
+		}
+		if runFile != nil {
+			if err := strictConfigError(configPath, &RunConfigFile{}); err != nil {
+				return err
+			}
+		}
+	}
 	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
@@ -721,39 +1621,134 @@ func cmdRun(args []string) error {
 		if len(artifactSources) == 0 && len(prof.ArtifactSources) > 0 {
 			artifactSources = copyArtifactSources(prof.ArtifactSources)
 		}
-		if !artifactSinceStartFlag.set && prof.ArtifactSinceStart != nil {
-			artifactSinceStart = *prof.ArtifactSinceStart
+		if len(metricSpecs) == 0 && len(prof.Metrics) > 0 {
+			metricSpecs = append([]MetricSpec(nil), prof.Metrics...)
 		}
-		if !pollIntervalFlag.set && prof.PollInterval != "" {
-			d, err := time.ParseDuration(prof.PollInterval)
-			if err != nil {
-				return fmt.Errorf("invalid poll_interval %q in profile %s: %w", prof.PollInterval, source, err)
-			}
-			pollInterval = d
+		if minSize == "" {
+			minSize = string(prof.MinSize)
 		}
-		return nil
-	}
-	if cfg == nil {
-		if profileName != "" {
-			return fmt.Errorf("profile %q requested but no config file found (expected %s)", profileName, configPathHint())
+		if maxSize == "" {
+			maxSize = string(prof.MaxSize)
 		}
-	} else {
-		if err := applyProfile("defaults", &cfg.Defaults); err != nil {
-			return err
+		if bwLimit == "" {
+			bwLimit = string(prof.BWLimit)
 		}
-		if profileName != "" {
-			prof, ok := cfg.Profiles[profileName]
-			if !ok {
-				return fmt.Errorf("profile %q not found in %s", profileName, cfg.path)
-			}
-			if err := applyProfile(profileName, &prof); err != nil {
-				return err
-			}
+		if compress == nil && prof.Compress != nil {
+			v := *prof.Compress
+			compress = &v
 		}
-	}
-
-	applyRunFile := func(source string, cfg *RunConfigFile) error {
-		if cfg == nil {
+		if compressLevel == 0 {
+			compressLevel = int(prof.CompressLevel)
+		}
+		if parallel == 0 {
+			parallel = int(prof.Parallel)
+		}
+		if !flatFlag.set && prof.FlatArtifacts != nil {
+			flat = *prof.FlatArtifacts
+		}
+		if rsyncRetries == nil && prof.RsyncRetries != nil {
+			n := int(*prof.RsyncRetries)
+			rsyncRetries = &n
+		}
+		if rsyncBackoff == "" {
+			rsyncBackoff = prof.RsyncBackoff
+		}
+		if listRetries == nil && prof.ListRetries != nil {
+			n := int(*prof.ListRetries)
+			listRetries = &n
+		}
+		if listRetryDelay == "" {
+			listRetryDelay = prof.ListRetryDelay
+		}
+		if fallbackNoTimeFilter == nil {
+			fallbackNoTimeFilter = prof.FallbackNoTimeFilter
+		}
+		if checksum == nil {
+			checksum = prof.Checksum
+		}
+		if captureSeff == nil {
+			captureSeff = prof.CaptureSeff
+		}
+		if notifyLocal == nil {
+			notifyLocal = prof.NotifyLocal
+		}
+		if confirmOver == "" {
+			confirmOver = string(prof.ConfirmOver)
+		}
+		if deferLargeSync == nil {
+			deferLargeSync = prof.DeferLargeSync
+		}
+		if syncInterval == "" {
+			syncInterval = prof.SyncInterval
+		}
+		if transferRemote == "" {
+			transferRemote = prof.TransferRemote
+		}
+		if settleDelay == "" {
+			settleDelay = prof.SettleDelay
+		}
+		if settleMaxWait == "" {
+			settleMaxWait = prof.SettleMaxWait
+		}
+		if assumeCompleted == "" {
+			assumeCompleted = prof.AssumeCompletedAfter
+		}
+		if pendingCheck == "" {
+			pendingCheck = prof.PendingCheckInterval
+		}
+		if stallAfter == "" {
+			stallAfter = prof.StallAfter
+		}
+		if cluster == "" {
+			cluster = prof.Cluster
+		}
+		if progressRegex == "" {
+			progressRegex = prof.ProgressRegex
+		}
+		if maxMonitor == "" {
+			maxMonitor = prof.MaxMonitor
+		}
+		sshOpts.fill(prof.sshHostOptions())
+		if prof.PatternSyntax != "" {
+			syntax, err := normalizePatternSyntax(prof.PatternSyntax)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", source, err)
+			}
+			patternSyntax = syntax
+		}
+		if !artifactSinceStartFlag.set && prof.ArtifactSinceStart != nil {
+			artifactSinceStart = *prof.ArtifactSinceStart
+		}
+		if !pollIntervalFlag.set && prof.PollInterval != "" {
+			d, err := time.ParseDuration(prof.PollInterval)
+			if err != nil {
+				return fmt.Errorf("invalid poll_interval %q in profile %s: %w", prof.PollInterval, source, err)
+			}
+			pollInterval = d
+		}
+		return nil
+	}
+	if cfg == nil {
+		if profileName != "" {
+			return fmt.Errorf("profile %q requested but no config file found (expected %s)", profileName, configPathHint())
+		}
+	} else {
+		if err := applyProfile("defaults", &cfg.Defaults); err != nil {
+			return err
+		}
+		if profileName != "" {
+			prof, ok := cfg.Profiles[profileName]
+			if !ok {
+				return fmt.Errorf("profile %q not found in %s", profileName, cfg.path)
+			}
+			if err := applyProfile(profileName, &prof); err != nil {
+				return err
+			}
+		}
+	}
+
+	applyRunFile := func(source string, cfg *RunConfigFile) error {
+		if cfg == nil {
 			return nil
 		}
 		if remote == "" {
@@ -765,9 +1760,15 @@ func cmdRun(args []string) error {
 		if script == "" {
 			script = cfg.Script
 		}
+		if cfg.BuildScript != "" && cfg.BuildScriptInline != "" {
+			return fmt.Errorf("%s sets both build_script and build_script_inline", source)
+		}
 		if buildScript == "" {
 			buildScript = cfg.BuildScript
 		}
+		if buildScript == "" && buildInline == "" {
+			buildInline = cfg.BuildScriptInline
+		}
 		if scriptLocal == "" {
 			scriptLocal = cfg.ScriptLocal
 		}
@@ -780,6 +1781,101 @@ func cmdRun(args []string) error {
 		if len(artifactSources) == 0 && len(cfg.ArtifactSources) > 0 {
 			artifactSources = copyArtifactSources(cfg.ArtifactSources)
 		}
+		if len(cfg.Metrics) > 0 {
+			metricSpecs = append([]MetricSpec(nil), cfg.Metrics...)
+		}
+		if minSize == "" {
+			minSize = string(cfg.MinSize)
+		}
+		if maxSize == "" {
+			maxSize = string(cfg.MaxSize)
+		}
+		if bwLimit == "" {
+			bwLimit = string(cfg.BWLimit)
+		}
+		if compress == nil && cfg.Compress != nil {
+			v := *cfg.Compress
+			compress = &v
+		}
+		if compressLevel == 0 {
+			compressLevel = int(cfg.CompressLevel)
+		}
+		if parallel == 0 {
+			parallel = int(cfg.Parallel)
+		}
+		if !flatFlag.set && cfg.FlatArtifacts != nil {
+			flat = *cfg.FlatArtifacts
+		}
+		if rsyncRetries == nil && cfg.RsyncRetries != nil {
+			n := int(*cfg.RsyncRetries)
+			rsyncRetries = &n
+		}
+		if rsyncBackoff == "" {
+			rsyncBackoff = cfg.RsyncBackoff
+		}
+		if listRetries == nil && cfg.ListRetries != nil {
+			n := int(*cfg.ListRetries)
+			listRetries = &n
+		}
+		if listRetryDelay == "" {
+			listRetryDelay = cfg.ListRetryDelay
+		}
+		if fallbackNoTimeFilter == nil {
+			fallbackNoTimeFilter = cfg.FallbackNoTimeFilter
+		}
+		if checksum == nil {
+			checksum = cfg.Checksum
+		}
+		if captureSeff == nil {
+			captureSeff = cfg.CaptureSeff
+		}
+		if notifyLocal == nil {
+			notifyLocal = cfg.NotifyLocal
+		}
+		if confirmOver == "" {
+			confirmOver = string(cfg.ConfirmOver)
+		}
+		if deferLargeSync == nil {
+			deferLargeSync = cfg.DeferLargeSync
+		}
+		if syncInterval == "" {
+			syncInterval = cfg.SyncInterval
+		}
+		if transferRemote == "" {
+			transferRemote = cfg.TransferRemote
+		}
+		if settleDelay == "" {
+			settleDelay = cfg.SettleDelay
+		}
+		if settleMaxWait == "" {
+			settleMaxWait = cfg.SettleMaxWait
+		}
+		if assumeCompleted == "" {
+			assumeCompleted = cfg.AssumeCompletedAfter
+		}
+		if pendingCheck == "" {
+			pendingCheck = cfg.PendingCheckInterval
+		}
+		if stallAfter == "" {
+			stallAfter = cfg.StallAfter
+		}
+		if cluster == "" {
+			cluster = cfg.Cluster
+		}
+		if progressRegex == "" {
+			progressRegex = cfg.ProgressRegex
+		}
+		if maxMonitor == "" {
+			maxMonitor = cfg.MaxMonitor
+		}
+		sshOpts.fill(cfg.sshHostOptions())
+		if cfg.PatternSyntax != "" {
+			syntax, err := normalizePatternSyntax(cfg.PatternSyntax)
+			if err != nil {
+				return fmt.Errorf("%s: %w", source, err)
+			}
+			patternSyntax = syntax
+		}
 		if len(configPatterns) == 0 {
 			if patterns := normalizePatternList(cfg.ArtifactPattern, cfg.ArtifactPatterns); len(patterns) > 0 {
 				configPatterns = patterns
@@ -812,6 +1908,9 @@ func cmdRun(args []string) error {
 		fs.Usage()
 		return fmt.Errorf("remote, name, log-dir, and script are required (or set EXP_REMOTE)")
 	}
+	if err := validateExperimentName(name); err != nil {
+		return err
+	}
 
 	if artifactRemote != "" && !strings.HasPrefix(artifactRemote, "/") {
 		return fmt.Errorf("artifact-remote must be an absolute path on the remote host")
@@ -819,6 +1918,93 @@ func cmdRun(args []string) error {
 	if len(artifactSources) == 0 && (artifactRemote == "") != (artifactDest == "") {
 		return fmt.Errorf("artifact-remote and artifact-dest must be provided together (or specify artifact-sources)")
 	}
+	if _, _, err := parseSizeLimits(minSize, maxSize); err != nil {
+		return err
+	}
+	if bwLimit, err = parseBWLimit(bwLimit); err != nil {
+		return err
+	}
+	if confirmOver != "" {
+		if _, err := parseSize(confirmOver); err != nil {
+			return fmt.Errorf("confirm_over: %w", err)
+		}
+	}
+	if transferRemote != "" {
+		if err := validateRemoteHost(transferRemote); err != nil {
+			return fmt.Errorf("transfer_remote: %w", err)
+		}
+	}
+	if err := validateSettle(settleDelay, settleMaxWait); err != nil {
+		return err
+	}
+	if err := validateAssumeCompleted(assumeCompleted); err != nil {
+		return err
+	}
+	if err := validatePendingCheck(pendingCheck); err != nil {
+		return err
+	}
+	if err := validateStallAfter(stallAfter); err != nil {
+		return err
+	}
+	if err := validateCluster(cluster); err != nil {
+		return err
+	}
+	if progressRegex != "" {
+		if _, err := compileProgressRegex(progressRegex); err != nil {
+			return err
+		}
+	}
+	maxMonitorDuration, err := parseMaxMonitor(maxMonitor)
+	if err != nil {
+		return err
+	}
+	if err := sshOpts.validate(); err != nil {
+		return err
+	}
+	if sshOpts.Identity != "" {
+		// The snapshot is used from other directories later.
+		if sshOpts.Identity, err = expandLocalPath(sshOpts.Identity); err != nil {
+			return fmt.Errorf("ssh_identity: %w", err)
+		}
+	}
+	if syncInterval != "" {
+		if d, err := time.ParseDuration(syncInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid sync_interval %q (examples: 30m, 1h)", syncInterval)
+		}
+		if len(artifactSources) == 0 && artifactRemote == "" {
+			return fmt.Errorf("sync_interval needs artifact sources to sync")
+		}
+		if detach {
+			fmt.Println("Note: sync_interval only applies while exp run is monitoring; the detached monitor daemon syncs once the job finishes.")
+		}
+	}
+	if err := validateCompressLevel(compressLevel); err != nil {
+		return err
+	}
+	if parallel < 0 {
+		return fmt.Errorf("parallel must be at least 1")
+	}
+	if rsyncRetries != nil && *rsyncRetries < 0 {
+		return fmt.Errorf("rsync_retries must not be negative")
+	}
+	if rsyncBackoff != "" {
+		if d, err := time.ParseDuration(rsyncBackoff); err != nil || d <= 0 {
+			return fmt.Errorf("invalid rsync_backoff %q (examples: 10s, 1m)", rsyncBackoff)
+		}
+	}
+	if listRetries != nil && *listRetries < 0 {
+		return fmt.Errorf("list_retries must not be negative")
+	}
+	if listRetryDelay != "" {
+		if d, err := time.ParseDuration(listRetryDelay); err != nil || d <= 0 {
+			return fmt.Errorf("invalid list_retry_delay %q (examples: 3s, 30s)", listRetryDelay)
+		}
+	}
+	for _, spec := range metricSpecs {
+		if _, err := regexp.Compile(spec.Pattern); err != nil {
+			return fmt.Errorf("metrics pattern %q: %w", spec.Pattern, err)
+		}
+	}
 	patterns := configPatterns
 	if vals := artifactPatterns.Values(); len(vals) > 0 {
 		patterns = vals
@@ -834,16 +2020,22 @@ func cmdRun(args []string) error {
 			return fmt.Errorf("ensure artifact destination %s: %w", artifactDestAbs, err)
 		}
 	}
-	if buildScript != "" {
+	if buildScript != "" || buildInline != "" {
 		if remote == "" {
 			return fmt.Errorf("build-script requires a remote host")
 		}
-		if err := runRemoteBuildScript(remote, buildScript); err != nil {
+		var err error
+		if buildScript != "" {
+			err = runRemoteBuildScript(remote, sshOpts, buildScript)
+		} else {
+			err = runInlineBuildScript(remote, sshOpts, buildInline)
+		}
+		if err != nil {
 			return err
 		}
 	}
 	if scriptLocal != "" {
-		if err := uploadScript(remote, scriptLocal, script); err != nil {
+		if err := uploadScript(remote, sshOpts, scriptLocal, script); err != nil {
 			return err
 		}
 	}
@@ -866,6 +2058,38 @@ func cmdRun(args []string) error {
 		}
 		sources[i].Patterns = ensurePatterns(sources[i].Patterns)
 	}
+	forceSyntax := ""
+	if globPatterns {
+		forceSyntax = patternSyntaxGlob
+		patternSyntax = patternSyntaxGlob
+	}
+	if patternSyntax == "" {
+		patternSyntax = patternSyntaxRegex
+	}
+	if err := applyPatternSyntax(sources, patternSyntax, forceSyntax); err != nil {
+		return err
+	}
+	if err := assignSourceNames(sources); err != nil {
+		return err
+	}
+	if err := normalizeSourceSymlinks(sources); err != nil {
+		return err
+	}
+	if err := validateSourceRemotes(sources); err != nil {
+		return err
+	}
+	if err := validateSourcePruneDirs(sources); err != nil {
+		return err
+	}
+	artifactLayout := ""
+	if len(sources) > 0 {
+		if flat && len(sources) > 1 {
+			return fmt.Errorf("--flat-artifacts only applies to experiments with a single artifact source")
+		}
+		if !flat {
+			artifactLayout = artifactLayoutPerSource
+		}
+	}
 	artifactPatternCombined := combinePatterns(flattenPatternsFromSources(sources))
 	if artifactPatternCombined == "" {
 		artifactPatternCombined = combinePatterns(patterns)
@@ -881,18 +2105,6 @@ func cmdRun(args []string) error {
 		scriptArgs = append([]string(nil), runFile.Args...)
 	}
 
-	// Remote log template, include %j for the job id (interpreted by sbatch on remote).
-	logTemplate := filepath.Join(logDir, fmt.Sprintf("%s-%%j.out", name))
-
-	// Submit via ssh + sbatch.
-	jobID, sshOut, err := submitSbatchSSH(remote, logTemplate, script, scriptArgs)
-	if err != nil {
-		return err
-	}
-
-	// Final remote log path (with job id substituted).
-	logPath := strings.ReplaceAll(logTemplate, "%j", jobID)
-
 	gitDirs := []string{}
 	if script != "" {
 		if dir := filepath.Dir(script); dir != "" && dir != "." {
@@ -903,43 +2115,91 @@ func cmdRun(args []string) error {
 		gitDirs = append(gitDirs, artifactRemote)
 	}
 
-	// Remote git info (try script dir, then artifact remote); fall back to local if unavailable.
-	commit, branch := "", ""
-	for _, dir := range gitDirs {
-		if dir == "" {
-			continue
-		}
-		fmt.Printf("Attempting remote git lookup at %s:%s\n", remote, dir)
-		if c, b, err := getRemoteGitInfo(remote, dir); err == nil {
-			commit, branch = c, b
-			fmt.Printf("Remote git lookup succeeded at %s:%s (commit=%s branch=%s)\n", remote, dir, commit, branch)
-			break
-		} else {
-			fmt.Printf("Warning: unable to read remote git info from %s: %v\n", dir, err)
+	// One session for the hostname, git info (script dir, then artifact
+	// remote) and path checks; separate git calls if that fails.
+	preflightStart := time.Now()
+	preflight, err := runPreflight(remote, sshOpts, gitDirs, []string{script, logDir})
+	if err != nil {
+		fmt.Printf("Warning: remote preflight failed (%v); looking up git info separately\n", err)
+	} else {
+		fmt.Printf("Remote host: %s\n", preflight.Hostname)
+		if err := checkRemotePaths(remote, preflight, script, logDir); err != nil {
+			return err
 		}
 	}
+	commit, branch, tried := remoteGitInfo(remote, sshOpts, preflight, gitDirs)
+	if verbose && preflight != nil {
+		fmt.Printf("Preflight: 1 ssh round trip instead of %d (%s)\n",
+			preflightRoundTrips(tried, 2), time.Since(preflightStart).Round(time.Millisecond))
+	}
+
+	// Remote log template, include %j for the job id (interpreted by sbatch on remote).
+	logTemplate := filepath.Join(logDir, fmt.Sprintf("%s-%%j.out", name))
+
+	// Submit via ssh + sbatch.
+	jobID, jobCluster, sshOut, err := submitSbatchSSH(remote, sshOpts, cluster, logTemplate, script, scriptArgs)
+	if err != nil {
+		return err
+	}
+
+	// Final remote log path (with job id substituted).
+	logPath := strings.ReplaceAll(logTemplate, "%j", jobID)
+
+	// Fall back to local git info if the remote has none.
 	if commit == "" && branch == "" {
 		fmt.Println("Warning: unable to determine remote git directory; recording local git metadata")
 		commit, branch = getGitInfo()
 	}
 
 	snapshot := RunSnapshot{
-		Name:               name,
-		Remote:             remote,
-		LogDir:             logDir,
-		Script:             script,
-		BuildScript:        buildScript,
-		ArtifactPatterns:   append([]string(nil), patterns...),
-		ArtifactRemote:     artifactRemote,
-		ArtifactDest:       artifactDestAbs,
-		ArtifactPattern:    artifactPatternCombined,
-		ArtifactSinceStart: artifactSinceStart,
-		PollInterval:       pollInterval.String(),
-		Args:               append([]string(nil), scriptArgs...),
-		Profile:            profileName,
-		GitCommit:          commit,
-		GitBranch:          branch,
-	}
+		Name:                 name,
+		Remote:               remote,
+		LogDir:               logDir,
+		Script:               script,
+		BuildScript:          buildScript,
+		BuildScriptInline:    buildInline,
+		ArtifactPatterns:     append([]string(nil), patterns...),
+		ArtifactRemote:       artifactRemote,
+		ArtifactDest:         artifactDestAbs,
+		ArtifactSources:      copyArtifactSources(sources),
+		ArtifactPattern:      artifactPatternCombined,
+		PatternSyntax:        patternSyntax,
+		MinSize:              minSize,
+		MaxSize:              maxSize,
+		BWLimit:              bwLimit,
+		Compress:             compress,
+		CompressLevel:        compressLevel,
+		Parallel:             parallel,
+		ArtifactLayout:       artifactLayout,
+		RsyncRetries:         rsyncRetries,
+		RsyncBackoff:         rsyncBackoff,
+		ListRetries:          listRetries,
+		ListRetryDelay:       listRetryDelay,
+		FallbackNoTimeFilter: fallbackNoTimeFilter != nil && *fallbackNoTimeFilter,
+		Checksum:             checksum != nil && *checksum,
+		CaptureSeff:          captureSeff != nil && *captureSeff,
+		NotifyLocal:          notifyLocal != nil && *notifyLocal,
+		ConfirmOver:          confirmOver,
+		DeferLargeSync:       deferLargeSync != nil && *deferLargeSync,
+		SyncInterval:         syncInterval,
+		TransferRemote:       transferRemote,
+		SettleDelay:          settleDelay,
+		SettleMaxWait:        settleMaxWait,
+		AssumeCompletedAfter: assumeCompleted,
+		PendingCheckInterval: pendingCheck,
+		StallAfter:           stallAfter,
+		Cluster:              jobCluster,
+		ProgressRegex:        progressRegex,
+		MaxMonitor:           maxMonitor,
+		ArtifactSinceStart:   artifactSinceStart,
+		PollInterval:         pollInterval.String(),
+		Metrics:              metricSpecs,
+		Args:                 append([]string(nil), scriptArgs...),
+		Profile:              profileName,
+		GitCommit:            commit,
+		GitBranch:            branch,
+	}
+	snapshot.setSSHOptions(sshOpts)
 	if configPath != "" {
 		snapshot.ConfigFile = configPath
 	}
@@ -960,38 +2220,62 @@ func cmdRun(args []string) error {
 	createdAt := time.Now().UTC()
 	now := createdAt.Format(time.RFC3339)
 
-	res, err := db.Exec(
-		`INSERT INTO experiments (name, remote, script_path, args, git_commit, git_branch, job_id, job_status, log_path,
-                                  created_at, completed_at, artifact_remote, artifact_dest, artifact_pattern,
-                                  artifact_since_start, artifact_last_sync, artifact_last_error, config_snapshot)
-         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		name, remote, script, strings.Join(scriptArgs, " "), commit, branch, jobID, "SUBMITTED", logPath,
-		now, "", primaryRemote, artifactDestAbs, artifactPatternCombined, boolToInt(artifactSinceStart), "", "", snapshotJSON,
-	)
-	if err != nil {
-		return fmt.Errorf("insert experiment: %w", err)
-	}
-	id, _ := res.LastInsertId()
+	warnDuplicateJob(db, remote, jobID)
+
+	// The per-ID destination needs the new row's id; insert and point the row
+	// at it in one transaction so a crash cannot leave it half-written.
+	var id int64
 	artifactDestFinal := artifactDestAbs
-	if artifactDestAbs != "" {
-		artifactDestFinal = filepath.Join(artifactDestAbs, fmt.Sprintf("%d", id))
-		if err := os.MkdirAll(artifactDestFinal, 0o755); err != nil {
-			return fmt.Errorf("ensure artifact destination %s: %w", artifactDestFinal, err)
+	argsDisplay, argsJSON := argsColumns(scriptArgs)
+	err = inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`INSERT INTO experiments (name, remote, script_path, args, args_json, git_commit, git_branch, job_id, job_status, log_path,
+                                  created_at, completed_at, artifact_remote, artifact_dest, artifact_pattern,
+                                  artifact_since_start, artifact_last_sync, artifact_last_error, config_snapshot, cluster)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, remote, script, argsDisplay, argsJSON, commit, branch, jobID, "SUBMITTED", logPath,
+			now, "", primaryRemote, artifactDestAbs, artifactPatternCombined, boolToInt(artifactSinceStart), "", "", snapshotJSON,
+			nullString(jobCluster),
+		)
+		if err != nil {
+			return fmt.Errorf("insert experiment: %w", err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
 		}
+		if err := writeArtifactSources(tx, id, sources); err != nil {
+			return err
+		}
+		if artifactDestAbs == "" {
+			return nil
+		}
+		artifactDestFinal = filepath.Join(artifactDestAbs, fmt.Sprintf("%d", id))
 		snapshot.ArtifactDest = artifactDestFinal
 		snapshotBytes, err := json.Marshal(snapshot)
 		if err != nil {
 			return fmt.Errorf("marshal config snapshot: %w", err)
 		}
 		snapshotJSON = string(snapshotBytes)
-		if _, err := db.Exec(`UPDATE experiments SET artifact_dest = ?, config_snapshot = ? WHERE id = ?`,
+		if _, err := tx.Exec(`UPDATE experiments SET artifact_dest = ?, config_snapshot = ? WHERE id = ?`,
 			artifactDestFinal, snapshotJSON, id); err != nil {
 			return fmt.Errorf("update experiment destination: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if artifactDestAbs != "" {
+		if err := os.MkdirAll(artifactDestFinal, 0o755); err != nil {
+			return fmt.Errorf("ensure artifact destination %s: %w", artifactDestFinal, err)
+		}
 	}
 
 	fmt.Printf("Remote:       %s\n", remote)
 	fmt.Printf("Submitted job %s via ssh\n", jobID)
+	if jobCluster != "" {
+		fmt.Printf("Cluster:      %s\n", jobCluster)
+	}
 	fmt.Printf("ssh/sbatch output: %s\n", strings.TrimSpace(sshOut))
 	fmt.Printf("Recorded experiment %d locally\n", id)
 	fmt.Printf("Remote log will be at: %s\n", logPath)
@@ -1003,6 +2287,7 @@ func cmdRun(args []string) error {
 		ID:                 id,
 		Name:               name,
 		Remote:             remote,
+		Cluster:            jobCluster,
 		ScriptPath:         script,
 		Args:               strings.Join(scriptArgs, " "),
 		GitCommit:          commit,
@@ -1019,73 +2304,253 @@ func cmdRun(args []string) error {
 		ConfigSnapshot:     snapshotJSON,
 	}
 
+	if detach {
+		if pid, ok := runningMonitorPID(); ok {
+			fmt.Printf("Detached; the monitor daemon (pid %d) will track job %s\n", pid, jobID)
+		} else {
+			fmt.Printf("Detached; no monitor daemon is running, start one with: exp monitor --daemon\n")
+		}
+		return nil
+	}
+
 	fmt.Printf("Monitoring job %s every %s ...\n", jobID, pollInterval)
-	if err := monitorExperiment(db, exp, pollInterval); err != nil {
+	if err := monitorExperiment(db, exp, pollInterval, monitorOptions{FollowLog: followLogFlag, MaxMonitor: maxMonitorDuration}); err != nil {
 		return err
 	}
+	if exp.JobCategory.failure() {
+		// For wrapper scripts; the outcome is already printed.
+		return exitStatus(1)
+	}
 	return nil
 }
 
 func cmdList(args []string) error {
 	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var columnsFlag string
+	var verbose bool
+	fs.StringVar(&columnsFlag, "columns", "", "Comma-separated columns to show: id,name,remote,cluster,job_id,status,outcome,reason,starts,progress,created_at,elapsed,exit_code,max_rss,synced and/or metric keys (e.g. id,name,recall@10)")
+	fs.BoolVar(&verbose, "verbose", false, "Also print which database file is in use (on stderr)")
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: exp list\n")
+		fmt.Fprintf(os.Stderr, "Usage: exp list [--columns id,name,status,recall@10] [--verbose]\n")
 		fs.PrintDefaults()
 	}
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	columns := defaultListColumns
+	if columnsFlag != "" {
+		columns = splitCommaValues([]string{columnsFlag})
+	}
+	var metricKeys []string
+	for _, col := range columns {
+		if _, ok := listColumnWidths[col]; !ok {
+			metricKeys = append(metricKeys, col)
+		}
+	}
+
 	db, err := openDB()
 	if err != nil {
 		return fmt.Errorf("open DB: %w", err)
 	}
 	defer db.Close()
+	if verbose {
+		printDBPath()
+	}
 
-	rows, err := db.Query(`SELECT id, name, remote, job_id, job_status, created_at FROM experiments ORDER BY created_at DESC`)
+	exps, err := loadExperiments(db, "")
 	if err != nil {
 		return fmt.Errorf("query experiments: %w", err)
 	}
-	defer rows.Close()
+	metrics, err := loadMetricTable(db, metricKeys)
+	if err != nil {
+		return fmt.Errorf("query metrics: %w", err)
+	}
 
-	fmt.Printf("%-5s %-25s %-22s %-10s %-12s %-20s\n", "ID", "NAME", "REMOTE", "JOB_ID", "STATUS", "CREATED_AT")
-	for rows.Next() {
-		var id int64
-		var name, remote, jobID, status, created string
-		if err := rows.Scan(&id, &name, &remote, &jobID, &status, &created); err != nil {
-			return err
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = strings.ToUpper(col)
+	}
+	printListRow(columns, header, nil)
+	color := isTerminal(os.Stdout)
+	for _, exp := range exps {
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			row[i] = listColumnValue(exp, metrics[exp.ID], col)
+		}
+		var paint func(col, cell string) string
+		if color && exp.JobCategory.failure() {
+			// Failed jobs stand out in red; the reason column says why.
+			paint = func(col, cell string) string {
+				if col == "status" || col == "outcome" {
+					return "\033[31m" + cell + "\033[0m"
+				}
+				return cell
+			}
+		} else if color && exp.stalled() {
+			// Stalled ones in yellow, reason included.
+			paint = func(col, cell string) string {
+				if col == "status" || col == "reason" {
+					return "\033[33m" + cell + "\033[0m"
+				}
+				return cell
+			}
 		}
-		fmt.Printf("%-5d %-25s %-22s %-10s %-12s %-20s\n", id, name, remote, jobID, status, created)
+		printListRow(columns, row, paint)
 	}
-	return rows.Err()
+	return nil
 }
 
-func cmdShow(args []string) error {
-	fs := flag.NewFlagSet("show", flag.ExitOnError)
-	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: exp show <id>\n")
-		fs.PrintDefaults()
-	}
-	if err := fs.Parse(args); err != nil {
-		return err
-	}
-	if fs.NArg() != 1 {
-		fs.Usage()
-		return fmt.Errorf("id is required")
-	}
-	idStr := fs.Arg(0)
+var defaultListColumns = []string{"id", "name", "remote", "job_id", "status", "created_at"}
+
+// listColumnWidths holds the built-in exp list columns; any other column name
+// is treated as a metric key.
+var listColumnWidths = map[string]int{
+	"id":         5,
+	"name":       25,
+	"remote":     22,
+	"cluster":    12,
+	"job_id":     10,
+	"status":     12,
+	"outcome":    9,
+	"reason":     30,
+	"starts":     20,
+	"progress":   16,
+	"created_at": 20,
+	"elapsed":    11,
+	"exit_code":  9,
+	"max_rss":    10,
+	"synced":     14,
+}
+
+const listMetricWidth = 12
+
+func listColumnValue(exp *Experiment, metrics map[string]float64, col string) string {
+	switch col {
+	case "id":
+		return strconv.FormatInt(exp.ID, 10)
+	case "name":
+		return exp.Name
+	case "remote":
+		return exp.Remote
+	case "cluster":
+		if exp.Cluster == "" {
+			return "-"
+		}
+		return exp.Cluster
+	case "job_id":
+		return exp.JobID
+	case "status":
+		if exp.stalled() {
+			// Unlike an ordinary pending job, this one needs looking at.
+			return "STALLED"
+		}
+		return exp.JobStatus
+	case "outcome":
+		if exp.JobCategory == jobActive {
+			return "-"
+		}
+		return string(exp.JobCategory)
+	case "reason":
+		// Why it ended, or why it is still waiting.
+		if e, ok := exp.lastPendingEstimate(); ok && e.Reason != "" {
+			return e.Reason
+		}
+		if exp.JobReason == "" {
+			return "-"
+		}
+		return exp.JobReason
+	case "starts":
+		if e, ok := exp.lastPendingEstimate(); ok && !e.Start.IsZero() {
+			return e.Start.Local().Format(time.RFC3339)
+		}
+		return "-"
+	case "progress":
+		if exp.Progress.Text == "" {
+			return "-"
+		}
+		return exp.Progress.describe()
+	case "created_at":
+		if exp.CreatedAt.IsZero() {
+			return ""
+		}
+		return exp.CreatedAt.Format(time.RFC3339)
+	case "elapsed":
+		if exp.Accounting.Elapsed < 0 {
+			return "-"
+		}
+		return formatSlurmDuration(exp.Accounting.Elapsed)
+	case "exit_code":
+		if exp.Accounting.ExitCode == "" {
+			return "-"
+		}
+		return exp.Accounting.ExitCode
+	case "max_rss":
+		if exp.Accounting.MaxRSS <= 0 {
+			return "-"
+		}
+		return formatBytes(exp.Accounting.MaxRSS)
+	case "synced":
+		return syncedColumn(exp)
+	}
+	if v, ok := metrics[col]; ok {
+		return formatMetric(v)
+	}
+	return "-"
+}
+
+// printListRow prints one padded row; paint, when set, decorates a padded
+// cell.
+func printListRow(columns, values []string, paint func(col, cell string) string) {
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		width, ok := listColumnWidths[col]
+		if !ok {
+			width = listMetricWidth
+			if len(col) > width {
+				width = len(col)
+			}
+		}
+		parts[i] = fmt.Sprintf("%-*s", width, values[i])
+		if paint != nil {
+			parts[i] = paint(col, parts[i])
+		}
+	}
+	fmt.Println(strings.TrimRight(strings.Join(parts, " "), " "))
+}
+
+func cmdShow(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	var jobID, remote string
+	var verbose, usage bool
+	fs.BoolVar(&verbose, "verbose", false, "Also print which database file is in use (on stderr)")
+	fs.BoolVar(&usage, "usage", false, "Also print the seff efficiency report captured when the job finished (capture_seff)")
+	fs.StringVar(&jobID, "job-id", "", "Show the experiment that submitted this Slurm job instead of giving its id")
+	fs.StringVar(&remote, "remote", "", "With --job-id, the cluster (user@host or host) when the job ID exists on several")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp show <id> [--usage] [--verbose]\n       exp show --job-id JOBID [--remote HOST] [--usage] [--verbose]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	idStr, err := experimentArg(fs.Args(), jobID, remote)
+	if err != nil {
+		fs.Usage()
+		return err
+	}
 
 	db, err := openDB()
 	if err != nil {
 		return fmt.Errorf("open DB: %w", err)
 	}
 	defer db.Close()
+	if verbose {
+		printDBPath()
+	}
 
-	exp, err := loadExperimentByID(db, idStr)
+	exp, err := findExperiment(db, idStr)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("no experiment with id %s", idStr)
-		}
 		return err
 	}
 
@@ -1093,13 +2558,44 @@ func cmdShow(args []string) error {
 	fmt.Println("-------------")
 	fmt.Printf("Name:        %s\n", exp.Name)
 	fmt.Printf("Remote:      %s\n", exp.Remote)
+	if exp.Cluster != "" {
+		fmt.Printf("Cluster:     %s\n", exp.Cluster)
+	}
 	fmt.Printf("Job ID:      %s\n", exp.JobID)
 	fmt.Printf("Job status:  %s\n", exp.JobStatus)
+	if outcome := exp.outcomeLine(); outcome != "" {
+		if exp.JobCategory.failure() && isTerminal(os.Stdout) {
+			outcome = "\033[31m" + outcome + "\033[0m"
+		}
+		fmt.Printf("Outcome:     %s\n", outcome)
+	}
+	if e, ok := exp.lastPendingEstimate(); ok {
+		fmt.Printf("Pending:     %s\n", e.describe())
+	}
+	if exp.stalled() {
+		_, hint := classifyPendingReason(exp.StalledReason)
+		fmt.Printf("Stalled:     %s: %s\n", exp.StalledReason, hint)
+	}
+	if exp.Progress.Line != "" {
+		fmt.Printf("Progress:    %s (as of %s)\n", exp.Progress.describe(), exp.Progress.At.Local().Format(time.RFC3339))
+		fmt.Printf("             %s\n", exp.Progress.Line)
+	}
 	fmt.Printf("Script:      %s\n", exp.ScriptPath)
-	fmt.Printf("Args:        %s\n", exp.Args)
+	if exp.ArgsApproximate {
+		fmt.Printf("Args:        %s (approximate: recorded before exact arguments were kept)\n", formatArgs(exp.ArgList))
+	} else {
+		fmt.Printf("Args:        %s\n", formatArgs(exp.ArgList))
+	}
 	fmt.Printf("Git commit:  %s\n", exp.GitCommit)
 	fmt.Printf("Git branch:  %s\n", exp.GitBranch)
-	fmt.Printf("Remote log:  %s\n", exp.LogPath)
+	if len(exp.Tags) > 0 {
+		fmt.Printf("Tags:        %s\n", strings.Join(exp.Tags, ", "))
+	}
+	if exp.LogArchived && exp.ArtifactDest != "" {
+		fmt.Printf("Remote log:  %s (log archived locally in %s)\n", exp.LogPath, filepath.Join(exp.ArtifactDest, jobLogDir))
+	} else {
+		fmt.Printf("Remote log:  %s\n", exp.LogPath)
+	}
 	if !exp.CreatedAt.IsZero() {
 		fmt.Printf("Created at:  %s\n", exp.CreatedAt.Format(time.RFC3339))
 	} else {
@@ -1108,20 +2604,57 @@ func cmdShow(args []string) error {
 	if !exp.CompletedAt.IsZero() {
 		fmt.Printf("Completed:   %s\n", exp.CompletedAt.Format(time.RFC3339))
 	}
+	if exp.RequeueCount > 0 {
+		fmt.Printf("Requeued:    %d time(s)\n", exp.RequeueCount)
+	}
+	if exp.PreemptCount > 0 {
+		fmt.Printf("Preempted:   %d time(s)\n", exp.PreemptCount)
+	}
+	if d, ok := exp.runDuration(); ok {
+		fmt.Printf("Duration:    %s\n", d)
+	}
+	if exp.Accounting.recorded() {
+		fmt.Printf("Accounting:  %s\n", exp.Accounting.summary())
+	}
+	if exp.Efficiency.captured() {
+		fmt.Printf("Efficiency:  %s\n", exp.Efficiency.summary())
+	}
+	if usage {
+		if exp.Efficiency.captured() {
+			fmt.Println("seff report:")
+			for _, line := range strings.Split(exp.Efficiency.Raw, "\n") {
+				fmt.Printf("  %s\n", line)
+			}
+		} else {
+			fmt.Println("seff report: (none; set capture_seff: true to capture one when the job finishes)")
+		}
+	}
 	if exp.ArtifactRemote != "" {
 		fmt.Printf("Artifacts\n")
 		fmt.Printf("  Remote:    %s\n", exp.ArtifactRemote)
 		fmt.Printf("  Dest:      %s\n", exp.ArtifactDest)
+		if opts := exp.recordedFetchOptions(); opts.PerSource {
+			fmt.Println("  Sources:   (each in its own subdirectory)")
+			for _, src := range exp.EffectiveArtifactSources() {
+				fmt.Printf("    - %s -> %s\n", src.label(), opts.sourceDest(exp.ArtifactDest, src))
+			}
+		} else {
+			for _, src := range exp.EffectiveArtifactSources() {
+				if src.Remote != "" {
+					fmt.Printf("  Host:      %s (for %s)\n", src.Remote, src.Path)
+				}
+			}
+		}
 		if exp.ArtifactPattern != "" {
 			patts := splitPatterns(exp.ArtifactPattern)
 			if len(patts) == 0 {
 				fmt.Printf("  Pattern:   (none)\n")
 			} else if len(patts) == 1 {
-				fmt.Printf("  Pattern:   %s\n", patts[0])
+				fmt.Printf("  Pattern:   %s\n", describePattern(patts[0]))
 			} else {
 				fmt.Println("  Patterns:")
 				for _, p := range patts {
-					fmt.Printf("    - %s\n", p)
+					fmt.Printf("    - %s\n", describePattern(p))
 				}
 			}
 		} else {
@@ -1129,12 +2662,74 @@ func cmdShow(args []string) error {
 		}
 		fmt.Printf("  Since start filter: %t\n", exp.ArtifactSinceStart)
 		if !exp.ArtifactLastSync.IsZero() {
-			fmt.Printf("  Last sync: %s\n", exp.ArtifactLastSync.Format(time.RFC3339))
+			if st := exp.ArtifactSyncStats; st.ManifestPath != "" {
+				fmt.Printf("  Last sync: %s%s (%s)\n", st, st.updatedNote(), exp.ArtifactLastSync.Format(time.RFC3339))
+				fmt.Printf("  Manifest:  %s\n", st.ManifestPath)
+			} else if st.TarPath != "" {
+				fmt.Printf("  Last sync: %s (%s)\n", st, exp.ArtifactLastSync.Format(time.RFC3339))
+				fmt.Printf("  Tar:       %s\n", st.TarPath)
+			} else {
+				fmt.Printf("  Last sync: %s\n", exp.ArtifactLastSync.Format(time.RFC3339))
+			}
+			if st := exp.ArtifactSyncStats; st.Host != "" {
+				fmt.Printf("  Via:       %s\n", st.Host)
+			}
+			if st := exp.ArtifactSyncStats; st.Settle != "" {
+				fmt.Printf("  Settle:    %s\n", st.Settle)
+			}
+			if exp.lastSyncMatchedNothing() {
+				fmt.Println("  " + noFilesMatchedWarning)
+			}
 		}
 		if exp.ArtifactLastError != "" {
 			fmt.Printf("  Last error: %s\n", exp.ArtifactLastError)
 		}
 	}
+	history, err := loadSyncHistory(db, exp.ID, syncHistoryShown)
+	if err != nil {
+		return fmt.Errorf("load sync history: %w", err)
+	}
+	if len(history) > 0 {
+		fmt.Println("Recent syncs:")
+		for _, r := range history {
+			fmt.Printf("  %s  %s\n", r.At.Format(time.RFC3339), r)
+		}
+	}
+	if exp.ArchivePath != "" {
+		fmt.Printf("Archived to: %s\n", exp.ArchivePath)
+	}
+	metrics, err := loadMetrics(db, exp.ID)
+	if err != nil {
+		return fmt.Errorf("load metrics: %w", err)
+	}
+	if len(metrics) > 0 {
+		fmt.Println("Metrics:")
+		printMetrics(metrics)
+	}
+	pushes, err := loadPushes(db, exp.ID)
+	if err != nil {
+		return fmt.Errorf("load pushes: %w", err)
+	}
+	if len(pushes) > 0 {
+		fmt.Println("Remote tree modified after the run (exp push):")
+		for _, p := range pushes {
+			fmt.Printf("  %s  %d file(s), %s -> %s\n", p.PushedAt, p.Files, formatBytes(p.Bytes), p.RemotePath)
+		}
+	}
+	events, err := loadStatusEvents(db, exp.ID)
+	if err != nil {
+		return fmt.Errorf("load status history: %w", err)
+	}
+	if len(events) > 0 {
+		fmt.Println("Status history:")
+		for _, ev := range events {
+			line := fmt.Sprintf("  %s  %s", ev.ObservedAt, ev.Status)
+			if ev.Note != "" {
+				line += "  (" + ev.Note + ")"
+			}
+			fmt.Println(line)
+		}
+	}
 	if exp.ConfigSnapshot != "" {
 		fmt.Println("Config snapshot:")
 		var pretty bytes.Buffer
@@ -1149,29 +2744,131 @@ func cmdShow(args []string) error {
 
 func cmdFetch(args []string) error {
 	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	var f fetchFlags
+	f.rsyncRetries = -1
+	f.rsyncBackoff = durationFlag{value: defaultRsyncBackoff}
+	f.listRetries = -1
+	f.listRetryDelay = durationFlag{value: defaultListRetryDelay}
+	var followSymlinks, preserveSymlinks bool
+	var fileFlag, pruneFlag multiStringFlag
 	var (
-		remotePath  string
-		destDir     string
-		patternFlag multiStringFlag
-		dryRun      bool
+		all         bool
+		statusFlag  multiStringFlag
+		since       string
+		missingOnly bool
+		jobID       string
+		jobRemote   string
 	)
-	var sinceStartFlag boolFlag
-	fs.StringVar(&remotePath, "remote-path", "", "Absolute remote directory/file tree to copy (defaults to recorded artifact path)")
-	fs.StringVar(&destDir, "dest", "", "Local destination directory for fetched files (defaults to recorded artifact destination)")
-	fs.Var(&patternFlag, "pattern", "Regex applied to full remote paths (defaults to recorded artifact patterns); may be repeated")
-	fs.Var(&sinceStartFlag, "since-start", "Only include files newer than the experiment start time (defaults to recorded preference)")
-	fs.BoolVar(&dryRun, "dry-run", false, "Only list files that would be copied")
+	fs.StringVar(&jobID, "job-id", "", "Fetch for the experiment that submitted this Slurm job instead of giving its id")
+	fs.StringVar(&jobRemote, "remote", "", "With --job-id, the cluster (user@host or host) when the job ID exists on several")
+	fs.StringVar(&f.remotePath, "remote-path", "", "Absolute remote directory/file tree to copy (defaults to recorded artifact path)")
+	fs.StringVar(&f.destDir, "dest", "", "Local destination directory for fetched files (defaults to recorded artifact destination)")
+	fs.Var(&f.patterns, "pattern", "Regex applied to full remote paths (defaults to recorded artifact patterns); may be repeated")
+	fs.BoolVar(&f.glob, "glob", false, "Treat --pattern (and recorded patterns) as globs such as *.json or results/**/*.csv")
+	fs.Var(&f.sinceStart, "since-start", "Only include files newer than the experiment start time (defaults to recorded preference)")
+	fs.BoolVar(&f.dryRun, "dry-run", false, "Only list files that would be copied")
+	fs.StringVar(&f.minSize, "min-size", "", "Skip files smaller than this (e.g. 1K; defaults to the recorded min_size)")
+	fs.StringVar(&f.maxSize, "max-size", "", "Skip files larger than this (e.g. 10M, 1.5G; defaults to the recorded max_size)")
+	fs.StringVar(&f.bwLimit, "bwlimit", "", "Limit rsync bandwidth, e.g. 500K or 1.5M (KiB/s when bare; 0 disables; defaults to the recorded bwlimit)")
+	fs.Var(&f.compress, "compress", "Compress the transfer (rsync -z); defaults to the recorded setting, else on when most files are text-like")
+	fs.IntVar(&f.level, "compress-level", 0, "rsync compression level (1-9); implies --compress")
+	fs.IntVar(&f.parallel, "parallel", 0, "Number of artifact sources to fetch at once (defaults to the recorded parallel setting, else 3)")
+	fs.BoolVar(&f.mirror, "mirror", false, "Delete local files matching the patterns that no longer exist remotely (only in the experiment's own artifact directory)")
+	fs.IntVar(&f.latest, "latest", 0, "Only fetch the N most recently modified matching files (applied after patterns)")
+	fs.BoolVar(&f.latestPerDir, "latest-per-dir", false, "Apply --latest within each directory instead of across the whole tree")
+	fs.IntVar(&f.rsyncRetries, "rsync-retries", -1, fmt.Sprintf("Re-run rsync this many times after network failures (defaults to the recorded setting, else %d)", defaultRsyncRetries))
+	fs.Var(&f.rsyncBackoff, "rsync-backoff", "Wait before the first rsync retry, doubling each time")
+	fs.IntVar(&f.listRetries, "list-retries", -1, fmt.Sprintf("Retry an empty remote listing this many times; only applies with --after-completion (defaults to the recorded setting, else %d)", defaultListRetries))
+	fs.Var(&f.listRetryDelay, "list-retry-delay", "Wait between listing retries")
+	fs.IntVar(&f.listLimit, "list-limit", 0, "Fail instead of handling a remote listing of more than this many files (0 means no limit)")
+	fs.BoolVar(&f.afterCompletion, "after-completion", false, "Treat this as the sync right after the job finished: retry empty listings while results reach the shared filesystem")
+	fs.Var(&f.fallbackNoTimeFilter, "fallback-no-time-filter", "When the time window matches nothing, list again without it (defaults to the recorded setting)")
+	fs.BoolVar(&f.appendVerify, "append-verify", false, "Resume partially transferred files with rsync --append-verify")
+	fs.StringVar(&f.confirmOver, "confirm-over", "", "Ask before transferring more than this much data (e.g. 5G; 0 never asks; defaults to the recorded confirm_over)")
+	fs.BoolVar(&f.withLog, "with-log", false, "Also copy the job's log file(s) into <dest>/logs/")
+	fs.Var(&f.checksum, "checksum", "Compare file contents (rsync -c) instead of size and mtime, for files rewritten in place, and record each file's sha256 in the fetch manifest (default off, or the run's checksum setting)")
+	fs.BoolVar(&f.strict, "strict", false, "Fail the sync when remote files or directories are unreadable instead of skipping them with a warning")
+	fs.BoolVar(&f.yes, "yes", false, "Do not prompt before a large --checksum comparison or a transfer over --confirm-over")
+	fs.StringVar(&f.transfer, "transfer", "", "Transfer backend: auto (rsync, else tar over ssh), rsync, scp (one sftp session) or tar")
+	fs.BoolVar(&f.full, "full", false, "Transfer every matching file even if the last sync's manifest says it is unchanged")
+	fs.StringVar(&f.via, "via", "", "user@host (e.g. a data-transfer node) to list and rsync through instead of the submission host; sources with their own remote keep it (defaults to the recorded transfer_remote)")
+	fs.StringVar(&f.remoteHost, "artifact-remote-host", "", "user@host to list and rsync artifacts from instead of the submission host (applies to every source)")
+	fs.BoolVar(&followSymlinks, "follow-symlinks", false, "Fetch what symlinks point at as regular files (find -L, rsync --copy-links); loops are detected and skipped")
+	fs.BoolVar(&preserveSymlinks, "preserve-symlinks", false, "Fetch symlinks as symlinks instead of skipping them")
+	fs.Var(&pruneFlag, "prune", "Never descend into remote directories with this basename (e.g. checkpoints), on top of the recorded prune_dirs; may be repeated or comma-separated")
+	fs.BoolVar(&f.flatten, "flatten", false, "Drop remote directories: results/run1/metrics.json lands as results_run1_metrics.json")
+	fs.Var(&f.flat, "flat-artifacts", "Fetch a single source straight into --dest instead of <dest>/<source-name>/ (defaults to the recorded layout)")
+	fs.Var(&fileFlag, "file", "Fetch only these files (relative to a source, absolute, or SOURCE:PATH), skipping the remote listing; may be repeated or comma-separated")
+	fs.BoolVar(&f.stdout, "stdout", false, "With a single --file, write its contents to standard output instead of the destination")
+	fs.StringVar(&f.tarPath, "tar", "", "Write the matching files to this tar archive (- for stdout) instead of syncing into --dest")
+	fs.BoolVar(&f.gzip, "gzip", false, "Gzip the --tar archive")
+	fs.BoolVar(&all, "all", false, "Fetch every experiment matching --status/--since/--missing-only instead of a single id")
+	fs.Var(&statusFlag, "status", "With --all, only fetch experiments with this job status; may be repeated or comma-separated (default COMPLETED)")
+	fs.StringVar(&since, "since", "", "Only fetch files modified after this timestamp or age (e.g. 2024-05-01T12:00:00Z, 6h); with --all, instead only fetch experiments completed within this long (e.g. 7d)")
+	fs.BoolVar(&f.sinceLastSync, "since-last-sync", false, "Only fetch files modified since the last successful sync (falls back to --since-start without one)")
+	fs.BoolVar(&missingOnly, "missing-only", false, "With --all, skip experiments whose artifacts were synced after they completed")
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: exp fetch <id> --remote-path REMOTE --dest LOCAL [--pattern REGEX] [--since-start] [--dry-run]\n")
+		fmt.Fprintf(os.Stderr, "Usage: exp fetch <id> --remote-path REMOTE --dest LOCAL [--pattern REGEX] [--glob] [--min-size 1K] [--max-size 10M] [--bwlimit 1M] [--compress[=false]] [--compress-level N] [--parallel N] [--latest N [--latest-per-dir]] [--flat-artifacts] [--flatten] [--follow-symlinks | --preserve-symlinks] [--artifact-remote-host user@host | --via user@host] [--mirror] [--full] [--rsync-retries N] [--append-verify] [--after-completion [--list-retries N]] [--fallback-no-time-filter] [--list-limit N] [--prune DIR] [--strict] [--transfer auto|rsync|scp|tar] [--checksum[=false] [--yes]] [--with-log] [--confirm-over 5G] [--since-start | --since-last-sync | --since 6h] [--dry-run]\n")
+		fmt.Fprintf(os.Stderr, "       exp fetch <id> --file REL_PATH[,REL_PATH...] [--stdout] [--dest LOCAL] [--transfer auto|rsync|scp|tar] [--dry-run]\n")
+		fmt.Fprintf(os.Stderr, "       exp fetch <id> --tar PATH|- [--gzip] [--pattern REGEX] [--since-start | --since-last-sync | --since 6h] [--dry-run]\n")
+		fmt.Fprintf(os.Stderr, "       exp fetch --job-id JOBID [--remote HOST] [fetch options]\n")
+		fmt.Fprintf(os.Stderr, "       exp fetch --all [--status COMPLETED] [--since 7d] [--missing-only] [fetch options]\n")
 		fs.PrintDefaults()
 	}
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	switch {
+	case followSymlinks && preserveSymlinks:
+		return fmt.Errorf("--follow-symlinks and --preserve-symlinks are mutually exclusive")
+	case followSymlinks:
+		f.symlinks = symlinksFollow
+	case preserveSymlinks:
+		f.symlinks = symlinksPreserve
+	}
+	f.files = splitCommaValues(fileFlag.Values())
+	f.prune = splitCommaValues(pruneFlag.Values())
+	if err := f.validate(); err != nil {
+		return err
+	}
+	var err error
 
-	if fs.NArg() != 1 {
+	if all {
+		if fs.NArg() != 0 || jobID != "" {
+			fs.Usage()
+			return fmt.Errorf("--all does not take an experiment id or --job-id")
+		}
+		if f.remotePath != "" || f.destDir != "" {
+			return fmt.Errorf("--remote-path and --dest apply to a single experiment, not --all")
+		}
+		if len(f.files) > 0 || f.tarPath != "" {
+			return fmt.Errorf("--file and --tar apply to a single experiment, not --all")
+		}
+		sel := fetchSelection{Statuses: splitCommaValues(statusFlag.Values()), MissingOnly: missingOnly}
+		if since != "" {
+			age, err := parseAge(since)
+			if err != nil {
+				return fmt.Errorf("since: %w", err)
+			}
+			sel.CompletedAfter = time.Now().UTC().Add(-age)
+		}
+		return fetchAll(sel, f)
+	}
+	if len(statusFlag.Values()) > 0 || missingOnly {
+		return fmt.Errorf("--status and --missing-only require --all")
+	}
+	if since != "" {
+		if f.since, err = parseSinceTime(since, time.Now()); err != nil {
+			return fmt.Errorf("since: %w", err)
+		}
+		if f.mirror {
+			return fmt.Errorf("--mirror cannot be combined with --since")
+		}
+	}
+	idStr, err := experimentArg(fs.Args(), jobID, jobRemote)
+	if err != nil {
 		fs.Usage()
-		return fmt.Errorf("experiment id is required")
+		return err
 	}
 	db, err := openDB()
 	if err != nil {
@@ -1179,399 +2876,2089 @@ func cmdFetch(args []string) error {
 	}
 	defer db.Close()
 
-	idStr := fs.Arg(0)
-	exp, err := loadExperimentByID(db, idStr)
+	exp, err := findExperiment(db, idStr)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("no experiment with id %s", idStr)
-		}
 		return err
 	}
-	if exp.Remote == "" {
-		return fmt.Errorf("experiment %s has empty remote host", idStr)
+	if len(f.files) > 0 {
+		return fetchNamedFiles(db, exp, f)
+	}
+	var out io.Writer = os.Stdout
+	if f.tarPath == "-" && !f.dryRun {
+		// Only the archive may reach stdout; progress goes to stderr.
+		out = os.Stderr
+	}
+	f.out = out
+	stats, err := fetchExperiment(db, exp, f)
+	if err != nil || f.dryRun {
+		return err
 	}
+	fmt.Fprintf(out, "Fetch complete: %s%s.\n", stats, stats.updatedNote())
+	if w := stats.skippedWarning(); w != "" {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	return nil
+}
+
+// fetchFlags holds exp fetch's per-experiment options; zero values fall back
+// to what the experiment recorded at run time.
+type fetchFlags struct {
+	remotePath           string
+	destDir              string
+	patterns             multiStringFlag
+	glob                 bool
+	sinceStart           boolFlag
+	sinceLastSync        bool
+	since                time.Time
+	dryRun               bool
+	minSize              string
+	maxSize              string
+	bwLimit              string
+	compress             boolFlag
+	level                int
+	parallel             int
+	mirror               bool
+	latest               int
+	latestPerDir         bool
+	rsyncRetries         int
+	rsyncBackoff         durationFlag
+	listRetries          int
+	listRetryDelay       durationFlag
+	listLimit            int
+	afterCompletion      bool
+	fallbackNoTimeFilter boolFlag
+	appendVerify         bool
+	confirmOver          string
+	checksum             boolFlag
+	yes                  bool
+	transfer             string
+	withLog              bool
+	full                 bool
+	flat                 boolFlag
+	flatten              bool
+	symlinks             string   // overrides every source's setting when set
+	remoteHost           string   // overrides every source's host when set
+	via                  string   // replaces the submission host for transfers
+	prune                []string // added to every source's prune_dirs
+	files                []string
+	stdout               bool
+	tarPath              string
+	gzip                 bool
+	strict               bool
+	out                  io.Writer // progress output; nil is stdout
+}
 
-	if remotePath != "" && !strings.HasPrefix(remotePath, "/") {
+// validate checks the flags that do not depend on an experiment.
+func (f fetchFlags) validate() error {
+	if f.remotePath != "" && !strings.HasPrefix(f.remotePath, "/") {
 		return fmt.Errorf("remote-path must be absolute so rsync can address files precisely")
 	}
+	if err := validatePruneDirs(f.prune); err != nil {
+		return fmt.Errorf("--prune: %w", err)
+	}
+	if f.level != 0 {
+		if err := validateCompressLevel(f.level); err != nil {
+			return err
+		}
+	}
+	if f.parallel < 0 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if f.latest < 0 {
+		return fmt.Errorf("--latest must be positive")
+	}
+	if f.listLimit < 0 {
+		return fmt.Errorf("--list-limit must not be negative")
+	}
+	if f.latestPerDir && f.latest == 0 {
+		return fmt.Errorf("--latest-per-dir requires --latest N")
+	}
+	// Pruning needs the full remote listing, not just recently modified files.
+	if f.mirror && f.sinceStart.set && f.sinceStart.value {
+		return fmt.Errorf("--mirror cannot be combined with --since-start")
+	}
+	if f.mirror && f.sinceLastSync {
+		return fmt.Errorf("--mirror cannot be combined with --since-last-sync")
+	}
+	if f.stdout && len(f.files) != 1 {
+		return fmt.Errorf("--stdout requires exactly one --file")
+	}
+	if len(f.files) > 0 && (f.mirror || f.latest > 0) {
+		return fmt.Errorf("--file cannot be combined with --mirror or --latest")
+	}
+	if f.gzip && f.tarPath == "" {
+		return fmt.Errorf("--gzip requires --tar")
+	}
+	if f.via != "" {
+		if f.remoteHost != "" {
+			return fmt.Errorf("--via cannot be combined with --artifact-remote-host")
+		}
+		if err := validateRemoteHost(f.via); err != nil {
+			return fmt.Errorf("--via: %w", err)
+		}
+	}
+	if f.tarPath != "" && (f.mirror || f.withLog || len(f.files) > 0) {
+		return fmt.Errorf("--tar cannot be combined with --mirror, --with-log or --file")
+	}
+	return nil
+}
+
+// fetchExperiment resolves the sources, destination and options for exp,
+// syncs them, and records the outcome.
+func fetchExperiment(db *sql.DB, exp *Experiment, f fetchFlags) (syncStats, error) {
+	sources, destDir, opts, err := resolveFetch(db, exp, f)
+	if err != nil {
+		return syncStats{}, err
+	}
+	// The sync is stamped with when its listing started, so files written
+	// while it transferred are newer than the next since-last-sync cutoff.
+	started := time.Now().UTC()
+	stats, err := fetchArtifactSources(exp, sources, destDir, opts)
+	if errors.Is(err, errFetchDeclined) {
+		return syncStats{}, err
+	}
+	if f.tarPath != "" {
+		// An archive is an export, not a sync of the destination.
+		return stats, err
+	}
+	if err != nil {
+		if err2 := recordArtifactSync(db, exp.ID, nil, nil, err.Error()); err2 != nil {
+			return syncStats{}, fmt.Errorf("%v (additionally failed to record sync state: %w)", err, err2)
+		}
+		return syncStats{}, err
+	}
+	if f.dryRun {
+		return stats, nil
+	}
+
+	if err := recordArtifactSync(db, exp.ID, &started, &stats, ""); err != nil {
+		return stats, err
+	}
+	if err := resumeDeferredSync(db, exp); err != nil {
+		return stats, err
+	}
+	syncMetrics(db, exp, destDir)
+	if f.withLog {
+		archiveJobLogs(db, exp, destDir)
+	}
+	return stats, nil
+}
 
+// resolveFetch works out the sources, destination and options for exp from
+// the flags and its recorded settings.
+func resolveFetch(db *sql.DB, exp *Experiment, f fetchFlags) ([]ArtifactSource, string, fetchOptions, error) {
+	if exp.Remote == "" {
+		return nil, "", fetchOptions{}, fmt.Errorf("experiment %d has empty remote host", exp.ID)
+	}
+	destDir := f.destDir
 	if destDir == "" {
 		destDir = exp.ArtifactDest
 	}
-	if destDir == "" {
-		return fmt.Errorf("dest is required and no artifact destination is recorded for experiment %s", idStr)
+	if destDir == "" && f.tarPath == "" {
+		return nil, "", fetchOptions{}, fmt.Errorf("dest is required and no artifact destination is recorded for experiment %d", exp.ID)
 	}
 
-	sinceStart := exp.ArtifactSinceStart
-	if sinceStartFlag.set {
-		sinceStart = sinceStartFlag.value
+	var err error
+	opts := exp.recordedFetchOptions()
+	opts.DryRun = f.dryRun
+	if f.sinceStart.set {
+		opts.SinceStart = f.sinceStart.value
+	}
+	opts.SinceLastSync = f.sinceLastSync
+	opts.Since = f.since
+	if f.minSize != "" || f.maxSize != "" {
+		snap := exp.runSnapshot()
+		minSize, maxSize := f.minSize, f.maxSize
+		if minSize == "" {
+			minSize = snap.MinSize
+		}
+		if maxSize == "" {
+			maxSize = snap.MaxSize
+		}
+		if opts.MinSize, opts.MaxSize, err = parseSizeLimits(minSize, maxSize); err != nil {
+			return nil, "", fetchOptions{}, err
+		}
+	}
+	if f.bwLimit != "" {
+		if opts.BWLimit, err = parseBWLimit(f.bwLimit); err != nil {
+			return nil, "", fetchOptions{}, err
+		}
+	}
+	if f.compress.set {
+		compress := f.compress.value
+		opts.Compress = &compress
+	}
+	if f.level != 0 {
+		opts.CompressLevel = f.level
+		if opts.Compress == nil {
+			on := true
+			opts.Compress = &on
+		}
+	}
+	if f.parallel > 0 {
+		opts.Parallel = f.parallel
 	}
 
-	overridePatterns := patternFlag.Values()
+	overridePatterns := f.patterns.Values()
 	sources := exp.EffectiveArtifactSources()
-	if remotePath != "" {
-		if !strings.HasPrefix(remotePath, "/") {
-			return fmt.Errorf("remote-path must be absolute so rsync can address files precisely")
-		}
-		sources = []ArtifactSource{{Path: remotePath, Patterns: splitPatterns(exp.ArtifactPattern)}}
+	if f.remotePath != "" {
+		sources = []ArtifactSource{{Path: f.remotePath, Patterns: splitPatterns(exp.ArtifactPattern), PatternSyntax: exp.runSnapshot().PatternSyntax}}
 	}
 	if len(sources) == 0 {
-		return fmt.Errorf("no artifact sources recorded for experiment %s; use --remote-path", idStr)
+		return nil, "", fetchOptions{}, fmt.Errorf("no artifact sources recorded for experiment %d; use --remote-path", exp.ID)
 	}
 	if len(overridePatterns) > 0 {
 		for i := range sources {
 			sources[i].Patterns = overridePatterns
+			// Patterns given on the command line are regexes unless --glob.
+			sources[i].PatternSyntax = patternSyntaxRegex
 		}
 	}
-
-	if err := fetchArtifactSources(exp, sources, destDir, sinceStart, dryRun); err != nil {
-		if err2 := recordArtifactSync(db, exp.ID, nil, err.Error()); err2 != nil {
-			return fmt.Errorf("%v (additionally failed to record sync state: %w)", err, err2)
+	forceSyntax := ""
+	if f.glob {
+		forceSyntax = patternSyntaxGlob
+	}
+	if err := applyPatternSyntax(sources, "", forceSyntax); err != nil {
+		return nil, "", fetchOptions{}, err
+	}
+	if err := assignSourceNames(sources); err != nil {
+		return nil, "", fetchOptions{}, err
+	}
+	if f.symlinks != "" {
+		for i := range sources {
+			sources[i].Symlinks = f.symlinks
 		}
-		return err
 	}
-
-	if dryRun {
-		return nil
+	if err := normalizeSourceSymlinks(sources); err != nil {
+		return nil, "", fetchOptions{}, err
 	}
-
-	now := time.Now().UTC()
-	if err := recordArtifactSync(db, exp.ID, &now, ""); err != nil {
-		return err
+	if len(f.prune) > 0 {
+		for i := range sources {
+			sources[i].PruneDirs = append(sources[i].PruneDirs, f.prune...)
+		}
 	}
-	fmt.Println("Fetch complete.")
-	return nil
+	if err := validateSourcePruneDirs(sources); err != nil {
+		return nil, "", fetchOptions{}, err
+	}
+	if f.remoteHost != "" {
+		for i := range sources {
+			sources[i].Remote = f.remoteHost
+		}
+	}
+	if err := validateSourceRemotes(sources); err != nil {
+		return nil, "", fetchOptions{}, err
+	}
+	if f.flatten {
+		for i := range sources {
+			sources[i].Flatten = true
+		}
+	}
+	if f.flat.set {
+		if f.flat.value && len(sources) > 1 {
+			return nil, "", fetchOptions{}, fmt.Errorf("--flat-artifacts only applies to a single artifact source")
+		}
+		opts.PerSource = !f.flat.value
+	}
+	opts.DB = db
+	opts.Full = f.full
+	opts.Latest = f.latest
+	opts.LatestPerDir = f.latestPerDir
+	if f.rsyncRetries >= 0 {
+		opts.RsyncRetries = f.rsyncRetries
+	}
+	if f.rsyncBackoff.set {
+		opts.RsyncBackoff = f.rsyncBackoff.value
+	}
+	if f.listRetries >= 0 {
+		opts.ListRetries = f.listRetries
+	}
+	if f.listRetryDelay.set {
+		opts.ListRetryDelay = f.listRetryDelay.value
+	}
+	opts.ListLimit = f.listLimit
+	opts.AfterCompletion = f.afterCompletion
+	// A manual fetch is how a deferred sync gets done.
+	opts.DeferOver = false
+	if f.fallbackNoTimeFilter.set {
+		opts.FallbackNoTimeFilter = f.fallbackNoTimeFilter.value
+	}
+	opts.AppendVerify = f.appendVerify
+	if f.checksum.set {
+		opts.Checksum = f.checksum.value
+	}
+	opts.AssumeYes = f.yes
+	opts.Strict = f.strict
+	if f.via != "" {
+		opts.Via = f.via
+	}
+	if f.remoteHost != "" {
+		// Every source already names its host.
+		opts.Via = ""
+	}
+	opts.TarPath, opts.TarGzip, opts.Out = f.tarPath, f.gzip, f.out
+	if opts.Transfer, err = normalizeTransfer(f.transfer); err != nil {
+		return nil, "", fetchOptions{}, err
+	}
+	if f.confirmOver != "" {
+		if opts.ConfirmOver, err = parseSize(f.confirmOver); err != nil {
+			return nil, "", fetchOptions{}, fmt.Errorf("confirm-over: %w", err)
+		}
+	}
+	if f.mirror {
+		if err := checkMirrorDest(exp, destDir, len(sources), opts); err != nil {
+			return nil, "", fetchOptions{}, err
+		}
+		for _, src := range sources {
+			if src.Flatten {
+				return nil, "", fetchOptions{}, fmt.Errorf("--mirror cannot be combined with flattened source %s", src.Path)
+			}
+		}
+		opts.SinceStart = false
+		opts.Mirror = true
+	}
+
+	return sources, destDir, opts, nil
+}
+
+// monitorOptions are how exp run and exp watch monitor a job beyond polling.
+type monitorOptions struct {
+	FollowLog   bool // stream the job's log between the status lines
+	NotifyLocal bool // notify when the job ends, as notify_local does
+	// MaxMonitor stops monitoring after this long, leaving the job running;
+	// zero monitors until the job ends.
+	MaxMonitor time.Duration
 }
 
-func monitorExperiment(db *sql.DB, exp *Experiment, interval time.Duration) error {
-	fmt.Printf("Monitoring job %s on %s\n", exp.JobID, exp.Remote)
+// monitorExperiment polls exp's job until it ends, then fetches its
+// artifacts. With opts.FollowLog, the job's log streams in between the
+// status lines once the job has started.
+func monitorExperiment(db *sql.DB, exp *Experiment, interval time.Duration, opts monitorOptions) error {
+	lock, err := lockExperiment(db, exp.ID, lockCommand())
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	// Every line goes through out, which the log follower shares.
+	out := &syncWriter{w: os.Stdout}
+	fmt.Fprintf(out, "Monitoring job %s on %s\n", exp.JobID, exp.Remote)
+	display := newMonitorDisplay(out, exp.JobID)
+	defer display.done()
+	recordedSince := statusSince(db, exp)
+	syncEvery, _ := time.ParseDuration(exp.runSnapshot().SyncInterval)
+	lastPass := time.Now()
+	started := time.Now()
+	unrecognized := make(unrecognizedStates)
+	absent := make(absentJobs)
+	pending := make(pendingChecks)
+	stalled := make(stalledJobs)
+	progress := make(progressChecks)
+	followLog := opts.FollowLog
+	notify := opts.NotifyLocal || exp.runSnapshot().NotifyLocal
+	warnf := func(format string, args ...interface{}) { fmt.Fprintf(out, "Warning: "+format+"\n", args...) }
+	var follower *logFollower
+	defer func() {
+		if follower != nil {
+			follower.close(0)
+		}
+	}()
+	display.lastLog = func() string {
+		if follower != nil {
+			return follower.lastLine()
+		}
+		return exp.Progress.Line
+	}
 	for {
-		status, err := queryJobStatus(exp.Remote, exp.JobID)
+		if lock.Lost() {
+			return fmt.Errorf("another process took over experiment %d while this one was unresponsive; stopping", exp.ID)
+		}
+		if opts.MaxMonitor > 0 && time.Since(started) >= opts.MaxMonitor {
+			display.done()
+			return detachMonitor(db, exp, opts.MaxMonitor)
+		}
+		status, err := queryJobStatus(exp.Remote, exp.SSH, exp.Cluster, exp.JobID)
 		if err != nil {
-			fmt.Printf("Warning: unable to query job status: %v\n", err)
-			time.Sleep(interval)
+			fmt.Fprintf(out, "Warning: unable to query job status: %v\n", err)
+			display.wait(jitterInterval(interval))
 			continue
 		}
+		status = absent.resolve(exp, status, time.Now(), warnf)
+		status = unrecognized.resolve(exp, status, time.Now(), warnf)
+		// A terminal observation is not final if exp requeue ran since the
+		// last poll; keep polling the same job ID instead.
+		if count, err := loadRequeueCount(db, exp.ID); err == nil && count > exp.RequeueCount {
+			exp.RequeueCount = count
+			if !isActiveStatus(status) {
+				exp.JobStatus = "PENDING"
+				fmt.Fprintf(out, "Job %s was requeued; continuing to monitor\n", exp.JobID)
+				display.wait(jitterInterval(interval))
+				continue
+			}
+		}
+		if status != exp.JobStatus {
+			if err := changeExperimentStatus(db, exp.ID, status, "", nil); err != nil {
+				return err
+			}
+		}
+		// The first poll finding the recorded status carries on from when the
+		// job entered it.
+		var since time.Time
+		if display.status == "" && status == exp.JobStatus {
+			since = recordedSince
+		}
 		exp.JobStatus = status
-		if err := updateExperimentStatus(db, exp.ID, status, nil); err != nil {
+		display.observe(status, since)
+		if followLog && follower == nil && jobStarted(status) {
+			if exp.LogPath == "" {
+				fmt.Fprintf(out, "Warning: no log path recorded for job %s; not following its log\n", exp.JobID)
+				followLog = false
+			} else {
+				follower = startLogFollower(exp.Remote, exp.SSH, exp.LogPath, out)
+			}
+		}
+		if e, ok, err := pending.check(db, exp, time.Now(), querySqueueStart); err != nil {
+			fmt.Fprintf(out, "Warning: unable to ask when the job starts: %v\n", err)
+		} else if ok {
+			fmt.Fprintf(out, "Pending: %s\n", e.describe())
+			warning, err := stalled.observe(db, exp, e, time.Now())
+			if err != nil {
+				return err
+			}
+			if warning != "" {
+				if notify {
+					notifyLocal(stalledNotice(exp, warning))
+				}
+				if isTerminal(os.Stdout) {
+					warning = "\033[33m" + warning + "\033[0m"
+				}
+				fmt.Fprintf(out, "WARNING: %s\n", warning)
+			}
+		}
+		if p, ok, err := progress.check(db, exp, time.Now(), tailRemoteLog); err != nil {
 			return err
+		} else if ok {
+			fmt.Fprintf(out, "Progress: %s\n", p.describe())
+		}
+		if syncEvery > 0 && strings.EqualFold(status, "RUNNING") && time.Since(lastPass) >= syncEvery {
+			lastPass = time.Now()
+			// The sync prints as it goes; log lines wait until it is done.
+			out.hold(func() { syncWhileRunning(db, exp) })
 		}
-		fmt.Printf("[%s] %s -> %s\n", time.Now().Format(time.RFC3339), exp.JobID, status)
 		if !isActiveStatus(status) {
-			completed := time.Now().UTC()
-			exp.CompletedAt = completed
-			if err := updateExperimentStatus(db, exp.ID, status, &completed); err != nil {
+			// From here on, whole lines only.
+			display.done()
+			if follower != nil {
+				follower.close(logFollowGrace)
+				follower = nil
+			}
+			if err := finishJob(db, exp, status, time.Now(), "", out); err != nil {
 				return err
 			}
+			if notify {
+				notifyLocal(finishedNotice(exp))
+			}
 			break
 		}
-		time.Sleep(interval)
+		display.wait(jitterInterval(interval))
 	}
 
 	sources := exp.EffectiveArtifactSources()
 	if len(sources) > 0 && exp.ArtifactDest != "" {
 		fmt.Println("Job finished; fetching artifacts from configured sources")
-		time.Sleep(artifactSettleDelay)
-		if err := fetchArtifactSources(exp, sources, exp.ArtifactDest, exp.ArtifactSinceStart, false); err != nil {
+		settled := settleArtifacts(exp, sources, time.Sleep)
+		started := time.Now().UTC()
+		stats, err := fetchArtifactSources(exp, sources, exp.ArtifactDest, exp.autoSyncOptions(db))
+		if errors.Is(err, errSyncDeferred) {
+			return deferArtifactSync(db, exp)
+		}
+		if err != nil {
 			fmt.Printf("Artifact sync failed: %v\n", err)
-			if err := recordArtifactSync(db, exp.ID, nil, err.Error()); err != nil {
+			if notify {
+				notifyLocal(syncFailedNotice(exp, err))
+			}
+			if err := recordArtifactSync(db, exp.ID, nil, nil, err.Error()); err != nil {
 				return err
 			}
 			return err
 		}
-		now := time.Now().UTC()
-		exp.ArtifactLastSync = now
-		if err := recordArtifactSync(db, exp.ID, &now, ""); err != nil {
+		stats.Settle = settled.String()
+		exp.ArtifactLastSync = started
+		if err := recordArtifactSync(db, exp.ID, &started, &stats, ""); err != nil {
 			return err
 		}
 		fmt.Printf("Artifacts stored under %s\n", exp.ArtifactDest)
+		if stats.Files == 0 {
+			fmt.Println(noFilesMatchedWarning)
+		}
+		syncMetrics(db, exp, exp.ArtifactDest)
+		archiveJobLogs(db, exp, exp.ArtifactDest)
 	} else {
 		fmt.Println("No artifact paths configured for this experiment; skipping automatic fetch.")
 	}
 	return nil
 }
 
-func isActiveStatus(status string) bool {
-	switch strings.ToUpper(strings.TrimSpace(status)) {
-	case "PENDING", "CONFIGURING", "RUNNING", "COMPLETING", "SUSPENDED", "RESV_DEL_HOLD", "SPECIAL_EXIT":
-		return true
-	default:
-		return false
+// queryJobStatus is one job's status, UNKNOWN when the scheduler does not
+// know it.
+func queryJobStatus(remote string, sshOpts sshHostOptions, cluster, jobID string) (string, error) {
+	if jobID == "" {
+		return "UNKNOWN", nil
+	}
+	states, err := jobStatuses.lookup(remote, sshOpts, cluster, []string{jobID})
+	if err != nil {
+		return "", err
+	}
+	if st, ok := states[jobID]; ok {
+		return st.Status, nil
+	}
+	return "UNKNOWN", nil
+}
+
+// updateExperimentStatus stores status and its category. A job that is
+// active again, having been requeued, loses the reason it ended, and one no
+// longer pending its start estimate and stall mark.
+func updateExperimentStatus(db execer, id int64, status string, completedAt *time.Time) error {
+	status = normalizeStatus(status)
+	category, _ := jobStateCategory(status)
+	if category == jobActive {
+		if _, err := db.Exec(`UPDATE experiments SET job_reason = NULL WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	if status != "PENDING" {
+		if _, err := db.Exec(`UPDATE experiments SET pending_reason = NULL, pending_start = NULL, stalled_reason = NULL WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	if completedAt != nil {
+		_, err := db.Exec(`UPDATE experiments SET job_status = ?, job_category = ?, completed_at = ? WHERE id = ?`,
+			status, string(category), completedAt.Format(time.RFC3339), id)
+		return err
 	}
+	_, err := db.Exec(`UPDATE experiments SET job_status = ?, job_category = ? WHERE id = ?`, status, string(category), id)
+	return err
+}
+
+// recordStatusEvent appends one entry to the experiment's status history.
+func recordStatusEvent(db execer, id int64, status, note string) error {
+	_, err := db.Exec(`INSERT INTO status_events (experiment_id, status, observed_at, note) VALUES (?, ?, ?, ?)`,
+		id, status, time.Now().UTC().Format(time.RFC3339), note)
+	return err
+}
+
+// changeExperimentStatus records a status event and stores the new status
+// together, so the history never disagrees with the experiment. A job seen
+// going from RUNNING back to the queue counts as preempted (see
+// isPreemption), and one recorded as ended that is back counts as requeued
+// (see isRequeue). The on_state_change hook runs once the change is stored.
+func changeExperimentStatus(db *sql.DB, id int64, status, note string, completedAt *time.Time) error {
+	var prev string
+	err := inTx(db, func(tx *sql.Tx) error {
+		// The last event, or the stored status when there is none yet; a
+		// monitor's detach marker is not a status.
+		err := tx.QueryRow(`SELECT COALESCE((SELECT status FROM status_events WHERE experiment_id = ? AND status != ? ORDER BY id DESC LIMIT 1), job_status, '')
+                              FROM experiments WHERE id = ?`, id, statusMonitorDetached, id).Scan(&prev)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if isPreemption(prev, status) {
+			if _, err := tx.Exec(`UPDATE experiments SET preempt_count = COALESCE(preempt_count, 0) + 1 WHERE id = ?`, id); err != nil {
+				return err
+			}
+			if note == "" {
+				note = "preempted and requeued"
+			}
+		}
+		if isRequeue(prev, status) {
+			if _, err := tx.Exec(`UPDATE experiments SET requeue_count = COALESCE(requeue_count, 0) + 1, completed_at = '' WHERE id = ?`, id); err != nil {
+				return err
+			}
+			note = strings.TrimPrefix(note+"; requeued after "+normalizeStatus(prev), "; ")
+		}
+		if err := recordStatusEvent(tx, id, status, note); err != nil {
+			return err
+		}
+		return updateExperimentStatus(tx, id, status, completedAt)
+	})
+	if err == nil {
+		stateHooks.statusChanged(db, id, prev, status)
+	}
+	return err
+}
+
+type statusEvent struct {
+	Status     string `json:"status"`
+	ObservedAt string `json:"observed_at"`
+	Note       string `json:"note,omitempty"`
+}
+
+func loadStatusEvents(db *sql.DB, id int64) ([]statusEvent, error) {
+	rows, err := db.Query(`SELECT status, observed_at, note FROM status_events WHERE experiment_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []statusEvent
+	for rows.Next() {
+		var ev statusEvent
+		var note sql.NullString
+		if err := rows.Scan(&ev.Status, &ev.ObservedAt, &note); err != nil {
+			return nil, err
+		}
+		ev.Note = note.String
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+func loadRequeueCount(db *sql.DB, id int64) (int, error) {
+	var n sql.NullInt64
+	err := db.QueryRow(`SELECT requeue_count FROM experiments WHERE id = ?`, id).Scan(&n)
+	return int(n.Int64), err
+}
+
+// recordArtifactSync stores the outcome of a sync. stats describes a
+// successful sync; a failed one (stats == nil) keeps the previous figures.
+// Files a successful sync skipped are recorded in artifact_last_error as a
+// warning, which does not count as a failure.
+func recordArtifactSync(db *sql.DB, id int64, syncedAt *time.Time, stats *syncStats, errMsg string) error {
+	ts := ""
+	if syncedAt != nil {
+		ts = syncedAt.Format(time.RFC3339)
+	}
+	// artifact_sync_failures only ever grows so it can back a Prometheus counter.
+	failed := 0
+	if errMsg != "" {
+		failed = 1
+	} else if stats != nil {
+		errMsg = stats.skippedWarning()
+	}
+	at := time.Now()
+	if syncedAt != nil {
+		at = *syncedAt
+	}
+	err := inTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE experiments SET artifact_last_sync = ?, artifact_last_error = ?,
+                              artifact_sync_failures = COALESCE(artifact_sync_failures, 0) + ? WHERE id = ?`, ts, errMsg, failed, id)
+		if err != nil {
+			return err
+		}
+		if err := insertSyncRecord(tx, id, at, stats, errMsg); err != nil || stats == nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE experiments SET artifact_sync_files = ?, artifact_sync_bytes = ?, artifact_sync_seconds = ?,
+                              artifact_manifest = ?, artifact_sync_tar = ?, artifact_sync_host = ?,
+                              artifact_sync_updated = ?, artifact_sync_updated_bytes = ?, artifact_sync_settle = ? WHERE id = ?`,
+			stats.Files, stats.Bytes, stats.Duration.Seconds(), stats.ManifestPath, stats.TarPath, stats.Host,
+			stats.Updated, stats.UpdatedBytes, stats.Settle, id)
+		return err
+	})
+	if err == nil && failed == 1 {
+		stateHooks.syncFailed(db, id, errMsg)
+	}
+	return err
+}
+
+// fetchOptions controls one artifact sync. Size limits of zero and an empty
+// BWLimit mean no limit.
+type fetchOptions struct {
+	SinceStart bool
+	// SinceLastSync narrows the listing to files modified after the last
+	// successful sync; Since, when set, is an explicit cutoff that overrides
+	// both.
+	SinceLastSync bool
+	Since         time.Time
+	DryRun        bool
+	MinSize       int64
+	MaxSize       int64
+	BWLimit       string // rsync --bwlimit value, already validated
+	// Compress forces rsync -z on or off; nil picks it from the file names.
+	Compress      *bool
+	CompressLevel int
+	Parallel      int // sources fetched at once; 0 means defaultFetchParallel
+	// PerSource syncs each source into destDir/<source-name>/ rather than
+	// straight into destDir.
+	PerSource bool
+	// Mirror deletes local files that match the patterns but are gone from
+	// the remote.
+	Mirror bool
+	// DB, when set, records a manifest per source after each sync and skips
+	// files that are unchanged since the last one unless Full is set.
+	DB   *sql.DB
+	Full bool
+	// RsyncRetries re-runs rsync after transient network failures, waiting
+	// RsyncBackoff, then twice that, and so on.
+	RsyncRetries int
+	RsyncBackoff time.Duration
+	AppendVerify bool
+	// AfterCompletion marks the automatic sync right after a job finished;
+	// only then is an empty listing retried ListRetries times, ListRetryDelay
+	// apart. FallbackNoTimeFilter lists everything when the time window
+	// matched nothing.
+	AfterCompletion      bool
+	ListRetries          int
+	ListRetryDelay       time.Duration
+	FallbackNoTimeFilter bool
+	// ConfirmOver prompts before transferring more than this many bytes; 0
+	// never prompts.
+	ConfirmOver int64
+	// Checksum makes rsync compare contents (-c) rather than size and mtime,
+	// hands it every matched file instead of only the ones the manifest
+	// thinks changed, and records each file's sha256 in the fetch manifest.
+	// Both read every byte, so both are off unless asked for.
+	Checksum bool
+	// DeferOver makes an unattended sync over ConfirmOver stop with
+	// errSyncDeferred instead of transferring anyway.
+	DeferOver bool
+	// AssumeYes skips the --checksum and ConfirmOver prompts.
+	AssumeYes bool
+	// Strict fails the sync on unreadable remote files instead of skipping
+	// them with a warning.
+	Strict bool
+	// Via is the user@host that lists and transfers the sources that would
+	// otherwise use the submission host; see routeVia.
+	Via string
+	// Transfer forces a transfer backend (rsync, scp or tar); empty picks
+	// rsync when available on both ends.
+	Transfer string
+	// ListLimit aborts a listing that returns more than this many files
+	// (after any remote narrowing); 0 means no limit.
+	ListLimit int
+	// TarPath streams every matching file into one tar archive at this path,
+	// or to stdout when "-", instead of syncing into the destination.
+	TarPath string
+	TarGzip bool
+	// Out receives the progress output; nil is stdout.
+	Out io.Writer
+	// Latest keeps only the N most recently modified matches, overall or in
+	// each directory with LatestPerDir.
+	Latest       int
+	LatestPerDir bool
+}
+
+// recordedFetchOptions returns the options recorded at submit time, used by
+// the automatic post-run sync and as defaults for exp fetch.
+func (exp *Experiment) recordedFetchOptions() fetchOptions {
+	snap := exp.runSnapshot()
+	opts := fetchOptions{
+		SinceStart:           exp.ArtifactSinceStart,
+		BWLimit:              snap.BWLimit,
+		Compress:             snap.Compress,
+		CompressLevel:        snap.CompressLevel,
+		Parallel:             snap.Parallel,
+		PerSource:            snap.ArtifactLayout == artifactLayoutPerSource,
+		RsyncRetries:         defaultRsyncRetries,
+		RsyncBackoff:         defaultRsyncBackoff,
+		ListRetries:          defaultListRetries,
+		ListRetryDelay:       defaultListRetryDelay,
+		FallbackNoTimeFilter: snap.FallbackNoTimeFilter,
+		Checksum:             snap.Checksum,
+		DeferOver:            snap.DeferLargeSync,
+		Via:                  snap.TransferRemote,
+	}
+	// Validated at submit time, like the size limits.
+	if n, err := parseSize(snap.ConfirmOver); err == nil {
+		opts.ConfirmOver = n
+	}
+	if snap.RsyncRetries != nil {
+		opts.RsyncRetries = *snap.RsyncRetries
+	}
+	if snap.ListRetries != nil {
+		opts.ListRetries = *snap.ListRetries
+	}
+	if d, err := time.ParseDuration(snap.ListRetryDelay); err == nil && d > 0 {
+		opts.ListRetryDelay = d
+	}
+	// Validated at submit time, like the size limits.
+	if d, err := time.ParseDuration(snap.RsyncBackoff); err == nil && d > 0 {
+		opts.RsyncBackoff = d
+	}
+	// Limits were validated when the experiment was submitted.
+	opts.MinSize, opts.MaxSize, _ = parseSizeLimits(snap.MinSize, snap.MaxSize)
+	return opts
+}
+
+// parseSizeLimits parses optional min/max sizes; "" leaves a bound unset.
+func parseSizeLimits(minSize, maxSize string) (int64, int64, error) {
+	var lo, hi int64
+	var err error
+	if minSize != "" {
+		if lo, err = parseSize(minSize); err != nil {
+			return 0, 0, fmt.Errorf("min-size: %w", err)
+		}
+	}
+	if maxSize != "" {
+		if hi, err = parseSize(maxSize); err != nil {
+			return 0, 0, fmt.Errorf("max-size: %w", err)
+		}
+	}
+	if hi > 0 && lo > hi {
+		return 0, 0, fmt.Errorf("min-size %s is larger than max-size %s", minSize, maxSize)
+	}
+	return lo, hi, nil
+}
+
+// sizeSkipReason explains why a file falls outside the size limits, or
+// returns "" when it is within them.
+func (o fetchOptions) sizeSkipReason(size int64) string {
+	switch {
+	case o.MinSize > 0 && size < o.MinSize:
+		return fmt.Sprintf("%s < min-size %s", formatBytes(size), formatBytes(o.MinSize))
+	case o.MaxSize > 0 && size > o.MaxSize:
+		return fmt.Sprintf("%s > max-size %s", formatBytes(size), formatBytes(o.MaxSize))
+	default:
+		return ""
+	}
+}
+
+// artifactLayoutPerSource is the snapshot's artifact_layout for experiments
+// that sync each source into its own subdirectory. Experiments recorded
+// without a layout keep syncing into the destination root.
+const artifactLayoutPerSource = "per-source"
+
+// assignSourceNames gives every unnamed source the last component of its
+// path, adding -2, -3, ... when that name is already taken.
+func assignSourceNames(sources []ArtifactSource) error {
+	taken := make(map[string]bool)
+	for _, src := range sources {
+		if src.Name == "" {
+			continue
+		}
+		if src.Name == "." || src.Name == ".." || strings.ContainsAny(src.Name, `/\`) {
+			return fmt.Errorf("artifact source name %q must be a single path component", src.Name)
+		}
+		if taken[src.Name] {
+			return fmt.Errorf("artifact source name %q is used more than once", src.Name)
+		}
+		taken[src.Name] = true
+	}
+	for i := range sources {
+		if sources[i].Name != "" {
+			continue
+		}
+		base := path.Base(strings.TrimRight(sources[i].Path, "/"))
+		if base == "." || base == "/" || base == "" {
+			base = "root"
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[name] = true
+		sources[i].Name = name
+	}
+	return nil
+}
+
+func (o fetchOptions) out() io.Writer {
+	if o.Out == nil {
+		return os.Stdout
+	}
+	return o.Out
+}
+
+// sourceDest is where a source's files land locally.
+func (o fetchOptions) sourceDest(destDir string, src ArtifactSource) string {
+	if o.PerSource && src.Name != "" {
+		return filepath.Join(destDir, src.Name)
+	}
+	return destDir
+}
+
+// defaultFetchParallel is how many artifact sources are listed and
+// transferred at once when neither --parallel nor a profile sets it.
+const defaultFetchParallel = 3
+
+// sourceFetch tracks one artifact source through listing and transfer. With
+// more than one worker its output is buffered and printed in one piece.
+type sourceFetch struct {
+	src      ArtifactSource
+	dest     string
+	matched  []remoteFile
+	files    []string // relative paths to transfer
+	listed   []remoteFile
+	stale    []string          // local files to delete in mirror mode
+	flat     map[string]string // remote relative path -> local name when flattening
+	manifest artifactManifest
+	updated  transferTally // what the transfer reported moving
+	denied   []string      // paths skipped as unreadable, relative to src.Path
+	out      bytes.Buffer
+	err      error
+}
+
+// fetchArtifactSources lists every source concurrently, then transfers the
+// matched files. A failing source does not stop the others; the returned
+// error names each source that failed.
+func fetchArtifactSources(exp *Experiment, sources []ArtifactSource, destDir string, opts fetchOptions) (syncStats, error) {
+	out := opts.out()
+	if len(sources) == 0 {
+		fmt.Fprintln(out, "No artifact sources to process; nothing to copy.")
+		return syncStats{}, nil
+	}
+	for _, src := range sources {
+		if src.Path == "" {
+			return syncStats{}, fmt.Errorf("artifact source has empty path")
+		}
+	}
+	absDest, err := expandLocalPath(destDir)
+	if err != nil {
+		return syncStats{}, fmt.Errorf("artifact destination: %w", err)
+	}
+	if opts.Via != "" {
+		if sources, err = routeVia(out, exp, sources, opts.Via); err != nil {
+			return syncStats{}, err
+		}
+	}
+	if opts.TarPath != "" {
+		// Per-source destinations become name prefixes inside the archive.
+		absDest = ""
+	} else if absDest == "" {
+		return syncStats{}, fmt.Errorf("destination directory is required")
+	}
+	start := time.Now()
+
+	workers := opts.Parallel
+	if workers <= 0 {
+		workers = defaultFetchParallel
+	}
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+	results := make([]*sourceFetch, len(sources))
+	for i, src := range sources {
+		results[i] = &sourceFetch{src: src, dest: opts.sourceDest(absDest, src)}
+	}
+	var mu sync.Mutex
+	writer := func(r *sourceFetch) io.Writer {
+		if workers == 1 {
+			return out
+		}
+		return &r.out
+	}
+	flush := func(r *sourceFetch) {
+		mu.Lock()
+		defer mu.Unlock()
+		out.Write(r.out.Bytes())
+		r.out.Reset()
+	}
+
+	runPool(len(results), workers, func(i int) {
+		r := results[i]
+		w := writer(r)
+		fmt.Fprintf(w, "Fetching artifacts from %s\n", r.src.Path)
+		r.matched, r.listed, r.denied, r.err = planArtifactFetch(w, exp, r.src, opts)
+		r.files = remoteFileNames(r.matched)
+		if r.err == nil && r.src.Flatten {
+			r.flat, r.err = flattenNames(r.files)
+		}
+		if r.err == nil && opts.DB != nil && opts.TarPath == "" {
+			r.manifest, r.err = loadArtifactManifest(opts.DB, exp.ID, r.src.Path, r.dest)
+			if r.err == nil && !opts.Full && !opts.Checksum {
+				r.files = r.manifest.changedFiles(w, r.matched, r.dest)
+				if opts.DryRun && len(r.manifest.Files) > 0 {
+					fmt.Fprintf(w, "Estimated new or updated: %d file(s), %s\n", len(r.files), formatBytes(r.pendingBytes()))
+				}
+			}
+		}
+		if r.err == nil && opts.DryRun && len(r.files) > 0 {
+			if opts.TarPath != "" {
+				fmt.Fprintf(w, "Would archive into %s.\n", opts.TarPath)
+			} else if backend, err := chooseTransfer(w, r.src.host(exp), exp.SSH, opts.Transfer); err != nil {
+				r.err = err
+			} else {
+				fmt.Fprintf(w, "Would transfer with %s.\n", backend)
+			}
+		}
+		if r.err == nil && opts.Mirror {
+			r.stale, r.err = staleArtifacts(w, r.dest, r.src, r.listed, r.denied, opts.DryRun)
+		}
+		flush(r)
+	})
+	if err := confirmTransfer(results, opts); err != nil {
+		return syncStats{}, err
+	}
+	var tarStats syncStats
+	switch {
+	case opts.DryRun:
+	case opts.TarPath != "":
+		if tarStats, err = writeArtifactTar(exp, results, opts); err != nil {
+			return syncStats{}, err
+		}
+	default:
+		transferWorkers := workers
+		if rel, n := artifactCollisions(results); n > 0 {
+			fmt.Fprintf(out, "Warning: %d path(s) such as %s exist in more than one source; transferring sources one at a time so later sources win.\n", n, rel)
+			transferWorkers = 1
+		}
+		runPool(len(results), transferWorkers, func(i int) {
+			r := results[i]
+			if r.err != nil {
+				return
+			}
+			w := writer(r)
+			switch {
+			case len(r.files) == 0:
+			case r.flat != nil:
+				r.updated, r.err = rsyncFlattened(w, r.src.host(exp), exp.SSH, r.src, r.files, r.dest, r.flat, opts)
+			default:
+				r.updated, r.err = transferFiles(w, r.src.host(exp), exp.SSH, r.src, r.files, r.dest, opts)
+			}
+			var de *deniedError
+			if errors.As(r.err, &de) && !opts.Strict {
+				fmt.Fprintf(w, "Warning: skipped %d unreadable file(s) under %s (--strict fails instead): %s\n", len(de.Paths), r.src.Path, displayPaths(de.Paths))
+				r.skipDenied(de.Paths)
+				r.err = nil
+			}
+			// Only prune once the fresh copy is in place.
+			if r.err == nil && len(r.stale) > 0 {
+				r.err = removeStaleArtifacts(w, r.dest, r.stale)
+			}
+			flush(r)
+		})
+		// Manifests are written one at a time after the transfers so the
+		// workers never contend for the DB.
+		if opts.DB != nil {
+			for _, r := range results {
+				if r.err != nil || (len(r.matched) == 0 && len(r.manifest.Files) == 0) {
+					continue
+				}
+				m := newArtifactManifest(r.matched)
+				m.setLocalNames(r.flat)
+				if err := saveArtifactManifest(opts.DB, exp.ID, r.src.Path, r.dest, m); err != nil {
+					r.err = fmt.Errorf("record manifest: %w", err)
+				}
+			}
+		}
+	}
+
+	var failed []string
+	for _, r := range results {
+		if r.err != nil {
+			if len(results) == 1 {
+				return syncStats{}, r.err
+			}
+			failed = append(failed, fmt.Sprintf("  %s: %v", r.src.Path, r.err))
+		}
+	}
+	if len(failed) > 0 {
+		return syncStats{}, fmt.Errorf("%d of %d artifact source(s) failed:\n%s", len(failed), len(results), strings.Join(failed, "\n"))
+	}
+	if opts.DryRun {
+		return syncStats{}, nil
+	}
+	if opts.TarPath != "" {
+		tarStats.Duration = time.Since(start)
+		tarStats.Host = opts.Via
+		tarStats.Updated, tarStats.UpdatedBytes = -1, -1
+		for _, r := range results {
+			for _, rel := range r.denied {
+				tarStats.Skipped = append(tarStats.Skipped, path.Join(r.src.Path, rel))
+			}
+		}
+		return tarStats, nil
+	}
+
+	var transferred []transferredFile
+	for _, r := range results {
+		for _, rel := range r.files {
+			transferred = append(transferred, transferredFile{Source: r.src.Path, Dest: r.dest, Rel: r.localName(rel), Remote: rel})
+		}
+	}
+	stats, err := writeTransferManifest(exp.ID, absDest, transferred, opts.Checksum)
+	if err != nil {
+		return syncStats{}, fmt.Errorf("write manifest: %w", err)
+	}
+	stats.Duration = time.Since(start)
+	stats.Host = opts.Via
+	var updated transferTally
+	for _, r := range results {
+		for _, rel := range r.denied {
+			stats.Skipped = append(stats.Skipped, path.Join(r.src.Path, rel))
+		}
+		updated = updated.add(r.updated)
+	}
+	stats.Updated, stats.UpdatedBytes = updated.Files, updated.Bytes
+	return stats, nil
+}
+
+// skipDenied leaves the unreadable paths out of what counts as synced, so
+// neither manifest records them and the next fetch tries them again.
+func (r *sourceFetch) skipDenied(denied []string) {
+	r.denied = append(r.denied, denied...)
+	r.files = withoutDenied(r.files, denied)
+	matched := r.matched[:0:0]
+	for _, f := range r.matched {
+		if !isDenied(f.Rel, denied) {
+			matched = append(matched, f)
+		}
+	}
+	r.matched = matched
+}
+
+// localName is where a remote relative path lands under r.dest.
+func (r *sourceFetch) localName(rel string) string {
+	if name, ok := r.flat[rel]; ok {
+		return name
+	}
+	return rel
+}
+
+// pendingBytes is the remote size of the files queued for transfer.
+func (r *sourceFetch) pendingBytes() int64 {
+	queued := make(map[string]bool, len(r.files))
+	for _, rel := range r.files {
+		queued[rel] = true
+	}
+	var total int64
+	for _, f := range r.matched {
+		if queued[f.Rel] {
+			total += f.Size
+		}
+	}
+	return total
+}
+
+// errFetchDeclined is returned when the user turns down a --confirm-over
+// prompt; it is not recorded as a failed sync.
+var errFetchDeclined = errors.New("fetch cancelled")
+
+// errSyncDeferred is returned when an unattended sync is over ConfirmOver
+// and DeferOver is set; see deferArtifactSync.
+var errSyncDeferred = errors.New("artifact sync deferred")
+
+// checksumWarnFiles is the listing size above which --checksum asks first.
+const checksumWarnFiles = 1000
+
+// confirmTransfer prints how much is about to be transferred, and asks
+// before a --checksum comparison of more than checksumWarnFiles files or a
+// transfer larger than opts.ConfirmOver. Unattended syncs cannot answer: they
+// log the warning and go ahead, or stop with errSyncDeferred.
+func confirmTransfer(results []*sourceFetch, opts fetchOptions) error {
+	out := opts.out()
+	var matched, queued int
+	var matchedBytes, queuedBytes int64
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		for _, f := range r.matched {
+			matchedBytes += f.Size
+		}
+		matched += len(r.matched)
+		queued += len(r.files)
+		queuedBytes += r.pendingBytes()
+	}
+	over := opts.ConfirmOver > 0 && queuedBytes > opts.ConfirmOver
+	if opts.DryRun {
+		fmt.Fprintf(out, "Total: %d file(s), %s\n", matched, formatBytes(matchedBytes))
+		fmt.Fprintf(out, "Would transfer %s in %s files", formatBytes(queuedBytes), formatCount(queued))
+		if over {
+			fmt.Fprintf(out, " (over confirm_over %s)", formatBytes(opts.ConfirmOver))
+		}
+		fmt.Fprintln(out)
+		return nil
+	}
+	if queued > 0 {
+		fmt.Fprintf(out, "About to transfer %s in %s files\n", formatBytes(queuedBytes), formatCount(queued))
+	}
+	if opts.Checksum && queued > checksumWarnFiles {
+		fmt.Fprintf(out, "Warning: --checksum makes rsync read all %d file(s) (%s) on both ends to compare them.\n", queued, formatBytes(queuedBytes))
+		// Unattended syncs cannot answer; they only get the warning.
+		if !opts.AssumeYes && !opts.AfterCompletion && !confirmOn(out, "Continue?") {
+			return errFetchDeclined
+		}
+	}
+	if !over || opts.AssumeYes {
+		return nil
+	}
+	if opts.AfterCompletion {
+		action := "syncing anyway"
+		if opts.DeferOver {
+			action = "deferring it to a manual exp fetch"
+		}
+		fmt.Fprintf(out, "WARNING: this sync of %s is over confirm_over (%s); %s.\n", formatBytes(queuedBytes), formatBytes(opts.ConfirmOver), action)
+		if opts.DeferOver {
+			return errSyncDeferred
+		}
+		return nil
+	}
+	if !confirmOn(out, fmt.Sprintf("Transfer %s in %d file(s) (over %s)?", formatBytes(queuedBytes), queued, formatBytes(opts.ConfirmOver))) {
+		return errFetchDeclined
+	}
+	return nil
+}
+
+// runPool calls fn for every index in [0, n) using at most workers
+// goroutines, and returns once all calls have finished.
+func runPool(n, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// artifactCollisions counts local paths written by more than one source,
+// returning one of them as an example. Such sources would race to write the
+// same file; per-source subdirectories avoid this.
+func artifactCollisions(results []*sourceFetch) (string, int) {
+	seen := make(map[string]int)
+	for _, r := range results {
+		for _, rel := range r.files {
+			seen[filepath.Join(r.dest, r.localName(rel))]++
+		}
+	}
+	var dups []string
+	for rel, count := range seen {
+		if count > 1 {
+			dups = append(dups, rel)
+		}
+	}
+	if len(dups) == 0 {
+		return "", 0
+	}
+	sort.Strings(dups)
+	return dups[0], len(dups)
+}
+
+// staleArtifacts returns the local files under dest that match the source's
+// patterns but no longer appear in the remote listing, printing what mirror
+// mode will delete. An empty listing deletes nothing, so a failed or
+// filtered-out listing cannot wipe the destination; nor do the denied paths
+// the listing could not read, which may only be unreadable for now.
+func staleArtifacts(w io.Writer, dest string, src ArtifactSource, listed []remoteFile, denied []string, dryRun bool) ([]string, error) {
+	if len(listed) == 0 {
+		fmt.Fprintf(w, "Mirror: remote listing of %s is empty; not deleting anything.\n", src.Path)
+		return nil, nil
+	}
+	if len(denied) > 0 && src.Flatten {
+		// Flattened files no longer say which remote directory they came from.
+		fmt.Fprintf(w, "Mirror: %d path(s) under %s were unreadable; not deleting anything from a flattened source.\n", len(denied), src.Path)
+		return nil, nil
+	}
+	compiled, err := compileMatchers(ensurePatterns(src.Patterns), src.PatternSyntax)
+	if err != nil {
+		return nil, err
+	}
+	remote := make(map[string]bool, len(listed))
+	for _, f := range listed {
+		remote[f.Rel] = true
+	}
+	local, err := listLocalFileInfo(dest, false, src.Symlinks == symlinksPreserve)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, rel := range sortedKeys(local) {
+		// Job logs archived by --with-log have no remote counterpart here.
+		if strings.HasPrefix(rel, jobLogDir+"/") {
+			continue
+		}
+		// The listing never looked inside pruned or unreadable
+		// directories, so their files are missing from it without being
+		// gone.
+		if inPrunedDir(rel, src.PruneDirs) || isDenied(rel, denied) {
+			continue
+		}
+		if !remote[rel] && patternMatches(compiled, src.Path, rel) {
+			stale = append(stale, rel)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	if dryRun {
+		fmt.Fprintf(w, "Mirror: would delete %d stale local file(s) no longer on the remote:\n", len(stale))
+	} else {
+		fmt.Fprintf(w, "Mirror: deleting %d stale local file(s) no longer on the remote:\n", len(stale))
+	}
+	for _, rel := range stale {
+		fmt.Fprintf(w, "  delete %s\n", displayPath(filepath.Join(dest, filepath.FromSlash(rel))))
+	}
+	return stale, nil
+}
+
+func removeStaleArtifacts(w io.Writer, dest string, stale []string) error {
+	for _, rel := range stale {
+		if err := os.Remove(filepath.Join(dest, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("mirror: %w", err)
+		}
+	}
+	fmt.Fprintf(w, "Mirror: deleted %d stale local file(s).\n", len(stale))
+	return nil
+}
+
+// checkMirrorDest refuses mirror mode anywhere but the per-experiment
+// directory exp run created (<artifact-dest>/<id>), and for several sources
+// sharing one flat directory, where one source's files look stale to another.
+func checkMirrorDest(exp *Experiment, destDir string, sourceCount int, opts fetchOptions) error {
+	dest, err := expandLocalPath(destDir)
+	if err != nil {
+		return err
+	}
+	recorded, err := expandLocalPath(exp.ArtifactDest)
+	if err != nil {
+		return err
+	}
+	if recorded == "" || filepath.Clean(dest) != filepath.Clean(recorded) || filepath.Base(recorded) != strconv.FormatInt(exp.ID, 10) {
+		return fmt.Errorf("--mirror only deletes inside the experiment's own artifact directory (<artifact-dest>/%d); refusing for %s", exp.ID, destDir)
+	}
+	if sourceCount > 1 && !opts.PerSource {
+		return fmt.Errorf("--mirror needs per-source subdirectories when there are several artifact sources")
+	}
+	return nil
+}
+
+// fetchArtifacts lists, filters, and transfers a single artifact source.
+func fetchArtifacts(exp *Experiment, src ArtifactSource, destDir string, opts fetchOptions) error {
+	_, err := fetchArtifactSources(exp, []ArtifactSource{src}, destDir, opts)
+	return err
+}
+
+// listPolicy says how to react when a listing comes back empty.
+type listPolicy struct {
+	Retries  int // extra attempts, each after Delay
+	Delay    time.Duration
+	Fallback bool // finally list again without the time filter
+}
+
+const (
+	defaultListRetries    = 5
+	defaultListRetryDelay = 3 * time.Second
+)
+
+// listPolicy only retries right after a job finished, when results may not
+// have reached the shared filesystem yet; a manual fetch reports what is
+// there.
+func (o fetchOptions) listPolicy() listPolicy {
+	p := listPolicy{Fallback: o.FallbackNoTimeFilter}
+	if o.AfterCompletion {
+		p.Retries, p.Delay = o.ListRetries, o.ListRetryDelay
+	}
+	return p
+}
+
+// listWithPolicy calls list with the since cutoff, retrying an empty result
+// and then, if allowed, dropping the time filter. Every decision is logged,
+// since silently widening the window can pull an entire shared directory.
+func listWithPolicy(w io.Writer, list func(since time.Time) ([]remoteFile, string, error), since time.Time, p listPolicy, sleep func(time.Duration)) ([]remoteFile, string, error) {
+	var files []remoteFile
+	var cmd string
+	var err error
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		if attempt > 0 {
+			fmt.Fprintf(w, "No files found yet; retrying in %s (attempt %d of %d).\n", p.Delay, attempt+1, p.Retries+1)
+			sleep(p.Delay)
+		}
+		if files, cmd, err = list(since); err != nil || len(files) > 0 {
+			if err == nil {
+				fmt.Fprintf(w, "Found %d file(s).\n", len(files))
+			}
+			return files, cmd, err
+		}
+	}
+	if since.IsZero() {
+		return nil, cmd, nil
+	}
+	if !p.Fallback {
+		fmt.Fprintln(w, "No files were modified inside the time window; not widening it (use --fallback-no-time-filter to list everything).")
+		return nil, cmd, nil
+	}
+	fmt.Fprintln(w, "No files were modified inside the time window; listing again without the time filter (--fallback-no-time-filter).")
+	if files, cmd, err = list(time.Time{}); err == nil {
+		fmt.Fprintf(w, "Found %d file(s).\n", len(files))
+	}
+	return files, cmd, err
+}
+
+// listingCutoff picks the -newermt window for a fetch and names it. An
+// explicit Since wins, then the last successful sync, then the start time;
+// asking for since-last-sync without a previous sync falls back to the start.
+func listingCutoff(w io.Writer, exp *Experiment, opts fetchOptions) (time.Time, string, error) {
+	switch {
+	case !opts.Since.IsZero():
+		return opts.Since, "--since", nil
+	case opts.SinceLastSync && !exp.ArtifactLastSync.IsZero():
+		return exp.ArtifactLastSync, "since last sync", nil
+	case opts.SinceLastSync || opts.SinceStart:
+		if exp.CreatedAt.IsZero() {
+			return time.Time{}, "", fmt.Errorf("experiment %d does not have a recorded start time, cannot apply since-start filter", exp.ID)
+		}
+		if opts.SinceLastSync {
+			fmt.Fprintf(w, "Note: experiment %d has no previous sync; using the since-start window.\n", exp.ID)
+		}
+		return exp.CreatedAt, "since start", nil
+	}
+	return time.Time{}, "", nil
+}
+
+// newerThanArg is the find -newermt clause for files modified after since,
+// widened by sinceStartGracePeriod to absorb clock skew.
+func newerThanArg(since time.Time) string {
+	cutoff := since.UTC().Add(-sinceStartGracePeriod)
+	return " -newermt " + shellQuote(fmt.Sprintf("@%d", cutoff.Unix()))
+}
+
+// planArtifactFetch lists the source on the remote and applies the pattern
+// and size filters, returning the matching files, the full listing and the
+// directories find could not read. In dry-run mode it also prints the
+// matches.
+func planArtifactFetch(w io.Writer, exp *Experiment, src ArtifactSource, opts fetchOptions) ([]remoteFile, []remoteFile, []string, error) {
+	remotePath := src.Path
+	if remotePath == "" {
+		return nil, nil, nil, fmt.Errorf("remote-path is required")
+	}
+	if !strings.HasPrefix(remotePath, "/") {
+		return nil, nil, nil, fmt.Errorf("remote-path must be absolute so rsync can address the files precisely")
+	}
+
+	since, window, err := listingCutoff(w, exp, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !since.IsZero() {
+		fmt.Fprintf(w, "Only listing files modified after %s (%s, less %s grace).\n",
+			since.Local().Format(time.RFC3339), window, sinceStartGracePeriod)
+	}
+	compiled, err := compileMatchers(ensurePatterns(src.Patterns), src.PatternSyntax)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	filter := listFilter{
+		Keep:  func(f remoteFile) bool { return patternMatches(compiled, remotePath, f.Rel) },
+		Limit: opts.ListLimit,
+	}
+	if predicate, ok := remoteFindPredicate(src.Patterns, src.PatternSyntax, remotePath); ok {
+		filter.Predicate = predicate
+		fmt.Fprintf(w, "Narrowing the remote listing with find %s\n", predicate)
+	}
+	if len(src.PruneDirs) > 0 {
+		filter.Prune = src.PruneDirs
+		fmt.Fprintf(w, "Pruning directories named %s from the remote listing\n", strings.Join(src.PruneDirs, ", "))
+	}
+
+	fmt.Fprintf(w, "Querying %s for files under %s...\n", src.host(exp), remotePath)
+	var denied []string
+	list := func(since time.Time) ([]remoteFile, string, error) {
+		files, cmd, err := listRemoteFiles(w, src.host(exp), exp.SSH, remotePath, src.Symlinks, since, filter)
+		var de *deniedError
+		if errors.As(err, &de) && !opts.Strict {
+			denied, err = de.Paths, nil
+		}
+		return files, cmd, err
+	}
+	// files only holds listed paths that match the patterns.
+	files, cmd, err := listWithPolicy(w, list, since, opts.listPolicy(), time.Sleep)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(denied) > 0 {
+		fmt.Fprintf(w, "Warning: skipping %d unreadable path(s) under %s (--strict fails instead): %s\n", len(denied), remotePath, displayPaths(denied))
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintf(w, "Remote find produced no matching files (command: %s)\n", cmd)
+		fmt.Fprintln(w, "No files matched the provided filters; nothing to copy.")
+		return nil, nil, nil, nil
+	}
+
+	var filtered []remoteFile
+	var skipped []string
+	for _, f := range files {
+		if reason := opts.sizeSkipReason(f.Size); reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", displayPath(filepath.Join(remotePath, f.Rel)), reason))
+			continue
+		}
+		filtered = append(filtered, f)
+	}
+
+	if opts.Latest > 0 {
+		matched := len(filtered)
+		filtered = latestRemoteFiles(filtered, opts.Latest, opts.LatestPerDir)
+		if len(filtered) < matched {
+			scope := ""
+			if opts.LatestPerDir {
+				scope = " per directory"
+			}
+			fmt.Fprintf(w, "Keeping the latest %d%s: %d of %d matching file(s).\n", opts.Latest, scope, len(filtered), matched)
+		}
+	}
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(w, "Skipped %d file(s) outside the size limits.\n", len(skipped))
+		if opts.DryRun {
+			for _, line := range skipped {
+				fmt.Fprintf(w, "  skip %s\n", line)
+			}
+		}
+	}
+	if len(filtered) == 0 {
+		fmt.Fprintln(w, "No files matched the provided filters; nothing to copy.")
+		return nil, files, denied, nil
+	}
+
+	fmt.Fprintf(w, "Matched %d file(s).\n", len(filtered))
+	if opts.BWLimit != "" {
+		fmt.Fprintf(w, "Bandwidth limit: %s/s\n", opts.BWLimit)
+	}
+	if opts.DryRun {
+		var total int64
+		for _, f := range filtered {
+			total += f.Size
+			if opts.Latest > 0 {
+				fmt.Fprintf(w, "%9s  %s  %s\n", formatBytes(f.Size), time.Unix(f.ModTime, 0).Format("2006-01-02 15:04:05"), displayPath(filepath.Join(remotePath, f.Rel)))
+				continue
+			}
+			fmt.Fprintf(w, "%9s  %s\n", formatBytes(f.Size), displayPath(filepath.Join(remotePath, f.Rel)))
+		}
+		fmt.Fprintf(w, "Subtotal for %s: %d file(s), %s\n", remotePath, len(filtered), formatBytes(total))
+	}
+	return filtered, files, denied, nil
+}
+
+// textLikeExts are extensions that compress well enough for rsync -z to pay
+// off on a slow link.
+var textLikeExts = map[string]bool{
+	".txt": true, ".log": true, ".out": true, ".err": true, ".csv": true, ".tsv": true,
+	".json": true, ".jsonl": true, ".yaml": true, ".yml": true, ".xml": true, ".html": true,
+	".md": true, ".py": true, ".sh": true, ".cfg": true, ".ini": true, ".toml": true,
+}
+
+func validateCompressLevel(level int) error {
+	if level < 0 || level > 9 {
+		return fmt.Errorf("compress-level %d must be between 1 and 9", level)
+	}
+	return nil
+}
+
+// compressArgs returns the rsync compression flags for files. An explicit
+// setting wins; otherwise compression is on when most files are text-like.
+func (o fetchOptions) compressArgs(files []string) []string {
+	on := false
+	if o.Compress != nil {
+		on = *o.Compress
+	} else {
+		text := 0
+		for _, f := range files {
+			if textLikeExts[strings.ToLower(filepath.Ext(f))] {
+				text++
+			}
+		}
+		on = text*2 > len(files)
+	}
+	if !on {
+		return nil
+	}
+	if o.CompressLevel > 0 {
+		return []string{"-z", fmt.Sprintf("--compress-level=%d", o.CompressLevel)}
+	}
+	return []string{"-z"}
+}
+
+// latestRemoteFiles keeps the n most recently modified files, either overall
+// or within each directory, newest first.
+func latestRemoteFiles(files []remoteFile, n int, perDir bool) []remoteFile {
+	sorted := append([]remoteFile(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ModTime != sorted[j].ModTime {
+			return sorted[i].ModTime > sorted[j].ModTime
+		}
+		return sorted[i].Rel < sorted[j].Rel
+	})
+	kept := make(map[string]int)
+	var out []remoteFile
+	for _, f := range sorted {
+		group := ""
+		if perDir {
+			group = path.Dir(f.Rel)
+		}
+		if kept[group] >= n {
+			continue
+		}
+		kept[group]++
+		out = append(out, f)
+	}
+	return out
+}
+
+// remoteFile is one entry of a remote artifact listing.
+type remoteFile struct {
+	Rel     string
+	Size    int64
+	ModTime int64 // unix seconds
+}
+
+func (f remoteFile) String() string { return f.Rel }
+
+// listRemoteFiles lists the files under root on remote. The listing is
+// parsed as it streams in, so only the records filter keeps are held in
+// memory. When find's only errors were unreadable directories, the files it
+// did list are returned with a *deniedError.
+//
+// A listing that fails on the way to the host is retried (see retrySSH).
+func listRemoteFiles(w io.Writer, remote string, sshOpts sshHostOptions, root, symlinks string, since time.Time, filter listFilter) ([]remoteFile, string, error) {
+	var files []remoteFile
+	var command string
+	err := retrySSH(w, remote, "listing "+remote, sshRetryPolicy, time.Sleep, func() (string, error) {
+		var err error
+		files, command, err = listRemoteFilesOnce(w, remote, sshOpts, root, symlinks, since, filter)
+		return "", err
+	})
+	return files, command, err
 }
 
-func queryJobStatus(remote, jobID string) (string, error) {
-	if jobID == "" {
-		return "UNKNOWN", nil
+func listRemoteFilesOnce(w io.Writer, remote string, sshOpts sshHostOptions, root, symlinks string, since time.Time, filter listFilter) ([]remoteFile, string, error) {
+	if cwd, err := os.Getwd(); err == nil {
+		fmt.Fprintf(w, "Local PWD during listRemoteFiles: %s\n", cwd)
+	} else {
+		fmt.Fprintf(w, "Local PWD during listRemoteFiles: unable to determine working directory: %v\n", err)
 	}
-	status, err := runSqueue(remote, jobID)
+	var cmdBuilder strings.Builder
+	cmdBuilder.WriteString("echo Remote initial PWD: \"$PWD\" >&2 && ")
+	cmdBuilder.WriteString(remoteListCommand(root, symlinks, since, filter))
+
+	cmd := sshCommand(remote, sshOpts, "bash", "-lc", cmdBuilder.String()).withTimeout(timeouts.Transfer)
+	var stderrBuf bytes.Buffer
+	cmd.Stderr = &stderrBuf
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", err
+		return nil, cmdBuilder.String(), err
 	}
-	if status != "" {
-		return status, nil
+	if err := cmd.Start(); err != nil {
+		return nil, cmdBuilder.String(), fmt.Errorf("remote find failed: %w", err)
 	}
-	if status, err = runSacct(remote, jobID); err == nil {
-		if status != "" {
-			return status, nil
-		}
-	} else {
-		// sacct is optional; treat missing sacct as "unknown" once the job leaves squeue
-		return "UNKNOWN", nil
+	files, received, scanErr := filter.scan(stdout)
+	if scanErr != nil {
+		// Stop the remote find rather than draining a listing we will not use.
+		cmd.Kill()
 	}
-	return "UNKNOWN", nil
-}
-
-func runSqueue(remote, jobID string) (string, error) {
-	cmd := exec.Command("ssh", remote, "squeue", "-h", "-j", jobID, "-o", "%T")
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("squeue: %v (output: %s)", err, strings.TrimSpace(string(out)))
+	err = cmd.Wait()
+	stderrText := stderrBuf.String()
+	if stderrText != "" {
+		fmt.Fprint(w, stderrText)
 	}
-	text := strings.TrimSpace(string(out))
-	if text == "" {
-		return "", nil
+	if errors.Is(scanErr, errListLimit) {
+		return nil, cmdBuilder.String(), fmt.Errorf("remote listing of %s passed --list-limit %d files; narrow the artifact patterns or raise --list-limit", root, filter.Limit)
+	}
+	if scanErr != nil {
+		return nil, cmdBuilder.String(), scanErr
+	}
+	denied, onlyDenied := parseDeniedPaths(stderrText, root)
+	if code, ok := exitCode(err); ok && onlyDenied && code == 1 {
+		// The readable part of the tree was listed in full.
+		return files, cmdBuilder.String(), &deniedError{Paths: denied, err: fmt.Errorf("remote find failed: %w", err)}
 	}
-	lines := strings.Split(text, "\n")
-	return strings.TrimSpace(lines[0]), nil
-}
-
-func runSacct(remote, jobID string) (string, error) {
-	cmd := exec.Command("ssh", remote, "sacct", "-n", "-X", "-j", jobID, "-o", "State")
-	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("sacct: %v (output: %s)", err, strings.TrimSpace(string(out)))
+		return nil, cmdBuilder.String(), fmt.Errorf("remote find failed: %w\nCommand: %s\nRecords received: %d\nStderr: %s",
+			err, cmdBuilder.String(), received, strings.TrimSpace(stderrText))
 	}
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		state := line
-		if idx := strings.Index(state, " "); idx >= 0 {
-			state = state[:idx]
-		}
-		state = strings.Trim(state, "+")
-		return state, nil
+	if onlyDenied {
+		// find -L tolerates exit code 1 for symlink loops.
+		return files, cmdBuilder.String(), &deniedError{Paths: denied, err: errors.New("remote find could not read every directory")}
 	}
-	return "", nil
+	return files, cmdBuilder.String(), nil
 }
 
-func updateExperimentStatus(db *sql.DB, id int64, status string, completedAt *time.Time) error {
-	if completedAt != nil {
-		_, err := db.Exec(`UPDATE experiments SET job_status = ?, completed_at = ? WHERE id = ?`,
-			status, completedAt.Format(time.RFC3339), id)
-		return err
+// remoteListCommand is the shell snippet that lists regular files under
+// root, skipping filter's pruned directories and narrowed by its find
+// predicate. Records are NUL-terminated so any file name survives, including
+// ones with newlines.
+func remoteListCommand(root, symlinks string, since time.Time, filter listFilter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cd %s && echo Remote PWD after cd: \"$PWD\" >&2 && ", shellQuote(root))
+	action := " -printf '%s\\t%T@\\t%P\\0'"
+	if filter.Predicate != "" {
+		action = " " + filter.Predicate + action
+	}
+	b.WriteString(findFilesCommand(symlinks, filter.Prune, since, action))
+	return b.String()
+}
+
+const (
+	symlinksFollow   = "follow"
+	symlinksPreserve = "preserve"
+
+	// symlinkMaxDepth bounds how deep find -L descends through linked
+	// directories.
+	symlinkMaxDepth = 32
+)
+
+// normalizeSymlinks validates a symlinks setting; "" skips symlinks.
+func normalizeSymlinks(mode string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(mode)); m {
+	case "", symlinksFollow, symlinksPreserve:
+		return m, nil
+	case "skip", "ignore":
+		return "", nil
+	default:
+		return "", fmt.Errorf("symlinks %q must be follow, preserve or skip", mode)
 	}
-	_, err := db.Exec(`UPDATE experiments SET job_status = ? WHERE id = ?`, status, id)
-	return err
 }
 
-func recordArtifactSync(db *sql.DB, id int64, syncedAt *time.Time, errMsg string) error {
-	ts := ""
-	if syncedAt != nil {
-		ts = syncedAt.Format(time.RFC3339)
+// preservesSymlinks reports whether any of sources fetches symlinks as links.
+func preservesSymlinks(sources []ArtifactSource) bool {
+	for _, src := range sources {
+		if src.Symlinks == symlinksPreserve {
+			return true
+		}
 	}
-	_, err := db.Exec(`UPDATE experiments SET artifact_last_sync = ?, artifact_last_error = ? WHERE id = ?`, ts, errMsg, id)
-	return err
+	return false
 }
 
-func fetchArtifactSources(exp *Experiment, sources []ArtifactSource, destDir string, sinceStart bool, dryRun bool) error {
-	if len(sources) == 0 {
-		fmt.Println("No artifact sources to process; nothing to copy.")
-		return nil
+// normalizeSourceSymlinks validates and canonicalizes each source's symlinks
+// setting.
+func normalizeSourceSymlinks(sources []ArtifactSource) error {
+	for i := range sources {
+		mode, err := normalizeSymlinks(sources[i].Symlinks)
+		if err != nil {
+			return fmt.Errorf("artifact source %s: %w", sources[i].Path, err)
+		}
+		sources[i].Symlinks = mode
 	}
+	return nil
+}
+
+// validateSourceRemotes checks every per-source host override.
+func validateSourceRemotes(sources []ArtifactSource) error {
 	for _, src := range sources {
-		if src.Path == "" {
-			return fmt.Errorf("artifact source has empty path")
+		if src.Remote == "" {
+			continue
 		}
-		fmt.Printf("Fetching artifacts from %s\n", src.Path)
-		if err := fetchArtifacts(exp, src.Path, destDir, ensurePatterns(src.Patterns), sinceStart, dryRun); err != nil {
-			return err
+		if err := validateRemoteHost(src.Remote); err != nil {
+			return fmt.Errorf("artifact source %s: %w", src.Path, err)
 		}
 	}
 	return nil
 }
 
-func fetchArtifacts(exp *Experiment, remotePath, destDir string, patterns []string, sinceStart bool, dryRun bool) error {
-	if remotePath == "" {
-		return fmt.Errorf("remote-path is required")
-	}
-	if !strings.HasPrefix(remotePath, "/") {
-		return fmt.Errorf("remote-path must be absolute so rsync can address the files precisely")
-	}
-	absDest, err := expandLocalPath(destDir)
-	if err != nil {
-		return fmt.Errorf("artifact destination: %w", err)
-	}
-	if absDest == "" {
-		return fmt.Errorf("destination directory is required")
+// validateRemoteHost requires a user@host ssh destination. The host may not
+// start with "-" so it cannot be taken for an ssh or rsync option.
+func validateRemoteHost(remote string) error {
+	user, host, ok := strings.Cut(remote, "@")
+	if !ok || user == "" || host == "" || strings.Contains(host, "@") ||
+		strings.HasPrefix(remote, "-") || strings.HasPrefix(host, "-") || strings.ContainsAny(remote, " \t\n:/") {
+		return fmt.Errorf("remote %q must be in user@host form", remote)
 	}
+	return nil
+}
 
-	var since time.Time
-	if sinceStart {
-		if exp.CreatedAt.IsZero() {
-			return fmt.Errorf("experiment %d does not have a recorded start time, cannot apply since-start filter", exp.ID)
-		}
-		since = exp.CreatedAt
+// findFilesCommand returns the find invocation selecting a source's files,
+// followed by the optional time filter and action. Directories named in
+// prune are skipped without being walked.
+//
+// With symlinks=follow, find -L reports links to files as the files they
+// point to and descends into linked directories. GNU find detects symlink
+// loops itself: it prints "File system loop detected", skips the loop and
+// exits 1, which is tolerated here (its stderr still reaches the fetch
+// output). -maxdepth caps long chains of links that are not strictly loops.
+// Dangling links are skipped. With symlinks=preserve the links themselves
+// are listed and rsync recreates them locally.
+func findFilesCommand(symlinks string, prune []string, since time.Time, action string) string {
+	filter := ""
+	if !since.IsZero() {
+		filter = newerThanArg(since)
+	}
+	skip := pruneClause(prune)
+	switch symlinks {
+	case symlinksFollow:
+		return fmt.Sprintf("{ find -L . -maxdepth %d %s-type f%s%s || [ $? -eq 1 ]; }", symlinkMaxDepth, skip, filter, action)
+	case symlinksPreserve:
+		return fmt.Sprintf("find . %s\\( -type f -o -type l \\)%s%s", skip, filter, action)
+	default:
+		return fmt.Sprintf("find . %s-type f%s%s", skip, filter, action)
 	}
+}
 
-	var files []string
-	var cmd string
-
-	attempts := []struct {
-		label string
-		ts    time.Time
-	}{
-		{"without time filter", time.Time{}},
+// pruneClause is the find expression, ending in -o, that stops find from
+// descending into directories named in prune.
+func pruneClause(prune []string) string {
+	if len(prune) == 0 {
+		return ""
 	}
-	if sinceStart {
-		attempts = append([]struct {
-			label string
-			ts    time.Time
-		}{{"since-start window", since}}, attempts...)
+	tests := make([]string, len(prune))
+	for i, name := range prune {
+		tests[i] = "-name " + shellQuote(name)
 	}
+	return `\( ` + strings.Join(tests, " -o ") + ` \) -type d -prune -o `
+}
 
-	for _, attempt := range attempts {
-		for retry := 0; retry < 6; retry++ {
-			if retry > 0 {
-				time.Sleep(3 * time.Second)
-			}
-			fmt.Printf("Querying %s for files under %s (%s, attempt %d)...\n", exp.Remote, remotePath, attempt.label, retry+1)
-			files, cmd, err = listRemoteFiles(exp.Remote, remotePath, attempt.ts)
-			fmt.Println("files found: ", files)
-			if err != nil {
-				return err
-			}
-			if len(files) > 0 {
-				goto FILES_FOUND
+// inPrunedDir reports whether rel lies under a directory the remote listing
+// prunes, matching each directory name as find -name does.
+func inPrunedDir(rel string, prune []string) bool {
+	dirs := strings.Split(rel, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		for _, name := range prune {
+			if ok, _ := path.Match(name, dir); ok {
+				return true
 			}
 		}
 	}
+	return false
+}
 
-FILES_FOUND:
-	if len(files) == 0 {
-		fmt.Printf("Remote find produced no files (command: %s)\n", cmd)
-		fmt.Println("No files matched the provided filters; nothing to copy.")
-		return nil
-	}
-
-	var compiled []*regexp.Regexp
-	for _, pat := range patterns {
-		pat = strings.TrimSpace(pat)
-		if pat == "" {
-			continue
+// validatePruneDirs checks prune_dirs entries, which match directory
+// basenames and so may not contain a "/".
+func validatePruneDirs(names []string) error {
+	for _, name := range names {
+		switch {
+		case name == "" || name == "." || name == "..":
+			return fmt.Errorf("%q is not a directory name", name)
+		case strings.Contains(name, "/"):
+			return fmt.Errorf("%q contains a /; prune names match directory basenames, not paths", name)
 		}
-		re, err := regexp.Compile(pat)
-		if err != nil {
-			return fmt.Errorf("compile pattern %q: %w", pat, err)
-		}
-		compiled = append(compiled, re)
 	}
+	return nil
+}
 
-	var filtered []string
-	for _, rel := range files {
-		if !patternMatches(compiled, remotePath, rel) {
-			continue
+// validateSourcePruneDirs checks every source's prune_dirs.
+func validateSourcePruneDirs(sources []ArtifactSource) error {
+	for _, src := range sources {
+		if err := validatePruneDirs(src.PruneDirs); err != nil {
+			return fmt.Errorf("artifact source %s: prune_dirs %w", src.Path, err)
 		}
-		filtered = append(filtered, rel)
 	}
+	return nil
+}
 
-	if len(filtered) == 0 {
-		fmt.Println("No files matched the provided filters; nothing to copy.")
-		return nil
-	}
+// parseRemoteListing parses the NUL-terminated "size<TAB>mtime<TAB>path"
+// records printed by remoteListCommand. The path is taken verbatim.
+func parseRemoteListing(out string) ([]remoteFile, error) {
+	files, _, err := listFilter{}.scan(strings.NewReader(out))
+	return files, err
+}
 
-	fmt.Printf("Matched %d file(s).\n", len(filtered))
-	if dryRun {
-		for _, rel := range filtered {
-			fmt.Println(filepath.Join(remotePath, rel))
-		}
-		return nil
+// parseListingRecord parses one listing record; ok is false for blank ones.
+func parseListingRecord(line string) (f remoteFile, ok bool, err error) {
+	if strings.TrimSpace(line) == "" {
+		return remoteFile{}, false, nil
+	}
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) != 3 {
+		return remoteFile{}, false, fmt.Errorf("unexpected listing line %q", line)
 	}
+	size, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+	if err != nil {
+		return remoteFile{}, false, fmt.Errorf("unexpected size in listing line %q", line)
+	}
+	mtime, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return remoteFile{}, false, fmt.Errorf("unexpected mtime in listing line %q", line)
+	}
+	if fields[2] == "" {
+		return remoteFile{}, false, nil
+	}
+	return remoteFile{Rel: fields[2], Size: size, ModTime: int64(mtime)}, true, nil
+}
 
-	if err := rsyncFiles(exp.Remote, remotePath, filtered, absDest); err != nil {
-		return err
+// filesFrom0 is the --files-from input for rsync --from0: one name per
+// NUL, so names are never split, unescaped or taken for comments.
+func filesFrom0(files []string) string {
+	var b strings.Builder
+	for _, f := range files {
+		b.WriteString(f)
+		b.WriteByte(0)
 	}
-	return nil
+	return b.String()
 }
 
-func listRemoteFiles(remote, root string, since time.Time) ([]string, string, error) {
-	if cwd, err := os.Getwd(); err == nil {
-		fmt.Printf("Local PWD during listRemoteFiles: %s\n", cwd)
-	} else {
-		fmt.Printf("Local PWD during listRemoteFiles: unable to determine working directory: %v\n", err)
+// displayPath returns p for printing, quoted Go-style when it contains
+// control characters or invalid UTF-8 that would garble the terminal.
+func displayPath(p string) string {
+	if !utf8.ValidString(p) || strings.IndexFunc(p, unicode.IsControl) >= 0 {
+		return strconv.Quote(p)
 	}
-	var cmdBuilder strings.Builder
-	fmt.Fprintf(&cmdBuilder, "echo Remote initial PWD: \"$PWD\" >&2 && cd %s && echo Remote PWD after cd: \"$PWD\" >&2 && find . -type f", shellQuote(root))
-	if !since.IsZero() {
-		cutoff := since.UTC().Add(-sinceStartGracePeriod)
-		epoch := cutoff.Unix()
-		fmt.Fprintf(&cmdBuilder, " -newermt %s", shellQuote(fmt.Sprintf("@%d", epoch)))
+	return p
+}
+
+// rsyncTransferredRe matches the --stats line counting transferred files;
+// rsync before 3.1 does not say "regular".
+var rsyncTransferredRe = regexp.MustCompile(`(?m)^Number of (?:regular )?files transferred: ([\d,]+)`)
+
+// parseRsyncTransferred reads the transferred file count from rsync --stats
+// output.
+func parseRsyncTransferred(out string) (int, bool) {
+	m := rsyncTransferredRe.FindStringSubmatch(out)
+	if m == nil {
+		return 0, false
 	}
-	cmdBuilder.WriteString(" -print")
+	n, err := strconv.Atoi(strings.ReplaceAll(m[1], ",", ""))
+	return n, err == nil
+}
 
-	cmd := exec.Command("ssh", remote, "bash", "-lc", cmdBuilder.String())
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
-	err := cmd.Run()
-	stderrText := stderrBuf.String()
-	if stderrText != "" {
-		fmt.Print(stderrText)
+// rsyncArgs builds the rsync command line copying files (read NUL-separated
+// from stdin) from src on remote into absDest.
+func rsyncArgs(remote string, src ArtifactSource, files []string, absDest string, opts fetchOptions) []string {
+	sourceRoot := strings.TrimRight(src.Path, "/")
+	if sourceRoot == "" {
+		sourceRoot = "/"
 	}
-	if err != nil {
-		return nil, cmdBuilder.String(), fmt.Errorf("remote find failed: %v\nCommand: %s\nStdout: %s\nStderr: %s",
-			err, cmdBuilder.String(), strings.TrimSpace(stdoutBuf.String()), strings.TrimSpace(stderrText))
+	// Keep partially transferred files so a retry (or the next fetch)
+	// resumes instead of starting over; --stats reports how many files
+	// rsync actually transferred.
+	args := []string{"-av", "--stats", "--files-from=-", "--from0", "--partial", "--partial-dir=" + rsyncPartialDir}
+	if opts.Checksum {
+		args = append(args, "--checksum")
 	}
-	trimmed := strings.TrimSpace(stdoutBuf.String())
-	if trimmed == "" {
-		return nil, cmdBuilder.String(), nil
+	if opts.AppendVerify {
+		args = append(args, "--append-verify")
 	}
-	lines := strings.Split(trimmed, "\n")
-	var files []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || line == "." {
-			continue
-		}
-		line = strings.TrimPrefix(line, "./")
-		files = append(files, line)
+	if opts.BWLimit != "" {
+		args = append(args, "--bwlimit="+opts.BWLimit)
 	}
-	return files, cmdBuilder.String(), nil
+	switch src.Symlinks {
+	case symlinksFollow:
+		// Store what the links point at as real files.
+		args = append(args, "--copy-links")
+	case symlinksPreserve:
+		args = append(args, "--links")
+	}
+	args = append(args, opts.compressArgs(files)...)
+	return append(args, fmt.Sprintf("%s:%s/", remote, sourceRoot), absDest)
 }
 
-func rsyncFiles(remote, root string, files []string, dest string) error {
+// rsyncFiles copies files (relative to src.Path on remote) into dest and
+// returns what rsync's --stats block says it transferred. Progress is shown
+// as it goes. A partial transfer that only failed on unreadable files
+// returns a *deniedError.
+func rsyncFiles(w io.Writer, remote string, sshOpts sshHostOptions, src ArtifactSource, files []string, dest string, opts fetchOptions) (transferTally, error) {
 	if len(files) == 0 {
-		return nil
+		return transferTally{}, nil
 	}
 	absDest, err := filepath.Abs(dest)
 	if err != nil {
-		return fmt.Errorf("resolve destination: %w", err)
+		return transferTally{}, fmt.Errorf("resolve destination: %w", err)
 	}
 	if err := os.MkdirAll(absDest, 0o755); err != nil {
-		return fmt.Errorf("ensure destination: %w", err)
+		return transferTally{}, fmt.Errorf("ensure destination: %w", err)
+	}
+
+	args := append(rsyncProgressArgs(), rsyncArgs(remote, src, files, absDest, opts)...)
+	from := args[len(args)-2]
+	fmt.Fprintf(w, "Starting rsync: rsync %s %s\n", strings.Join(args[:len(args)-2], " "), strings.Join(args[len(args)-2:], " "))
+	fmt.Fprintf(w, "  Files-from: %s\n  Destination: %s\n", from, absDest)
+
+	retries, backoff := opts.RsyncRetries, opts.RsyncBackoff
+	if retries < 0 {
+		retries = 0
+	}
+	if backoff <= 0 {
+		backoff = defaultRsyncBackoff
+	}
+	// Files a failed attempt finished are not sent again, so the tally
+	// counts every attempt.
+	var tally transferTally
+	for attempt := 0; ; attempt++ {
+		var out, errOut bytes.Buffer
+		progress := newRsyncProgress(w)
+		cmd := runCommand("rsync", append(rsyncSSHArgs(sshOpts), args...)...)
+		cmd.Stdin = strings.NewReader(filesFrom0(files))
+		cmd.Stdout = io.MultiWriter(progress, &out)
+		cmd.Stderr = io.MultiWriter(w, &errOut)
+		if w == io.Writer(os.Stdout) {
+			cmd.Stderr = io.MultiWriter(os.Stderr, &errOut)
+		}
+		err := cmd.Run()
+		progress.finish()
+		attemptTally, ok := parseRsyncStats(out.String())
+		if !ok && err != nil {
+			attemptTally = progress.transferred()
+		}
+		tally = tally.add(attemptTally)
+		if err == nil {
+			return tally, nil
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return transferTally{}, fmt.Errorf("rsync failed: %w", err)
+		}
+		code := exitErr.ExitCode()
+		retryable, meaning := classifyRsyncExit(code)
+		if code == 255 {
+			// rsync's ssh failed; a rejected key or host key would fail
+			// every retry too.
+			if class := classifySSHError(err, errOut.String()); !class.transient() && class != sshErrRemote {
+				return transferTally{}, &sshError{Remote: remote, Class: class, Attempts: attempt + 1, err: fmt.Errorf("rsync failed with exit code %d (%s): %w", code, meaning, err)}
+			}
+		}
+		if denied, ok := parseDeniedPaths(errOut.String(), src.Path); ok && code == 23 {
+			return tally, &deniedError{Paths: denied, err: fmt.Errorf("rsync failed with exit code %d (%s): %w", code, meaning, err)}
+		}
+		if !retryable || attempt >= retries {
+			return transferTally{}, fmt.Errorf("rsync failed with exit code %d (%s): %w", code, meaning, err)
+		}
+		wait := backoff << attempt
+		fmt.Fprintf(w, "rsync exited with code %d (%s); retrying in %s (retry %d of %d)\n", code, meaning, wait, attempt+1, retries)
+		time.Sleep(wait)
 	}
+}
 
-	sourceRoot := strings.TrimRight(root, "/")
-	if sourceRoot == "" {
-		sourceRoot = "/"
-	}
-	src := fmt.Sprintf("%s:%s/", remote, sourceRoot)
-	args := []string{"-av", "--files-from=-", src, absDest}
-	cmd := exec.Command("rsync", args...)
-	cmd.Stdin = strings.NewReader(strings.Join(files, "\n") + "\n")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	fmt.Printf("Starting rsync: rsync %s %s\n", strings.Join(args[:len(args)-2], " "), strings.Join(args[len(args)-2:], " "))
-	fmt.Printf("  Files-from: %s\n  Destination: %s\n", src, absDest)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("rsync failed: %w", err)
+const (
+	// rsyncPartialDir holds interrupted transfers inside each destination;
+	// local listings skip it.
+	rsyncPartialDir     = ".rsync-partial"
+	defaultRsyncRetries = 3
+	defaultRsyncBackoff = 10 * time.Second
+)
+
+// classifyRsyncExit explains an rsync exit code and reports whether it looks
+// like a transient network failure worth retrying. Errors such as permission
+// denied (23) or vanished source files (24) would just fail again.
+func classifyRsyncExit(code int) (retryable bool, meaning string) {
+	switch code {
+	case 5:
+		return true, "error starting the client-server protocol"
+	case 10:
+		return true, "socket I/O error"
+	case 12:
+		return true, "protocol data stream error"
+	case 30:
+		return true, "timeout in data send/receive"
+	case 35:
+		return true, "timeout waiting for daemon connection"
+	case 255:
+		return true, "ssh connection failed"
+	case 1:
+		return false, "syntax or usage error"
+	case 2:
+		return false, "protocol incompatibility"
+	case 3:
+		return false, "error selecting input/output files"
+	case 4:
+		return false, "action not supported"
+	case 11:
+		return false, "file I/O error"
+	case 20:
+		return false, "interrupted by a signal"
+	case 22:
+		return false, "out of memory"
+	case 23:
+		return false, "partial transfer due to error (e.g. permission denied)"
+	case 24:
+		return false, "some source files vanished"
+	default:
+		return false, "unrecognized rsync error"
 	}
-	return nil
 }
 
-func patternMatches(res []*regexp.Regexp, remoteRoot, rel string) bool {
+// patternMatches reports whether rel (relative to remoteRoot) matches any
+// include pattern and no negated one, trying the relative path, its base
+// name, and the full remote path. A list of only negated patterns includes
+// everything they do not exclude.
+func patternMatches(res []pathMatcher, remoteRoot, rel string) bool {
 	if len(res) == 0 {
 		return true
 	}
@@ -1580,15 +4967,32 @@ func patternMatches(res []*regexp.Regexp, remoteRoot, rel string) bool {
 		full = filepath.Join(remoteRoot, rel)
 	}
 	base := filepath.Base(rel)
+	matches := func(re pathMatcher) bool {
+		return re.MatchString(rel) || re.MatchString(base) || re.MatchString(full)
+	}
+	included, haveIncludes := false, false
 	for _, re := range res {
 		if re == nil {
 			continue
 		}
-		if re.MatchString(rel) || re.MatchString(base) || re.MatchString(full) {
-			return true
+		if _, ok := re.(negatedMatcher); ok {
+			continue
+		}
+		haveIncludes = true
+		if matches(re) {
+			included = true
+			break
 		}
 	}
-	return false
+	if haveIncludes && !included {
+		return false
+	}
+	for _, re := range res {
+		if neg, ok := re.(negatedMatcher); ok && matches(neg.pathMatcher) {
+			return false
+		}
+	}
+	return true
 }
 
 func shellQuote(s string) string {
@@ -1620,6 +5024,45 @@ func expandLocalPath(p string) (string, error) {
 	return filepath.Abs(p)
 }
 
+// dirSize returns the total size of regular files under path. A missing path
+// has size zero.
+func dirSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// confirm asks a yes/no question on stdin and defaults to no.
+func confirm(prompt string) bool {
+	return confirmOn(os.Stdout, prompt)
+}
+
+// confirmOn asks prompt on w and reads the answer from stdin.
+func confirmOn(w io.Writer, prompt string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", prompt)
+	var answer string
+	if _, err := fmt.Scanln(&answer); err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 func copyArtifactSources(src []ArtifactSource) []ArtifactSource {
 	if len(src) == 0 {
 		return nil
@@ -1627,8 +5070,14 @@ func copyArtifactSources(src []ArtifactSource) []ArtifactSource {
 	dst := make([]ArtifactSource, len(src))
 	for i, s := range src {
 		dst[i] = ArtifactSource{
-			Path:     s.Path,
-			Patterns: append([]string(nil), s.Patterns...),
+			Name:          s.Name,
+			Path:          s.Path,
+			Patterns:      append([]string(nil), s.Patterns...),
+			PatternSyntax: s.PatternSyntax,
+			Flatten:       s.Flatten,
+			Symlinks:      s.Symlinks,
+			Remote:        s.Remote,
+			PruneDirs:     append([]string(nil), s.PruneDirs...),
 		}
 	}
 	return dst
@@ -1649,29 +5098,41 @@ func normalizePatternList(single string, list []string) []string {
 	return res
 }
 
+// ensurePatterns drops blank patterns and normalizes negations, so "! x"
+// and "!x" are the same pattern.
 func ensurePatterns(pats []string) []string {
 	if len(pats) == 0 {
 		return nil
 	}
 	var out []string
 	for _, p := range pats {
-		p = strings.TrimSpace(p)
-		if p != "" {
+		if p = normalizePattern(p); p != "" {
 			out = append(out, p)
 		}
 	}
 	return out
 }
 
-func combinePatterns(patterns []string) string {
-	var cleaned []string
-	for _, p := range patterns {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			cleaned = append(cleaned, p)
-		}
+func normalizePattern(p string) string {
+	p = strings.TrimSpace(p)
+	if body, negated := cutNegation(p); negated && body != "" {
+		return "!" + body
+	}
+	return p
+}
+
+// describePattern renders a pattern for display, spelling out negations.
+func describePattern(p string) string {
+	if body, negated := cutNegation(p); negated {
+		return "not " + body
 	}
-	return strings.Join(cleaned, "\n")
+	return p
+}
+
+// combinePatterns joins patterns one per line for the artifact_pattern
+// column; splitPatterns reverses it, "!" prefixes included.
+func combinePatterns(patterns []string) string {
+	return strings.Join(ensurePatterns(patterns), "\n")
 }
 
 func splitPatterns(s string) []string {
@@ -1679,31 +5140,21 @@ func splitPatterns(s string) []string {
 	if s == "" {
 		return nil
 	}
-	lines := strings.Split(s, "\n")
-	var out []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			out = append(out, line)
-		}
-	}
-	return out
+	return ensurePatterns(strings.Split(s, "\n"))
 }
 
 func (exp *Experiment) EffectiveArtifactSources() []ArtifactSource {
 	if exp == nil {
 		return nil
 	}
-	if len(exp.ArtifactSources) > 0 {
-		return copyArtifactSources(exp.ArtifactSources)
-	}
-	if exp.ArtifactRemote == "" {
+	if len(exp.ArtifactSources) == 0 {
 		return nil
 	}
-	return []ArtifactSource{{
-		Path:     exp.ArtifactRemote,
-		Patterns: splitPatterns(exp.ArtifactPattern),
-	}}
+	sources := copyArtifactSources(exp.ArtifactSources)
+	// Names were validated at submit time; this only fills in defaults
+	// for experiments recorded before sources had names.
+	_ = assignSourceNames(sources)
+	return sources
 }
 
 func flattenPatternsFromSources(src []ArtifactSource) []string {
@@ -1725,28 +5176,6 @@ func boolToInt(b bool) int {
 	return 0
 }
 
-func unmarshalConfigData(data []byte, ext string, target interface{}) error {
-	trimmed := bytes.TrimSpace(data)
-	if len(trimmed) == 0 {
-		return nil
-	}
-	format := strings.ToLower(ext)
-	switch format {
-	case ".yaml", ".yml":
-		return unmarshalYAML(trimmed, target)
-	case ".json", "":
-		if err := json.Unmarshal(trimmed, target); err == nil {
-			return nil
-		}
-		return unmarshalYAML(trimmed, target)
-	default:
-		if err := json.Unmarshal(trimmed, target); err == nil {
-			return nil
-		}
-		return unmarshalYAML(trimmed, target)
-	}
-}
-
 func unmarshalYAML(data []byte, target interface{}) error {
 	node, err := parseYAMLDocument(data)
 	if err != nil {
@@ -1767,14 +5196,14 @@ func unmarshalYAML(data []byte, target interface{}) error {
 
 func parseYAMLDocument(data []byte) (map[string]interface{}, error) {
 	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
-	m, idx, err := parseYAMLMap(lines, 0, 0)
+	m, idx, err := parseYAMLMap(lines, 0, 0, newYAMLAnchors())
 	if err != nil {
 		return nil, err
 	}
 	for i := idx; i < len(lines); i++ {
 		_, _, ok, err := preprocessYAMLLine(lines[i])
 		if err != nil {
-			return nil, fmt.Errorf("line %d: %w", i+1, err)
+			return nil, yamlLineError(lines, i, err)
 		}
 		if !ok {
 			continue
@@ -1784,13 +5213,14 @@ func parseYAMLDocument(data []byte) (map[string]interface{}, error) {
 	return m, nil
 }
 
-func parseYAMLMap(lines []string, start, indent int) (map[string]interface{}, int, error) {
+func parseYAMLMap(lines []string, start, indent int, anchors *yamlAnchors) (map[string]interface{}, int, error) {
 	result := make(map[string]interface{})
+	var merges []yamlMerge
 	i := start
 	for i < len(lines) {
 		trimmed, lineIndent, ok, err := preprocessYAMLLine(lines[i])
 		if err != nil {
-			return nil, 0, fmt.Errorf("line %d: %w", i+1, err)
+			return nil, 0, yamlLineError(lines, i, err)
 		}
 		if !ok {
 			i++
@@ -1800,7 +5230,7 @@ func parseYAMLMap(lines []string, start, indent int) (map[string]interface{}, in
 			break
 		}
 		if lineIndent > indent {
-			return nil, 0, fmt.Errorf("line %d: unexpected indentation", i+1)
+			return nil, 0, yamlIndentError(lines, i, indent, lineIndent, "", "only a key with nothing after its ':' has lines nested under it, indented 2 spaces more than the key")
 		}
 		if strings.HasPrefix(trimmed, "- ") {
 			return nil, 0, fmt.Errorf("line %d: unexpected list item", i+1)
@@ -1814,65 +5244,72 @@ func parseYAMLMap(lines []string, start, indent int) (map[string]interface{}, in
 			return nil, 0, fmt.Errorf("line %d: missing key", i+1)
 		}
 		rest := strings.TrimSpace(trimmed[colon+1:])
-		if rest != "" {
-			result[key] = parseYAMLScalar(rest)
-			i++
-			continue
-		}
-		nextIdx := i + 1
-		handled := false
-		for nextIdx < len(lines) {
-			nextTrimmed, nextIndent, ok, err := preprocessYAMLLine(lines[nextIdx])
+		line := i + 1
+		var value interface{}
+		anchor, after, anchored := cutYAMLAnchor(rest)
+		switch {
+		case rest == "" || anchored && after == "":
+			// A block value, anchored as a whole.
+			anchors.begin(anchor)
+			value, i, err = parseYAMLBlock(lines, i+1, indent+2, anchors)
 			if err != nil {
-				return nil, 0, fmt.Errorf("line %d: %w", nextIdx+1, err)
-			}
-			if !ok {
-				nextIdx++
-				continue
-			}
-			if nextIndent < indent+2 {
-				result[key] = map[string]interface{}{}
-				i = nextIdx
-				handled = true
-				break
-			}
-			if nextIndent > indent+2 {
-				return nil, 0, fmt.Errorf("line %d: unexpected indentation", nextIdx+1)
-			}
-			if strings.HasPrefix(nextTrimmed, "- ") {
-				list, newIdx, err := parseYAMLList(lines, nextIdx, indent+2)
-				if err != nil {
-					return nil, 0, err
-				}
-				result[key] = list
-				i = newIdx
-				handled = true
-				break
+				return nil, 0, err
 			}
-			child, newIdx, err := parseYAMLMap(lines, nextIdx, indent+2)
-			if err != nil {
+			anchors.define(anchor, value)
+		case isYAMLBlockHeader(after):
+			value, i = parseYAMLBlockScalar(lines, i+1, indent, after)
+			anchors.define(anchor, value)
+		default:
+			if value, err = anchors.scalar(rest, line); err != nil {
 				return nil, 0, err
 			}
-			result[key] = child
-			i = newIdx
-			handled = true
-			break
+			i++
 		}
-		if !handled {
-			result[key] = map[string]interface{}{}
-			i = nextIdx
+		if key == "<<" {
+			merges = append(merges, yamlMerge{value, line})
+			continue
 		}
+		result[key] = value
+	}
+	if err := mergeYAML(result, merges); err != nil {
+		return nil, 0, err
 	}
 	return result, i, nil
 }
 
-func parseYAMLList(lines []string, start, indent int) ([]interface{}, int, error) {
+// parseYAMLBlock reads the block value starting at lines[start], a list or
+// a mapping indented by indent; a block with nothing indented that far is
+// an empty mapping.
+func parseYAMLBlock(lines []string, start, indent int, anchors *yamlAnchors) (interface{}, int, error) {
+	for i := start; i < len(lines); i++ {
+		trimmed, lineIndent, ok, err := preprocessYAMLLine(lines[i])
+		if err != nil {
+			return nil, 0, yamlLineError(lines, i, err)
+		}
+		if !ok {
+			continue
+		}
+		if lineIndent < indent {
+			return map[string]interface{}{}, i, nil
+		}
+		if lineIndent > indent {
+			return nil, 0, yamlIndentError(lines, i, indent, lineIndent, "", "nested keys and list items are indented exactly 2 spaces more than their parent key")
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			return parseYAMLList(lines, i, indent, anchors)
+		}
+		return parseYAMLMap(lines, i, indent, anchors)
+	}
+	return map[string]interface{}{}, len(lines), nil
+}
+
+func parseYAMLList(lines []string, start, indent int, anchors *yamlAnchors) ([]interface{}, int, error) {
 	var items []interface{}
 	i := start
 	for i < len(lines) {
 		trimmed, lineIndent, ok, err := preprocessYAMLLine(lines[i])
 		if err != nil {
-			return nil, 0, fmt.Errorf("line %d: %w", i+1, err)
+			return nil, 0, yamlLineError(lines, i, err)
 		}
 		if !ok {
 			i++
@@ -1882,7 +5319,7 @@ func parseYAMLList(lines []string, start, indent int) ([]interface{}, int, error
 			break
 		}
 		if lineIndent > indent {
-			return nil, 0, fmt.Errorf("line %d: unexpected indentation for list item", i+1)
+			return nil, 0, yamlIndentError(lines, i, indent, lineIndent, " for list item", "the items of a list all start at the same column")
 		}
 		if !strings.HasPrefix(trimmed, "-") {
 			break
@@ -1891,10 +5328,29 @@ func parseYAMLList(lines []string, start, indent int) ([]interface{}, int, error
 		if value == "" {
 			return nil, 0, fmt.Errorf("line %d: empty list items are not supported", i+1)
 		}
+		if anchor, after, _ := cutYAMLAnchor(value); isYAMLBlockHeader(after) {
+			text, newIdx := parseYAMLBlockScalar(lines, i+1, indent, after)
+			anchors.define(anchor, text)
+			items = append(items, text)
+			i = newIdx
+			continue
+		}
+		if anchor, after, ok := cutYAMLAnchor(value); ok && after == "" {
+			// - &name on its own anchors the block below it.
+			anchors.begin(anchor)
+			child, newIdx, err := parseYAMLBlock(lines, i+1, indent+2, anchors)
+			if err != nil {
+				return nil, 0, err
+			}
+			anchors.define(anchor, child)
+			items = append(items, child)
+			i = newIdx
+			continue
+		}
 		if isInlineMapListItem(value) {
 			original := lines[i]
 			lines[i] = strings.Repeat(" ", indent+2) + value
-			child, newIdx, err := parseYAMLMap(lines, i, indent+2)
+			child, newIdx, err := parseYAMLMap(lines, i, indent+2, anchors)
 			lines[i] = original
 			if err != nil {
 				return nil, 0, err
@@ -1903,7 +5359,11 @@ func parseYAMLList(lines []string, start, indent int) ([]interface{}, int, error
 			i = newIdx
 			continue
 		}
-		items = append(items, parseYAMLScalar(value))
+		item, err := anchors.scalar(value, i+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
 		i++
 	}
 	return items, i, nil
@@ -2006,7 +5466,7 @@ func countLeadingSpaces(line string) (int, error) {
 		case ' ':
 			count++
 		case '\t':
-			return 0, fmt.Errorf("tabs are not supported in YAML input")
+			return 0, &yamlSyntaxError{Column: i, Msg: "tab in indentation", Hint: yamlTabHint}
 		default:
 			return count, nil
 		}
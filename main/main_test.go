@@ -0,0 +1,588 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain keeps the environment's exp and XDG directories out of the tests,
+// which set HOME to a temporary directory instead, and job statuses one
+// test's fake scheduler reported out of the next.
+func TestMain(m *testing.M) {
+	for _, env := range []string{"EXP_HOME", "EXP_DB_PATH", "XDG_CONFIG_HOME", "XDG_DATA_HOME"} {
+		os.Unsetenv(env)
+	}
+	jobStatuses.ttl = 0
+	os.Exit(m.Run())
+}
+
+func TestParseInterspersed(t *testing.T) {
+	cases := []struct {
+		args    []string
+		wantPos []string
+		wantCD  bool
+	}{
+		{[]string{"12", "--cd"}, []string{"12"}, true},
+		{[]string{"--cd", "12"}, []string{"12"}, true},
+		{[]string{"12", "--", "--cd"}, []string{"12", "--cd"}, false},
+		{[]string{"1", "2"}, []string{"1", "2"}, false},
+	}
+	for _, c := range cases {
+		fs := flag.NewFlagSet("t", flag.ContinueOnError)
+		cd := fs.Bool("cd", false, "")
+		pos, err := parseInterspersed(fs, c.args)
+		if err != nil {
+			t.Fatalf("%v: %v", c.args, err)
+		}
+		if !reflect.DeepEqual(pos, c.wantPos) || *cd != c.wantCD {
+			t.Errorf("%v: got %v cd=%v, want %v cd=%v", c.args, pos, *cd, c.wantPos, c.wantCD)
+		}
+	}
+}
+
+func TestParseRemoteListing(t *testing.T) {
+	got, err := parseRemoteListing("12\t1700000000.5000000000\tmetrics.json\x000\t1700000001.0\tlogs/empty.txt\x004096\t1700000002.25\tdir with space/a\tb\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []remoteFile{
+		{Rel: "metrics.json", Size: 12, ModTime: 1700000000},
+		{Rel: "logs/empty.txt", Size: 0, ModTime: 1700000001},
+		{Rel: "dir with space/a\tb", Size: 4096, ModTime: 1700000002},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"metrics.json\x00", "12\tmetrics.json\x00", "12\tsoon\tmetrics.json\x00"} {
+		if _, err := parseRemoteListing(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	lo, hi, err := parseSizeLimits("1K", "10M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := fetchOptions{MinSize: lo, MaxSize: hi}
+	cases := map[int64]bool{0: false, 1023: false, 1024: true, 10 << 20: true, 10<<20 + 1: false}
+	for size, keep := range cases {
+		if got := opts.sizeSkipReason(size) == ""; got != keep {
+			t.Errorf("size %d: kept=%v, want %v", size, got, keep)
+		}
+	}
+	if reason := (fetchOptions{}).sizeSkipReason(1 << 40); reason != "" {
+		t.Errorf("no limits should keep everything, got %q", reason)
+	}
+	if _, _, err := parseSizeLimits("10M", "1K"); err == nil {
+		t.Error("expected an error when min-size exceeds max-size")
+	}
+	if _, _, err := parseSizeLimits("big", ""); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestCompressArgs(t *testing.T) {
+	on, off := true, false
+	textHeavy := []string{"train.log", "metrics.json", "model.pt"}
+	binaryHeavy := []string{"model.pt", "ckpt.bin", "notes.txt"}
+	cases := []struct {
+		opts  fetchOptions
+		files []string
+		want  []string
+	}{
+		{fetchOptions{}, textHeavy, []string{"-z"}},
+		{fetchOptions{}, binaryHeavy, nil},
+		{fetchOptions{Compress: &on}, binaryHeavy, []string{"-z"}},
+		{fetchOptions{Compress: &off}, textHeavy, nil},
+		{fetchOptions{Compress: &on, CompressLevel: 3}, nil, []string{"-z", "--compress-level=3"}},
+	}
+	for i, c := range cases {
+		if got := c.opts.compressArgs(c.files); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: got %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestRunConfigCompressFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.yaml")
+	if err := os.WriteFile(path, []byte("compress: true\ncompress_level: 6\nbwlimit: 500\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRunConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Compress == nil || !*cfg.Compress || cfg.CompressLevel != 6 || cfg.BWLimit != "500" {
+		t.Errorf("got compress=%v level=%d bwlimit=%q", cfg.Compress, cfg.CompressLevel, cfg.BWLimit)
+	}
+}
+
+func TestRunConfigBWLimitNumber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := os.WriteFile(path, []byte(`{"bwlimit": 1000}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRunConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BWLimit != "1000" {
+		t.Errorf("bwlimit = %q, want 1000", cfg.BWLimit)
+	}
+	var s looseString
+	for in, want := range map[string]string{`"1.5M"`: "1.5M", `1.5`: "1.5", `null`: ""} {
+		if err := json.Unmarshal([]byte(in), &s); err != nil || string(s) != want {
+			t.Errorf("%s decodes as %q, %v; want %q", in, s, err, want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`true`), &s); err == nil {
+		t.Error("true decodes as a string")
+	}
+}
+
+func TestRunConfigBuildScriptInline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.yaml")
+	data := "name: sweep\nbuild_script_inline: |\n  set -x\n  module load cuda/12.4\n  make -C ~/src -j8\nremote: u@h\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRunConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "set -x\nmodule load cuda/12.4\nmake -C ~/src -j8\n"; cfg.BuildScriptInline != want || cfg.Remote != "u@h" {
+		t.Errorf("build_script_inline = %q, remote = %q", cfg.BuildScriptInline, cfg.Remote)
+	}
+}
+
+func TestRunPoolBoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	done := make([]bool, 10)
+	runPool(len(done), 3, func(i int) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active--
+		done[i] = true
+		mu.Unlock()
+	})
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("index %d never ran", i)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("peak concurrency %d exceeds 3 workers", peak)
+	}
+}
+
+func TestArtifactCollisions(t *testing.T) {
+	results := []*sourceFetch{
+		{files: []string{"metrics.json", "a.log"}},
+		{files: []string{"b.log"}},
+		{files: []string{"metrics.json", "a.log"}},
+	}
+	if example, n := artifactCollisions(results); example != "a.log" || n != 2 {
+		t.Errorf("got %q, %d; want a.log, 2", example, n)
+	}
+	if _, n := artifactCollisions(results[:2]); n != 0 {
+		t.Errorf("expected no collisions, got %d", n)
+	}
+}
+
+func TestAssignSourceNames(t *testing.T) {
+	sources := []ArtifactSource{
+		{Path: "/scratch/run/results/"},
+		{Path: "/home/u/results"},
+		{Path: "/scratch/logs", Name: "results-2"},
+		{Path: "/"},
+	}
+	if err := assignSourceNames(sources); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, src := range sources {
+		got = append(got, src.Name)
+	}
+	want := []string{"results", "results-3", "results-2", "root"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	opts := fetchOptions{PerSource: true}
+	if dest := opts.sourceDest("/data/7", sources[1]); dest != filepath.Join("/data/7", "results-3") {
+		t.Errorf("per-source dest = %s", dest)
+	}
+	if dest := (fetchOptions{}).sourceDest("/data/7", sources[1]); dest != "/data/7" {
+		t.Errorf("flat dest = %s", dest)
+	}
+
+	for _, bad := range [][]ArtifactSource{
+		{{Path: "/a", Name: "x"}, {Path: "/b", Name: "x"}},
+		{{Path: "/a", Name: "../x"}},
+	} {
+		if err := assignSourceNames(bad); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestStaleArtifacts(t *testing.T) {
+	dest := t.TempDir()
+	for _, rel := range []string{"keep.json", "old.json", "notes.md", "sub/old.json", "ckpt-3/state.json", "sub/wandb/run.json"} {
+		p := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := ArtifactSource{Path: "/remote/out", Patterns: []string{`\.json$`}, PruneDirs: []string{"ckpt-*", "wandb"}}
+	listed := []remoteFile{{Rel: "keep.json", Size: 1}, {Rel: "new.json", Size: 1}}
+	var out strings.Builder
+	stale, err := staleArtifacts(&out, dest, src, listed, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old.json", "sub/old.json"}; !reflect.DeepEqual(stale, want) {
+		t.Errorf("stale = %v, want %v", stale, want)
+	}
+	if !strings.Contains(out.String(), "would delete 2 stale") {
+		t.Errorf("dry-run output = %q", out.String())
+	}
+	if stale, _ := staleArtifacts(&out, dest, src, nil, nil, true); stale != nil {
+		t.Errorf("an empty listing must not delete anything, got %v", stale)
+	}
+	if err := removeStaleArtifacts(&out, dest, []string{"old.json", "sub/old.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "old.json")); !os.IsNotExist(err) {
+		t.Errorf("old.json still present: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "notes.md")); err != nil {
+		t.Errorf("notes.md should survive: %v", err)
+	}
+}
+
+func TestCheckMirrorDest(t *testing.T) {
+	root := t.TempDir()
+	exp := &Experiment{ID: 7, ArtifactDest: filepath.Join(root, "7")}
+	if err := checkMirrorDest(exp, exp.ArtifactDest, 1, fetchOptions{}); err != nil {
+		t.Errorf("own directory: %v", err)
+	}
+	if err := checkMirrorDest(exp, root, 1, fetchOptions{}); err == nil {
+		t.Error("expected refusal for a directory other than the recorded one")
+	}
+	if err := checkMirrorDest(exp, exp.ArtifactDest, 2, fetchOptions{}); err == nil {
+		t.Error("expected refusal for several sources in one flat directory")
+	}
+	if err := checkMirrorDest(exp, exp.ArtifactDest, 2, fetchOptions{PerSource: true}); err != nil {
+		t.Errorf("per-source layout: %v", err)
+	}
+	shared := &Experiment{ID: 8, ArtifactDest: root}
+	if err := checkMirrorDest(shared, root, 1, fetchOptions{}); err == nil {
+		t.Error("expected refusal when the recorded destination is not per-experiment")
+	}
+}
+
+func TestLatestRemoteFiles(t *testing.T) {
+	files := []remoteFile{
+		{Rel: "ckpt/step-100.pt", ModTime: 100},
+		{Rel: "ckpt/step-300.pt", ModTime: 300},
+		{Rel: "ckpt/step-200.pt", ModTime: 200},
+		{Rel: "eval/epoch-1.json", ModTime: 150},
+		{Rel: "eval/epoch-2.json", ModTime: 250},
+	}
+	names := func(fs []remoteFile) []string {
+		var out []string
+		for _, f := range fs {
+			out = append(out, f.Rel)
+		}
+		return out
+	}
+	if got, want := names(latestRemoteFiles(files, 2, false)), []string{"ckpt/step-300.pt", "eval/epoch-2.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("latest 2 = %v, want %v", got, want)
+	}
+	if got, want := names(latestRemoteFiles(files, 1, true)), []string{"ckpt/step-300.pt", "eval/epoch-2.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("latest 1 per dir = %v, want %v", got, want)
+	}
+	if got := latestRemoteFiles(files, 10, false); len(got) != len(files) {
+		t.Errorf("latest 10 kept %d of %d", len(got), len(files))
+	}
+}
+
+func TestClassifyRsyncExit(t *testing.T) {
+	for _, code := range []int{5, 10, 12, 30, 35, 255} {
+		if retry, _ := classifyRsyncExit(code); !retry {
+			t.Errorf("exit %d should be retried", code)
+		}
+	}
+	for _, code := range []int{1, 2, 3, 11, 20, 23, 24, 99} {
+		if retry, meaning := classifyRsyncExit(code); retry || meaning == "" {
+			t.Errorf("exit %d: retry=%v meaning=%q; want a non-retryable explanation", code, retry, meaning)
+		}
+	}
+}
+
+func TestParseRsyncTransferred(t *testing.T) {
+	cases := []struct {
+		out  string
+		want int
+		ok   bool
+	}{
+		{"Number of files: 1,204 (reg: 1,200, dir: 4)\nNumber of created files: 0\nNumber of regular files transferred: 1,031\nTotal file size: 5 bytes\n", 1031, true},
+		{"Number of files: 12\nNumber of files transferred: 3\n", 3, true},
+		{"sent 20 bytes  received 12 bytes\n", 0, false},
+	}
+	for _, c := range cases {
+		if got, ok := parseRsyncTransferred(c.out); got != c.want || ok != c.ok {
+			t.Errorf("parseRsyncTransferred(%q) = %d, %v; want %d, %v", c.out, got, ok, c.want, c.ok)
+		}
+	}
+
+	st := syncStats{Files: 142, Updated: 3}
+	if got := st.updatedNote(); got != " (rsync updated 3)" {
+		t.Errorf("updatedNote = %q", got)
+	}
+	for _, updated := range []int{142, -1} {
+		if st.Updated = updated; st.updatedNote() != "" {
+			t.Errorf("updatedNote with Updated=%d = %q", updated, st.updatedNote())
+		}
+	}
+}
+
+func TestListingCutoff(t *testing.T) {
+	// A fixed clock: the job started at 09:00, last synced at 11:30, and
+	// "now" is noon.
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	exp := &Experiment{ID: 3, CreatedAt: now.Add(-3 * time.Hour), ArtifactLastSync: now.Add(-30 * time.Minute)}
+	var out strings.Builder
+
+	since, window, err := listingCutoff(&out, exp, fetchOptions{SinceStart: true, SinceLastSync: true})
+	if err != nil || !since.Equal(exp.ArtifactLastSync) || window != "since last sync" {
+		t.Fatalf("since-last-sync = %v %q %v", since, window, err)
+	}
+	if got, want := newerThanArg(since), " -newermt '@"+strconv.FormatInt(now.Add(-32*time.Minute).Unix(), 10)+"'"; got != want {
+		t.Errorf("newerThanArg = %q, want %q (last sync less the grace period)", got, want)
+	}
+
+	explicit, _ := parseSinceTime("6h", now)
+	if since, window, _ := listingCutoff(&out, exp, fetchOptions{SinceLastSync: true, Since: explicit}); !since.Equal(now.Add(-6*time.Hour)) || window != "--since" {
+		t.Errorf("--since = %v %q", since, window)
+	}
+	if got, want := newerThanArg(explicit), " -newermt '@"+strconv.FormatInt(now.Add(-6*time.Hour-2*time.Minute).Unix(), 10)+"'"; got != want {
+		t.Errorf("newerThanArg(--since 6h) = %q, want %q", got, want)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected notice: %q", out.String())
+	}
+
+	exp.ArtifactLastSync = time.Time{}
+	since, window, err = listingCutoff(&out, exp, fetchOptions{SinceLastSync: true})
+	if err != nil || !since.Equal(exp.CreatedAt) || window != "since start" || !strings.Contains(out.String(), "no previous sync") {
+		t.Errorf("fallback = %v %q %v, notice %q", since, window, err, out.String())
+	}
+	if since, _, _ := listingCutoff(&out, exp, fetchOptions{}); !since.IsZero() {
+		t.Errorf("no filter = %v", since)
+	}
+}
+
+func TestPendingBytes(t *testing.T) {
+	r := &sourceFetch{
+		matched: []remoteFile{{Rel: "a.bin", Size: 1 << 20}, {Rel: "b.json", Size: 300}, {Rel: "c.log", Size: 700}},
+		files:   []string{"b.json", "c.log"},
+	}
+	if got := r.pendingBytes(); got != 1000 {
+		t.Errorf("pendingBytes = %d, want 1000", got)
+	}
+	// Under the threshold nothing is asked.
+	if err := confirmTransfer([]*sourceFetch{r}, fetchOptions{ConfirmOver: 1000}); err != nil {
+		t.Errorf("confirmTransfer = %v", err)
+	}
+	// Over it, an unattended sync warns and goes ahead, or defers.
+	if err := confirmTransfer([]*sourceFetch{r}, fetchOptions{ConfirmOver: 999, AfterCompletion: true}); err != nil {
+		t.Errorf("unattended confirmTransfer = %v", err)
+	}
+	if err := confirmTransfer([]*sourceFetch{r}, fetchOptions{ConfirmOver: 999, AfterCompletion: true, DeferOver: true}); !errors.Is(err, errSyncDeferred) {
+		t.Errorf("deferring confirmTransfer = %v, want errSyncDeferred", err)
+	}
+
+	for n, want := range map[int]string{0: "0", 999: "999", 3214: "3,214", 1234567: "1,234,567", -4500: "-4,500"} {
+		if got := formatCount(n); got != want {
+			t.Errorf("formatCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestListWithPolicy(t *testing.T) {
+	window := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	everything := []remoteFile{{Rel: "shared/huge.bin", Size: 300 << 30}}
+	// fakeLister returns nothing for the first emptyTries windowed calls and
+	// everything once the time filter is dropped.
+	fakeLister := func(emptyTries int, calls *[]time.Time) func(time.Time) ([]remoteFile, string, error) {
+		return func(since time.Time) ([]remoteFile, string, error) {
+			*calls = append(*calls, since)
+			if since.IsZero() || len(*calls) > emptyTries {
+				return everything, "find", nil
+			}
+			return nil, "find", nil
+		}
+	}
+	var slept []time.Duration
+	sleep := func(d time.Duration) { slept = append(slept, d) }
+
+	cases := []struct {
+		name      string
+		policy    listPolicy
+		empty     int
+		wantCalls []time.Time
+		wantFiles int
+		wantLog   string
+	}{
+		{"manual fetch reports zero matches", fetchOptions{ListRetries: 5, ListRetryDelay: time.Second}.listPolicy(), 99,
+			[]time.Time{window}, 0, "not widening it"},
+		{"explicit fallback", fetchOptions{FallbackNoTimeFilter: true}.listPolicy(), 99,
+			[]time.Time{window, {}}, 1, "listing again without the time filter"},
+		{"retries after completion", fetchOptions{AfterCompletion: true, ListRetries: 2, ListRetryDelay: time.Second}.listPolicy(), 2,
+			[]time.Time{window, window, window}, 1, "attempt 3 of 3"},
+	}
+	for _, tc := range cases {
+		var calls []time.Time
+		slept = nil
+		var out strings.Builder
+		files, _, err := listWithPolicy(&out, fakeLister(tc.empty, &calls), window, tc.policy, sleep)
+		if err != nil || len(files) != tc.wantFiles || !reflect.DeepEqual(calls, tc.wantCalls) || !strings.Contains(out.String(), tc.wantLog) {
+			t.Errorf("%s: files %v, err %v, calls %v\n%s", tc.name, files, err, calls, out.String())
+		}
+		if len(slept) != len(tc.wantCalls)-1 && tc.policy.Retries > 0 {
+			t.Errorf("%s: slept %v", tc.name, slept)
+		}
+	}
+}
+
+func TestSpecialFileNames(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	names := []string{
+		"results part 2.json",
+		`it's "quoted".json`,
+		"ümlaut-結果.json",
+		`back\slash.json`,
+		"new\nline.json",
+		"#comment.json",
+		";semi.json",
+		"sub dir/tab\there.json",
+	}
+	root := t.TempDir()
+	for _, name := range names {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := exec.Command("bash", "-c", remoteListCommand(root, "", time.Time{}, listFilter{})).Output()
+	if err != nil {
+		t.Skipf("find -printf not available: %v", err)
+	}
+	files, err := parseRemoteListing(string(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := remoteFileNames(files)
+	sort.Strings(got)
+	want := append([]string(nil), names...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("listed %q\nwant   %q", got, want)
+	}
+
+	regex, _ := compileMatchers([]string{`^.*\.json$`}, patternSyntaxRegex)
+	glob, _ := compileMatchers([]string{"**/*.json"}, patternSyntaxGlob)
+	for _, name := range names {
+		if !patternMatches(regex, "/remote/out", name) || !patternMatches(glob, "/remote/out", name) {
+			t.Errorf("%q did not match both patterns", name)
+		}
+	}
+
+	if got := strings.Split(strings.TrimSuffix(filesFrom0(names), "\x00"), "\x00"); !reflect.DeepEqual(got, names) {
+		t.Errorf("filesFrom0 round trip = %q", got)
+	}
+	if got := displayPath("new\nline.json"); got != `"new\nline.json"` {
+		t.Errorf("displayPath = %s", got)
+	}
+	if got := displayPath("ümlaut-結果.json"); got != "ümlaut-結果.json" {
+		t.Errorf("displayPath should leave printable UTF-8 alone, got %s", got)
+	}
+}
+
+func TestSymlinkListing(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "f"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"best": "a/f", "a/loop": "..", "dangling": "missing"} {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(mode string) []string {
+		out, err := exec.Command("bash", "-c", remoteListCommand(root, mode, time.Time{}, listFilter{})).Output()
+		if err != nil {
+			t.Skipf("find -printf not available: %v", err)
+		}
+		files, err := parseRemoteListing(string(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := remoteFileNames(files)
+		sort.Strings(got)
+		return got
+	}
+	if got := list(""); !reflect.DeepEqual(got, []string{"a/f"}) {
+		t.Errorf("default listing = %q", got)
+	}
+	if got := list(symlinksFollow); !reflect.DeepEqual(got, []string{"a/f", "best"}) {
+		t.Errorf("follow listing = %q (the loop must be skipped, the dangling link dropped)", got)
+	}
+	if got := list(symlinksPreserve); !reflect.DeepEqual(got, []string{"a/f", "a/loop", "best", "dangling"}) {
+		t.Errorf("preserve listing = %q", got)
+	}
+
+	for in, want := range map[string]string{"": "", "Follow": symlinksFollow, "preserve": symlinksPreserve, "skip": ""} {
+		if got, err := normalizeSymlinks(in); err != nil || got != want {
+			t.Errorf("normalizeSymlinks(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := normalizeSymlinks("copy"); err == nil {
+		t.Error("unknown symlinks mode accepted")
+	}
+}
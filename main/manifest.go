@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// artifactManifestVersion is bumped whenever the manifest JSON changes shape;
+// a manifest with any other version is ignored and the next fetch is full.
+const artifactManifestVersion = 1
+
+// artifactManifest records what the last successful sync of one source into
+// one destination transferred, so the next fetch can skip unchanged files.
+type artifactManifest struct {
+	Version int                      `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256,omitempty"`
+	Local   string `json:"local,omitempty"` // local name when it differs (flattened sources)
+}
+
+func newArtifactManifest(files []remoteFile) artifactManifest {
+	m := artifactManifest{Version: artifactManifestVersion, Files: make(map[string]manifestEntry, len(files))}
+	for _, f := range files {
+		m.Files[f.Rel] = manifestEntry{Size: f.Size, ModTime: f.ModTime}
+	}
+	return m
+}
+
+// setLocalNames records where flattened files were written locally.
+func (m artifactManifest) setLocalNames(names map[string]string) {
+	for rel, local := range names {
+		if e, ok := m.Files[rel]; ok && local != rel {
+			e.Local = local
+			m.Files[rel] = e
+		}
+	}
+}
+
+// manifestDiff classifies a fresh listing against the manifest.
+type manifestDiff struct {
+	Unchanged []string
+	New       []string
+	Updated   []string
+	Gone      []string // in the manifest but no longer listed remotely
+}
+
+// diff compares files against the manifest. A file only counts as unchanged
+// when its remote size and mtime match and the local copy under dest still
+// has the recorded size, so deleting a local file brings it back. A
+// preserved symlink is listed with its own size, so the local copy is not
+// followed either.
+func (m artifactManifest) diff(files []remoteFile, dest string) manifestDiff {
+	var d manifestDiff
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f.Rel] = true
+		entry, ok := m.Files[f.Rel]
+		switch {
+		case !ok:
+			d.New = append(d.New, f.Rel)
+		case entry.Size != f.Size || entry.ModTime != f.ModTime:
+			d.Updated = append(d.Updated, f.Rel)
+		default:
+			local := f.Rel
+			if entry.Local != "" {
+				local = entry.Local
+			}
+			st, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(local)))
+			if err != nil || st.Size() != f.Size {
+				d.Updated = append(d.Updated, f.Rel)
+			} else {
+				d.Unchanged = append(d.Unchanged, f.Rel)
+			}
+		}
+	}
+	for _, rel := range sortedKeys(m.Files) {
+		if !listed[rel] {
+			d.Gone = append(d.Gone, rel)
+		}
+	}
+	return d
+}
+
+// changedFiles prints the incremental summary and returns the new and
+// updated files, the only ones that need transferring.
+func (m artifactManifest) changedFiles(w io.Writer, files []remoteFile, dest string) []string {
+	if len(m.Files) == 0 {
+		return remoteFileNames(files)
+	}
+	d := m.diff(files, dest)
+	fmt.Fprintf(w, "%d unchanged, %d new, %d updated", len(d.Unchanged), len(d.New), len(d.Updated))
+	if len(d.Gone) > 0 {
+		fmt.Fprintf(w, " (%d no longer on the remote)", len(d.Gone))
+	}
+	fmt.Fprintln(w)
+	return append(d.New, d.Updated...)
+}
+
+func remoteFileNames(files []remoteFile) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Rel
+	}
+	return names
+}
+
+func loadArtifactManifest(db *sql.DB, expID int64, source, dest string) (artifactManifest, error) {
+	var raw string
+	err := db.QueryRow(`SELECT manifest FROM artifact_manifests WHERE experiment_id = ? AND source = ? AND dest = ?`,
+		expID, source, dest).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return artifactManifest{}, nil
+	}
+	if err != nil {
+		return artifactManifest{}, err
+	}
+	var m artifactManifest
+	if err := json.Unmarshal([]byte(raw), &m); err != nil || m.Version != artifactManifestVersion {
+		// An unreadable or older manifest just means a full fetch.
+		return artifactManifest{}, nil
+	}
+	return m, nil
+}
+
+func saveArtifactManifest(db *sql.DB, expID int64, source, dest string, m artifactManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO artifact_manifests (experiment_id, source, dest, manifest, updated_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(experiment_id, source, dest) DO UPDATE SET manifest = excluded.manifest, updated_at = excluded.updated_at`,
+		expID, source, dest, string(data), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// fetchManifestName is the per-sync record written into the artifact
+// destination. Local artifact listings skip it.
+const fetchManifestName = ".exp-manifest.json"
+
+// syncStats summarizes one successful sync for exp show and the DB.
+type syncStats struct {
+	Files        int
+	Bytes        int64
+	Duration     time.Duration
+	ManifestPath string
+	// TarPath is where a fetch --tar wrote its archive ("-" for stdout)
+	// instead of syncing into the destination.
+	TarPath string
+	// Host is the transfer host the sync went through (--via or
+	// transfer_remote), or "" for the recorded hosts.
+	Host string
+	// Updated and UpdatedBytes are how many files, and how many bytes of
+	// them, rsync reported transferring; -1 when its --stats output could
+	// not be read.
+	Updated      int
+	UpdatedBytes int64
+	// Settle describes how a post-run sync waited for the job's files to
+	// settle, or is "" for other syncs.
+	Settle string
+	// Skipped lists the remote paths left out because they were unreadable.
+	// Stored as the warning in artifact_last_error.
+	Skipped []string
+}
+
+func (s syncStats) String() string {
+	return fmt.Sprintf("%d files, %s in %s", s.Files, formatBytes(s.Bytes), s.Duration.Round(time.Second))
+}
+
+// skippedWarning describes the unreadable paths a sync left out, or is ""
+// when there were none. Only the first few are named.
+func (s syncStats) skippedWarning() string {
+	if len(s.Skipped) == 0 {
+		return ""
+	}
+	const shown = 5
+	names := s.Skipped
+	more := ""
+	if len(names) > shown {
+		names, more = names[:shown], fmt.Sprintf(" and %d more", len(names)-shown)
+	}
+	return fmt.Sprintf("warning: skipped %d unreadable path(s): %s%s", len(s.Skipped), displayPaths(names), more)
+}
+
+// updatedNote tells how many of the synced files rsync actually rewrote,
+// which is fewer when its quick check or --checksum found them unchanged.
+func (s syncStats) updatedNote() string {
+	if s.Updated < 0 || s.Updated == s.Files {
+		return ""
+	}
+	if s.UpdatedBytes > 0 {
+		return fmt.Sprintf(" (rsync updated %d, %s)", s.Updated, formatBytes(s.UpdatedBytes))
+	}
+	return fmt.Sprintf(" (rsync updated %d)", s.Updated)
+}
+
+// transferredFile is one file a sync copied: Rel is its path under the
+// source's local destination and Remote its path under the source, which
+// differ for flattened sources.
+type transferredFile struct {
+	Source string
+	Dest   string
+	Rel    string
+	Remote string
+}
+
+// fetchManifest lists what the last sync copied, with paths relative to the
+// experiment's artifact destination.
+type fetchManifest struct {
+	Version      int                  `json:"version"`
+	ExperimentID int64                `json:"experiment_id"`
+	SyncedAt     string               `json:"synced_at"`
+	Files        []fetchManifestEntry `json:"files"`
+}
+
+type fetchManifestEntry struct {
+	Path    string `json:"path"`
+	Source  string `json:"source"`
+	Remote  string `json:"remote,omitempty"` // path under source when not the same as the local one
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// writeTransferManifest stats (and optionally hashes, on all CPUs) the files
+// a sync copied and writes the manifest into root.
+func writeTransferManifest(expID int64, root string, files []transferredFile, checksum bool) (syncStats, error) {
+	m := fetchManifest{
+		Version:      artifactManifestVersion,
+		ExperimentID: expID,
+		SyncedAt:     time.Now().UTC().Format(time.RFC3339),
+		Files:        make([]fetchManifestEntry, len(files)),
+	}
+	var stats syncStats
+	links := make([]bool, len(files)) // preserved links are not hashed
+	for i, f := range files {
+		local := filepath.Join(f.Dest, filepath.FromSlash(f.Rel))
+		st, err := os.Lstat(local)
+		if err != nil {
+			return stats, err
+		}
+		if st.Mode()&os.ModeSymlink != 0 {
+			links[i] = true
+		}
+		rel, err := filepath.Rel(root, local)
+		if err != nil {
+			return stats, err
+		}
+		m.Files[i] = fetchManifestEntry{Path: filepath.ToSlash(rel), Source: f.Source, Size: st.Size(), ModTime: st.ModTime().Unix()}
+		if f.Remote != "" && f.Remote != f.Rel {
+			m.Files[i].Remote = f.Remote
+		}
+		stats.Files++
+		stats.Bytes += st.Size()
+	}
+	if checksum {
+		errs := make([]error, len(files))
+		runPool(len(files), runtime.NumCPU(), func(i int) {
+			if links[i] {
+				return
+			}
+			m.Files[i].SHA256, errs[i] = sha256File(filepath.Join(root, filepath.FromSlash(m.Files[i].Path)))
+		})
+		if err := errors.Join(errs...); err != nil {
+			return stats, err
+		}
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return stats, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return stats, err
+	}
+	tmp, err := os.CreateTemp(root, ".exp-manifest-*.json")
+	if err != nil {
+		return stats, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return stats, err
+	}
+	if err := tmp.Close(); err != nil {
+		return stats, err
+	}
+	stats.ManifestPath = filepath.Join(root, fetchManifestName)
+	return stats, os.Rename(tmp.Name(), stats.ManifestPath)
+}
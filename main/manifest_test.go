@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArtifactManifestDiff(t *testing.T) {
+	dest := t.TempDir()
+	for rel, content := range map[string]string{"same.json": "1234", "size.json": "12", "mtime.log": "abc"} {
+		if err := os.WriteFile(filepath.Join(dest, rel), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := newArtifactManifest([]remoteFile{
+		{Rel: "same.json", Size: 4, ModTime: 100},
+		{Rel: "size.json", Size: 2, ModTime: 100},
+		{Rel: "mtime.log", Size: 3, ModTime: 100},
+		{Rel: "deleted-locally.csv", Size: 5, ModTime: 100},
+		{Rel: "gone.txt", Size: 1, ModTime: 100},
+	})
+	listing := []remoteFile{
+		{Rel: "same.json", Size: 4, ModTime: 100},
+		{Rel: "size.json", Size: 20, ModTime: 100},
+		{Rel: "mtime.log", Size: 3, ModTime: 200},
+		{Rel: "deleted-locally.csv", Size: 5, ModTime: 100},
+		{Rel: "new.bin", Size: 9, ModTime: 300},
+	}
+	d := m.diff(listing, dest)
+	want := manifestDiff{
+		Unchanged: []string{"same.json"},
+		New:       []string{"new.bin"},
+		Updated:   []string{"size.json", "mtime.log", "deleted-locally.csv"},
+		Gone:      []string{"gone.txt"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("diff = %+v\nwant   %+v", d, want)
+	}
+
+	var out strings.Builder
+	files := m.changedFiles(&out, listing, dest)
+	if len(files) != 4 {
+		t.Errorf("changedFiles = %v", files)
+	}
+	if got := out.String(); got != "1 unchanged, 1 new, 3 updated (1 no longer on the remote)\n" {
+		t.Errorf("summary = %q", got)
+	}
+
+	out.Reset()
+	if files := (artifactManifest{}).changedFiles(&out, listing, dest); len(files) != len(listing) || out.Len() != 0 {
+		t.Errorf("without a manifest every file transfers silently, got %v / %q", files, out.String())
+	}
+}
+
+func TestArtifactManifestStore(t *testing.T) {
+	db := openTestDB(t)
+	m, err := loadArtifactManifest(db, 1, "/remote/out", "/data/1")
+	if err != nil || len(m.Files) != 0 {
+		t.Fatalf("missing manifest = %+v, %v", m, err)
+	}
+	saved := newArtifactManifest([]remoteFile{{Rel: "a.json", Size: 3, ModTime: 10}})
+	for i := 0; i < 2; i++ {
+		if err := saveArtifactManifest(db, 1, "/remote/out", "/data/1", saved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err = loadArtifactManifest(db, 1, "/remote/out", "/data/1")
+	if err != nil || !reflect.DeepEqual(m, saved) {
+		t.Errorf("loaded %+v, %v; want %+v", m, err, saved)
+	}
+	if m, _ := loadArtifactManifest(db, 1, "/remote/out", "/elsewhere"); len(m.Files) != 0 {
+		t.Errorf("a different destination must not share the manifest: %+v", m)
+	}
+
+	if _, err := db.Exec(`UPDATE artifact_manifests SET manifest = ? WHERE experiment_id = 1`, `{"version": 99, "files": {"a.json": {"size": 3}}}`); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := loadArtifactManifest(db, 1, "/remote/out", "/data/1"); err != nil || len(m.Files) != 0 {
+		t.Errorf("an unknown manifest version should be ignored, got %+v, %v", m, err)
+	}
+}
+
+func TestWriteTransferManifest(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "out")
+	if err := os.MkdirAll(filepath.Join(dest, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for rel, content := range map[string]string{"b.json": "{}", "sub/a.log": "hello"} {
+		if err := os.WriteFile(filepath.Join(dest, filepath.FromSlash(rel)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []transferredFile{
+		{Source: "/remote/out", Dest: dest, Rel: "b.json"},
+		{Source: "/remote/out", Dest: dest, Rel: "sub/a.log"},
+	}
+	stats, err := writeTransferManifest(7, root, files, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Bytes != 7 || stats.ManifestPath != filepath.Join(root, fetchManifestName) {
+		t.Errorf("stats = %+v", stats)
+	}
+	data, err := os.ReadFile(stats.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m fetchManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.ExperimentID != 7 || len(m.Files) != 2 || m.Files[0].Path != "out/b.json" || m.Files[1].Path != "out/sub/a.log" {
+		t.Fatalf("manifest = %+v", m)
+	}
+	// sha256("hello")
+	if m.Files[1].SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("sha256 = %q", m.Files[1].SHA256)
+	}
+
+	if _, err := writeTransferManifest(7, root, files, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(stats.ManifestPath)
+	if strings.Contains(string(data), "sha256") {
+		t.Errorf("a manifest written without checksums still has them:\n%s", data)
+	}
+	local, err := listLocalFileInfo(root, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := local[fetchManifestName]; ok {
+		t.Error("the manifest must not be listed as an artifact")
+	}
+}
+
+func TestArtifactManifestDiffPreservedLink(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "big.bin"), make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("big.bin", filepath.Join(dest, "latest")); err != nil {
+		t.Fatal(err)
+	}
+	// find -printf %s reports a link's own size, the length of its target.
+	listing := []remoteFile{{Rel: "latest", Size: int64(len("big.bin")), ModTime: 100}}
+	d := newArtifactManifest(listing).diff(listing, dest)
+	if !reflect.DeepEqual(d.Unchanged, []string{"latest"}) {
+		t.Errorf("diff = %+v, want the link unchanged", d)
+	}
+
+	local, err := listLocalFileInfo(dest, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := local["latest"]; got.Size != int64(len("big.bin")) || got.SHA256 != "" {
+		t.Errorf("latest = %+v, want the link's own size and no checksum", got)
+	}
+	if local, err = listLocalFileInfo(dest, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := local["latest"]; ok {
+		t.Error("links are only listed when preserved")
+	}
+}
+
+func TestSyncStats(t *testing.T) {
+	st := syncStats{Files: 142, Bytes: 1395864371, Duration: 130*time.Second + 400*time.Millisecond, ManifestPath: "/data/1/.exp-manifest.json", Host: "u@dtn"}
+	if got := st.String(); got != "142 files, 1.3 GiB in 2m10s" {
+		t.Errorf("String() = %q", got)
+	}
+
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "sync", "COMPLETED", "")
+	now := time.Now().UTC()
+	if err := recordArtifactSync(db, id, &now, &st, ""); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := exp.ArtifactSyncStats
+	got.Duration = got.Duration.Round(time.Millisecond)
+	if !reflect.DeepEqual(got, st) {
+		t.Errorf("stored stats = %#v, want %#v", got, st)
+	}
+
+	// Skipped files are a warning, not a failure.
+	st.Skipped = []string{"/scratch/run/secret"}
+	if err := recordArtifactSync(db, id, &now, &st, ""); err != nil {
+		t.Fatal(err)
+	}
+	var lastErr string
+	var failures int
+	if err := db.QueryRow(`SELECT artifact_last_error, COALESCE(artifact_sync_failures, 0) FROM experiments WHERE id = ?`, id).Scan(&lastErr, &failures); err != nil {
+		t.Fatal(err)
+	}
+	if lastErr != "warning: skipped 1 unreadable path(s): /scratch/run/secret" || failures != 0 {
+		t.Errorf("last error %q, %d failure(s)", lastErr, failures)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricSpec selects scalar metrics from fetched artifact files. Pattern is a
+// regex matched against the path relative to the artifact destination. Keys
+// are dotted JSON paths (e.g. "recall@10" or "summary.qps") or CSV column
+// names; when empty every top-level numeric value / column is extracted.
+type MetricSpec struct {
+	Pattern string   `json:"pattern"`
+	Keys    []string `json:"keys,omitempty"`
+}
+
+type metricValue struct {
+	Key        string
+	Value      float64
+	SourceFile string
+}
+
+// exp metrics <id>
+func cmdMetrics(args []string) error {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp metrics <id>\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	specs, err := metricSpecsFor(exp)
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("no metrics configured for experiment %s (add a metrics section to the run config or profile)", idStr)
+	}
+	if exp.ArtifactDest == "" {
+		return fmt.Errorf("experiment %s has no recorded artifact destination", idStr)
+	}
+	values, err := extractMetrics(exp.ArtifactDest, specs)
+	if err != nil {
+		return err
+	}
+	if err := storeMetrics(db, exp.ID, values); err != nil {
+		return err
+	}
+	fmt.Printf("Extracted %d metric(s) for experiment %d\n", len(values), exp.ID)
+	stored, err := loadMetrics(db, exp.ID)
+	if err != nil {
+		return err
+	}
+	printMetrics(stored)
+	return nil
+}
+
+// metricSpecsFor returns the metric specs recorded in the experiment's
+// snapshot, falling back to the current config (its profile, then defaults)
+// for experiments recorded before metrics were configured.
+func metricSpecsFor(exp *Experiment) ([]MetricSpec, error) {
+	snap := exp.runSnapshot()
+	if len(snap.Metrics) > 0 {
+		return snap.Metrics, nil
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	if cfg == nil {
+		return nil, nil
+	}
+	if prof, ok := cfg.Profiles[snap.Profile]; ok && snap.Profile != "" && len(prof.Metrics) > 0 {
+		return prof.Metrics, nil
+	}
+	return cfg.Defaults.Metrics, nil
+}
+
+// syncMetrics re-extracts metrics after a successful artifact sync. Failures
+// are reported but never fail the sync itself.
+func syncMetrics(db *sql.DB, exp *Experiment, destDir string) {
+	specs, err := metricSpecsFor(exp)
+	if err == nil && len(specs) > 0 {
+		var values []metricValue
+		if values, err = extractMetrics(destDir, specs); err == nil {
+			err = storeMetrics(db, exp.ID, values)
+		}
+		if err == nil {
+			fmt.Printf("Recorded %d metric(s)\n", len(values))
+		}
+	}
+	if err != nil {
+		fmt.Printf("Warning: metric extraction failed: %v\n", err)
+	}
+}
+
+// extractMetrics walks dir and parses every file matching a spec. Files are
+// visited in path order, so when several files provide the same key the last
+// one wins.
+func extractMetrics(dir string, specs []MetricSpec) ([]metricValue, error) {
+	type compiledSpec struct {
+		re   *regexp.Regexp
+		keys []string
+	}
+	var compiled []compiledSpec
+	for _, spec := range specs {
+		re, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("metrics pattern %q: %w", spec.Pattern, err)
+		}
+		compiled = append(compiled, compiledSpec{re: re, keys: spec.Keys})
+	}
+	files, err := listLocalFileInfo(dir, false, false)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]metricValue)
+	for _, rel := range sortedKeys(files) {
+		for _, spec := range compiled {
+			if !spec.re.MatchString(rel) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+			if err != nil {
+				return nil, err
+			}
+			var values map[string]float64
+			if strings.EqualFold(filepath.Ext(rel), ".csv") {
+				values, err = parseCSVMetrics(data, spec.keys)
+			} else {
+				values, err = parseJSONMetrics(data, spec.keys)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rel, err)
+			}
+			for key, v := range values {
+				byKey[key] = metricValue{Key: key, Value: v, SourceFile: rel}
+			}
+		}
+	}
+	out := make([]metricValue, 0, len(byKey))
+	for _, v := range byKey {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// parseJSONMetrics resolves each dotted key path against a JSON document. A
+// key that names an existing top-level field is used verbatim, so keys that
+// themselves contain dots still work.
+func parseJSONMetrics(data []byte, keys []string) (map[string]float64, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse JSON: %w", err)
+	}
+	out := make(map[string]float64)
+	if len(keys) == 0 {
+		for key, val := range doc {
+			if f, ok := metricNumber(val); ok {
+				out[key] = f
+			}
+		}
+		return out, nil
+	}
+	for _, key := range keys {
+		val, ok := doc[key]
+		if !ok {
+			var cur interface{} = doc
+			for _, part := range strings.Split(key, ".") {
+				m, isMap := cur.(map[string]interface{})
+				if !isMap {
+					cur = nil
+					break
+				}
+				cur = m[part]
+			}
+			val = cur
+		}
+		if f, ok := metricNumber(val); ok {
+			out[key] = f
+		}
+	}
+	return out, nil
+}
+
+// parseCSVMetrics reads a CSV with a header row and takes the values from the
+// last data row.
+func parseCSVMetrics(data []byte, keys []string) (map[string]float64, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("parse CSV header: %w", err)
+	}
+	var last []string
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse CSV: %w", err)
+		}
+		last = rec
+	}
+	out := make(map[string]float64)
+	if last == nil {
+		return out, nil
+	}
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	for i, col := range header {
+		col = strings.TrimSpace(col)
+		if i >= len(last) || (len(keys) > 0 && !wanted[col]) {
+			continue
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(last[i]), 64); err == nil {
+			out[col] = f
+		}
+	}
+	return out, nil
+}
+
+func metricNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func storeMetrics(db *sql.DB, id int64, values []metricValue) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, v := range values {
+		if _, err := tx.Exec(`INSERT INTO metrics (experiment_id, key, value, source_file) VALUES (?, ?, ?, ?)
+                              ON CONFLICT(experiment_id, key) DO UPDATE SET value = excluded.value, source_file = excluded.source_file`,
+			id, v.Key, v.Value, v.SourceFile); err != nil {
+			return fmt.Errorf("store metric %s: %w", v.Key, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func loadMetrics(db *sql.DB, id int64) ([]metricValue, error) {
+	rows, err := db.Query(`SELECT key, value, source_file FROM metrics WHERE experiment_id = ? ORDER BY key`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []metricValue
+	for rows.Next() {
+		var v metricValue
+		var source sql.NullString
+		if err := rows.Scan(&v.Key, &v.Value, &source); err != nil {
+			return nil, err
+		}
+		v.SourceFile = source.String
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// loadMetricTable returns metric values keyed by experiment ID then key,
+// restricted to the given keys.
+func loadMetricTable(db *sql.DB, keys []string) (map[int64]map[string]float64, error) {
+	out := make(map[int64]map[string]float64)
+	if len(keys) == 0 {
+		return out, nil
+	}
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		placeholders[i] = "?"
+		args[i] = k
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT experiment_id, key, value FROM metrics WHERE key IN (%s)`,
+		strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var key string
+		var value float64
+		if err := rows.Scan(&id, &key, &value); err != nil {
+			return nil, err
+		}
+		if out[id] == nil {
+			out[id] = make(map[string]float64)
+		}
+		out[id][key] = value
+	}
+	return out, rows.Err()
+}
+
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func printMetrics(values []metricValue) {
+	for _, v := range values {
+		fmt.Printf("  %-20s %-14s %s\n", v.Key, formatMetric(v.Value), v.SourceFile)
+	}
+}
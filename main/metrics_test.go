@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseJSONMetrics(t *testing.T) {
+	data := []byte(`{"recall@10": 0.91, "qps": "1200", "summary": {"p99": 3.5}, "label": "x"}`)
+	got, err := parseJSONMetrics(data, []string{"recall@10", "qps", "summary.p99", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"recall@10": 0.91, "qps": 1200, "summary.p99": 3.5}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	all, err := parseJSONMetrics(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := all["label"]; ok || all["recall@10"] != 0.91 || len(all) != 2 {
+		t.Fatalf("all keys = %v", all)
+	}
+}
+
+func TestParseCSVMetricsUsesLastRow(t *testing.T) {
+	data := []byte("epoch,loss,acc\n1,0.9,0.5\n2,0.4,0.8\n")
+	got, err := parseCSVMetrics(data, []string{"acc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["acc"] != 0.8 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestExtractAndStoreMetrics(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "COMPLETED", "")
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "results"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "results", "recall.json"), []byte(`{"recall@10": 0.9}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	specs := []MetricSpec{{Pattern: `^results/.*\.json$`, Keys: []string{"recall@10"}}}
+	values, err := extractMetrics(dir, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Storing twice must upsert rather than duplicate.
+	for i := 0; i < 2; i++ {
+		if err := storeMetrics(db, id, values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, err := loadMetrics(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Key != "recall@10" || stored[0].Value != 0.9 || stored[0].SourceFile != "results/recall.json" {
+		t.Fatalf("stored = %+v", stored)
+	}
+	table, err := loadMetricTable(db, []string{"recall@10"})
+	if err != nil || table[id]["recall@10"] != 0.9 {
+		t.Fatalf("loadMetricTable = %v, %v", table, err)
+	}
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// monitorTick is how often the daemon rescans the DB for new experiments and
+// checks which ones are due for a poll; each experiment still polls on its
+// own interval.
+const monitorTick = 5 * time.Second
+
+// monitorDaemon watches every active experiment from one process. Polls are
+// batched per remote and cluster, and a failing remote only delays its own
+// experiments.
+type monitorDaemon struct {
+	db       *sql.DB
+	interval time.Duration // overrides per-experiment intervals when non-zero
+	query    func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error)
+	sync     func(db *sql.DB, exp *Experiment, settled *settleResult) error
+
+	nextPoll    map[int64]time.Time
+	pendingSync map[int64]time.Time
+	// settling holds the stability checks of finished experiments, each
+	// listing made by totals when its pendingSync time comes.
+	settling map[int64]*settleCheck
+	totals   func(exp *Experiment) (treeTotals, error)
+
+	// owner holds the locks of the experiments being monitored; busy marks
+	// those another process is watching, so that is logged once.
+	owner lockOwner
+	busy  map[int64]bool
+
+	unrecognized unrecognizedStates
+	absent       absentJobs
+
+	// pending paces the squeue --start checks of pending jobs, made with
+	// startQuery.
+	pending    pendingChecks
+	startQuery func(remote string, sshOpts sshHostOptions, cluster, jobID string) (pendingEstimate, error)
+	stalled    stalledJobs
+
+	// progress paces reading the end of running jobs' logs, with logTail.
+	progress progressChecks
+	logTail  func(remote string, sshOpts sshHostOptions, path string) (string, error)
+
+	// notify tells the user of runs that set notify_local.
+	notify func(title, message string)
+}
+
+func newMonitorDaemon(db *sql.DB, interval time.Duration) *monitorDaemon {
+	return &monitorDaemon{
+		db:          db,
+		interval:    interval,
+		query:       jobStatuses.lookup,
+		sync:        syncCompletedArtifacts,
+		nextPoll:    make(map[int64]time.Time),
+		pendingSync: make(map[int64]time.Time),
+		settling:    make(map[int64]*settleCheck),
+		totals: func(exp *Experiment) (treeTotals, error) {
+			return artifactTreeTotals(exp, exp.EffectiveArtifactSources())
+		},
+		owner: currentLockOwner("exp monitor"),
+		busy:  make(map[int64]bool),
+
+		unrecognized: make(unrecognizedStates),
+		absent:       make(absentJobs),
+
+		pending:    make(pendingChecks),
+		startQuery: querySqueueStart,
+		stalled:    make(stalledJobs),
+
+		progress: make(progressChecks),
+		logTail:  tailRemoteLog,
+
+		notify: notifyLocal,
+	}
+}
+
+// exp monitor [--daemon] [--once] [--poll-interval 30s] [--verbose]
+func cmdMonitor(args []string) error {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	var (
+		daemon  bool
+		once    bool
+		verbose bool
+	)
+	fs.BoolVar(&daemon, "daemon", false, "Detach and keep monitoring in the background (logs to monitor.log in the data directory, or monitor-<hash>.log for a --db database)")
+	fs.BoolVar(&once, "once", false, "Poll every active experiment once, sync finished ones, then exit (for cron)")
+	pollIntervalFlag := durationFlag{value: defaultPollInterval}
+	fs.Var(&pollIntervalFlag, "poll-interval", "Poll every experiment at this interval (defaults to each experiment's recorded interval)")
+	fs.BoolVar(&verbose, "verbose", false, "Also log how many scheduler queries answered the status lookups, when it stops")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp monitor [--daemon | --once] [--poll-interval 30s] [--verbose]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if daemon && once {
+		return fmt.Errorf("--daemon and --once are mutually exclusive")
+	}
+	if pid, ok := runningMonitorPID(); ok {
+		return fmt.Errorf("a monitor daemon is already running (pid %d)", pid)
+	}
+	if daemon {
+		var childArgs []string
+		if pollIntervalFlag.set {
+			childArgs = append(childArgs, "--poll-interval", pollIntervalFlag.value.String())
+		}
+		if verbose {
+			childArgs = append(childArgs, "--verbose")
+		}
+		return startMonitorDaemon(childArgs)
+	}
+
+	release, err := acquireMonitorPidfile()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	var interval time.Duration
+	if pollIntervalFlag.set {
+		interval = pollIntervalFlag.value
+	}
+	d := newMonitorDaemon(db, interval)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopCommands = ctx
+	go d.heartbeat(ctx)
+	defer func() {
+		if err := releaseOwnerLocks(db, d.owner); err != nil {
+			monitorLogf("release experiment locks: %v", err)
+		}
+	}()
+	if verbose {
+		defer func() { monitorLogf("%s", jobStatuses.summary()) }()
+	}
+
+	if once {
+		d.pass(ctx, time.Now(), true)
+		// Stability checks put their experiments back until they settle.
+		for len(d.pendingSync) > 0 {
+			var next time.Time
+			for _, due := range d.pendingSync {
+				if next.IsZero() || due.Before(next) {
+					next = due
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(next)):
+			}
+			d.runSyncs(ctx, next)
+		}
+		return nil
+	}
+
+	monitorLogf("monitor started (pid %d)", os.Getpid())
+	ticker := time.NewTicker(monitorTick)
+	defer ticker.Stop()
+	for {
+		d.pass(ctx, time.Now(), false)
+		select {
+		case <-ctx.Done():
+			monitorLogf("monitor stopping")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pass polls every due experiment and then runs any artifact syncs whose
+// settle delay has elapsed. force polls everything regardless of schedule.
+func (d *monitorDaemon) pass(ctx context.Context, now time.Time, force bool) {
+	exps, err := selectExperiments(d.db, experimentFilter{Live: true, HasJob: true})
+	if err != nil {
+		monitorLogf("query experiments: %v", err)
+		return
+	}
+	var due []*Experiment
+	for _, exp := range exps {
+		if next, ok := d.nextPoll[exp.ID]; ok && !force && now.Before(next) {
+			continue
+		}
+		if !d.lock(exp, now) {
+			d.nextPoll[exp.ID] = now.Add(d.intervalFor(exp))
+			continue
+		}
+		due = append(due, exp)
+	}
+	groups, byGroup := groupBySlurm(due)
+
+	for _, g := range groups {
+		if ctx.Err() != nil {
+			return
+		}
+		group := byGroup[g]
+		for _, exp := range group {
+			d.nextPoll[exp.ID] = now.Add(d.intervalFor(exp))
+		}
+		jobIDs := make([]string, len(group))
+		for i, exp := range group {
+			jobIDs[i] = exp.JobID
+		}
+		setDebugExperiment(0)
+		states, err := d.query(g.Remote, group[0].SSH, g.Cluster, jobIDs)
+		if err != nil {
+			monitorLogf("query %s: %v (retrying on the next interval)", g, err)
+			continue
+		}
+		for _, exp := range group {
+			st, ok := states[exp.JobID]
+			if !ok {
+				st = jobState{Status: "UNKNOWN"}
+			}
+			logf := func(format string, args ...interface{}) {
+				monitorLogf("experiment %d: "+format, append([]interface{}{exp.ID}, args...)...)
+			}
+			st.Status = d.absent.resolve(exp, st.Status, now, logf)
+			st.Status = d.unrecognized.resolve(exp, st.Status, now, logf)
+			t, err := applyRefreshedState(d.db, exp, st, "exp monitor")
+			if err != nil {
+				monitorLogf("experiment %d: %v", exp.ID, err)
+				continue
+			}
+			if t.from != t.to {
+				monitorLogf("experiment %d (%s) job %s: %s -> %s", exp.ID, exp.Name, exp.JobID, t.from, t.to)
+				if exp.JobReason != "" {
+					monitorLogf("experiment %d: %s", exp.ID, exp.outcomeLine())
+				}
+			}
+			if e, ok, err := d.pending.check(d.db, exp, now, d.startQuery); err != nil {
+				logf("unable to ask when job %s starts: %v", exp.JobID, err)
+			} else if ok {
+				logf("job %s pending: %s", exp.JobID, e.describe())
+				if warning, err := d.stalled.observe(d.db, exp, e, now); err != nil {
+					logf("%v", err)
+				} else if warning != "" {
+					monitorLogf("WARNING: %s", warning)
+					if exp.runSnapshot().NotifyLocal {
+						d.notify(stalledNotice(exp, warning))
+					}
+				}
+			}
+			if p, ok, err := d.progress.check(d.db, exp, now, d.logTail); err != nil {
+				logf("%v", err)
+			} else if ok {
+				logf("job %s progress: %s", exp.JobID, p.describe())
+			}
+			if isActiveStatus(st.Status) {
+				continue
+			}
+			if exp.runSnapshot().NotifyLocal {
+				d.notify(finishedNotice(exp))
+			}
+			delete(d.nextPoll, exp.ID)
+			if exp.ArtifactDest != "" && len(exp.EffectiveArtifactSources()) > 0 {
+				// The settle wait is a deadline checked on later passes,
+				// so other experiments are not held up: a fixed delay is
+				// one deadline, a stability check lists the tree at each.
+				due := now
+				if p := exp.settlePolicy(); !p.stable() {
+					due = now.Add(p.Delay)
+				} else {
+					logf("waiting for artifacts to settle: listing every %s, for up to %s", p.Delay, p.MaxWait)
+					d.settling[exp.ID] = &settleCheck{policy: p}
+				}
+				d.pendingSync[exp.ID] = due
+			} else {
+				d.unlock(exp.ID)
+			}
+		}
+	}
+	d.runSyncs(ctx, now)
+}
+
+// lock claims exp for the daemon, or reports false when another process is
+// monitoring it; the daemon leaves such experiments alone until it stops.
+func (d *monitorDaemon) lock(exp *Experiment, now time.Time) bool {
+	err := claimExperimentLock(d.db, exp.ID, d.owner, now)
+	var le *lockedError
+	switch {
+	case err == nil:
+		if d.busy[exp.ID] {
+			monitorLogf("experiment %d: no longer watched elsewhere; monitoring", exp.ID)
+			delete(d.busy, exp.ID)
+		}
+		return true
+	case errors.As(err, &le):
+		if !d.busy[exp.ID] {
+			monitorLogf("experiment %d: skipped while %s watches it", exp.ID, le.Owner)
+			d.busy[exp.ID] = true
+		}
+	default:
+		monitorLogf("experiment %d: lock: %v", exp.ID, err)
+	}
+	return false
+}
+
+func (d *monitorDaemon) unlock(id int64) {
+	if err := releaseExperimentLock(d.db, id, d.owner); err != nil {
+		monitorLogf("experiment %d: release lock: %v", id, err)
+	}
+}
+
+// heartbeat keeps the daemon's locks fresh, including through a long sync,
+// until ctx is done.
+func (d *monitorDaemon) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(lockHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := heartbeatLocks(d.db, d.owner, now); err != nil {
+				monitorLogf("heartbeat experiment locks: %v", err)
+			}
+		}
+	}
+}
+
+// runSyncs fetches artifacts for finished experiments whose settle delay has
+// passed, or takes the next listing of a stability check. A failed sync is
+// recorded and not retried; exp fetch or exp refresh --fetch-missing can
+// pick it up later.
+func (d *monitorDaemon) runSyncs(ctx context.Context, now time.Time) {
+	ids := make([]int64, 0, len(d.pendingSync))
+	for id, due := range d.pendingSync {
+		if !now.Before(due) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		delete(d.pendingSync, id)
+		if !d.syncFinished(id, now) {
+			continue
+		}
+		// Whatever the outcome, the experiment is done with.
+		d.unlock(id)
+	}
+}
+
+// syncFinished syncs a finished experiment, or reports false when its
+// artifacts are still settling and it has been put back in pendingSync.
+func (d *monitorDaemon) syncFinished(id int64, now time.Time) bool {
+	exp, err := findExperiment(d.db, strconv.FormatInt(id, 10))
+	if err != nil {
+		delete(d.settling, id)
+		monitorLogf("experiment %d: %v", id, err)
+		return true
+	}
+	settled := settleResult{Waited: exp.settlePolicy().Delay}
+	if check := d.settling[id]; check != nil {
+		cur, err := d.totals(exp)
+		res, wait, done := check.step(cur, err)
+		if !done {
+			d.pendingSync[id] = now.Add(wait)
+			return false
+		}
+		delete(d.settling, id)
+		if err != nil {
+			monitorLogf("experiment %d: stability check stopped after %s: %v", id, res.Waited, err)
+		}
+		settled = res
+	}
+	monitorLogf("experiment %d: artifact settle: %s", id, settled)
+	if err := d.sync(d.db, exp, &settled); errors.Is(err, errSyncDeferred) {
+		monitorLogf("experiment %d: artifact sync deferred (over confirm_over); run exp fetch %d", id, id)
+		return true
+	} else if err != nil {
+		monitorLogf("experiment %d: artifact sync failed: %v; run exp fetch %d to retry", id, err, id)
+		if exp.runSnapshot().NotifyLocal {
+			d.notify(syncFailedNotice(exp, err))
+		}
+		return true
+	}
+	monitorLogf("experiment %d: artifacts stored under %s", id, exp.ArtifactDest)
+	return true
+}
+
+func (d *monitorDaemon) intervalFor(exp *Experiment) time.Duration {
+	if d.interval > 0 {
+		return d.interval
+	}
+	if snap := exp.runSnapshot(); snap.PollInterval != "" {
+		if iv, err := time.ParseDuration(snap.PollInterval); err == nil && iv > 0 {
+			return iv
+		}
+	}
+	return defaultPollInterval
+}
+
+// syncCompletedArtifacts fetches every recorded artifact source for a
+// finished experiment and records the outcome, along with how the sync
+// waited for the files to settle when settled is non-nil. A deferred sync
+// returns errSyncDeferred once the experiment is marked.
+func syncCompletedArtifacts(db *sql.DB, exp *Experiment, settled *settleResult) error {
+	started := time.Now().UTC()
+	stats, err := fetchArtifactSources(exp, exp.EffectiveArtifactSources(), exp.ArtifactDest, exp.autoSyncOptions(db))
+	if errors.Is(err, errSyncDeferred) {
+		if err := deferArtifactSync(db, exp); err != nil {
+			return err
+		}
+		return errSyncDeferred
+	}
+	if err != nil {
+		_ = recordArtifactSync(db, exp.ID, nil, nil, err.Error())
+		return err
+	}
+	if settled != nil {
+		stats.Settle = settled.String()
+	}
+	exp.ArtifactLastSync = started
+	if err := recordArtifactSync(db, exp.ID, &started, &stats, ""); err != nil {
+		return err
+	}
+	if stats.Files == 0 {
+		fmt.Println(noFilesMatchedWarning)
+	}
+	syncMetrics(db, exp, exp.ArtifactDest)
+	archiveJobLogs(db, exp, exp.ArtifactDest)
+	return nil
+}
+
+// syncWhileRunning runs one of the periodic syncs sync_interval asks for
+// while the job is still running. Each pass only lists files modified since
+// the previous one. A failure is recorded and reported, and monitoring goes
+// on; the post-completion sync still fetches everything at the end.
+func syncWhileRunning(db *sql.DB, exp *Experiment) {
+	sources := exp.EffectiveArtifactSources()
+	if len(sources) == 0 || exp.ArtifactDest == "" {
+		return
+	}
+	opts := exp.recordedFetchOptions()
+	opts.DB = db
+	opts.SinceLastSync = true
+	// Nobody is there to answer a confirm_over or --checksum prompt.
+	opts.AssumeYes = true
+	// Files written while this pass runs are newer than its start, so the
+	// next pass picks them up.
+	started := time.Now().UTC()
+	fmt.Printf("[%s] Syncing artifacts while job %s runs\n", started.Local().Format(time.RFC3339), exp.JobID)
+	stats, err := fetchArtifactSources(exp, sources, exp.ArtifactDest, opts)
+	if err != nil {
+		fmt.Printf("Intermediate artifact sync failed; will retry next interval: %v\n", err)
+		if err := recordArtifactSync(db, exp.ID, nil, nil, err.Error()); err != nil {
+			fmt.Printf("Warning: unable to record the failed sync: %v\n", err)
+		}
+		return
+	}
+	exp.ArtifactLastSync = started
+	if err := recordArtifactSync(db, exp.ID, &started, &stats, ""); err != nil {
+		fmt.Printf("Warning: unable to record the sync: %v\n", err)
+	}
+	fmt.Printf("Intermediate sync: %s%s\n", stats, stats.updatedNote())
+	syncMetrics(db, exp, exp.ArtifactDest)
+}
+
+// statusSyncDeferred marks a completed experiment whose post-run sync was
+// skipped for being over confirm_over. The next successful exp fetch sets it
+// back to COMPLETED.
+const statusSyncDeferred = "SYNC_DEFERRED"
+
+// autoSyncOptions are the recorded options for the unattended sync after a
+// job finished. Only a COMPLETED experiment is deferred, so that restoring
+// the status afterwards loses nothing.
+func (exp *Experiment) autoSyncOptions(db *sql.DB) fetchOptions {
+	opts := exp.recordedFetchOptions()
+	opts.DB = db
+	opts.AfterCompletion = true
+	opts.DeferOver = opts.DeferOver && strings.EqualFold(exp.JobStatus, "COMPLETED")
+	return opts
+}
+
+// deferArtifactSync marks exp SYNC_DEFERRED after its post-run sync was
+// skipped.
+func deferArtifactSync(db *sql.DB, exp *Experiment) error {
+	if err := changeExperimentStatus(db, exp.ID, statusSyncDeferred, "artifact sync over confirm_over", nil); err != nil {
+		return err
+	}
+	exp.JobStatus = statusSyncDeferred
+	fmt.Printf("Experiment %d marked %s; run exp fetch %d to sync its artifacts.\n", exp.ID, statusSyncDeferred, exp.ID)
+	return nil
+}
+
+// resumeDeferredSync sets a SYNC_DEFERRED experiment back to COMPLETED once
+// its artifacts were fetched.
+func resumeDeferredSync(db *sql.DB, exp *Experiment) error {
+	if exp.JobStatus != statusSyncDeferred {
+		return nil
+	}
+	if err := changeExperimentStatus(db, exp.ID, "COMPLETED", "deferred artifact sync fetched", nil); err != nil {
+		return err
+	}
+	exp.JobStatus = "COMPLETED"
+	return nil
+}
+
+func monitorLogf(format string, args ...interface{}) {
+	fmt.Printf("[%s] %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// monitorFile is where the daemon watching the database in use keeps its
+// pidfile or log (ext ".pid" or ".log"): monitor.pid and monitor.log in the
+// data directory for the default database, and names carrying a hash of the
+// database path for one chosen with --db or EXP_DB_PATH, so daemons for
+// different databases neither block each other nor share a log.
+func monitorFile(ext string) (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	db, err := dbPath()
+	if err != nil {
+		return "", err
+	}
+	name := "monitor"
+	if db != filepath.Join(dir, dbFileName) {
+		sum := sha256.Sum256([]byte(db))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return filepath.Join(dir, name+ext), nil
+}
+
+func monitorPidPath() (string, error) {
+	return monitorFile(".pid")
+}
+
+// runningMonitorPID reports the pid of a live monitor daemon, if any. A
+// pidfile left behind by a crashed daemon is treated as absent.
+func runningMonitorPID() (int, bool) {
+	path, err := monitorPidPath()
+	if err != nil {
+		return 0, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+// acquireMonitorPidfile creates monitor.pid exclusively, replacing a
+// stale one. The returned func removes it again if it still holds our pid.
+func acquireMonitorPidfile() (func(), error) {
+	path, err := monitorPidPath()
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, privateFileMode)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			if err := f.Close(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrExist) || attempt > 0 {
+			return nil, fmt.Errorf("create pidfile %s: %w", path, err)
+		}
+		if pid, ok := runningMonitorPID(); ok {
+			return nil, fmt.Errorf("a monitor daemon is already running (pid %d)", pid)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("remove stale pidfile %s: %w", path, err)
+		}
+	}
+	return func() {
+		if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// startMonitorDaemon re-executes exp monitor in a new session with output
+// appended to its log in the data directory (see monitorFile), and returns
+// once the child has started.
+func startMonitorDaemon(childArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logPath, err := monitorFile(".log")
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, privateFileMode)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	args := append(globals.args(), "monitor")
+	cmd := runCommand(exe, append(args, childArgs...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.StartDetached(); err != nil {
+		return fmt.Errorf("start monitor daemon: %w", err)
+	}
+	pidPath, _ := monitorPidPath()
+	fmt.Printf("Started monitor daemon (pid %d, pidfile %s); logging to %s\n", cmd.Process.Pid, pidPath, logPath)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A monitor used to print a line per poll, a thousand identical RUNNING
+// lines overnight. Now a terminal gets one status line redrawn in place
+// (job 2723147 RUNNING for 3h42m, next poll in 12s, ...), and a log or pipe
+// gets the state transitions and a heartbeat line every monitor_heartbeat.
+// Transitions and everything after the job ends are whole lines either way.
+
+// defaultMonitorHeartbeat is how often a monitor whose output is not a
+// terminal says the job is still in the same state; monitor_heartbeat in
+// the config overrides it, 0 turning the heartbeat off.
+const defaultMonitorHeartbeat = 10 * time.Minute
+
+// monitorHeartbeat is set from the config by finishGlobalOptions.
+var monitorHeartbeat = defaultMonitorHeartbeat
+
+// configMonitorHeartbeat reads monitor_heartbeat.
+func configMonitorHeartbeat(cfg *Config) (time.Duration, error) {
+	if cfg.MonitorHeartbeat == "" {
+		return defaultMonitorHeartbeat, nil
+	}
+	d, err := time.ParseDuration(string(cfg.MonitorHeartbeat))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid monitor_heartbeat %q (examples: 10m, 1h; 0 for none)", cfg.MonitorHeartbeat)
+	}
+	return d, nil
+}
+
+// setStatus draws line as the status line, replacing the previous one; an
+// empty line clears it.
+func (s *syncWriter) setStatus(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprint(s.w, "\r\033[K"+line)
+	s.status = line
+}
+
+// statusSince is when exp entered its recorded status, going by its status
+// history, or else when it was submitted.
+func statusSince(db *sql.DB, exp *Experiment) time.Time {
+	events, _ := loadStatusEvents(db, exp.ID)
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Status == statusMonitorDetached {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, events[i].ObservedAt); err == nil && events[i].Status == exp.JobStatus {
+			return t
+		}
+		break
+	}
+	return exp.CreatedAt
+}
+
+// monitorDisplay renders what a monitor sees of one job.
+type monitorDisplay struct {
+	out       *syncWriter
+	tty       bool
+	jobID     string
+	heartbeat time.Duration
+	now       func() time.Time
+	sleep     func(time.Duration)
+	// lastLog is the newest log line known, when there is one.
+	lastLog func() string
+
+	status  string
+	since   time.Time // when the job was first seen in status
+	printed time.Time // when a line about status was last printed
+}
+
+func newMonitorDisplay(out *syncWriter, jobID string) *monitorDisplay {
+	return &monitorDisplay{
+		out:       out,
+		tty:       out.w == os.Stdout && isTerminal(os.Stdout),
+		jobID:     jobID,
+		heartbeat: monitorHeartbeat,
+		now:       time.Now,
+		sleep:     time.Sleep,
+		lastLog:   func() string { return "" },
+	}
+}
+
+// observe takes in a poll's status. since is when the job entered it, as
+// far as anyone recorded; a change seen now has since zero. A change prints
+// a line, and so does an unchanged status once the heartbeat is due.
+func (d *monitorDisplay) observe(status string, since time.Time) {
+	now := d.now()
+	switch {
+	case status != d.status:
+		d.status = status
+		d.since = now
+		if !since.IsZero() {
+			d.since = since
+		}
+		fmt.Fprintf(d.out, "[%s] %s -> %s\n", now.Format(time.RFC3339), d.jobID, status)
+		d.printed = now
+	case !d.tty && d.heartbeat > 0 && now.Sub(d.printed) >= d.heartbeat:
+		fmt.Fprintf(d.out, "[%s] %s still %s (for %s)\n", now.Format(time.RFC3339), d.jobID, status, formatElapsed(now.Sub(d.since)))
+		d.printed = now
+	}
+}
+
+// wait waits for the next poll, counting down on the status line.
+func (d *monitorDisplay) wait(interval time.Duration) {
+	if !d.tty {
+		d.sleep(interval)
+		return
+	}
+	next := d.now().Add(interval)
+	for {
+		left := next.Sub(d.now())
+		if left <= 0 {
+			return
+		}
+		d.out.setStatus(d.line(left))
+		d.sleep(min(left, time.Second))
+	}
+}
+
+// line is the status line, left before the next poll.
+func (d *monitorDisplay) line(left time.Duration) string {
+	s := fmt.Sprintf("job %s %s for %s, next poll in %s", d.jobID, d.status,
+		formatElapsed(d.now().Sub(d.since)), formatElapsed(left.Round(time.Second)))
+	if last := strings.TrimSpace(d.lastLog()); last != "" {
+		s += ", last log line: " + last
+	}
+	return truncateToWidth(s, terminalWidth()-1)
+}
+
+// done clears the status line for good, before the whole lines of the end.
+func (d *monitorDisplay) done() {
+	if d.tty {
+		d.out.setStatus("")
+	}
+}
+
+// formatElapsed renders d to the second under a minute and coarser above:
+// 42s, 12m5s, 3h42m, 2d3h.
+func formatElapsed(d time.Duration) string {
+	d = max(d, 0).Truncate(time.Second)
+	switch {
+	case d < time.Minute:
+		return d.String()
+	case d < time.Hour && d%time.Minute != 0:
+		return d.String()
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", d/time.Hour, d%time.Hour/time.Minute)
+	}
+	days := d / (24 * time.Hour)
+	return fmt.Sprintf("%dd%dh", days, (d-days*24*time.Hour)/time.Hour)
+}
+
+// terminalWidth is $COLUMNS, or 80.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// truncateToWidth cuts s to width runes, marking the cut with an ellipsis,
+// so the status line never wraps and \r still goes back to its start.
+func truncateToWidth(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatElapsed(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		42*time.Second + 300*time.Millisecond:        "42s",
+		12*time.Minute + 5*time.Second:               "12m5s",
+		12 * time.Minute:                             "12m",
+		3*time.Hour + 42*time.Minute + 9*time.Second: "3h42m",
+		51*time.Hour + 20*time.Minute:                "2d3h",
+		-time.Second:                                 "0s",
+	} {
+		if got := formatElapsed(d); got != want {
+			t.Errorf("formatElapsed(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+// testDisplay is a display on a fake clock that sleep advances.
+func testDisplay(tty bool) (*monitorDisplay, *bytes.Buffer, *time.Time) {
+	var buf bytes.Buffer
+	now := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	d := newMonitorDisplay(&syncWriter{w: &buf}, "2723147")
+	d.tty = tty
+	d.heartbeat = 10 * time.Minute
+	d.now = func() time.Time { return now }
+	d.sleep = func(d time.Duration) { now = now.Add(d) }
+	return d, &buf, &now
+}
+
+func TestMonitorDisplayLog(t *testing.T) {
+	d, buf, now := testDisplay(false)
+	d.observe("PENDING", time.Time{})
+	for i := 0; i < 40; i++ {
+		d.wait(30 * time.Second)
+		status := "PENDING"
+		if i >= 10 {
+			status = "RUNNING"
+		}
+		d.observe(status, time.Time{})
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"[2025-03-01T09:00:00Z] 2723147 -> PENDING",
+		"[2025-03-01T09:05:30Z] 2723147 -> RUNNING",
+		"[2025-03-01T09:15:30Z] 2723147 still RUNNING (for 10m)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output:\n%s\nwant:\n%s", buf, strings.Join(want, "\n"))
+	}
+	if got := now.Sub(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)); got != 20*time.Minute {
+		t.Errorf("waited %s", got)
+	}
+}
+
+func TestMonitorDisplayTerminal(t *testing.T) {
+	t.Setenv("COLUMNS", "120")
+	d, buf, now := testDisplay(true)
+	d.lastLog = func() string { return "epoch 12/50 loss=0.39" }
+	d.observe("RUNNING", now.Add(-(3*time.Hour + 42*time.Minute)))
+	d.wait(3 * time.Second)
+	fmt.Fprintf(d.out, "| epoch 13/50\n")
+	d.observe("RUNNING", time.Time{})
+	d.done()
+	fmt.Fprintf(d.out, "Job outcome: completed\n")
+
+	status := "job 2723147 RUNNING for 3h42m, next poll in 1s, last log line: epoch 12/50 loss=0.39"
+	want := "[2025-03-01T09:00:00Z] 2723147 -> RUNNING\n" +
+		"\r\033[Kjob 2723147 RUNNING for 3h42m, next poll in 3s, last log line: epoch 12/50 loss=0.39" +
+		"\r\033[Kjob 2723147 RUNNING for 3h42m, next poll in 2s, last log line: epoch 12/50 loss=0.39" +
+		"\r\033[K" + status +
+		// A streamed line scrolls up past the status line, which stays put.
+		"\r\033[K| epoch 13/50\n" + status +
+		"\r\033[K" +
+		"Job outcome: completed\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output:\n%q\nwant:\n%q", got, want)
+	}
+
+	t.Setenv("COLUMNS", "40")
+	if line := d.line(time.Second); len([]rune(line)) != 39 || !strings.HasSuffix(line, "…") {
+		t.Errorf("line not cut to the terminal: %q", line)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMonitorDaemonPass(t *testing.T) {
+	db := openTestDB(t)
+	good := insertTestExperiment(t, db, "good", "RUNNING", "")
+	bad := insertTestExperiment(t, db, "bad", "RUNNING", "")
+	if _, err := db.Exec(`UPDATE experiments SET remote = 'down@host', artifact_dest = '/tmp/x' WHERE id = ?`, bad); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = '/tmp/x' WHERE id = ?`, good); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{good, bad} {
+		if err := writeArtifactSources(db, id, []ArtifactSource{{Path: "/r"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := newMonitorDaemon(db, time.Minute)
+	queried := map[string]int{}
+	d.query = func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		queried[remote]++
+		if remote == "down@host" {
+			return nil, errors.New("ssh: connect timed out")
+		}
+		return map[string]jobState{"42": {Status: "COMPLETED"}}, nil
+	}
+	var synced []int64
+	d.sync = func(db *sql.DB, exp *Experiment, settled *settleResult) error {
+		synced = append(synced, exp.ID)
+		return nil
+	}
+
+	now := time.Now()
+	d.pass(context.Background(), now, false)
+	exp, err := findExperiment(db, strconv.FormatInt(good, 10))
+	if err != nil || exp.JobStatus != "COMPLETED" {
+		t.Fatalf("good experiment = %+v, %v", exp, err)
+	}
+	if exp, _ := findExperiment(db, strconv.FormatInt(bad, 10)); exp.JobStatus != "RUNNING" {
+		t.Fatalf("bad experiment status changed to %s", exp.JobStatus)
+	}
+	if len(synced) != 0 {
+		t.Fatalf("synced before the settle delay: %v", synced)
+	}
+
+	// The failing remote is not re-polled before its interval elapses, and
+	// the finished experiment syncs once the settle delay has passed.
+	d.pass(context.Background(), now.Add(defaultSettleDelay), false)
+	if queried["down@host"] != 1 || queried["u@h"] != 1 {
+		t.Fatalf("queries = %v", queried)
+	}
+	if len(synced) != 1 || synced[0] != good {
+		t.Fatalf("synced = %v", synced)
+	}
+	d.pass(context.Background(), now.Add(2*time.Minute), false)
+	if queried["down@host"] != 2 || queried["u@h"] != 1 {
+		t.Fatalf("queries after interval = %v", queried)
+	}
+}
+
+func TestMonitorDaemonStabilityCheck(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "settling", "RUNNING", `{"settle_delay": "10s", "settle_max_wait": "1m"}`)
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = '/tmp/x' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArtifactSources(db, id, []ArtifactSource{{Path: "/r"}}); err != nil {
+		t.Fatal(err)
+	}
+	d := newMonitorDaemon(db, time.Minute)
+	d.query = func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		return map[string]jobState{"42": {Status: "COMPLETED"}}, nil
+	}
+	// The tree grows once, then holds still.
+	listings := []treeTotals{{1, 10}, {2, 20}, {2, 20}}
+	listed := 0
+	d.totals = func(exp *Experiment) (treeTotals, error) {
+		listed++
+		return listings[min(listed, len(listings))-1], nil
+	}
+	var settled []string
+	d.sync = func(db *sql.DB, exp *Experiment, res *settleResult) error {
+		settled = append(settled, res.String())
+		return nil
+	}
+
+	now := time.Now()
+	start := time.Now()
+	d.pass(context.Background(), now, false)
+	if listed != 1 || len(settled) != 0 {
+		t.Fatalf("after the first pass: %d listing(s), synced %v", listed, settled)
+	}
+	// Each pass only lists the tree when the check's next listing is due,
+	// and none of them sleeps.
+	for _, step := range []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second} {
+		now = now.Add(step)
+		d.pass(context.Background(), now, false)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("passes took %s; the daemon slept through the settle delay", time.Since(start))
+	}
+	if listed != 3 || len(settled) != 1 || settled[0] != "stability check, stable after 20s" {
+		t.Fatalf("%d listing(s), synced %v", listed, settled)
+	}
+	if len(d.pendingSync) != 0 || len(d.settling) != 0 {
+		t.Errorf("leftover state: %v %v", d.pendingSync, d.settling)
+	}
+}
+
+func TestMonitorPidfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path, err := monitorPidPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A pidfile naming a process that no longer exists is stale.
+	if err := os.WriteFile(path, []byte("999999999\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	release, err := acquireMonitorPidfile()
+	if err != nil {
+		t.Fatalf("stale pidfile not replaced: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Fatalf("pidfile = %q", data)
+	}
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("pidfile not removed: %v", err)
+	}
+
+	// Our parent is certainly alive, so its pid blocks a second daemon.
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireMonitorPidfile(); err == nil {
+		t.Fatal("expected a live pidfile to block startup")
+	}
+
+	// A daemon for another database has a pidfile of its own.
+	t.Setenv("EXP_DB_PATH", filepath.Join(t.TempDir(), "other.db"))
+	other, err := monitorPidPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == path || filepath.Dir(other) != filepath.Dir(path) {
+		t.Fatalf("pidfile for another database = %s (default %s)", other, path)
+	}
+	release, err = acquireMonitorPidfile()
+	if err != nil {
+		t.Fatalf("the default database's daemon blocked another database's: %v", err)
+	}
+	release()
+}
+
+func TestMonitorDaemonCountsPreemptions(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "preemptable", "RUNNING", "")
+	d := newMonitorDaemon(db, time.Minute)
+	sequence := []string{"RUNNING", "PENDING", "RUNNING", "REQUEUED", "PENDING", "RUNNING", "PENDING", "PENDING", "RUNNING", "COMPLETED"}
+	polled := 0
+	d.query = func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		st := jobState{Status: sequence[polled]}
+		polled++
+		return map[string]jobState{"42": st}, nil
+	}
+	d.sync = func(db *sql.DB, exp *Experiment, settled *settleResult) error { return nil }
+	d.startQuery = func(remote string, sshOpts sshHostOptions, cluster, jobID string) (pendingEstimate, error) {
+		return pendingEstimate{Reason: "Priority"}, nil
+	}
+
+	now := time.Now()
+	for range sequence {
+		d.pass(context.Background(), now, false)
+		now = now.Add(d.interval)
+	}
+	if polled != len(sequence) {
+		t.Fatalf("polled %d times, want %d", polled, len(sequence))
+	}
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.JobStatus != "COMPLETED" || exp.PreemptCount != 3 {
+		t.Errorf("status %s, preempted %d times; want COMPLETED, 3", exp.JobStatus, exp.PreemptCount)
+	}
+
+	// The since-start filter still starts at submission, not the restart.
+	since, _, err := listingCutoff(io.Discard, exp, fetchOptions{SinceStart: true})
+	if err != nil || !since.Equal(exp.CreatedAt) {
+		t.Errorf("since-start cutoff = %v, %v; want %v", since, err, exp.CreatedAt)
+	}
+}
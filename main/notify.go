@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With notify_local, exp rings the terminal bell when a monitored job ends,
+// stalls in the queue or its artifacts fail to sync, and posts a desktop notification where
+// osascript (macOS) or notify-send (Linux) is around. A notification that
+// cannot be shown is not worth an error: the same news is printed anyway.
+
+// notifyTimeout bounds a notifier that hangs, say on a dead D-Bus session.
+const notifyTimeout = 10 * time.Second
+
+var (
+	notifierOnce sync.Once
+	notifierPath string // empty when there is no notifier
+)
+
+// desktopNotifier returns the notifier's path, looked up once.
+func desktopNotifier() string {
+	notifierOnce.Do(func() {
+		name := "notify-send"
+		if runtime.GOOS == "darwin" {
+			name = "osascript"
+		}
+		notifierPath, _ = exec.LookPath(name)
+	})
+	return notifierPath
+}
+
+// notifyLocal rings the bell, when stdout is a terminal, and posts title and
+// message as a desktop notification.
+func notifyLocal(title, message string) {
+	if isTerminal(os.Stdout) {
+		fmt.Fprint(os.Stdout, "\a")
+	}
+	path := desktopNotifier()
+	if path == "" {
+		return
+	}
+	var cmd *loggedCmd
+	if runtime.GOOS == "darwin" {
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = runCommand(path, "-e", script)
+	} else {
+		cmd = runCommand(path, "--app-name=exp", title, message)
+	}
+	cmd.withTimeout(notifyTimeout).Run()
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// finishedNotice is the notification of exp's job ending: its name, final
+// status and how long it ran.
+func finishedNotice(exp *Experiment) (title, message string) {
+	message = fmt.Sprintf("Experiment %d (%s) finished: %s", exp.ID, exp.Name, exp.JobStatus)
+	if d, ok := exp.runDuration(); ok {
+		message += " after " + d.String()
+	}
+	return "exp: " + exp.Name + " " + exp.JobStatus, message
+}
+
+// stalledNotice is the notification of exp's pending job stalling; warning
+// is what stalledJobs.observe said.
+func stalledNotice(exp *Experiment, warning string) (title, message string) {
+	return "exp: " + exp.Name + " stalled", warning
+}
+
+// syncFailedNotice is the notification of exp's artifacts failing to sync.
+func syncFailedNotice(exp *Experiment, err error) (title, message string) {
+	return "exp: " + exp.Name + " sync failed",
+		fmt.Sprintf("Experiment %d (%s): artifact sync failed: %v", exp.ID, exp.Name, err)
+}
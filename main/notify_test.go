@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifyLocal(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("notifies with osascript on macOS")
+	}
+	bin := t.TempDir()
+	calls := filepath.Join(t.TempDir(), "calls")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" >> " + shellQuote(calls) + "\n"
+	os.WriteFile(filepath.Join(bin, "notify-send"), []byte(script), 0o755)
+	t.Setenv("PATH", bin)
+	notifierOnce = sync.Once{}
+	t.Cleanup(func() { notifierOnce = sync.Once{} })
+
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	exp := &Experiment{ID: 7, Name: "train", JobStatus: "FAILED", CreatedAt: created, CompletedAt: created.Add(90 * time.Minute)}
+	notifyLocal(finishedNotice(exp))
+	data, _ := os.ReadFile(calls)
+	want := "--app-name=exp\nexp: train FAILED\nExperiment 7 (train) finished: FAILED after 1h30m0s\n"
+	if string(data) != want {
+		t.Errorf("notify-send got %q, want %q", data, want)
+	}
+
+	// A notifier that fails, here one gone since it was found, is ignored.
+	os.Remove(filepath.Join(bin, "notify-send"))
+	notifyLocal(syncFailedNotice(exp, errors.New("rsync: connection unexpectedly closed")))
+	if data, _ := os.ReadFile(calls); strings.Contains(string(data), "sync failed") {
+		t.Errorf("removed notifier ran: %q", data)
+	}
+	notifierOnce = sync.Once{}
+	if path := desktopNotifier(); path != "" {
+		t.Errorf("notifier = %q without notify-send", path)
+	}
+}
+
+func TestMonitorDaemonNotifies(t *testing.T) {
+	db := openTestDB(t)
+	insertTestExperiment(t, db, "quiet", "RUNNING", "")
+	insertTestExperiment(t, db, "loud", "RUNNING", `{"notify_local":true}`)
+	d := newMonitorDaemon(db, time.Minute)
+	d.query = func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		return map[string]jobState{"42": {Status: "COMPLETED"}}, nil
+	}
+	var notices []string
+	d.notify = func(title, message string) { notices = append(notices, title) }
+	d.pass(context.Background(), time.Now(), true)
+	if len(notices) != 1 || notices[0] != "exp: loud COMPLETED" {
+		t.Errorf("notices = %q", notices)
+	}
+}
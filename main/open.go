@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// exp open <id> [--cd | --log | --finder]
+func cmdOpen(args []string) error {
+	fs := flag.NewFlagSet("open", flag.ExitOnError)
+	var (
+		cdOnly bool
+		logRef bool
+		finder bool
+	)
+	fs.BoolVar(&cdOnly, "cd", false, "Print only the artifact path, e.g. cd $(exp open 12 --cd)")
+	fs.BoolVar(&logRef, "log", false, "Print the remote log as user@host:path (ready for scp)")
+	fs.BoolVar(&finder, "finder", false, "Open the artifact directory in the desktop file browser (open/xdg-open)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp open <id> [--cd | --log | --finder]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+
+	if logRef {
+		if exp.LogPath == "" {
+			return fmt.Errorf("experiment %s has no recorded log path", idStr)
+		}
+		fmt.Printf("%s:%s\n", exp.Remote, exp.LogPath)
+		return nil
+	}
+
+	if exp.ArtifactDest == "" {
+		return fmt.Errorf("experiment %s has no recorded artifact destination; fetch artifacts first with: exp fetch %s --dest DIR --remote-path REMOTE", idStr, idStr)
+	}
+	if cdOnly {
+		fmt.Println(exp.ArtifactDest)
+		return nil
+	}
+	if finder {
+		opener := "xdg-open"
+		if runtime.GOOS == "darwin" {
+			opener = "open"
+		}
+		if _, err := exec.LookPath(opener); err != nil {
+			return fmt.Errorf("%s not found; artifacts are at %s", opener, exp.ArtifactDest)
+		}
+		cmd := runCommand(opener, exp.ArtifactDest)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s %s: %w", opener, exp.ArtifactDest, err)
+		}
+		return nil
+	}
+	fmt.Printf("Experiment %d (%s)\n", exp.ID, exp.Name)
+	fmt.Printf("Artifacts:   %s\n", exp.ArtifactDest)
+	if _, err := os.Stat(exp.ArtifactDest); os.IsNotExist(err) {
+		fmt.Printf("  (directory does not exist yet; run exp fetch %s)\n", idStr)
+	}
+	if exp.LogPath != "" {
+		fmt.Printf("Remote log:  %s:%s\n", exp.Remote, exp.LogPath)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// globalOptions are the options given before the command. They apply to
+// every command, so they are parsed once in main rather than by each
+// command's flag set.
+type globalOptions struct {
+	DBPath   string // --db; dbPath falls back to EXP_DB_PATH, then the data directory
+	DebugLog string // --debug-log; the config's debug_log applies without it
+	// NoMultiplex (--no-multiplex) gives every ssh its own connection.
+	NoMultiplex bool
+}
+
+var globals globalOptions
+
+// setupGlobalOptions consumes the global options at the front of args, opens
+// the debug log, picks the SSH backend, and returns the command and its
+// arguments.
+func setupGlobalOptions(args []string) ([]string, error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		var dest *string
+		switch name {
+		case "--no-multiplex":
+			if hasValue {
+				return nil, fmt.Errorf("--no-multiplex takes no value")
+			}
+			globals.NoMultiplex, args = true, args[1:]
+			continue
+		case "--db":
+			dest = &globals.DBPath
+		case "--debug-log":
+			dest = &globals.DebugLog
+		default:
+			return args, finishGlobalOptions()
+		}
+		if !hasValue {
+			if len(args) < 2 {
+				return nil, fmt.Errorf("%s needs a path", name)
+			}
+			value, args = args[1], args[1:]
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%s needs a path", name)
+		}
+		*dest, args = value, args[1:]
+	}
+	return args, finishGlobalOptions()
+}
+
+func finishGlobalOptions() error {
+	// A broken config is reported by the commands that need it.
+	cfg, err := loadConfig()
+	if err != nil || cfg == nil {
+		cfg = &Config{}
+	}
+	if timeouts, err = configTimeouts(cfg); err != nil {
+		return err
+	}
+	if remoteExecutor, err = newRemoteExecutor(cfg.SSHBackend, cfg.SSHIdentityFiles); err != nil {
+		return err
+	}
+	stateHooks = newStateHookDispatcher(cfg.OnStateChange)
+	if monitorHeartbeat, err = configMonitorHeartbeat(cfg); err != nil {
+		return err
+	}
+	polls, err := configMaxConcurrentPolls(cfg)
+	if err != nil {
+		return err
+	}
+	remotePolls = newPollLimiter(polls)
+	path := globals.DebugLog
+	if path == "" {
+		path = cfg.DebugLog
+	}
+	if path == "" {
+		return nil
+	}
+	return openDebugLog(path)
+}
+
+// args repeats the global options for a child exp process, such as the
+// monitor daemon, with paths made absolute since it may run elsewhere.
+func (g globalOptions) args() []string {
+	var args []string
+	for _, opt := range []struct{ name, path string }{{"--db", g.DBPath}, {"--debug-log", g.DebugLog}} {
+		if opt.path == "" {
+			continue
+		}
+		if abs, err := expandLocalPath(opt.path); err == nil {
+			opt.path = abs
+		}
+		args = append(args, opt.name, opt.path)
+	}
+	if g.NoMultiplex {
+		args = append(args, "--no-multiplex")
+	}
+	return args
+}
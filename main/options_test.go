@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func resetGlobals(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		if debugLog.file != nil {
+			debugLog.file.Close()
+		}
+		debugLog = debugLogger{}
+		globals = globalOptions{}
+	})
+}
+
+func TestSetupGlobalOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	resetGlobals(t)
+	logPath := filepath.Join(t.TempDir(), "debug.jsonl")
+	rest, err := setupGlobalOptions([]string{"--db=work.db", "--debug-log", logPath, "list", "--debug-log", "x"})
+	if err != nil || strings.Join(rest, " ") != "list --debug-log x" {
+		t.Fatalf("setupGlobalOptions = %q, %v", rest, err)
+	}
+	if globals.DBPath != "work.db" || globals.DebugLog != logPath || !debugLog.enabled() {
+		t.Errorf("globals = %+v, debug log enabled %v", globals, debugLog.enabled())
+	}
+	cwd, _ := os.Getwd()
+	if got := strings.Join(globals.args(), " "); got != "--db "+filepath.Join(cwd, "work.db")+" --debug-log "+logPath {
+		t.Errorf("child args = %q", got)
+	}
+	for _, bad := range [][]string{{"--db"}, {"--db=", "list"}} {
+		if _, err := setupGlobalOptions(bad); err == nil {
+			t.Errorf("setupGlobalOptions(%q) should fail", bad)
+		}
+	}
+	if rest, err := setupGlobalOptions([]string{"--no-multiplex", "fetch", "3"}); err != nil || len(rest) != 2 || !globals.NoMultiplex {
+		t.Errorf("--no-multiplex: %q, %v, %+v", rest, err, globals)
+	}
+	if got := globals.args(); got[len(got)-1] != "--no-multiplex" {
+		t.Errorf("child args = %q", got)
+	}
+	if _, err := setupGlobalOptions([]string{"--no-multiplex=yes", "list"}); err == nil {
+		t.Error("--no-multiplex=yes should fail")
+	}
+	if rest, err := setupGlobalOptions([]string{"--help"}); err != nil || len(rest) != 1 {
+		t.Errorf("unknown options are left to the command: %q, %v", rest, err)
+	}
+}
+
+func TestDBPathOverrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("EXP_DB_PATH", "")
+	resetGlobals(t)
+
+	if path, err := dbPath(); err != nil || path != filepath.Join(home, ".local", "share", "exp", "experiments.db") {
+		t.Errorf("default dbPath = %q, %v", path, err)
+	}
+	t.Setenv("EXP_DB_PATH", "~/personal/exp.db")
+	if path, err := dbPath(); err != nil || path != filepath.Join(home, "personal", "exp.db") {
+		t.Errorf("EXP_DB_PATH dbPath = %q, %v", path, err)
+	}
+	globals.DBPath = "~/work/exp.db"
+	if path, err := dbPath(); err != nil || path != filepath.Join(home, "work", "exp.db") {
+		t.Errorf("--db dbPath = %q, %v", path, err)
+	}
+
+	// Each database holds its own experiments.
+	db := openTestDBAt(t)
+	insertTestExperiment(t, db, "work", "COMPLETED", "")
+	globals.DBPath = ""
+	other := openTestDBAt(t)
+	var n int
+	if err := other.QueryRow(`SELECT COUNT(*) FROM experiments`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("EXP_DB_PATH database sees %d experiments, %v", n, err)
+	}
+}
+
+func openTestDBAt(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := openDB()
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	patternSyntaxRegex = "regex"
+	patternSyntaxGlob  = "glob"
+)
+
+// pathMatcher is a compiled artifact pattern. *regexp.Regexp satisfies it
+// directly; globMatcher adds path.Match-style globs with "**".
+type pathMatcher interface {
+	MatchString(s string) bool
+}
+
+// negatedMatcher is a pattern written with a leading "!": paths it matches
+// are dropped after the include patterns have been applied.
+type negatedMatcher struct {
+	pathMatcher
+}
+
+// cutNegation splits a leading "!" off a pattern. A pattern that must start
+// with a literal "!" can escape it as "\!" in either syntax.
+func cutNegation(pattern string) (string, bool) {
+	if rest, ok := strings.CutPrefix(pattern, "!"); ok {
+		return strings.TrimSpace(rest), true
+	}
+	return pattern, false
+}
+
+// globMatcher matches slash-separated paths segment by segment with
+// path.Match; a "**" segment matches zero or more whole segments.
+type globMatcher struct {
+	segments []string
+}
+
+func (g globMatcher) MatchString(s string) bool {
+	return matchGlobSegments(g.segments, strings.Split(s, "/"))
+}
+
+func matchGlobSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func compileGlob(pattern string) (globMatcher, error) {
+	segments := strings.Split(pattern, "/")
+	for _, seg := range segments {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return globMatcher{}, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return globMatcher{segments: segments}, nil
+}
+
+// normalizePatternSyntax validates a pattern_syntax value; "" means the
+// caller's default (regex unless something upstream chose glob).
+func normalizePatternSyntax(syntax string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(syntax)) {
+	case "":
+		return "", nil
+	case "regex", "regexp":
+		return patternSyntaxRegex, nil
+	case "glob":
+		return patternSyntaxGlob, nil
+	default:
+		return "", fmt.Errorf("pattern_syntax %q must be glob or regex", syntax)
+	}
+}
+
+// compileMatchers compiles patterns in the given syntax, naming the offending
+// pattern when one is invalid. Patterns starting with "!" compile to
+// negatedMatchers.
+func compileMatchers(patterns []string, syntax string) ([]pathMatcher, error) {
+	syntax, err := normalizePatternSyntax(syntax)
+	if err != nil {
+		return nil, err
+	}
+	var out []pathMatcher
+	for _, pat := range patterns {
+		pat = strings.TrimSpace(pat)
+		if pat == "" {
+			continue
+		}
+		body, negated := cutNegation(pat)
+		if body == "" {
+			return nil, fmt.Errorf("pattern %q negates nothing", pat)
+		}
+		var m pathMatcher
+		if syntax == patternSyntaxGlob {
+			g, err := compileGlob(body)
+			if err != nil {
+				return nil, err
+			}
+			m = g
+		} else {
+			compiled, err := compilePatterns([]string{body})
+			if err != nil {
+				return nil, err
+			}
+			m = compiled[0]
+		}
+		if negated {
+			m = negatedMatcher{m}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// applyPatternSyntax fills in each source's syntax: force (from --glob)
+// overrides everything, otherwise def applies to sources without their own.
+// It returns an error naming the first invalid pattern.
+func applyPatternSyntax(sources []ArtifactSource, def, force string) error {
+	def, err := normalizePatternSyntax(def)
+	if err != nil {
+		return err
+	}
+	if def == "" {
+		def = patternSyntaxRegex
+	}
+	for i := range sources {
+		syntax, err := normalizePatternSyntax(sources[i].PatternSyntax)
+		if err != nil {
+			return fmt.Errorf("artifact source %s: %w", sources[i].Path, err)
+		}
+		switch {
+		case force != "":
+			syntax = force
+		case syntax == "":
+			syntax = def
+		}
+		sources[i].PatternSyntax = syntax
+		if _, err := compileMatchers(sources[i].Patterns, syntax); err != nil {
+			return fmt.Errorf("artifact source %s: %w", sources[i].Path, err)
+		}
+	}
+	return nil
+}
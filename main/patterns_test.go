@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobMatcher(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.json", "recall.json", true},
+		{"*.json", "res/recall.json", false},
+		{"results/**/*.csv", "results/a/b/run.csv", true},
+		{"results/**/*.csv", "results/run.csv", true},
+		{"results/**/*.csv", "other/run.csv", false},
+		{"**", "any/depth/file", true},
+		{"/remote/**/metrics.json", "/remote/x/metrics.json", true},
+		{"run-?.log", "run-1.log", true},
+		{"run-[0-9].log", "run-a.log", false},
+	}
+	for _, c := range cases {
+		g, err := compileGlob(c.pattern)
+		if err != nil {
+			t.Fatalf("compileGlob(%q): %v", c.pattern, err)
+		}
+		if got := g.MatchString(c.path); got != c.want {
+			t.Errorf("%q.MatchString(%q) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
+
+func TestCompileMatchers(t *testing.T) {
+	if _, err := compileMatchers([]string{"*.json", "[bad"}, "glob"); err == nil || !strings.Contains(err.Error(), `"[bad"`) {
+		t.Fatalf("invalid glob error = %v", err)
+	}
+	if _, err := compileMatchers([]string{"*.json"}, "shell"); err == nil {
+		t.Fatal("expected unknown syntax to be rejected")
+	}
+
+	glob, err := compileMatchers([]string{"*.json"}, "glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	regex, err := compileMatchers([]string{`\.json$`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both syntaxes share patternMatches, which also tries the base name.
+	for _, m := range [][]pathMatcher{glob, regex} {
+		if !patternMatches(m, "/remote/res", "sub/recall.json") || patternMatches(m, "/remote/res", "sub/recall.csv") {
+			t.Errorf("patternMatches(%v) wrong", m)
+		}
+	}
+}
+
+func TestApplyPatternSyntax(t *testing.T) {
+	sources := []ArtifactSource{
+		{Path: "/a", Patterns: []string{"*.json"}},
+		{Path: "/b", Patterns: []string{`\.csv$`}, PatternSyntax: "regex"},
+	}
+	if err := applyPatternSyntax(sources, "glob", ""); err != nil {
+		t.Fatal(err)
+	}
+	if sources[0].PatternSyntax != "glob" || sources[1].PatternSyntax != "regex" {
+		t.Fatalf("sources = %+v", sources)
+	}
+	if err := applyPatternSyntax(sources, "", "glob"); err != nil {
+		t.Fatalf("forced glob: %v", err)
+	}
+	if sources[1].PatternSyntax != "glob" {
+		t.Fatalf("--glob did not override the source syntax: %+v", sources[1])
+	}
+	bad := []ArtifactSource{{Path: "/c", Patterns: []string{"res/[x"}}}
+	if err := applyPatternSyntax(bad, "glob", ""); err == nil || !strings.Contains(err.Error(), "res/[x") {
+		t.Fatalf("expected the invalid glob to be named, got %v", err)
+	}
+}
+
+func TestNegatedPatterns(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		syntax   string
+		path     string
+		want     bool
+	}{
+		{[]string{"json$", `!debug.*\.json$`}, "", "res/recall.json", true},
+		{[]string{"json$", `!debug.*\.json$`}, "", "res/debug-1.json", false},
+		{[]string{"json$", `!debug.*\.json$`}, "", "res/run.log", false},
+		{[]string{"*.json", "!debug*"}, "glob", "debug.json", false},
+		{[]string{"*.json", "!debug*"}, "glob", "recall.json", true},
+		// Only negations: everything except what they match.
+		{[]string{`!\.tmp$`}, "", "res/run.log", true},
+		{[]string{`!\.tmp$`}, "", "res/x.tmp", false},
+		{[]string{"! *.tmp"}, "glob", "x.tmp", false},
+		// An escaped "!" is a literal.
+		{[]string{`\!important`}, "", "!important", true},
+	}
+	for _, c := range cases {
+		m, err := compileMatchers(ensurePatterns(c.patterns), c.syntax)
+		if err != nil {
+			t.Fatalf("compileMatchers(%q): %v", c.patterns, err)
+		}
+		if got := patternMatches(m, "/remote/out", c.path); got != c.want {
+			t.Errorf("patternMatches(%q, %q) = %v, want %v", c.patterns, c.path, got, c.want)
+		}
+	}
+	if _, err := compileMatchers([]string{"!"}, ""); err == nil {
+		t.Error("a bare ! was accepted")
+	}
+
+	patterns := []string{"json$", "! debug.*", "  csv$ "}
+	stored := splitPatterns(combinePatterns(patterns))
+	if want := []string{"json$", "!debug.*", "csv$"}; strings.Join(stored, "|") != strings.Join(want, "|") {
+		t.Errorf("round trip = %q, want %q", stored, want)
+	}
+	if got := describePattern("!debug.*"); got != "not debug.*" {
+		t.Errorf("describePattern = %q", got)
+	}
+}
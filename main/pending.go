@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// While a job is PENDING, the monitor asks squeue --start, now and then, when
+// Slurm expects it to start and why it is waiting, so one can decide whether
+// to wait for it.
+
+// defaultPendingCheckInterval is how often the monitor asks without
+// pending_check_interval: the estimate moves slowly, and the scheduler
+// should not be asked on every poll.
+const defaultPendingCheckInterval = 5 * time.Minute
+
+// pendingEstimate is what squeue --start says about a pending job.
+type pendingEstimate struct {
+	Start  time.Time // zero when Slurm has no estimate (N/A)
+	Reason string    // e.g. Priority, Resources, QOSMaxJobsPerUser
+}
+
+// describe renders the estimate for the monitor and exp show.
+func (e pendingEstimate) describe() string {
+	reason := e.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	if e.Start.IsZero() {
+		return reason + "; no start estimate yet"
+	}
+	return fmt.Sprintf("%s; expected to start around %s", reason, e.Start.Local().Format(time.RFC3339))
+}
+
+// parseSqueueStart reads squeue --start -o "%S %r" output: the estimated
+// start, or N/A, and the pending reason.
+func parseSqueueStart(out string) (pendingEstimate, error) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || isClusterHeader(line) {
+			continue
+		}
+		var e pendingEstimate
+		if fields[0] != "N/A" {
+			e.Start = parseSlurmTime(fields[0])
+		}
+		if len(fields) > 1 && fields[1] != "None" && fields[1] != "(null)" {
+			e.Reason = fields[1]
+		}
+		return e, nil
+	}
+	return pendingEstimate{}, fmt.Errorf("squeue --start printed nothing; the job is no longer pending")
+}
+
+// querySqueueStart asks the scheduler of remote's cluster about a pending
+// job.
+func querySqueueStart(remote string, sshOpts sshHostOptions, cluster, jobID string) (pendingEstimate, error) {
+	out, err := sshCombinedOutput(remote, sshOpts, slurmArgs(cluster, "squeue", "-h", "--start", "-j", jobID, "-o", shellQuote("%S %r"))...)
+	if err != nil {
+		return pendingEstimate{}, fmt.Errorf("squeue --start: %w (output: %s)", err, strings.TrimSpace(string(out)))
+	}
+	return parseSqueueStart(string(out))
+}
+
+// pendingCheckInterval reads pending_check_interval from the run snapshot;
+// 0 turns the checks off.
+func (exp *Experiment) pendingCheckInterval() time.Duration {
+	d, err := time.ParseDuration(exp.runSnapshot().PendingCheckInterval)
+	if err != nil || d < 0 {
+		return defaultPendingCheckInterval
+	}
+	return d
+}
+
+// validatePendingCheck checks pending_check_interval as given in a run config
+// or on the command line.
+func validatePendingCheck(interval string) error {
+	if interval == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(interval); err != nil || d < 0 {
+		return fmt.Errorf("invalid pending_check_interval %q (examples: 5m, 15m, 0 to turn it off)", interval)
+	}
+	return nil
+}
+
+// pendingChecks remembers when each experiment's pending job was last asked
+// about.
+type pendingChecks map[int64]time.Time
+
+// check asks query about exp's job when it is pending and the last check is
+// pending_check_interval old, and stores the answer. ok is false when no
+// check was due.
+func (p pendingChecks) check(db execer, exp *Experiment, now time.Time, query func(remote string, sshOpts sshHostOptions, cluster, jobID string) (pendingEstimate, error)) (e pendingEstimate, ok bool, err error) {
+	interval := exp.pendingCheckInterval()
+	if normalizeStatus(exp.JobStatus) != "PENDING" || interval <= 0 {
+		delete(p, exp.ID)
+		return e, false, nil
+	}
+	if last, seen := p[exp.ID]; seen && now.Sub(last) < interval {
+		return e, false, nil
+	}
+	p[exp.ID] = now
+	if e, err = query(exp.Remote, exp.SSH, exp.Cluster, exp.JobID); err != nil {
+		return e, false, err
+	}
+	exp.PendingReason, exp.PendingStart = e.Reason, e.Start
+	return e, true, recordPendingEstimate(db, exp.ID, e)
+}
+
+// recordPendingEstimate stores e on experiment id. updateExperimentStatus
+// clears it once the job leaves PENDING.
+func recordPendingEstimate(db execer, id int64, e pendingEstimate) error {
+	_, err := db.Exec(`UPDATE experiments SET pending_reason = ?, pending_start = ? WHERE id = ?`,
+		nullString(e.Reason), nullTime(e.Start), id)
+	return err
+}
+
+// lastPendingEstimate is what the last check stored for exp.
+func (exp *Experiment) lastPendingEstimate() (pendingEstimate, bool) {
+	if normalizeStatus(exp.JobStatus) != "PENDING" || (exp.PendingReason == "" && exp.PendingStart.IsZero()) {
+		return pendingEstimate{}, false
+	}
+	return pendingEstimate{Start: exp.PendingStart, Reason: exp.PendingReason}, true
+}
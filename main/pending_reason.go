@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pendingReasonClass says whether a pending job will start by itself.
+type pendingReasonClass int
+
+const (
+	pendingBenign     pendingReasonClass = iota // the job waits its turn
+	pendingActionable                           // the job waits for something that may never happen
+)
+
+// pendingReasons classify the reasons squeue %r gives for a pending job, with
+// what to do about the actionable ones. A reason ending in * matches every
+// reason it starts; the first match wins. Reasons not listed are benign.
+var pendingReasons = []struct {
+	reason string
+	class  pendingReasonClass
+	hint   string
+}{
+	{"Priority", pendingBenign, ""},
+	{"Resources", pendingBenign, ""},
+	{"Dependency", pendingBenign, ""},
+	{"BeginTime", pendingBenign, ""},
+	{"DependencyNeverSatisfied", pendingActionable, "a job it depends on did not end as required; cancel it or change the dependency with scontrol update"},
+	{"JobHeldUser", pendingActionable, "it is held; release it with scontrol release JOBID"},
+	{"JobHeldAdmin", pendingActionable, "an administrator holds it"},
+	{"QOSMaxSubmitJobPerUserLimit", pendingActionable, "you have more jobs queued than your QOS allows; cancel some"},
+	{"QOS*", pendingActionable, "a QOS limit holds it until your other jobs finish, or the limit is raised"},
+	{"AssocGrp*", pendingActionable, "your account's group limit holds it until other jobs of the account finish"},
+	{"AssocMax*", pendingActionable, "it asks for more than your account's limits allow"},
+	{"PartitionDown", pendingActionable, "the partition is down"},
+	{"PartitionInactive", pendingActionable, "the partition does not accept jobs"},
+	{"PartitionNodeLimit", pendingActionable, "it asks for more nodes than the partition allows"},
+	{"PartitionTimeLimit", pendingActionable, "it asks for more time than the partition allows"},
+	{"ReqNodeNotAvail", pendingActionable, "a node it needs is down, drained or reserved"},
+	{"InvalidQOS", pendingActionable, "its QOS is not valid for its account or partition"},
+	{"InvalidAccount", pendingActionable, "its account is not valid"},
+	{"BadConstraints", pendingActionable, "no node satisfies its constraints"},
+}
+
+// classifyPendingReason classifies reason and returns the hint for it.
+func classifyPendingReason(reason string) (pendingReasonClass, string) {
+	reason = strings.Trim(reason, "()")
+	for _, r := range pendingReasons {
+		if prefix, ok := strings.CutSuffix(r.reason, "*"); (ok && strings.HasPrefix(reason, prefix)) || r.reason == reason {
+			return r.class, r.hint
+		}
+	}
+	return pendingBenign, ""
+}
+
+// defaultStallAfter is how long an actionable reason holds a job before the
+// monitor warns, without stall_after: long enough for a limit to clear on
+// its own, short enough to notice the same day.
+const defaultStallAfter = time.Hour
+
+// stallAfter reads stall_after from the run snapshot.
+func (exp *Experiment) stallAfter() time.Duration {
+	d, err := time.ParseDuration(exp.runSnapshot().StallAfter)
+	if err != nil || d <= 0 {
+		return defaultStallAfter
+	}
+	return d
+}
+
+// validateStallAfter checks stall_after as given in a run config or on the
+// command line.
+func validateStallAfter(after string) error {
+	if after == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(after); err != nil || d <= 0 {
+		return fmt.Errorf("invalid stall_after %q (examples: 30m, 2h)", after)
+	}
+	return nil
+}
+
+// stalledJobs remembers since when each experiment's pending job has been
+// held by an actionable reason.
+type stalledJobs map[int64]time.Time
+
+// observe judges e, a fresh estimate for exp's pending job. Once an
+// actionable reason has held it for stall_after, the experiment is marked
+// stalled, on_state_change runs, and observe returns the warning to show,
+// once. A benign reason clears the mark.
+func (s stalledJobs) observe(db *sql.DB, exp *Experiment, e pendingEstimate, now time.Time) (warning string, err error) {
+	class, hint := classifyPendingReason(e.Reason)
+	if class != pendingActionable {
+		delete(s, exp.ID)
+		if exp.StalledReason == "" {
+			return "", nil
+		}
+		exp.StalledReason = ""
+		return "", recordStalledReason(db, exp.ID, "")
+	}
+	since, seen := s[exp.ID]
+	if !seen {
+		s[exp.ID] = now
+		since = now
+	}
+	if now.Sub(since) < exp.stallAfter() || exp.StalledReason == e.Reason {
+		return "", nil
+	}
+	exp.StalledReason = e.Reason
+	if err := recordStalledReason(db, exp.ID, e.Reason); err != nil {
+		return "", err
+	}
+	stateHooks.stalled(db, exp.ID)
+	return fmt.Sprintf("experiment %d (job %s) has been pending for %s because of %s: %s",
+		exp.ID, exp.JobID, now.Sub(since).Round(time.Minute), e.Reason, hint), nil
+}
+
+// recordStalledReason marks experiment id stalled by reason, or clears the
+// mark. updateExperimentStatus clears it too once the job leaves PENDING.
+func recordStalledReason(db execer, id int64, reason string) error {
+	_, err := db.Exec(`UPDATE experiments SET stalled_reason = ? WHERE id = ?`, nullString(reason), id)
+	return err
+}
+
+// stalled reports whether exp's pending job is held by an actionable reason.
+func (exp *Experiment) stalled() bool {
+	return exp.StalledReason != "" && normalizeStatus(exp.JobStatus) == "PENDING"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyPendingReason(t *testing.T) {
+	for reason, want := range map[string]pendingReasonClass{
+		"Priority":                    pendingBenign,
+		"Resources":                   pendingBenign,
+		"Dependency":                  pendingBenign,
+		"SomeFutureReason":            pendingBenign,
+		"":                            pendingBenign,
+		"QOSMaxSubmitJobPerUserLimit": pendingActionable,
+		"QOSMaxJobsPerUserLimit":      pendingActionable,
+		"(QOSGrpCpuLimit)":            pendingActionable,
+		"AssocGrpGRES":                pendingActionable,
+		"DependencyNeverSatisfied":    pendingActionable,
+		"JobHeldUser":                 pendingActionable,
+		"PartitionDown":               pendingActionable,
+		"ReqNodeNotAvail":             pendingActionable,
+	} {
+		if got, hint := classifyPendingReason(reason); got != want || (got == pendingActionable) != (hint != "") {
+			t.Errorf("classifyPendingReason(%q) = %d, %q; want %d", reason, got, hint, want)
+		}
+	}
+	// Every actionable entry says what to do, and none is shadowed by an
+	// earlier pattern.
+	for i, r := range pendingReasons {
+		if r.class == pendingActionable && r.hint == "" {
+			t.Errorf("%s has no hint", r.reason)
+		}
+		name := strings.TrimSuffix(r.reason, "*")
+		if class, hint := classifyPendingReason(name); class != r.class || hint != r.hint {
+			t.Errorf("entry %d (%s) is shadowed by an earlier one", i, r.reason)
+		}
+	}
+}
+
+func TestStalledJobs(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "queued", "PENDING", `{"stall_after":"30m"}`)
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := make(stalledJobs)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	limit := pendingEstimate{Reason: "QOSMaxSubmitJobPerUserLimit"}
+
+	var warnings []string
+	for _, step := range []struct {
+		after time.Duration
+		e     pendingEstimate
+	}{
+		{0, pendingEstimate{Reason: "Priority"}},
+		{5 * time.Minute, limit},
+		{30 * time.Minute, limit},
+		{35 * time.Minute, limit},
+		{40 * time.Minute, limit},
+	} {
+		w, err := s.observe(db, exp, step.e, start.Add(step.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "pending for 30m0s because of QOSMaxSubmitJobPerUserLimit") {
+		t.Fatalf("warnings = %q", warnings)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if !exp.stalled() || listColumnValue(exp, nil, "status") != "STALLED" {
+		t.Errorf("stalled reason %q, status column %q", exp.StalledReason, listColumnValue(exp, nil, "status"))
+	}
+
+	// Once the limit clears, the job is ordinary pending again.
+	if w, err := s.observe(db, exp, pendingEstimate{Reason: "Priority"}, start.Add(time.Hour)); w != "" || err != nil {
+		t.Errorf("benign reason: %q, %v", w, err)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.stalled() || listColumnValue(exp, nil, "status") != "PENDING" {
+		t.Errorf("still stalled: %q", exp.StalledReason)
+	}
+}
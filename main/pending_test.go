@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseSqueueStart(t *testing.T) {
+	cases := []struct {
+		out    string
+		start  time.Time
+		reason string
+	}{
+		{"2025-03-01T14:00:00 Priority\n", parseSlurmTime("2025-03-01T14:00:00"), "Priority"},
+		{"N/A Resources\n", time.Time{}, "Resources"},
+		{"N/A QOSMaxJobsPerUser\n", time.Time{}, "QOSMaxJobsPerUser"},
+		{"N/A None\n", time.Time{}, ""},
+	}
+	for _, c := range cases {
+		e, err := parseSqueueStart(c.out)
+		if err != nil || !e.Start.Equal(c.start) || e.Reason != c.reason {
+			t.Errorf("parseSqueueStart(%q) = %+v, %v", c.out, e, err)
+		}
+	}
+	if _, err := parseSqueueStart(""); err == nil {
+		t.Error("empty output parsed")
+	}
+	if got := (pendingEstimate{Reason: "Resources"}).describe(); got != "Resources; no start estimate yet" {
+		t.Errorf("describe = %q", got)
+	}
+}
+
+func TestPendingChecks(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "queued", "PENDING", `{"pending_check_interval":"10m"}`)
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asked := 0
+	query := func(remote string, sshOpts sshHostOptions, cluster, jobID string) (pendingEstimate, error) {
+		asked++
+		return parseSqueueStart("2025-03-01T14:00:00 Priority\n")
+	}
+	p := make(pendingChecks)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, after := range []time.Duration{0, time.Minute, 9 * time.Minute, 10 * time.Minute, 15 * time.Minute} {
+		if _, _, err := p.check(db, exp, start.Add(after), query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if asked != 2 {
+		t.Errorf("asked %d times in 15 minutes, want 2", asked)
+	}
+
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if e, ok := exp.lastPendingEstimate(); !ok || e.Reason != "Priority" || e.Start.IsZero() {
+		t.Errorf("stored estimate = %+v, %v", e, ok)
+	}
+	if got := listColumnValue(exp, nil, "reason"); got != "Priority" {
+		t.Errorf("reason column = %q", got)
+	}
+
+	if err := changeExperimentStatus(db, id, "RUNNING", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.PendingReason != "" || !exp.PendingStart.IsZero() {
+		t.Errorf("estimate kept after the job started: %q %v", exp.PendingReason, exp.PendingStart)
+	}
+	if _, ok, _ := p.check(db, exp, start.Add(time.Hour), query); ok || asked != 2 {
+		t.Error("asked about a running job")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// deniedError reports a transfer that only failed on paths it was not
+// allowed to read: rsync exit code 23 where every error was "Permission
+// denied". The other files were transferred. Unless --strict is set the
+// caller skips Paths (relative to the source) and treats the sync as a
+// success with warnings.
+type deniedError struct {
+	Paths []string
+	err   error
+}
+
+func (e *deniedError) Error() string {
+	return fmt.Sprintf("%v; unreadable: %s", e.err, strings.Join(e.Paths, ", "))
+}
+
+func (e *deniedError) Unwrap() error { return e.err }
+
+// parseDeniedPaths picks the "Permission denied" errors out of find or rsync
+// stderr and returns the paths they name, relative to root. ok is false when
+// there are none or when find or rsync also reported any other error; lines
+// from neither, such as login banners, are ignored.
+func parseDeniedPaths(stderr, root string) (paths []string, ok bool) {
+	other := false
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "find: ") && !strings.HasPrefix(line, "rsync: ") {
+			// "rsync error: ... (code 23)" only summarises the lines above.
+			continue
+		}
+		if !strings.Contains(line, "Permission denied") {
+			other = true
+			continue
+		}
+		p, found := quotedPath(line)
+		if !found {
+			other = true
+			continue
+		}
+		paths = append(paths, relToRoot(p, root))
+	}
+	return paths, len(paths) > 0 && !other
+}
+
+// quotedPath returns the path find (‘x’ or 'x') or rsync ("x") quotes in an
+// error line.
+func quotedPath(line string) (string, bool) {
+	i := strings.IndexAny(line, "‘'\"")
+	if i < 0 {
+		return "", false
+	}
+	open := line[i:]
+	closer := "\""
+	switch {
+	case strings.HasPrefix(open, "‘"):
+		closer, open = "’", open[len("‘"):]
+	case strings.HasPrefix(open, "'"):
+		closer, open = "'", open[1:]
+	default:
+		open = open[1:]
+	}
+	j := strings.LastIndex(open, closer)
+	if j <= 0 {
+		return "", false
+	}
+	return open[:j], true
+}
+
+// relToRoot turns a path from find (./rel) or rsync (absolute, or relative
+// to the source) into one relative to root.
+func relToRoot(p, root string) string {
+	if rest, ok := strings.CutPrefix(p, strings.TrimRight(root, "/")+"/"); ok {
+		p = rest
+	}
+	return strings.TrimPrefix(path.Clean(p), "./")
+}
+
+// withoutDenied drops the files that are, or lie under, a denied path.
+func withoutDenied(files []string, denied []string) []string {
+	out := files[:0:0]
+	for _, f := range files {
+		if !isDenied(f, denied) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func isDenied(rel string, denied []string) bool {
+	for _, d := range denied {
+		if rel == d || strings.HasPrefix(rel, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// displayPaths joins paths for a one-line message.
+func displayPaths(paths []string) string {
+	shown := make([]string, len(paths))
+	for i, p := range paths {
+		shown[i] = displayPath(p)
+	}
+	return strings.Join(shown, ", ")
+}
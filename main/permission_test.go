@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseDeniedPaths(t *testing.T) {
+	root := "/scratch/run"
+	cases := []struct {
+		stderr string
+		want   []string
+		ok     bool
+	}{
+		{"Remote PWD after cd: /scratch/run\nfind: ‘./secret’: Permission denied\nfind: './a b/private': Permission denied\n", []string{"secret", "a b/private"}, true},
+		{`rsync: [sender] send_files failed to open "/scratch/run/out/x.json": Permission denied (13)
+rsync: [sender] opendir "/scratch/run/locked" failed: Permission denied (13)
+rsync error: some files/attrs were not transferred (see previous errors) (code 23) at main.c(1865) [generator=3.2.7]
+`, []string{"out/x.json", "locked"}, true},
+		{"find: ‘./secret’: Permission denied\nfind: ‘./gone’: No such file or directory\n", []string{"secret"}, false},
+		{"Welcome to the cluster\n", nil, false},
+	}
+	for _, c := range cases {
+		got, ok := parseDeniedPaths(c.stderr, root)
+		if !reflect.DeepEqual(got, c.want) || ok != c.ok {
+			t.Errorf("parseDeniedPaths(%q) = %q, %v; want %q, %v", c.stderr, got, ok, c.want, c.ok)
+		}
+	}
+
+	r := &sourceFetch{
+		files:   []string{"a.json", "locked/b.json", "locked.json"},
+		matched: []remoteFile{{Rel: "a.json"}, {Rel: "locked/b.json"}, {Rel: "locked.json"}},
+	}
+	r.skipDenied([]string{"locked"})
+	if want := []string{"a.json", "locked.json"}; !reflect.DeepEqual(r.files, want) || !reflect.DeepEqual(remoteFileNames(r.matched), want) {
+		t.Errorf("after skipDenied files = %q, matched = %q", r.files, remoteFileNames(r.matched))
+	}
+}
+
+// TestListingSkipsUnreadableDir lists a tree with an unreadable directory
+// the way the remote side would, as an unprivileged user.
+func TestListingSkipsUnreadableDir(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	root := t.TempDir()
+	for _, rel := range []string{"ok/a.json", "secret/b.json", "c.json"} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(root, "secret"), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(root, "secret"), 0o755)
+
+	cmd := exec.Command("bash", "-c", remoteListCommand(root, "", time.Time{}, listFilter{}))
+	if os.Geteuid() == 0 {
+		// root reads everything; drop to nobody, who needs to reach root.
+		setpriv, err := exec.LookPath("setpriv")
+		if err != nil {
+			t.Skip("running as root without setpriv")
+		}
+		for dir := root; dir != filepath.Clean(os.TempDir()) && dir != "/"; dir = filepath.Dir(dir) {
+			if err := os.Chmod(dir, 0o755); err != nil {
+				t.Skipf("cannot open up %s: %v", dir, err)
+			}
+		}
+		cmd = exec.Command(setpriv, append([]string{"--reuid=65534", "--regid=65534", "--clear-groups"}, cmd.Args...)...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("listing an unreadable directory: %v\n%s", err, stderr.String())
+	}
+	files, err := parseRemoteListing(stdout.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := remoteFileNames(files)
+	sort.Strings(names)
+	if want := []string{"c.json", "ok/a.json"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listed %q, want %q", names, want)
+	}
+	denied, ok := parseDeniedPaths(stderr.String(), root)
+	if !ok || !reflect.DeepEqual(denied, []string{"secret"}) {
+		t.Errorf("denied = %q, %v from %q", denied, ok, stderr.String())
+	}
+}
+
+func TestMirrorKeepsUnreadableDir(t *testing.T) {
+	dest := t.TempDir()
+	for _, rel := range []string{"c.json", "gone.json", "ok/a.json", "secret/b.json", "secret/deep/d.json"} {
+		p := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// What the listing returns when secret/ cannot be read for now.
+	src := ArtifactSource{Path: "/remote/out", Patterns: []string{`\.json$`}}
+	listed := []remoteFile{{Rel: "c.json"}, {Rel: "ok/a.json"}}
+	denied := []string{"secret"}
+	var out bytes.Buffer
+	stale, err := staleArtifacts(&out, dest, src, listed, denied, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"gone.json"}; !reflect.DeepEqual(stale, want) {
+		t.Errorf("stale = %q, want %q", stale, want)
+	}
+
+	src.Flatten = true
+	if stale, err := staleArtifacts(&out, dest, src, listed, denied, false); err != nil || stale != nil {
+		t.Errorf("flattened source: stale = %q, %v; want nothing deleted", stale, err)
+	}
+}
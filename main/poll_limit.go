@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Experiments submitted together poll together: fifteen monitors on a 30s
+// interval would open fifteen ssh sessions to the login node at once, every
+// 30 seconds. Each monitor's sleep is jittered so they drift apart, and
+// status queries in one process take a slot per host, max_concurrent_polls
+// of them, so no host sees more than that many at a time.
+
+// pollJitter is how far a monitor's sleep strays from its interval, either
+// way, as a fraction of it.
+const pollJitter = 0.15
+
+// pollRand returns a number in [0, 1); tests replace it.
+var pollRand = rand.Float64
+
+// jitterInterval is d give or take pollJitter of it.
+func jitterInterval(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (1 + pollJitter*(2*pollRand()-1)))
+}
+
+// defaultMaxConcurrentPolls is how many status queries run on one host at a
+// time unless max_concurrent_polls in the config says otherwise.
+const defaultMaxConcurrentPolls = 4
+
+// remotePolls limits the status queries of this process; finishGlobalOptions
+// sets it from the config.
+var remotePolls = newPollLimiter(defaultMaxConcurrentPolls)
+
+// configMaxConcurrentPolls reads max_concurrent_polls.
+func configMaxConcurrentPolls(cfg *Config) (int, error) {
+	switch {
+	case cfg.MaxConcurrentPolls == nil:
+		return defaultMaxConcurrentPolls, nil
+	case *cfg.MaxConcurrentPolls < 1:
+		return 0, fmt.Errorf("invalid max_concurrent_polls %d (must be at least 1)", *cfg.MaxConcurrentPolls)
+	}
+	return int(*cfg.MaxConcurrentPolls), nil
+}
+
+// pollLimiter is a counting semaphore per host.
+type pollLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newPollLimiter(limit int) *pollLimiter {
+	return &pollLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// acquire waits for a free slot on remote's host and returns the func that
+// frees it again.
+func (l *pollLimiter) acquire(remote string) func() {
+	_, host, ok := strings.Cut(remote, "@")
+	if !ok {
+		host = remote
+	}
+	l.mu.Lock()
+	slots, found := l.slots[host]
+	if !found {
+		slots = make(chan struct{}, l.limit)
+		l.slots[host] = slots
+	}
+	l.mu.Unlock()
+	slots <- struct{}{}
+	return func() { <-slots }
+}
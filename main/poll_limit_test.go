@@ -0,0 +1,125 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJitterInterval(t *testing.T) {
+	saved := pollRand
+	t.Cleanup(func() { pollRand = saved })
+
+	lo, hi := 25500*time.Millisecond, 34500*time.Millisecond
+	for _, r := range []float64{0, 0.5, 0.9999999} {
+		pollRand = func() float64 { return r }
+		if d := jitterInterval(30 * time.Second); d < lo || d > hi {
+			t.Errorf("rand %v: jitterInterval(30s) = %s, want within [%s, %s]", r, d, lo, hi)
+		}
+	}
+	pollRand = saved
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		d := jitterInterval(30 * time.Second)
+		if d < lo || d > hi {
+			t.Fatalf("jitterInterval(30s) = %s, want within [%s, %s]", d, lo, hi)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 100 {
+		t.Errorf("only %d distinct intervals in 1000", len(seen))
+	}
+}
+
+// slowExecutor takes a while to start each command, counting how many
+// start at once, and answers squeue for job 42.
+type slowExecutor struct {
+	inflight, peak atomic.Int32
+}
+
+func (e *slowExecutor) Command(remote string, _ sshHostOptions, args ...string) *loggedCmd {
+	n := e.inflight.Add(1)
+	for {
+		peak := e.peak.Load()
+		if n <= peak || e.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	e.inflight.Add(-1)
+	return runCommand("sh", "-c", "echo '42 RUNNING'")
+}
+
+func (e *slowExecutor) Upload(local, remote string, _ sshHostOptions, path string) error { return nil }
+
+func TestPollLimiterPerHost(t *testing.T) {
+	savedExec, savedPolls := remoteExecutor, remotePolls
+	t.Cleanup(func() { remoteExecutor, remotePolls = savedExec, savedPolls })
+	useTestMux(t, nil)
+
+	poll := func(limit int, remotes ...string) int32 {
+		t.Helper()
+		exec := &slowExecutor{}
+		remoteExecutor = exec
+		remotePolls = newPollLimiter(limit)
+		var wg sync.WaitGroup
+		for _, remote := range remotes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				states, err := batchJobStatuses(remote, sshHostOptions{}, "", []string{"42"})
+				if err != nil || states["42"].Status != "RUNNING" {
+					t.Errorf("%s: %v, %v", remote, states, err)
+				}
+			}()
+		}
+		wg.Wait()
+		return exec.peak.Load()
+	}
+
+	if peak := poll(1, "u@login", "v@login", "u@login", "u@login", "w@login"); peak != 1 {
+		t.Errorf("max_concurrent_polls 1: %d queries at once on one host", peak)
+	}
+	if peak := poll(2, "u@login", "u@login", "u@login", "u@login", "u@login", "u@login"); peak != 2 {
+		t.Errorf("max_concurrent_polls 2: %d queries at once on one host", peak)
+	}
+	if peak := poll(1, "u@login1", "u@login2", "u@login3"); peak != 3 {
+		t.Errorf("max_concurrent_polls 1 on three hosts: %d queries at once, want 3", peak)
+	}
+}
+
+func TestConfigMaxConcurrentPolls(t *testing.T) {
+	tests := []struct {
+		config string
+		want   int
+		err    string
+	}{
+		{"defaults:\n  remote: u@h\n", defaultMaxConcurrentPolls, ""},
+		{"max_concurrent_polls: 2\n", 2, ""},
+		{"max_concurrent_polls: \"3\"\n", 3, ""},
+		{"max_concurrent_polls: 0\n", 0, "must be at least 1"},
+	}
+	for _, tt := range tests {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("EXP_HOME", filepath.Join(home, "exp"))
+		writeConfigFiles(t, home, map[string]string{"exp/config.yaml": tt.config})
+		cfg, err := loadConfig()
+		if err != nil {
+			t.Fatalf("%q: %v", tt.config, err)
+		}
+		got, err := configMaxConcurrentPolls(cfg)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: err = %v, want %q", tt.config, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: %d, %v, want %d", tt.config, got, err, tt.want)
+		}
+	}
+}
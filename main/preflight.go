@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Before submitting, exp run asks the remote for its hostname, the git
+// commit and branch of each candidate directory, and whether the script and
+// log directory exist. It does so in one ssh session (one 2FA prompt on a
+// cluster without connection sharing) running preflightScript, whose output
+// is a series of sections:
+//
+//	@@exp:hostname
+//	login-01
+//	@@exp:git /home/me/project
+//	3f5a0690c1d2...
+//	main
+//	exit 0
+//	@@exp:exists /home/me/project/run.sbatch
+//	yes
+//	@@exp:end
+//
+// Anything before the first section, such as a login banner, is ignored.
+
+const preflightMarker = "@@exp:"
+
+// preflightScript returns the bash script that reports on gitDirs and paths.
+func preflightScript(gitDirs, paths []string) string {
+	var b strings.Builder
+	header := func(section string) {
+		fmt.Fprintf(&b, "printf '%%s\\n' %s\n", shellQuote(preflightMarker+section))
+	}
+	header("hostname")
+	b.WriteString("hostname\n")
+	for _, dir := range gitDirs {
+		header("git " + dir)
+		fmt.Fprintf(&b, "(cd %s && env GIT_DISCOVERY_ACROSS_FILESYSTEM=1 git rev-parse HEAD --abbrev-ref HEAD) 2>&1\n", shellQuote(dir))
+		b.WriteString("echo \"exit $?\"\n")
+	}
+	for _, path := range paths {
+		header("exists " + path)
+		fmt.Fprintf(&b, "if [ -e %s ]; then echo yes; else echo no; fi\n", shellQuote(path))
+	}
+	header("end")
+	return b.String()
+}
+
+// preflightSections splits preflight output into its sections' lines, keyed
+// by their headers ("hostname", "git DIR", "exists PATH"). Output without the
+// end section, from a session cut short, is an error.
+func preflightSections(output string) (map[string][]string, error) {
+	sections := make(map[string][]string)
+	current, ended := "", false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if name, ok := strings.CutPrefix(line, preflightMarker); ok {
+			if name == "end" {
+				ended = true
+				break
+			}
+			current = name
+			sections[current] = nil
+			continue
+		}
+		if current != "" && line != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	if !ended {
+		return nil, fmt.Errorf("remote preflight output ended early")
+	}
+	return sections, nil
+}
+
+// getRemoteGitInfo returns the commit and branch preflight output reports
+// for gitDir.
+func getRemoteGitInfo(output, gitDir string) (commit, branch string, err error) {
+	sections, err := preflightSections(output)
+	if err != nil {
+		return "", "", err
+	}
+	lines, ok := sections["git "+gitDir]
+	if !ok {
+		return "", "", fmt.Errorf("no git section for %s", gitDir)
+	}
+	if len(lines) == 0 {
+		return "", "", fmt.Errorf("git in %s: no exit status", gitDir)
+	}
+	status, ok := strings.CutPrefix(lines[len(lines)-1], "exit ")
+	if !ok {
+		return "", "", fmt.Errorf("git in %s: no exit status", gitDir)
+	}
+	lines = lines[:len(lines)-1]
+	if code, err := strconv.Atoi(status); err != nil || code != 0 {
+		return "", "", fmt.Errorf("git in %s exited %s: %s", gitDir, status, strings.Join(lines, " "))
+	}
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("git in %s: unexpected output %q", gitDir, strings.Join(lines, "\n"))
+	}
+	return lines[0], lines[1], nil
+}
+
+// remotePreflight is what the preflight learned.
+type remotePreflight struct {
+	Output   string // the raw output, for getRemoteGitInfo
+	Hostname string
+	Exists   map[string]bool
+}
+
+// runPreflight runs preflightScript on remote.
+func runPreflight(remote string, sshOpts sshHostOptions, gitDirs, paths []string) (*remotePreflight, error) {
+	cmd := sshCommand(remote, sshOpts, "bash", "-lc", shellQuote(preflightScript(gitDirs, paths)))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w (stderr: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return parsePreflight(stdout.String())
+}
+
+func parsePreflight(output string) (*remotePreflight, error) {
+	sections, err := preflightSections(output)
+	if err != nil {
+		return nil, err
+	}
+	p := &remotePreflight{Output: output, Exists: make(map[string]bool)}
+	if lines := sections["hostname"]; len(lines) > 0 {
+		p.Hostname = lines[0]
+	}
+	for name, lines := range sections {
+		if path, ok := strings.CutPrefix(name, "exists "); ok {
+			p.Exists[path] = len(lines) > 0 && lines[0] == "yes"
+		}
+	}
+	return p, nil
+}
+
+// preflightRoundTrips is how many ssh sessions the preflight replaces: two
+// git commands for each directory tried, up to the one that answered, and
+// one per existence check.
+func preflightRoundTrips(gitDirsTried, paths int) int {
+	return 2*gitDirsTried + paths
+}
+
+// lookupRemoteGitInfo reads gitDir's commit and branch with a session per
+// git command, for when the combined preflight failed.
+func lookupRemoteGitInfo(remote string, sshOpts sshHostOptions, gitDir string) (commit, branch string, err error) {
+	if remote == "" {
+		return "", "", fmt.Errorf("remote host is required for remote git lookup")
+	}
+	if gitDir == "" {
+		return "", "", fmt.Errorf("git directory is required for remote git lookup")
+	}
+	fmt.Printf("Running remote git commands in %s:%s\n", remote, gitDir)
+	run := func(gitCmd string) (string, error) {
+		cmdStr := fmt.Sprintf("hostname >&2 && cd %s && env GIT_DISCOVERY_ACROSS_FILESYSTEM=1 %s", shellQuote(gitDir), gitCmd)
+		fmt.Printf("  ssh %s \"bash -lc %s\"\n", remote, shellQuote(cmdStr))
+		cmd := sshCommand(remote, sshOpts, "bash", "-lc", cmdStr)
+		var stdoutBuf, stderrBuf bytes.Buffer
+		cmd.Stdout = &stdoutBuf
+		cmd.Stderr = &stderrBuf
+		err := cmd.Run()
+		if stderrBuf.Len() > 0 {
+			fmt.Print(stderrBuf.String())
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %v (stdout: %s stderr: %s)", gitCmd, err,
+				strings.TrimSpace(stdoutBuf.String()), strings.TrimSpace(stderrBuf.String()))
+		}
+		return strings.TrimSpace(stdoutBuf.String()), nil
+	}
+	commit, err = run("git rev-parse HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Printf("Remote git commit from %s:%s = %s\n", remote, gitDir, commit)
+	branch, err = run("git rev-parse --abbrev-ref HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Printf("Remote git branch from %s:%s = %s\n", remote, gitDir, branch)
+	return commit, branch, nil
+}
+
+// remoteGitInfo returns the commit and branch of the first of gitDirs that is
+// a git checkout, from p, or by asking remote directly when p is nil. It
+// also returns how many directories it tried.
+func remoteGitInfo(remote string, sshOpts sshHostOptions, p *remotePreflight, gitDirs []string) (commit, branch string, tried int) {
+	for _, dir := range gitDirs {
+		tried++
+		var err error
+		if p != nil {
+			commit, branch, err = getRemoteGitInfo(p.Output, dir)
+		} else {
+			commit, branch, err = lookupRemoteGitInfo(remote, sshOpts, dir)
+		}
+		if err == nil {
+			fmt.Printf("Remote git lookup succeeded at %s:%s (commit=%s branch=%s)\n", remote, dir, commit, branch)
+			return commit, branch, tried
+		}
+		fmt.Printf("Warning: unable to read remote git info from %s: %v\n", dir, err)
+	}
+	return "", "", tried
+}
+
+// checkRemotePaths fails when the preflight found the script or log
+// directory missing: sbatch would refuse the first and the job would lose
+// its output to the second.
+func checkRemotePaths(remote string, p *remotePreflight, script, logDir string) error {
+	if !p.Exists[script] {
+		return fmt.Errorf("script %s does not exist on %s", script, remote)
+	}
+	if !p.Exists[logDir] {
+		return fmt.Errorf("log directory %s does not exist on %s; create it first (Slurm does not, and the job's output would be lost)", logDir, remote)
+	}
+	return nil
+}
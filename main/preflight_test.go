@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// preflightTranscript is a preflight from a cluster whose login shell prints
+// a banner, for a script directory that is a checkout and an artifact
+// directory that is not.
+const preflightTranscript = `Welcome to the cluster. Scratch is purged after 30 days.
+@@exp:hostname
+login-02.cluster
+@@exp:git /home/me/project/scripts
+3f5a0690c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6
+main
+exit 0
+@@exp:git /scratch/me/results
+fatal: not a git repository (or any parent up to mount point /)
+exit 128
+@@exp:exists /home/me/project/scripts/train.sbatch
+yes
+@@exp:exists /scratch/me/logs
+no
+@@exp:end
+`
+
+func TestGetRemoteGitInfo(t *testing.T) {
+	commit, branch, err := getRemoteGitInfo(preflightTranscript, "/home/me/project/scripts")
+	if err != nil || commit != "3f5a0690c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6" || branch != "main" {
+		t.Errorf("checkout: %q %q %v", commit, branch, err)
+	}
+	if _, _, err := getRemoteGitInfo(preflightTranscript, "/scratch/me/results"); err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("not a checkout: %v", err)
+	}
+	if _, _, err := getRemoteGitInfo(preflightTranscript, "/elsewhere"); err == nil {
+		t.Error("a directory the preflight did not look at has git info")
+	}
+	cut := preflightTranscript[:strings.Index(preflightTranscript, "@@exp:exists")]
+	if _, _, err := getRemoteGitInfo(cut, "/home/me/project/scripts"); err == nil {
+		t.Error("output cut short parsed")
+	}
+
+	p, err := parsePreflight(preflightTranscript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Hostname != "login-02.cluster" {
+		t.Errorf("hostname = %q", p.Hostname)
+	}
+	err = checkRemotePaths("u@h", p, "/home/me/project/scripts/train.sbatch", "/scratch/me/logs")
+	if err == nil || !strings.Contains(err.Error(), "log directory /scratch/me/logs") {
+		t.Errorf("checkRemotePaths = %v", err)
+	}
+}
+
+func TestRunPreflight(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	local := &localExecutor{}
+	remoteExecutor = local
+
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "my repo")
+	os.Mkdir(repo, 0o755)
+	git := func(args ...string) {
+		cmd := runCommand("git", append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "exp")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	script := filepath.Join(repo, "run.sbatch")
+	os.WriteFile(script, nil, 0o644)
+
+	p, err := runPreflight("u@h", sshHostOptions{}, []string{repo, dir}, []string{script, filepath.Join(dir, "logs")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local.calls) != 1 {
+		t.Errorf("%d ssh sessions, want 1", len(local.calls))
+	}
+	out, _ := runCommand("hostname").Output()
+	if want := strings.TrimSpace(string(out)); p.Hostname != want {
+		t.Errorf("hostname = %q, want %q", p.Hostname, want)
+	}
+	commit, branch, tried := remoteGitInfo("u@h", sshHostOptions{}, p, []string{dir, repo})
+	if len(commit) != 40 || branch != "exp" || tried != 2 {
+		t.Errorf("remoteGitInfo = %q %q %d", commit, branch, tried)
+	}
+	if !p.Exists[script] || p.Exists[filepath.Join(dir, "logs")] {
+		t.Errorf("exists = %v", p.Exists)
+	}
+}
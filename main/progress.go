@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transferTally is what one transfer actually moved. Files is -1 when
+// rsync's --stats block could not be read, and Bytes is -1 when the backend
+// does not report it.
+type transferTally struct {
+	Files int
+	Bytes int64
+}
+
+// add sums two tallies; an unknown figure makes the total unknown.
+func (t transferTally) add(o transferTally) transferTally {
+	if t.Files < 0 || o.Files < 0 {
+		t.Files = -1
+	} else {
+		t.Files += o.Files
+	}
+	if t.Bytes < 0 || o.Bytes < 0 {
+		t.Bytes = -1
+	} else {
+		t.Bytes += o.Bytes
+	}
+	return t
+}
+
+// rsyncTransferredBytesRe matches the --stats line with the size of the
+// files rsync transferred.
+var rsyncTransferredBytesRe = regexp.MustCompile(`(?m)^Total transferred file size: ([\d,]+) bytes`)
+
+// parseRsyncStats reads the transferred file count and size from rsync
+// --stats output; ok is false when the file count is missing.
+func parseRsyncStats(out string) (transferTally, bool) {
+	files, ok := parseRsyncTransferred(out)
+	if !ok {
+		return transferTally{Files: -1, Bytes: -1}, false
+	}
+	t := transferTally{Files: files, Bytes: -1}
+	if m := rsyncTransferredBytesRe.FindStringSubmatch(out); m != nil {
+		if n, err := strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64); err == nil {
+			t.Bytes = n
+		}
+	}
+	return t, true
+}
+
+// localRsyncProgress2 caches whether the local rsync understands
+// --info=progress2 (3.1.0 and later).
+var localRsyncProgress2 = sync.OnceValue(func() bool {
+	out, err := runCommand("rsync", "--version").Output()
+	return err == nil && rsyncHasProgress2(string(out))
+})
+
+var rsyncVersionRe = regexp.MustCompile(`version (\d+)\.(\d+)`)
+
+func rsyncHasProgress2(version string) bool {
+	m := rsyncVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major > 3 || major == 3 && minor >= 1
+}
+
+// rsyncProgressArgs asks rsync for whole-transfer progress, or per-file
+// progress from an rsync older than 3.1.
+func rsyncProgressArgs() []string {
+	if localRsyncProgress2() {
+		return []string{"--info=progress2"}
+	}
+	return []string{"--progress"}
+}
+
+// rsyncProgressLine is one progress update. --info=progress2 reports the
+// whole transfer and --progress the current file; Elapsed is the time so
+// far, or the estimate left while Percent is under 100.
+type rsyncProgressLine struct {
+	Bytes   int64
+	Percent int
+	Rate    string
+	Elapsed string
+	Done    int // files transferred so far, -1 when not reported
+	ToCheck int
+	Total   int
+}
+
+// rsyncProgressRe matches both variants: "xfr#/to-chk" (3.1 and later) and
+// "xfer#/to-check" (older), with "ir-chk" while the file list is still
+// growing.
+var rsyncProgressRe = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%\s+(\S+/s)\s+(\d+:\d\d:\d\d)(?:\s+\((?:xfr|xfer)#(\d+),\s*(?:to-chk|to-check|ir-chk)=(\d+)/(\d+)\))?\s*$`)
+
+func parseRsyncProgress(line string) (rsyncProgressLine, bool) {
+	m := rsyncProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		return rsyncProgressLine{}, false
+	}
+	p := rsyncProgressLine{Rate: m[3], Elapsed: m[4], Done: -1}
+	p.Bytes, _ = strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64)
+	p.Percent, _ = strconv.Atoi(m[2])
+	if m[5] != "" {
+		p.Done, _ = strconv.Atoi(m[5])
+		p.ToCheck, _ = strconv.Atoi(m[6])
+		p.Total, _ = strconv.Atoi(m[7])
+	}
+	return p, true
+}
+
+func (p rsyncProgressLine) String() string {
+	timing := "ETA " + p.Elapsed
+	if p.Percent >= 100 {
+		timing = "in " + p.Elapsed
+	}
+	s := fmt.Sprintf("%3d%%  %s  %s  %s", p.Percent, formatBytes(p.Bytes), p.Rate, timing)
+	if p.Done >= 0 {
+		s += fmt.Sprintf("  (%d file(s) done, %d of %d left to check)", p.Done, p.ToCheck, p.Total)
+	}
+	return s
+}
+
+// progressLogInterval is how often progress is printed when the output is
+// not a terminal.
+const progressLogInterval = 30 * time.Second
+
+// rsyncProgress sits between rsync's stdout and the fetch output. Progress
+// updates are redrawn in place on a terminal, or printed every
+// progressLogInterval otherwise; everything else passes through.
+type rsyncProgress struct {
+	out  io.Writer
+	tty  bool
+	now  func() time.Time
+	last time.Time
+	buf  []byte
+	// current is the progress line on the terminal, kept at the bottom
+	// while other output scrolls past it.
+	current string
+	// done is the latest file count the progress lines reported.
+	done int
+}
+
+func newRsyncProgress(w io.Writer) *rsyncProgress {
+	return &rsyncProgress{
+		out: w,
+		tty: w == io.Writer(os.Stdout) && isTerminal(os.Stdout),
+		now: time.Now,
+	}
+}
+
+func (p *rsyncProgress) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			return len(b), nil
+		}
+		line := string(p.buf[:i])
+		p.buf = p.buf[i+1:]
+		p.line(line)
+	}
+}
+
+func (p *rsyncProgress) line(s string) {
+	if pr, ok := parseRsyncProgress(s); ok {
+		if pr.Done >= 0 {
+			p.done = pr.Done
+		}
+		switch {
+		case p.tty:
+			p.current = pr.String()
+			fmt.Fprintf(p.out, "\r\033[K%s", p.current)
+		case p.last.IsZero() || p.now().Sub(p.last) >= progressLogInterval:
+			fmt.Fprintf(p.out, "Progress: %s\n", pr)
+			p.last = p.now()
+		}
+		return
+	}
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	if p.current == "" {
+		fmt.Fprintln(p.out, s)
+		return
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s\n%s", s, p.current)
+}
+
+// transferred is what the progress lines say rsync finished, for an
+// attempt that died before printing its --stats block. Only the file count
+// is known: --progress reports bytes of the current file alone.
+func (p *rsyncProgress) transferred() transferTally {
+	return transferTally{Files: p.done, Bytes: -1}
+}
+
+// finish prints whatever rsync wrote without a final newline.
+func (p *rsyncProgress) finish() {
+	if len(p.buf) > 0 {
+		p.line(string(p.buf))
+		p.buf = nil
+	}
+	if p.current != "" {
+		fmt.Fprintln(p.out)
+		p.current = ""
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRsyncProgress(t *testing.T) {
+	cases := []struct {
+		line string
+		want rsyncProgressLine
+	}{
+		// --info=progress2, rsync 3.1 and later.
+		{"  1,234,567  45%   12.34MB/s    0:00:10 (xfr#3, to-chk=10/20)",
+			rsyncProgressLine{Bytes: 1234567, Percent: 45, Rate: "12.34MB/s", Elapsed: "0:00:10", Done: 3, ToCheck: 10, Total: 20}},
+		{"     81,920   7%   80.00kB/s    0:00:12 (xfr#1, ir-chk=1005/1012)",
+			rsyncProgressLine{Bytes: 81920, Percent: 7, Rate: "80.00kB/s", Elapsed: "0:00:12", Done: 1, ToCheck: 1005, Total: 1012}},
+		{"          0   0%    0.00kB/s    0:00:00  ",
+			rsyncProgressLine{Rate: "0.00kB/s", Elapsed: "0:00:00", Done: -1}},
+		// --progress, older rsync: one file at a time.
+		{"      32,768 100%   31.25MB/s    0:00:00 (xfer#1, to-check=1/3)",
+			rsyncProgressLine{Bytes: 32768, Percent: 100, Rate: "31.25MB/s", Elapsed: "0:00:00", Done: 1, ToCheck: 1, Total: 3}},
+		{"     4194304  62%    4.00MB/s    0:00:01",
+			rsyncProgressLine{Bytes: 4194304, Percent: 62, Rate: "4.00MB/s", Elapsed: "0:00:01", Done: -1}},
+	}
+	for _, c := range cases {
+		got, ok := parseRsyncProgress(c.line)
+		if !ok || got != c.want {
+			t.Errorf("parseRsyncProgress(%q) = %+v, %v; want %+v", c.line, got, ok, c.want)
+		}
+	}
+	for _, line := range []string{"results/metrics.json", "sending incremental file list", "Number of files: 3"} {
+		if _, ok := parseRsyncProgress(line); ok {
+			t.Errorf("parseRsyncProgress(%q) should not match", line)
+		}
+	}
+}
+
+func TestParseRsyncStats(t *testing.T) {
+	out := "Number of files: 1,204 (reg: 1,200, dir: 4)\n" +
+		"Number of regular files transferred: 1,031\n" +
+		"Total file size: 9,876,543 bytes\n" +
+		"Total transferred file size: 1,234,567 bytes\n"
+	if got, ok := parseRsyncStats(out); !ok || got != (transferTally{Files: 1031, Bytes: 1234567}) {
+		t.Errorf("parseRsyncStats = %+v, %v", got, ok)
+	}
+	// rsync before 3.1 says "Number of files transferred".
+	if got, ok := parseRsyncStats("Number of files transferred: 2\n"); !ok || got != (transferTally{Files: 2, Bytes: -1}) {
+		t.Errorf("parseRsyncStats without sizes = %+v, %v", got, ok)
+	}
+	if got, ok := parseRsyncStats("sent 20 bytes  received 12 bytes\n"); ok || got.Files != -1 {
+		t.Errorf("parseRsyncStats without stats = %+v, %v", got, ok)
+	}
+
+	sum := transferTally{Files: 2, Bytes: 10}.add(transferTally{Files: 3, Bytes: -1})
+	if sum != (transferTally{Files: 5, Bytes: -1}) {
+		t.Errorf("add = %+v", sum)
+	}
+}
+
+func TestRsyncHasProgress2(t *testing.T) {
+	for version, want := range map[string]bool{
+		"rsync  version 3.2.7  protocol version 31": true,
+		"rsync  version 3.1.0  protocol version 31": true,
+		"rsync  version 3.0.9  protocol version 30": false,
+		"rsync  version 2.6.9  protocol version 29": false,
+		"openrsync: protocol version 29":            false,
+	} {
+		if got := rsyncHasProgress2(version); got != want {
+			t.Errorf("rsyncHasProgress2(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestRsyncProgressNotTerminal(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := &rsyncProgress{out: &out, now: func() time.Time { return now }}
+	update := func(pct int) {
+		fmt.Fprintf(p, "\r  %d  %d%%   1.00MB/s    0:00:05 (xfr#1, to-chk=1/2)", pct*1000, pct)
+	}
+	update(10)
+	now = now.Add(10 * time.Second)
+	update(20)
+	fmt.Fprint(p, "\rresults/a.json\n")
+	now = now.Add(progressLogInterval)
+	update(90)
+	p.finish()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 ||
+		!strings.HasPrefix(lines[0], "Progress:  10%") ||
+		lines[1] != "results/a.json" ||
+		!strings.HasPrefix(lines[2], "Progress:  90%") {
+		t.Errorf("progress output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultMetricsRecent is how many finished experiments keep per-id series
+// alongside every active one, so label cardinality stays bounded as the
+// database grows.
+const defaultMetricsRecent = 20
+
+// promSnapshot is everything one scrape reports, read from the local DB.
+type promSnapshot struct {
+	statusCounts map[string]int
+	tracked      []*Experiment
+	syncFailures int64
+	now          time.Time
+}
+
+func loadPromSnapshot(db *sql.DB, recent int, now time.Time) (promSnapshot, error) {
+	snap := promSnapshot{statusCounts: make(map[string]int), now: now}
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		return snap, err
+	}
+	// loadExperiments returns newest first, so the first finished experiments
+	// seen are the most recent ones.
+	terminal := 0
+	for _, exp := range exps {
+		status := strings.ToUpper(strings.TrimSpace(exp.JobStatus))
+		if status == "" {
+			status = "UNKNOWN"
+		}
+		snap.statusCounts[status]++
+		if isLiveStatus(exp.JobStatus) {
+			snap.tracked = append(snap.tracked, exp)
+		} else if terminal < recent {
+			snap.tracked = append(snap.tracked, exp)
+			terminal++
+		}
+	}
+	var failures sql.NullInt64
+	if err := db.QueryRow(`SELECT SUM(artifact_sync_failures) FROM experiments`).Scan(&failures); err != nil {
+		return snap, err
+	}
+	snap.syncFailures = failures.Int64
+	return snap, nil
+}
+
+// writePromMetrics renders snap in the Prometheus text exposition format.
+func writePromMetrics(w io.Writer, snap promSnapshot) error {
+	var b strings.Builder
+	b.WriteString("# HELP exp_experiments Number of experiments in the local DB by job status.\n")
+	b.WriteString("# TYPE exp_experiments gauge\n")
+	statuses := make([]string, 0, len(snap.statusCounts))
+	for st := range snap.statusCounts {
+		statuses = append(statuses, st)
+	}
+	sort.Strings(statuses)
+	for _, st := range statuses {
+		fmt.Fprintf(&b, "exp_experiments{status=\"%s\"} %d\n", promLabel(st), snap.statusCounts[st])
+	}
+
+	b.WriteString("# HELP exp_experiment_duration_seconds Wall time since submission, up to completion for finished experiments.\n")
+	b.WriteString("# TYPE exp_experiment_duration_seconds gauge\n")
+	for _, exp := range snap.tracked {
+		if exp.CreatedAt.IsZero() {
+			continue
+		}
+		end := snap.now
+		if !exp.CompletedAt.IsZero() {
+			end = exp.CompletedAt
+		}
+		fmt.Fprintf(&b, "exp_experiment_duration_seconds{id=\"%d\",name=\"%s\",status=\"%s\"} %.0f\n",
+			exp.ID, promLabel(exp.Name), promLabel(exp.JobStatus), end.Sub(exp.CreatedAt).Seconds())
+	}
+
+	b.WriteString("# HELP exp_artifact_last_sync_timestamp_seconds Unix time of the last successful artifact sync.\n")
+	b.WriteString("# TYPE exp_artifact_last_sync_timestamp_seconds gauge\n")
+	for _, exp := range snap.tracked {
+		if !exp.ArtifactLastSync.IsZero() {
+			fmt.Fprintf(&b, "exp_artifact_last_sync_timestamp_seconds{id=\"%d\"} %d\n", exp.ID, exp.ArtifactLastSync.Unix())
+		}
+	}
+
+	b.WriteString("# HELP exp_artifact_sync_failures_total Failed artifact syncs recorded in the local DB.\n")
+	b.WriteString("# TYPE exp_artifact_sync_failures_total counter\n")
+	fmt.Fprintf(&b, "exp_artifact_sync_failures_total %d\n", snap.syncFailures)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// promLabel escapes a label value per the exposition format.
+func promLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func (s *serveServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	snap, err := loadPromSnapshot(s.db, s.metricsRecent, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = writePromMetrics(w, snap)
+}
+
+// writePromTextfile writes the metrics for node_exporter's textfile
+// collector. The temp-then-rename keeps the collector from reading a
+// half-written file.
+func writePromTextfile(db *sql.DB, path string, recent int) error {
+	snap, err := loadPromSnapshot(db, recent, time.Now())
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".exp-metrics-*.prom")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writePromMetrics(tmp, snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromMetrics(t *testing.T) {
+	db := openTestDB(t)
+	running := insertTestExperiment(t, db, `quote"d`, "RUNNING", "")
+	for _, name := range []string{"old", "newer"} {
+		insertTestExperiment(t, db, name, "COMPLETED", "")
+	}
+	// Make "newer" the most recent finished experiment.
+	if _, err := db.Exec(`UPDATE experiments SET created_at = '2025-01-03T00:00:00Z', completed_at = '2025-01-03T01:00:00Z' WHERE name = 'newer'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordArtifactSync(db, running, nil, nil, "rsync failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordArtifactSync(db, running, nil, nil, "rsync failed again"); err != nil {
+		t.Fatal(err)
+	}
+	synced := time.Unix(1735790000, 0).UTC()
+	if err := recordArtifactSync(db, running, &synced, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 1, 2, 4, 4, 5, 0, time.UTC)
+	snap, err := loadPromSnapshot(db, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writePromMetrics(&buf, snap); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`exp_experiments{status="COMPLETED"} 2`,
+		`exp_experiments{status="RUNNING"} 1`,
+		`exp_experiment_duration_seconds{id="1",name="quote\"d",status="RUNNING"} 3600`,
+		`exp_experiment_duration_seconds{id="3",name="newer",status="COMPLETED"} 3600`,
+		`exp_artifact_last_sync_timestamp_seconds{id="1"} 1735790000`,
+		`exp_artifact_sync_failures_total 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `name="old"`) {
+		t.Errorf("--metrics-recent 1 should drop the older finished experiment:\n%s", out)
+	}
+
+	path := filepath.Join(t.TempDir(), "exp.prom")
+	if err := writePromTextfile(db, path, 1); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "exp_artifact_sync_failures_total 2") {
+		t.Fatalf("textfile = %q, %v", data, err)
+	}
+}
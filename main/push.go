@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultPushConfirmOver = 50
+
+// pushGroup is a set of files sharing one local root, sent with a single
+// rsync --files-from invocation.
+type pushGroup struct {
+	root  string
+	files []string
+	bytes int64
+}
+
+type pushRecord struct {
+	PushedAt   string
+	RemotePath string
+	Files      int
+	Bytes      int64
+}
+
+// exp push <id> LOCAL... [--remote-path SUBDIR] [--exclude REGEX] [--dry-run] [--yes]
+func cmdPush(args []string) error {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	var (
+		remotePath  string
+		excludes    multiStringFlag
+		dryRun      bool
+		yes         bool
+		confirmOver int
+	)
+	fs.StringVar(&remotePath, "remote-path", "", "Remote directory to push into: absolute, or relative to the recorded artifact remote (default: the artifact remote)")
+	fs.Var(&excludes, "exclude", "Regex applied to local relative paths; matching files are skipped; may be repeated")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only list files that would be pushed")
+	fs.BoolVar(&yes, "yes", false, "Push without prompting, however many files are selected")
+	fs.IntVar(&confirmOver, "confirm-over", defaultPushConfirmOver, "Ask for confirmation when more than this many files would be pushed")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp push <id> LOCAL... [--remote-path SUBDIR] [--exclude REGEX] [--dry-run] [--yes]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return fmt.Errorf("experiment id and at least one local path are required")
+	}
+	idStr, locals := positional[0], positional[1:]
+
+	excludeRes, err := compilePatterns(excludes.Values())
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if exp.Remote == "" {
+		return fmt.Errorf("experiment %s has empty remote host", idStr)
+	}
+	target, err := resolvePushTarget(exp, remotePath)
+	if err != nil {
+		return err
+	}
+
+	groups, err := collectPushFiles(locals, excludeRes)
+	if err != nil {
+		return err
+	}
+	totalFiles, totalBytes := 0, int64(0)
+	for _, g := range groups {
+		for _, f := range g.files {
+			fmt.Printf("  %s\n", path.Join(target, f))
+		}
+		totalFiles += len(g.files)
+		totalBytes += g.bytes
+	}
+	if totalFiles == 0 {
+		fmt.Println("No files to push.")
+		return nil
+	}
+	fmt.Printf("%d file(s), %s -> %s:%s\n", totalFiles, formatBytes(totalBytes), exp.Remote, target)
+	if dryRun {
+		return nil
+	}
+	if !yes && totalFiles > confirmOver && !confirm(fmt.Sprintf("Push %d files to %s:%s?", totalFiles, exp.Remote, target)) {
+		return fmt.Errorf("push cancelled")
+	}
+
+	for _, g := range groups {
+		if err := rsyncPush(exp.Remote, exp.SSH, g.root, g.files, target); err != nil {
+			return err
+		}
+	}
+	if err := recordPush(db, exp.ID, target, totalFiles, totalBytes); err != nil {
+		return fmt.Errorf("record push: %w", err)
+	}
+	fmt.Printf("Pushed %d file(s) to %s:%s\n", totalFiles, exp.Remote, target)
+	return nil
+}
+
+// resolvePushTarget applies the same absolute-path rule as --artifact-remote:
+// rsync needs an absolute remote directory to address files precisely.
+func resolvePushTarget(exp *Experiment, remotePath string) (string, error) {
+	base := exp.ArtifactRemote
+	if base == "" {
+		if sources := exp.EffectiveArtifactSources(); len(sources) > 0 {
+			base = sources[0].Path
+		}
+	}
+	target := remotePath
+	switch {
+	case target == "":
+		target = base
+	case !strings.HasPrefix(target, "/"):
+		if base == "" {
+			return "", fmt.Errorf("remote-path %q is relative but experiment %d has no recorded artifact remote", remotePath, exp.ID)
+		}
+		target = path.Join(base, target)
+	}
+	if target == "" {
+		return "", fmt.Errorf("experiment %d has no recorded artifact remote; pass an absolute --remote-path", exp.ID)
+	}
+	if !strings.HasPrefix(target, "/") {
+		return "", fmt.Errorf("remote path %q must be absolute so rsync can address files precisely", target)
+	}
+	return path.Clean(target), nil
+}
+
+// collectPushFiles expands each local argument into files relative to its
+// parent directory, so "configs/" lands as TARGET/configs/... and a single
+// file as TARGET/<name>, matching rsync's behaviour without a trailing slash.
+func collectPushFiles(locals []string, excludes []*regexp.Regexp) ([]pushGroup, error) {
+	byRoot := make(map[string]*pushGroup)
+	var order []string
+	for _, local := range locals {
+		abs, err := expandLocalPath(local)
+		if err != nil {
+			return nil, fmt.Errorf("local path %s: %w", local, err)
+		}
+		root := filepath.Dir(abs)
+		g := byRoot[root]
+		if g == nil {
+			g = &pushGroup{root: root}
+			byRoot[root] = g
+			order = append(order, root)
+		}
+		err = filepath.WalkDir(abs, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			for _, re := range excludes {
+				if re.MatchString(rel) {
+					return nil
+				}
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			g.files = append(g.files, rel)
+			g.bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	groups := make([]pushGroup, 0, len(order))
+	for _, root := range order {
+		groups = append(groups, *byRoot[root])
+	}
+	return groups, nil
+}
+
+func rsyncPush(remote string, sshOpts sshHostOptions, root string, files []string, target string) error {
+	if out, err := sshCommand(remote, sshOpts, "mkdir", "-p", shellQuote(target)).CombinedOutput(); err != nil {
+		return fmt.Errorf("create %s:%s: %v (output: %s)", remote, target, err, strings.TrimSpace(string(out)))
+	}
+	dest := fmt.Sprintf("%s:%s/", remote, strings.TrimRight(target, "/"))
+	args := []string{"-av", "--files-from=-", root + "/", dest}
+	cmd := runCommand("rsync", append(rsyncSSHArgs(sshOpts), args...)...)
+	cmd.Stdin = strings.NewReader(strings.Join(files, "\n") + "\n")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	fmt.Printf("Starting rsync: rsync %s\n", strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rsync failed: %w", err)
+	}
+	return nil
+}
+
+func recordPush(db *sql.DB, id int64, remotePath string, files int, bytes int64) error {
+	_, err := db.Exec(`INSERT INTO pushes (experiment_id, pushed_at, remote_path, file_count, bytes) VALUES (?, ?, ?, ?, ?)`,
+		id, time.Now().UTC().Format(time.RFC3339), remotePath, files, bytes)
+	return err
+}
+
+func loadPushes(db *sql.DB, id int64) ([]pushRecord, error) {
+	rows, err := db.Query(`SELECT pushed_at, remote_path, file_count, bytes FROM pushes WHERE experiment_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []pushRecord
+	for rows.Next() {
+		var p pushRecord
+		if err := rows.Scan(&p.PushedAt, &p.RemotePath, &p.Files, &p.Bytes); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestResolvePushTarget(t *testing.T) {
+	exp := &Experiment{ID: 3, ArtifactRemote: "/projects/results"}
+	for remotePath, want := range map[string]string{
+		"":            "/projects/results",
+		"configs":     "/projects/results/configs",
+		"/scratch/x/": "/scratch/x",
+	} {
+		got, err := resolvePushTarget(exp, remotePath)
+		if err != nil || got != want {
+			t.Errorf("resolvePushTarget(%q) = %q, %v; want %q", remotePath, got, err, want)
+		}
+	}
+	if _, err := resolvePushTarget(&Experiment{ID: 4}, "configs"); err == nil {
+		t.Error("relative remote-path without artifact remote: expected error")
+	}
+}
+
+func TestCollectPushFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"configs/a.yaml", "configs/b.yaml", "configs/tmp.swp", "notes.txt"} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groups, err := collectPushFiles([]string{filepath.Join(dir, "configs"), filepath.Join(dir, "notes.txt")},
+		[]*regexp.Regexp{regexp.MustCompile(`\.swp$`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].root != dir || groups[0].bytes != 3 {
+		t.Fatalf("groups = %+v", groups)
+	}
+	want := []string{"configs/a.yaml", "configs/b.yaml", "notes.txt"}
+	if len(groups[0].files) != len(want) {
+		t.Fatalf("files = %v", groups[0].files)
+	}
+	for i := range want {
+		if groups[0].files[i] != want[i] {
+			t.Fatalf("files = %v, want %v", groups[0].files, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// experimentFilter selects experiments in SQL rather than after loading
+// them all, so each condition can use one of the experiments indexes.
+// Zero fields select everything.
+type experimentFilter struct {
+	Statuses []string // job_status is one of these
+	Live     bool     // not finished yet, as isLiveStatus decides
+	HasJob   bool     // has a remote job to poll (remote and job_id set)
+	Name     string
+	// NameContains matches names case-insensitively (ASCII only, as SQLite's
+	// LIKE does). It reads the whole name index rather than the table.
+	NameContains string
+	JobID        string
+	Remote       string
+}
+
+// where builds the clause and arguments for loadExperiments. Statuses are
+// stored upper-case (updateExperimentStatus normalizes them), so they are
+// compared exactly.
+func (f experimentFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	in := func(col string, values []string) {
+		marks := make([]string, len(values))
+		for i, v := range values {
+			marks[i] = "?"
+			args = append(args, v)
+		}
+		conds = append(conds, col+" IN ("+strings.Join(marks, ", ")+")")
+	}
+	if len(f.Statuses) > 0 {
+		upper := make([]string, len(f.Statuses))
+		for i, s := range f.Statuses {
+			upper[i] = normalizeStatus(s)
+		}
+		in("job_status", upper)
+	}
+	if f.Live {
+		in("job_status", liveStatuses())
+	}
+	if f.HasJob {
+		conds = append(conds, "remote != ''", "job_id != ''")
+	}
+	if f.Name != "" {
+		conds = append(conds, "name = ?")
+		args = append(args, f.Name)
+	}
+	if f.NameContains != "" {
+		conds = append(conds, `name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(f.NameContains)+"%")
+	}
+	if f.JobID != "" {
+		conds = append(conds, "job_id = ?")
+		args = append(args, f.JobID)
+	}
+	if f.Remote != "" {
+		conds = append(conds, "remote = ?")
+		args = append(args, f.Remote)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// selectExperiments returns the experiments f selects, newest first.
+func selectExperiments(db *sql.DB, f experimentFilter) ([]*Experiment, error) {
+	where, args := f.where()
+	return loadExperiments(db, where, args...)
+}
+
+// liveStatuses are the stored statuses isLiveStatus accepts.
+func liveStatuses() []string {
+	return append([]string{""}, activeStates()...)
+}
+
+// normalizeStatus returns the bare state of status, e.g. CANCELLED for
+// "cancelled by 1234".
+func normalizeStatus(status string) string {
+	state, _ := splitSlurmState(status)
+	return state
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
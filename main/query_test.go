@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExperimentFilterWhere(t *testing.T) {
+	where, args := experimentFilter{Statuses: []string{"completed", " failed"}, NameContains: "100%_k", HasJob: true}.where()
+	if want := `job_status IN (?, ?) AND remote != '' AND job_id != '' AND name LIKE ? ESCAPE '\'`; where != want {
+		t.Errorf("where = %s\nwant %s", where, want)
+	}
+	if fmt.Sprint(args) != `[COMPLETED FAILED %100\%\_k%]` {
+		t.Errorf("args = %q", args)
+	}
+	if where, args := (experimentFilter{}).where(); where != "" || len(args) != 0 {
+		t.Errorf("empty filter = %q, %v", where, args)
+	}
+}
+
+// TestExperimentQueriesUseIndexes seeds a large table and checks that the
+// list and filter queries are answered through an index, not a table scan.
+func TestExperimentQueriesUseIndexes(t *testing.T) {
+	db := openTestDB(t)
+	const rows = 50000
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO experiments (name, remote, script_path, args, git_commit, git_branch, job_id, job_status,
+                                  log_path, created_at, artifact_remote, artifact_dest, artifact_pattern, artifact_last_error, config_snapshot)
+                             VALUES (?, ?, '/s.sbatch', '', '', '', ?, ?, '', ?, '', '', '', '', '')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := []string{"COMPLETED", "COMPLETED", "COMPLETED", "FAILED", "CANCELLED", "TIMEOUT", "COMPLETED", "COMPLETED", "COMPLETED", "RUNNING"}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < rows; i++ {
+		status := statuses[i%len(statuses)]
+		if i%1000 == 0 {
+			status = "PENDING"
+		}
+		if _, err := stmt.Exec(fmt.Sprintf("sweep-%d", i%500), fmt.Sprintf("u@cluster%d", i%3), fmt.Sprint(100000+i), status,
+			start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`ANALYZE`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []experimentFilter{
+		{},
+		{Live: true, HasJob: true},
+		{Statuses: []string{"failed"}},
+		{Name: "sweep-7"},
+		{JobID: "123456"},
+		{Remote: "u@cluster1", JobID: "100001"},
+	} {
+		where, args := f.where()
+		query := `SELECT ` + experimentColumns + ` FROM experiments`
+		if where != "" {
+			query += ` WHERE ` + where
+		}
+		query += ` ORDER BY created_at DESC`
+		plan, err := db.Query(`EXPLAIN QUERY PLAN `+query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var details []string
+		for plan.Next() {
+			var id, parent, notused int
+			var detail string
+			if err := plan.Scan(&id, &parent, &notused, &detail); err != nil {
+				t.Fatal(err)
+			}
+			details = append(details, detail)
+		}
+		plan.Close()
+		for _, d := range details {
+			if strings.HasPrefix(d, "SCAN experiments") && !strings.Contains(d, "INDEX") {
+				t.Errorf("%+v scans the table: %q", f, details)
+			}
+		}
+
+		began := time.Now()
+		exps, err := selectExperiments(db, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name != "" || f.JobID != "" {
+			if elapsed := time.Since(began); elapsed > time.Second {
+				t.Errorf("%+v took %s for %d row(s)", f, elapsed, len(exps))
+			}
+		}
+		if want := rows/10 + rows/1000; f.Live && len(exps) != want {
+			t.Errorf("live experiments = %d, want %d", len(exps), want)
+		}
+	}
+}
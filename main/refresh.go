@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jobState is one job's scheduler state from a batched squeue/sacct query.
+type jobState struct {
+	Status  string
+	End     time.Time
+	Outcome jobOutcome // from sacct, for a job that ended
+}
+
+type refreshTransition struct {
+	exp    *Experiment
+	from   string
+	to     string
+	detail string
+}
+
+// exp refresh [--all | id...] [--fetch-missing] [--resume] [--verbose]
+func cmdRefresh(args []string) error {
+	fs := flag.NewFlagSet("refresh", flag.ExitOnError)
+	var (
+		all          bool
+		fetchMissing bool
+		resume       bool
+		verbose      bool
+	)
+	fs.BoolVar(&all, "all", false, "Refresh every experiment that is not in a terminal state")
+	fs.BoolVar(&fetchMissing, "fetch-missing", false, "Fetch artifacts for finished experiments not synced since they finished, e.g. after exp run --max-monitor stopped watching them")
+	fs.BoolVar(&resume, "resume", false, "For jobs found finished, do what exp resume does: accounting, completed_at from sacct, hooks and the artifact sync")
+	fs.BoolVar(&verbose, "verbose", false, "Also print how many scheduler queries answered the status lookups")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp refresh [--all | id...] [--fetch-missing] [--resume] [--verbose]\n")
+		fs.PrintDefaults()
+	}
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if all == (len(ids) > 0) {
+		fs.Usage()
+		return fmt.Errorf("pass either --all or one or more experiment ids")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	var exps []*Experiment
+	if all {
+		if exps, err = selectExperiments(db, experimentFilter{Live: true, HasJob: true}); err != nil {
+			return fmt.Errorf("query experiments: %w", err)
+		}
+	} else {
+		for _, idStr := range ids {
+			exp, err := findExperiment(db, idStr)
+			if err != nil {
+				return err
+			}
+			if exp.Remote == "" || exp.JobID == "" {
+				return fmt.Errorf("experiment %s has no recorded remote job", idStr)
+			}
+			exps = append(exps, exp)
+		}
+	}
+	if len(exps) == 0 {
+		fmt.Println("No unfinished experiments to refresh.")
+		return nil
+	}
+
+	groups, byGroup := groupBySlurm(exps)
+
+	var transitions []refreshTransition
+	failedRemotes := 0
+	for _, g := range groups {
+		group := byGroup[g]
+		jobIDs := make([]string, len(group))
+		for i, exp := range group {
+			jobIDs[i] = exp.JobID
+		}
+		states, err := jobStatuses.lookup(g.Remote, group[0].SSH, g.Cluster, jobIDs)
+		if err != nil {
+			fmt.Printf("Warning: unable to query %s: %v\n", g, err)
+			failedRemotes++
+			continue
+		}
+		for _, exp := range group {
+			st, ok := states[exp.JobID]
+			if !ok {
+				st = jobState{Status: "UNKNOWN"}
+			}
+			if resume && !isActiveStatus(st.Status) && st.Status != "UNKNOWN" {
+				if t := resumeRefreshed(db, exp, st); t.from != t.to || t.detail != "" {
+					transitions = append(transitions, t)
+				}
+				continue
+			}
+			t, err := applyRefreshedState(db, exp, st, "exp refresh")
+			if err != nil {
+				return err
+			}
+			if fetchMissing && exp.missedFinalSync() {
+				t.detail = strings.TrimPrefix(t.detail+"; "+fetchMissingArtifacts(db, exp), "; ")
+			}
+			if t.from != t.to || t.detail != "" {
+				transitions = append(transitions, t)
+			}
+		}
+	}
+
+	if len(transitions) == 0 {
+		fmt.Printf("Refreshed %d experiment(s); no status changes.\n", len(exps))
+	} else {
+		fmt.Printf("%-5s %-25s %-12s    %-12s %s\n", "ID", "NAME", "FROM", "TO", "NOTE")
+		for _, t := range transitions {
+			fmt.Printf("%-5d %-25s %-12s -> %-12s %s\n", t.exp.ID, t.exp.Name, t.from, t.to, t.detail)
+		}
+		fmt.Printf("Refreshed %d experiment(s); %d changed.\n", len(exps), len(transitions))
+	}
+	if verbose {
+		fmt.Println(jobStatuses.summary())
+	}
+	if failedRemotes > 0 {
+		return fmt.Errorf("%d remote(s) could not be queried", failedRemotes)
+	}
+	return nil
+}
+
+// applyRefreshedState stores a newly observed state, logging the transition
+// with note (the command that saw it) and setting completed_at (from
+// sacct's End when known) once terminal.
+func applyRefreshedState(db *sql.DB, exp *Experiment, st jobState, note string) (refreshTransition, error) {
+	t := refreshTransition{exp: exp, from: exp.JobStatus, to: st.Status}
+	if st.Status == exp.JobStatus {
+		return t, nil
+	}
+	var completed *time.Time
+	if !isActiveStatus(st.Status) && st.Status != "UNKNOWN" {
+		end := st.End
+		if end.IsZero() {
+			end = time.Now().UTC()
+		}
+		completed = &end
+		exp.CompletedAt = end
+	}
+	if err := changeExperimentStatus(db, exp.ID, st.Status, note, completed); err != nil {
+		return t, err
+	}
+	exp.JobStatus = st.Status
+	exp.JobCategory, _ = jobStateCategory(st.Status)
+	if completed != nil {
+		exp.JobReason = st.Outcome.reason(st.Status)
+		if err := recordJobOutcome(db, exp.ID, exp.JobReason, st.Outcome.ExitCode); err != nil {
+			return t, err
+		}
+		if exp.JobReason != "" {
+			t.detail = exp.JobReason
+		}
+	}
+	return t, nil
+}
+
+// resumeRefreshed runs resumeFinished for exp, found ended as st, unless
+// another process watches it. A failure only shows in the transition: the
+// other experiments are resumed all the same.
+func resumeRefreshed(db *sql.DB, exp *Experiment, st jobState) refreshTransition {
+	t := refreshTransition{exp: exp, from: exp.JobStatus, to: st.Status}
+	lock, err := lockExperiment(db, exp.ID, lockCommand())
+	if err != nil {
+		t.to, t.detail = t.from, err.Error()
+		return t
+	}
+	defer lock.Release()
+	did, err := resumeFinished(db, exp, st, os.Stdout, resumeSync)
+	switch {
+	case err != nil:
+		t.detail = "resume failed: " + err.Error()
+	case did:
+		t.detail = strings.TrimPrefix(exp.JobReason+"; resumed", "; ")
+	}
+	return t
+}
+
+func fetchMissingArtifacts(db *sql.DB, exp *Experiment) string {
+	fmt.Printf("Fetching missing artifacts for experiment %d\n", exp.ID)
+	if err := syncCompletedArtifacts(db, exp, nil); errors.Is(err, errSyncDeferred) {
+		return "fetch deferred (over confirm_over)"
+	} else if err != nil {
+		return "fetch failed: " + err.Error()
+	}
+	return "artifacts fetched"
+}
+
+// batchJobStatuses queries many jobs on one remote and cluster with a single
+// squeue call, a single sacct call for the jobs squeue no longer knows about,
+// and a single scontrol session for those sacct has no record of. Jobs none
+// of them know are missing from the result.
+func batchJobStatuses(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+	defer remotePolls.acquire(remote)()
+	list := strings.Join(jobIDs, ",")
+	out, err := sshCombinedOutput(remote, sshOpts, slurmArgs(cluster, "squeue", "-h", "-j", list, "-o", shellQuote("%i %T"))...)
+	text := string(out)
+	if err != nil && !jobNotFound(text) {
+		return nil, fmt.Errorf("squeue: %w (output: %s)", err, strings.TrimSpace(text))
+	}
+	states := make(map[string]jobState)
+	if err == nil {
+		states = parseSqueueBatch(text)
+	}
+	var missing []string
+	for _, id := range jobIDs {
+		if _, ok := states[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return states, nil
+	}
+	out, err = sshCombinedOutput(remote, sshOpts, slurmArgs(cluster, "sacct", "-n", "-X", "-P", "-j", strings.Join(missing, ","), "-o", "JobID,State,End,ExitCode")...)
+	if isTransientSSHError(err) {
+		return nil, fmt.Errorf("sacct: %w", err)
+	}
+	if err == nil {
+		// sacct is optional; without it, or when it has no record,
+		// scontrol may still know the job.
+		for id, st := range parseSacctBatch(string(out)) {
+			states[id] = st
+		}
+	}
+	missing = slices.DeleteFunc(missing, func(id string) bool {
+		_, ok := states[id]
+		return ok
+	})
+	if len(missing) == 0 {
+		return states, nil
+	}
+	recent, err := runScontrol(remote, sshOpts, cluster, missing)
+	if isTransientSSHError(err) {
+		return nil, err
+	}
+	for id, st := range recent {
+		if slices.Contains(missing, id) {
+			states[id] = st
+		}
+	}
+	return states, nil
+}
+
+// parseSqueueBatch parses "JOBID STATE" lines from squeue -o "%i %T".
+func parseSqueueBatch(out string) map[string]jobState {
+	states := make(map[string]jobState)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || isClusterHeader(line) {
+			continue
+		}
+		states[fields[0]] = jobState{Status: fields[1]}
+	}
+	return states
+}
+
+// parseSacctBatch parses "JobID|State|End|ExitCode" lines from sacct -P.
+func parseSacctBatch(out string) map[string]jobState {
+	states := make(map[string]jobState)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) < 3 || parts[0] == "" {
+			continue
+		}
+		state, detail := splitSlurmState(parts[1])
+		st := jobState{Status: state, End: parseSlurmTime(parts[2]), Outcome: jobOutcome{Detail: detail, MaxRSS: -1}}
+		if len(parts) > 3 {
+			st.Outcome.ExitCode = parts[3]
+		}
+		states[parts[0]] = st
+	}
+	return states
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseBatchStatuses(t *testing.T) {
+	sq := parseSqueueBatch("101 RUNNING\n102 PENDING\n\n")
+	if sq["101"].Status != "RUNNING" || sq["102"].Status != "PENDING" || len(sq) != 2 {
+		t.Fatalf("squeue = %v", sq)
+	}
+	sa := parseSacctBatch("103|COMPLETED|2025-01-02T03:04:05|0:0\n104|CANCELLED by 1000|Unknown|0:15\n")
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local).UTC()
+	if sa["103"].Status != "COMPLETED" || !sa["103"].End.Equal(want) {
+		t.Errorf("103 = %+v", sa["103"])
+	}
+	if sa["104"].Status != "CANCELLED" || !sa["104"].End.IsZero() || sa["104"].Outcome.Detail != "by 1000" || sa["104"].Outcome.ExitCode != "0:15" {
+		t.Errorf("104 = %+v", sa["104"])
+	}
+}
+
+func TestApplyRefreshedState(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "RUNNING", "")
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Date(2025, 1, 2, 5, 0, 0, 0, time.UTC)
+	tr, err := applyRefreshedState(db, exp, jobState{Status: "COMPLETED", End: end}, "exp refresh")
+	if err != nil || tr.from != "RUNNING" || tr.to != "COMPLETED" {
+		t.Fatalf("transition = %+v, %v", tr, err)
+	}
+	exp, err = findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.JobStatus != "COMPLETED" || !exp.CompletedAt.Equal(end) {
+		t.Fatalf("experiment = %+v", exp)
+	}
+	events, err := loadStatusEvents(db, id)
+	if err != nil || len(events) != 1 || events[0].Status != "COMPLETED" {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+
+	// A failure is recorded with its reason, which a requeue clears.
+	if _, err := applyRefreshedState(db, exp, jobState{Status: "FAILED", End: end, Outcome: jobOutcome{ExitCode: "2:0"}}, "exp refresh"); err != nil {
+		t.Fatal(err)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.JobCategory != jobFailed || exp.JobReason != "exit code 2" || exp.Accounting.ExitCode != "2:0" {
+		t.Errorf("failed experiment: %q %q %q", exp.JobCategory, exp.JobReason, exp.Accounting.ExitCode)
+	}
+	if _, err := applyRefreshedState(db, exp, jobState{Status: "PENDING"}, "exp refresh"); err != nil {
+		t.Fatal(err)
+	}
+	exp, _ = findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.JobCategory != jobActive || exp.JobReason != "" {
+		t.Errorf("requeued experiment: %q %q", exp.JobCategory, exp.JobReason)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteExecutor runs commands on the cluster's hosts. Every ssh exp makes
+// goes through remoteExecutor; rsync, scp and sftp transfers still run the
+// system binaries.
+type RemoteExecutor interface {
+	// Command prepares args to run on remote, reached with opts. Like ssh,
+	// it joins them with spaces into one command line for the remote shell,
+	// so they must be quoted for it.
+	Command(remote string, opts sshHostOptions, args ...string) *loggedCmd
+	// Upload copies the local file to path on remote.
+	Upload(local, remote string, opts sshHostOptions, path string) error
+}
+
+// Values of ssh_backend in the config.
+const (
+	sshBackendSystem = "system"
+	sshBackendNative = "native"
+)
+
+// remoteExecutor is the backend ssh_backend selects; setupGlobalOptions
+// replaces the default.
+var remoteExecutor RemoteExecutor = systemExecutor{}
+
+// sshCommand is remoteExecutor.Command.
+func sshCommand(remote string, opts sshHostOptions, args ...string) *loggedCmd {
+	return remoteExecutor.Command(remote, opts, args...)
+}
+
+// newRemoteExecutor returns the backend for an ssh_backend value.
+func newRemoteExecutor(backend string, identityFiles []string) (RemoteExecutor, error) {
+	switch backend {
+	case "", sshBackendSystem:
+		return systemExecutor{}, nil
+	case sshBackendNative:
+		return newNativeExecutor(identityFiles), nil
+	}
+	return nil, fmt.Errorf("ssh_backend %q: expected %s or %s", backend, sshBackendSystem, sshBackendNative)
+}
+
+// systemExecutor runs the ssh and scp binaries, so ~/.ssh/config and the
+// user's agent apply, and shares their connections (see sshMuxOptions).
+type systemExecutor struct{}
+
+func (systemExecutor) Command(remote string, opts sshHostOptions, args ...string) *loggedCmd {
+	return muxCommand("ssh", opts, append([]string{remote}, args...)...)
+}
+
+func (systemExecutor) Upload(local, remote string, opts sshHostOptions, path string) error {
+	cmd := muxCommand("scp", opts, local, remote+":"+path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// exitCode returns the exit status of a command that ran and failed, from
+// either backend.
+func exitCode(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		return sshErr.ExitStatus(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// listFilter narrows a remote listing. Prune names directories find does
+// not descend into, Predicate is a find expression evaluated remotely, Keep
+// is applied to each record as it is parsed, and Limit caps how many records
+// may arrive (0 means no limit).
+type listFilter struct {
+	Prune     []string
+	Predicate string
+	Keep      func(remoteFile) bool
+	Limit     int
+}
+
+// errListLimit is returned by listFilter.scan when more than Limit records
+// arrive.
+var errListLimit = errors.New("listing limit exceeded")
+
+// scan parses NUL-terminated listing records from r one at a time and
+// returns those Keep accepts, along with how many records were read.
+func (lf listFilter) scan(r io.Reader) ([]remoteFile, int, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var files []remoteFile
+	received := 0
+	for {
+		line, readErr := br.ReadString(0)
+		if readErr != nil && readErr != io.EOF {
+			return nil, received, readErr
+		}
+		f, ok, err := parseListingRecord(strings.TrimSuffix(line, "\x00"))
+		if err != nil {
+			return nil, received, err
+		}
+		if ok {
+			received++
+			if lf.Limit > 0 && received > lf.Limit {
+				return nil, received, errListLimit
+			}
+			if lf.Keep == nil || lf.Keep(f) {
+				files = append(files, f)
+			}
+		}
+		if readErr == io.EOF {
+			return files, received, nil
+		}
+	}
+}
+
+// remoteFindPredicate translates a source's include patterns into a find
+// expression selecting a superset of the files they match, so a huge tree
+// is narrowed before its listing crosses the wire. The patterns are still
+// applied to what comes back, so the translation only has to be loose, never
+// too strict. ok is false when some include pattern has no safe translation,
+// or when there is nothing to narrow.
+func remoteFindPredicate(patterns []string, syntax, root string) (string, bool) {
+	var terms []string
+	for _, pat := range ensurePatterns(patterns) {
+		body, negated := cutNegation(pat)
+		if negated {
+			// Excluding fewer files remotely is always safe.
+			continue
+		}
+		var term string
+		var ok bool
+		if syntax == patternSyntaxGlob {
+			term, ok = globFindTerm(body, root)
+		} else {
+			term, ok = regexFindTerm(body, root)
+		}
+		if !ok {
+			return "", false
+		}
+		terms = append(terms, term)
+	}
+	return orFindTerms(terms)
+}
+
+func orFindTerms(terms []string) (string, bool) {
+	switch len(terms) {
+	case 0:
+		return "", false
+	case 1:
+		return terms[0], true
+	default:
+		return `\( ` + strings.Join(terms, " -o ") + ` \)`, true
+	}
+}
+
+// globFindTerm translates one glob. patternMatches tries a glob against the
+// relative path, the base name and the full path. Without a "/" only the
+// base name can match, which is -name; "**/NAME" is the same. A relative glob
+// with directories is matched against find's "./rel" path, and an absolute
+// one only when it lies under root. Globs whose first segment matches an
+// empty string, or that start with "**" before directories, could also match
+// through root's own segments and are not translated.
+func globFindTerm(pat, root string) (string, bool) {
+	if rest, ok := strings.CutPrefix(pat, "**/"); ok && !strings.Contains(rest, "/") {
+		pat = rest
+	}
+	if !strings.Contains(pat, "/") {
+		return "-name " + shellQuote(loosenGlob(pat)), true
+	}
+	if strings.HasPrefix(pat, "/") {
+		rest, ok := strings.CutPrefix(pat, strings.TrimRight(root, "/")+"/")
+		if !ok || rest == "" {
+			return "", false
+		}
+		pat = rest
+	}
+	first, _, _ := strings.Cut(pat, "/")
+	if matchesEmpty, _ := path.Match(first, ""); matchesEmpty || first == "**" {
+		return "", false
+	}
+	return "-path " + shellQuote("./"+loosenGlob(pat)), true
+}
+
+// loosenGlob rewrites a path.Match glob as an fnmatch pattern that matches at
+// least the same paths. "**" segments become a "*" that may also match
+// nothing (in find it crosses "/"), and "?" and bracket expressions become
+// "*", since find compares bytes and they would miss multi-byte characters.
+func loosenGlob(pat string) string {
+	segments := strings.Split(pat, "/")
+	var b strings.Builder
+	for i, seg := range segments {
+		if seg == "**" {
+			b.WriteByte('*')
+			continue
+		}
+		if i > 0 && segments[i-1] != "**" {
+			b.WriteByte('/')
+		}
+		for j := 0; j < len(seg); j++ {
+			switch c := seg[j]; c {
+			case '\\':
+				b.WriteByte(c)
+				if j+1 < len(seg) {
+					j++
+					b.WriteByte(seg[j])
+				}
+			case '?':
+				b.WriteByte('*')
+			case '[':
+				for j++; j < len(seg) && seg[j] != ']'; j++ {
+					if seg[j] == '\\' {
+						j++
+					}
+				}
+				b.WriteByte('*')
+			default:
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// regexFindTerm translates one regex by literal text every match must
+// contain. A regex may match anywhere in the relative path, the base name or
+// the full path; find only sees the relative path, so a literal that could
+// fall partly or wholly inside root narrows nothing.
+func regexFindTerm(pat, root string) (string, bool) {
+	re, err := syntax.Parse("(?s)"+pat, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	return regexTerm(re.Simplify(), root)
+}
+
+func regexTerm(re *syntax.Regexp, root string) (string, bool) {
+	switch re.Op {
+	case syntax.OpCapture:
+		return regexTerm(re.Sub[0], root)
+	case syntax.OpAlternate:
+		var terms []string
+		for _, sub := range re.Sub {
+			term, ok := regexTerm(sub, root)
+			if !ok {
+				return "", false
+			}
+			terms = append(terms, term)
+		}
+		return orFindTerms(terms)
+	case syntax.OpLiteral:
+		return containsFindTerm(re, root)
+	case syntax.OpConcat:
+		if n := len(re.Sub); n >= 2 && re.Sub[n-1].Op == syntax.OpEndText {
+			if term, ok := regexSuffixTerm(re.Sub[n-2]); ok {
+				return term, true
+			}
+		}
+		var best *syntax.Regexp
+		for _, sub := range re.Sub {
+			if sub.Op != syntax.OpLiteral || literalMayTouchRoot(sub, root) {
+				continue
+			}
+			if best == nil || len(sub.Rune) > len(best.Rune) {
+				best = sub
+			}
+		}
+		if best != nil {
+			return containsFindTerm(best, root)
+		}
+	}
+	return "", false
+}
+
+// regexSuffixTerm translates re, which ends the match ($ follows it). The
+// relative path and the full path end in the same base name, so a literal
+// suffix decides what the base name ends with, or all of it when the literal
+// contains a "/".
+func regexSuffixTerm(re *syntax.Regexp) (string, bool) {
+	switch re.Op {
+	case syntax.OpCapture:
+		return regexSuffixTerm(re.Sub[0])
+	case syntax.OpConcat:
+		return regexSuffixTerm(re.Sub[len(re.Sub)-1])
+	case syntax.OpAlternate:
+		var terms []string
+		for _, sub := range re.Sub {
+			term, ok := regexSuffixTerm(sub)
+			if !ok {
+				return "", false
+			}
+			terms = append(terms, term)
+		}
+		return orFindTerms(terms)
+	case syntax.OpLiteral:
+		lit := string(re.Rune)
+		pattern := "*" + literalFnmatch(re, lit)
+		if i := strings.LastIndex(lit, "/"); i >= 0 {
+			pattern = literalFnmatch(re, lit[i+1:])
+		}
+		if pattern == "" || pattern == "*" {
+			return "", false
+		}
+		return findTest("-name", re) + " " + shellQuote(pattern), true
+	}
+	return "", false
+}
+
+// containsFindTerm matches paths containing re's literal anywhere.
+func containsFindTerm(re *syntax.Regexp, root string) (string, bool) {
+	if len(re.Rune) == 0 || literalMayTouchRoot(re, root) {
+		return "", false
+	}
+	return findTest("-path", re) + " " + shellQuote("*"+literalFnmatch(re, string(re.Rune))+"*"), true
+}
+
+// literalMayTouchRoot reports whether re's literal could occur in the full
+// path without occurring in the relative path: inside root, or across the
+// "/" that joins root and the relative path.
+func literalMayTouchRoot(re *syntax.Regexp, root string) bool {
+	lit, prefix := string(re.Rune), strings.TrimRight(root, "/")+"/"
+	if re.Flags&syntax.FoldCase != 0 {
+		lit, prefix = strings.ToLower(lit), strings.ToLower(prefix)
+	}
+	if strings.Contains(prefix, lit) {
+		return true
+	}
+	for k := 1; k < len(lit); k++ {
+		if strings.HasSuffix(prefix, lit[:k]) {
+			return true
+		}
+	}
+	return false
+}
+
+// findTest returns test, or its case-insensitive form for a (?i) literal.
+func findTest(test string, re *syntax.Regexp) string {
+	if re.Flags&syntax.FoldCase != 0 {
+		return "-i" + test[1:]
+	}
+	return test
+}
+
+// literalFnmatch quotes the characters of re's literal that fnmatch treats
+// specially. For a (?i) literal, runes Go folds differently from find's
+// -iname (non-ASCII ones, and k and s, which also match the Kelvin and long s
+// signs) become "*".
+func literalFnmatch(re *syntax.Regexp, lit string) string {
+	fold := re.Flags&syntax.FoldCase != 0
+	var b strings.Builder
+	for _, r := range lit {
+		if fold && (r > unicode.MaxASCII || strings.ContainsRune("kKsS", r)) {
+			b.WriteByte('*')
+			continue
+		}
+		if fold {
+			r = unicode.ToLower(r)
+		}
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
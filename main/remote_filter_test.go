@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoteFindPredicate(t *testing.T) {
+	root := "/scratch/u/run"
+	cases := []struct {
+		patterns []string
+		syntax   string
+		want     string // "" when nothing should be narrowed
+	}{
+		{[]string{`\.json$`}, patternSyntaxRegex, `-name '*.json'`},
+		{[]string{`results/.*\.(json|csv)$`}, patternSyntaxRegex, `\( -name '*json' -o -name '*csv' \)`},
+		{[]string{`(?i)metrics\.JSON$`}, patternSyntaxRegex, `-iname '*metric*.j*on'`},
+		{[]string{`summary/final\.txt$`}, patternSyntaxRegex, `-name 'final.txt'`},
+		{[]string{`checkpoint`}, patternSyntaxRegex, `-path '*checkpoint*'`},
+		{[]string{`\.json$`, `!debug`}, patternSyntaxRegex, `-name '*.json'`},
+		// Literals inside, or running into, the root narrow nothing.
+		{[]string{`scratch`}, patternSyntaxRegex, ""},
+		{[]string{`run/out`}, patternSyntaxRegex, ""},
+		{[]string{`.*`}, patternSyntaxRegex, ""},
+		{[]string{`\.json$`, `[0-9]+`}, patternSyntaxRegex, ""},
+		{[]string{`!\.log$`}, patternSyntaxRegex, ""},
+		{[]string{"*.json"}, patternSyntaxGlob, `-name '*.json'`},
+		{[]string{"**/run-?.csv"}, patternSyntaxGlob, `-name 'run-*.csv'`},
+		{[]string{"results/**/metrics.json"}, patternSyntaxGlob, `-path './results*metrics.json'`},
+		{[]string{"/scratch/u/run/logs/*.txt"}, patternSyntaxGlob, `-path './logs/*.txt'`},
+		{[]string{"/elsewhere/*.txt"}, patternSyntaxGlob, ""},
+		{[]string{"**/results/*.json"}, patternSyntaxGlob, ""},
+		{[]string{"*/u/run/x.json"}, patternSyntaxGlob, ""},
+	}
+	for _, c := range cases {
+		got, ok := remoteFindPredicate(c.patterns, c.syntax, root)
+		if ok != (c.want != "") || got != c.want {
+			t.Errorf("remoteFindPredicate(%q, %s) = %q, %v; want %q", c.patterns, c.syntax, got, ok, c.want)
+		}
+	}
+}
+
+// TestRemoteFindPredicateMatchesLocal runs the listing with and without the
+// remote predicate against a local tree and checks that both end up with the
+// same files once the patterns are applied.
+func TestRemoteFindPredicateMatchesLocal(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	root := t.TempDir()
+	for _, rel := range []string{
+		"results/run1/metrics.json", "results/run2/METRICS.JSON", "results/metrics.json.bak",
+		"results/summary.csv", "logs/out.txt", "logs/debug.log", "top.csv", ".hidden.json",
+		"a b/ünï.json", "deep/x/y/z.csv", "checkpoints/step-10.pt", "run-1.csv", "run-10.csv",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(rel), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(predicate string, keep func(remoteFile) bool) []string {
+		out, err := exec.Command("bash", "-c", remoteListCommand(root, "", time.Time{}, listFilter{Predicate: predicate})).Output()
+		if err != nil {
+			t.Fatalf("list with %q: %v", predicate, err)
+		}
+		files, _, err := listFilter{Keep: keep}.scan(strings.NewReader(string(out)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := remoteFileNames(files)
+		sort.Strings(names)
+		return names
+	}
+
+	for _, c := range []struct {
+		syntax   string
+		patterns []string
+	}{
+		{patternSyntaxRegex, []string{`\.json$`}},
+		{patternSyntaxRegex, []string{`(?i)metrics\.json$`}},
+		{patternSyntaxRegex, []string{`results/.*\.(json|csv)$`, `!summary`}},
+		{patternSyntaxRegex, []string{`step-[0-9]+\.pt$`, `^logs/`}},
+		{patternSyntaxRegex, []string{`checkpoint`}},
+		{patternSyntaxGlob, []string{"*.json"}},
+		{patternSyntaxGlob, []string{"results/**/*.json"}},
+		{patternSyntaxGlob, []string{"**/run-?.csv", "deep/**"}},
+		{patternSyntaxGlob, []string{"*.[jc]s*", "!*.csv"}},
+		{patternSyntaxGlob, []string{root + "/logs/*"}},
+	} {
+		compiled, err := compileMatchers(c.patterns, c.syntax)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keep := func(f remoteFile) bool { return patternMatches(compiled, root, f.Rel) }
+		predicate, ok := remoteFindPredicate(c.patterns, c.syntax, root)
+		if !ok {
+			continue
+		}
+		want := list("", keep)
+		if len(want) == 0 {
+			t.Errorf("%q matches nothing; the case tests nothing", c.patterns)
+		}
+		if got := list(predicate, keep); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q narrowed with %s:\n got %q\nwant %q", c.patterns, predicate, got, want)
+		}
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	listing := "1\t1700000000.0\ta.json\x002\t1700000000.0\tb.log\x003\t1700000000.0\tc.json\x00"
+	f := listFilter{Keep: func(f remoteFile) bool { return strings.HasSuffix(f.Rel, ".json") }}
+	files, received, err := f.scan(strings.NewReader(listing))
+	if err != nil || received != 3 || !reflect.DeepEqual(remoteFileNames(files), []string{"a.json", "c.json"}) {
+		t.Errorf("scan = %v, %d, %v", files, received, err)
+	}
+	f.Limit = 2
+	if _, _, err := f.scan(strings.NewReader(listing)); err != errListLimit {
+		t.Errorf("scan over the limit = %v, want errListLimit", err)
+	}
+}
+
+func BenchmarkListingFilter(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 200000; i++ {
+		ext := ".log"
+		if i%50 == 0 {
+			ext = ".json"
+		}
+		fmt.Fprintf(&sb, "%d\t1700000000.0\tshard%03d/run%06d%s\x00", i, i%1000, i, ext)
+	}
+	listing := sb.String()
+	compiled, err := compileMatchers([]string{`\.json$`}, patternSyntaxRegex)
+	if err != nil {
+		b.Fatal(err)
+	}
+	keep := func(f remoteFile) bool { return patternMatches(compiled, "/scratch/run", f.Rel) }
+
+	// The old way: parse the whole listing, then filter it.
+	b.Run("buffered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			files, err := parseRemoteListing(listing)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var kept []remoteFile
+			for _, f := range files {
+				if keep(f) {
+					kept = append(kept, f)
+				}
+			}
+		}
+	})
+	b.Run("streamed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := (listFilter{Keep: keep}).scan(strings.NewReader(listing)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestPruneDirs(t *testing.T) {
+	got := findFilesCommand("", []string{"checkpoints", "wandb-*"}, time.Time{}, " -print")
+	want := `find . \( -name 'checkpoints' -o -name 'wandb-*' \) -type d -prune -o -type f -print`
+	if got != want {
+		t.Errorf("findFilesCommand = %s\nwant %s", got, want)
+	}
+	got = findFilesCommand(symlinksPreserve, []string{"ckpt"}, time.Time{}, "")
+	if want := `find . \( -name 'ckpt' \) -type d -prune -o \( -type f -o -type l \)`; got != want {
+		t.Errorf("preserve findFilesCommand = %s\nwant %s", got, want)
+	}
+	for _, bad := range []string{"results/checkpoints", "", ".."} {
+		if err := validatePruneDirs([]string{bad}); err == nil {
+			t.Errorf("validatePruneDirs(%q) should fail", bad)
+		}
+	}
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	root := t.TempDir()
+	for _, rel := range []string{"results/a.json", "checkpoints/step-1.pt", "results/checkpoints/b.pt", "checkpoints.json"} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := exec.Command("bash", "-c", remoteListCommand(root, "", time.Time{}, listFilter{Prune: []string{"checkpoints"}})).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := parseRemoteListing(string(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := remoteFileNames(files)
+	sort.Strings(names)
+	if want := []string{"checkpoints.json", "results/a.json"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("pruned listing = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// exp rename <id> <new-name>
+func cmdRename(args []string) error {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp rename <id> <new-name>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("id and new name are required")
+	}
+	idStr, newName := fs.Arg(0), fs.Arg(1)
+	if err := validateExperimentName(newName); err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if exp.Name == newName {
+		fmt.Printf("Experiment %d is already named %s\n", exp.ID, newName)
+		return nil
+	}
+
+	snapshotJSON, err := renameSnapshot(exp.ConfigSnapshot, newName)
+	if err != nil {
+		return fmt.Errorf("update config snapshot: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE experiments SET name = ?, config_snapshot = ? WHERE id = ?`, newName, snapshotJSON, exp.ID); err != nil {
+		return fmt.Errorf("rename experiment: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Renamed experiment %d: %s -> %s\n", exp.ID, exp.Name, newName)
+	if exp.LogPath != "" {
+		fmt.Printf("Note: the remote log keeps its original name: %s\n", exp.LogPath)
+	}
+	if exp.ArtifactDest != "" {
+		fmt.Printf("Note: the artifact directory is unchanged: %s\n", exp.ArtifactDest)
+	}
+	return nil
+}
+
+// renameSnapshot rewrites the name inside a stored snapshot while preserving
+// every other key, including ones this build does not know about.
+func renameSnapshot(snapshot, newName string) (string, error) {
+	if snapshot == "" {
+		return "", nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(snapshot), &fields); err != nil {
+		return "", err
+	}
+	nameJSON, err := json.Marshal(newName)
+	if err != nil {
+		return "", err
+	}
+	fields["name"] = nameJSON
+	buf, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateExperimentName(t *testing.T) {
+	for _, ok := range []string{"bigann-k100-bw8", "run_1.2", "k=10+bw=8"} {
+		if err := validateExperimentName(ok); err != nil {
+			t.Errorf("validateExperimentName(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "has space", "a/b", "job-%j", "-leading"} {
+		if err := validateExperimentName(bad); err == nil {
+			t.Errorf("validateExperimentName(%q): expected error", bad)
+		}
+	}
+}
+
+func TestRenameSnapshotPreservesUnknownKeys(t *testing.T) {
+	out, err := renameSnapshot(`{"name":"old","args":["--k","1"],"future_field":42}`, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "new" || m["future_field"] != float64(42) {
+		t.Fatalf("renamed snapshot = %s", out)
+	}
+}
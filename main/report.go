@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	defaultReportInlinePattern  = `\.(json|csv)$`
+	defaultReportInlineMaxBytes = 16 * 1024
+)
+
+type reportFile struct {
+	Path string
+	Size string
+}
+
+type reportInline struct {
+	Path    string
+	Lang    string
+	Content string
+}
+
+type reportExperiment struct {
+	*Experiment
+	Created  string
+	Duration string
+	Snapshot string
+	Files    []reportFile
+	Inlined  []reportInline
+}
+
+type reportData struct {
+	Generated   string
+	Experiments []reportExperiment
+}
+
+// exp report <id...> [--format md|html] [-o file]
+func cmdReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var (
+		format  string
+		outPath string
+	)
+	fs.StringVar(&format, "format", "md", "Output format: md or html")
+	fs.StringVar(&outPath, "o", "", "Write the report to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp report <id...> [--format md|html] [-o file]\n")
+		fs.PrintDefaults()
+	}
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fs.Usage()
+		return fmt.Errorf("at least one experiment id is required")
+	}
+	if format != "md" && format != "html" {
+		return fmt.Errorf("--format must be md or html, got %q", format)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	var rc ReportConfig
+	if cfg != nil {
+		rc = cfg.Report
+	}
+	inlinePattern := rc.InlinePattern
+	if inlinePattern == "" {
+		inlinePattern = defaultReportInlinePattern
+	}
+	inlineRe, err := regexp.Compile(inlinePattern)
+	if err != nil {
+		return fmt.Errorf("report inline_pattern %q: %w", inlinePattern, err)
+	}
+	inlineMax := rc.InlineMaxBytes
+	if inlineMax <= 0 {
+		inlineMax = defaultReportInlineMaxBytes
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	data := reportData{Generated: time.Now().Format(time.RFC3339)}
+	for _, idStr := range ids {
+		exp, err := findExperiment(db, idStr)
+		if err != nil {
+			return err
+		}
+		re, err := buildReportExperiment(exp, inlineRe, inlineMax)
+		if err != nil {
+			return err
+		}
+		data.Experiments = append(data.Experiments, re)
+	}
+
+	var buf bytes.Buffer
+	if err := renderReport(&buf, format, rc, data); err != nil {
+		return err
+	}
+	if outPath == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	absOut, err := expandLocalPath(outPath)
+	if err != nil {
+		return fmt.Errorf("output path: %w", err)
+	}
+	if err := os.WriteFile(absOut, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote report to %s\n", absOut)
+	return nil
+}
+
+func buildReportExperiment(exp *Experiment, inlineRe *regexp.Regexp, inlineMax int64) (reportExperiment, error) {
+	re := reportExperiment{Experiment: exp, Duration: "-", Created: "-"}
+	if !exp.CreatedAt.IsZero() {
+		re.Created = exp.CreatedAt.Format(time.RFC3339)
+	}
+	if d, ok := exp.runDuration(); ok {
+		re.Duration = d.String()
+	}
+	if exp.ConfigSnapshot != "" {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, []byte(exp.ConfigSnapshot), "", "  "); err == nil {
+			re.Snapshot = pretty.String()
+		} else {
+			re.Snapshot = exp.ConfigSnapshot
+		}
+	}
+	if exp.ArtifactDest == "" {
+		return re, nil
+	}
+	files, err := listLocalFileInfo(exp.ArtifactDest, false, false)
+	if err != nil {
+		return re, fmt.Errorf("list artifacts for experiment %d: %w", exp.ID, err)
+	}
+	for _, rel := range sortedKeys(files) {
+		info := files[rel]
+		re.Files = append(re.Files, reportFile{Path: rel, Size: formatBytes(info.Size)})
+		if info.Size > inlineMax || !inlineRe.MatchString(rel) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(exp.ArtifactDest, filepath.FromSlash(rel)))
+		if err != nil {
+			return re, err
+		}
+		lang := strings.TrimPrefix(filepath.Ext(rel), ".")
+		re.Inlined = append(re.Inlined, reportInline{Path: rel, Lang: lang, Content: strings.TrimRight(string(content), "\n")})
+	}
+	return re, nil
+}
+
+type reportTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+func renderReport(w io.Writer, format string, rc ReportConfig, data reportData) error {
+	override := rc.MarkdownTemplate
+	body := defaultMarkdownReportTemplate
+	if format == "html" {
+		override = rc.HTMLTemplate
+		body = defaultHTMLReportTemplate
+	}
+	if override != "" {
+		path, err := expandLocalPath(override)
+		if err != nil {
+			return fmt.Errorf("report template: %w", err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("report template: %w", err)
+		}
+		body = string(content)
+	}
+	funcs := map[string]interface{}{
+		"mdcell": func(s string) string {
+			return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+		},
+		"join": strings.Join,
+	}
+	var tmpl reportTemplate
+	var err error
+	if format == "html" {
+		tmpl, err = htmltemplate.New("report").Funcs(funcs).Parse(body)
+	} else {
+		tmpl, err = texttemplate.New("report").Funcs(funcs).Parse(body)
+	}
+	if err != nil {
+		return fmt.Errorf("parse report template: %w", err)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const defaultMarkdownReportTemplate = `# Experiment report
+
+Generated {{.Generated}}
+{{if gt (len .Experiments) 1}}
+## Comparison
+
+| ID | Name | Status | Duration | Commit | Args |
+|----|------|--------|----------|--------|------|
+{{range .Experiments}}| {{.ID}} | {{mdcell .Name}} | {{.JobStatus}} | {{.Duration}} | {{mdcell .GitCommit}} | {{mdcell .Args}} |
+{{end}}{{end}}{{range .Experiments}}
+## Experiment {{.ID}}: {{.Name}}
+
+| Field | Value |
+|-------|-------|
+| Remote | {{mdcell .Remote}} |
+| Job ID | {{.JobID}} |
+| Status | {{.JobStatus}} |
+| Created | {{.Created}} |
+| Duration | {{.Duration}} |
+| Script | {{mdcell .ScriptPath}} |
+| Args | {{mdcell .Args}} |
+| Git | {{mdcell .GitBranch}} @ {{mdcell .GitCommit}} |
+| Remote log | {{mdcell .LogPath}} |
+| Artifacts | {{mdcell .ArtifactDest}} |
+{{if .Snapshot}}
+### Config snapshot
+
+` + "```json" + `
+{{.Snapshot}}
+` + "```" + `
+{{end}}{{if .Files}}
+### Artifacts
+
+{{range .Files}}- ` + "`{{.Path}}`" + ` ({{.Size}})
+{{end}}{{end}}{{range .Inlined}}
+### {{.Path}}
+
+` + "```{{.Lang}}" + `
+{{.Content}}
+` + "```" + `
+{{end}}{{end}}`
+
+const defaultHTMLReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Experiment report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.25em 0.5em; text-align: left; }
+pre { background: #f6f6f6; padding: 0.5em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>Experiment report</h1>
+<p>Generated {{.Generated}}</p>
+{{if gt (len .Experiments) 1}}
+<h2>Comparison</h2>
+<table>
+<tr><th>ID</th><th>Name</th><th>Status</th><th>Duration</th><th>Commit</th><th>Args</th></tr>
+{{range .Experiments}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.JobStatus}}</td><td>{{.Duration}}</td><td>{{.GitCommit}}</td><td>{{.Args}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Experiments}}
+<h2>Experiment {{.ID}}: {{.Name}}</h2>
+<table>
+<tr><th>Remote</th><td>{{.Remote}}</td></tr>
+<tr><th>Job ID</th><td>{{.JobID}}</td></tr>
+<tr><th>Status</th><td>{{.JobStatus}}</td></tr>
+<tr><th>Created</th><td>{{.Created}}</td></tr>
+<tr><th>Duration</th><td>{{.Duration}}</td></tr>
+<tr><th>Script</th><td>{{.ScriptPath}}</td></tr>
+<tr><th>Args</th><td>{{.Args}}</td></tr>
+<tr><th>Git</th><td>{{.GitBranch}} @ {{.GitCommit}}</td></tr>
+<tr><th>Remote log</th><td>{{.LogPath}}</td></tr>
+<tr><th>Artifacts</th><td>{{.ArtifactDest}}</td></tr>
+</table>
+{{if .Snapshot}}<h3>Config snapshot</h3>
+<pre>{{.Snapshot}}</pre>
+{{end}}{{if .Files}}<h3>Artifacts</h3>
+<ul>
+{{range .Files}}<li><code>{{.Path}}</code> ({{.Size}})</li>
+{{end}}</ul>
+{{end}}{{range .Inlined}}<h3>{{.Path}}</h3>
+<pre>{{.Content}}</pre>
+{{end}}{{end}}
+</body>
+</html>
+`
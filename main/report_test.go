@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderReport(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "recall.json"), []byte(`{"recall@10": 0.93}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "big.bin"), make([]byte, 2048), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	exp := &Experiment{
+		ID: 3, Name: "bigann", JobStatus: "COMPLETED", Args: "--k 10 | x",
+		CreatedAt: created, CompletedAt: created.Add(90 * time.Minute),
+		ArtifactDest: dest, ConfigSnapshot: `{"name":"bigann"}`,
+	}
+	re, err := buildReportExperiment(exp, regexp.MustCompile(defaultReportInlinePattern), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := reportData{Generated: "now", Experiments: []reportExperiment{re, re}}
+
+	var md bytes.Buffer
+	if err := renderReport(&md, "md", ReportConfig{}, data); err != nil {
+		t.Fatal(err)
+	}
+	out := md.String()
+	for _, want := range []string{"## Comparison", "| Duration | 1h30m0s |", `--k 10 \| x`, "- `big.bin` (2.0 KiB)", `{"recall@10": 0.93}`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown report missing %q:\n%s", want, out)
+		}
+	}
+
+	var html bytes.Buffer
+	if err := renderReport(&html, "html", ReportConfig{}, data); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "&#34;recall@10&#34;") {
+		t.Errorf("html report did not escape inlined JSON:\n%s", html.String())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// exp requeue <id>
+func cmdRequeue(args []string) error {
+	fs := flag.NewFlagSet("requeue", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp requeue <id>\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if exp.Remote == "" || exp.JobID == "" {
+		return fmt.Errorf("experiment %s has no recorded remote job", idStr)
+	}
+
+	status, err := queryJobStatus(exp.Remote, exp.SSH, exp.Cluster, exp.JobID)
+	if err != nil {
+		return err
+	}
+	if !isRequeueableStatus(status) {
+		return fmt.Errorf("job %s is %s; only running, suspended, or finished batch jobs can be requeued", exp.JobID, status)
+	}
+
+	cmd := sshCommand(exp.Remote, exp.SSH, slurmArgs(exp.Cluster, "scontrol", "requeue", exp.JobID)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("scontrol requeue %s failed: %v (output: %s)\nSlurm may have already purged the job record; resubmit it with exp run instead",
+			exp.JobID, err, strings.TrimSpace(string(out)))
+	}
+
+	if err := markRequeued(db, exp.ID, status); err != nil {
+		return err
+	}
+	fmt.Printf("Requeued job %s (experiment %d, previously %s); status reset to PENDING\n", exp.JobID, exp.ID, status)
+	fmt.Printf("A running exp watch continues automatically; otherwise run: exp watch %d\n", exp.ID)
+	return nil
+}
+
+// isRequeueableStatus mirrors scontrol requeue: running, suspended, or
+// finished jobs can be requeued, pending ones cannot. UNKNOWN (sacct
+// unavailable) is attempted and left for the scheduler to decide.
+func isRequeueableStatus(status string) bool {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "PENDING", "CONFIGURING", "REQUEUED", "REQUEUE_HOLD", "REQUEUE_FED":
+		return false
+	default:
+		return true
+	}
+}
+
+// markRequeued resets the experiment to PENDING, clears completed_at, bumps
+// requeue_count, and logs the transition in the status history.
+func markRequeued(db *sql.DB, id int64, previous string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE experiments SET job_status = 'PENDING', completed_at = '',
+                          requeue_count = COALESCE(requeue_count, 0) + 1 WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("update experiment %d: %w", id, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO status_events (experiment_id, status, observed_at, note) VALUES (?, 'PENDING', ?, ?)`,
+		id, time.Now().UTC().Format(time.RFC3339), "requeued from "+previous); err != nil {
+		return fmt.Errorf("record status event: %w", err)
+	}
+	return tx.Commit()
+}
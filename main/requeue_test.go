@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestMarkRequeued(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "NODE_FAIL", "")
+	if _, err := db.Exec(`UPDATE experiments SET completed_at = '2025-01-02T04:00:00Z' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := markRequeued(db, id, "NODE_FAIL"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.JobStatus != "PENDING" || !exp.CompletedAt.IsZero() || exp.RequeueCount != 2 {
+		t.Fatalf("experiment after requeue = %+v", exp)
+	}
+	events, err := loadStatusEvents(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Status != "PENDING" || events[0].Note != "requeued from NODE_FAIL" {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestIsRequeueableStatus(t *testing.T) {
+	for status, want := range map[string]bool{"NODE_FAIL": true, "RUNNING": true, "pending": false, "REQUEUED": false} {
+		if got := isRequeueableStatus(status); got != want {
+			t.Errorf("isRequeueableStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestRefreshCountsLaterRequeue(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "a", "NODE_FAIL", "")
+	if _, err := db.Exec(`UPDATE experiments SET completed_at = '2025-01-02T04:00:00Z' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Slurm requeued the job after exp recorded it as failed.
+	if _, err := applyRefreshedState(db, exp, jobState{Status: "PENDING"}, "exp refresh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyRefreshedState(db, exp, jobState{Status: "RUNNING"}, "exp refresh"); err != nil {
+		t.Fatal(err)
+	}
+	if exp, err = findExperiment(db, strconv.FormatInt(id, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if exp.RequeueCount != 1 || !exp.CompletedAt.IsZero() {
+		t.Fatalf("requeue_count = %d, completed_at = %v; want 1 and cleared", exp.RequeueCount, exp.CompletedAt)
+	}
+
+	for from, want := range map[string]bool{"COMPLETED": true, "TIMEOUT": true, "RUNNING": false, "UNKNOWN": false, statusCompletedUnconfirmed: false} {
+		if got := isRequeue(from, "PENDING"); got != want {
+			t.Errorf("isRequeue(%s, PENDING) = %v, want %v", from, got, want)
+		}
+	}
+}
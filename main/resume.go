@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// exp resume finishes what a monitor would have done for a job that ended
+// while nobody watched, say with the laptop asleep: the final state and
+// completed_at from sacct, the accounting, the artifact sync and the
+// notifications. Whatever was done already is not done again.
+
+// exp resume <id>
+func cmdResume(args []string) error {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp resume <id>\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if exp.Remote == "" || exp.JobID == "" {
+		return fmt.Errorf("experiment %s has no recorded remote job", idStr)
+	}
+	lock, err := lockExperiment(db, exp.ID, lockCommand())
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	st := jobState{Status: exp.JobStatus}
+	if isLiveStatus(exp.JobStatus) {
+		states, err := jobStatuses.lookup(exp.Remote, exp.SSH, exp.Cluster, []string{exp.JobID})
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if st, ok = states[exp.JobID]; !ok {
+			return fmt.Errorf("job %s is unknown to squeue, sacct and scontrol on %s; cannot tell how it ended", exp.JobID, exp.Remote)
+		}
+	}
+	if isActiveStatus(st.Status) {
+		if st.Status != exp.JobStatus {
+			if err := changeExperimentStatus(db, exp.ID, st.Status, "exp resume", nil); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Job %s is still %s; monitor it with: exp watch %d\n", exp.JobID, st.Status, exp.ID)
+		return nil
+	}
+	done, err := resumeFinished(db, exp, st, os.Stdout, resumeSync)
+	if err != nil {
+		return err
+	}
+	if !done {
+		fmt.Printf("Experiment %d (%s) finished with status %s and has nothing left to do.\n", exp.ID, exp.Name, exp.JobStatus)
+	}
+	return nil
+}
+
+// resumeSync is the artifact sync of exp resume: the job ended a while ago,
+// so there is nothing to wait for.
+func resumeSync(db *sql.DB, exp *Experiment) error {
+	return syncCompletedArtifacts(db, exp, nil)
+}
+
+// resumeFinished does for exp, whose job ended as st, whatever
+// monitorExperiment would have done once it saw that and was not done yet:
+// finishJob for a job still recorded as running or without accounting, the
+// notifications for a job that only now turns out to have ended, and the
+// artifact sync when exp.missedFinalSync. It reports whether it did
+// anything.
+func resumeFinished(db *sql.DB, exp *Experiment, st jobState, w io.Writer, sync func(db *sql.DB, exp *Experiment) error) (bool, error) {
+	ended := st.Status != exp.JobStatus
+	did := false
+	if ended || !exp.Accounting.recorded() {
+		end := st.End
+		if end.IsZero() {
+			end = exp.CompletedAt
+		}
+		if end.IsZero() {
+			end = time.Now()
+		}
+		fmt.Fprintf(w, "Experiment %d (%s): job %s %s\n", exp.ID, exp.Name, exp.JobID, st.Status)
+		if err := finishJob(db, exp, st.Status, end, "exp resume", w); err != nil {
+			return false, err
+		}
+		did = true
+	}
+	if ended && exp.runSnapshot().NotifyLocal {
+		notifyLocal(finishedNotice(exp))
+	}
+	if !exp.missedFinalSync() {
+		return did, nil
+	}
+	fmt.Fprintf(w, "Fetching the artifacts of experiment %d\n", exp.ID)
+	err := sync(db, exp)
+	switch {
+	case errors.Is(err, errSyncDeferred):
+	case err != nil:
+		if exp.runSnapshot().NotifyLocal {
+			notifyLocal(syncFailedNotice(exp, err))
+		}
+		return true, fmt.Errorf("artifact sync failed: %w", err)
+	default:
+		fmt.Fprintf(w, "Artifacts stored under %s\n", exp.ArtifactDest)
+	}
+	return true, nil
+}
+
+// finishJob records the end of exp's job as status: its accounting, seff's
+// report with capture_seff, why the job ended, and the status itself with
+// completed_at from sacct's End, or end when sacct does not know it. The
+// status goes into the history with note, and runs on_state_change, when it
+// is new; by then everything else is stored.
+func finishJob(db *sql.DB, exp *Experiment, status string, end time.Time, note string, w io.Writer) error {
+	exp.Accounting = queryJobAccounting(exp.Remote, exp.SSH, exp.Cluster, exp.JobID)
+	if err := recordJobAccounting(db, exp.ID, exp.Accounting); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Job accounting: %s\n", exp.Accounting.summary())
+	if exp.runSnapshot().CaptureSeff {
+		if r, ok := querySeff(exp.Remote, exp.SSH, exp.Cluster, exp.JobID); ok {
+			exp.Efficiency = r
+			if err := recordSeff(db, exp.ID, r); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Job efficiency: %s\n", r.summary())
+		}
+	}
+	exp.JobReason = exp.Accounting.outcome().reason(status)
+	if err := recordJobOutcome(db, exp.ID, exp.JobReason, ""); err != nil {
+		return err
+	}
+	if !exp.Accounting.End.IsZero() {
+		end = exp.Accounting.End
+	}
+	completed := end.UTC()
+	var err error
+	if status != exp.JobStatus {
+		err = changeExperimentStatus(db, exp.ID, status, note, &completed)
+	} else {
+		err = updateExperimentStatus(db, exp.ID, status, &completed)
+	}
+	if err != nil {
+		return err
+	}
+	exp.JobStatus = status
+	exp.JobCategory, _ = jobStateCategory(status)
+	exp.CompletedAt = completed
+	fmt.Fprintf(w, "Job outcome: %s\n", exp.outcomeLine())
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// cannedExecutor answers remote commands with canned output, by the first
+// entry whose key the command line contains; anything else fails as an
+// unknown command would.
+type cannedExecutor struct {
+	replies []cannedReply
+	calls   []string
+}
+
+type cannedReply struct {
+	match, output string
+	exit          int
+}
+
+func (e *cannedExecutor) Command(remote string, _ sshHostOptions, args ...string) *loggedCmd {
+	line := strings.Join(args, " ")
+	e.calls = append(e.calls, line)
+	for _, r := range e.replies {
+		if strings.Contains(line, r.match) {
+			return runCommand("sh", "-c", "printf %s "+shellQuote(r.output)+"; exit "+strconv.Itoa(r.exit))
+		}
+	}
+	return runCommand("sh", "-c", "echo 'sh: command not found' >&2; exit 127")
+}
+
+func (e *cannedExecutor) Upload(local, remote string, _ sshHostOptions, path string) error {
+	return nil
+}
+
+func TestResumeFinished(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &cannedExecutor{replies: []cannedReply{
+		{"squeue", "slurm_load_jobs error: Invalid job id specified\n", 1},
+		{"JobID,State,End,ExitCode", "42|COMPLETED|2025-03-06T04:10:00|0:0\n", 0},
+		{sacctAccountingFields, "42|4-19:10:00|0:0||4-18:00:00|gpu-07|gpu|COMPLETED|2025-03-01T09:00:00|2025-03-06T04:10:00|None\n" +
+			"42.batch|4-19:10:00|0:0|31G|4-18:00:00|gpu-07||COMPLETED|2025-03-01T09:00:00|2025-03-06T04:10:00|\n", 0},
+	}}
+	useTestMux(t, nil)
+	_, runs := useStateHook(t, "")
+
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "five-days", "RUNNING", `{"artifact_sources":[{"path":"/scratch/u/run","patterns":[".*"]}]}`)
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = '/tmp/five-days' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	syncs := 0
+	sync := func(db *sql.DB, exp *Experiment) error {
+		syncs++
+		if !exp.ArtifactSinceStart || exp.CreatedAt.IsZero() {
+			t.Errorf("sync without the since-start window: %+v", exp)
+		}
+		return recordArtifactSync(db, exp.ID, &exp.CompletedAt, &syncStats{Files: 3, Updated: -1, UpdatedBytes: -1}, "")
+	}
+	resume := func() bool {
+		t.Helper()
+		exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		states, err := batchJobStatuses(exp.Remote, sshHostOptions{}, exp.Cluster, []string{exp.JobID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		did, err := resumeFinished(db, exp, states[exp.JobID], &out, sync)
+		if err != nil {
+			t.Fatalf("resume: %v\n%s", err, out.String())
+		}
+		return did
+	}
+
+	if !resume() {
+		t.Fatal("nothing resumed")
+	}
+	exp, _ := findExperiment(db, strconv.FormatInt(id, 10))
+	if exp.JobStatus != "COMPLETED" || !exp.CompletedAt.Equal(parseSlurmTime("2025-03-06T04:10:00")) {
+		t.Errorf("status %s, completed %s; want COMPLETED at sacct's End", exp.JobStatus, exp.CompletedAt)
+	}
+	if exp.Accounting.MaxRSS != 31<<30 || exp.Accounting.NodeList != "gpu-07" {
+		t.Errorf("accounting = %+v", exp.Accounting)
+	}
+	if syncs != 1 || exp.ArtifactLastSync.IsZero() {
+		t.Errorf("%d syncs, last sync %s", syncs, exp.ArtifactLastSync)
+	}
+
+	// A second run finds everything done.
+	events, _ := loadStatusEvents(db, id)
+	if resume() {
+		t.Error("resumed twice")
+	}
+	if again, _ := loadStatusEvents(db, id); len(again) != len(events) || syncs != 1 {
+		t.Errorf("second resume: %d events (was %d), %d syncs", len(again), len(events), syncs)
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "\n") != 1 || !strings.Contains(string(data), "RUNNING->COMPLETED") {
+		t.Errorf("hook runs:\n%s", data)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultSafetyWindow protects freshly created experiments from
+// exp prune-artifacts when the config does not set retention.safety_window.
+const defaultSafetyWindow = 7 * 24 * time.Hour
+
+// RetentionConfig is the retention section of the config: the policy
+// exp prune-artifacts applies to local artifact directories.
+type RetentionConfig struct {
+	MaxTotalSize string   `json:"max_total_size"`
+	MaxAge       string   `json:"max_age"`
+	KeepPerName  looseInt `json:"keep_per_name"`
+	SafetyWindow string   `json:"safety_window"`
+}
+
+// retentionPolicy is a parsed RetentionConfig; zero fields are unlimited.
+type retentionPolicy struct {
+	MaxTotal     int64
+	MaxAge       time.Duration
+	KeepPerName  int
+	SafetyWindow time.Duration
+}
+
+func (p retentionPolicy) empty() bool {
+	return p.MaxTotal == 0 && p.MaxAge == 0 && p.KeepPerName == 0
+}
+
+func parseRetention(c RetentionConfig) (retentionPolicy, error) {
+	p := retentionPolicy{KeepPerName: int(c.KeepPerName), SafetyWindow: defaultSafetyWindow}
+	var err error
+	if strings.TrimSpace(c.MaxTotalSize) != "" {
+		if p.MaxTotal, err = parseSize(c.MaxTotalSize); err != nil {
+			return p, fmt.Errorf("max_total_size: %w", err)
+		}
+	}
+	if strings.TrimSpace(c.MaxAge) != "" {
+		if p.MaxAge, err = parseAge(c.MaxAge); err != nil {
+			return p, fmt.Errorf("max_age: %w", err)
+		}
+	}
+	if strings.TrimSpace(c.SafetyWindow) != "" {
+		if p.SafetyWindow, err = parseAge(c.SafetyWindow); err != nil {
+			return p, fmt.Errorf("safety_window: %w", err)
+		}
+	}
+	if p.KeepPerName < 0 {
+		return p, fmt.Errorf("keep_per_name must not be negative")
+	}
+	return p, nil
+}
+
+// pruneItem is one experiment's local artifact directory.
+type pruneItem struct {
+	exp       *Experiment
+	dir       string
+	size      int64
+	protected string // why it must not be deleted, if anything
+	reason    string // why the policy deletes it
+}
+
+// exp prune-artifacts [--dry-run] [--yes] [--rescan] [--max-total-size 200G] [--max-age 90d] [--keep-per-name 3]
+func cmdPruneArtifacts(args []string) error {
+	fs := flag.NewFlagSet("prune-artifacts", flag.ExitOnError)
+	var (
+		dryRun  bool
+		yes     bool
+		rescan  bool
+		flagCfg RetentionConfig
+		keep    int
+	)
+	fs.BoolVar(&dryRun, "dry-run", false, "Show what would be deleted and how much space it would reclaim")
+	fs.BoolVar(&yes, "yes", false, "Delete without prompting")
+	fs.BoolVar(&rescan, "rescan", false, "Re-measure every artifact directory instead of using cached sizes")
+	fs.StringVar(&flagCfg.MaxTotalSize, "max-total-size", "", "Delete the oldest directories until the total fits (e.g. 200G; overrides retention.max_total_size)")
+	fs.StringVar(&flagCfg.MaxAge, "max-age", "", "Delete directories of experiments created longer ago than this (e.g. 90d; overrides retention.max_age)")
+	fs.IntVar(&keep, "keep-per-name", 0, "Keep only the newest N experiments' artifacts per name (overrides retention.keep_per_name)")
+	fs.StringVar(&flagCfg.SafetyWindow, "safety-window", "", "Never delete experiments created within this long (default 7d; overrides retention.safety_window)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp prune-artifacts [--dry-run] [--yes] [--rescan] [--max-total-size 200G] [--max-age 90d] [--keep-per-name 3]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	rc := RetentionConfig{}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		rc = cfg.Retention
+	}
+	if flagCfg.MaxTotalSize != "" {
+		rc.MaxTotalSize = flagCfg.MaxTotalSize
+	}
+	if flagCfg.MaxAge != "" {
+		rc.MaxAge = flagCfg.MaxAge
+	}
+	if keep > 0 {
+		rc.KeepPerName = looseInt(keep)
+	}
+	if flagCfg.SafetyWindow != "" {
+		rc.SafetyWindow = flagCfg.SafetyWindow
+	}
+	policy, err := parseRetention(rc)
+	if err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	if policy.empty() {
+		fmt.Printf("No retention policy: set retention.max_total_size, max_age or keep_per_name in %s, or pass --max-total-size/--max-age/--keep-per-name.\n", configPathHint())
+		return nil
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		return fmt.Errorf("query experiments: %w", err)
+	}
+	items, err := collectPruneItems(db, exps, rescan)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, it := range items {
+		total += it.size
+	}
+	plan := planArtifactPrune(items, policy, time.Now())
+	printPruneSkips(items)
+	if len(plan) == 0 {
+		fmt.Printf("Nothing to delete; artifacts use %s.\n", formatBytes(total))
+		return nil
+	}
+	var planned int64
+	for _, it := range plan {
+		planned += it.size
+	}
+	printPrunePlan(plan)
+
+	if dryRun {
+		fmt.Printf("Dry run: would reclaim %s of %s (%s would remain)\n", formatBytes(planned), formatBytes(total), formatBytes(total-planned))
+		return nil
+	}
+	if !yes && !confirm(fmt.Sprintf("Delete %d artifact director(ies) (%s)?", len(plan), formatBytes(planned))) {
+		return fmt.Errorf("aborted")
+	}
+	var reclaimed int64
+	deleted := 0
+	for _, it := range plan {
+		if err := os.RemoveAll(it.dir); err != nil {
+			fmt.Printf("Warning: unable to remove %s: %v\n", it.dir, err)
+			continue
+		}
+		if err := recordArtifactsPruned(db, it.exp.ID); err != nil {
+			fmt.Printf("Warning: experiment %d: %v\n", it.exp.ID, err)
+		}
+		deleted++
+		reclaimed += it.size
+	}
+	fmt.Printf("Deleted %d artifact director(ies); reclaimed %s (%s remain)\n", deleted, formatBytes(reclaimed), formatBytes(total-reclaimed))
+	return nil
+}
+
+// collectPruneItems measures (or reads the cached size of) every recorded
+// artifact directory that exists and marks the ones that must be kept. Only
+// the per-ID directories exp run creates are ever deleted; a destination
+// the user chose, such as a project's results directory, is reported and
+// left alone.
+func collectPruneItems(db *sql.DB, exps []*Experiment, rescan bool) ([]*pruneItem, error) {
+	var items []*pruneItem
+	for _, exp := range exps {
+		if exp.ArtifactDest == "" || !filepath.IsAbs(exp.ArtifactDest) {
+			continue
+		}
+		dir := filepath.Clean(exp.ArtifactDest)
+		if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+			continue
+		}
+		size, err := cachedArtifactSize(db, exp, rescan)
+		if err != nil {
+			return nil, fmt.Errorf("measure %s: %w", dir, err)
+		}
+		items = append(items, &pruneItem{exp: exp, dir: dir, size: size})
+	}
+	for _, it := range items {
+		switch {
+		case perExperimentArtifactDir(it.exp) != it.dir:
+			it.protected = "not a per-experiment directory"
+		case isLiveStatus(it.exp.JobStatus):
+			it.protected = "active"
+		case it.exp.hasTag(keepTag):
+			it.protected = "tagged keep"
+		case sharesArtifactDir(it, items):
+			it.protected = "shared destination"
+		}
+	}
+	return items, nil
+}
+
+// sharesArtifactDir reports whether another experiment's directory is the
+// same as, inside, or around this one, so deleting it would take their files
+// too.
+func sharesArtifactDir(it *pruneItem, items []*pruneItem) bool {
+	for _, other := range items {
+		if other == it {
+			continue
+		}
+		if other.dir == it.dir || strings.HasPrefix(other.dir, it.dir+string(filepath.Separator)) ||
+			strings.HasPrefix(it.dir, other.dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// planArtifactPrune returns the items the policy deletes, oldest first.
+// keep_per_name and max_age apply first; max_total_size then deletes the
+// oldest remaining directories until the total (protected ones included)
+// fits. Protected items are never chosen; ones created inside the safety
+// window are marked protected here.
+func planArtifactPrune(items []*pruneItem, p retentionPolicy, now time.Time) []*pruneItem {
+	sorted := append([]*pruneItem(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].exp, sorted[j].exp
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	for _, it := range sorted {
+		it.reason = ""
+		if it.protected == "" && p.SafetyWindow > 0 && it.exp.CreatedAt.After(now.Add(-p.SafetyWindow)) {
+			it.protected = "inside safety window"
+		}
+	}
+	deletable := func(it *pruneItem) bool {
+		return it.protected == "" && it.reason == ""
+	}
+
+	if p.KeepPerName > 0 {
+		seen := make(map[string]int)
+		for _, it := range sorted {
+			seen[it.exp.Name]++
+			if seen[it.exp.Name] > p.KeepPerName && deletable(it) {
+				it.reason = fmt.Sprintf("beyond newest %d of %s", p.KeepPerName, it.exp.Name)
+			}
+		}
+	}
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		for _, it := range sorted {
+			if !it.exp.CreatedAt.IsZero() && it.exp.CreatedAt.Before(cutoff) && deletable(it) {
+				it.reason = "older than " + formatAge(p.MaxAge)
+			}
+		}
+	}
+	if p.MaxTotal > 0 {
+		var total int64
+		for _, it := range sorted {
+			if it.reason == "" {
+				total += it.size
+			}
+		}
+		for i := len(sorted) - 1; i >= 0 && total > p.MaxTotal; i-- {
+			if it := sorted[i]; deletable(it) {
+				it.reason = "over max total size"
+				total -= it.size
+			}
+		}
+	}
+
+	var plan []*pruneItem
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if sorted[i].reason != "" {
+			plan = append(plan, sorted[i])
+		}
+	}
+	return plan
+}
+
+// formatAge renders a retention age in days when it is a whole number of
+// them, e.g. "90d".
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func printPruneSkips(items []*pruneItem) {
+	counts := make(map[string]int)
+	for _, it := range items {
+		if it.protected != "" {
+			counts[it.protected]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	var parts []string
+	n := 0
+	for _, reason := range sortedKeys(counts) {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[reason], reason))
+		n += counts[reason]
+	}
+	fmt.Printf("Protected %d experiment(s): %s\n", n, strings.Join(parts, ", "))
+}
+
+func printPrunePlan(plan []*pruneItem) {
+	fmt.Printf("%-5s %-25s %-10s %10s  %-28s %s\n", "ID", "NAME", "CREATED", "SIZE", "REASON", "PATH")
+	for _, it := range plan {
+		created := "-"
+		if !it.exp.CreatedAt.IsZero() {
+			created = it.exp.CreatedAt.Local().Format("2006-01-02")
+		}
+		fmt.Printf("%-5d %-25s %-10s %10s  %-28s %s\n", it.exp.ID, it.exp.Name, created, formatBytes(it.size), it.reason, it.dir)
+	}
+}
+
+// cachedArtifactSize returns the size of exp's artifact directory, measuring
+// it only when it was never measured, a sync has run since, or rescan is set.
+// Fresh measurements are stored in the artifact_size column.
+func cachedArtifactSize(db *sql.DB, exp *Experiment, rescan bool) (int64, error) {
+	if !rescan && !exp.ArtifactSizeAt.IsZero() && !exp.ArtifactSizeAt.Before(exp.ArtifactLastSync) {
+		return exp.ArtifactSize, nil
+	}
+	size, err := dirSize(exp.ArtifactDest)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	if _, err := db.Exec(`UPDATE experiments SET artifact_size = ?, artifact_size_at = ? WHERE id = ?`,
+		size, now.Format(time.RFC3339), exp.ID); err != nil {
+		return 0, err
+	}
+	exp.ArtifactSize, exp.ArtifactSizeAt = size, now
+	return size, nil
+}
+
+// recordArtifactsPruned zeroes the cached size and drops the fetch manifests,
+// so a later exp fetch transfers everything again.
+func recordArtifactsPruned(db *sql.DB, id int64) error {
+	if _, err := db.Exec(`UPDATE experiments SET artifact_size = 0, artifact_size_at = ?, log_archived = 0 WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339), id); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM artifact_manifests WHERE experiment_id = ?`, id)
+	return err
+}
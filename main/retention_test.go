@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPlanArtifactPrune(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	item := func(id int64, name, status string, age time.Duration, size int64, tags ...string) *pruneItem {
+		exp := &Experiment{ID: id, Name: name, JobStatus: status, CreatedAt: now.Add(-age), Tags: tags}
+		it := &pruneItem{exp: exp, dir: "/data/" + strconv.FormatInt(id, 10), size: size}
+		switch {
+		case isLiveStatus(status):
+			it.protected = "active"
+		case exp.hasTag(keepTag):
+			it.protected = "tagged keep"
+		}
+		return it
+	}
+	ids := func(plan []*pruneItem) []int64 {
+		var out []int64
+		for _, it := range plan {
+			out = append(out, it.exp.ID)
+		}
+		return out
+	}
+	items := func() []*pruneItem {
+		return []*pruneItem{
+			item(1, "bigann", "COMPLETED", 200*day, 50),
+			item(2, "bigann", "COMPLETED", 150*day, 50, "keep"),
+			item(3, "bigann", "COMPLETED", 100*day, 50),
+			item(4, "bigann", "COMPLETED", 30*day, 50),
+			item(5, "bigann", "RUNNING", 20*day, 50),
+			item(6, "deep", "FAILED", 120*day, 10),
+			item(7, "deep", "COMPLETED", 2*day, 500),
+		}
+	}
+
+	cases := []struct {
+		name   string
+		policy retentionPolicy
+		want   []int64
+	}{
+		{"max age", retentionPolicy{MaxAge: 90 * day}, []int64{1, 6, 3}},
+		{"keep per name", retentionPolicy{KeepPerName: 2}, []int64{1, 3}},
+		// 760 total; the oldest unprotected directories go until it fits,
+		// and the huge new one is inside the safety window.
+		{"max total", retentionPolicy{MaxTotal: 680, SafetyWindow: 7 * day}, []int64{1, 6, 3}},
+		{"max total without window", retentionPolicy{MaxTotal: 200}, []int64{1, 6, 3, 4, 7}},
+		{"combined", retentionPolicy{KeepPerName: 3, MaxTotal: 700, SafetyWindow: 7 * day}, []int64{1, 6}},
+	}
+	for _, c := range cases {
+		if got := ids(planArtifactPrune(items(), c.policy, now)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: deleted %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	p, err := parseRetention(RetentionConfig{MaxTotalSize: "200G", MaxAge: "90d", KeepPerName: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxTotal != 200<<30 || p.MaxAge != 90*day || p.KeepPerName != 3 || p.SafetyWindow != defaultSafetyWindow {
+		t.Errorf("parseRetention = %+v", p)
+	}
+	if _, err := parseRetention(RetentionConfig{MaxAge: "soon"}); err == nil {
+		t.Error("invalid max_age accepted")
+	}
+}
+
+func TestCachedArtifactSize(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "size", "COMPLETED", "")
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "a.json"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = ? WHERE id = ?`, dest, id); err != nil {
+		t.Fatal(err)
+	}
+	load := func() *Experiment {
+		exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exp
+	}
+	if size, err := cachedArtifactSize(db, load(), false); err != nil || size != 5 {
+		t.Fatalf("first measurement = %d, %v", size, err)
+	}
+	// Without a newer sync the cached value is used, even though the tree grew.
+	if err := os.WriteFile(filepath.Join(dest, "b.json"), []byte("678"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exp := load()
+	if exp.ArtifactSize != 5 || exp.ArtifactSizeAt.IsZero() {
+		t.Fatalf("cached size not stored: %+v", exp)
+	}
+	if size, _ := cachedArtifactSize(db, exp, false); size != 5 {
+		t.Errorf("cached size = %d, want 5", size)
+	}
+	exp.ArtifactLastSync = exp.ArtifactSizeAt.Add(time.Minute)
+	if size, _ := cachedArtifactSize(db, exp, false); size != 8 {
+		t.Errorf("size after a newer sync = %d, want 8", size)
+	}
+
+	if err := recordArtifactsPruned(db, id); err != nil {
+		t.Fatal(err)
+	}
+	if exp := load(); exp.ArtifactSize != 0 {
+		t.Errorf("pruned experiment still has size %d", exp.ArtifactSize)
+	}
+}
+
+func TestCollectPruneItemsPerExperimentOnly(t *testing.T) {
+	db := openTestDB(t)
+	root := t.TempDir()
+	var exps []*Experiment
+	for _, name := range []string{"own", "custom"} {
+		id := insertTestExperiment(t, db, name, "COMPLETED", "")
+		dest := filepath.Join(root, strconv.FormatInt(id, 10))
+		if name == "custom" {
+			dest = filepath.Join(root, "results")
+		}
+		if err := os.MkdirAll(dest, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`UPDATE experiments SET artifact_dest = ? WHERE id = ?`, dest, id); err != nil {
+			t.Fatal(err)
+		}
+		exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		exps = append(exps, exp)
+	}
+	items, err := collectPruneItems(db, exps, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, it := range items {
+		got[it.exp.Name] = it.protected
+	}
+	if want := map[string]string{"own": "", "custom": "not a per-experiment directory"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("protected = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateTags(t *testing.T) {
+	tags := updateTags([]string{"baseline"}, []string{"keep", "baseline", "paper"}, false)
+	if !reflect.DeepEqual(tags, []string{"baseline", "keep", "paper"}) {
+		t.Errorf("add = %v", tags)
+	}
+	if tags = updateTags(tags, []string{"baseline"}, true); !reflect.DeepEqual(tags, []string{"keep", "paper"}) {
+		t.Errorf("remove = %v", tags)
+	}
+	if err := validateTag("has space"); err == nil {
+		t.Error("tag with whitespace accepted")
+	}
+
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "tagged", "COMPLETED", "")
+	if _, err := db.Exec(`UPDATE experiments SET tags = 'keep,paper' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exp.hasTag(keepTag) || len(exp.Tags) != 2 {
+		t.Errorf("tags = %v", exp.Tags)
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one numbered step of the schema. up runs inside a
+// transaction together with the bump of the recorded version, so a step is
+// applied completely or not at all, and may mix SQL with Go-side backfills.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations are applied in order to bring any database up to date. Append
+// new steps; never edit or renumber one that has shipped.
+var migrations = []migration{
+	{1, "baseline schema", migrateBaseline},
+	{2, "backfill legacy NULL columns", migrateBackfillNulls},
+	{3, "index child tables by experiment", migrateChildIndexes},
+	{4, "index experiment lookups", migrateExperimentIndexes},
+	{5, "artifact sources table", migrateArtifactSources},
+	{6, "job accounting columns", migrateJobAccounting},
+	{7, "sync history", migrateSyncHistory},
+	{8, "experiment locks", migrateLocks},
+	{9, "exact script arguments", migrateArgsJSON},
+	{10, "job outcome columns", migrateJobOutcome},
+	{11, "seff efficiency columns", migrateSeff},
+	{12, "job start, end and preemptions", migratePreemption},
+	{13, "pending reason and start estimate", migratePendingEstimate},
+	{14, "stalled reason", migrateStalledReason},
+	{15, "slurm cluster", migrateCluster},
+	{16, "job progress", migrateProgress},
+}
+
+// latestSchemaVersion is the version a fully migrated database reports.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// initSchema applies the migrations the database has not seen yet. Each one
+// first claims its version in schema_migrations; when a concurrent process
+// already did, the step is skipped.
+func initSchema(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+  version    INTEGER PRIMARY KEY,
+  name       TEXT,
+  applied_at TEXT
+)`); err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("schema migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Writing first takes the write lock before anything is read, so two
+	// processes opening an old database cannot both run the step.
+	res, err := tx.Exec(`INSERT OR IGNORE INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion is the newest migration applied to db, 0 for a database
+// that predates versioning (or is empty).
+func schemaVersion(db *sql.DB) (int, error) {
+	var v sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&v); err != nil {
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+// legacyExperimentColumns were added to experiments by the ALTER statements
+// that ran on every open before migrations were versioned. Any of them may be
+// missing from an old database.
+var legacyExperimentColumns = []struct{ name, decl string }{
+	{"job_status", "TEXT"},
+	{"completed_at", "TEXT"},
+	{"artifact_remote", "TEXT"},
+	{"artifact_dest", "TEXT"},
+	{"artifact_pattern", "TEXT"},
+	{"artifact_since_start", "INTEGER"},
+	{"artifact_last_sync", "TEXT"},
+	{"artifact_last_error", "TEXT"},
+	{"config_snapshot", "TEXT"},
+	{"archive_path", "TEXT"},
+	{"requeue_count", "INTEGER DEFAULT 0"},
+	{"artifact_sync_failures", "INTEGER DEFAULT 0"},
+	{"artifact_sync_files", "INTEGER"},
+	{"artifact_sync_bytes", "INTEGER"},
+	{"artifact_sync_seconds", "REAL"},
+	{"artifact_manifest", "TEXT"},
+	{"log_archived", "INTEGER DEFAULT 0"},
+	{"artifact_size", "INTEGER"},
+	{"artifact_size_at", "TEXT"},
+	{"tags", "TEXT"},
+	{"artifact_sync_tar", "TEXT"},
+	{"artifact_sync_host", "TEXT"},
+	{"artifact_sync_updated", "INTEGER"},
+	{"artifact_sync_updated_bytes", "INTEGER"},
+	{"artifact_sync_settle", "TEXT"},
+}
+
+// migrateBaseline creates the tables a new database starts with and adds
+// whichever legacy columns an unversioned database lacks.
+func migrateBaseline(tx *sql.Tx) error {
+	for _, stmt := range []string{`
+CREATE TABLE IF NOT EXISTS experiments (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  name         TEXT,
+  remote       TEXT,
+  script_path  TEXT,
+  args         TEXT,
+  git_commit   TEXT,
+  git_branch   TEXT,
+  job_id       TEXT,
+  job_status   TEXT,
+  log_path     TEXT,
+  created_at   TEXT,
+  completed_at TEXT,
+  artifact_remote TEXT,
+  artifact_dest   TEXT,
+  artifact_pattern TEXT,
+  artifact_since_start INTEGER,
+  artifact_last_sync   TEXT,
+  artifact_last_error  TEXT,
+  config_snapshot      TEXT,
+  archive_path         TEXT,
+  requeue_count        INTEGER DEFAULT 0,
+  artifact_sync_failures INTEGER DEFAULT 0
+)`, `
+CREATE TABLE IF NOT EXISTS metrics (
+  experiment_id INTEGER NOT NULL,
+  key           TEXT NOT NULL,
+  value         REAL,
+  source_file   TEXT,
+  PRIMARY KEY (experiment_id, key)
+)`, `
+CREATE TABLE IF NOT EXISTS status_events (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  experiment_id INTEGER NOT NULL,
+  status        TEXT,
+  observed_at   TEXT,
+  note          TEXT
+)`, `
+CREATE TABLE IF NOT EXISTS artifact_manifests (
+  experiment_id INTEGER NOT NULL,
+  source        TEXT NOT NULL,
+  dest          TEXT NOT NULL,
+  manifest      TEXT,
+  updated_at    TEXT,
+  PRIMARY KEY (experiment_id, source, dest)
+)`, `
+CREATE TABLE IF NOT EXISTS pushes (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  experiment_id INTEGER NOT NULL,
+  pushed_at     TEXT,
+  remote_path   TEXT,
+  file_count    INTEGER,
+  bytes         INTEGER
+)`} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	have, err := tableColumns(tx, "experiments")
+	if err != nil {
+		return err
+	}
+	for _, c := range legacyExperimentColumns {
+		if have[c.name] {
+			continue
+		}
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + c.name + ` ` + c.decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateBackfillNulls fills in columns that rows written before the column
+// existed left NULL but scanExperiment reads as plain strings. A missing job
+// status is taken from the experiment's last status event when there is one.
+func migrateBackfillNulls(tx *sql.Tx) error {
+	for _, col := range []string{"name", "remote", "script_path", "args", "git_commit", "git_branch", "job_id", "log_path",
+		"artifact_remote", "artifact_dest", "artifact_pattern", "artifact_last_error", "config_snapshot"} {
+		if _, err := tx.Exec(`UPDATE experiments SET ` + col + ` = '' WHERE ` + col + ` IS NULL`); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT id FROM experiments WHERE job_status IS NULL`)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		var status sql.NullString
+		err := tx.QueryRow(`SELECT status FROM status_events WHERE experiment_id = ? ORDER BY id DESC LIMIT 1`, id).Scan(&status)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if !status.Valid || status.String == "" {
+			status.String = "UNKNOWN"
+		}
+		if _, err := tx.Exec(`UPDATE experiments SET job_status = ? WHERE id = ?`, status.String, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateChildIndexes indexes the tables exp show and gc look up by
+// experiment; metrics and artifact_manifests already lead their primary key
+// with it.
+func migrateChildIndexes(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`CREATE INDEX IF NOT EXISTS status_events_experiment ON status_events (experiment_id)`,
+		`CREATE INDEX IF NOT EXISTS pushes_experiment ON pushes (experiment_id)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateExperimentIndexes indexes the columns exp list orders by and the
+// filters select on. Statuses are upper-cased first so that filters can
+// compare them exactly.
+func migrateExperimentIndexes(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`UPDATE experiments SET job_status = UPPER(TRIM(job_status)) WHERE job_status != UPPER(TRIM(job_status))`,
+		`CREATE INDEX IF NOT EXISTS experiments_created_at ON experiments (created_at)`,
+		`CREATE INDEX IF NOT EXISTS experiments_job_status ON experiments (job_status)`,
+		`CREATE INDEX IF NOT EXISTS experiments_name ON experiments (name)`,
+		`CREATE INDEX IF NOT EXISTS experiments_job_id ON experiments (job_id)`,
+		`CREATE INDEX IF NOT EXISTS experiments_remote ON experiments (remote)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateArtifactSources moves each experiment's sources out of its config
+// snapshot into artifact_sources. Rows from before per-source snapshots get
+// the one source their artifact_remote and artifact_pattern columns describe.
+func migrateArtifactSources(tx *sql.Tx) error {
+	for _, stmt := range []string{`
+CREATE TABLE IF NOT EXISTS artifact_sources (
+  experiment_id    INTEGER NOT NULL,
+  position         INTEGER NOT NULL,
+  path             TEXT NOT NULL,
+  patterns         TEXT,
+  exclude_patterns TEXT,
+  name             TEXT,
+  remote_override  TEXT,
+  pattern_syntax   TEXT,
+  flatten          INTEGER DEFAULT 0,
+  symlinks         TEXT,
+  prune_dirs       TEXT,
+  PRIMARY KEY (experiment_id, position)
+)`,
+		`CREATE INDEX IF NOT EXISTS artifact_sources_path ON artifact_sources (path)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	type legacyRow struct {
+		id                        int64
+		snapshot, remote, pattern sql.NullString
+	}
+	rows, err := tx.Query(`SELECT id, config_snapshot, artifact_remote, artifact_pattern FROM experiments`)
+	if err != nil {
+		return err
+	}
+	var legacy []legacyRow
+	for rows.Next() {
+		var r legacyRow
+		if err := rows.Scan(&r.id, &r.snapshot, &r.remote, &r.pattern); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range legacy {
+		sources := recordedArtifactSources(r.snapshot.String, r.remote.String, r.pattern.String)
+		if err := writeArtifactSources(tx, r.id, sources); err != nil {
+			return fmt.Errorf("experiment %d: %w", r.id, err)
+		}
+	}
+	return nil
+}
+
+// migrateJobAccounting adds the columns recordJobAccounting fills from sacct
+// when a job finishes. Experiments that finished earlier keep them NULL.
+func migrateJobAccounting(tx *sql.Tx) error {
+	for _, col := range []string{
+		"job_elapsed_seconds INTEGER",
+		"job_exit_code TEXT",
+		"job_max_rss INTEGER",
+		"job_total_cpu_seconds REAL",
+		"job_node_list TEXT",
+		"job_partition TEXT",
+		"job_accounting_note TEXT",
+	} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSyncHistory creates sync_history, seeded with each experiment's last
+// recorded sync.
+func migrateSyncHistory(tx *sql.Tx) error {
+	for _, stmt := range []string{`
+CREATE TABLE IF NOT EXISTS sync_history (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  experiment_id     INTEGER NOT NULL,
+  synced_at         TEXT,
+  files_matched     INTEGER,
+  bytes_matched     INTEGER,
+  files_transferred INTEGER,
+  bytes_transferred INTEGER,
+  duration_seconds  REAL,
+  error             TEXT
+)`,
+		`CREATE INDEX IF NOT EXISTS sync_history_experiment ON sync_history (experiment_id)`,
+		`INSERT INTO sync_history (experiment_id, synced_at, files_matched, bytes_matched, files_transferred,
+                           bytes_transferred, duration_seconds, error)
+ SELECT id, artifact_last_sync, artifact_sync_files, artifact_sync_bytes, artifact_sync_updated,
+        artifact_sync_updated_bytes, artifact_sync_seconds, artifact_last_error
+   FROM experiments
+  WHERE artifact_last_sync != '' AND artifact_sync_files IS NOT NULL
+  ORDER BY artifact_last_sync`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLocks creates the table of experiment locks; see lock.go.
+func migrateLocks(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS locks (
+  experiment_id INTEGER PRIMARY KEY,
+  owner_pid     INTEGER NOT NULL,
+  owner_host    TEXT NOT NULL,
+  command       TEXT,
+  acquired_at   TEXT,
+  heartbeat_at  TEXT
+)`)
+	return err
+}
+
+// migrateArgsJSON adds args_json, the exact argument list, and backfills it
+// with backfillArgs; rows whose list had to be split from args are marked
+// args_approximate.
+func migrateArgsJSON(tx *sql.Tx) error {
+	for _, col := range []string{"args_json TEXT", "args_approximate INTEGER DEFAULT 0"} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	type legacyRow struct {
+		id             int64
+		snapshot, args sql.NullString
+	}
+	rows, err := tx.Query(`SELECT id, config_snapshot, args FROM experiments`)
+	if err != nil {
+		return err
+	}
+	var legacy []legacyRow
+	for rows.Next() {
+		var r legacyRow
+		if err := rows.Scan(&r.id, &r.snapshot, &r.args); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range legacy {
+		args, approximate := backfillArgs(r.snapshot.String, r.args.String)
+		_, exact := argsColumns(args)
+		if _, err := tx.Exec(`UPDATE experiments SET args_json = ?, args_approximate = ? WHERE id = ?`,
+			exact, boolToInt(approximate), r.id); err != nil {
+			return fmt.Errorf("experiment %d: %w", r.id, err)
+		}
+	}
+	return nil
+}
+
+// migrateJobOutcome adds job_category, filled in from each job_status, and
+// job_reason, which only jobs that end from now on get.
+func migrateJobOutcome(tx *sql.Tx) error {
+	for _, col := range []string{"job_category TEXT", "job_reason TEXT"} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	rows, err := tx.Query(`SELECT DISTINCT COALESCE(job_status, '') FROM experiments`)
+	if err != nil {
+		return err
+	}
+	var statuses []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			rows.Close()
+			return err
+		}
+		statuses = append(statuses, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		c, _ := jobStateCategory(s)
+		if _, err := tx.Exec(`UPDATE experiments SET job_category = ? WHERE COALESCE(job_status, '') = ?`, string(c), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSeff adds the columns recordSeff fills when a run captures seff.
+func migrateSeff(tx *sql.Tx) error {
+	for _, col := range []string{
+		"seff_cpu_efficiency REAL",
+		"seff_mem_efficiency REAL",
+		"seff_wall_seconds INTEGER",
+		"seff_report TEXT",
+	} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePreemption adds the job's start and end as sacct reports them and
+// the count of preemptions changeExperimentStatus observes.
+func migratePreemption(tx *sql.Tx) error {
+	for _, col := range []string{"job_start_at TEXT", "job_end_at TEXT", "preempt_count INTEGER DEFAULT 0"} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePendingEstimate adds what squeue --start last said about a pending
+// job; see pendingChecks.
+func migratePendingEstimate(tx *sql.Tx) error {
+	for _, col := range []string{"pending_reason TEXT", "pending_start TEXT"} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateStalledReason adds the mark stalledJobs sets on a job an actionable
+// pending reason holds.
+func migrateStalledReason(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN stalled_reason TEXT`)
+	return err
+}
+
+// migrateCluster adds the Slurm cluster a job was submitted to with -M.
+func migrateCluster(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN cluster TEXT`)
+	return err
+}
+
+// migrateProgress adds what the newest log line progress_regex matches says;
+// see progressChecks.
+func migrateProgress(tx *sql.Tx) error {
+	for _, col := range []string{"progress TEXT", "progress_percent REAL", "progress_line TEXT", "progress_at TEXT"} {
+		if _, err := tx.Exec(`ALTER TABLE experiments ADD COLUMN ` + col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
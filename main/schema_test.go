@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// legacySchema is a database as the unversioned schema code left it: an
+// experiments table grown by ALTER statements, with a row from before
+// job_status existed.
+const legacySchema = `
+CREATE TABLE experiments (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  name         TEXT,
+  remote       TEXT,
+  script_path  TEXT,
+  args         TEXT,
+  git_commit   TEXT,
+  git_branch   TEXT,
+  job_id       TEXT,
+  log_path     TEXT,
+  created_at   TEXT
+);
+CREATE TABLE metrics (
+  experiment_id INTEGER NOT NULL,
+  key           TEXT NOT NULL,
+  value         REAL,
+  source_file   TEXT,
+  PRIMARY KEY (experiment_id, key)
+);
+CREATE TABLE status_events (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  experiment_id INTEGER NOT NULL,
+  status        TEXT,
+  observed_at   TEXT,
+  note          TEXT
+);
+INSERT INTO experiments (name, remote, script_path, args, git_commit, git_branch, job_id, log_path, created_at)
+VALUES ('old', 'u@h', '/s.sbatch', '[]', 'abc', 'main', '41', '/logs/41.out', '2023-01-02T03:04:05Z');
+INSERT INTO experiments (name, remote, script_path, args, git_commit, git_branch, job_id, log_path, created_at)
+VALUES ('older', 'u@h', '/s.sbatch', '[]', 'abc', 'main', '40', '/logs/40.out', '2023-01-01T03:04:05Z');
+INSERT INTO status_events (experiment_id, status, observed_at) VALUES (1, 'PENDING', '2023-01-02T03:04:05Z');
+INSERT INTO status_events (experiment_id, status, observed_at) VALUES (1, 'COMPLETED', '2023-01-02T04:04:05Z');
+ALTER TABLE experiments ADD COLUMN job_status TEXT;
+ALTER TABLE experiments ADD COLUMN completed_at TEXT;
+ALTER TABLE experiments ADD COLUMN artifact_remote TEXT;
+ALTER TABLE experiments ADD COLUMN artifact_dest TEXT;
+ALTER TABLE experiments ADD COLUMN artifact_pattern TEXT;
+ALTER TABLE experiments ADD COLUMN artifact_since_start INTEGER;
+ALTER TABLE experiments ADD COLUMN artifact_last_sync TEXT;
+ALTER TABLE experiments ADD COLUMN artifact_last_error TEXT;
+ALTER TABLE experiments ADD COLUMN config_snapshot TEXT;
+ALTER TABLE experiments ADD COLUMN requeue_count INTEGER DEFAULT 0;
+ALTER TABLE experiments ADD COLUMN artifact_sync_files INTEGER;
+ALTER TABLE experiments ADD COLUMN tags TEXT;
+UPDATE experiments SET args = '--label run one' WHERE id = 1;
+UPDATE experiments SET artifact_last_sync = '2023-01-02T05:00:00Z', artifact_sync_files = 3 WHERE id = 1;
+UPDATE experiments SET artifact_remote = '/scratch/old', artifact_pattern = '\.json$' || char(10) || '!debug' WHERE id = 1;
+UPDATE experiments SET config_snapshot = '{"pattern_syntax":"glob","artifact_sources":[{"path":"/scratch/a","artifact_patterns":["*.csv"],"pattern_syntax":"glob"},{"name":"logs","path":"/scratch/logs","artifact_patterns":null,"remote":"dtn@h","flatten":true}]}' WHERE id = 2;
+`
+
+func TestMigrateLegacySchema(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path, err := dbPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	db, err := openDB()
+	if err != nil {
+		t.Fatalf("migrate legacy database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if v, err := schemaVersion(db); err != nil || v != latestSchemaVersion() {
+		t.Fatalf("schema version = %d, %v; want %d", v, err, latestSchemaVersion())
+	}
+
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		t.Fatalf("load migrated experiments: %v", err)
+	}
+	statuses := map[string]string{}
+	sources := map[string][]ArtifactSource{}
+	for _, exp := range exps {
+		statuses[exp.Name] = exp.JobStatus
+		sources[exp.Name] = exp.EffectiveArtifactSources()
+		if exp.Name == "old" && (!exp.ArgsApproximate || !reflect.DeepEqual(exp.ArgList, []string{"--label", "run", "one"})) {
+			t.Errorf("backfilled args = %q (approximate %v)", exp.ArgList, exp.ArgsApproximate)
+		}
+	}
+	if statuses["old"] != "COMPLETED" || statuses["older"] != "UNKNOWN" {
+		t.Errorf("backfilled statuses = %v", statuses)
+	}
+	var category string
+	if err := db.QueryRow(`SELECT job_category FROM experiments WHERE name = 'old'`).Scan(&category); err != nil || category != "success" {
+		t.Errorf("backfilled category = %q, %v", category, err)
+	}
+	wantSources := map[string][]ArtifactSource{
+		"old": {{Name: "old", Path: "/scratch/old", Patterns: []string{`\.json$`, "!debug"}}},
+		"older": {
+			{Name: "a", Path: "/scratch/a", Patterns: []string{"*.csv"}, PatternSyntax: patternSyntaxGlob},
+			{Name: "logs", Path: "/scratch/logs", Remote: "dtn@h", Flatten: true},
+		},
+	}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("backfilled sources = %+v\nwant %+v", sources, wantSources)
+	}
+	var stored int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM artifact_sources`).Scan(&stored); err != nil || stored != 3 {
+		t.Errorf("artifact_sources rows = %d, %v", stored, err)
+	}
+	var index string
+	if err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'status_events'`).Scan(&index); err != nil {
+		t.Errorf("status_events index: %v", err)
+	}
+	if history, err := loadSyncHistory(db, 1, 0); err != nil || len(history) != 1 || history[0].FilesMatched != 3 {
+		t.Errorf("backfilled sync history = %+v, %v", history, err)
+	}
+	if _, err := db.Exec(`INSERT INTO pushes (experiment_id, file_count) VALUES (1, 2)`); err != nil {
+		t.Errorf("pushes table not created: %v", err)
+	}
+
+	// Opening again runs nothing.
+	db.Close()
+	if db, err = openDB(); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil || applied != len(migrations) {
+		t.Errorf("schema_migrations rows = %d, %v", applied, err)
+	}
+}
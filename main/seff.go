@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seffReport is what seff, the efficiency summary many Slurm sites install
+// from contribs, says about a finished job. exp runs it on completion when
+// the run sets capture_seff.
+type seffReport struct {
+	CPUEfficiency float64       // percent; -1 when unknown
+	MemEfficiency float64       // percent; -1 when unknown
+	WallTime      time.Duration // -1 when unknown
+	Raw           string        // seff's output, for exp show --usage
+}
+
+func unknownSeff() seffReport {
+	return seffReport{CPUEfficiency: -1, MemEfficiency: -1, WallTime: -1}
+}
+
+// captured reports whether seff ran for the job.
+func (r seffReport) captured() bool {
+	return r.Raw != ""
+}
+
+// parseSeff reads seff's output:
+//
+//	Job Wall-clock time: 00:48:00
+//	CPU Efficiency: 81.38% of 06:24:00 core-walltime
+//	Memory Efficiency: 39.06% of 32.00 GB (4.00 GB/core)
+//
+// Lines it does not know are kept in Raw only.
+func parseSeff(out string) seffReport {
+	r := unknownSeff()
+	r.Raw = strings.TrimSpace(out)
+	percent := func(value string) float64 {
+		p, _, _ := strings.Cut(strings.TrimSpace(value), "%")
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 {
+			return -1
+		}
+		return f
+	}
+	for _, line := range strings.Split(r.Raw, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "CPU Efficiency":
+			r.CPUEfficiency = percent(value)
+		case "Memory Efficiency":
+			r.MemEfficiency = percent(value)
+		case "Job Wall-clock time":
+			if d, ok := parseSlurmDuration(value); ok {
+				r.WallTime = d
+			}
+		}
+	}
+	return r
+}
+
+// querySeff runs seff for the job. A remote without seff, or a failure of
+// any kind, is skipped quietly: the report is a nicety and the job is done
+// either way.
+func querySeff(remote string, sshOpts sshHostOptions, cluster, jobID string) (seffReport, bool) {
+	out, err := sshCommand(remote, sshOpts, slurmArgs(cluster, "seff", jobID)...).CombinedOutput()
+	if err != nil {
+		return unknownSeff(), false
+	}
+	r := parseSeff(string(out))
+	if r.CPUEfficiency < 0 && r.MemEfficiency < 0 {
+		// Not seff's report, e.g. a login shell's "command not found"
+		// with a zero exit status.
+		return unknownSeff(), false
+	}
+	return r, true
+}
+
+// recordSeff stores r on experiment id.
+func recordSeff(db execer, id int64, r seffReport) error {
+	var cpu, mem, wall interface{}
+	if r.CPUEfficiency >= 0 {
+		cpu = r.CPUEfficiency
+	}
+	if r.MemEfficiency >= 0 {
+		mem = r.MemEfficiency
+	}
+	if r.WallTime >= 0 {
+		wall = int64(r.WallTime / time.Second)
+	}
+	_, err := db.Exec(`UPDATE experiments SET seff_cpu_efficiency = ?, seff_mem_efficiency = ?, seff_wall_seconds = ?, seff_report = ? WHERE id = ?`,
+		cpu, mem, wall, nullString(r.Raw), id)
+	return err
+}
+
+// scanSeff builds a report from the seff_* columns.
+func scanSeff(cpu, mem sql.NullFloat64, wall sql.NullInt64, raw sql.NullString) seffReport {
+	r := unknownSeff()
+	if cpu.Valid {
+		r.CPUEfficiency = cpu.Float64
+	}
+	if mem.Valid {
+		r.MemEfficiency = mem.Float64
+	}
+	if wall.Valid {
+		r.WallTime = time.Duration(wall.Int64) * time.Second
+	}
+	r.Raw = raw.String
+	return r
+}
+
+// summary renders the parsed fields for exp show.
+func (r seffReport) summary() string {
+	var parts []string
+	if r.CPUEfficiency >= 0 {
+		parts = append(parts, fmt.Sprintf("CPU %.1f%%", r.CPUEfficiency))
+	}
+	if r.MemEfficiency >= 0 {
+		parts = append(parts, fmt.Sprintf("memory %.1f%%", r.MemEfficiency))
+	}
+	if r.WallTime >= 0 {
+		parts = append(parts, "wall time "+formatSlurmDuration(r.WallTime))
+	}
+	return strings.Join(parts, ", ")
+}
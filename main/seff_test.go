@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// seffOutput is seff's report for a finished single-node job.
+const seffOutput = `Job ID: 4242
+Cluster: cluster
+User/Group: me/me
+State: COMPLETED (exit code 0)
+Nodes: 1
+Cores per node: 8
+CPU Utilized: 05:12:30
+CPU Efficiency: 81.38% of 06:24:00 core-walltime
+Job Wall-clock time: 00:48:00
+Memory Utilized: 12.50 GB
+Memory Efficiency: 39.06% of 32.00 GB (4.00 GB/core)
+`
+
+func TestParseSeff(t *testing.T) {
+	r := parseSeff(seffOutput)
+	if r.CPUEfficiency != 81.38 || r.MemEfficiency != 39.06 || r.WallTime != 48*time.Minute {
+		t.Errorf("parsed %+v", r)
+	}
+	if got := r.summary(); got != "CPU 81.4%, memory 39.1%, wall time 00:48:00" {
+		t.Errorf("summary = %q", got)
+	}
+
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "bigann", "COMPLETED", "")
+	if err := recordSeff(db, id, r); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := loadExperimentByID(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.Efficiency != r {
+		t.Errorf("stored %+v, want %+v", exp.Efficiency, r)
+	}
+}
+
+func TestQuerySeff(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+	bin := t.TempDir()
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if _, ok := querySeff("u@h", sshHostOptions{}, "", "4242"); ok {
+		t.Error("a remote without seff gave a report")
+	}
+	os.WriteFile(filepath.Join(bin, "seff"), []byte("#!/bin/sh\nprintf '%s' "+shellQuote(seffOutput)+"\n"), 0o755)
+	if r, ok := querySeff("u@h", sshHostOptions{}, "", "4242"); !ok || r.CPUEfficiency != 81.38 {
+		t.Errorf("querySeff = %+v, %v", r, ok)
+	}
+}
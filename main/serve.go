@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultServeAddr = "127.0.0.1:7777"
+
+//go:embed web/templates/*.html web/static/*
+var webFS embed.FS
+
+// apiExperiment is the JSON shape served by /api/experiments. Detail-only
+// fields are omitted from the list endpoint.
+type apiExperiment struct {
+	ID                int64              `json:"id"`
+	Name              string             `json:"name"`
+	Remote            string             `json:"remote"`
+	ScriptPath        string             `json:"script_path"`
+	Args              string             `json:"args"`
+	ArgList           []string           `json:"arg_list"`
+	ArgsApproximate   bool               `json:"args_approximate,omitempty"`
+	GitCommit         string             `json:"git_commit"`
+	GitBranch         string             `json:"git_branch"`
+	JobID             string             `json:"job_id"`
+	Status            string             `json:"status"`
+	Outcome           string             `json:"outcome"`
+	Reason            string             `json:"reason,omitempty"`
+	LogPath           string             `json:"log_path"`
+	CreatedAt         string             `json:"created_at"`
+	CompletedAt       string             `json:"completed_at,omitempty"`
+	Duration          string             `json:"duration,omitempty"`
+	ArtifactDest      string             `json:"artifact_dest"`
+	ArtifactLastSync  string             `json:"artifact_last_sync,omitempty"`
+	ArtifactLastError string             `json:"artifact_last_error,omitempty"`
+	ArchivePath       string             `json:"archive_path,omitempty"`
+	RequeueCount      int                `json:"requeue_count"`
+	PreemptCount      int                `json:"preempt_count"`
+	Metrics           map[string]float64 `json:"metrics,omitempty"`
+
+	Snapshot      json.RawMessage `json:"snapshot,omitempty"`
+	SnapshotText  string          `json:"-"`
+	Files         []serveFile     `json:"files,omitempty"`
+	StatusHistory []statusEvent   `json:"status_history,omitempty"`
+}
+
+type serveFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type serveServer struct {
+	db            *sql.DB
+	dbPath        string
+	metricsRecent int
+	tmpl          map[string]*template.Template
+}
+
+// exp serve [--addr 127.0.0.1:7777] [--metrics-recent N] [--write-textfile PATH]
+func cmdServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	var (
+		addr          string
+		metricsRecent int
+		textfile      string
+	)
+	flags.StringVar(&addr, "addr", defaultServeAddr, "Address to listen on; keep it on localhost unless you trust the network")
+	flags.IntVar(&metricsRecent, "metrics-recent", defaultMetricsRecent, "Finished experiments that keep per-id series on /metrics (active ones always do)")
+	flags.StringVar(&textfile, "write-textfile", "", "Write the /metrics output to this file for node_exporter's textfile collector and exit instead of serving")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp serve [--addr 127.0.0.1:7777] [--metrics-recent 20] [--write-textfile PATH]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	path, err := dbPath()
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	if textfile != "" {
+		absOut, err := expandLocalPath(textfile)
+		if err != nil {
+			return fmt.Errorf("textfile path: %w", err)
+		}
+		return writePromTextfile(db, absOut, metricsRecent)
+	}
+
+	handler, err := newServeHandler(db, path, metricsRecent)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	fmt.Printf("Serving %s on http://%s/ (metrics at /metrics; Ctrl-C to stop)\n", path, addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newServeHandler wires the HTML pages, JSON API, Prometheus /metrics and
+// embedded static assets.
+// Handlers only read the local DB and artifact directories; nothing here
+// talks to the remote host.
+func newServeHandler(db *sql.DB, path string, metricsRecent int) (http.Handler, error) {
+	s := &serveServer{db: db, dbPath: path, metricsRecent: metricsRecent, tmpl: make(map[string]*template.Template)}
+	for _, page := range []string{"list", "detail"} {
+		t, err := template.New(page).Funcs(template.FuncMap{"bytes": formatBytes, "args": formatArgs}).ParseFS(webFS, "web/templates/layout.html", "web/templates/"+page+".html")
+		if err != nil {
+			return nil, fmt.Errorf("parse %s template: %w", page, err)
+		}
+		s.tmpl[page] = t
+	}
+	static, err := fs.Sub(webFS, "web/static")
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("GET /{$}", s.handleList)
+	mux.HandleFunc("GET /experiments/{id}", s.handleDetail)
+	mux.HandleFunc("GET /api/experiments", s.handleAPIList)
+	mux.HandleFunc("GET /api/experiments/{id}", s.handleAPIDetail)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux, nil
+}
+
+// queryExperiments applies the list page's ?status= and ?name= filters.
+// Name matching is a case-insensitive substring match.
+func (s *serveServer) queryExperiments(r *http.Request) ([]*Experiment, error) {
+	var f experimentFilter
+	if status := strings.TrimSpace(r.URL.Query().Get("status")); status != "" {
+		f.Statuses = []string{status}
+	}
+	f.NameContains = strings.TrimSpace(r.URL.Query().Get("name"))
+	return selectExperiments(s.db, f)
+}
+
+func (s *serveServer) handleList(w http.ResponseWriter, r *http.Request) {
+	exps, err := s.queryExperiments(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	statuses, err := s.knownStatuses()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows := make([]apiExperiment, len(exps))
+	for i, exp := range exps {
+		rows[i] = newAPIExperiment(exp)
+	}
+	s.render(w, "list", map[string]interface{}{
+		"Title":       "Experiments",
+		"Experiments": rows,
+		"Statuses":    statuses,
+		"Status":      strings.ToUpper(r.URL.Query().Get("status")),
+		"Name":        r.URL.Query().Get("name"),
+	})
+}
+
+func (s *serveServer) handleDetail(w http.ResponseWriter, r *http.Request) {
+	detail, status, err := s.loadDetail(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	s.render(w, "detail", map[string]interface{}{
+		"Title":      fmt.Sprintf("Experiment %d: %s", detail.ID, detail.Name),
+		"Experiment": detail,
+	})
+}
+
+func (s *serveServer) handleAPIList(w http.ResponseWriter, r *http.Request) {
+	exps, err := s.queryExperiments(r)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	out := make([]apiExperiment, len(exps))
+	for i, exp := range exps {
+		out[i] = newAPIExperiment(exp)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *serveServer) handleAPIDetail(w http.ResponseWriter, r *http.Request) {
+	detail, status, err := s.loadDetail(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// loadDetail gathers everything the detail page shows. The returned status
+// code is only meaningful when err is non-nil.
+func (s *serveServer) loadDetail(idStr string) (apiExperiment, int, error) {
+	if _, err := strconv.ParseInt(idStr, 10, 64); err != nil {
+		return apiExperiment{}, http.StatusBadRequest, fmt.Errorf("invalid experiment id %q", idStr)
+	}
+	exp, err := findExperiment(s.db, idStr)
+	if err != nil {
+		return apiExperiment{}, http.StatusNotFound, err
+	}
+	detail := newAPIExperiment(exp)
+	metrics, err := loadMetrics(s.db, exp.ID)
+	if err != nil {
+		return detail, http.StatusInternalServerError, err
+	}
+	for _, m := range metrics {
+		if detail.Metrics == nil {
+			detail.Metrics = make(map[string]float64)
+		}
+		detail.Metrics[m.Key] = m.Value
+	}
+	if detail.StatusHistory, err = loadStatusEvents(s.db, exp.ID); err != nil {
+		return detail, http.StatusInternalServerError, err
+	}
+	if exp.ConfigSnapshot != "" && json.Valid([]byte(exp.ConfigSnapshot)) {
+		detail.Snapshot = json.RawMessage(exp.ConfigSnapshot)
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, detail.Snapshot, "", "  "); err == nil {
+			detail.SnapshotText = pretty.String()
+		}
+	}
+	if exp.ArtifactDest != "" {
+		files, err := listLocalFileInfo(exp.ArtifactDest, false, false)
+		if err != nil {
+			return detail, http.StatusInternalServerError, fmt.Errorf("list artifacts: %w", err)
+		}
+		for _, rel := range sortedKeys(files) {
+			detail.Files = append(detail.Files, serveFile{Path: rel, Size: files[rel].Size})
+		}
+	}
+	return detail, http.StatusOK, nil
+}
+
+func (s *serveServer) knownStatuses() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT job_status FROM experiments WHERE job_status != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var st string
+		if err := rows.Scan(&st); err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	sort.Strings(out)
+	return out, rows.Err()
+}
+
+func (s *serveServer) render(w http.ResponseWriter, page string, data map[string]interface{}) {
+	data["DBPath"] = s.dbPath
+	data["Generated"] = time.Now().Format(time.RFC3339)
+	// Render into a buffer so a template error doesn't leave a half-written page.
+	var buf bytes.Buffer
+	if err := s.tmpl[page].ExecuteTemplate(&buf, page+".html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+func newAPIExperiment(exp *Experiment) apiExperiment {
+	a := apiExperiment{
+		ID:                exp.ID,
+		Name:              exp.Name,
+		Remote:            exp.Remote,
+		ScriptPath:        exp.ScriptPath,
+		Args:              exp.Args,
+		ArgList:           exp.ArgList,
+		ArgsApproximate:   exp.ArgsApproximate,
+		GitCommit:         exp.GitCommit,
+		GitBranch:         exp.GitBranch,
+		JobID:             exp.JobID,
+		Status:            exp.JobStatus,
+		Outcome:           string(exp.JobCategory),
+		Reason:            exp.JobReason,
+		LogPath:           exp.LogPath,
+		ArtifactDest:      exp.ArtifactDest,
+		ArtifactLastError: exp.ArtifactLastError,
+		ArchivePath:       exp.ArchivePath,
+		RequeueCount:      exp.RequeueCount,
+		PreemptCount:      exp.PreemptCount,
+	}
+	if !exp.CreatedAt.IsZero() {
+		a.CreatedAt = exp.CreatedAt.Format(time.RFC3339)
+	}
+	if !exp.CompletedAt.IsZero() {
+		a.CompletedAt = exp.CompletedAt.Format(time.RFC3339)
+		if d, ok := exp.runDuration(); ok {
+			a.Duration = d.String()
+		}
+	}
+	if !exp.ArtifactLastSync.IsZero() {
+		a.ArtifactLastSync = exp.ArtifactLastSync.Format(time.RFC3339)
+	}
+	return a
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeHandler(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "bigann-sweep", "COMPLETED", `{"name":"bigann-sweep"}`)
+	insertTestExperiment(t, db, "other", "RUNNING", "")
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "recall.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE experiments SET artifact_dest = ? WHERE id = ?`, dest, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeMetrics(db, id, []metricValue{{Key: "recall@10", Value: 0.93}}); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := newServeHandler(db, "test.db", defaultMetricsRecent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	var list []apiExperiment
+	rec := get("/api/experiments?status=completed")
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].Name != "bigann-sweep" {
+		t.Fatalf("status filter: %v %s", err, rec.Body.String())
+	}
+	rec = get("/api/experiments?name=OTH")
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].Name != "other" {
+		t.Fatalf("name filter: %v %s", err, rec.Body.String())
+	}
+
+	var detail apiExperiment
+	rec = get("/api/experiments/1")
+	if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil {
+		t.Fatal(err)
+	}
+	var snap RunSnapshot
+	if err := json.Unmarshal(detail.Snapshot, &snap); err != nil || snap.Name != "bigann-sweep" {
+		t.Fatalf("snapshot = %s, %v", detail.Snapshot, err)
+	}
+	// Recorded before exact arguments were kept, so split from the text.
+	if len(detail.ArgList) != 2 || detail.ArgList[1] != "1" || !detail.ArgsApproximate {
+		t.Errorf("arg_list = %q, approximate %v", detail.ArgList, detail.ArgsApproximate)
+	}
+	if detail.Metrics["recall@10"] != 0.93 || len(detail.Files) != 1 || detail.Files[0].Size != 2 {
+		t.Fatalf("detail = %s", rec.Body.String())
+	}
+	if rec := get("/api/experiments/99"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing experiment: code %d", rec.Code)
+	}
+	if rec := get("/api/experiments/x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad id: code %d", rec.Code)
+	}
+
+	rec = get("/?name=bigann")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "bigann-sweep") || strings.Contains(rec.Body.String(), ">other<") {
+		t.Fatalf("list page: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = get("/experiments/1")
+	for _, want := range []string{"recall@10", "recall.json", "&#34;name&#34;"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("detail page missing %q", want)
+		}
+	}
+	if rec := get("/static/style.css"); rec.Code != http.StatusOK {
+		t.Errorf("static asset: code %d", rec.Code)
+	}
+}
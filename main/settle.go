@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// settlePolicy is how long the post-run sync waits for a finished job's
+// files to show up. Without MaxWait it sleeps Delay once; with it, the
+// remote tree is listed every Delay until the file count and total size stop
+// changing, for at most MaxWait.
+type settlePolicy struct {
+	Delay   time.Duration
+	MaxWait time.Duration
+}
+
+// settlePolicy reads settle_delay and settle_max_wait from the run snapshot.
+func (exp *Experiment) settlePolicy() settlePolicy {
+	snap := exp.runSnapshot()
+	p := settlePolicy{Delay: defaultSettleDelay}
+	if d, err := time.ParseDuration(snap.SettleDelay); err == nil && d >= 0 {
+		p.Delay = d
+	}
+	if d, err := time.ParseDuration(snap.SettleMaxWait); err == nil && d > 0 {
+		p.MaxWait = d
+	}
+	return p
+}
+
+// stable reports whether the policy checks the tree rather than sleeping.
+func (p settlePolicy) stable() bool {
+	return p.MaxWait > 0 && p.Delay > 0
+}
+
+// validateSettle checks settle_delay and settle_max_wait as given in a run
+// config or on the command line.
+func validateSettle(delay, maxWait string) error {
+	d := defaultSettleDelay
+	if delay != "" {
+		var err error
+		if d, err = time.ParseDuration(delay); err != nil || d < 0 {
+			return fmt.Errorf("invalid settle_delay %q (examples: 0s, 10s, 1m)", delay)
+		}
+	}
+	if maxWait != "" {
+		if m, err := time.ParseDuration(maxWait); err != nil || m <= 0 {
+			return fmt.Errorf("invalid settle_max_wait %q (examples: 2m, 10m)", maxWait)
+		}
+		if d == 0 {
+			return fmt.Errorf("settle_max_wait needs a non-zero settle_delay between listings")
+		}
+	}
+	return nil
+}
+
+// treeTotals is what the stability check compares between listings.
+type treeTotals struct {
+	Files int
+	Bytes int64
+}
+
+// settleResult is what the wait before a post-run sync did, for the log and
+// the sync record.
+type settleResult struct {
+	Waited   time.Duration
+	Checked  bool // the tree was listed rather than a fixed delay slept
+	Unstable bool // still changing when MaxWait ran out
+}
+
+func (r settleResult) String() string {
+	switch {
+	case !r.Checked:
+		return fmt.Sprintf("fixed delay, waited %s", r.Waited)
+	case r.Unstable:
+		return fmt.Sprintf("stability check, still changing after %s", r.Waited)
+	default:
+		return fmt.Sprintf("stability check, stable after %s", r.Waited)
+	}
+}
+
+// settle waits according to p before a post-run sync. list totals the remote
+// tree and sleep waits; both are parameters so tests need no remote and no
+// clock. A failed listing ends the check early: the sync itself reports what
+// is wrong with the remote.
+func (p settlePolicy) settle(list func() (treeTotals, error), sleep func(time.Duration)) (settleResult, error) {
+	if !p.stable() {
+		sleep(p.Delay)
+		return settleResult{Waited: p.Delay}, nil
+	}
+	c := settleCheck{policy: p}
+	for {
+		cur, err := list()
+		res, wait, done := c.step(cur, err)
+		if done {
+			return res, err
+		}
+		sleep(wait)
+	}
+}
+
+// settleCheck is a stability check taken one listing at a time. The
+// monitor daemon keeps one per finished experiment and comes back for the
+// next listing on a later pass instead of sleeping in between.
+type settleCheck struct {
+	policy settlePolicy
+	res    settleResult
+	prev   *treeTotals
+}
+
+// step takes the latest listing and returns the result once the check is
+// over, or how long to wait before the next listing.
+func (c *settleCheck) step(cur treeTotals, err error) (settleResult, time.Duration, bool) {
+	c.res.Checked = true
+	switch {
+	case err != nil:
+		return c.res, 0, true
+	case c.prev != nil && cur == *c.prev:
+		return c.res, 0, true
+	case c.prev != nil && c.res.Waited >= c.policy.MaxWait:
+		c.res.Unstable = true
+		return c.res, 0, true
+	}
+	c.prev = &cur
+	wait := min(c.policy.Delay, c.policy.MaxWait-c.res.Waited)
+	c.res.Waited += wait
+	return c.res, wait, false
+}
+
+// settleArtifacts waits for a finished job's artifact sources to settle and
+// prints what it did.
+func settleArtifacts(exp *Experiment, sources []ArtifactSource, sleep func(time.Duration)) settleResult {
+	p := exp.settlePolicy()
+	if p.stable() {
+		fmt.Printf("Waiting for artifacts to settle: listing every %s, for up to %s\n", p.Delay, p.MaxWait)
+	}
+	res, err := p.settle(func() (treeTotals, error) {
+		return artifactTreeTotals(exp, sources)
+	}, sleep)
+	if err != nil {
+		fmt.Printf("Warning: stability check stopped after %s: %v\n", res.Waited, err)
+	}
+	fmt.Printf("Artifact settle: %s\n", res)
+	return res
+}
+
+// artifactTreeTotals counts the files, and their total size, under every
+// source.
+func artifactTreeTotals(exp *Experiment, sources []ArtifactSource) (treeTotals, error) {
+	var t treeTotals
+	for _, src := range sources {
+		files, _, err := listRemoteFiles(io.Discard, src.host(exp), exp.SSH, src.Path, src.Symlinks, time.Time{}, listFilter{Prune: src.PruneDirs})
+		var de *deniedError
+		if err != nil && !errors.As(err, &de) {
+			return treeTotals{}, err
+		}
+		for _, f := range files {
+			t.Files++
+			t.Bytes += f.Size
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSettle(t *testing.T) {
+	// Each listing returns the next totals; the last one repeats.
+	lister := func(totals ...treeTotals) (func() (treeTotals, error), *int) {
+		calls := 0
+		return func() (treeTotals, error) {
+			i := min(calls, len(totals)-1)
+			calls++
+			return totals[i], nil
+		}, &calls
+	}
+	var slept time.Duration
+	sleep := func(d time.Duration) { slept += d }
+
+	p := settlePolicy{Delay: 10 * time.Second}
+	list, calls := lister(treeTotals{})
+	if res, err := p.settle(list, sleep); err != nil || res.Checked || res.Waited != 10*time.Second || *calls != 0 || slept != 10*time.Second {
+		t.Errorf("fixed delay = %+v, %v after %d listings, slept %s", res, err, *calls, slept)
+	}
+
+	// The tree grows twice, then holds still.
+	slept = 0
+	p = settlePolicy{Delay: 15 * time.Second, MaxWait: 2 * time.Minute}
+	list, calls = lister(treeTotals{1, 10}, treeTotals{3, 10}, treeTotals{3, 40}, treeTotals{3, 40})
+	res, err := p.settle(list, sleep)
+	if err != nil || !res.Checked || res.Unstable || res.Waited != 45*time.Second || *calls != 4 || slept != res.Waited {
+		t.Errorf("settling tree = %+v, %v after %d listings, slept %s", res, err, *calls, slept)
+	}
+	if got := res.String(); got != "stability check, stable after 45s" {
+		t.Errorf("String = %q", got)
+	}
+
+	// A tree that keeps changing gives up at MaxWait, even mid-interval.
+	slept = 0
+	n := 0
+	growing := func() (treeTotals, error) { n++; return treeTotals{Files: n}, nil }
+	p = settlePolicy{Delay: 40 * time.Second, MaxWait: time.Minute}
+	if res, err := p.settle(growing, sleep); err != nil || !res.Unstable || res.Waited != time.Minute || slept != time.Minute {
+		t.Errorf("changing tree = %+v, %v, slept %s", res, err, slept)
+	}
+
+	boom := errors.New("ssh: connect timed out")
+	failing := func() (treeTotals, error) { return treeTotals{}, boom }
+	if _, err := p.settle(failing, sleep); err != boom {
+		t.Errorf("failed listing = %v", err)
+	}
+}
+
+func TestValidateSettle(t *testing.T) {
+	for _, c := range []struct {
+		delay, maxWait string
+		ok             bool
+	}{
+		{"", "", true},
+		{"0s", "", true},
+		{"1m", "10m", true},
+		{"", "5m", true},
+		{"-1s", "", false},
+		{"soon", "", false},
+		{"10s", "0s", false},
+		{"0s", "5m", false},
+	} {
+		if err := validateSettle(c.delay, c.maxWait); (err == nil) != c.ok {
+			t.Errorf("validateSettle(%q, %q) = %v", c.delay, c.maxWait, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exp learns a job's state from squeue while it is queued or running, then
+// from sacct. Some clusters run without accounting, so sacct knows nothing;
+// scontrol still remembers a finished job for MinJobAge (five minutes by
+// default). After that only assume_completed_after (see absentJobs) decides
+// how the job ended.
+
+// jobNotFound reports whether squeue or scontrol output says the job is not
+// one Slurm knows about any more. squeue exits 1 this way once a finished job
+// ages out, and scontrol always does.
+func jobNotFound(output string) bool {
+	return strings.Contains(strings.ToLower(output), "invalid job id")
+}
+
+// scontrolFields splits a line of scontrol -o show job output into its
+// KEY=VALUE fields. Values with spaces, such as a JobName, are cut short;
+// the fields exp reads have none.
+func scontrolFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, f := range strings.Fields(line) {
+		if key, value, ok := strings.Cut(f, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// parseScontrolJobs parses scontrol -o show job output, one line per job,
+// keyed by job ID; an array task is keyed as squeue prints it, JOBID_TASK.
+// Error lines, such as for a job id scontrol no longer knows, are skipped.
+func parseScontrolJobs(out string) map[string]jobState {
+	states := make(map[string]jobState)
+	for _, line := range strings.Split(out, "\n") {
+		f := scontrolFields(line)
+		if f["JobId"] == "" || f["JobState"] == "" {
+			continue
+		}
+		state, _ := splitSlurmState(f["JobState"])
+		st := jobState{
+			Status:  state,
+			End:     parseSlurmTime(f["EndTime"]),
+			Outcome: jobOutcome{ExitCode: f["ExitCode"], Reason: f["Reason"], MaxRSS: -1},
+		}
+		states[f["JobId"]] = st
+		if f["ArrayJobId"] != "" && f["ArrayTaskId"] != "" {
+			states[f["ArrayJobId"]+"_"+f["ArrayTaskId"]] = st
+		}
+	}
+	return states
+}
+
+// scontrolScript shows each of jobIDs in turn. An unknown job makes scontrol
+// exit 1, which must not hide the others, so the script always succeeds.
+func scontrolScript(cluster string, jobIDs []string) string {
+	quoted := make([]string, len(jobIDs))
+	for i, id := range jobIDs {
+		quoted[i] = shellQuote(id)
+	}
+	scontrol := strings.Join(slurmArgs(cluster, "scontrol", "-o", "show", "job"), " ")
+	return fmt.Sprintf("for j in %s; do %s \"$j\" 2>&1; done; true", strings.Join(quoted, " "), scontrol)
+}
+
+// runScontrol asks scontrol on cluster for jobIDs in one ssh session. The
+// jobs it no longer remembers are missing from the result.
+func runScontrol(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+	out, err := sshCombinedOutput(remote, sshOpts, scontrolScript(cluster, jobIDs))
+	if err != nil {
+		return nil, fmt.Errorf("scontrol: %w (output: %s)", err, strings.TrimSpace(string(out)))
+	}
+	return parseScontrolJobs(string(out)), nil
+}
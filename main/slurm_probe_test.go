@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// What Slurm prints on a cluster without accounting: squeue and scontrol for
+// a job that aged out of slurmctld, sacct for any job, and scontrol -o for a
+// job that ended a minute before and for an array task.
+const (
+	squeueInvalidJob    = "slurm_load_jobs error: Invalid job id specified\n"
+	sacctDisabled       = "Slurm accounting storage is disabled\n"
+	scontrolFinishedJob = "JobId=4242 JobName=train UserId=me(1000) GroupId=me(1000) MCS_label=N/A Priority=1 Nice=0 Account=(null) QOS=normal JobState=FAILED Reason=NonZeroExitCode Dependency=(null) Requeue=1 Restarts=0 BatchFlag=1 Reboot=0 ExitCode=3:0 RunTime=00:01:12 TimeLimit=01:00:00 TimeMin=N/A SubmitTime=2025-03-01T11:58:40 EligibleTime=2025-03-01T11:58:40 StartTime=2025-03-01T11:58:48 EndTime=2025-03-01T12:00:00 Deadline=N/A Partition=gpu NodeList=gpu07 BatchHost=gpu07 NumNodes=1 NumCPUs=8 Command=/home/me/project/train.sbatch WorkDir=/home/me/project StdOut=/scratch/me/logs/train-4242.out\n"
+	scontrolArrayTask   = "JobId=4250 ArrayJobId=4243 ArrayTaskId=7 JobName=sweep JobState=COMPLETED Reason=None ExitCode=0:0 EndTime=2025-03-01T12:05:00\n"
+)
+
+func TestJobStatusProbes(t *testing.T) {
+	if !jobNotFound(squeueInvalidJob) || jobNotFound(sacctDisabled) {
+		t.Error("jobNotFound misread the captured outputs")
+	}
+
+	states := parseScontrolJobs(scontrolFinishedJob + "slurm_load_jobs error: Invalid job id specified\n" + scontrolArrayTask)
+	st, ok := states["4242"]
+	if !ok || st.Status != "FAILED" || st.Outcome.ExitCode != "3:0" || st.Outcome.Reason != "NonZeroExitCode" {
+		t.Fatalf("scontrol job = %+v, %v", st, ok)
+	}
+	if want := parseSlurmTime("2025-03-01T12:00:00"); !st.End.Equal(want) {
+		t.Errorf("end = %v, want %v", st.End, want)
+	}
+	if got := st.Outcome.reason(st.Status); got != "exit code 3; Slurm reason NonZeroExitCode" {
+		t.Errorf("reason = %q", got)
+	}
+	if states["4243_7"].Status != "COMPLETED" || len(states) != 3 {
+		t.Errorf("array task: %+v", states)
+	}
+}
+
+func TestQueryJobStatusWithoutAccounting(t *testing.T) {
+	bin := t.TempDir()
+	fake := filepath.Join(t.TempDir(), "scontrol.out")
+	writeScript := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript("squeue", "printf '%s' "+shellQuote(squeueInvalidJob)+"; exit 1")
+	writeScript("sacct", "printf '%s' "+shellQuote(sacctDisabled)+"; exit 1")
+	writeScript("scontrol", `if [ -s `+shellQuote(fake)+` ]; then cat `+shellQuote(fake)+`; else echo "slurm_load_jobs error: Invalid job id specified"; exit 1; fi`)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+
+	os.WriteFile(fake, []byte(scontrolFinishedJob), 0o644)
+	if status, err := queryJobStatus("u@h", sshHostOptions{}, "", "4242"); err != nil || status != "FAILED" {
+		t.Errorf("job scontrol remembers = %q, %v", status, err)
+	}
+	states, err := batchJobStatuses("u@h", sshHostOptions{}, "", []string{"4242", "4243"})
+	if err != nil || states["4242"].Status != "FAILED" || len(states) != 1 {
+		t.Errorf("batch = %+v, %v", states, err)
+	}
+
+	os.WriteFile(fake, nil, 0o644)
+	if status, err := queryJobStatus("u@h", sshHostOptions{}, "", "4242"); err != nil || status != "UNKNOWN" {
+		t.Errorf("job nothing remembers = %q, %v", status, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The artifact_sources table holds each experiment's sources, one row per
+// source in submission order. Rows written before the table existed are
+// backfilled by a migration; the config snapshot stays the fallback for an
+// experiment that has none.
+
+// sourceLoadChunk bounds the ids looked up by one query.
+const sourceLoadChunk = 500
+
+// writeArtifactSources replaces the stored sources of experiment id.
+func writeArtifactSources(tx execer, id int64, sources []ArtifactSource) error {
+	if _, err := tx.Exec(`DELETE FROM artifact_sources WHERE experiment_id = ?`, id); err != nil {
+		return err
+	}
+	for i, src := range sources {
+		var include, exclude []string
+		for _, p := range src.Patterns {
+			if body, negated := cutNegation(p); negated {
+				exclude = append(exclude, body)
+			} else {
+				include = append(include, p)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO artifact_sources (experiment_id, position, path, patterns, exclude_patterns,
+                                     name, remote_override, pattern_syntax, flatten, symlinks, prune_dirs)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, i, src.Path, encodeStringList(include), encodeStringList(exclude),
+			src.Name, src.Remote, src.PatternSyntax, boolToInt(src.Flatten), src.Symlinks, encodeStringList(src.PruneDirs),
+		); err != nil {
+			return fmt.Errorf("store artifact source %s: %w", src.Path, err)
+		}
+	}
+	return nil
+}
+
+// loadArtifactSources returns the stored sources of each of ids that has
+// any.
+func loadArtifactSources(db queryer, ids []int64) (map[int64][]ArtifactSource, error) {
+	out := make(map[int64][]ArtifactSource)
+	for start := 0; start < len(ids); start += sourceLoadChunk {
+		chunk := ids[start:min(start+sourceLoadChunk, len(ids))]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		rows, err := db.Query(`SELECT experiment_id, path, patterns, exclude_patterns, name, remote_override,
+                                      pattern_syntax, flatten, symlinks, prune_dirs
+                                 FROM artifact_sources
+                                WHERE experiment_id IN (?`+strings.Repeat(", ?", len(chunk)-1)+`)
+                                ORDER BY experiment_id, position`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				id                                    int64
+				src                                   ArtifactSource
+				include, exclude, name, remote, prune sql.NullString
+				syntax, symlinks                      sql.NullString
+				flatten                               sql.NullInt64
+			)
+			if err := rows.Scan(&id, &src.Path, &include, &exclude, &name, &remote, &syntax, &flatten, &symlinks, &prune); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			src.Patterns = decodeStringList(include.String)
+			for _, p := range decodeStringList(exclude.String) {
+				src.Patterns = append(src.Patterns, "!"+p)
+			}
+			src.Name = name.String
+			src.Remote = remote.String
+			src.PatternSyntax = syntax.String
+			src.Flatten = flatten.Int64 == 1
+			src.Symlinks = symlinks.String
+			src.PruneDirs = decodeStringList(prune.String)
+			out[id] = append(out[id], src)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// attachArtifactSources sets ArtifactSources from the table for every
+// experiment that has rows there, leaving the snapshot's sources on the
+// others.
+func attachArtifactSources(db queryer, exps []*Experiment) error {
+	ids := make([]int64, len(exps))
+	for i, exp := range exps {
+		ids[i] = exp.ID
+	}
+	stored, err := loadArtifactSources(db, ids)
+	if err != nil {
+		return fmt.Errorf("load artifact sources: %w", err)
+	}
+	for _, exp := range exps {
+		if sources, ok := stored[exp.ID]; ok {
+			exp.ArtifactSources = sources
+		}
+	}
+	return nil
+}
+
+// recordedArtifactSources are the sources of an experiment row as written
+// before the table existed: those in its config snapshot or, for rows older
+// than per-source snapshots, one source built from the artifact_remote and
+// artifact_pattern columns.
+func recordedArtifactSources(snapshotJSON, artifactRemote, artifactPattern string) []ArtifactSource {
+	var snap RunSnapshot
+	if snapshotJSON != "" {
+		_ = json.Unmarshal([]byte(snapshotJSON), &snap)
+	}
+	if len(snap.ArtifactSources) > 0 {
+		return copyArtifactSources(snap.ArtifactSources)
+	}
+	if artifactRemote == "" {
+		return nil
+	}
+	return []ArtifactSource{{
+		Path:          artifactRemote,
+		Patterns:      splitPatterns(artifactPattern),
+		PatternSyntax: snap.PatternSyntax,
+	}}
+}
+
+func encodeStringList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+func decodeStringList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var list []string
+	_ = json.Unmarshal([]byte(s), &list)
+	return list
+}
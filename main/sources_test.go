@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestArtifactSourcesTable(t *testing.T) {
+	db := openTestDB(t)
+	snapshot := `{"artifact_sources":[{"path":"/scratch/snap","artifact_patterns":["\\.log$"]}]}`
+	stored := insertTestExperiment(t, db, "stored", "RUNNING", snapshot)
+	legacy := insertTestExperiment(t, db, "legacy", "RUNNING", snapshot)
+
+	sources := []ArtifactSource{
+		{Name: "results", Path: "/scratch/run", Patterns: []string{`\.json$`, "!debug", `\.csv$`}, PatternSyntax: patternSyntaxRegex},
+		{Name: "ckpt", Path: "/scratch/ckpt", Remote: "dtn@h", Flatten: true, Symlinks: symlinksFollow, PruneDirs: []string{"wandb-*"}},
+	}
+	if err := writeArtifactSources(db, stored, sources); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := findExperiment(db, strconv.FormatInt(stored, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Excludes are stored apart from includes and come back after them.
+	want := copyArtifactSources(sources)
+	want[0].Patterns = []string{`\.json$`, `\.csv$`, "!debug"}
+	if !reflect.DeepEqual(exp.EffectiveArtifactSources(), want) {
+		t.Errorf("stored sources = %+v\nwant %+v", exp.EffectiveArtifactSources(), want)
+	}
+	var exclude string
+	if err := db.QueryRow(`SELECT exclude_patterns FROM artifact_sources WHERE experiment_id = ? AND position = 0`, stored).Scan(&exclude); err != nil || exclude != `["debug"]` {
+		t.Errorf("exclude_patterns = %q, %v", exclude, err)
+	}
+
+	// Without rows in the table the snapshot's sources are used.
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range exps {
+		got := exp.EffectiveArtifactSources()
+		switch {
+		case exp.ID == legacy && (len(got) != 1 || got[0].Path != "/scratch/snap"):
+			t.Errorf("legacy sources = %+v", got)
+		case exp.ID == stored && len(got) != 2:
+			t.Errorf("loaded sources = %+v", got)
+		}
+	}
+
+	// Rewriting replaces the previous set.
+	if err := writeArtifactSources(db, stored, sources[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if exp, _ := findExperiment(db, strconv.FormatInt(stored, 10)); len(exp.ArtifactSources) != 1 || exp.ArtifactSources[0].Name != "ckpt" {
+		t.Errorf("rewritten sources = %+v", exp.ArtifactSources)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// With the system ssh, exp shares one connection per remote between all its
+// ssh, scp, sftp and rsync runs (OpenSSH's ControlMaster), so a command that
+// talks to the cluster ten times authenticates, and prompts for 2FA, once.
+// The master outlives exp by controlPersist, which also covers the next few
+// commands. --no-multiplex turns this off.
+
+const controlPersist = "10m"
+
+// maxControlDir is the longest socket directory that fits. A socket path
+// must fit in sun_path, 104 bytes on macOS (108 on Linux), and ssh binds the
+// directory, a slash, %C (40 hex digits) and a 17-byte temporary suffix,
+// plus a NUL.
+const maxControlDir = 104 - 1 - 40 - 17 - 1
+
+var mux struct {
+	once    sync.Once
+	options []string
+}
+
+// sshMuxOptions returns the ssh options that share connections, or nil when
+// multiplexing is off or the socket directory is unusable.
+func sshMuxOptions() []string {
+	mux.once.Do(func() {
+		if globals.NoMultiplex {
+			return
+		}
+		dir, err := controlSocketDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: not sharing ssh connections: %v\n", err)
+			return
+		}
+		removeStaleSockets(dir)
+		mux.options = muxOptions(dir)
+	})
+	return mux.options
+}
+
+func muxOptions(dir string) []string {
+	return []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(dir, "%C"),
+		"-o", "ControlPersist=" + controlPersist,
+	}
+}
+
+// sshBatchMode stops ssh from prompting for passwords, passphrases and host
+// keys, which would hang the monitor daemon on a terminal no one watches; it
+// fails instead and classifySSHError explains why. exp run --interactive-auth
+// turns it off so the foreground run can prompt (and, with connection
+// sharing, the master it opens serves the rest of the run).
+var sshBatchMode = true
+
+// sshArgs returns the arguments for an ssh, scp or sftp run: the host's
+// options (see sshHostOptions), BatchMode and ConnectTimeout, the sharing
+// options, then args. This is the one place the system backend's ssh
+// options are built.
+func sshArgs(host sshHostOptions, args ...string) []string {
+	opts := host.args()
+	if sshBatchMode {
+		opts = append(opts, "-o", "BatchMode=yes")
+	}
+	if timeouts.Connect > 0 {
+		// Whole seconds, rounded up.
+		secs := (timeouts.Connect + time.Second - 1) / time.Second
+		opts = append(opts, "-o", "ConnectTimeout="+strconv.Itoa(int(secs)))
+	}
+	opts = append(opts, sshMuxOptions()...)
+	return append(opts, args...)
+}
+
+// rsyncSSHArgs returns the -e option that makes rsync's ssh use the same
+// options.
+func rsyncSSHArgs(host sshHostOptions) []string {
+	opts := sshArgs(host)
+	if len(opts) == 0 {
+		return nil
+	}
+	return []string{"-e", "ssh " + formatArgs(opts)}
+}
+
+// muxCommand prepares ssh, scp or sftp to contact a host reached with
+// opts; args include the remote (or remote:path) where the command expects
+// it.
+func muxCommand(name string, opts sshHostOptions, args ...string) *loggedCmd {
+	cmd := runCommand(name, sshArgs(opts, args...)...)
+	if mux.options != nil {
+		// The master ssh forks should not hold up Wait if it keeps one
+		// of the command's pipes open.
+		cmd.WaitDelay = time.Second
+	}
+	return cmd
+}
+
+// controlSocketDir returns the private directory for the sockets: sockets
+// under the data directory, or /tmp/exp-UID when that path is too long.
+func controlSocketDir() (string, error) {
+	data, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	dir := chooseSocketDir(data, os.Getuid())
+	if err := os.MkdirAll(dir, privateDirMode); err != nil {
+		return "", err
+	}
+	// /tmp is shared: only use a directory no one else can reach into.
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("%s is not a private directory", dir)
+	}
+	return dir, nil
+}
+
+func chooseSocketDir(data string, uid int) string {
+	if dir := filepath.Join(data, "sockets"); len(dir) <= maxControlDir {
+		return dir
+	}
+	return fmt.Sprintf("/tmp/exp-%d", uid)
+}
+
+// removeStaleSockets deletes the sockets of masters that are gone, such as
+// one killed along with the machine.
+func removeStaleSockets(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.Type()&os.ModeSocket == 0 || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			continue
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			os.Remove(path)
+		}
+	}
+}
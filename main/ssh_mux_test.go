@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func useTestMux(t *testing.T, options []string) {
+	t.Helper()
+	mux.once.Do(func() {})
+	mux.options = options
+	t.Cleanup(func() {
+		mux.once = sync.Once{}
+		mux.options = nil
+	})
+}
+
+func useTestBatchMode(t *testing.T, on bool) {
+	t.Helper()
+	saved := sshBatchMode
+	sshBatchMode = on
+	t.Cleanup(func() { sshBatchMode = saved })
+}
+
+func TestMuxArguments(t *testing.T) {
+	useTestTimeouts(t, commandTimeouts{})
+	useTestBatchMode(t, false)
+	dir := "/home/me/.local/share/exp/sockets"
+	useTestMux(t, muxOptions(dir))
+	want := "-o ControlMaster=auto -o ControlPath=" + dir + "/%C -o ControlPersist=10m u@h hostname"
+	if got := strings.Join(sshArgs(sshHostOptions{}, "u@h", "hostname"), " "); got != want {
+		t.Errorf("sshArgs = %q, want %q", got, want)
+	}
+	if got := strings.Join(systemExecutor{}.Command("u@h", sshHostOptions{}, "hostname").Args, " "); got != "ssh "+want {
+		t.Errorf("ssh command = %q", got)
+	}
+	rsync := rsyncSSHArgs(sshHostOptions{})
+	if len(rsync) != 2 || rsync[0] != "-e" || rsync[1] != "ssh -o ControlMaster=auto -o ControlPath="+dir+"/%C -o ControlPersist=10m" {
+		t.Errorf("rsyncSSHArgs = %q", rsync)
+	}
+
+	// rsync splits -e on spaces, so a path with one is quoted.
+	useTestMux(t, muxOptions("/Users/Jo Doe/exp/sockets"))
+	if got := rsyncSSHArgs(sshHostOptions{})[1]; !strings.Contains(got, "'ControlPath=/Users/Jo Doe/exp/sockets/%C'") {
+		t.Errorf("rsync -e = %q", got)
+	}
+
+	useTestMux(t, nil)
+	if got := strings.Join(sshArgs(sshHostOptions{}, "u@h", "true"), " "); got != "u@h true" {
+		t.Errorf("sshArgs without multiplexing = %q", got)
+	}
+	if rsyncSSHArgs(sshHostOptions{}) != nil {
+		t.Error("rsync should use its default ssh without multiplexing")
+	}
+}
+
+func TestBatchMode(t *testing.T) {
+	useTestMux(t, nil)
+	useTestTimeouts(t, commandTimeouts{})
+	if got := strings.Join(sshArgs(sshHostOptions{}, "u@h", "true"), " "); got != "-o BatchMode=yes u@h true" {
+		t.Errorf("sshArgs = %q", got)
+	}
+	useTestBatchMode(t, false)
+	if got := strings.Join(sshArgs(sshHostOptions{}, "u@h", "true"), " "); got != "u@h true" {
+		t.Errorf("sshArgs with --interactive-auth = %q", got)
+	}
+}
+
+func TestSocketDirFitsSunPath(t *testing.T) {
+	short := "/home/me/.local/share/exp"
+	if got := chooseSocketDir(short, 1000); got != short+"/sockets" {
+		t.Errorf("short data dir: %q", got)
+	}
+	long := "/home/" + strings.Repeat("x", 40) + "/.local/share/exp"
+	if got := chooseSocketDir(long, 1000); got != "/tmp/exp-1000" {
+		t.Errorf("long data dir: %q", got)
+	}
+	// The longest directory chosen still leaves room for what ssh binds.
+	for _, dir := range []string{strings.Repeat("d", maxControlDir), "/tmp/exp-4294967295"} {
+		bound := filepath.Join(dir, strings.Repeat("c", 40)) + "." + strings.Repeat("r", 16)
+		if len(bound) >= 104 {
+			t.Errorf("%d-byte socket path for %s", len(bound), dir)
+		}
+	}
+}
+
+func TestControlSocketDir(t *testing.T) {
+	// A short home keeps the sockets out of the shared /tmp/exp-UID.
+	home, err := os.MkdirTemp("/tmp", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+	t.Setenv("HOME", home)
+	dir, err := controlSocketDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil || dir != filepath.Join(home, ".local", "share", "exp", "sockets") || info.Mode().Perm() != privateDirMode {
+		t.Errorf("socket dir %s: %v, %v", dir, info.Mode(), err)
+	}
+	os.Chmod(dir, 0o755)
+	if _, err := controlSocketDir(); err == nil {
+		t.Error("a directory others can read should be refused")
+	}
+}
+
+func TestRemoveStaleSockets(t *testing.T) {
+	// Unix socket paths must be short; TempDir's may not be.
+	dir, err := os.MkdirTemp("/tmp", "mux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	live, err := net.Listen("unix", filepath.Join(dir, "live"))
+	if err != nil {
+		t.Skipf("unix sockets: %v", err)
+	}
+	defer live.Close()
+	stale, err := net.Listen("unix", filepath.Join(dir, "stale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	os.WriteFile(filepath.Join(dir, "notes"), nil, 0o600)
+
+	removeStaleSockets(dir)
+	for name, want := range map[string]bool{"live": true, "stale": false, "notes": true} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", name, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// nativeExecutor speaks SSH itself (ssh_backend: native), for machines
+// without an ssh binary. It keeps one connection per host for the life of
+// the process, so the monitor does not reconnect on every poll.
+//
+// It authenticates with the ssh-agent at SSH_AUTH_SOCK and with unencrypted
+// key files (ssh_identity_files, default ~/.ssh/id_ed25519, id_ecdsa and
+// id_rsa), and only accepts hosts whose key is in ~/.ssh/known_hosts. It
+// does not read ~/.ssh/config: remotes must name the real host, on port 22
+// unless ssh_port says otherwise. ssh_proxy_jump and ssh_options need the
+// system backend.
+type nativeExecutor struct {
+	identityFiles []string // empty for the defaults
+	knownHosts    []string // empty for ~/.ssh/known_hosts
+	port          string
+	dialTimeout   time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*ssh.Client
+}
+
+func newNativeExecutor(identityFiles []string) *nativeExecutor {
+	return &nativeExecutor{identityFiles: identityFiles, port: "22", dialTimeout: timeouts.Connect, clients: make(map[string]*ssh.Client)}
+}
+
+func (e *nativeExecutor) Command(remote string, opts sshHostOptions, args ...string) *loggedCmd {
+	return &loggedCmd{
+		Cmd:     &exec.Cmd{Path: "ssh", Args: append([]string{"ssh", remote}, args...)},
+		session: &nativeSession{exec: e, remote: remote, opts: opts, command: strings.Join(args, " ")},
+		timeout: timeouts.Command,
+	}
+}
+
+// Upload streams the file into cat on the remote host.
+func (e *nativeExecutor) Upload(local, remote string, opts sshHostOptions, path string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cmd := e.Command(remote, opts, "cat", ">", shellQuote(path)).withTimeout(timeouts.Transfer)
+	cmd.Stdin = f
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Close drops every connection.
+func (e *nativeExecutor) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, c := range e.clients {
+		c.Close()
+		delete(e.clients, key)
+	}
+}
+
+// newSession opens a session on remote's connection, dialing it first if
+// needed. A connection that has gone away (the laptop slept, say) is
+// replaced once.
+func (e *nativeExecutor) newSession(remote string, opts sshHostOptions) (*ssh.Session, error) {
+	key := clientKey(remote, opts)
+	for attempt := 0; ; attempt++ {
+		client, err := e.client(remote, opts)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := client.NewSession()
+		if err == nil || attempt > 0 {
+			return sess, err
+		}
+		e.mu.Lock()
+		if e.clients[key] == client {
+			delete(e.clients, key)
+		}
+		e.mu.Unlock()
+		client.Close()
+	}
+}
+
+// clientKey tells connections apart: one host reached with other options
+// (another port or key) gets its own.
+func clientKey(remote string, opts sshHostOptions) string {
+	return strings.Join(append([]string{remote}, opts.args()...), " ")
+}
+
+func (e *nativeExecutor) client(remote string, opts sshHostOptions) (*ssh.Client, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := clientKey(remote, opts)
+	if c := e.clients[key]; c != nil {
+		return c, nil
+	}
+	user, host, ok := strings.Cut(remote, "@")
+	if !ok {
+		return nil, fmt.Errorf("remote %q must be in user@host form", remote)
+	}
+	if opts.ProxyJump != "" || len(opts.Options) > 0 {
+		return nil, fmt.Errorf("ssh %s: ssh_proxy_jump and ssh_options need ssh_backend: system", remote)
+	}
+	port := e.port
+	if opts.Port != 0 {
+		port = strconv.Itoa(opts.Port)
+	}
+	addr := net.JoinHostPort(host, port)
+	hostKeys, algorithms, err := e.hostKeyCallback(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:              user,
+		Auth:              []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) { return e.signers(opts.Identity) })},
+		HostKeyCallback:   hostKeys,
+		HostKeyAlgorithms: algorithms,
+		Timeout:           e.dialTimeout,
+	}
+	c, err := e.dial(addr, config)
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("ssh %s: host key not in known_hosts; connect once with the ssh binary or add it with ssh-keyscan", remote)
+		}
+		return nil, fmt.Errorf("ssh %s: %w", remote, err)
+	}
+	e.clients[key] = c
+	return c, nil
+}
+
+// dial connects to addr. Like ssh's ConnectTimeout, dialTimeout bounds the
+// handshake as well as the TCP connection, so a host that accepts but never
+// answers does not hang exp.
+func (e *nativeExecutor) dial(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if config.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(config.Timeout))
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// hostKeyCallback checks host keys against known_hosts. It also returns the
+// key algorithms known_hosts has for addr, so the server is asked for a key
+// that can be checked rather than its preferred one.
+func (e *nativeExecutor) hostKeyCallback(addr string) (ssh.HostKeyCallback, []string, error) {
+	files := e.knownHosts
+	if len(files) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+	}
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("known_hosts: %w", err)
+	}
+	// Asking about a throwaway key lists the keys on file for addr.
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	var keyErr *knownhosts.KeyError
+	var algorithms []string
+	if err := callback(addr, &net.TCPAddr{}, probe); errors.As(err, &keyErr) {
+		for _, k := range keyErr.Want {
+			if k.Key.Type() == ssh.KeyAlgoRSA {
+				algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+			}
+			algorithms = append(algorithms, k.Key.Type())
+		}
+	}
+	return callback, algorithms, nil
+}
+
+// signers are the keys offered to the server: the agent's, then identity's
+// (the host's ssh_identity), then the key files'. Passphrase-protected key
+// files are skipped; load them into the agent instead.
+func (e *nativeExecutor) signers(identity string) ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			if s, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, s...)
+			}
+		}
+	}
+	files := e.identityFiles
+	if len(files) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return signers, nil
+		}
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			files = append(files, filepath.Join(home, ".ssh", name))
+		}
+	}
+	if identity != "" {
+		files = append([]string{identity}, files...)
+	}
+	for _, path := range files {
+		abs, err := expandLocalPath(path)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			continue
+		}
+		if s, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, s)
+		}
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no ssh-agent keys or unencrypted identity files to authenticate with")
+	}
+	return signers, nil
+}
+
+// nativeSession runs one loggedCmd over a nativeExecutor connection.
+type nativeSession struct {
+	exec    *nativeExecutor
+	remote  string
+	opts    sshHostOptions
+	command string
+
+	sess  *ssh.Session
+	pipes []*io.PipeWriter // closed once the command exits
+	done  chan error
+}
+
+func (s *nativeSession) start(c *loggedCmd) error {
+	sess, err := s.exec.newSession(s.remote, s.opts)
+	if err != nil {
+		return err
+	}
+	sess.Stdin, sess.Stdout, sess.Stderr = c.Stdin, c.Stdout, c.Stderr
+	if err := sess.Start(s.command); err != nil {
+		sess.Close()
+		return err
+	}
+	s.sess = sess
+	s.done = make(chan error, 1)
+	// Waiting here rather than in Wait ends a StdoutPipe reader's stream
+	// when the command exits, as with a process.
+	go func() {
+		err := sess.Wait()
+		sess.Close()
+		for _, pw := range s.pipes {
+			pw.Close()
+		}
+		s.done <- err
+	}()
+	return nil
+}
+
+func (s *nativeSession) stdoutPipe(c *loggedCmd) (io.ReadCloser, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	pr, pw := io.Pipe()
+	c.Stdout = pw
+	s.pipes = append(s.pipes, pw)
+	return pr, nil
+}
+
+func (s *nativeSession) wait() error {
+	if s.done == nil {
+		return errors.New("exec: not started")
+	}
+	return <-s.done
+}
+
+// kill ends the command by closing its channel.
+func (s *nativeSession) kill() {
+	if s.sess != nil {
+		s.sess.Close()
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer runs exec requests with sh, accepting one client key.
+type testSSHServer struct {
+	addr        string
+	hostKey     ssh.PublicKey
+	connections atomic.Int32
+}
+
+func startTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostSigner)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &testSSHServer{addr: ln.Addr().String(), hostKey: hostSigner.PublicKey()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	s.connections.Add(1)
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range reqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				command := string(req.Payload[4:])
+				cmd := exec.Command("sh", "-c", command)
+				cmd.Stdin, cmd.Stdout, cmd.Stderr = ch, ch, ch.Stderr()
+				status := uint32(0)
+				if err := cmd.Run(); err != nil {
+					status = uint32(cmd.ProcessState.ExitCode())
+				}
+				payload := make([]byte, 4)
+				binary.BigEndian.PutUint32(payload, status)
+				ch.SendRequest("exit-status", false, payload)
+				ch.Close()
+			}
+		}()
+	}
+}
+
+func newTestNativeExecutor(t *testing.T) (*nativeExecutor, *testSSHServer, string) {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startTestSSHServer(t, sshPub)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, server.hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(server.addr)
+	e := newNativeExecutor([]string{keyPath})
+	e.knownHosts = []string{knownHosts}
+	e.port = port
+	t.Cleanup(e.Close)
+	return e, server, "tester@" + host
+}
+
+func TestNativeExecutor(t *testing.T) {
+	e, server, remote := newTestNativeExecutor(t)
+
+	out, err := e.Command(remote, sshHostOptions{}, "echo", shellQuote("run one;"), "&&", "echo", "oops", ">&2", "&&", "exit", "3").CombinedOutput()
+	if code, ok := exitCode(err); !ok || code != 3 {
+		t.Fatalf("exit code = %d, %v (%v)", code, ok, err)
+	}
+	if !strings.Contains(string(out), "run one;") || !strings.Contains(string(out), "oops") {
+		t.Errorf("output = %q", out)
+	}
+
+	// A streamed listing ends when the command does.
+	cmd := e.Command(remote, sshHostOptions{}, "seq", "1", "3")
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for sc := bufio.NewScanner(pipe); sc.Scan(); {
+		lines = append(lines, sc.Text())
+	}
+	if err := cmd.Wait(); err != nil || strings.Join(lines, ",") != "1,2,3" {
+		t.Errorf("streamed lines = %q, %v", lines, err)
+	}
+
+	local := filepath.Join(t.TempDir(), "job.sbatch")
+	if err := os.WriteFile(local, []byte("#!/bin/bash\necho 'it''s here'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(t.TempDir(), "uploaded dir", "job.sbatch")
+	os.MkdirAll(filepath.Dir(target), 0o755)
+	if err := e.Upload(local, remote, sshHostOptions{}, target); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "#!/bin/bash\necho 'it''s here'\n" {
+		t.Errorf("uploaded %q, %v", data, err)
+	}
+
+	if n := server.connections.Load(); n != 1 {
+		t.Errorf("%d connections for four commands, want 1", n)
+	}
+}
+
+func TestNativeExecutorUnknownHost(t *testing.T) {
+	e, _, remote := newTestNativeExecutor(t)
+	empty := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e.knownHosts = []string{empty}
+	err := e.Command(remote, sshHostOptions{}, "true").Run()
+	if err == nil || !strings.Contains(err.Error(), "known_hosts") {
+		t.Errorf("unknown host: %v", err)
+	}
+}
+
+func TestNewRemoteExecutor(t *testing.T) {
+	for backend, want := range map[string]string{"": "main.systemExecutor", "system": "main.systemExecutor", "native": "*main.nativeExecutor"} {
+		e, err := newRemoteExecutor(backend, nil)
+		if err != nil || fmt.Sprintf("%T", e) != want {
+			t.Errorf("newRemoteExecutor(%q) = %T, %v", backend, e, err)
+		}
+	}
+	if _, err := newRemoteExecutor("openssh", nil); err == nil {
+		t.Error("unknown backend should fail")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// sshHostOptions say how to reach a cluster that ~/.ssh/config would
+// otherwise have to describe: the ssh_identity, ssh_port, ssh_proxy_jump and
+// ssh_options fields of a profile, run config or snapshot (and exp run's
+// --ssh-* flags). They apply to every host an experiment contacts: its
+// remote, transfer_remote and artifact source remotes. Loading an
+// experiment puts them in Experiment.SSH, and every ssh, scp, sftp and
+// rsync run is handed the options of the experiment it is for.
+type sshHostOptions struct {
+	Identity  string   // a local key file
+	Port      int      // 0 for ssh's default
+	ProxyJump string   // user@bastion[:port]
+	Options   []string // ssh -o values, e.g. ServerAliveInterval=30
+}
+
+// sshOptionPattern is an ssh_config keyword followed by = or a space.
+var sshOptionPattern = regexp.MustCompile(`^[A-Za-z]+[= ]`)
+
+// fill sets the options o does not have yet from other, the way exp run
+// lets flags override profiles and profiles override run configs.
+func (o *sshHostOptions) fill(other sshHostOptions) {
+	if o.Identity == "" {
+		o.Identity = other.Identity
+	}
+	if o.Port == 0 {
+		o.Port = other.Port
+	}
+	if o.ProxyJump == "" {
+		o.ProxyJump = other.ProxyJump
+	}
+	if len(o.Options) == 0 {
+		o.Options = append([]string(nil), other.Options...)
+	}
+}
+
+func (o sshHostOptions) validate() error {
+	if o.Port < 0 || o.Port > 65535 {
+		return fmt.Errorf("ssh_port %d is not a TCP port", o.Port)
+	}
+	for _, opt := range o.Options {
+		if !sshOptionPattern.MatchString(opt) {
+			return fmt.Errorf("ssh_options entry %q must look like Keyword=value (as given to ssh -o)", opt)
+		}
+	}
+	return nil
+}
+
+// args returns the options as ssh -o arguments, which scp, sftp and the ssh
+// rsync runs take alike (unlike -p/-P for the port).
+func (o sshHostOptions) args() []string {
+	var args []string
+	if o.Identity != "" {
+		args = append(args, "-o", "IdentityFile="+o.Identity)
+	}
+	if o.Port != 0 {
+		args = append(args, "-o", "Port="+strconv.Itoa(o.Port))
+	}
+	if o.ProxyJump != "" {
+		args = append(args, "-o", "ProxyJump="+o.ProxyJump)
+	}
+	for _, opt := range o.Options {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
+
+// sshHostOptions returns the options a snapshot recorded.
+func (s RunSnapshot) sshHostOptions() sshHostOptions {
+	return sshHostOptions{Identity: s.SSHIdentity, Port: s.SSHPort, ProxyJump: s.SSHProxyJump, Options: s.SSHOptions}
+}
+
+// setSSHOptions records the options in the snapshot.
+func (s *RunSnapshot) setSSHOptions(o sshHostOptions) {
+	s.SSHIdentity, s.SSHPort, s.SSHProxyJump = o.Identity, o.Port, o.ProxyJump
+	s.SSHOptions = append([]string(nil), o.Options...)
+}
+
+func (p RunProfile) sshHostOptions() sshHostOptions {
+	return sshHostOptions{Identity: p.SSHIdentity, Port: int(p.SSHPort), ProxyJump: p.SSHProxyJump, Options: p.SSHOptions}
+}
+
+func (c RunConfigFile) sshHostOptions() sshHostOptions {
+	return sshHostOptions{Identity: c.SSHIdentity, Port: int(c.SSHPort), ProxyJump: c.SSHProxyJump, Options: c.SSHOptions}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSSHHostOptions(t *testing.T) {
+	flags := sshHostOptions{Port: 2222}
+	flags.fill(sshHostOptions{Port: 22, Identity: "~/.ssh/cluster", Options: []string{"ServerAliveInterval=30"}})
+	flags.fill(sshHostOptions{ProxyJump: "u@bastion", Options: []string{"Compression=yes"}})
+	want := "-o IdentityFile=~/.ssh/cluster -o Port=2222 -o ProxyJump=u@bastion -o ServerAliveInterval=30"
+	if got := strings.Join(flags.args(), " "); got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	if err := flags.validate(); err != nil {
+		t.Error(err)
+	}
+	for _, bad := range []sshHostOptions{{Port: 70000}, {Options: []string{"-v"}}, {Options: []string{"ServerAliveInterval"}}} {
+		if bad.validate() == nil {
+			t.Errorf("%+v should not validate", bad)
+		}
+	}
+	if (sshHostOptions{Options: []string{"ProxyCommand ssh -W %h:%p gw"}}).validate() != nil {
+		t.Error("Keyword value is a valid -o")
+	}
+}
+
+func TestSSHArgsUseHostOptions(t *testing.T) {
+	useTestMux(t, nil)
+	useTestTimeouts(t, commandTimeouts{})
+	useTestBatchMode(t, false)
+	opts := sshHostOptions{Port: 2222, ProxyJump: "u@bastion", Options: []string{"ProxyCommand=ssh -W %h:%p gw"}}
+
+	if got := strings.Join(systemExecutor{}.Command("u@dtn", opts, "hostname").Args, " "); got != "ssh -o Port=2222 -o ProxyJump=u@bastion -o ProxyCommand=ssh -W %h:%p gw u@dtn hostname" {
+		t.Errorf("ssh = %q", got)
+	}
+	if got := strings.Join(systemExecutor{}.Command("u@other", sshHostOptions{}, "hostname").Args, " "); got != "ssh u@other hostname" {
+		t.Errorf("a host without options: %q", got)
+	}
+	rsync := rsyncSSHArgs(opts)
+	if len(rsync) != 2 || rsync[1] != "ssh -o Port=2222 -o ProxyJump=u@bastion -o 'ProxyCommand=ssh -W %h:%p gw'" {
+		t.Errorf("rsync -e = %q", rsync)
+	}
+}
+
+func TestSnapshotSSHOptionsApplyOnLoad(t *testing.T) {
+	db := openTestDB(t)
+	var snap RunSnapshot
+	snap.Remote, snap.TransferRemote = "u@h", "u@dtn"
+	snap.setSSHOptions(sshHostOptions{Identity: "/keys/cluster", Port: 2222})
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := insertTestExperiment(t, db, "remote-options", "COMPLETED", string(data))
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exp.SSH; got.Identity != "/keys/cluster" || got.Port != 2222 {
+		t.Errorf("options after loading = %+v", got)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// sshErrorClass says why a remote command failed, from its error and output.
+type sshErrorClass int
+
+const (
+	sshErrRemote         sshErrorClass = iota // the command ran on the host and failed
+	sshErrRefused                             // nothing accepted the connection
+	sshErrUnreachable                         // no route to the host, or its name did not resolve
+	sshErrTimeout                             // the connection timed out
+	sshErrDropped                             // the connection failed or broke for another reason
+	sshErrHostKey                             // the host key is not in known_hosts
+	sshErrHostKeyChanged                      // the host key differs from the one in known_hosts
+	sshErrAuth                                // the host rejected our credentials
+)
+
+func (c sshErrorClass) String() string {
+	switch c {
+	case sshErrRefused:
+		return "connection refused"
+	case sshErrUnreachable:
+		return "host unreachable"
+	case sshErrTimeout:
+		return "connection timed out"
+	case sshErrDropped:
+		return "connection failed"
+	case sshErrHostKey:
+		return "host key not known"
+	case sshErrHostKeyChanged:
+		return "host key changed"
+	case sshErrAuth:
+		return "authentication failed"
+	}
+	return "remote command failed"
+}
+
+// transient reports whether trying again later may succeed: network
+// trouble, not a rejected key or a command that failed.
+func (c sshErrorClass) transient() bool {
+	switch c {
+	case sshErrRefused, sshErrUnreachable, sshErrTimeout, sshErrDropped:
+		return true
+	}
+	return false
+}
+
+// beforeCommand reports whether the failure certainly came before the
+// remote command started, so running it again cannot repeat it.
+func (c sshErrorClass) beforeCommand() bool {
+	switch c {
+	case sshErrRefused, sshErrUnreachable, sshErrHostKey, sshErrHostKeyChanged, sshErrAuth:
+		return true
+	}
+	return false
+}
+
+// hint says how to fix a failure that will not go away by itself, or is
+// empty. ssh runs with BatchMode, so these fail rather than prompt.
+func (c sshErrorClass) hint(remote string) string {
+	_, host, _ := strings.Cut(remote, "@")
+	if host == "" {
+		host = remote
+	}
+	switch c {
+	case sshErrHostKey:
+		return fmt.Sprintf("%s's host key is not in ~/.ssh/known_hosts; run ssh %s once to check and accept it", host, remote)
+	case sshErrHostKeyChanged:
+		return fmt.Sprintf("%s's host key has changed since it was recorded. If its admins expected this (a reinstall, say), remove the old key with ssh-keygen -R %s; otherwise someone may be intercepting the connection", host, host)
+	case sshErrAuth:
+		return fmt.Sprintf("%s accepted none of your keys; load yours with ssh-add or set ssh_identity, or rerun exp run with --interactive-auth to type a password or 2FA code", host)
+	}
+	return ""
+}
+
+// sshErrorPatterns map (lowercased) messages from ssh, and from the native
+// backend's Go errors, to their class. The first match wins, so the
+// specific ones come first.
+var sshErrorPatterns = []struct {
+	text  string
+	class sshErrorClass
+}{
+	{"remote host identification has changed", sshErrHostKeyChanged},
+	{"knownhosts: key mismatch", sshErrHostKeyChanged},
+	{"host key verification failed", sshErrHostKey},
+	{"host key not in known_hosts", sshErrHostKey},
+	{"permission denied (", sshErrAuth},
+	{"too many authentication failures", sshErrAuth},
+	{"unable to authenticate", sshErrAuth},
+	{"connection refused", sshErrRefused},
+	{"could not resolve hostname", sshErrUnreachable},
+	{"no such host", sshErrUnreachable},
+	{"name or service not known", sshErrUnreachable},
+	{"temporary failure in name resolution", sshErrUnreachable},
+	{"network is unreachable", sshErrUnreachable},
+	{"no route to host", sshErrUnreachable},
+	{"timed out", sshErrTimeout},
+	{"i/o timeout", sshErrTimeout},
+	{"not responding", sshErrTimeout},
+	{"connection reset", sshErrDropped},
+	{"connection closed", sshErrDropped},
+	{"broken pipe", sshErrDropped},
+	{"exchange_identification", sshErrDropped},
+	{"ssh: handshake failed", sshErrDropped},
+	{"without exit status", sshErrDropped},
+}
+
+// classifySSHError classifies err, a failed remote command, using output,
+// what the command wrote (ssh's own messages go to stderr).
+func classifySSHError(err error, output string) sshErrorClass {
+	var te *commandTimeoutError
+	if errors.As(err, &te) {
+		return sshErrTimeout
+	}
+	code, exited := exitCode(err)
+	if exited && code != 255 {
+		// ssh exits 255 for its own failures; anything else is the
+		// command's status.
+		return sshErrRemote
+	}
+	text := strings.ToLower(err.Error() + "\n" + output)
+	for _, p := range sshErrorPatterns {
+		if strings.Contains(text, p.text) {
+			return p.class
+		}
+	}
+	if exited {
+		return sshErrDropped
+	}
+	return sshErrRemote
+}
+
+// sshError is a remote command that still failed after retries. Its
+// message ends with the class's hint.
+type sshError struct {
+	Remote   string
+	Class    sshErrorClass
+	Attempts int
+	err      error
+}
+
+func (e *sshError) Error() string {
+	msg := fmt.Sprintf("%v (%s)", e.err, e.Class)
+	if e.Attempts > 1 {
+		msg = fmt.Sprintf("%v (%s; gave up after %d attempts)", e.err, e.Class, e.Attempts)
+	}
+	if hint := e.Class.hint(e.Remote); hint != "" {
+		msg += ". " + hint
+	}
+	return msg
+}
+
+func (e *sshError) Unwrap() error { return e.err }
+
+// retryPolicy is how often, and how patiently, a transient failure is
+// retried: Attempts tries in all, waiting Initial, then twice as long each
+// time up to Max.
+type retryPolicy struct {
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+// sshRetryPolicy covers a VPN or Wi-Fi blip of about a minute.
+var sshRetryPolicy = retryPolicy{Attempts: 5, Initial: 2 * time.Second, Max: 30 * time.Second}
+
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := p.Initial
+	for i := 1; i < retry && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// retrySSH runs attempt, a command on remote, until it succeeds, fails for a
+// reason that is not transient, or uses up p. attempt returns the command's
+// output for classifySSHError. Failures other than a remote command's own
+// are returned as an *sshError; the remote command's are returned as they
+// are.
+func retrySSH(w io.Writer, remote, what string, p retryPolicy, sleep func(time.Duration), attempt func() (string, error)) error {
+	for n := 1; ; n++ {
+		output, err := attempt()
+		if err == nil {
+			return nil
+		}
+		if stopCommands.Err() != nil {
+			return err
+		}
+		class := classifySSHError(err, output)
+		if class == sshErrRemote {
+			return err
+		}
+		if !class.transient() || n >= p.Attempts {
+			return &sshError{Remote: remote, Class: class, Attempts: n, err: err}
+		}
+		wait := p.delay(n)
+		fmt.Fprintf(w, "%s: %s; retrying in %s (retry %d of %d)\n", what, class, wait, n, p.Attempts-1)
+		sleep(wait)
+	}
+}
+
+// sshCombinedOutput runs args on remote and returns what it wrote to stdout
+// and stderr, retrying transient failures (see retrySSH).
+func sshCombinedOutput(remote string, sshOpts sshHostOptions, args ...string) ([]byte, error) {
+	var out []byte
+	err := retrySSH(os.Stderr, remote, "ssh "+remote, sshRetryPolicy, time.Sleep, func() (string, error) {
+		var err error
+		out, err = sshCommand(remote, sshOpts, args...).CombinedOutput()
+		return string(out), err
+	})
+	return out, err
+}
+
+// isTransientSSHError reports whether err is a network failure that outlasted
+// its retries, as opposed to a rejected login or a failed remote command.
+func isTransientSSHError(err error) bool {
+	var se *sshError
+	return errors.As(err, &se) && se.Class.transient()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exitErr returns the error of a process that exited with code.
+func exitErr(t *testing.T, code int) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", "exit "+strconv.Itoa(code)).Run()
+	if _, ok := exitCode(err); !ok {
+		t.Fatalf("exit %d: %v", code, err)
+	}
+	return err
+}
+
+func TestClassifySSHError(t *testing.T) {
+	tests := []struct {
+		code   int // 0 for an error that is not an exit status
+		err    string
+		output string
+		want   sshErrorClass
+	}{
+		{255, "", "ssh: connect to host login port 22: Connection refused", sshErrRefused},
+		{255, "", "ssh: Could not resolve hostname login.example.edu: Name or service not known", sshErrUnreachable},
+		{255, "", "ssh: connect to host login port 22: Network is unreachable", sshErrUnreachable},
+		{255, "", "ssh: connect to host login port 22: Operation timed out", sshErrTimeout},
+		{255, "", "Timeout, server login not responding.", sshErrTimeout},
+		{255, "", "Connection reset by peer", sshErrDropped},
+		{255, "", "kex_exchange_identification: read: Connection reset by peer", sshErrDropped},
+		{255, "", "Connection to login closed by remote host.", sshErrDropped},
+		{255, "", "", sshErrDropped},
+		{255, "", "Host key verification failed.", sshErrHostKey},
+		{255, "", hostKeyChangedOutput, sshErrHostKeyChanged},
+		{255, "", "No ED25519 host key is known for login and you have requested strict checking.\nHost key verification failed.", sshErrHostKey},
+		{255, "", "u@login: Permission denied (publickey).", sshErrAuth},
+		{255, "", "u@login: Permission denied (publickey,keyboard-interactive).", sshErrAuth},
+		{1, "", "slurm_load_jobs error: Invalid job id specified", sshErrRemote},
+		{1, "", "find: '/scratch/x': Permission denied", sshErrRemote},
+		{2, "", "ssh: connect to host login port 22: Connection refused", sshErrRemote},
+		// The native backend reports Go errors instead.
+		{0, "ssh u@login: dial tcp 10.0.0.1:22: connect: connection refused", "", sshErrRefused},
+		{0, "ssh u@login: dial tcp 10.0.0.1:22: i/o timeout", "", sshErrTimeout},
+		{0, "ssh u@login: dial tcp: lookup login: no such host", "", sshErrUnreachable},
+		{0, "ssh u@login: ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey]", "", sshErrAuth},
+		{0, "ssh u@login: host key not in known_hosts; connect once with the ssh binary", "", sshErrHostKey},
+		{0, "ssh u@login: ssh: handshake failed: knownhosts: key mismatch", "", sshErrHostKeyChanged},
+		{0, "wait: remote command exited without exit status or exit signal", "", sshErrDropped},
+		{0, `exec: "ssh": executable file not found in $PATH`, "", sshErrRemote},
+	}
+	for _, tt := range tests {
+		err := errors.New(tt.err)
+		if tt.code != 0 {
+			err = exitErr(t, tt.code)
+		}
+		if got := classifySSHError(err, tt.output); got != tt.want {
+			t.Errorf("classify(%d, %q, %q) = %s, want %s", tt.code, tt.err, tt.output, got, tt.want)
+		}
+	}
+}
+
+// hostKeyChangedOutput is what ssh prints when a host's key has changed.
+const hostKeyChangedOutput = `@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!
+Someone could be eavesdropping on you right now (man-in-the-middle attack)!
+It is also possible that a host key has just been changed.
+The fingerprint for the ED25519 key sent by the remote host is
+SHA256:2oH9bJmSW0xHc3Pd1hxUpV6ZV3Xy/6b0ajfH3Gq3hLo.
+Please contact your system administrator.
+Add correct host key in /home/me/.ssh/known_hosts to get rid of this message.
+Offending ED25519 key in /home/me/.ssh/known_hosts:12
+Host key for login has changed and you have requested strict checking.
+Host key verification failed.`
+
+func TestSSHErrorHints(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"u@login: Permission denied (publickey).", "ssh-add"},
+		{hostKeyChangedOutput, "ssh-keygen -R login"},
+		{"Host key verification failed.", "run ssh u@login once"},
+	}
+	for _, tt := range tests {
+		err := retrySSH(io.Discard, "u@login", "test", sshRetryPolicy, func(time.Duration) { t.Fatal("retried") }, func() (string, error) {
+			return tt.output, exitErr(t, 255)
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%.40q: err = %v, want a hint with %q", tt.output, err, tt.want)
+		}
+	}
+	if hint := sshErrDropped.hint("u@login"); hint != "" {
+		t.Errorf("a dropped connection has a hint: %q", hint)
+	}
+}
+
+func TestRetrySSH(t *testing.T) {
+	refused := errors.New("dial tcp: connect: connection refused")
+	denied := errors.New("ssh: unable to authenticate")
+	failed := errors.New("exec: not started")
+	policy := retryPolicy{Attempts: 4, Initial: time.Second, Max: 3 * time.Second}
+	tests := []struct {
+		name     string
+		results  []error
+		attempts int
+		sleeps   []time.Duration
+		class    sshErrorClass // of a returned *sshError; -1 when err is returned as is
+	}{
+		{"success", []error{nil}, 1, nil, -1},
+		{"recovers", []error{refused, refused, nil}, 3, []time.Duration{time.Second, 2 * time.Second}, -1},
+		{"gives up", []error{refused, refused, refused, refused, nil}, 4, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, sshErrRefused},
+		{"auth is not retried", []error{denied, nil}, 1, nil, sshErrAuth},
+		{"command errors are not retried", []error{failed, nil}, 1, nil, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sleeps []time.Duration
+			n := 0
+			err := retrySSH(io.Discard, "u@h", "test", policy, func(d time.Duration) { sleeps = append(sleeps, d) }, func() (string, error) {
+				n++
+				return "", tt.results[n-1]
+			})
+			if n != tt.attempts || len(sleeps) != len(tt.sleeps) {
+				t.Fatalf("%d attempts, sleeps %v", n, sleeps)
+			}
+			for i := range sleeps {
+				if sleeps[i] != tt.sleeps[i] {
+					t.Errorf("sleeps = %v, want %v", sleeps, tt.sleeps)
+				}
+			}
+			var se *sshError
+			switch {
+			case tt.class < 0 && errors.As(err, &se):
+				t.Errorf("err = %v, want it unwrapped", err)
+			case tt.class >= 0 && (!errors.As(err, &se) || se.Class != tt.class || se.Attempts != n):
+				t.Errorf("err = %#v, want class %s", err, tt.class)
+			}
+		})
+	}
+}
+
+// localExecutor runs "remote" commands with the local shell. Each call
+// takes the next of failures, which may make it fail as ssh does, before the
+// command runs or after.
+type localExecutor struct {
+	calls    []string
+	failures []localFailure
+}
+
+type localFailure struct {
+	ran    bool
+	stderr string
+}
+
+func (e *localExecutor) Command(remote string, _ sshHostOptions, args ...string) *loggedCmd {
+	line := strings.Join(args, " ")
+	e.calls = append(e.calls, line)
+	if len(e.failures) > 0 {
+		f := e.failures[0]
+		e.failures = e.failures[1:]
+		fail := "echo " + shellQuote(f.stderr) + " >&2; exit 255"
+		if f.ran {
+			fail = "(" + line + ") >/dev/null 2>&1; " + fail
+		}
+		return runCommand("sh", "-c", fail)
+	}
+	return runCommand("sh", "-c", line)
+}
+
+func (e *localExecutor) Upload(local, remote string, _ sshHostOptions, path string) error { return nil }
+
+func TestSubmitRetriesWithoutResubmitting(t *testing.T) {
+	bin := t.TempDir()
+	writeScript := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript("sbatch", `[ -e "$FAKE_SLURM/reject" ] && { echo "sbatch: error: invalid partition specified" >&2; exit 1; }
+echo x >> "$FAKE_SLURM/submitted"; echo 1234`)
+	// Another run of a script by the same name is queued too; only the
+	// command tells them apart.
+	writeScript("squeue", `echo "$@" > "$FAKE_SLURM/squeue-args"
+echo "999 $(date +%s) /elsewhere/train.sbatch"
+[ -s "$FAKE_SLURM/submitted" ] && echo "1234 $(date +%s) $FAKE_SCRIPT"; true`)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	script := filepath.Join(t.TempDir(), "train.sbatch")
+	os.WriteFile(script, []byte("#!/bin/bash\n#SBATCH --time=1:00:00\n#SBATCH -J bigann-k100\npython train.py\n"), 0o644)
+	t.Setenv("FAKE_SCRIPT", script)
+
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	savedPolicy := sshRetryPolicy
+	sshRetryPolicy.Initial = time.Millisecond
+	t.Cleanup(func() { sshRetryPolicy = savedPolicy })
+	useTestMux(t, nil)
+
+	tests := []struct {
+		name      string
+		failures  []localFailure
+		submitted int
+		err       string
+	}{
+		{"dropped after sbatch ran", []localFailure{{ran: true, stderr: "Connection reset by peer"}}, 1, ""},
+		{"dropped before sbatch ran", []localFailure{{stderr: "Connection closed by 10.0.0.1 port 22"}}, 1, ""},
+		{"refused", []localFailure{{stderr: "ssh: connect to host login port 22: Connection refused"}}, 1, ""},
+		{"rejected key", []localFailure{{stderr: "u@login: Permission denied (publickey)."}}, 0, "authentication failed"},
+		{"rejected by sbatch", nil, 0, "invalid partition specified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := t.TempDir()
+			t.Setenv("FAKE_SLURM", state)
+			if tt.name == "rejected by sbatch" {
+				os.WriteFile(filepath.Join(state, "reject"), nil, 0o644)
+			}
+			exec := &localExecutor{failures: tt.failures}
+			remoteExecutor = exec
+			jobID, _, _, err := submitSbatchSSH("u@login", sshHostOptions{}, "", "/logs/x-%j.out", script, nil)
+			data, _ := os.ReadFile(filepath.Join(state, "submitted"))
+			if n := strings.Count(string(data), "x"); n != tt.submitted {
+				t.Errorf("sbatch ran %d times, want %d (calls %q)", n, tt.submitted, exec.calls)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("err = %v, want %q", err, tt.err)
+				}
+				if _, err := os.Stat(filepath.Join(state, "squeue-args")); err == nil {
+					t.Error("squeue checked after a failure that submitted nothing")
+				}
+				return
+			}
+			if err != nil || jobID != "1234" {
+				t.Fatalf("submit = %q, %v", jobID, err)
+			}
+			// Only a connection that broke after sbatch may have run
+			// needs squeue checked.
+			args, err := os.ReadFile(filepath.Join(state, "squeue-args"))
+			if checked := err == nil; checked != strings.HasPrefix(tt.name, "dropped") {
+				t.Errorf("squeue checked = %v", checked)
+			}
+			if err == nil && !strings.Contains(string(args), "-n bigann-k100") {
+				t.Errorf("squeue looked for %q, want the script's job name", args)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// statsTopNames bounds the per-name artifact usage table of exp stats.
+const statsTopNames = 10
+
+// exp stats
+func cmdStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp stats\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exps, err := loadExperiments(db, "")
+	if err != nil {
+		return fmt.Errorf("query experiments: %w", err)
+	}
+	printStats(os.Stdout, exps)
+	return nil
+}
+
+// nameUsage is the cached artifact usage of all experiments sharing a name.
+type nameUsage struct {
+	Name  string
+	Count int
+	Bytes int64
+}
+
+// printStats summarizes experiments by status, their local artifact disk
+// usage and the peak memory sacct recorded for them. Only cached sizes and
+// stored accounting are used, so it never walks artifact trees or queries a
+// remote.
+func printStats(w io.Writer, exps []*Experiment) {
+	byStatus := make(map[string]int)
+	for _, exp := range exps {
+		status := strings.ToUpper(strings.TrimSpace(exp.JobStatus))
+		if status == "" {
+			status = "UNKNOWN"
+		}
+		byStatus[status]++
+	}
+	fmt.Fprintf(w, "Experiments: %d\n", len(exps))
+	for _, status := range sortedKeys(byStatus) {
+		fmt.Fprintf(w, "  %-12s %d\n", status, byStatus[status])
+	}
+
+	var total int64
+	measured, unmeasured := 0, 0
+	byName := make(map[string]*nameUsage)
+	for _, exp := range exps {
+		if exp.ArtifactDest == "" {
+			continue
+		}
+		if exp.ArtifactSizeAt.IsZero() {
+			unmeasured++
+			continue
+		}
+		measured++
+		total += exp.ArtifactSize
+		u := byName[exp.Name]
+		if u == nil {
+			u = &nameUsage{Name: exp.Name}
+			byName[exp.Name] = u
+		}
+		u.Count++
+		u.Bytes += exp.ArtifactSize
+	}
+	fmt.Fprintf(w, "\nArtifact disk usage: %s across %d experiment(s)\n", formatBytes(total), measured)
+	if unmeasured > 0 {
+		fmt.Fprintf(w, "  (%d not measured yet; exp prune-artifacts --dry-run measures them)\n", unmeasured)
+	}
+	if len(byName) > 0 {
+		printUsageByName(w, byName)
+	}
+	printMemoryStats(w, exps)
+	printEfficiencyStats(w, exps)
+}
+
+func printUsageByName(w io.Writer, byName map[string]*nameUsage) {
+	names := make([]*nameUsage, 0, len(byName))
+	for _, u := range byName {
+		names = append(names, u)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Bytes != names[j].Bytes {
+			return names[i].Bytes > names[j].Bytes
+		}
+		return names[i].Name < names[j].Name
+	})
+	if len(names) > statsTopNames {
+		names = names[:statsTopNames]
+	}
+	fmt.Fprintf(w, "  %-25s %5s %10s\n", "NAME", "RUNS", "SIZE")
+	for _, u := range names {
+		fmt.Fprintf(w, "  %-25s %5d %10s\n", u.Name, u.Count, formatBytes(u.Bytes))
+	}
+}
+
+// nameMemory is the sacct MaxRSS of all experiments sharing a name.
+type nameMemory struct {
+	Name  string
+	Count int
+	Total int64
+	Peak  int64
+}
+
+// printMemoryStats aggregates the MaxRSS stored on completion, by name,
+// largest peak first. Jobs too short for sacct to sample report none, or 0;
+// both are left out.
+func printMemoryStats(w io.Writer, exps []*Experiment) {
+	byName := make(map[string]*nameMemory)
+	measured := 0
+	for _, exp := range exps {
+		rss := exp.Accounting.MaxRSS
+		if rss <= 0 {
+			continue
+		}
+		measured++
+		m := byName[exp.Name]
+		if m == nil {
+			m = &nameMemory{Name: exp.Name}
+			byName[exp.Name] = m
+		}
+		m.Count++
+		m.Total += rss
+		m.Peak = max(m.Peak, rss)
+	}
+	if measured == 0 {
+		return
+	}
+	names := make([]*nameMemory, 0, len(byName))
+	for _, m := range byName {
+		names = append(names, m)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Peak != names[j].Peak {
+			return names[i].Peak > names[j].Peak
+		}
+		return names[i].Name < names[j].Name
+	})
+	if len(names) > statsTopNames {
+		names = names[:statsTopNames]
+	}
+	fmt.Fprintf(w, "\nPeak memory (sacct MaxRSS) of %d experiment(s):\n", measured)
+	fmt.Fprintf(w, "  %-25s %5s %10s %10s\n", "NAME", "RUNS", "MEAN", "MAX")
+	for _, m := range names {
+		fmt.Fprintf(w, "  %-25s %5d %10s %10s\n", m.Name, m.Count, formatBytes(m.Total/int64(m.Count)), formatBytes(m.Peak))
+	}
+}
+
+// nameEfficiency sums the seff efficiencies of all experiments sharing a
+// name; a report may lack either.
+type nameEfficiency struct {
+	Name             string
+	Count            int
+	CPU, Mem         float64
+	CPURuns, MemRuns int
+}
+
+// printEfficiencyStats averages the CPU and memory efficiency seff reported
+// on completion, by name, least efficient CPU use first: those are the
+// requests worth trimming.
+func printEfficiencyStats(w io.Writer, exps []*Experiment) {
+	byName := make(map[string]*nameEfficiency)
+	measured := 0
+	for _, exp := range exps {
+		r := exp.Efficiency
+		if !r.captured() {
+			continue
+		}
+		measured++
+		e := byName[exp.Name]
+		if e == nil {
+			e = &nameEfficiency{Name: exp.Name}
+			byName[exp.Name] = e
+		}
+		e.Count++
+		if r.CPUEfficiency >= 0 {
+			e.CPU += r.CPUEfficiency
+			e.CPURuns++
+		}
+		if r.MemEfficiency >= 0 {
+			e.Mem += r.MemEfficiency
+			e.MemRuns++
+		}
+	}
+	if measured == 0 {
+		return
+	}
+	names := make([]*nameEfficiency, 0, len(byName))
+	for _, e := range byName {
+		names = append(names, e)
+	}
+	mean := func(sum float64, n int) float64 {
+		if n == 0 {
+			return -1
+		}
+		return sum / float64(n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := mean(names[i].CPU, names[i].CPURuns), mean(names[j].CPU, names[j].CPURuns)
+		if a != b {
+			return a < b
+		}
+		return names[i].Name < names[j].Name
+	})
+	if len(names) > statsTopNames {
+		names = names[:statsTopNames]
+	}
+	percent := func(sum float64, n int) string {
+		if n == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", sum/float64(n))
+	}
+	fmt.Fprintf(w, "\nEfficiency (seff) of %d experiment(s):\n", measured)
+	fmt.Fprintf(w, "  %-25s %5s %10s %10s\n", "NAME", "RUNS", "CPU", "MEMORY")
+	for _, e := range names {
+		fmt.Fprintf(w, "  %-25s %5d %10s %10s\n", e.Name, e.Count, percent(e.CPU, e.CPURuns), percent(e.Mem, e.MemRuns))
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintStats(t *testing.T) {
+	measured := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	exps := []*Experiment{
+		{Name: "bigann", JobStatus: "COMPLETED", ArtifactDest: "/d/1", ArtifactSize: 3 << 30, ArtifactSizeAt: measured,
+			Accounting: jobAccounting{MaxRSS: 6 << 30}, Efficiency: seffReport{CPUEfficiency: 80, MemEfficiency: 40, Raw: "..."}},
+		{Name: "bigann", JobStatus: "completed", ArtifactDest: "/d/2", ArtifactSize: 1 << 30, ArtifactSizeAt: measured,
+			Accounting: jobAccounting{MaxRSS: 2 << 30}, Efficiency: seffReport{CPUEfficiency: 60, MemEfficiency: -1, Raw: "..."}},
+		{Name: "deep", JobStatus: "FAILED", ArtifactDest: "/d/3", ArtifactSize: 2 << 30, ArtifactSizeAt: measured,
+			Accounting: jobAccounting{MaxRSS: -1}, Efficiency: seffReport{CPUEfficiency: 12.5, MemEfficiency: 90, Raw: "..."}},
+		{Name: "deep", JobStatus: "RUNNING", ArtifactDest: "/d/4"},
+		{Name: "adhoc", JobStatus: ""},
+	}
+	var out strings.Builder
+	printStats(&out, exps)
+	got := out.String()
+	for _, want := range []string{
+		"Experiments: 5\n",
+		"  COMPLETED    2\n",
+		"  UNKNOWN      1\n",
+		"Artifact disk usage: 6.0 GiB across 3 experiment(s)\n",
+		"(1 not measured yet",
+		"  bigann                        2    4.0 GiB\n",
+		"Peak memory (sacct MaxRSS) of 2 experiment(s):\n",
+		"  bigann                        2    4.0 GiB    6.0 GiB\n",
+		"Efficiency (seff) of 3 experiment(s):\n",
+		"  deep                          1      12.5%      90.0%\n",
+		"  bigann                        2      70.0%      40.0%\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "bigann ") > strings.Index(got, "deep ") {
+		t.Errorf("names should be ordered by size:\n%s", got)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Every job status lookup goes through jobStatuses: queryJobStatus for a
+// single job, exp refresh and the monitor daemon for the jobs of a remote
+// and cluster. Lookups of a remote made while a query of it is running wait
+// and are answered together by the next query, one squeue -j id1,id2,...
+// (and one sacct for the jobs squeue no longer knows), and an answer is
+// reused for statusCacheTTL, so lookups a moment apart do not each reach
+// the login node. The answers are also kept in statusCacheFile, so
+// foreground monitors, exp refresh and the daemon running side by side
+// share them.
+
+const (
+	// statusCacheTTL is how long a job's status is reused.
+	statusCacheTTL = 5 * time.Second
+	// statusCacheFile, in the data directory, is the cache every exp
+	// process reads and adds to.
+	statusCacheFile = "job-status-cache.json"
+)
+
+var jobStatuses = newStatusBatcher(statusCacheTTL, batchJobStatuses)
+
+// statusBatcher coalesces and caches job status lookups per remote.
+type statusBatcher struct {
+	ttl   time.Duration
+	fetch func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error)
+	// shared is the path of the file shared with other processes; nil
+	// keeps the cache to this one. main sets it.
+	shared func() (string, error)
+
+	mu       sync.Mutex
+	remotes  map[slurmGroup]*remoteStatuses
+	lookups  int // calls to lookup
+	queries  int // calls to fetch
+	cacheHit int // jobs answered from the cache
+}
+
+// remoteStatuses is the cache of one remote and the lookups waiting for it.
+type remoteStatuses struct {
+	ssh     sshHostOptions // how the latest lookup reaches the remote
+	cache   map[string]cachedJobState
+	running bool         // a lookup is querying the remote
+	next    *statusBatch // jobs for the query after the running one
+}
+
+type cachedJobState struct {
+	state jobState
+	known bool // the scheduler knew the job
+	at    time.Time
+}
+
+// statusBatch is one query of a remote, shared by the lookups it answers.
+type statusBatch struct {
+	jobIDs map[string]bool
+	done   chan struct{}
+	states map[string]jobState
+	err    error
+}
+
+func newStatusBatcher(ttl time.Duration, fetch func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error)) *statusBatcher {
+	return &statusBatcher{ttl: ttl, fetch: fetch, remotes: make(map[slurmGroup]*remoteStatuses)}
+}
+
+// lookup returns the states of jobIDs on remote and cluster, like
+// batchJobStatuses: jobs the scheduler does not know are missing from the
+// result.
+func (b *statusBatcher) lookup(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+	g := slurmGroup{Remote: remote, Cluster: cluster}
+	b.mu.Lock()
+	b.lookups++
+	r, ok := b.remotes[g]
+	if !ok {
+		r = &remoteStatuses{cache: make(map[string]cachedJobState)}
+		b.remotes[g] = r
+	}
+	r.ssh = sshOpts
+	b.readShared(g, r)
+	states := make(map[string]jobState)
+	now := time.Now()
+	var batch *statusBatch
+	var wanted []string
+	for _, id := range jobIDs {
+		if c, ok := r.cache[id]; ok && now.Sub(c.at) < b.ttl {
+			b.cacheHit++
+			if c.known {
+				states[id] = c.state
+			}
+			continue
+		}
+		if r.next == nil {
+			r.next = &statusBatch{jobIDs: make(map[string]bool), done: make(chan struct{})}
+		}
+		batch = r.next
+		batch.jobIDs[id] = true
+		wanted = append(wanted, id)
+	}
+	if batch == nil {
+		b.mu.Unlock()
+		return states, nil
+	}
+	lead := !r.running
+	r.running = true
+	b.mu.Unlock()
+
+	if lead {
+		b.run(g, r)
+	}
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	for _, id := range wanted {
+		if st, ok := batch.states[id]; ok {
+			states[id] = st
+		}
+	}
+	return states, nil
+}
+
+// run queries g for the waiting lookups, and again for those that arrive
+// meanwhile, until none is left.
+func (b *statusBatcher) run(g slurmGroup, r *remoteStatuses) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for r.next != nil {
+		batch := r.next
+		r.next = nil
+		b.queries++
+		jobIDs := make([]string, 0, len(batch.jobIDs))
+		for id := range batch.jobIDs {
+			jobIDs = append(jobIDs, id)
+		}
+		sort.Strings(jobIDs)
+		sshOpts := r.ssh
+		b.mu.Unlock()
+		batch.states, batch.err = b.fetch(g.Remote, sshOpts, g.Cluster, jobIDs)
+		at := time.Now()
+		if batch.err == nil {
+			b.writeShared(g, jobIDs, batch.states, at)
+		}
+		b.mu.Lock()
+		if batch.err == nil {
+			for _, id := range jobIDs {
+				st, known := batch.states[id]
+				r.cache[id] = cachedJobState{state: st, known: known, at: at}
+			}
+		}
+		close(batch.done)
+	}
+	r.running = false
+}
+
+// sharedJobState is one job's entry in statusCacheFile.
+type sharedJobState struct {
+	Remote  string
+	Cluster string
+	JobID   string
+	State   jobState
+	Known   bool
+	At      time.Time
+}
+
+// sharedStatusPath is statusCacheFile in the data directory.
+func sharedStatusPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, statusCacheFile), nil
+}
+
+// loadShared reads the fresh entries of the shared cache. The cache is an
+// optimization, so a missing or unreadable file is an empty one.
+func (b *statusBatcher) loadShared(now time.Time) (string, []sharedJobState) {
+	if b.shared == nil {
+		return "", nil
+	}
+	path, err := b.shared()
+	if err != nil {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return path, nil
+	}
+	var entries, fresh []sharedJobState
+	if json.Unmarshal(data, &entries) != nil {
+		return path, nil
+	}
+	for _, e := range entries {
+		if now.Sub(e.At) < b.ttl {
+			fresh = append(fresh, e)
+		}
+	}
+	return path, fresh
+}
+
+// readShared copies into r the entries of g that another process stored
+// more recently than r has them.
+func (b *statusBatcher) readShared(g slurmGroup, r *remoteStatuses) {
+	_, entries := b.loadShared(time.Now())
+	for _, e := range entries {
+		if e.Remote != g.Remote || e.Cluster != g.Cluster {
+			continue
+		}
+		if c, ok := r.cache[e.JobID]; !ok || c.at.Before(e.At) {
+			r.cache[e.JobID] = cachedJobState{state: e.State, known: e.Known, at: e.At}
+		}
+	}
+}
+
+// writeShared adds a query's answers to the shared cache and drops stale
+// entries. Two processes writing at once may lose one's answers, which
+// only costs a later query; the rename keeps readers from seeing half a
+// file.
+func (b *statusBatcher) writeShared(g slurmGroup, jobIDs []string, states map[string]jobState, at time.Time) {
+	path, entries := b.loadShared(at)
+	if path == "" {
+		return
+	}
+	answered := make(map[string]bool, len(jobIDs))
+	for _, id := range jobIDs {
+		answered[id] = true
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Remote != g.Remote || e.Cluster != g.Cluster || !answered[e.JobID] {
+			kept = append(kept, e)
+		}
+	}
+	for _, id := range jobIDs {
+		st, known := states[id]
+		kept = append(kept, sharedJobState{Remote: g.Remote, Cluster: g.Cluster, JobID: id, State: st, Known: known, At: at})
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), statusCacheFile+".*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// summary says how many lookups the scheduler queries answered, for
+// --verbose.
+func (b *statusBatcher) summary() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fmt.Sprintf("Job status: %d lookup(s) answered by %d scheduler query(ies); %d job(s) from the %s cache",
+		b.lookups, b.queries, b.cacheHit, b.ttl)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// squeueExecutor answers squeue with every requested job RUNNING, except
+// those in gone, and sacct with nothing. The first squeue waits for hold
+// to close, so lookups made meanwhile pile up.
+type squeueExecutor struct {
+	mu    sync.Mutex
+	calls []string
+	gone  map[string]bool
+	hold  chan struct{}
+}
+
+func (e *squeueExecutor) Command(remote string, _ sshHostOptions, args ...string) *loggedCmd {
+	if args[0] == slurmTimeEnv {
+		args = args[1:]
+	}
+	e.mu.Lock()
+	e.calls = append(e.calls, strings.Join(args, " "))
+	first := len(e.calls) == 1
+	e.mu.Unlock()
+	if args[0] != "squeue" {
+		return runCommand("true")
+	}
+	if first && e.hold != nil {
+		<-e.hold
+	}
+	var out strings.Builder
+	for _, id := range strings.Split(args[3], ",") {
+		if !e.gone[id] {
+			fmt.Fprintf(&out, "%s RUNNING\n", id)
+		}
+	}
+	return runCommand("printf", "%s", out.String())
+}
+
+func (e *squeueExecutor) Upload(local, remote string, _ sshHostOptions, path string) error {
+	return nil
+}
+
+func (e *squeueExecutor) squeueCalls() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var calls []string
+	for _, c := range e.calls {
+		if strings.HasPrefix(c, "squeue") {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func useExecutor(t *testing.T, e RemoteExecutor) {
+	t.Helper()
+	saved := remoteExecutor
+	remoteExecutor = e
+	t.Cleanup(func() { remoteExecutor = saved })
+	useTestMux(t, nil)
+}
+
+func TestStatusLookupsCoalesce(t *testing.T) {
+	exec := &squeueExecutor{hold: make(chan struct{}), gone: map[string]bool{"9": true}}
+	useExecutor(t, exec)
+	b := newStatusBatcher(time.Minute, batchJobStatuses)
+
+	var wg sync.WaitGroup
+	results := make([]map[string]jobState, 5)
+	errs := make([]error, 5)
+	lookup := func(i int, ids ...string) {
+		defer wg.Done()
+		results[i], errs[i] = b.lookup("u@h", sshHostOptions{}, "", ids)
+	}
+	wg.Add(1)
+	go lookup(0, "1")
+	for len(exec.squeueCalls()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// While the first squeue runs, four more lookups queue up.
+	wg.Add(4)
+	go lookup(1, "2")
+	go lookup(2, "3", "4")
+	go lookup(3, "2", "9")
+	go lookup(4, "1")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		b.mu.Lock()
+		queued := 0
+		if next := b.remotes[slurmGroup{Remote: "u@h"}].next; next != nil {
+			queued = len(next.jobIDs)
+		}
+		b.mu.Unlock()
+		if queued == 5 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(exec.hold)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	calls := exec.squeueCalls()
+	if len(calls) != 2 || !strings.Contains(calls[0], "-j 1 ") || !strings.Contains(calls[1], "-j 1,2,3,4,9 ") {
+		t.Fatalf("squeue calls = %q, want 1 and then 1,2,3,4,9 together", calls)
+	}
+	if len(results[2]) != 2 || results[2]["4"].Status != "RUNNING" {
+		t.Errorf("lookup of 3,4 = %v", results[2])
+	}
+	if _, ok := results[3]["9"]; ok || results[3]["2"].Status != "RUNNING" {
+		t.Errorf("lookup of 2,9 = %v, want 9 missing", results[3])
+	}
+	if b.lookups != 5 || b.queries != 2 {
+		t.Errorf("%d lookups, %d queries", b.lookups, b.queries)
+	}
+}
+
+func TestStatusLookupCache(t *testing.T) {
+	exec := &squeueExecutor{gone: map[string]bool{"9": true}}
+	useExecutor(t, exec)
+	b := newStatusBatcher(time.Minute, batchJobStatuses)
+	for i := 0; i < 3; i++ {
+		states, err := b.lookup("u@h", sshHostOptions{}, "", []string{"1", "9"})
+		if err != nil || len(states) != 1 || states["1"].Status != "RUNNING" {
+			t.Fatalf("lookup %d = %v, %v", i, states, err)
+		}
+	}
+	if calls := exec.squeueCalls(); len(calls) != 1 {
+		t.Errorf("squeue calls = %q, want the first lookup's only", calls)
+	}
+	if _, err := b.lookup("u@other", sshHostOptions{}, "", []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := exec.squeueCalls(); len(calls) != 2 {
+		t.Errorf("squeue calls = %q, want another remote queried", calls)
+	}
+	if got := b.summary(); !strings.Contains(got, "4 lookup(s) answered by 2 scheduler query(ies); 4 job(s) from the 1m0s cache") {
+		t.Errorf("summary = %q", got)
+	}
+
+	// Failures are not cached.
+	fails := 0
+	b = newStatusBatcher(time.Minute, func(remote string, sshOpts sshHostOptions, cluster string, jobIDs []string) (map[string]jobState, error) {
+		fails++
+		return nil, errors.New("connection refused")
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := b.lookup("u@h", sshHostOptions{}, "", []string{"1"}); err == nil {
+			t.Fatal("lookup succeeded")
+		}
+	}
+	if fails != 2 {
+		t.Errorf("fetched %d times, want 2", fails)
+	}
+}
+
+func TestStatusLookupSharedCache(t *testing.T) {
+	exec := &squeueExecutor{gone: map[string]bool{"9": true}}
+	useExecutor(t, exec)
+	path := filepath.Join(t.TempDir(), statusCacheFile)
+	shared := func() (string, error) { return path, nil }
+	// One batcher per exp process.
+	daemon := newStatusBatcher(time.Minute, batchJobStatuses)
+	daemon.shared = shared
+	if _, err := daemon.lookup("u@h", sshHostOptions{}, "", []string{"1", "9"}); err != nil {
+		t.Fatal(err)
+	}
+	watcher := newStatusBatcher(time.Minute, batchJobStatuses)
+	watcher.shared = shared
+	states, err := watcher.lookup("u@h", sshHostOptions{}, "", []string{"1", "9"})
+	if err != nil || len(states) != 1 || states["1"].Status != "RUNNING" {
+		t.Fatalf("lookup = %v, %v", states, err)
+	}
+	if calls := exec.squeueCalls(); len(calls) != 1 {
+		t.Errorf("squeue calls = %q, want the other process's answer reused", calls)
+	}
+
+	// Stale entries are queried again.
+	stale := newStatusBatcher(time.Nanosecond, batchJobStatuses)
+	stale.shared = shared
+	if _, err := stale.lookup("u@h", sshHostOptions{}, "", []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := exec.squeueCalls(); len(calls) != 2 {
+		t.Errorf("squeue calls = %q, want a stale entry queried again", calls)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// syncHistoryShown bounds the syncs exp show lists.
+const syncHistoryShown = 5
+
+// syncRecord is one row of sync_history: a sync, successful or not. The
+// experiment row keeps only the latest; the history keeps them all, so a
+// run of syncs that copied nothing stays visible.
+type syncRecord struct {
+	At               time.Time
+	FilesMatched     int   // -1 when unknown (a failed sync)
+	BytesMatched     int64 // -1 when unknown
+	FilesTransferred int   // -1 when rsync's stats could not be read
+	BytesTransferred int64 // -1 when unknown
+	Duration         time.Duration
+	Error            string
+}
+
+// insertSyncRecord appends one sync to the history; stats is nil for a
+// failed sync.
+func insertSyncRecord(db execer, id int64, at time.Time, stats *syncStats, errMsg string) error {
+	var matched, matchedBytes, transferred, transferredBytes, seconds interface{}
+	if stats != nil {
+		matched, matchedBytes, seconds = stats.Files, stats.Bytes, stats.Duration.Seconds()
+		if stats.Updated >= 0 {
+			transferred = stats.Updated
+		}
+		if stats.UpdatedBytes >= 0 {
+			transferredBytes = stats.UpdatedBytes
+		}
+	}
+	_, err := db.Exec(`INSERT INTO sync_history (experiment_id, synced_at, files_matched, bytes_matched,
+                                   files_transferred, bytes_transferred, duration_seconds, error)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, at.UTC().Format(time.RFC3339), matched, matchedBytes, transferred, transferredBytes, seconds, errMsg)
+	return err
+}
+
+// loadSyncHistory returns the experiment's latest syncs, newest first; a
+// limit of 0 returns them all.
+func loadSyncHistory(db *sql.DB, id int64, limit int) ([]syncRecord, error) {
+	query := `SELECT synced_at, files_matched, bytes_matched, files_transferred, bytes_transferred, duration_seconds, error
+                FROM sync_history WHERE experiment_id = ? ORDER BY id DESC`
+	if limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(limit)
+	}
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []syncRecord
+	for rows.Next() {
+		var at, errMsg sql.NullString
+		var matched, matchedBytes, transferred, transferredBytes sql.NullInt64
+		var seconds sql.NullFloat64
+		if err := rows.Scan(&at, &matched, &matchedBytes, &transferred, &transferredBytes, &seconds, &errMsg); err != nil {
+			return nil, err
+		}
+		r := syncRecord{FilesMatched: -1, BytesMatched: -1, FilesTransferred: -1, BytesTransferred: -1, Error: errMsg.String}
+		r.At, _ = time.Parse(time.RFC3339, at.String)
+		if matched.Valid {
+			r.FilesMatched = int(matched.Int64)
+		}
+		if matchedBytes.Valid {
+			r.BytesMatched = matchedBytes.Int64
+		}
+		if transferred.Valid {
+			r.FilesTransferred = int(transferred.Int64)
+		}
+		if transferredBytes.Valid {
+			r.BytesTransferred = transferredBytes.Int64
+		}
+		r.Duration = time.Duration(seconds.Float64 * float64(time.Second))
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (r syncRecord) String() string {
+	if r.FilesMatched < 0 {
+		return "failed: " + r.Error
+	}
+	s := fmt.Sprintf("%d matched (%s)", r.FilesMatched, formatBytes(r.BytesMatched))
+	if r.FilesTransferred >= 0 {
+		s += fmt.Sprintf(", %d transferred", r.FilesTransferred)
+		if r.BytesTransferred >= 0 {
+			s += fmt.Sprintf(" (%s)", formatBytes(r.BytesTransferred))
+		}
+	}
+	s += fmt.Sprintf(" in %s", r.Duration.Round(time.Second))
+	if r.Error != "" {
+		s += "; " + r.Error
+	}
+	return s
+}
+
+const noFilesMatchedWarning = "WARNING: the sync after the job finished matched no files; check the artifact paths and patterns"
+
+// lastSyncMatchedNothing reports whether the latest successful sync ran after
+// the job finished and found no files, and no earlier sync found any, which
+// usually means the artifact patterns or paths are wrong rather than that the
+// job wrote nothing. After a sync that did find files, an empty incremental
+// one only means nothing changed.
+func (exp *Experiment) lastSyncMatchedNothing() bool {
+	st := exp.ArtifactSyncStats
+	if exp.ArtifactLastSync.IsZero() || exp.CompletedAt.IsZero() || exp.ArtifactLastSync.Before(exp.CompletedAt) || exp.ArtifactEverMatched {
+		return false
+	}
+	return (st.ManifestPath != "" || st.TarPath != "") && st.Files == 0
+}
+
+// syncedColumn is the exp list SYNCED value: the files the last sync matched,
+// with how many it transferred, flagged when a sync after completion matched
+// nothing.
+func syncedColumn(exp *Experiment) string {
+	st := exp.ArtifactSyncStats
+	switch {
+	case exp.lastSyncMatchedNothing():
+		return "0 (!)"
+	case exp.ArtifactLastSync.IsZero() || st.ManifestPath == "" && st.TarPath == "":
+		return "-"
+	case st.Updated >= 0 && st.Updated != st.Files:
+		return fmt.Sprintf("%s (+%s)", formatCount(st.Files), formatCount(st.Updated))
+	default:
+		return formatCount(st.Files)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSyncHistory(t *testing.T) {
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "e", "COMPLETED", "")
+	first := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	if err := recordArtifactSync(db, id, &first, &syncStats{Files: 12, Bytes: 4096, Duration: 3 * time.Second,
+		ManifestPath: "/d/m.json", Updated: 12, UpdatedBytes: 4096}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordArtifactSync(db, id, nil, nil, "rsync: connection reset"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordArtifactSync(db, id, &second, &syncStats{Files: 12, Bytes: 4096, Duration: time.Second,
+		ManifestPath: "/d/m.json", Updated: 0, UpdatedBytes: 0}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := loadSyncHistory(db, id, 0)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+	if got := history[0].String(); got != "12 matched (4.0 KiB), 0 transferred (0 B) in 1s" {
+		t.Errorf("latest = %q", got)
+	}
+	if got := history[1].String(); got != "failed: rsync: connection reset" {
+		t.Errorf("failure = %q", got)
+	}
+	if !history[2].At.Equal(first) || history[2].FilesTransferred != 12 {
+		t.Errorf("oldest = %+v", history[2])
+	}
+	if limited, _ := loadSyncHistory(db, id, 2); len(limited) != 2 {
+		t.Errorf("limited history has %d entries", len(limited))
+	}
+
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := syncedColumn(exp); got != "12 (+0)" {
+		t.Errorf("synced column = %q", got)
+	}
+	if !exp.ArtifactEverMatched {
+		t.Error("ArtifactEverMatched not set after syncs that matched files")
+	}
+}
+
+func TestLastSyncMatchedNothing(t *testing.T) {
+	done := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	empty := syncStats{ManifestPath: "/d/m.json", Updated: 0}
+	cases := []struct {
+		exp     Experiment
+		flagged bool
+		synced  string
+	}{
+		{Experiment{CompletedAt: done, ArtifactLastSync: done.Add(time.Minute), ArtifactSyncStats: empty}, true, "0 (!)"},
+		// An empty pass while the job ran is normal.
+		{Experiment{CompletedAt: done, ArtifactLastSync: done.Add(-time.Minute), ArtifactSyncStats: empty}, false, "0"},
+		{Experiment{ArtifactLastSync: done, ArtifactSyncStats: empty}, false, "0"},
+		{Experiment{CompletedAt: done, ArtifactLastSync: done, ArtifactSyncStats: syncStats{Files: 1340, Updated: -1, TarPath: "/t.tar"}}, false, "1,340"},
+		{Experiment{CompletedAt: done}, false, "-"},
+		// Nothing new since an earlier sync that found the files.
+		{Experiment{CompletedAt: done, ArtifactLastSync: done.Add(time.Minute), ArtifactSyncStats: empty, ArtifactEverMatched: true}, false, "0"},
+	}
+	for i, c := range cases {
+		if got := c.exp.lastSyncMatchedNothing(); got != c.flagged {
+			t.Errorf("case %d: lastSyncMatchedNothing = %v", i, got)
+		}
+		if got := syncedColumn(&c.exp); got != c.synced {
+			t.Errorf("case %d: synced column = %q, want %q", i, got, c.synced)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// keepTag protects an experiment's artifacts from exp prune-artifacts.
+const keepTag = "keep"
+
+// exp tag <id> [--remove] TAG...
+func cmdTag(args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	var remove bool
+	fs.BoolVar(&remove, "remove", false, "Remove the given tags instead of adding them")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp tag <id> [--remove] TAG...\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("id is required")
+	}
+	for _, tag := range positional[1:] {
+		if err := validateTag(tag); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, positional[0])
+	if err != nil {
+		return err
+	}
+	if len(positional) == 1 {
+		if len(exp.Tags) == 0 {
+			fmt.Printf("Experiment %d has no tags\n", exp.ID)
+		} else {
+			fmt.Println(strings.Join(exp.Tags, "\n"))
+		}
+		return nil
+	}
+
+	tags := updateTags(exp.Tags, positional[1:], remove)
+	if _, err := db.Exec(`UPDATE experiments SET tags = ? WHERE id = ?`, strings.Join(tags, ","), exp.ID); err != nil {
+		return fmt.Errorf("update tags: %w", err)
+	}
+	if len(tags) == 0 {
+		fmt.Printf("Experiment %d: no tags\n", exp.ID)
+	} else {
+		fmt.Printf("Experiment %d: %s\n", exp.ID, strings.Join(tags, ", "))
+	}
+	return nil
+}
+
+func validateTag(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, ", \t\n") {
+		return fmt.Errorf("invalid tag %q: tags must be non-empty and contain no commas or whitespace", tag)
+	}
+	return nil
+}
+
+// updateTags adds (or removes) tags and returns the sorted, de-duplicated set.
+func updateTags(current, tags []string, remove bool) []string {
+	set := make(map[string]bool, len(current)+len(tags))
+	for _, t := range current {
+		set[t] = true
+	}
+	for _, t := range tags {
+		set[t] = !remove
+	}
+	var out []string
+	for t, ok := range set {
+		if ok {
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// splitTags parses the comma-separated tags column.
+func splitTags(s string) []string {
+	var out []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (exp *Experiment) hasTag(tag string) bool {
+	for _, t := range exp.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
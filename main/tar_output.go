@@ -0,0 +1,135 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// writeArtifactTar implements exp fetch --tar: each source's remote side
+// archives its queued files with tar (the list goes over stdin), and the
+// entries are copied into a single local archive under the names they would
+// get in the destination, including the per-source subdirectory.
+func writeArtifactTar(exp *Experiment, results []*sourceFetch, opts fetchOptions) (syncStats, error) {
+	var out io.Writer = os.Stdout
+	stats := syncStats{TarPath: opts.TarPath}
+	var file *os.File
+	if opts.TarPath != "-" {
+		abs, err := expandLocalPath(opts.TarPath)
+		if err != nil {
+			return syncStats{}, fmt.Errorf("tar output: %w", err)
+		}
+		if file, err = os.Create(abs); err != nil {
+			return syncStats{}, fmt.Errorf("tar output: %w", err)
+		}
+		defer file.Close()
+		out, stats.TarPath = file, abs
+	}
+	var gz *gzip.Writer
+	if opts.TarGzip {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+	for _, r := range results {
+		if r.err != nil || len(r.files) == 0 {
+			continue
+		}
+		fmt.Fprintf(opts.out(), "Archiving %d file(s) from %s\n", len(r.files), r.src.label())
+		n, size, err := appendRemoteTar(tw, r.src.host(exp), exp.SSH, r)
+		stats.Files += n
+		stats.Bytes += size
+		if err != nil {
+			return syncStats{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return syncStats{}, fmt.Errorf("write tar: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return syncStats{}, fmt.Errorf("write tar: %w", err)
+		}
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return syncStats{}, fmt.Errorf("write tar: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+// appendRemoteTar streams r's files from remote as a tar archive and copies
+// each entry into tw under its local name. It returns how many entries and
+// bytes were copied.
+func appendRemoteTar(tw *tar.Writer, remote string, sshOpts sshHostOptions, r *sourceFetch) (int, int64, error) {
+	script, _ := tarCommands(r.src.Path, r.src.Symlinks, "")
+	cmd := sshCommand(remote, sshOpts, "bash", "-c", shellQuote(script)).withTimeout(timeouts.Transfer)
+	cmd.Stdin = strings.NewReader(filesFrom0(r.files))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, 0, fmt.Errorf("start remote tar: %w", err)
+	}
+	n, size, copyErr := copyTarEntries(tw, pipe, tarPrefix(r.dest), r.localName)
+	if copyErr != nil {
+		// Let the remote side exit instead of blocking on a full pipe.
+		io.Copy(io.Discard, pipe)
+	}
+	if err := cmd.Wait(); err != nil {
+		return n, size, fmt.Errorf("remote tar failed: %v\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	return n, size, copyErr
+}
+
+// tarPrefix turns a source's destination, which with --tar is relative to
+// the archive root, into an entry name prefix.
+func tarPrefix(dest string) string {
+	if dest == "" || dest == "." {
+		return ""
+	}
+	return filepath.ToSlash(dest)
+}
+
+// copyTarEntries copies every entry of the archive read from src into tw,
+// renaming it to prefix/localName(name).
+func copyTarEntries(tw *tar.Writer, src io.Reader, prefix string, localName func(string) string) (int, int64, error) {
+	tr := tar.NewReader(src)
+	var n int
+	var size int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return n, size, nil
+		}
+		if err != nil {
+			return n, size, fmt.Errorf("read remote tar: %w", err)
+		}
+		name := path.Join(prefix, localName(strings.TrimPrefix(hdr.Name, "./")))
+		if hdr.Typeflag == tar.TypeDir {
+			name += "/"
+		}
+		hdr.Name = name
+		// Let the writer pick a format that fits the new name.
+		hdr.Format = tar.FormatUnknown
+		if err := tw.WriteHeader(hdr); err != nil {
+			return n, size, fmt.Errorf("write tar: %w", err)
+		}
+		written, err := io.Copy(tw, tr)
+		if err != nil {
+			return n, size, fmt.Errorf("write tar: %w", err)
+		}
+		n++
+		size += written
+	}
+}
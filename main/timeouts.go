@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Every external command exp runs has a deadline, so an unreachable host
+// fails instead of hanging. ssh gives up on connecting after
+// ssh_connect_timeout. Quick commands (status polls, git lookups) are killed
+// after command_timeout. Long ones (transfers, listings, checksums, build
+// scripts) get transfer_timeout. A command killed at its deadline fails with
+// a *commandTimeoutError, which classifySSHError treats as transient.
+const (
+	defaultConnectTimeout  = 10 * time.Second
+	defaultCommandTimeout  = 2 * time.Minute
+	defaultTransferTimeout = 12 * time.Hour
+)
+
+// timeouts are the deadlines in effect; finishGlobalOptions applies the
+// config's. Zero means no deadline.
+var timeouts = commandTimeouts{
+	Connect:  defaultConnectTimeout,
+	Command:  defaultCommandTimeout,
+	Transfer: defaultTransferTimeout,
+}
+
+type commandTimeouts struct {
+	Connect, Command, Transfer time.Duration
+}
+
+// configTimeouts returns the deadlines cfg sets, with defaults for the rest.
+func configTimeouts(cfg *Config) (commandTimeouts, error) {
+	t := commandTimeouts{Connect: defaultConnectTimeout, Command: defaultCommandTimeout, Transfer: defaultTransferTimeout}
+	for _, opt := range []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"ssh_connect_timeout", string(cfg.SSHConnectTimeout), &t.Connect},
+		{"command_timeout", string(cfg.CommandTimeout), &t.Command},
+		{"transfer_timeout", string(cfg.TransferTimeout), &t.Transfer},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(opt.value)
+		if err != nil || d < 0 {
+			return t, fmt.Errorf("invalid %s %q (examples: 10s, 5m; 0 for none)", opt.key, opt.value)
+		}
+		*opt.dest = d
+	}
+	return t, nil
+}
+
+// defaultTimeout is the deadline for a command by name: ssh runs are quick
+// unless the caller says otherwise, file copies are long, and local tools
+// such as git or an opener have none.
+func defaultTimeout(name string) time.Duration {
+	switch name {
+	case "ssh":
+		return timeouts.Command
+	case "rsync", "scp", "sftp", "tar":
+		return timeouts.Transfer
+	}
+	return 0
+}
+
+// commandTimeoutError is a command killed at its deadline.
+type commandTimeoutError struct {
+	Name    string
+	Timeout time.Duration
+}
+
+func (e *commandTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s and was killed", e.Name, e.Timeout)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useTestTimeouts(t *testing.T, d commandTimeouts) {
+	t.Helper()
+	saved := timeouts
+	timeouts = d
+	t.Cleanup(func() { timeouts = saved })
+}
+
+func TestConfigTimeouts(t *testing.T) {
+	got, err := configTimeouts(&Config{SSHConnectTimeout: "3s", TransferTimeout: "0"})
+	if err != nil || got != (commandTimeouts{Connect: 3 * time.Second, Command: defaultCommandTimeout}) {
+		t.Errorf("configTimeouts = %+v, %v", got, err)
+	}
+	for _, bad := range []*Config{{CommandTimeout: "soon"}, {SSHConnectTimeout: "-1s"}} {
+		if _, err := configTimeouts(bad); err == nil {
+			t.Errorf("%+v should not parse", bad)
+		}
+	}
+
+	useTestMux(t, nil)
+	useTestTimeouts(t, commandTimeouts{Connect: 1500 * time.Millisecond})
+	useTestBatchMode(t, false)
+	if got := strings.Join(sshArgs(sshHostOptions{}, "u@h", "true"), " "); got != "-o ConnectTimeout=2 u@h true" {
+		t.Errorf("sshArgs = %q", got)
+	}
+}
+
+func TestCommandDeadline(t *testing.T) {
+	// The shell's child holds stdout too; the whole group has to go.
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	cmd := runCommand("sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait").withTimeout(200 * time.Millisecond)
+	start := time.Now()
+	_, err := cmd.Output()
+	var te *commandTimeoutError
+	if !errors.As(err, &te) || te.Timeout != 200*time.Millisecond {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("took %s to give up", elapsed)
+	}
+	if got := classifySSHError(err, ""); got != sshErrTimeout || !got.transient() {
+		t.Errorf("a deadline is classified %s", got)
+	}
+	if err := runCommand("sh", "-c", "true").withTimeout(time.Minute).Run(); err != nil {
+		t.Errorf("a quick command: %v", err)
+	}
+	if data, err := os.ReadFile(pidFile); err == nil && cmd.group {
+		// A killed child may linger as a zombie until init reaps it.
+		pid := strings.TrimSpace(string(data))
+		time.Sleep(100 * time.Millisecond)
+		if stat, err := os.ReadFile("/proc/" + pid + "/stat"); err == nil && !strings.Contains(string(stat), ") Z ") {
+			t.Errorf("child %s outlived the deadline", pid)
+		}
+	}
+}
+
+func TestStopCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	saved := stopCommands
+	stopCommands = ctx
+	t.Cleanup(func() { stopCommands = saved })
+
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := runCommand("sh", "-c", "sleep 30 & wait").withTimeout(time.Minute).Output()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want the stop's cause", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("took %s to stop", elapsed)
+	}
+	attempts := 0
+	err = retrySSH(io.Discard, "u@h", "ssh", sshRetryPolicy, func(time.Duration) {}, func() (string, error) {
+		attempts++
+		return "Connection reset by peer", errors.New("exit status 255")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("retried %d times after the stop: %v", attempts, err)
+	}
+}
+
+func TestNativeConnectTimeout(t *testing.T) {
+	// A host that accepts the connection but never answers, as behind a
+	// firewall that swallows the SSH banner.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	e := newNativeExecutor(nil)
+	defer e.Close()
+	e.port, e.dialTimeout = port, 300*time.Millisecond
+	e.knownHosts = []string{filepath.Join(t.TempDir(), "known_hosts")}
+	os.WriteFile(e.knownHosts[0], nil, 0o600)
+
+	start := time.Now()
+	err = e.Command("u@127.0.0.1", sshHostOptions{}, "true").Run()
+	if err == nil {
+		t.Fatal("connecting to a silent host succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to give up", elapsed)
+	}
+	if got := classifySSHError(err, ""); got != sshErrTimeout {
+		t.Errorf("classified %s (%v), want a timeout", got, err)
+	}
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TOML config files (config.toml, --config-file run.toml) are read into the
+// same generic document as YAML, then go through JSON into Config,
+// RunProfile or RunConfigFile. Tables are nested mappings and arrays of
+// tables ([[artifact_sources]]) lists of them:
+//
+//	remote = "u@login"
+//	log_dir = "/scratch/u/logs"
+//
+//	[[artifact_sources]]
+//	path = "/scratch/u/run"
+//	artifact_patterns = ['.*\.json$']
+//
+// Dates and times (1979-05-27T07:32:00Z) are kept as the strings they were
+// written as, since no setting takes one.
+
+var (
+	tomlBareKey  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	tomlDateTime = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}|^\d{2}:\d{2}:\d{2}`)
+)
+
+// tomlParser reads one document.
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+
+	root    map[string]interface{}
+	current map[string]interface{}
+	// defined are the tables a [header] or key/value pairs made, which no
+	// later [header] may open again, keyed by their map's identity.
+	defined map[uintptr]bool
+}
+
+func unmarshalTOML(data []byte, target interface{}) error {
+	doc, err := parseTOMLDocument(data)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, target)
+}
+
+func parseTOMLDocument(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{
+		src:     strings.ReplaceAll(string(data), "\r\n", "\n"),
+		line:    1,
+		root:    make(map[string]interface{}),
+		defined: make(map[uintptr]bool),
+	}
+	p.current = p.root
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return p.root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			err = p.header()
+		} else {
+			err = p.keyValue(p.current)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: "+format, append([]interface{}{p.line}, args...)...)
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.src) }
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, line breaks and comments.
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t':
+			p.pos++
+		case '\n':
+			p.pos++
+			p.line++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// endOfLine requires nothing but a comment after a header or key/value.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if !p.eof() && p.peek() == '#' {
+		p.skipComment()
+	}
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q after the value", p.rest())
+	}
+	p.pos++
+	p.line++
+	return nil
+}
+
+// rest is what is left of the current line, for error messages.
+func (p *tomlParser) rest() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return p.src[p.pos:]
+	}
+	return p.src[p.pos : p.pos+end]
+}
+
+// header reads a [table] or [[array of tables]] header and makes its table
+// the current one.
+func (p *tomlParser) header() error {
+	array := strings.HasPrefix(p.src[p.pos:], "[[")
+	p.pos++
+	if array {
+		p.pos++
+	}
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], closing) {
+		return p.errorf("expected %s after [%s", closing, strings.Join(keys, "."))
+	}
+	p.pos += len(closing)
+
+	table := p.root
+	for _, k := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, k); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	name := strings.Join(keys, ".")
+	if array {
+		list, ok := table[last].([]interface{})
+		if _, exists := table[last]; exists && !ok {
+			return p.errorf("[[%s]]: %s is not an array of tables", name, name)
+		}
+		next := make(map[string]interface{})
+		table[last] = append(list, next)
+		p.current = next
+		return nil
+	}
+	next, ok := table[last].(map[string]interface{})
+	switch _, exists := table[last]; {
+	case !exists:
+		next = make(map[string]interface{})
+		table[last] = next
+	case !ok:
+		return p.errorf("[%s]: %s is already a value", name, name)
+	case p.defined[reflect.ValueOf(next).Pointer()]:
+		return p.errorf("table [%s] is defined twice", name)
+	}
+	p.defined[reflect.ValueOf(next).Pointer()] = true
+	p.current = next
+	return nil
+}
+
+// descend returns the table under key k of table, creating it, or the
+// newest table of an array of tables.
+func (p *tomlParser) descend(table map[string]interface{}, k string) (map[string]interface{}, error) {
+	switch v := table[k].(type) {
+	case nil:
+		next := make(map[string]interface{})
+		table[k] = next
+		return next, nil
+	case map[string]interface{}:
+		return v, nil
+	case []interface{}:
+		if len(v) > 0 {
+			if last, ok := v[len(v)-1].(map[string]interface{}); ok {
+				return last, nil
+			}
+		}
+	}
+	return nil, p.errorf("%s is already a value, not a table", k)
+}
+
+// key reads a bare, quoted or dotted key.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("expected a key")
+		}
+		var k string
+		var err error
+		switch p.peek() {
+		case '"':
+			k, err = p.basicString()
+		case '\'':
+			k, err = p.literalString()
+		default:
+			start := p.pos
+			for !p.eof() && tomlBareKey.MatchString(p.src[p.pos:p.pos+1]) {
+				p.pos++
+			}
+			k = p.src[start:p.pos]
+			if k == "" {
+				return nil, p.errorf("expected a key, found %q", p.rest())
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		p.skipSpace()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+// keyValue reads key = value into table.
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("expected = after %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, k); err != nil {
+			return err
+		}
+		p.defined[reflect.ValueOf(table).Pointer()] = true
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return p.errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	table[last] = value
+	return nil
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("expected a value")
+	}
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.src[p.pos:], `'''`):
+		return p.multilineString(`'''`)
+	case p.peek() == '"':
+		return p.basicString()
+	case p.peek() == '\'':
+		return p.literalString()
+	case p.peek() == '[':
+		return p.array()
+	case p.peek() == '{':
+		return p.inlineTable()
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, p.errorf("%s cannot be stored", token)
+	}
+	if tomlDateTime.MatchString(token) {
+		return token, nil
+	}
+	digits := strings.ReplaceAll(token, "_", "")
+	unsigned := strings.TrimLeft(digits, "+-")
+	switch {
+	case unsigned == "" || unsigned[0] < '0' || unsigned[0] > '9':
+	case len(unsigned) > 2 && unsigned[0] == '0' && strings.ContainsRune("xob", rune(unsigned[1])):
+		if n, err := strconv.ParseInt(digits, 0, 64); err == nil {
+			return n, nil
+		}
+	case len(unsigned) > 1 && unsigned[0] == '0' && unsigned[1] >= '0' && unsigned[1] <= '9':
+		// Leading zeros are not allowed.
+	default:
+		if n, err := strconv.ParseInt(digits, 10, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(digits, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, p.errorf("invalid value %q (strings need quotes)", token)
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++ // [
+	items := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return items, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		p.skipBlank()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array, found %q", p.rest())
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++ // {
+	table := make(map[string]interface{})
+	p.skipSpace()
+	if !p.eof() && p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table, found %q", p.rest())
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++ // '
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] == '\n' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++ // "
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// multilineString reads a string between three double or three single
+// quotes. A line break right after the opening quotes is dropped, and
+// between double quotes so is a backslash ending a line, with the
+// whitespace after it.
+func (p *tomlParser) multilineString(quotes string) (string, error) {
+	p.pos += 3
+	if strings.HasPrefix(p.src[p.pos:], "\n") {
+		p.pos++
+		p.line++
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated %s string", quotes)
+		}
+		if strings.HasPrefix(p.src[p.pos:], quotes) {
+			// Up to two quotes right before the closing ones belong to
+			// the string.
+			extra := 0
+			for extra < 2 && strings.HasPrefix(p.src[p.pos+extra+1:], quotes) {
+				extra++
+			}
+			b.WriteString(p.src[p.pos : p.pos+extra])
+			p.pos += extra + 3
+			return b.String(), nil
+		}
+		c := p.peek()
+		switch {
+		case c == '\n':
+			b.WriteByte(c)
+			p.pos++
+			p.line++
+		case c == '\\' && quotes == `"""`:
+			if trimmed := strings.TrimLeft(p.src[p.pos+1:], " \t"); strings.HasPrefix(trimmed, "\n") {
+				p.pos = len(p.src) - len(trimmed)
+				for !p.eof() && strings.ContainsRune(" \t\n", rune(p.peek())) {
+					if p.peek() == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// escape reads the escape sequence at p.pos into b.
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.pos+1 >= len(p.src) {
+		return p.errorf("unterminated string")
+	}
+	c := p.src[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return p.errorf("short \\%c escape", c)
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid \\%c escape %q", c, p.src[p.pos:p.pos+n])
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// renderTOML writes v, a struct such as RunConfigFile, as TOML: its set
+// fields by their JSON names, in field order, with lists of structs as
+// arrays of tables after the plain values.
+func renderTOML(v interface{}) string {
+	var b strings.Builder
+	writeTOMLTable(&b, reflect.ValueOf(v), "")
+	return b.String()
+}
+
+func writeTOMLTable(b *strings.Builder, v reflect.Value, prefix string) {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	type section struct {
+		name  string
+		items reflect.Value
+	}
+	var sections []section
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if fv.IsZero() || fv.Kind() == reflect.Slice && fv.Len() == 0 {
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct {
+			sections = append(sections, section{name, fv})
+			continue
+		}
+		fmt.Fprintf(b, "%s = %s\n", tomlKey(name), tomlValue(fv))
+	}
+	for _, s := range sections {
+		for i := 0; i < s.items.Len(); i++ {
+			fmt.Fprintf(b, "\n[[%s%s]]\n", prefix, tomlKey(s.name))
+			writeTOMLTable(b, s.items.Index(i), prefix+tomlKey(s.name)+".")
+		}
+	}
+}
+
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlString quotes s as a basic string; JSON's escapes are all valid TOML.
+func tomlString(s string) string {
+	buf, _ := json.Marshal(s)
+	return string(buf)
+}
+
+func tomlValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return tomlString(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = tomlValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = tomlKey(k) + " = " + tomlValue(v.MapIndex(reflect.ValueOf(k)))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+	return tomlString(fmt.Sprint(v.Interface()))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOMLDocument(t *testing.T) {
+	doc := `
+# exp config
+debug_log = "~/exp-debug.jsonl"   # trailing comment
+ssh_identity_files = [
+  "~/.ssh/a",  # first
+  '~/.ssh/b',
+]
+
+[defaults]
+remote = "u@login"
+compress_level = 3
+poll_interval = '30s'
+checksum = true
+ssh.port = 2222
+
+[profiles.explorer]
+log_dir = "/scratch/u/logs"
+progress_regex = 'epoch (\d+)/(\d+)'
+build_script_inline = """
+module load cuda \
+  12.4
+make -j8
+"""
+notes = '''
+raw \n "quoted"'''
+
+[[profiles.explorer.artifact_sources]]
+path = "/scratch/u/run"
+artifact_patterns = ['.*\.json$', "a\tb\u00e9"]
+
+[[profiles.explorer.artifact_sources]]
+path = "/scratch/u/eval"
+prune_dirs = ["ckpt"]
+metrics = [{pattern = "x", keys = ["loss"]}]
+
+[report]
+inline_max_bytes = 1_048_576
+ratio = 0.5
+when = 1979-05-27T07:32:00Z
+`
+	m, err := parseTOMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"debug_log":          "~/exp-debug.jsonl",
+		"ssh_identity_files": []interface{}{"~/.ssh/a", "~/.ssh/b"},
+		"defaults": map[string]interface{}{
+			"remote": "u@login", "compress_level": int64(3), "poll_interval": "30s", "checksum": true,
+			"ssh": map[string]interface{}{"port": int64(2222)},
+		},
+		"profiles": map[string]interface{}{
+			"explorer": map[string]interface{}{
+				"log_dir":             "/scratch/u/logs",
+				"progress_regex":      `epoch (\d+)/(\d+)`,
+				"build_script_inline": "module load cuda 12.4\nmake -j8\n",
+				"notes":               "raw \\n \"quoted\"",
+				"artifact_sources": []interface{}{
+					map[string]interface{}{"path": "/scratch/u/run", "artifact_patterns": []interface{}{`.*\.json$`, "a\tbé"}},
+					map[string]interface{}{"path": "/scratch/u/eval", "prune_dirs": []interface{}{"ckpt"},
+						"metrics": []interface{}{map[string]interface{}{"pattern": "x", "keys": []interface{}{"loss"}}}},
+				},
+			},
+		},
+		"report": map[string]interface{}{"inline_max_bytes": int64(1048576), "ratio": 0.5, "when": "1979-05-27T07:32:00Z"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got  %#v\nwant %#v", m, want)
+	}
+}
+
+func TestTOMLErrors(t *testing.T) {
+	tests := []struct{ doc, want string }{
+		{"a = 1\na = 2\n", "line 2: duplicate key a"},
+		{"[t]\nx = 1\n\n[t]\ny = 2\n", "line 4: table [t] is defined twice"},
+		{"name = \"open\nremote = \"u@h\"\n", "line 1: unterminated string"},
+		{"\n\nremote = u@h\n", `line 3: invalid value "u@h" (strings need quotes)`},
+		{"x = 1 2\n", `line 1: unexpected "2" after the value`},
+		{"a = 1\n[a.b]\n", "line 2: a is already a value"},
+		{"s = \"\\q\"\n", `line 1: invalid escape \q`},
+		{"n = 007\n", `line 1: invalid value "007"`},
+	}
+	for _, tt := range tests {
+		_, err := parseTOMLDocument([]byte(tt.doc))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: err = %v, want %q", tt.doc, err, tt.want)
+		}
+	}
+}
+
+// The same config in all three formats loads the same.
+func TestConfigFormatsAgree(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+defaults:
+  remote: u@login
+  compress_level: 3
+profiles:
+  explorer:
+    log_dir: /scratch/u/logs
+    notify_local: true
+    artifact_sources:
+      - path: /scratch/u/run
+        artifact_patterns: [".*\\.json$"]
+        flatten: true
+`,
+		"config.json": `{"defaults": {"remote": "u@login", "compress_level": 3},
+ "profiles": {"explorer": {"log_dir": "/scratch/u/logs", "notify_local": true,
+  "artifact_sources": [{"path": "/scratch/u/run", "artifact_patterns": [".*\\.json$"], "flatten": true}]}}}`,
+		"config.toml": `
+[defaults]
+remote = "u@login"
+compress_level = 3
+
+[profiles.explorer]
+log_dir = "/scratch/u/logs"
+notify_local = true
+
+[[profiles.explorer.artifact_sources]]
+path = "/scratch/u/run"
+artifact_patterns = ['.*\.json$']
+flatten = true
+`,
+	}
+	var first *Config
+	for _, name := range []string{"config.yaml", "config.json", "config.toml"} {
+		home := t.TempDir()
+		t.Setenv("EXP_HOME", home)
+		if err := os.WriteFile(filepath.Join(home, name), []byte(files[name]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := loadConfig()
+		if err != nil || cfg == nil {
+			t.Fatalf("%s: %+v, %v", name, cfg, err)
+		}
+		cfg.path = ""
+		if first == nil {
+			first = cfg
+			continue
+		}
+		if !reflect.DeepEqual(cfg, first) {
+			t.Errorf("%s loads as\n%+v\nnot\n%+v", name, cfg, first)
+		}
+	}
+	if p := first.Profiles["explorer"]; len(p.ArtifactSources) != 1 || !p.ArtifactSources[0].Flatten || first.Defaults.CompressLevel != 3 {
+		t.Errorf("config = %+v", first)
+	}
+}
+
+// TOML has bare integers where YAML leaves unquoted numbers as strings, so
+// settings read as strings still take them.
+func TestTOMLBareNumbers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("EXP_HOME", home)
+	writeConfigFiles(t, home, map[string]string{
+		"config.toml": `
+monitor_heartbeat = 0
+command_timeout = 0
+max_concurrent_polls = 2
+
+[defaults]
+remote = "u@login"
+bwlimit = 1000
+max_size = 1048576
+ssh_port = 2222
+`,
+		"run.toml": `
+name = "sweep"
+bwlimit = 500
+min_size = 1024
+confirm_over = 5000000000
+`,
+	})
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heartbeat, err := configMonitorHeartbeat(cfg); err != nil || heartbeat != 0 {
+		t.Errorf("monitor_heartbeat = %v, %v; want 0", heartbeat, err)
+	}
+	if timeouts, err := configTimeouts(cfg); err != nil || timeouts.Command != 0 {
+		t.Errorf("command_timeout = %v, %v; want 0", timeouts.Command, err)
+	}
+	if polls, err := configMaxConcurrentPolls(cfg); err != nil || polls != 2 {
+		t.Errorf("max_concurrent_polls = %d, %v; want 2", polls, err)
+	}
+	if d := cfg.Defaults; d.BWLimit != "1000" || d.MaxSize != "1048576" || d.SSHPort != 2222 {
+		t.Errorf("defaults = %+v", d)
+	}
+
+	run, err := loadRunConfigFile(filepath.Join(home, "run.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.BWLimit != "500" || run.MinSize != "1024" || run.ConfirmOver != "5000000000" {
+		t.Errorf("run config = %+v", run)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trackedJob is what the scheduler still knows about a job submitted outside
+// of exp run.
+type trackedJob struct {
+	Name      string
+	Script    string
+	Args      []string
+	LogPath   string
+	State     string
+	Submitted time.Time
+}
+
+// exp track --remote user@host --job-id ID [--cluster NAME] [--name NAME] [--artifact-remote DIR --artifact-dest DIR] [--watch]
+func cmdTrack(args []string) error {
+	fs := flag.NewFlagSet("track", flag.ExitOnError)
+	var (
+		remote           string
+		jobID            string
+		cluster          string
+		name             string
+		artifactRemote   string
+		artifactDest     string
+		artifactPatterns multiStringFlag
+		watch            bool
+	)
+	fs.StringVar(&remote, "remote", "", "Remote user@host where the job was submitted (required, or set EXP_REMOTE)")
+	fs.StringVar(&jobID, "job-id", "", "Slurm job ID to adopt (required)")
+	fs.StringVar(&cluster, "cluster", "", "Cluster the job was submitted to with sbatch -M, on a multi-cluster Slurm setup")
+	fs.StringVar(&name, "name", "", "Experiment name (defaults to the Slurm job name)")
+	fs.StringVar(&artifactRemote, "artifact-remote", "", "REMOTE directory tree to sync after the job completes (optional)")
+	fs.StringVar(&artifactDest, "artifact-dest", "", "LOCAL directory to store downloaded artifacts (optional)")
+	fs.Var(&artifactPatterns, "artifact-pattern", "Regex filter applied to full remote artifact paths; may be repeated")
+	fs.BoolVar(&watch, "watch", false, "Monitor the job after adopting it (and fetch artifacts when it finishes)")
+	artifactSinceStartFlag := boolFlag{value: true}
+	fs.Var(&artifactSinceStartFlag, "artifact-since-start", "Only copy files newer than the job's submit time when syncing artifacts")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp track --remote user@host --job-id ID [--cluster NAME] [--name NAME] [--artifact-remote DIR --artifact-dest DIR] [--watch]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if remote == "" {
+		remote = os.Getenv("EXP_REMOTE")
+	}
+	if remote == "" || jobID == "" {
+		fs.Usage()
+		return fmt.Errorf("remote and job-id are required")
+	}
+	if (artifactRemote == "") != (artifactDest == "") {
+		return fmt.Errorf("artifact-remote and artifact-dest must be provided together")
+	}
+	if artifactRemote != "" && !strings.HasPrefix(artifactRemote, "/") {
+		return fmt.Errorf("artifact-remote must be an absolute path on the remote host")
+	}
+	if err := validateCluster(cluster); err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	var existing int64
+	err = db.QueryRow(`SELECT id FROM experiments WHERE remote = ? AND job_id = ? LIMIT 1`, remote, jobID).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("job %s on %s is already tracked as experiment %d (see exp show %d)", jobID, remote, existing, existing)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	job, err := lookupSlurmJob(remote, cluster, jobID)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = job.Name
+	}
+	if err := validateExperimentName(name); err != nil {
+		return fmt.Errorf("%w (pass --name to choose a different one)", err)
+	}
+	createdAt := job.Submitted
+	if createdAt.IsZero() {
+		fmt.Println("Warning: scheduler did not report a submit time; using now (the since-start artifact filter may skip files)")
+		createdAt = time.Now().UTC()
+	}
+
+	var sources []ArtifactSource
+	artifactDestAbs := ""
+	if artifactRemote != "" {
+		if artifactDestAbs, err = expandLocalPath(artifactDest); err != nil {
+			return fmt.Errorf("artifact-dest: %w", err)
+		}
+		sources = []ArtifactSource{{Path: artifactRemote, Patterns: ensurePatterns(artifactPatterns.Values())}}
+	}
+	snapshot := RunSnapshot{
+		Name:               name,
+		Remote:             remote,
+		Script:             job.Script,
+		ArtifactRemote:     artifactRemote,
+		ArtifactSources:    copyArtifactSources(sources),
+		ArtifactPattern:    combinePatterns(flattenPatternsFromSources(sources)),
+		ArtifactSinceStart: artifactSinceStartFlag.value,
+		PollInterval:       defaultPollInterval.String(),
+		Args:               append([]string(nil), job.Args...),
+		Cluster:            cluster,
+	}
+	if job.LogPath != "" {
+		snapshot.LogDir = filepath.Dir(job.LogPath)
+	}
+
+	var id int64
+	argsDisplay, argsJSON := argsColumns(job.Args)
+	err = inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`INSERT INTO experiments (name, remote, script_path, args, args_json, git_commit, git_branch, job_id, job_status, log_path,
+                                  created_at, completed_at, artifact_remote, artifact_dest, artifact_pattern,
+                                  artifact_since_start, artifact_last_sync, artifact_last_error, config_snapshot, cluster)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, remote, job.Script, argsDisplay, argsJSON, "", "", jobID, job.State, job.LogPath,
+			createdAt.UTC().Format(time.RFC3339), "", artifactRemote, "", snapshot.ArtifactPattern,
+			boolToInt(snapshot.ArtifactSinceStart), "", "", "", nullString(cluster),
+		)
+		if err != nil {
+			return fmt.Errorf("insert experiment: %w", err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if err := writeArtifactSources(tx, id, sources); err != nil {
+			return err
+		}
+		snapshot.ArtifactDest = artifactDestAbs
+		if artifactDestAbs != "" {
+			snapshot.ArtifactDest = filepath.Join(artifactDestAbs, fmt.Sprintf("%d", id))
+		}
+		snapshotBytes, err := json.Marshal(snapshot)
+		if err != nil {
+			return fmt.Errorf("marshal config snapshot: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE experiments SET artifact_dest = ?, config_snapshot = ? WHERE id = ?`,
+			snapshot.ArtifactDest, string(snapshotBytes), id); err != nil {
+			return fmt.Errorf("update experiment snapshot: %w", err)
+		}
+		return recordStatusEvent(tx, id, job.State, "adopted with exp track")
+	})
+	if err != nil {
+		return err
+	}
+	if artifactDestAbs != "" {
+		artifactDestAbs = snapshot.ArtifactDest
+		if err := os.MkdirAll(artifactDestAbs, 0o755); err != nil {
+			return fmt.Errorf("ensure artifact destination %s: %w", artifactDestAbs, err)
+		}
+	}
+
+	fmt.Printf("Tracking job %s on %s as experiment %d (%s, %s)\n", jobID, remote, id, name, job.State)
+	if job.Script != "" {
+		fmt.Printf("Script:       %s\n", job.Script)
+	}
+	if job.LogPath != "" {
+		fmt.Printf("Remote log:   %s\n", job.LogPath)
+	}
+	fmt.Printf("Submitted at: %s\n", createdAt.Format(time.RFC3339))
+
+	if !watch {
+		return nil
+	}
+	exp, err := findExperiment(db, fmt.Sprintf("%d", id))
+	if err != nil {
+		return err
+	}
+	if !isLiveStatus(exp.JobStatus) {
+		fmt.Printf("Job already finished with status %s\n", exp.JobStatus)
+		if len(sources) == 0 {
+			return nil
+		}
+	}
+	return monitorExperiment(db, exp, defaultPollInterval, monitorOptions{})
+}
+
+// lookupSlurmJob combines scontrol (script, log path; only while the
+// controller remembers the job) with sacct (submit time, state; kept in the
+// accounting database for much longer), both asked on cluster. exp track has
+// no ssh options of its own, so remote is reached as ~/.ssh/config says.
+func lookupSlurmJob(remote, cluster, jobID string) (*trackedJob, error) {
+	job := &trackedJob{}
+	scontrolOut, scontrolErr := sshCommand(remote, sshHostOptions{}, slurmArgs(cluster, "scontrol", "show", "job", "-o", jobID)...).CombinedOutput()
+	if scontrolErr == nil {
+		fields := parseScontrolFields(string(scontrolOut))
+		job.Name = fields["JobName"]
+		job.State = fields["JobState"]
+		job.LogPath = fields["StdOut"]
+		if cmd := strings.Fields(fields["Command"]); len(cmd) > 0 {
+			job.Script, job.Args = cmd[0], cmd[1:]
+		}
+		job.Submitted = parseSlurmTime(fields["SubmitTime"])
+	}
+	sacctOut, sacctErr := sshCommand(remote, sshHostOptions{}, slurmArgs(cluster, "sacct", "-n", "-X", "-P", "-j", jobID, "-o", "JobName,Submit,State")...).CombinedOutput()
+	if sacctErr == nil {
+		if name, submitted, state, ok := parseSacctTrackLine(string(sacctOut)); ok {
+			if job.Name == "" {
+				job.Name = name
+			}
+			if job.State == "" {
+				job.State = state
+			}
+			if !submitted.IsZero() {
+				job.Submitted = submitted
+			}
+		}
+	}
+	if job.State == "" {
+		return nil, fmt.Errorf("job %s not found on %s\nscontrol: %s\nsacct: %s", jobID, remote,
+			strings.TrimSpace(string(scontrolOut)), strings.TrimSpace(string(sacctOut)))
+	}
+	return job, nil
+}
+
+// scontrolKeyPattern matches scontrol field names (JobName, Socks/Node,
+// NtasksPerN:B:S:C). Script arguments such as --k=10 or model=resnet do not.
+var scontrolKeyPattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9:/_]*$`)
+
+// parseScontrolFields parses one-line "scontrol show job -o" output. Values
+// may contain spaces (Command=script arg1 arg2), so tokens that do not start
+// a new field are appended to the previous value.
+func parseScontrolFields(out string) map[string]string {
+	fields := make(map[string]string)
+	last := ""
+	for _, tok := range strings.Fields(out) {
+		key, val, ok := strings.Cut(tok, "=")
+		if !ok || !scontrolKeyPattern.MatchString(key) {
+			if last != "" {
+				fields[last] += " " + tok
+			}
+			continue
+		}
+		fields[key] = val
+		last = key
+	}
+	return fields
+}
+
+// parseSacctTrackLine parses the first "JobName|Submit|State" line.
+func parseSacctTrackLine(out string) (name string, submitted time.Time, state string, ok bool) {
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) < 3 {
+			continue
+		}
+		state = parts[2]
+		if idx := strings.Index(state, " "); idx >= 0 {
+			state = state[:idx]
+		}
+		return parts[0], parseSlurmTime(parts[1]), strings.Trim(state, "+"), true
+	}
+	return "", time.Time{}, "", false
+}
+
+// parseSlurmTime parses the epoch seconds Slurm prints under slurmTimeEnv,
+// or, from a Slurm that ignores it, a "2006-01-02T15:04:05" timestamp taken
+// to be local; "Unknown" and "None" yield the zero time.
+func parseSlurmTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if secs <= 0 {
+			return time.Time{}
+		}
+		return time.Unix(secs, 0).UTC()
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScontrolFields(t *testing.T) {
+	out := "JobId=2723147 JobName=bigann-k100 UserId=arunit(1000) JobState=RUNNING Reason=None Socks/Node=* " +
+		"SubmitTime=2025-01-02T03:04:05 Command=/home/a/query.sbatch --k 100 --beam=8 model=resnet " +
+		"WorkDir=/home/a StdOut=/logs/bigann-k100-2723147.out\n"
+	f := parseScontrolFields(out)
+	if f["JobName"] != "bigann-k100" || f["JobState"] != "RUNNING" || f["StdOut"] != "/logs/bigann-k100-2723147.out" {
+		t.Fatalf("fields = %v", f)
+	}
+	if f["Command"] != "/home/a/query.sbatch --k 100 --beam=8 model=resnet" {
+		t.Fatalf("Command = %q", f["Command"])
+	}
+}
+
+func TestParseSacctTrackLine(t *testing.T) {
+	name, submitted, state, ok := parseSacctTrackLine("bigann|2025-01-02T03:04:05|CANCELLED by 1000\n")
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local).UTC()
+	if !ok || name != "bigann" || state != "CANCELLED" || !submitted.Equal(want) {
+		t.Fatalf("got %q %v %q %v", name, submitted, state, ok)
+	}
+	if _, s, _, _ := parseSacctTrackLine("x|Unknown|PENDING"); !s.IsZero() {
+		t.Fatalf("Unknown submit time parsed as %v", s)
+	}
+}
+
+func TestParseSlurmTimeEpoch(t *testing.T) {
+	// Under slurmTimeEnv the cluster's time zone does not matter.
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got := parseSlurmTime(" 1735787045\n"); !got.Equal(want) {
+		t.Errorf("parseSlurmTime = %v, want %v", got, want)
+	}
+	for _, s := range []string{"Unknown", "None", "0", "N/A"} {
+		if got := parseSlurmTime(s); !got.IsZero() {
+			t.Errorf("parseSlurmTime(%q) = %v, want zero", s, got)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Transfer backends for exp fetch --transfer. auto uses rsync when it is
+// installed locally and on the remote host, and tar over ssh otherwise.
+const (
+	transferAuto  = "auto"
+	transferRsync = "rsync"
+	transferSCP   = "scp"
+	transferTar   = "tar"
+)
+
+func normalizeTransfer(s string) (string, error) {
+	switch t := strings.ToLower(strings.TrimSpace(s)); t {
+	case "", transferAuto:
+		return "", nil
+	case transferRsync, transferSCP, transferTar:
+		return t, nil
+	case "sftp":
+		return transferSCP, nil
+	default:
+		return "", fmt.Errorf("transfer %q must be auto, rsync, scp or tar", s)
+	}
+}
+
+// routeVia returns sources with via standing in for the submission host, so
+// bulk transfers go through a data-transfer node; sources with a remote of
+// their own keep it. It first checks with one ssh call that via sees every
+// rerouted source directory.
+func routeVia(w io.Writer, exp *Experiment, sources []ArtifactSource, via string) ([]ArtifactSource, error) {
+	routed := copyArtifactSources(sources)
+	var paths []string
+	for i := range routed {
+		if routed[i].Remote == "" {
+			routed[i].Remote = via
+			paths = append(paths, routed[i].Path)
+		}
+	}
+	if len(paths) == 0 {
+		return routed, nil
+	}
+	fmt.Fprintf(w, "Transferring through %s instead of %s\n", via, exp.Remote)
+	cmd := sshCommand(via, exp.SSH, "bash", "-c", shellQuote(missingDirsCommand(paths)))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("transfer host %s: %v\n%s", via, err, strings.TrimSpace(stderr.String()))
+	}
+	if out := strings.TrimSpace(stdout.String()); out != "" {
+		missing := strings.Split(out, "\n")
+		return nil, fmt.Errorf("artifact path(s) %s are not visible from transfer host %s; check the filesystem is mounted there, or fetch without --via/transfer_remote", strings.Join(missing, ", "), via)
+	}
+	return routed, nil
+}
+
+// missingDirsCommand prints each of paths that is not a directory, one per
+// line.
+func missingDirsCommand(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	return fmt.Sprintf(`for d in %s; do test -d "$d" || printf '%%s\n' "$d"; done`, strings.Join(quoted, " "))
+}
+
+// remoteRsync caches, per host, whether rsync is on the remote PATH so a
+// multi-source fetch asks once.
+var remoteRsync = struct {
+	sync.Mutex
+	hosts map[string]bool
+}{hosts: make(map[string]bool)}
+
+func remoteHasRsync(remote string, sshOpts sshHostOptions) bool {
+	remoteRsync.Lock()
+	defer remoteRsync.Unlock()
+	if ok, cached := remoteRsync.hosts[remote]; cached {
+		return ok
+	}
+	err := sshCommand(remote, sshOpts, "command -v rsync >/dev/null").Run()
+	// Only a clean "not found" counts; an ssh failure will surface again in
+	// the transfer itself.
+	code, exited := exitCode(err)
+	ok := err == nil || !(exited && code == 1)
+	remoteRsync.hosts[remote] = ok
+	return ok
+}
+
+// chooseTransfer resolves the backend for remote, explaining a fallback.
+// With ssh_backend: native only tar works: rsync and sftp run the ssh
+// binary, which such a machine need not have and whose config exp ignores.
+func chooseTransfer(w io.Writer, remote string, sshOpts sshHostOptions, requested string) (string, error) {
+	_, native := remoteExecutor.(*nativeExecutor)
+	if native {
+		if requested != "" && requested != transferTar {
+			return "", fmt.Errorf("--transfer %s runs the ssh binary; with ssh_backend: %s use --transfer %s", requested, sshBackendNative, transferTar)
+		}
+		return transferTar, nil
+	}
+	if requested != "" {
+		return requested, nil
+	}
+	if _, err := exec.LookPath("rsync"); err != nil {
+		fmt.Fprintln(w, "rsync is not installed locally; transferring with tar over ssh.")
+		return transferTar, nil
+	}
+	if !remoteHasRsync(remote, sshOpts) {
+		fmt.Fprintf(w, "rsync is not available on %s; transferring with tar over ssh.\n", remote)
+		return transferTar, nil
+	}
+	return transferRsync, nil
+}
+
+// transferFiles copies files (relative to src.Path on remote) into dest with
+// the backend opts.Transfer selects, keeping their relative paths. It
+// returns what was transferred; only rsync reports the bytes.
+func transferFiles(w io.Writer, remote string, sshOpts sshHostOptions, src ArtifactSource, files []string, dest string, opts fetchOptions) (transferTally, error) {
+	if len(files) == 0 {
+		return transferTally{}, nil
+	}
+	backend, err := chooseTransfer(w, remote, sshOpts, opts.Transfer)
+	if err != nil {
+		return transferTally{}, err
+	}
+	if backend == transferRsync {
+		return rsyncFiles(w, remote, sshOpts, src, files, dest, opts)
+	}
+	if opts.BWLimit != "" || opts.AppendVerify || opts.Checksum {
+		fmt.Fprintf(w, "Note: --bwlimit, --append-verify and --checksum only apply to rsync; ignored for %s.\n", backend)
+	}
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return transferTally{}, fmt.Errorf("resolve destination: %w", err)
+	}
+	if err := os.MkdirAll(absDest, 0o755); err != nil {
+		return transferTally{}, fmt.Errorf("ensure destination: %w", err)
+	}
+	if backend == transferSCP {
+		err = sftpFiles(w, remote, sshOpts, src, files, absDest)
+	} else {
+		err = tarFiles(w, remote, sshOpts, src, files, absDest)
+	}
+	if err != nil {
+		return transferTally{}, err
+	}
+	fmt.Fprintf(w, "Transferred %d file(s) with %s.\n", len(files), backend)
+	return transferTally{Files: len(files), Bytes: -1}, nil
+}
+
+// tarCommands returns the remote script that streams the files named on its
+// stdin (NUL-separated, relative to root) as a tar archive, and the local tar
+// arguments that unpack it into absDest.
+func tarCommands(root, symlinks, absDest string) (string, []string) {
+	create := "-cf"
+	if symlinks == symlinksFollow {
+		// Archive what the links point at.
+		create = "-chf"
+	}
+	script := fmt.Sprintf("cd %s && tar %s - --null -T -", shellQuote(root), create)
+	return script, []string{"-xf", "-", "-C", absDest}
+}
+
+func tarFiles(w io.Writer, remote string, sshOpts sshHostOptions, src ArtifactSource, files []string, absDest string) error {
+	script, localArgs := tarCommands(src.Path, src.Symlinks, absDest)
+	fmt.Fprintf(w, "Starting transfer: ssh %s %s | tar %s\n", remote, script, strings.Join(localArgs, " "))
+	pack := sshCommand(remote, sshOpts, "bash", "-c", shellQuote(script)).withTimeout(timeouts.Transfer)
+	pack.Stdin = strings.NewReader(filesFrom0(files))
+	unpack := runCommand("tar", localArgs...)
+	var packErr, unpackErr bytes.Buffer
+	pack.Stderr = &packErr
+	unpack.Stderr = &unpackErr
+	// A plain pipe rather than StdoutPipe, which Wait would close under
+	// the local tar while it is still reading.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	pack.Stdout, unpack.Stdin = pw, pr
+	err = unpack.Start()
+	// Only the local tar reads; if it dies, the remote end gets EPIPE
+	// instead of blocking on a pipe this process still holds open.
+	pr.Close()
+	if err != nil {
+		pw.Close()
+		return fmt.Errorf("start local tar: %w", err)
+	}
+	if err := pack.Start(); err != nil {
+		pw.Close()
+		unpack.Wait()
+		return fmt.Errorf("start remote tar: %w", err)
+	}
+	// ssh now holds its own copy of the write end, unless a native session
+	// or --debug-log's tee writes it from this process; then it is closed
+	// once pack is done.
+	if pack.session == nil && pack.Stdout == io.Writer(pw) {
+		pw.Close()
+	}
+	err = pack.Wait()
+	pw.Close()
+	if err != nil {
+		unpack.Wait()
+		return fmt.Errorf("remote tar failed: %v\n%s", err, strings.TrimSpace(packErr.String()))
+	}
+	if err := unpack.Wait(); err != nil {
+		return fmt.Errorf("local tar failed: %v\n%s", err, strings.TrimSpace(unpackErr.String()))
+	}
+	return nil
+}
+
+// sftpBatch returns an sftp batch script fetching each file from root into
+// the same relative path under absDest. Paths are double-quoted; remote ones
+// also escape glob characters since sftp expands them. sftp batch files
+// cannot express a newline in a name.
+func sftpBatch(root string, files []string, absDest string) (string, error) {
+	var b strings.Builder
+	for _, rel := range files {
+		if strings.ContainsAny(rel, "\n\r") {
+			return "", fmt.Errorf("%s: scp cannot transfer names containing newlines; use --transfer tar", displayPath(rel))
+		}
+		remote := path.Join(root, rel)
+		local := filepath.Join(absDest, filepath.FromSlash(rel))
+		fmt.Fprintf(&b, "get -p %s %s\n", sftpQuote(remote, true), sftpQuote(local, false))
+	}
+	return b.String(), nil
+}
+
+func sftpQuote(s string, glob bool) string {
+	special := `"\`
+	if glob {
+		special += "*?[]"
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// sftpFiles is the scp backend. It drives one sftp session in batch mode
+// rather than running scp, whose remote side re-parses paths with a shell.
+func sftpFiles(w io.Writer, remote string, sshOpts sshHostOptions, src ArtifactSource, files []string, absDest string) error {
+	batch, err := sftpBatch(src.Path, files, absDest)
+	if err != nil {
+		return err
+	}
+	for _, rel := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(absDest, filepath.FromSlash(rel))), 0o755); err != nil {
+			return fmt.Errorf("ensure destination: %w", err)
+		}
+	}
+	fmt.Fprintf(w, "Starting transfer: sftp -b - %s (%d file(s))\n", remote, len(files))
+	cmd := muxCommand("sftp", sshOpts, "-q", "-b", "-", remote)
+	cmd.Stdin = strings.NewReader(batch)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sftp failed: %v\n%s", err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRsyncArgs(t *testing.T) {
+	off := false
+	opts := fetchOptions{Checksum: true, BWLimit: "1M", Compress: &off}
+	src := ArtifactSource{Path: "/remote/out/", Symlinks: symlinksFollow}
+	args := rsyncArgs("u@storage", src, []string{"a.json"}, "/data/7", opts)
+	got := strings.Join(args, " ")
+	want := "-av --stats --files-from=- --from0 --partial --partial-dir=" + rsyncPartialDir + " --checksum --bwlimit=1M --copy-links u@storage:/remote/out/ /data/7"
+	if got != want {
+		t.Errorf("rsync args:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestRsyncFilesCountsEveryAttempt(t *testing.T) {
+	bin := t.TempDir()
+	failed := filepath.Join(bin, "failed")
+	// The first attempt dies after two files; the retry sends the other three.
+	script := `#!/bin/sh
+case "$1" in --version) echo "rsync  version 3.2.7  protocol version 31"; exit 0 ;; esac
+cat >/dev/null
+if [ ! -e ` + shellQuote(failed) + ` ]; then
+	touch ` + shellQuote(failed) + `
+	printf '        200  40%%    1.00MB/s    0:00:01 (xfr#2, to-chk=3/5)\n'
+	exit 10
+fi
+printf 'Number of regular files transferred: 3\nTotal transferred file size: 300 bytes\n'
+`
+	if err := os.WriteFile(filepath.Join(bin, "rsync"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	useTestMux(t, nil)
+
+	var out bytes.Buffer
+	opts := fetchOptions{RsyncRetries: 1, RsyncBackoff: time.Millisecond}
+	tally, err := rsyncFiles(&out, "u@cluster", sshHostOptions{}, ArtifactSource{Path: "/remote/out"}, []string{"a", "b", "c", "d", "e"}, t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("rsyncFiles: %v\n%s", err, out.String())
+	}
+	if tally.Files != 5 {
+		t.Errorf("tally = %+v, want the 2 files of the failed attempt plus 3", tally)
+	}
+}
+
+func TestTarTransfer(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not available")
+	}
+	root := t.TempDir()
+	files := []string{"results/run 1.json", "top.csv", `odd "name".log`}
+	for _, rel := range files {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(rel), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := t.TempDir()
+	script, localArgs := tarCommands(root, "", dest)
+	if want := "cd " + shellQuote(root) + " && tar -cf - --null -T -"; script != want {
+		t.Errorf("remote script = %q, want %q", script, want)
+	}
+	if follow, _ := tarCommands(root, symlinksFollow, dest); !strings.Contains(follow, "tar -chf -") {
+		t.Errorf("follow script = %q", follow)
+	}
+
+	// Run the remote half locally, the way ssh would.
+	pack := exec.Command("bash", "-c", script)
+	pack.Stdin = strings.NewReader(filesFrom0(files))
+	unpack := exec.Command("tar", localArgs...)
+	pipe, err := pack.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpack.Stdin = pipe
+	if err := unpack.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pack.Run(); err != nil {
+		t.Skipf("tar --null -T not supported: %v", err)
+	}
+	if err := unpack.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+		if err != nil || string(data) != rel {
+			t.Errorf("%s: %q, %v", rel, data, err)
+		}
+	}
+
+	// The same through tarFiles, with the "remote" shell run locally.
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	dest = t.TempDir()
+	var out bytes.Buffer
+	if err := tarFiles(&out, "u@cluster", sshHostOptions{}, ArtifactSource{Path: root}, files, dest); err != nil {
+		t.Fatalf("tarFiles: %v\n%s", err, out.String())
+	}
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+		if err != nil || string(data) != rel {
+			t.Errorf("tarFiles %s: %q, %v", rel, data, err)
+		}
+	}
+}
+
+func TestSFTPBatch(t *testing.T) {
+	batch, err := sftpBatch("/remote/out", []string{"a/run[1].json", `say "hi".txt`}, "/data/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `get -p "/remote/out/a/run\[1\].json" "/data/7/a/run[1].json"` + "\n" +
+		`get -p "/remote/out/say \"hi\".txt" "/data/7/say \"hi\".txt"` + "\n"
+	if batch != want {
+		t.Errorf("batch:\n%s\nwant:\n%s", batch, want)
+	}
+	if _, err := sftpBatch("/remote/out", []string{"new\nline"}, "/data/7"); err == nil {
+		t.Error("a newline in a name should be rejected")
+	}
+
+	for in, want := range map[string]string{"": "", "auto": "", "TAR": transferTar, "sftp": transferSCP, "rsync": transferRsync} {
+		if got, err := normalizeTransfer(in); err != nil || got != want {
+			t.Errorf("normalizeTransfer(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := normalizeTransfer("ftp"); err == nil {
+		t.Error("unknown backend accepted")
+	}
+	if got, err := chooseTransfer(&strings.Builder{}, "u@h", sshHostOptions{}, transferSCP); err != nil || got != transferSCP {
+		t.Errorf("an explicit backend must be used as is, got %q, %v", got, err)
+	}
+
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = newNativeExecutor(nil)
+	if got, err := chooseTransfer(&strings.Builder{}, "u@h", sshHostOptions{}, ""); err != nil || got != transferTar {
+		t.Errorf("auto with the native backend = %q, %v, want tar", got, err)
+	}
+	for _, backend := range []string{transferRsync, transferSCP} {
+		if _, err := chooseTransfer(&strings.Builder{}, "u@h", sshHostOptions{}, backend); err == nil || !strings.Contains(err.Error(), "ssh_backend") {
+			t.Errorf("--transfer %s with the native backend: err = %v", backend, err)
+		}
+	}
+}
+
+func TestCopyTarEntries(t *testing.T) {
+	var remote bytes.Buffer
+	tw := tar.NewWriter(&remote)
+	for _, name := range []string{"./results/run1/metrics.json", "top.csv"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(name)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(name))
+	}
+	tw.Close()
+
+	var local bytes.Buffer
+	out := tar.NewWriter(&local)
+	flat := map[string]string{"results/run1/metrics.json": "run1_metrics.json"}
+	localName := func(rel string) string {
+		if name, ok := flat[rel]; ok {
+			return name
+		}
+		return rel
+	}
+	n, size, err := copyTarEntries(out, &remote, "bigann", localName)
+	if err != nil || n != 2 || size != int64(len("./results/run1/metrics.json")+len("top.csv")) {
+		t.Fatalf("copyTarEntries = %d, %d, %v", n, size, err)
+	}
+	out.Close()
+
+	var names []string
+	tr := tar.NewReader(&local)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if want := []string{"bigann/run1_metrics.json", "bigann/top.csv"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+}
+
+func TestRouteVia(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	root := t.TempDir()
+	present := filepath.Join(root, "run dir")
+	if err := os.Mkdir(present, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "not mounted")
+	out, err := exec.Command("bash", "-c", missingDirsCommand([]string{present, missing})).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != missing+"\n" {
+		t.Errorf("missing dirs = %q, want only %q", out, missing)
+	}
+
+	// Sources with a host of their own are left alone, with no preflight.
+	exp := &Experiment{Remote: "u@login"}
+	sources := []ArtifactSource{{Path: "/data/run", Remote: "u@storage"}}
+	routed, err := routeVia(io.Discard, exp, sources, "u@dtn")
+	if err != nil || !reflect.DeepEqual(routed, sources) {
+		t.Errorf("routeVia = %+v, %v", routed, err)
+	}
+}
+
+func TestFetchTarIsNotASync(t *testing.T) {
+	saved := remoteExecutor
+	t.Cleanup(func() { remoteExecutor = saved })
+	remoteExecutor = &localExecutor{}
+	useTestMux(t, nil)
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "metrics.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db := openTestDB(t)
+	id := insertTestExperiment(t, db, "tar", "COMPLETED", "")
+	exp, err := findExperiment(db, strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.ArtifactSources = []ArtifactSource{{Path: root, Patterns: []string{`\.json$`}}}
+	var progress bytes.Buffer
+	archive := filepath.Join(t.TempDir(), "out.tar")
+	stats, err := fetchExperiment(db, exp, fetchFlags{tarPath: archive, out: &progress})
+	if err != nil {
+		t.Fatalf("fetch --tar: %v\n%s", err, progress.String())
+	}
+	if stats.Files != 1 || !strings.Contains(progress.String(), "Archiving 1 file(s)") {
+		t.Errorf("stats = %+v, progress:\n%s", stats, progress.String())
+	}
+	if exp, err = findExperiment(db, strconv.FormatInt(id, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if !exp.ArtifactLastSync.IsZero() || exp.ArtifactSyncStats.Files != 0 {
+		t.Errorf("an archive export was recorded as a sync: %v %+v", exp.ArtifactLastSync, exp.ArtifactSyncStats)
+	}
+}
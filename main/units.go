@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatBytes renders a byte count with binary units, e.g. "1.3 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatCount renders n with thousands separators, e.g. "3,214".
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	start := 0
+	if n < 0 {
+		start = 1
+	}
+	for i := len(s) - 3; i > start; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// parseSize accepts plain byte counts or human-friendly sizes such as "10M",
+// "1.5G", or "200GiB". Suffixes are binary (K = 1024).
+func parseSize(s string) (int64, error) {
+	orig := s
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	s = strings.TrimSuffix(s, "IB")
+	s = strings.TrimSuffix(s, "B")
+	mult := float64(1)
+	if s != "" {
+		if idx := strings.IndexByte("KMGTP", s[len(s)-1]); idx >= 0 {
+			mult = math.Pow(1024, float64(idx+1))
+			s = s[:len(s)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q (examples: 500K, 10M, 1.5G)", orig)
+	}
+	return int64(v * mult), nil
+}
+
+var bwLimitRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)(?:([KMG])(?:I?B)?)?$`)
+
+// parseBWLimit validates an rsync --bwlimit rate such as "500", "500K", "1.5M"
+// or "2MiB"; like rsync, a bare number is KiB per second. It returns the rate
+// in the form passed to rsync, or "" when the rate is zero (no limit).
+func parseBWLimit(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	m := bwLimitRe.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil {
+		return "", fmt.Errorf("invalid bandwidth limit %q (examples: 500K, 1.5M; a bare number is KiB/s)", s)
+	}
+	if v, _ := strconv.ParseFloat(m[1], 64); v == 0 {
+		return "", nil
+	}
+	unit := m[2]
+	if unit == "" {
+		unit = "K"
+	}
+	return m[1] + unit, nil
+}
+
+// parseAge extends time.ParseDuration with day ("d") and week ("w") units so
+// retention-style values like "90d" work.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (examples: 45m, 12h, 90d)", s)
+	}
+	return d, nil
+}
+
+// parseSinceTime reads a fetch cutoff given either as a timestamp (RFC3339,
+// "2006-01-02 15:04" or "2006-01-02", local time) or as an age relative to now
+// such as 6h or 2d.
+func parseSinceTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use a timestamp like 2024-05-01T12:00:00Z or an age like 6h)", s)
+	}
+	return now.Add(-age), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":    512,
+		"10K":    10 * 1024,
+		"10M":    10 * 1024 * 1024,
+		"1.5G":   1536 * 1024 * 1024,
+		"2GiB":   2 * 1024 * 1024 * 1024,
+		" 100b ": 100,
+	}
+	for in, want := range cases {
+		got, err := parseSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "ten", "-5M"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("parseSize(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseBWLimit(t *testing.T) {
+	cases := map[string]string{
+		"":     "",
+		"0":    "",
+		"0.0M": "",
+		"500":  "500K",
+		"500k": "500K",
+		"1.5M": "1.5M",
+		"2MiB": "2M",
+		" 1G ": "1G",
+	}
+	for in, want := range cases {
+		got, err := parseBWLimit(in)
+		if err != nil || got != want {
+			t.Errorf("parseBWLimit(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"fast", "-1M", "10T", "1.5MBps"} {
+		if _, err := parseBWLimit(bad); err == nil {
+			t.Errorf("parseBWLimit(%q): expected error", bad)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:                      "0 B",
+		1023:                   "1023 B",
+		1536:                   "1.5 KiB",
+		1395864371:             "1.3 GiB",
+		5 * 1024 * 1024 * 1024: "5.0 GiB",
+	}
+	for in, want := range cases {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"90d": 90 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+		"45m": 45 * time.Minute,
+	}
+	for in, want := range cases {
+		got, err := parseAge(in)
+		if err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseAge("soon"); err == nil {
+		t.Error("parseAge(soon): expected error")
+	}
+}
+
+func TestParseSinceTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"6h":                   now.Add(-6 * time.Hour),
+		"2d":                   now.Add(-48 * time.Hour),
+		"2024-04-30T08:00:00Z": time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC),
+		"2024-04-30 08:00":     time.Date(2024, 4, 30, 8, 0, 0, 0, time.Local),
+	}
+	for in, want := range cases {
+		got, err := parseSinceTime(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseSinceTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseSinceTime("yesterday", now); err == nil {
+		t.Error("parseSinceTime(yesterday): expected error")
+	}
+}
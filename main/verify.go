@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileInfo is the size (and optional sha256) of one artifact file, keyed by
+// its path relative to the artifact source root or local destination.
+type fileInfo struct {
+	Size   int64
+	SHA256 string
+}
+
+// artifactEntry is one row of a local/remote artifact comparison.
+type artifactEntry struct {
+	Rel    string    `json:"path"`
+	Source string    `json:"source,omitempty"`
+	Remote *fileInfo `json:"remote,omitempty"`
+	Local  *fileInfo `json:"local,omitempty"`
+
+	// srcRel is Rel relative to the source root; it differs from Rel when
+	// the source syncs into its own subdirectory.
+	srcRel string
+}
+
+func (e artifactEntry) state() string {
+	switch {
+	case e.Remote != nil && e.Local == nil:
+		return "missing"
+	case e.Remote == nil && e.Local != nil:
+		return "extra"
+	case e.Remote.Size != e.Local.Size:
+		return "size-mismatch"
+	case e.Remote.SHA256 != "" && e.Local.SHA256 != "" && e.Remote.SHA256 != e.Local.SHA256:
+		return "checksum-mismatch"
+	default:
+		return "ok"
+	}
+}
+
+// exp verify <id> [--checksum] [--fix]
+func cmdVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		checksum bool
+		fix      bool
+	)
+	fs.BoolVar(&checksum, "checksum", false, "Also compare sha256 checksums (slower; hashes every file on both sides)")
+	fs.BoolVar(&fix, "fix", false, "Re-fetch missing and mismatched files after reporting")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp verify <id> [--checksum] [--fix]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if exp.ArtifactDest == "" {
+		return fmt.Errorf("experiment %s has no recorded artifact destination", idStr)
+	}
+	sources := exp.EffectiveArtifactSources()
+	if len(sources) == 0 {
+		return fmt.Errorf("no artifact sources recorded for experiment %s", idStr)
+	}
+
+	entries, err := compareArtifacts(exp, sources, checksum)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	toFetch := make(map[string][]string)
+	for _, e := range entries {
+		st := e.state()
+		counts[st]++
+		if st == "ok" {
+			continue
+		}
+		fmt.Printf("%-18s %s\n", st, e.Rel)
+		if st != "extra" {
+			toFetch[e.Source] = append(toFetch[e.Source], e.srcRel)
+		}
+	}
+	differing := len(entries) - counts["ok"]
+	fmt.Printf("Verified %d file(s): %d ok, %d missing, %d extra, %d size mismatch, %d checksum mismatch\n",
+		len(entries), counts["ok"], counts["missing"], counts["extra"], counts["size-mismatch"], counts["checksum-mismatch"])
+
+	if fix && len(toFetch) > 0 {
+		for _, src := range sources {
+			files := toFetch[src.Path]
+			if len(files) == 0 {
+				continue
+			}
+			fmt.Printf("Re-fetching %d file(s) from %s\n", len(files), src.Path)
+			opts := exp.recordedFetchOptions()
+			if _, err := transferFiles(os.Stdout, src.host(exp), exp.SSH, src, files, opts.sourceDest(exp.ArtifactDest, src), opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if differing > 0 {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// compareArtifacts lists each source remotely, walks the local destination,
+// and pairs files by relative path. Only files matching the recorded patterns
+// (and since-start window) are compared, so unrelated files are ignored.
+func compareArtifacts(exp *Experiment, sources []ArtifactSource, checksum bool) ([]artifactEntry, error) {
+	var since time.Time
+	if exp.ArtifactSinceStart {
+		since = exp.CreatedAt
+	}
+	opts := exp.recordedFetchOptions()
+	var shared map[string]fileInfo
+	if !opts.PerSource {
+		var err error
+		if shared, err = listLocalFileInfo(exp.ArtifactDest, checksum, preservesSymlinks(sources)); err != nil {
+			return nil, err
+		}
+	}
+
+	byRel := make(map[string]*artifactEntry)
+	for _, src := range sources {
+		compiled, err := compileMatchers(src.Patterns, src.PatternSyntax)
+		if err != nil {
+			return nil, err
+		}
+		local, prefix := shared, ""
+		if opts.PerSource {
+			if local, err = listLocalFileInfo(opts.sourceDest(exp.ArtifactDest, src), checksum, src.Symlinks == symlinksPreserve); err != nil {
+				return nil, err
+			}
+			prefix = src.Name + "/"
+		}
+		remote, err := listRemoteFileInfo(src.host(exp), exp.SSH, src.Path, src.Symlinks, src.PruneDirs, since, checksum)
+		if err != nil {
+			return nil, err
+		}
+		for rel, info := range remote {
+			if !patternMatches(compiled, src.Path, rel) {
+				continue
+			}
+			info := info
+			byRel[prefix+rel] = &artifactEntry{Rel: prefix + rel, Source: src.Path, Remote: &info, srcRel: rel}
+		}
+		for rel, info := range local {
+			if !patternMatches(compiled, src.Path, rel) {
+				continue
+			}
+			info := info
+			if e, ok := byRel[prefix+rel]; ok {
+				e.Local = &info
+			} else {
+				byRel[prefix+rel] = &artifactEntry{Rel: prefix + rel, Local: &info, srcRel: rel}
+			}
+		}
+	}
+	out := make([]artifactEntry, 0, len(byRel))
+	for _, e := range byRel {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rel < out[j].Rel })
+	return out, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pat := range patterns {
+		pat = strings.TrimSpace(pat)
+		if pat == "" {
+			continue
+		}
+		// (?s) lets "." cross a newline inside a file name.
+		re, err := regexp.Compile("(?s)" + pat)
+		if err != nil {
+			return nil, fmt.Errorf("compile pattern %q: %w", pat, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+const remoteChecksumMarker = "__EXP_SHA256__"
+
+// remoteChecksumScript prints a NUL-terminated "sha256\tpath" record for
+// each file it is given. sha256sum reads the file on stdin, so it never
+// escapes an unusual name the way it does the names it prints.
+const remoteChecksumScript = `for f; do s=$(sha256sum < "$f") || exit 1; printf '%s\t%s\0' "${s%% *}" "${f#./}"; done`
+
+// listRemoteFileInfo lists files under root with their sizes, plus sha256
+// checksums when requested, in a single ssh invocation. Records are
+// NUL-terminated, as in the fetch listing, so any file name survives.
+func listRemoteFileInfo(remote string, sshOpts sshHostOptions, root, symlinks string, prune []string, since time.Time, checksum bool) (map[string]fileInfo, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cd %s && %s", shellQuote(root), findFilesCommand(symlinks, prune, since, ` -printf '%s\t%P\0'`))
+	if checksum {
+		// Preserved links are compared by size only; hashing one that points
+		// at a directory would fail.
+		sumLinks := symlinks
+		if sumLinks == symlinksPreserve {
+			sumLinks = ""
+		}
+		fmt.Fprintf(&b, " && printf '%s\\0' && %s", remoteChecksumMarker,
+			findFilesCommand(sumLinks, prune, since, " -exec sh -c "+shellQuote(remoteChecksumScript)+" sh {} +"))
+	}
+	cmd := sshCommand(remote, sshOpts, "bash", "-lc", shellQuote(b.String())).withTimeout(timeouts.Transfer)
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("remote listing of %s failed: %v\nStderr: %s", root, err, strings.TrimSpace(stderrBuf.String()))
+	}
+	return parseRemoteFileInfo(stdoutBuf.String())
+}
+
+// parseRemoteFileInfo parses NUL-terminated "size\tpath" records, optionally
+// followed by the checksum marker and "sha256\tpath" records.
+func parseRemoteFileInfo(out string) (map[string]fileInfo, error) {
+	files := make(map[string]fileInfo)
+	inChecksums := false
+	for _, line := range strings.Split(out, "\x00") {
+		if line == "" {
+			continue
+		}
+		if line == remoteChecksumMarker {
+			inChecksums = true
+			continue
+		}
+		if inChecksums {
+			sum, rel, ok := strings.Cut(line, "\t")
+			if !ok {
+				return nil, fmt.Errorf("unexpected checksum record %q", line)
+			}
+			info := files[rel]
+			info.SHA256 = sum
+			files[rel] = info
+			continue
+		}
+		sizeStr, rel, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected listing record %q", line)
+		}
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected size in listing record %q", line)
+		}
+		info := files[rel]
+		info.Size = size
+		files[rel] = info
+	}
+	return files, nil
+}
+
+// listLocalFileInfo walks dir and returns regular files keyed by relative
+// path. With links, symlinks are listed too, by their own size and without
+// a checksum, the way the remote listing reports preserved links.
+func listLocalFileInfo(dir string, checksum, links bool) (map[string]fileInfo, error) {
+	files := make(map[string]fileInfo)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() && (d.Name() == rsyncPartialDir || d.Name() == flattenStagingDir) {
+			return filepath.SkipDir
+		}
+		if d.Name() == fetchManifestName && !d.IsDir() {
+			return nil
+		}
+		isLink := d.Type()&os.ModeSymlink != 0
+		if !d.Type().IsRegular() && !(links && isLink) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fi := fileInfo{Size: info.Size()}
+		if checksum && !isLink {
+			if fi.SHA256, err = sha256File(path); err != nil {
+				return err
+			}
+		}
+		files[filepath.ToSlash(rel)] = fi
+		return nil
+	})
+	return files, err
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
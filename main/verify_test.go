@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRemoteFileInfo(t *testing.T) {
+	out := "12\tresults/a.json\x007\tb.out\x00" + remoteChecksumMarker + "\x00" +
+		"aaaa\tresults/a.json\x00bbbb\tb.out\x00"
+	files, err := parseRemoteFileInfo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := files["results/a.json"]; got.Size != 12 || got.SHA256 != "aaaa" {
+		t.Fatalf("a.json = %+v", got)
+	}
+	if got := files["b.out"]; got.Size != 7 || got.SHA256 != "bbbb" {
+		t.Fatalf("b.out = %+v", got)
+	}
+}
+
+func TestListRemoteFileInfoOddNames(t *testing.T) {
+	useExecutor(t, &localExecutor{})
+	root := t.TempDir()
+	names := []string{"plain.txt", "new\nline.txt", `back\slash.txt`}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := listRemoteFileInfo("u@h", sshHostOptions{}, root, "", nil, time.Time{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(names) {
+		t.Fatalf("files = %+v", files)
+	}
+	for _, name := range names {
+		sum := sha256.Sum256([]byte(name))
+		if got := files[name]; got.Size != int64(len(name)) || got.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%q = %+v", name, got)
+		}
+	}
+}
+
+func TestArtifactEntryState(t *testing.T) {
+	cases := []struct {
+		e    artifactEntry
+		want string
+	}{
+		{artifactEntry{Remote: &fileInfo{Size: 1}}, "missing"},
+		{artifactEntry{Local: &fileInfo{Size: 1}}, "extra"},
+		{artifactEntry{Remote: &fileInfo{Size: 1}, Local: &fileInfo{Size: 2}}, "size-mismatch"},
+		{artifactEntry{Remote: &fileInfo{Size: 1, SHA256: "a"}, Local: &fileInfo{Size: 1, SHA256: "b"}}, "checksum-mismatch"},
+		{artifactEntry{Remote: &fileInfo{Size: 1, SHA256: "a"}, Local: &fileInfo{Size: 1}}, "ok"},
+	}
+	for _, c := range cases {
+		if got := c.e.state(); got != c.want {
+			t.Errorf("state(%+v) = %s, want %s", c.e, got, c.want)
+		}
+	}
+}
+
+func TestListLocalFileInfo(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "x.txt"), []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, rsyncPartialDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, rsyncPartialDir, "big.bin"), []byte("half"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := listLocalFileInfo(dir, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := files["sub/x.txt"]
+	if got.Size != 3 || got.SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("sub/x.txt = %+v", got)
+	}
+	if len(files) != 1 {
+		t.Errorf("partial transfers should not be listed: %v", files)
+	}
+	missing, err := listLocalFileInfo(filepath.Join(dir, "nope"), false, false)
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("missing dir: %v %v", missing, err)
+	}
+}
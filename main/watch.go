@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// exp watch <id> [--poll-interval 30s]
+func cmdWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	pollIntervalFlag := durationFlag{value: defaultPollInterval}
+	fs.Var(&pollIntervalFlag, "poll-interval", "How frequently to poll job status (defaults to the interval recorded at submit time)")
+	var followLog bool
+	fs.BoolVar(&followLog, "follow-log", false, "Stream the job's log (tail -F over ssh) between the status lines")
+	var notify bool
+	var maxMonitor string
+	fs.StringVar(&maxMonitor, "max-monitor", "", "Stop watching after this long, leaving the job running (defaults to the run's max_monitor)")
+	fs.BoolVar(&notify, "notify-local", false, "Ring the terminal bell and post a desktop notification when the job ends (on by default for runs that set notify_local)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: exp watch <id> [--poll-interval 30s] [--follow-log] [--notify-local] [--max-monitor 12h]\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("experiment id is required")
+	}
+	idStr := positional[0]
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open DB: %w", err)
+	}
+	defer db.Close()
+
+	exp, err := findExperiment(db, idStr)
+	if err != nil {
+		return err
+	}
+	if exp.Remote == "" || exp.JobID == "" {
+		return fmt.Errorf("experiment %s has no recorded remote job", idStr)
+	}
+	if !isLiveStatus(exp.JobStatus) {
+		if exp.missedFinalSync() {
+			// It finished while nobody watched, say after max_monitor.
+			fmt.Printf("Experiment %d finished with status %s while unobserved; fetching its artifacts\n", exp.ID, exp.JobStatus)
+			return syncCompletedArtifacts(db, exp, nil)
+		}
+		fmt.Printf("Experiment %d already finished with status %s; nothing to watch\n", exp.ID, exp.JobStatus)
+		return nil
+	}
+	if maxMonitor == "" {
+		maxMonitor = exp.runSnapshot().MaxMonitor
+	}
+	maxMonitorDuration, err := parseMaxMonitor(maxMonitor)
+	if err != nil {
+		return err
+	}
+
+	interval := pollIntervalFlag.value
+	if !pollIntervalFlag.set {
+		if snap := exp.runSnapshot(); snap.PollInterval != "" {
+			if d, err := time.ParseDuration(snap.PollInterval); err == nil && d > 0 {
+				interval = d
+			}
+		}
+	}
+	return monitorExperiment(db, exp, interval, monitorOptions{FollowLog: followLog, NotifyLocal: notify, MaxMonitor: maxMonitorDuration})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Config files repeat themselves, the same artifact_sources in four
+// profiles, say; YAML anchors name a node once (&name) and aliases (*name)
+// repeat it, while a merge key (<<: *name, or <<: [*a, *b]) copies an
+// anchored mapping's keys into another mapping without overriding the keys
+// it sets itself. parseYAMLDocument resolves them as it reads, so an alias
+// may only refer to an anchor above it.
+//
+// Anchor names are letters, digits, _ and -. Anything else after * or &
+// stays a plain string, as it always was here: a pattern list item such as
+// - *.ckpt is still the pattern.
+
+var yamlAnchorName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// yamlAnchors holds the anchored nodes of one document.
+type yamlAnchors struct {
+	values map[string]interface{}
+	// open are the anchors whose node is still being read; an alias to one
+	// of them would contain itself.
+	open map[string]bool
+}
+
+func newYAMLAnchors() *yamlAnchors {
+	return &yamlAnchors{values: make(map[string]interface{}), open: make(map[string]bool)}
+}
+
+// cutYAMLAnchor splits "&name rest" into name and rest.
+func cutYAMLAnchor(value string) (name, rest string, ok bool) {
+	if !strings.HasPrefix(value, "&") {
+		return "", value, false
+	}
+	name, rest, _ = strings.Cut(value[1:], " ")
+	if !yamlAnchorName.MatchString(name) {
+		return "", value, false
+	}
+	return name, strings.TrimSpace(rest), true
+}
+
+// yamlAliasName returns name for a value that is exactly "*name".
+func yamlAliasName(value string) (string, bool) {
+	if !strings.HasPrefix(value, "*") || !yamlAnchorName.MatchString(value[1:]) {
+		return "", false
+	}
+	return value[1:], true
+}
+
+// begin marks name, when there is one, as being read.
+func (a *yamlAnchors) begin(name string) {
+	if name != "" {
+		a.open[name] = true
+	}
+}
+
+// define stores the node read for name, when there is one.
+func (a *yamlAnchors) define(name string, value interface{}) {
+	if name == "" {
+		return
+	}
+	delete(a.open, name)
+	a.values[name] = value
+}
+
+// resolve returns the node the alias *name on line refers to.
+func (a *yamlAnchors) resolve(name string, line int) (interface{}, error) {
+	if a.open[name] {
+		return nil, fmt.Errorf("line %d: alias *%s is inside the node anchored &%s (a cycle)", line, name, name)
+	}
+	v, ok := a.values[name]
+	if !ok {
+		return nil, fmt.Errorf("line %d: alias *%s refers to no anchor &%s defined above it", line, name, name)
+	}
+	return v, nil
+}
+
+// scalar reads the inline value val on line, which may be an alias, an
+// anchored scalar, or a flow list of aliases such as [*a, *b].
+func (a *yamlAnchors) scalar(val string, line int) (interface{}, error) {
+	if name, ok := yamlAliasName(val); ok {
+		return a.resolve(name, line)
+	}
+	if name, rest, ok := cutYAMLAnchor(val); ok {
+		v, err := a.scalar(rest, line)
+		if err != nil {
+			return nil, err
+		}
+		a.define(name, v)
+		return v, nil
+	}
+	if strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]") {
+		var items []interface{}
+		for _, item := range strings.Split(val[1:len(val)-1], ",") {
+			name, ok := yamlAliasName(strings.TrimSpace(item))
+			if !ok {
+				return parseYAMLScalar(val), nil
+			}
+			v, err := a.resolve(name, line)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+	return parseYAMLScalar(val), nil
+}
+
+// yamlMerge is the value of a << key, and its line.
+type yamlMerge struct {
+	value interface{}
+	line  int
+}
+
+// mergeYAML adds to m the keys of the mappings merged into it that m does
+// not set itself; of several merged mappings, the first to set a key wins.
+func mergeYAML(m map[string]interface{}, merges []yamlMerge) error {
+	for _, merge := range merges {
+		sources, ok := merge.value.([]interface{})
+		if !ok {
+			sources = []interface{}{merge.value}
+		}
+		for _, src := range sources {
+			from, ok := src.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("line %d: << merges a mapping or a list of mappings, not %T", merge.line, src)
+			}
+			for k, v := range from {
+				if _, set := m[k]; !set {
+					m[k] = v
+				}
+			}
+		}
+	}
+	return nil
+}
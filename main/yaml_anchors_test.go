@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLAnchorsAcrossProfiles(t *testing.T) {
+	doc := `
+patterns:
+  - &first metrics.json
+  - &second "loss.csv"
+defaults: &defaults
+  remote: u@cluster   # shared by every profile
+  log_dir: /scratch/u/logs
+  artifact_sources: &sources
+    - path: /scratch/u/run
+      artifact_patterns: ["*.json", "*.pt"]
+    - path: /scratch/u/eval
+      artifact_patterns:
+        - *.csv
+profiles:
+  gpu:
+    <<: *defaults
+    poll_interval: 1m
+  debug:
+    <<: *defaults
+    remote: u@debug
+  other:
+    remote: u@other
+    artifact_sources: *sources
+    artifact_patterns: [*first, *second]
+`
+	var cfg Config
+	if err := unmarshalYAML([]byte(doc), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	sources := []ArtifactSource{
+		{Path: "/scratch/u/run", Patterns: []string{"*.json", "*.pt"}},
+		{Path: "/scratch/u/eval", Patterns: []string{"*.csv"}},
+	}
+	gpu, debug, other := cfg.Profiles["gpu"], cfg.Profiles["debug"], cfg.Profiles["other"]
+	if gpu.Remote != "u@cluster" || gpu.LogDir != "/scratch/u/logs" || gpu.PollInterval != "1m" || !reflect.DeepEqual(gpu.ArtifactSources, sources) {
+		t.Errorf("gpu = %+v", gpu)
+	}
+	if debug.Remote != "u@debug" || debug.LogDir != "/scratch/u/logs" {
+		t.Errorf("debug: a key set next to << must win, got %+v", debug)
+	}
+	if !reflect.DeepEqual(other.ArtifactSources, sources) || !reflect.DeepEqual(other.ArtifactPatterns, []string{"metrics.json", "loss.csv"}) {
+		t.Errorf("other = %+v", other)
+	}
+	if !reflect.DeepEqual(cfg.Defaults.ArtifactSources, sources) {
+		t.Errorf("defaults = %+v", cfg.Defaults)
+	}
+}
+
+func TestYAMLMergeOrder(t *testing.T) {
+	doc := `
+a: &a
+  x: 1
+  y: 1
+b: &b
+  y: 2
+  z: 2
+c:
+  <<: [*a, *b]
+  x: 3
+items:
+  - &item
+    name: one
+  - *item
+`
+	m, err := parseYAMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"x": "3", "y": "1", "z": "2"}; !reflect.DeepEqual(m["c"], want) {
+		t.Errorf("c = %v, want %v", m["c"], want)
+	}
+	item := map[string]interface{}{"name": "one"}
+	if want := []interface{}{item, item}; !reflect.DeepEqual(m["items"], want) {
+		t.Errorf("items = %v", m["items"])
+	}
+}
+
+func TestYAMLAnchorErrors(t *testing.T) {
+	tests := []struct{ doc, want string }{
+		{"a:\n  b: 1\nc: *defualts\n", "line 3: alias *defualts refers to no anchor &defualts"},
+		{"c:\n  <<: *later\nlater: &later\n  x: 1\n", "line 2: alias *later refers to no anchor"},
+		{"a: &loop\n  b:\n    <<: *loop\n", "line 3: alias *loop is inside the node anchored &loop"},
+		{"a: &s hello\nb:\n  <<: *s\n", "line 3: << merges a mapping"},
+	}
+	for _, tt := range tests {
+		_, err := parseYAMLDocument([]byte(tt.doc))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: err = %v, want %q", tt.doc, err, tt.want)
+		}
+	}
+}
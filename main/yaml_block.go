@@ -0,0 +1,117 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Block scalars carry multi-line text such as an inline build script:
+//
+//	build_script_inline: |
+//	  module load cuda
+//	  make -j8
+//
+// A literal block (|) keeps its line breaks; a folded one (>) joins lines
+// into one, except around blank and more-indented lines. The indentation of
+// the first line is stripped from every line unless an indentation
+// indicator (|2) says how much to strip. Chomping decides the final line
+// breaks: clip (the default) keeps one, strip (-) none, keep (+) all.
+
+var yamlBlockHeader = regexp.MustCompile(`^[|>]([1-9][+-]?|[+-][1-9]?)?$`)
+
+// isYAMLBlockHeader reports whether an inline value starts a block scalar.
+func isYAMLBlockHeader(value string) bool {
+	return yamlBlockHeader.MatchString(value)
+}
+
+// parseYAMLBlockScalar reads the block scalar introduced by header on
+// lines[start-1], whose node is indented by indent, and returns it and the
+// index of the first line after it.
+func parseYAMLBlockScalar(lines []string, start, indent int, header string) (string, int) {
+	folded := header[0] == '>'
+	chomp, explicit := byte(0), 0
+	for _, c := range []byte(header[1:]) {
+		if c == '+' || c == '-' {
+			chomp = c
+		} else {
+			explicit = int(c - '0')
+		}
+	}
+	contentIndent := indent + explicit
+	var content []string
+	i := start
+	for ; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if strings.TrimSpace(line) == "" {
+			content = append(content, "")
+			continue
+		}
+		lead := len(line) - len(strings.TrimLeft(line, " "))
+		if explicit == 0 && contentIndent == indent {
+			// The first line with text sets the indentation.
+			if lead <= indent {
+				break
+			}
+			contentIndent = lead
+		}
+		if lead < contentIndent {
+			break
+		}
+		content = append(content, line[contentIndent:])
+	}
+
+	// Trailing blank lines are the block's final line breaks.
+	trailing := 0
+	for len(content) > 0 && content[len(content)-1] == "" {
+		content = content[:len(content)-1]
+		trailing++
+	}
+	var body string
+	if folded {
+		body = foldYAMLLines(content)
+	} else {
+		body = strings.Join(content, "\n")
+	}
+	switch {
+	case len(content) == 0 && chomp == '+':
+		body = strings.Repeat("\n", trailing)
+	case len(content) == 0:
+	case chomp == '-':
+	case chomp == '+':
+		body += "\n" + strings.Repeat("\n", trailing)
+	default:
+		body += "\n"
+	}
+	return body, i
+}
+
+// foldYAMLLines joins the lines of a folded block: neighbouring lines of
+// text become one line, each blank line between them a line break, and
+// more-indented lines keep their breaks.
+func foldYAMLLines(lines []string) string {
+	var b strings.Builder
+	blanks := 0
+	prevText := false
+	for n, line := range lines {
+		if line == "" {
+			blanks++
+			continue
+		}
+		text := line[0] != ' ' && line[0] != '\t'
+		switch {
+		case n == blanks:
+			// Leading blank lines.
+			b.WriteString(strings.Repeat("\n", blanks))
+		case prevText && text && blanks == 0:
+			b.WriteByte(' ')
+		case prevText && text:
+			b.WriteString(strings.Repeat("\n", blanks))
+		default:
+			b.WriteString(strings.Repeat("\n", blanks+1))
+		}
+		b.WriteString(line)
+		prevText = text
+		blanks = 0
+	}
+	return b.String()
+}
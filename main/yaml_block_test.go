@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestYAMLBlockChomping(t *testing.T) {
+	doc := "clip: |\n  one\n  two\n\n\n" +
+		"strip: |-\n  one\n  two\n\n" +
+		"keep: |+\n  one\n  two\n\n\n" +
+		"empty: |\n" +
+		"folded: >\n  one\n  two\n\n  three\n    indented\n  four\n\n" +
+		"folded_strip: >-\n  one\n  two\n" +
+		"explicit: |2\n     four spaces kept\n    two\n" +
+		"after: done # a comment\n"
+	m, err := parseYAMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"clip":         "one\ntwo\n",
+		"strip":        "one\ntwo",
+		"keep":         "one\ntwo\n\n\n",
+		"empty":        "",
+		"folded":       "one two\nthree\n  indented\nfour\n",
+		"folded_strip": "one two",
+		"explicit":     "   four spaces kept\n  two\n",
+		"after":        "done",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %#v\nwant %#v", m, want)
+	}
+}
+
+func TestYAMLBlockInListItems(t *testing.T) {
+	doc := `
+steps:
+  - name: build
+    run: |
+      module load cuda   # not a comment
+      make -j8
+    after: test
+  - |-
+    plain item
+    second line
+  - &setup >
+    folded
+    item
+  - *setup
+metrics:
+  - pattern: "x"
+`
+	m, err := parseYAMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		map[string]interface{}{"name": "build", "run": "module load cuda   # not a comment\nmake -j8\n", "after": "test"},
+		"plain item\nsecond line",
+		"folded item\n",
+		"folded item\n",
+	}
+	if !reflect.DeepEqual(m["steps"], want) {
+		t.Errorf("steps = %#v", m["steps"])
+	}
+	if got := m["metrics"]; !reflect.DeepEqual(got, []interface{}{map[string]interface{}{"pattern": "x"}}) {
+		t.Errorf("metrics after the blocks = %#v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Indentation mistakes are the usual reason a hand-edited config fails to
+// parse, and a bare line number rarely shows what is wrong with a line
+// that looks fine in the editor. These errors quote the line, point a
+// caret at the offending column and say what the parser expected:
+//
+//	line 4: unexpected indentation: expected 2 spaces, found 4
+//	  4 |     log_dir: /scratch/logs
+//	    |     ^
+//	  hint: nested keys are indented exactly 2 spaces more than their parent key
+//
+// Tabs are rejected rather than expanded: how wide a tab is depends on the
+// editor, so any width picked here would silently misread someone's file.
+
+const yamlTabHint = "YAML indents with spaces only; convert tabs to spaces (e.g. expand -t 2 FILE) or set the editor to insert spaces"
+
+// yamlSyntaxError is a parse error at a column of one line.
+type yamlSyntaxError struct {
+	Line   int    // 1-based
+	Column int    // byte offset of the caret in Text
+	Text   string // the line as written
+	Msg    string
+	Hint   string
+}
+
+func (e *yamlSyntaxError) Error() string {
+	num := strconv.Itoa(e.Line)
+	// Tabs before the caret are kept so it lines up under the same column.
+	pad := []byte(e.Text[:min(e.Column, len(e.Text))])
+	for i, c := range pad {
+		if c != '\t' {
+			pad[i] = ' '
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "line %d: %s\n", e.Line, e.Msg)
+	fmt.Fprintf(&b, "  %s | %s\n", num, e.Text)
+	fmt.Fprintf(&b, "  %s | %s^", strings.Repeat(" ", len(num)), pad)
+	if e.Hint != "" {
+		fmt.Fprintf(&b, "\n  hint: %s", e.Hint)
+	}
+	return b.String()
+}
+
+// yamlLineError places err, from reading lines[i], on its line.
+func yamlLineError(lines []string, i int, err error) error {
+	if e, ok := err.(*yamlSyntaxError); ok {
+		e.Line = i + 1
+		e.Text = strings.TrimRight(lines[i], "\r")
+		return e
+	}
+	return fmt.Errorf("line %d: %w", i+1, err)
+}
+
+// yamlIndentError reports lines[i], indented by found spaces where the
+// parser expected want.
+func yamlIndentError(lines []string, i, want, found int, what, hint string) error {
+	return yamlLineError(lines, i, &yamlSyntaxError{
+		Column: found,
+		Msg:    fmt.Sprintf("unexpected indentation%s: expected %s, found %d", what, pluralSpaces(want), found),
+		Hint:   hint,
+	})
+}
+
+func pluralSpaces(n int) string {
+	if n == 1 {
+		return "1 space"
+	}
+	return fmt.Sprintf("%d spaces", n)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestYAMLIndentationErrors(t *testing.T) {
+	const tabHint = "  hint: YAML indents with spaces only; convert tabs to spaces (e.g. expand -t 2 FILE) or set the editor to insert spaces"
+	tests := []struct{ file, want string }{
+		{"tab_indent.yaml", "line 2: tab in indentation\n" +
+			"  2 | \tremote: u@cluster\n" +
+			"    | ^\n" + tabHint},
+		{"mixed_tabs.yaml", "line 3: tab in indentation\n" +
+			"  3 |   \tlog_dir: /scratch/logs\n" +
+			"    |   ^\n" + tabHint},
+		{"four_space_indent.yaml", "line 2: unexpected indentation: expected 2 spaces, found 4\n" +
+			"  2 |     gpu:\n" +
+			"    |     ^\n" +
+			"  hint: nested keys and list items are indented exactly 2 spaces more than their parent key"},
+		{"over_indented_key.yaml", "line 3: unexpected indentation: expected 2 spaces, found 4\n" +
+			"  3 |     log_dir: /scratch/logs\n" +
+			"    |     ^\n" +
+			"  hint: only a key with nothing after its ':' has lines nested under it, indented 2 spaces more than the key"},
+		{"list_item_indent.yaml", "line 3: unexpected indentation for list item: expected 2 spaces, found 3\n" +
+			"  3 |    - \"*.pt\"\n" +
+			"    |    ^\n" +
+			"  hint: the items of a list all start at the same column"},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", "yaml", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseYAMLDocument(data)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err =\n%v\nwant\n%s", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestYAMLTabsAfterIndentation(t *testing.T) {
+	m, err := parseYAMLDocument([]byte("defaults:\n  remote:\tu@cluster\t# tab before the comment\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m["defaults"].(map[string]interface{})["remote"]; got != "u@cluster" {
+		t.Errorf("remote = %q", got)
+	}
+}